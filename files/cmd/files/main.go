@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/bencyrus/chatterbox/files/internal/config"
@@ -13,9 +15,17 @@ import (
 	"github.com/bencyrus/chatterbox/files/internal/proxytoken"
 	"github.com/bencyrus/chatterbox/shared/logger"
 	"github.com/bencyrus/chatterbox/shared/middleware"
+	"github.com/bencyrus/chatterbox/shared/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func main() {
+	selftestFlag := flag.Bool("selftest", false, "validate config and dependencies, print a JSON report, and exit")
+	flag.Parse()
+	if *selftestFlag {
+		os.Exit(runSelftest())
+	}
+
 	cfg := config.Load()
 
 	// Initialize the centralized logger
@@ -24,6 +34,16 @@ func main() {
 
 	logger.Info(ctx, "starting files http server", logger.Fields{"port": cfg.Port})
 
+	// Initialize tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := tracing.Init(ctx, "files")
+	if err != nil {
+		logger.Error(ctx, "failed to initialize tracing", err)
+		log.Fatal(err)
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	db, err := database.NewClient(cfg.DatabaseURL)
 	if err != nil {
 		logger.Error(ctx, "failed to initialize database", err)
@@ -52,6 +72,8 @@ func main() {
 	mux.HandleFunc("/signed_download_url", httpSrv.SignedDownloadURLHandler)
 	mux.HandleFunc("/signed_upload_url", httpSrv.SignedUploadURLHandler)
 	mux.HandleFunc("/signed_delete_url", httpSrv.SignedDeleteURLHandler)
+	mux.HandleFunc("/signed_object_url", httpSrv.SignedObjectURLHandler)
+	mux.HandleFunc("/signed_media_url", httpSrv.SignedMediaURLHandler)
 
 	// Proxy URL minting (called by the gateway, behind the API key).
 	mux.HandleFunc("/proxy_upload_url", httpSrv.ProxyUploadURLHandler)
@@ -65,8 +87,9 @@ func main() {
 	// token-authorized streaming endpoints (/u/, /d/).
 	protected := httpSrv.WithAPIKeyAuth(mux)
 
-	// Wrap with request ID middleware
-	handler := middleware.RequestIDMiddleware(protected)
+	// Wrap with request ID middleware, then tracing so spans continue the
+	// caller's trace (e.g. a worker task) via the traceparent header.
+	handler := otelhttp.NewHandler(middleware.RequestIDMiddleware(protected), "files")
 
 	// Note: ReadTimeout/WriteTimeout are intentionally left unset (0) so large
 	// media uploads/downloads are not truncated mid-stream. ReadHeaderTimeout
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/bencyrus/chatterbox/files/internal/config"
+	"github.com/bencyrus/chatterbox/files/internal/database"
+	"github.com/bencyrus/chatterbox/files/internal/gcs"
+	"github.com/bencyrus/chatterbox/shared/selftest"
+)
+
+// selftestTimeout bounds the whole self-test so a hung dependency fails the
+// deploy gate instead of stalling it.
+const selftestTimeout = 30 * time.Second
+
+// runSelftest validates configuration, connects to the database, runs the
+// no-op internal.selftest function, and signs a test URL with the configured
+// service account. It returns the process exit code.
+func runSelftest() int {
+	ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+	defer cancel()
+
+	r := selftest.New("files")
+
+	var cfg config.Config
+	if !r.Check("config", func() error {
+		cfg = config.Load()
+		return nil
+	}) {
+		r.Skip("database", "config failed")
+		r.Skip("db_function", "config failed")
+		r.Skip("sign_url", "config failed")
+		return r.Finish(os.Stdout)
+	}
+
+	var db *database.Client
+	if r.Check("database", func() error {
+		var err error
+		db, err = database.NewClient(cfg.DatabaseURL)
+		return err
+	}) {
+		defer db.Close()
+		r.Check("db_function", func() error {
+			return db.Selftest(ctx)
+		})
+	} else {
+		r.Skip("db_function", "database failed")
+	}
+
+	r.Check("sign_url", func() error {
+		_, err := gcs.SignedDownloadURL(cfg.GCSBucket, "selftest", cfg.GCSSigningEmail, cfg.GCSSigningPrivateKey, time.Minute)
+		return err
+	})
+
+	return r.Finish(os.Stdout)
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
@@ -17,6 +18,14 @@ type Config struct {
 	GCSSigningPrivateKey   string
 	GCSBucket              string
 	GCSSignedURLTTLSeconds int
+	// Shorter TTL for streaming URLs minted per request by /signed_media_url.
+	GCSMediaURLTTLSeconds int
+	// Signed download URLs kept in memory by file id and reused for the
+	// first half of their TTL; 0 disables the cache.
+	SignedURLCacheMaxEntries int
+	// Headers signed into every upload URL (e.g. Cache-Control); upload
+	// intents' own signed_headers override these per name.
+	GCSUploadDefaultHeaders map[string]string
 
 	// High-level environment mode: e.g. "local" or "prod".
 	// We only talk to the GCS emulator when this is explicitly "local".
@@ -55,6 +64,12 @@ const (
 
 	EnvGCSBucket       = "GCS_CHATTERBOX_BUCKET"
 	EnvGCSSignedURLTTL = "GCS_CHATTERBOX_SIGNED_URL_TTL_SECONDS"
+	EnvGCSMediaURLTTL  = "GCS_CHATTERBOX_MEDIA_URL_TTL_SECONDS"
+
+	EnvSignedURLCacheMaxEntries = "FILES_SIGNED_URL_CACHE_MAX_ENTRIES"
+
+	// JSON object of default headers signed into upload URLs
+	EnvGCSUploadDefaultHeaders = "GCS_CHATTERBOX_UPLOAD_DEFAULT_HEADERS"
 
 	EnvFileServiceAPIKey = "FILE_SERVICE_API_KEY"
 
@@ -102,6 +117,31 @@ func Load() Config {
 		panic("GCS_SIGNED_URL_TTL_SECONDS must be a positive integer")
 	}
 
+	mediaTTLStr := strings.TrimSpace(os.Getenv(EnvGCSMediaURLTTL))
+	if mediaTTLStr == "" {
+		mediaTTLStr = "300"
+	}
+	mediaTTLSeconds, err := strconv.Atoi(mediaTTLStr)
+	if err != nil || mediaTTLSeconds <= 0 {
+		panic("GCS_CHATTERBOX_MEDIA_URL_TTL_SECONDS must be a positive integer")
+	}
+
+	cacheStr := strings.TrimSpace(os.Getenv(EnvSignedURLCacheMaxEntries))
+	if cacheStr == "" {
+		cacheStr = "10000"
+	}
+	cacheMaxEntries, err := strconv.Atoi(cacheStr)
+	if err != nil || cacheMaxEntries < 0 {
+		panic("FILES_SIGNED_URL_CACHE_MAX_ENTRIES must be a non-negative integer")
+	}
+
+	var uploadDefaultHeaders map[string]string
+	if raw := strings.TrimSpace(os.Getenv(EnvGCSUploadDefaultHeaders)); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &uploadDefaultHeaders); err != nil {
+			panic("GCS_CHATTERBOX_UPLOAD_DEFAULT_HEADERS must be a JSON object of string values")
+		}
+	}
+
 	apiKey := strings.TrimSpace(os.Getenv(EnvFileServiceAPIKey))
 	if apiKey == "" {
 		panic("FILE_SERVICE_API_KEY is required for files service")
@@ -127,17 +167,20 @@ func Load() Config {
 	storageEmulatorHost := strings.TrimSpace(os.Getenv(EnvStorageEmulatorHost))
 
 	return Config{
-		Port:                   port,
-		DatabaseURL:            dbURL,
-		GCSSigningEmail:        signingEmail,
-		GCSSigningPrivateKey:   privateKey,
-		GCSBucket:              bucket,
-		GCSSignedURLTTLSeconds: ttlSeconds,
-		FileServiceAPIKey:      apiKey,
-		Environment:            environment,
-		GCSEmulatorURL:         emulatorURL,
-		FilesPublicBaseURL:     publicBaseURL,
-		ProxySigningSecret:     proxySecret,
-		StorageEmulatorHost:    storageEmulatorHost,
+		Port:                     port,
+		DatabaseURL:              dbURL,
+		GCSSigningEmail:          signingEmail,
+		GCSSigningPrivateKey:     privateKey,
+		GCSBucket:                bucket,
+		GCSSignedURLTTLSeconds:   ttlSeconds,
+		GCSMediaURLTTLSeconds:    mediaTTLSeconds,
+		SignedURLCacheMaxEntries: cacheMaxEntries,
+		GCSUploadDefaultHeaders:  uploadDefaultHeaders,
+		FileServiceAPIKey:        apiKey,
+		Environment:              environment,
+		GCSEmulatorURL:           emulatorURL,
+		FilesPublicBaseURL:       publicBaseURL,
+		ProxySigningSecret:       proxySecret,
+		StorageEmulatorHost:      storageEmulatorHost,
 	}
 }
@@ -34,6 +34,25 @@ func (c *Client) Close() error {
 	return c.db.Close()
 }
 
+// Selftest runs the no-op internal.selftest function, proving the service's
+// role can execute functions.
+func (c *Client) Selftest(ctx context.Context) error {
+	var raw []byte
+	if err := c.db.QueryRowContext(ctx, `select internal.selftest('{}'::jsonb)`).Scan(&raw); err != nil {
+		return fmt.Errorf("failed to run internal.selftest: %w", err)
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("failed to decode internal.selftest result: %w", err)
+	}
+	if result.Status != "succeeded" {
+		return fmt.Errorf("internal.selftest returned status %q", result.Status)
+	}
+	return nil
+}
+
 // LookupFiles calls files.lookup_files(bigint[]) and returns the result as a slice of FileMetadata.
 func (c *Client) LookupFiles(ctx context.Context, ids []int64) ([]filetypes.FileMetadata, error) {
 	const query = `select * from files.lookup_files($1::bigint[])`
@@ -60,13 +60,31 @@ func (c *DataClient) Close() error {
 }
 
 // UploadStream streams the contents of r into the given bucket/object, setting
-// the provided content type. It does not buffer the entire body in memory.
-func (c *DataClient) UploadStream(ctx context.Context, bucket, objectKey, contentType string, r io.Reader) (int64, error) {
+// the provided content type and any upload headers (see UploadHeaders) as
+// object metadata. It does not buffer the entire body in memory.
+func (c *DataClient) UploadStream(ctx context.Context, bucket, objectKey, contentType string, headers map[string]string, r io.Reader) (int64, error) {
 	obj := c.client.Bucket(bucket).Object(objectKey)
 	w := obj.NewWriter(ctx)
 	if contentType != "" {
 		w.ContentType = contentType
 	}
+	for name, value := range headers {
+		switch name {
+		case "Cache-Control":
+			w.CacheControl = value
+		case "Content-Disposition":
+			w.ContentDisposition = value
+		case "Content-Encoding":
+			w.ContentEncoding = value
+		case "Content-Language":
+			w.ContentLanguage = value
+		default:
+			if w.Metadata == nil {
+				w.Metadata = make(map[string]string)
+			}
+			w.Metadata[strings.TrimPrefix(name, "x-goog-meta-")] = value
+		}
+	}
 
 	n, err := io.Copy(w, r)
 	if err != nil {
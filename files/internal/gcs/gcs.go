@@ -1,6 +1,8 @@
 package gcs
 
 import (
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -8,6 +10,7 @@ import (
 )
 
 // SignedDownloadURL generates a V4 signed URL for downloading an object from GCS.
+// Only the host header is signed, so clients may send Range requests against it.
 func SignedDownloadURL(bucket, objectKey, serviceAccountEmail, privateKey string, ttl time.Duration) (string, error) {
 	// Convert literal \n sequences back into real newlines for the private key.
 	key := strings.ReplaceAll(privateKey, `\n`, "\n")
@@ -21,11 +24,43 @@ func SignedDownloadURL(bucket, objectKey, serviceAccountEmail, privateKey string
 	})
 }
 
+// SignedMediaURL generates a V4 signed GET URL suited to in-browser media
+// playback. Like SignedDownloadURL it leaves Range unsigned so players can seek,
+// and it asks GCS to serve the object inline with the given content type so the
+// browser streams it instead of downloading it.
+func SignedMediaURL(bucket, objectKey, contentType, serviceAccountEmail, privateKey string, ttl time.Duration) (string, error) {
+	// Convert literal \n sequences back into real newlines for the private key.
+	key := strings.ReplaceAll(privateKey, `\n`, "\n")
+
+	params := url.Values{}
+	params.Set("response-content-disposition", "inline")
+	if contentType != "" {
+		params.Set("response-content-type", contentType)
+	}
+
+	return storage.SignedURL(bucket, objectKey, &storage.SignedURLOptions{
+		Scheme:          storage.SigningSchemeV4,
+		Method:          "GET",
+		Expires:         time.Now().Add(ttl),
+		GoogleAccessID:  serviceAccountEmail,
+		PrivateKey:      []byte(key),
+		QueryParameters: params,
+	})
+}
+
 // SignedUploadURL generates a V4 signed URL for uploading an object to GCS.
-func SignedUploadURL(bucket, objectKey, contentType, serviceAccountEmail, privateKey string, ttl time.Duration) (string, error) {
+// headers (see UploadHeaders) are included in the signature, so the client must
+// send exactly those headers with the PUT.
+func SignedUploadURL(bucket, objectKey, contentType string, headers map[string]string, serviceAccountEmail, privateKey string, ttl time.Duration) (string, error) {
 	// Convert literal \n sequences back into real newlines for the private key.
 	key := strings.ReplaceAll(privateKey, `\n`, "\n")
 
+	signed := make([]string, 0, len(headers))
+	for name, value := range headers {
+		signed = append(signed, name+":"+value)
+	}
+	sort.Strings(signed)
+
 	return storage.SignedURL(bucket, objectKey, &storage.SignedURLOptions{
 		Scheme:         storage.SigningSchemeV4,
 		Method:         "PUT",
@@ -33,9 +68,43 @@ func SignedUploadURL(bucket, objectKey, contentType, serviceAccountEmail, privat
 		GoogleAccessID: serviceAccountEmail,
 		PrivateKey:     []byte(key),
 		ContentType:    contentType,
+		Headers:        signed,
 	})
 }
 
+// uploadHeaderNames are the standard headers an upload intent may sign, in
+// canonical form. x-goog-meta-* custom metadata headers are also allowed.
+var uploadHeaderNames = map[string]string{
+	"cache-control":       "Cache-Control",
+	"content-disposition": "Content-Disposition",
+	"content-encoding":    "Content-Encoding",
+	"content-language":    "Content-Language",
+}
+
+// UploadHeaders merges configured default upload headers with an upload
+// intent's own (intent values win) and keeps only headers GCS accepts on an
+// upload: Cache-Control, Content-Disposition, Content-Encoding,
+// Content-Language and x-goog-meta-*. Names are canonicalized (x-goog-meta-*
+// lowercased) and dropped names are returned for logging.
+func UploadHeaders(defaults, intent map[string]string) (map[string]string, []string) {
+	out := make(map[string]string, len(defaults)+len(intent))
+	var dropped []string
+	for _, src := range []map[string]string{defaults, intent} {
+		for name, value := range src {
+			lower := strings.ToLower(strings.TrimSpace(name))
+			switch {
+			case uploadHeaderNames[lower] != "":
+				out[uploadHeaderNames[lower]] = strings.TrimSpace(value)
+			case strings.HasPrefix(lower, "x-goog-meta-") && len(lower) > len("x-goog-meta-"):
+				out[lower] = strings.TrimSpace(value)
+			default:
+				dropped = append(dropped, name)
+			}
+		}
+	}
+	return out, dropped
+}
+
 // SignedDeleteURL generates a V4 signed URL for deleting an object from GCS.
 func SignedDeleteURL(bucket, objectKey, serviceAccountEmail, privateKey string, ttl time.Duration) (string, error) {
 	// Convert literal \n sequences back into real newlines for the private key.
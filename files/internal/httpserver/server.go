@@ -1,6 +1,7 @@
 package httpserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,6 +16,9 @@ import (
 	"github.com/bencyrus/chatterbox/files/internal/database"
 	"github.com/bencyrus/chatterbox/files/internal/gcs"
 	"github.com/bencyrus/chatterbox/files/internal/proxytoken"
+	filetypes "github.com/bencyrus/chatterbox/files/internal/types"
+	"github.com/bencyrus/chatterbox/files/internal/urlcache"
+	"github.com/bencyrus/chatterbox/shared/apierror"
 	"github.com/bencyrus/chatterbox/shared/logger"
 )
 
@@ -24,6 +28,7 @@ type Server struct {
 	db     *database.Client
 	data   *gcs.DataClient
 	signer *proxytoken.Signer
+	urls   *urlcache.Cache
 }
 
 // NewServer constructs a new HTTP server instance.
@@ -33,6 +38,7 @@ func NewServer(cfg config.Config, db *database.Client, data *gcs.DataClient, sig
 		db:     db,
 		data:   data,
 		signer: signer,
+		urls:   urlcache.New(cfg.SignedURLCacheMaxEntries),
 	}
 }
 
@@ -83,7 +89,7 @@ func (s *Server) WithAPIKeyAuth(next http.Handler) http.Handler {
 		providedKey := r.Header.Get("X-File-Service-Api-Key")
 		if providedKey == "" || providedKey != s.cfg.FileServiceAPIKey {
 			logger.Warn(ctx, "missing or invalid file service API key")
-			http.Error(w, "forbidden", http.StatusForbidden)
+			apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "forbidden")
 			return
 		}
 
@@ -107,7 +113,7 @@ func (s *Server) SignedDownloadURLHandler(w http.ResponseWriter, r *http.Request
 		logger.Warn(ctx, "invalid method for signed_download_url endpoint", logger.Fields{
 			"method": r.Method,
 		})
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -115,21 +121,21 @@ func (s *Server) SignedDownloadURLHandler(w http.ResponseWriter, r *http.Request
 	var body map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		logger.Error(ctx, "failed to decode request body", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
 		return
 	}
 
 	arr, ok := body["files"]
 	if !ok {
 		logger.Warn(ctx, "missing files field in request")
-		http.Error(w, "missing files", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing files")
 		return
 	}
 
 	items, ok := arr.([]any)
 	if !ok {
 		logger.Warn(ctx, "files field is not an array")
-		http.Error(w, "files must be an array", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "files must be an array")
 		return
 	}
 
@@ -152,17 +158,25 @@ func (s *Server) SignedDownloadURLHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Every file is looked up, so deleted files get no URL even while one is
+	// cached; URLs still fresh in the cache are reused instead of signed.
 	metadata, err := s.db.LookupFiles(ctx, normalizedIDs)
 	if err != nil {
 		logger.Error(ctx, "failed to lookup files in database", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
-	out := make([]map[string]any, 0, len(metadata))
 	ttl := time.Duration(s.cfg.GCSSignedURLTTLSeconds) * time.Second
 
+	out := make([]map[string]any, 0, len(metadata))
+	cached := 0
 	for _, m := range metadata {
+		if url, ok := s.urls.Get(m.FileID); ok {
+			out = append(out, map[string]any{"file_id": m.FileID, "url": url})
+			cached++
+			continue
+		}
 		url, err := gcs.SignedDownloadURL(s.cfg.GCSBucket, m.ObjectKey, s.cfg.GCSSigningEmail, s.cfg.GCSSigningPrivateKey, ttl)
 		if err != nil {
 			logger.Error(ctx, "failed to generate signed URL", err, logger.Fields{
@@ -170,9 +184,11 @@ func (s *Server) SignedDownloadURLHandler(w http.ResponseWriter, r *http.Request
 			})
 			continue
 		}
+		url = s.rewriteForEmulator(url)
+		s.urls.Put(m.FileID, url, ttl)
 		out = append(out, map[string]any{
 			"file_id": m.FileID,
-			"url":     s.rewriteForEmulator(url),
+			"url":     url,
 		})
 	}
 
@@ -185,12 +201,141 @@ func (s *Server) SignedDownloadURLHandler(w http.ResponseWriter, r *http.Request
 
 	logger.Info(ctx, "signed URLs generated successfully", logger.Fields{
 		"processed_files": len(out),
+		"cached_files":    cached,
+	})
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(out); err != nil {
+		logger.Error(ctx, "failed to encode response", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
+	}
+}
+
+// SignedMediaURLHandler mints a single short-lived signed URL for streaming a
+// file in a media player (POST {"file_id": n}). The URL expires after
+// GCS_CHATTERBOX_MEDIA_URL_TTL_SECONDS; callers re-request it to refresh. The
+// response carries expires_at so players can refresh before it lapses.
+func (s *Server) SignedMediaURLHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		logger.Warn(ctx, "invalid method for signed_media_url endpoint", logger.Fields{
+			"method": r.Method,
+		})
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		FileID int64 `json:"file_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.FileID <= 0 {
+		logger.Warn(ctx, "invalid signed_media_url request body")
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid file_id")
+		return
+	}
+
+	metadata, err := s.db.LookupFiles(ctx, []int64{body.FileID})
+	if err != nil {
+		logger.Error(ctx, "failed to lookup file for signed_media_url", err, logger.Fields{"file_id": body.FileID})
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
+		return
+	}
+	if len(metadata) == 0 {
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "file not found")
+		return
+	}
+	m := metadata[0]
+
+	ttl := time.Duration(s.cfg.GCSMediaURLTTLSeconds) * time.Second
+	expiresAt := time.Now().Add(ttl).UTC()
+	url, err := gcs.SignedMediaURL(m.Bucket, m.ObjectKey, m.MimeType, s.cfg.GCSSigningEmail, s.cfg.GCSSigningPrivateKey, ttl)
+	if err != nil {
+		logger.Error(ctx, "failed to generate signed media URL", err, logger.Fields{"file_id": m.FileID})
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
+		return
+	}
+
+	logger.Info(ctx, "signed media URL generated", logger.Fields{"file_id": m.FileID})
+
+	response := map[string]any{
+		"file_id":    m.FileID,
+		"url":        s.rewriteForEmulator(url),
+		"expires_at": expiresAt,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Error(ctx, "failed to encode signed_media_url response", err)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
+	}
+}
+
+// SignedObjectURLHandler signs download URLs for raw bucket/object_key pairs.
+// It serves responses that expose storage paths directly instead of file IDs.
+// Only objects in the configured bucket are signed; other pairs are skipped.
+func (s *Server) SignedObjectURLHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		logger.Warn(ctx, "invalid method for signed_object_url endpoint", logger.Fields{
+			"method": r.Method,
+		})
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Objects []filetypes.ObjectRef `json:"objects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Error(ctx, "failed to decode request body", err)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
+		return
+	}
+	if body.Objects == nil {
+		logger.Warn(ctx, "missing objects field in request")
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing objects")
+		return
+	}
+
+	logger.Debug(ctx, "processing signed object URL request", logger.Fields{
+		"objects_count": len(body.Objects),
+	})
+
+	out := make([]map[string]any, 0, len(body.Objects))
+	ttl := time.Duration(s.cfg.GCSSignedURLTTLSeconds) * time.Second
+
+	for _, obj := range body.Objects {
+		if obj.ObjectKey == "" || obj.Bucket != s.cfg.GCSBucket {
+			logger.Warn(ctx, "skipping object outside configured bucket", logger.Fields{
+				"bucket":     obj.Bucket,
+				"object_key": obj.ObjectKey,
+			})
+			continue
+		}
+		url, err := gcs.SignedDownloadURL(s.cfg.GCSBucket, obj.ObjectKey, s.cfg.GCSSigningEmail, s.cfg.GCSSigningPrivateKey, ttl)
+		if err != nil {
+			logger.Error(ctx, "failed to generate signed URL", err, logger.Fields{
+				"object_key": obj.ObjectKey,
+			})
+			continue
+		}
+		out = append(out, map[string]any{
+			"bucket":     obj.Bucket,
+			"object_key": obj.ObjectKey,
+			"url":        s.rewriteForEmulator(url),
+		})
+	}
+
+	logger.Info(ctx, "signed object URLs generated", logger.Fields{
+		"processed_objects": len(out),
 	})
 
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(out); err != nil {
 		logger.Error(ctx, "failed to encode response", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 	}
 }
 
@@ -202,7 +347,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 		logger.Warn(ctx, "invalid method for signed_delete_url endpoint", logger.Fields{
 			"method": r.Method,
 		})
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -210,14 +355,14 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 	var body map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		logger.Error(ctx, "failed to decode signed_delete_url request body", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
 		return
 	}
 
 	fileIDRaw, ok := body["file_id"]
 	if !ok {
 		logger.Warn(ctx, "missing file_id field in signed_delete_url request")
-		http.Error(w, "missing file_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing file_id")
 		return
 	}
 
@@ -225,7 +370,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 	fileIDFloat, ok := fileIDRaw.(float64)
 	if !ok {
 		logger.Warn(ctx, "file_id is not a number in signed_delete_url request")
-		http.Error(w, "invalid file_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid file_id")
 		return
 	}
 	fileID := int64(fileIDFloat)
@@ -237,14 +382,14 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 		logger.Error(ctx, "failed to lookup file for signed_delete_url", err, logger.Fields{
 			"file_id": fileID,
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 	if len(metadata) == 0 {
 		logger.Warn(ctx, "file not found for signed_delete_url", logger.Fields{
 			"file_id": fileID,
 		})
-		http.Error(w, "file not found", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "file not found")
 		return
 	}
 
@@ -257,7 +402,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 			"file_bucket":       m.Bucket,
 			"configured_bucket": s.cfg.GCSBucket,
 		})
-		http.Error(w, "invalid bucket", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid bucket")
 		return
 	}
 
@@ -269,7 +414,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 	if s.cfg.Environment == "local" && s.cfg.GCSEmulatorURL != "" {
 		base, err := url.Parse(s.cfg.GCSEmulatorURL)
 		if err != nil {
-			http.Error(w, "invalid gcs emulator url", http.StatusInternalServerError)
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "invalid gcs emulator url")
 			return
 		}
 		// Important: url.URL.Path should be the *decoded* path, and url.URL.RawPath
@@ -285,7 +430,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 				"file_id":    fileID,
 				"object_key": m.ObjectKey,
 			})
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 			return
 		}
 		deleteURL = s.rewriteForEmulator(signedURL)
@@ -303,7 +448,7 @@ func (s *Server) SignedDeleteURLHandler(w http.ResponseWriter, r *http.Request)
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(response); err != nil {
 		logger.Error(ctx, "failed to encode signed_delete_url response", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 	}
 }
 
@@ -315,7 +460,7 @@ func (s *Server) SignedUploadURLHandler(w http.ResponseWriter, r *http.Request)
 		logger.Warn(ctx, "invalid method for signed_upload_url endpoint", logger.Fields{
 			"method": r.Method,
 		})
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -323,14 +468,14 @@ func (s *Server) SignedUploadURLHandler(w http.ResponseWriter, r *http.Request)
 	var body map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		logger.Error(ctx, "failed to decode request body", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
 		return
 	}
 
 	uploadIntentRaw, ok := body["upload_intent_id"]
 	if !ok {
 		logger.Warn(ctx, "missing upload_intent_id field in request")
-		http.Error(w, "missing upload_intent_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing upload_intent_id")
 		return
 	}
 
@@ -340,7 +485,7 @@ func (s *Server) SignedUploadURLHandler(w http.ResponseWriter, r *http.Request)
 	uploadIntentID, ok := uploadIntentRaw.(float64)
 	if !ok {
 		logger.Warn(ctx, "upload_intent_id is not a number")
-		http.Error(w, "invalid upload_intent_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid upload_intent_id")
 		return
 	}
 
@@ -349,17 +494,19 @@ func (s *Server) SignedUploadURLHandler(w http.ResponseWriter, r *http.Request)
 		logger.Error(ctx, "failed to lookup upload intent in database", err, logger.Fields{
 			"upload_intent_id": int64(uploadIntentID),
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
+	headers := s.uploadHeaders(ctx, intent)
+
 	ttl := time.Duration(s.cfg.GCSSignedURLTTLSeconds) * time.Second
-	url, err := gcs.SignedUploadURL(intent.Bucket, intent.ObjectKey, intent.MimeType, s.cfg.GCSSigningEmail, s.cfg.GCSSigningPrivateKey, ttl)
+	url, err := gcs.SignedUploadURL(intent.Bucket, intent.ObjectKey, intent.MimeType, headers, s.cfg.GCSSigningEmail, s.cfg.GCSSigningPrivateKey, ttl)
 	if err != nil {
 		logger.Error(ctx, "failed to generate signed upload URL", err, logger.Fields{
 			"upload_intent_id": int64(uploadIntentID),
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
@@ -367,14 +514,17 @@ func (s *Server) SignedUploadURLHandler(w http.ResponseWriter, r *http.Request)
 		"upload_intent_id": int64(uploadIntentID),
 	})
 
+	// The headers are part of the signature: the client must send them, with
+	// these exact values, on the PUT (alongside Content-Type).
 	response := map[string]any{
-		"upload_url": s.rewriteForEmulator(url),
+		"upload_url":     s.rewriteForEmulator(url),
+		"upload_headers": headers,
 	}
 
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(response); err != nil {
 		logger.Error(ctx, "failed to encode response", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 	}
 }
 
@@ -388,7 +538,7 @@ func (s *Server) ProxyUploadURLHandler(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
 		logger.Warn(ctx, "invalid method for proxy_upload_url endpoint", logger.Fields{"method": r.Method})
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -396,21 +546,21 @@ func (s *Server) ProxyUploadURLHandler(w http.ResponseWriter, r *http.Request) {
 	var body map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		logger.Error(ctx, "failed to decode proxy_upload_url request body", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
 		return
 	}
 
 	uploadIntentRaw, ok := body["upload_intent_id"]
 	if !ok {
 		logger.Warn(ctx, "missing upload_intent_id field in proxy_upload_url request")
-		http.Error(w, "missing upload_intent_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing upload_intent_id")
 		return
 	}
 
 	uploadIntentFloat, ok := uploadIntentRaw.(float64)
 	if !ok {
 		logger.Warn(ctx, "upload_intent_id is not a number in proxy_upload_url request")
-		http.Error(w, "invalid upload_intent_id", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid upload_intent_id")
 		return
 	}
 	uploadIntentID := int64(uploadIntentFloat)
@@ -420,7 +570,7 @@ func (s *Server) ProxyUploadURLHandler(w http.ResponseWriter, r *http.Request) {
 		logger.Error(ctx, "failed to lookup upload intent for proxy_upload_url", err, logger.Fields{
 			"upload_intent_id": uploadIntentID,
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
@@ -435,7 +585,7 @@ func (s *Server) ProxyUploadURLHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]any{"upload_url": uploadURL}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		logger.Error(ctx, "failed to encode proxy_upload_url response", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 	}
 }
 
@@ -448,7 +598,7 @@ func (s *Server) ProxyDownloadURLHandler(w http.ResponseWriter, r *http.Request)
 
 	if r.Method != http.MethodPost {
 		logger.Warn(ctx, "invalid method for proxy_download_url endpoint", logger.Fields{"method": r.Method})
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -456,21 +606,21 @@ func (s *Server) ProxyDownloadURLHandler(w http.ResponseWriter, r *http.Request)
 	var body map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		logger.Error(ctx, "failed to decode proxy_download_url request body", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidJSON, "invalid json")
 		return
 	}
 
 	arr, ok := body["files"]
 	if !ok {
 		logger.Warn(ctx, "missing files field in proxy_download_url request")
-		http.Error(w, "missing files", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing files")
 		return
 	}
 
 	items, ok := arr.([]any)
 	if !ok {
 		logger.Warn(ctx, "files field is not an array in proxy_download_url request")
-		http.Error(w, "files must be an array", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "files must be an array")
 		return
 	}
 
@@ -492,7 +642,7 @@ func (s *Server) ProxyDownloadURLHandler(w http.ResponseWriter, r *http.Request)
 	metadata, err := s.db.LookupFiles(ctx, normalizedIDs)
 	if err != nil {
 		logger.Error(ctx, "failed to lookup files for proxy_download_url", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
@@ -518,7 +668,7 @@ func (s *Server) ProxyDownloadURLHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := json.NewEncoder(w).Encode(out); err != nil {
 		logger.Error(ctx, "failed to encode proxy_download_url response", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 	}
 }
 
@@ -528,10 +678,29 @@ func (s *Server) setProxyCORSHeaders(w http.ResponseWriter) {
 	h := w.Header()
 	h.Set("Access-Control-Allow-Origin", "*")
 	h.Set("Access-Control-Allow-Methods", "PUT, GET, HEAD, OPTIONS")
-	h.Set("Access-Control-Allow-Headers", "Content-Type")
+	h.Set("Access-Control-Allow-Headers", proxyAllowedRequestHeaders)
 	h.Set("Access-Control-Expose-Headers", "Content-Range, Accept-Ranges, Content-Length, Content-Type")
 }
 
+// proxyAllowedRequestHeaders are the request headers the proxy accepts
+// cross-origin: Content-Type plus the headers signed upload URLs may require,
+// so clients can send the same upload_headers to either upload path.
+const proxyAllowedRequestHeaders = "Content-Type, Cache-Control, Content-Disposition, Content-Encoding, Content-Language, X-Goog-Meta-*"
+
+// uploadHeaders resolves the headers to sign into (or apply on) an upload for
+// intent: the configured defaults overridden by the intent's signed_headers,
+// restricted to the names GCS accepts on upload.
+func (s *Server) uploadHeaders(ctx context.Context, intent *filetypes.UploadIntentMetadata) map[string]string {
+	headers, dropped := gcs.UploadHeaders(s.cfg.GCSUploadDefaultHeaders, intent.SignedHeaders)
+	if len(dropped) > 0 {
+		logger.Warn(ctx, "ignoring unsupported upload headers", logger.Fields{
+			"upload_intent_id": intent.UploadIntentID,
+			"headers":          dropped,
+		})
+	}
+	return headers
+}
+
 // UploadProxyHandler streams a client upload (PUT /u/{token}) through to GCS.
 // Authorization is provided by the HMAC token, not the internal API key.
 func (s *Server) UploadProxyHandler(w http.ResponseWriter, r *http.Request) {
@@ -543,20 +712,20 @@ func (s *Server) UploadProxyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method != http.MethodPut {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	token := strings.TrimPrefix(r.URL.Path, "/u/")
 	if token == "" {
-		http.Error(w, "missing token", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing token")
 		return
 	}
 
 	uploadIntentID, err := s.signer.Verify(token, proxytoken.OpPut)
 	if err != nil {
 		logger.Warn(ctx, "invalid upload proxy token", logger.Fields{"error": err.Error()})
-		http.Error(w, "forbidden", http.StatusForbidden)
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "forbidden")
 		return
 	}
 
@@ -565,17 +734,17 @@ func (s *Server) UploadProxyHandler(w http.ResponseWriter, r *http.Request) {
 		logger.Error(ctx, "failed to lookup upload intent for upload proxy", err, logger.Fields{
 			"upload_intent_id": uploadIntentID,
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
 	defer r.Body.Close()
-	n, err := s.data.UploadStream(ctx, intent.Bucket, intent.ObjectKey, intent.MimeType, r.Body)
+	n, err := s.data.UploadStream(ctx, intent.Bucket, intent.ObjectKey, intent.MimeType, s.uploadHeaders(ctx, intent), r.Body)
 	if err != nil {
 		logger.Error(ctx, "failed to stream upload to GCS", err, logger.Fields{
 			"upload_intent_id": uploadIntentID,
 		})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 
@@ -597,38 +766,38 @@ func (s *Server) DownloadProxyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	token := strings.TrimPrefix(r.URL.Path, "/d/")
 	if token == "" {
-		http.Error(w, "missing token", http.StatusBadRequest)
+		apierror.Write(w, r, http.StatusBadRequest, apierror.CodeInvalidRequest, "missing token")
 		return
 	}
 
 	fileID, err := s.signer.Verify(token, proxytoken.OpGet)
 	if err != nil {
 		logger.Warn(ctx, "invalid download proxy token", logger.Fields{"error": err.Error()})
-		http.Error(w, "forbidden", http.StatusForbidden)
+		apierror.Write(w, r, http.StatusForbidden, apierror.CodeForbidden, "forbidden")
 		return
 	}
 
 	metadata, err := s.db.LookupFiles(ctx, []int64{fileID})
 	if err != nil {
 		logger.Error(ctx, "failed to lookup file for download proxy", err, logger.Fields{"file_id": fileID})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 	if len(metadata) == 0 {
-		http.Error(w, "file not found", http.StatusNotFound)
+		apierror.Write(w, r, http.StatusNotFound, apierror.CodeNotFound, "file not found")
 		return
 	}
 	m := metadata[0]
 
 	offset, length, isRange, err := parseRangeHeader(r.Header.Get("Range"))
 	if err != nil {
-		http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+		apierror.Write(w, r, http.StatusRequestedRangeNotSatisfiable, apierror.CodeInvalidRange, "invalid range")
 		return
 	}
 
@@ -640,7 +809,7 @@ func (s *Server) DownloadProxyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if err != nil {
 		logger.Error(ctx, "failed to open GCS reader for download proxy", err, logger.Fields{"file_id": fileID})
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
 		return
 	}
 	defer reader.Close()
@@ -14,4 +14,14 @@ type UploadIntentMetadata struct {
 	Bucket         string `json:"bucket"`
 	ObjectKey      string `json:"object_key"`
 	MimeType       string `json:"mime_type"`
+	// SignedHeaders are extra headers (e.g. Cache-Control, x-goog-meta-*)
+	// bound into the signed upload URL; the client must send them verbatim.
+	SignedHeaders map[string]string `json:"signed_headers"`
+}
+
+// ObjectRef identifies a storage object by bucket and object key, as exposed
+// directly by some PostgREST views.
+type ObjectRef struct {
+	Bucket    string `json:"bucket"`
+	ObjectKey string `json:"object_key"`
 }
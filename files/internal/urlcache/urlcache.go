@@ -0,0 +1,82 @@
+// Package urlcache keeps recently minted signed download URLs by file id, so
+// a burst of requests for the same media (e.g. a classroom joining a lesson
+// at once) is answered without signing per request. Callers still look the
+// files up before serving a cached URL, so deleted files get none.
+//
+// A URL is served from the cache only during the first half of its lifetime,
+// so callers always receive one with at least half its TTL left.
+package urlcache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	url        string
+	freshUntil time.Time
+}
+
+// Cache is a bounded, concurrency-safe map of file id to signed URL.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[int64]entry
+	maxEntries int
+}
+
+// New returns a cache holding at most maxEntries URLs, or nil when
+// maxEntries is 0 (caching disabled). A nil *Cache is valid and never hits.
+func New(maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		return nil
+	}
+	return &Cache{entries: make(map[int64]entry), maxEntries: maxEntries}
+}
+
+// Get returns the cached URL for fileID while it is still fresh.
+func (c *Cache) Get(fileID int64) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[fileID]
+	if !ok {
+		return "", false
+	}
+	if !time.Now().Before(e.freshUntil) {
+		delete(c.entries, fileID)
+		return "", false
+	}
+	return e.url, true
+}
+
+// Put stores url for fileID, minted now with the given ttl. When the cache is
+// full, stale entries are dropped first, then arbitrary ones.
+func (c *Cache) Put(fileID int64, url string, ttl time.Duration) {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[fileID]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[fileID] = entry{url: url, freshUntil: now.Add(ttl / 2)}
+}
+
+// evict makes room for one entry. Callers hold c.mu.
+func (c *Cache) evict(now time.Time) {
+	for id, e := range c.entries {
+		if !now.Before(e.freshUntil) {
+			delete(c.entries, id)
+		}
+	}
+	for id := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+		delete(c.entries, id)
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/bencyrus/chatterbox/gateway/internal/config"
 	"github.com/bencyrus/chatterbox/gateway/internal/httpserver"
@@ -11,6 +13,12 @@ import (
 )
 
 func main() {
+	selftestFlag := flag.Bool("selftest", false, "validate config and dependencies, print a JSON report, and exit")
+	flag.Parse()
+	if *selftestFlag {
+		os.Exit(runSelftest())
+	}
+
 	cfg := config.Load()
 
 	// Initialize the centralized logger
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/selftest"
+)
+
+// selftestTimeout bounds the whole self-test so a hung dependency fails the
+// deploy gate instead of stalling it.
+const selftestTimeout = 30 * time.Second
+
+// runSelftest validates configuration, checks PostgREST answers, and checks
+// the files service accepts the API key by signing an empty set of objects.
+// It returns the process exit code.
+func runSelftest() int {
+	ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+	defer cancel()
+
+	r := selftest.New("gateway")
+
+	var cfg config.Config
+	if !r.Check("config", func() error {
+		cfg = config.Load()
+		return nil
+	}) {
+		r.Skip("postgrest", "config failed")
+		r.Skip("files_service", "config failed")
+		return r.Finish(os.Stdout)
+	}
+
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	r.Check("postgrest", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.PostgRESTURL, nil)
+		if err != nil {
+			return err
+		}
+		return selftest.CheckHTTP(client, req)
+	})
+
+	r.Check("files_service", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimRight(cfg.FileServiceURL, "/")+"/signed_object_url",
+			bytes.NewReader([]byte(`{"objects":[]}`)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-File-Service-Api-Key", cfg.FileServiceAPIKey)
+		return selftest.CheckHTTP(client, req)
+	})
+
+	return r.Finish(os.Stdout)
+}
@@ -3,6 +3,7 @@ module github.com/bencyrus/chatterbox/gateway
 go 1.22
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/bencyrus/chatterbox/shared v0.0.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 )
@@ -0,0 +1,183 @@
+package admintasks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/rpc"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// PathPrefix is where the task replay endpoints are mounted.
+const PathPrefix = "/admin/tasks/"
+
+// PostgREST RPCs backing each operation. Admin authorization is enforced by the
+// database functions, using the caller's Authorization header.
+const (
+	listFailedRPCPath = "/rpc/list_failed_tasks"
+	replayRPCPath     = "/rpc/replay_tasks"
+	listPausedRPCPath = "/rpc/list_paused_task_types"
+	pauseRPCPath      = "/rpc/pause_task_type"
+	resumeRPCPath     = "/rpc/resume_task_type"
+)
+
+// replayRequest is the body accepted by the replay endpoints. Payload, when
+// set, replaces the original payload and requires a single task.
+type replayRequest struct {
+	TaskIDs []int64         `json:"task_ids"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// pauseRequest is the optional body accepted when pausing a task type.
+type pauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// NewHandler serves failed task inspection and replay, and pausing of task
+// types:
+//
+//	GET  /admin/tasks/failed[?dead_lettered_only=true&limit=N]
+//	POST /admin/tasks/replay               {"task_ids": [1, 2], "payload": {...}?}
+//	POST /admin/tasks/{id}/replay          {"payload": {...}}? (body optional)
+//	GET  /admin/tasks/paused
+//	POST /admin/tasks/types/{type}/pause   {"reason": "..."}? (body optional)
+//	POST /admin/tasks/types/{type}/resume
+//
+// Replays enqueue new tasks linked to the originals; completed tasks are never
+// reopened. Tasks of a paused type stay queued until the type is resumed.
+// PostgREST errors (e.g. a non-admin caller) are relayed as is.
+func NewHandler(cfg config.Config) http.Handler {
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var rpcPath string
+		var args map[string]any
+		status := http.StatusOK
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/"), "/")
+		switch {
+		case len(parts) == 1 && parts[0] == "failed":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			rpcPath = listFailedRPCPath
+			args = map[string]any{}
+			q := r.URL.Query()
+			if v := q.Get("dead_lettered_only"); v != "" {
+				deadLetteredOnly, err := strconv.ParseBool(v)
+				if err != nil {
+					http.Error(w, "invalid dead_lettered_only", http.StatusBadRequest)
+					return
+				}
+				args["dead_lettered_only"] = deadLetteredOnly
+			}
+			if v := q.Get("limit"); v != "" {
+				limit, err := strconv.Atoi(v)
+				if err != nil || limit < 1 {
+					http.Error(w, "invalid limit", http.StatusBadRequest)
+					return
+				}
+				args["limit"] = limit
+			}
+
+		case (len(parts) == 1 && parts[0] == "replay") || (len(parts) == 2 && parts[1] == "replay"):
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			var req replayRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			if len(parts) == 2 {
+				taskID, err := strconv.ParseInt(parts[0], 10, 64)
+				if err != nil || taskID <= 0 {
+					http.NotFound(w, r)
+					return
+				}
+				req.TaskIDs = []int64{taskID}
+			}
+			rpcPath = replayRPCPath
+			args = map[string]any{"task_ids": req.TaskIDs}
+			if len(req.Payload) > 0 && string(req.Payload) != "null" {
+				args["payload"] = req.Payload
+			}
+			status = http.StatusCreated
+
+		case len(parts) == 1 && parts[0] == "paused":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			rpcPath = listPausedRPCPath
+			args = map[string]any{}
+
+		case len(parts) == 3 && parts[0] == "types" && (parts[2] == "pause" || parts[2] == "resume"):
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			args = map[string]any{"task_type": parts[1]}
+			if parts[2] == "resume" {
+				rpcPath = resumeRPCPath
+				break
+			}
+			var req pauseRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			rpcPath = pauseRPCPath
+			if req.Reason != "" {
+				args["reason"] = req.Reason
+			}
+
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		resp, err := rpc.Call(ctx, client, cfg, authorization, rpcPath, args)
+		if err != nil {
+			logger.Error(ctx, "task admin request failed", err, logger.Fields{"rpc": rpcPath})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !resp.OK() {
+			logger.Warn(ctx, "task admin request rejected", logger.Fields{
+				"rpc":         rpcPath,
+				"status_code": resp.StatusCode,
+			})
+			status = resp.StatusCode
+		} else {
+			switch rpcPath {
+			case replayRPCPath:
+				logger.Info(ctx, "tasks replayed", logger.Fields{"task_ids": args["task_ids"]})
+			case pauseRPCPath:
+				logger.Info(ctx, "task type paused", logger.Fields{"task_type": args["task_type"]})
+			case resumeRPCPath:
+				logger.Info(ctx, "task type resumed", logger.Fields{"task_type": args["task_type"]})
+			}
+		}
+
+		// Task payloads can hold personal data; never let them be cached.
+		w.Header().Set("Cache-Control", "no-store")
+		rpc.Write(w, resp, status)
+	})
+}
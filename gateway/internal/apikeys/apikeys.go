@@ -0,0 +1,116 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/rpc"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// PathPrefix is where the partner API key endpoints are mounted. Both the bare
+// collection path and everything below it are routed here.
+const PathPrefix = "/partner-api-keys"
+
+// PostgREST RPCs backing each operation. Admin authorization is enforced by the
+// database functions, using the caller's Authorization header.
+const (
+	createRPCPath = "/rpc/create_partner_api_key"
+	listRPCPath   = "/rpc/list_partner_api_keys"
+	rotateRPCPath = "/rpc/rotate_partner_api_key"
+	revokeRPCPath = "/rpc/revoke_partner_api_key"
+)
+
+// NewHandler serves partner API key management:
+//
+//	GET    /partner-api-keys               list keys (never includes secrets)
+//	POST   /partner-api-keys               create a key: {"name": "..."}
+//	POST   /partner-api-keys/{id}/rotate   revoke a key and issue its replacement
+//	DELETE /partner-api-keys/{id}          revoke a key
+//
+// Create and rotate return the plaintext api_key exactly once. PostgREST errors
+// (e.g. a non-admin caller) are relayed as is.
+func NewHandler(cfg config.Config) http.Handler {
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rpcPath, args, status, ok := route(w, r)
+		if !ok {
+			return
+		}
+
+		resp, err := rpc.Call(ctx, client, cfg, authorization, rpcPath, args)
+		if err != nil {
+			logger.Error(ctx, "partner api key request failed", err, logger.Fields{"rpc": rpcPath})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !resp.OK() {
+			logger.Warn(ctx, "partner api key request rejected", logger.Fields{
+				"rpc":         rpcPath,
+				"status_code": resp.StatusCode,
+			})
+			status = resp.StatusCode
+		}
+
+		// Responses can carry a freshly issued key; never let them be cached.
+		w.Header().Set("Cache-Control", "no-store")
+		rpc.Write(w, resp, status)
+	})
+}
+
+// route maps the request to an RPC path, its arguments and the success status.
+// It writes an error response and returns ok=false when the request is invalid.
+func route(w http.ResponseWriter, r *http.Request) (string, map[string]any, int, bool) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	parts := strings.Split(rest, "/")
+
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			return listRPCPath, map[string]any{}, http.StatusOK, true
+		case http.MethodPost:
+			var req struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return "", nil, 0, false
+			}
+			return createRPCPath, map[string]any{"name": req.Name}, http.StatusCreated, true
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", nil, 0, false
+	}
+
+	keyID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || keyID <= 0 || len(parts) > 2 {
+		http.NotFound(w, r)
+		return "", nil, 0, false
+	}
+	args := map[string]any{"partner_api_key_id": keyID}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		return revokeRPCPath, args, http.StatusOK, true
+	case len(parts) == 2 && parts[1] == "rotate" && r.Method == http.MethodPost:
+		return rotateRPCPath, args, http.StatusCreated, true
+	case len(parts) == 2 && parts[1] != "rotate":
+		http.NotFound(w, r)
+		return "", nil, 0, false
+	}
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return "", nil, 0, false
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Headers carrying the caller's device label and IP to PostgREST, where
+// api.refresh_tokens records them on the session. SetSessionHeaders
+// overwrites them on every forwarded request, so clients cannot set them.
+const (
+	SessionDeviceHeader = "X-Session-Device"
+	SessionIPHeader     = "X-Session-IP"
+)
+
+// SetSessionHeaders sets the session headers on h from the client request r.
+func SetSessionHeaders(h http.Header, r *http.Request) {
+	h.Set(SessionDeviceHeader, DeviceLabel(r.Header.Get("User-Agent")))
+	h.Set(SessionIPHeader, ClientIP(r))
+}
+
+// ClientIP returns the originating client IP for r: the right-most
+// X-Forwarded-For entry, added by the edge proxy, then the connection
+// address. Earlier entries are whatever the client sent and are ignored.
+func ClientIP(r *http.Request) string {
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		hops := strings.Split(fwd[len(fwd)-1], ",")
+		if last := strings.TrimSpace(hops[len(hops)-1]); last != "" {
+			return last
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// browserPatterns and osPatterns are matched in order, so more specific tokens come first
+// (e.g. Edge and Chrome both send "Safari").
+var (
+	browserPatterns = []struct{ token, name string }{
+		{"Chatterbox", "Chatterbox app"},
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"CFNetwork/", "iOS app"},
+		{"okhttp/", "Android app"},
+	}
+	osPatterns = []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Mac OS X", "macOS"},
+		{"Macintosh", "macOS"},
+		{"Darwin", "iOS"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DeviceLabel turns a User-Agent into a short human label such as
+// "Safari on iOS". It returns "" when nothing is recognized.
+func DeviceLabel(userAgent string) string {
+	browser := matchFirst(userAgent, browserPatterns)
+	platform := matchFirst(userAgent, osPatterns)
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	default:
+		return platform
+	}
+}
+
+func matchFirst(userAgent string, patterns []struct{ token, name string }) string {
+	for _, p := range patterns {
+		if strings.Contains(userAgent, p.token) {
+			return p.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	cases := []struct {
+		name       string
+		forwarded  []string
+		remoteAddr string
+		want       string
+	}{
+		{"connection address", nil, "198.51.100.7:4312", "198.51.100.7"},
+		{"edge proxy hop", []string{"203.0.113.9"}, "10.0.0.2:80", "203.0.113.9"},
+		{"client-sent hops ignored", []string{"1.2.3.4, 203.0.113.9"}, "10.0.0.2:80", "203.0.113.9"},
+		{"last header line", []string{"1.2.3.4", "203.0.113.9"}, "10.0.0.2:80", "203.0.113.9"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			for _, v := range c.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			r.Header.Set("X-Real-IP", "1.2.3.4")
+			if got := ClientIP(r); got != c.want {
+				t.Errorf("ClientIP = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
@@ -64,10 +64,10 @@ func ShouldRefreshAccessToken(cfg config.Config, headers http.Header, now time.T
 }
 
 // PreflightRefresh attempts a token refresh within maxWait. Returns nil on timeout or error.
-func PreflightRefresh(ctx context.Context, cfg config.Config, requestHeaders http.Header, maxWait time.Duration) *RefreshResult {
+func PreflightRefresh(ctx context.Context, cfg config.Config, r *http.Request, maxWait time.Duration) *RefreshResult {
 	ctx2, cancel := context.WithTimeout(ctx, maxWait)
 	defer cancel()
-	res, err := RefreshIfPresent(ctx2, cfg, requestHeaders)
+	res, err := RefreshIfPresent(ctx2, cfg, r)
 	if err != nil || res == nil {
 		return nil
 	}
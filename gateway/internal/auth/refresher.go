@@ -18,11 +18,13 @@ type RefreshResult struct {
 	RefreshToken string
 }
 
-// RefreshIfPresent attempts to refresh tokens using the provided refresh token header.
+// RefreshIfPresent attempts to refresh tokens using the refresh token header on r.
 // If no refresh token header is present, it returns nil result and nil error.
 // Any refresh error is returned, but callers may choose to ignore it.
-func RefreshIfPresent(ctx context.Context, cfg config.Config, requestHeaders http.Header) (*RefreshResult, error) {
-	refreshToken := requestHeaders.Get(cfg.RefreshTokenHeaderIn)
+// The caller's User-Agent and session headers are sent along so the database
+// can record them on the refresh token's session.
+func RefreshIfPresent(ctx context.Context, cfg config.Config, r *http.Request) (*RefreshResult, error) {
+	refreshToken := r.Header.Get(cfg.RefreshTokenHeaderIn)
 	if refreshToken == "" {
 		return nil, nil
 	}
@@ -46,6 +48,8 @@ func RefreshIfPresent(ctx context.Context, cfg config.Config, requestHeaders htt
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", r.Header.Get("User-Agent"))
+	SetSessionHeaders(req.Header, r)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -0,0 +1,327 @@
+// Package cache serves hot read endpoints from an in-memory response cache.
+//
+// Each cached response is stored once as identity, gzip and brotli bodies,
+// compressed when it is stored. Requests pick a variant from Accept-Encoding,
+// so a cache hit costs no compression work.
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/bencyrus/chatterbox/gateway/internal/auth"
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/fields"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// maxBodyBytes bounds the size of a response kept in the cache. Larger
+// responses are passed through uncached.
+const maxBodyBytes = 1 << 20
+
+// Content encodings the cache stores, in server preference order.
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+type entry struct {
+	header   http.Header
+	bodies   map[string][]byte
+	storedAt time.Time
+	expires  time.Time
+}
+
+type store struct {
+	mu         sync.Mutex
+	entries    map[string]*entry
+	maxEntries int
+}
+
+// Responses wraps next with a response cache for GET requests on the paths
+// configured by cfg.ResponseCachePaths. Responses are cached for
+// cfg.ResponseCacheTTLSeconds and keyed by the full URL plus the headers that
+// change the response (Authorization, Accept, Accept-Profile, Range, Prefer,
+// X-Fields), so one caller's data is never served to another.
+//
+// Only 200 responses are cached, and never ones that carry refreshed tokens
+// or ask not to be stored. Requests whose access token is due for a refresh
+// bypass the cache so the refresh still happens.
+func Responses(cfg config.Config, next http.Handler) http.Handler {
+	if len(cfg.ResponseCachePaths) == 0 || cfg.ResponseCacheTTLSeconds <= 0 {
+		return next
+	}
+
+	paths := make(map[string]struct{}, len(cfg.ResponseCachePaths))
+	for _, p := range cfg.ResponseCachePaths {
+		paths["/"+strings.Trim(p, "/")] = struct{}{}
+	}
+	ttl := time.Duration(cfg.ResponseCacheTTLSeconds) * time.Second
+	s := &store{entries: make(map[string]*entry), maxEntries: cfg.ResponseCacheMaxEntries}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := paths[strings.TrimRight(r.URL.Path, "/")]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if auth.ShouldRefreshAccessToken(cfg, r.Header, time.Now()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+		now := time.Now()
+		if e := s.get(key, now); e != nil {
+			serve(w, r, e, "HIT")
+			return
+		}
+
+		// Ask upstream for an uncompressed body; the cache compresses it once.
+		upstream := r.Clone(r.Context())
+		upstream.Header.Del("Accept-Encoding")
+		rec := &recorder{w: w, header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, upstream)
+
+		if !cacheable(cfg, rec) {
+			rec.writeTo(w)
+			return
+		}
+
+		e, err := newEntry(rec, now, ttl)
+		if err != nil {
+			logger.Warn(r.Context(), "failed to compress cached response", logger.Fields{
+				"path":  r.URL.Path,
+				"error": err.Error(),
+			})
+			rec.writeTo(w)
+			return
+		}
+		s.put(key, e, now)
+		serve(w, r, e, "MISS")
+	})
+}
+
+// cacheKey identifies a response by URL and the request headers PostgREST
+// and the gateway vary the response on. The Authorization header is hashed with the rest so
+// tokens are not kept in memory as map keys.
+func cacheKey(r *http.Request) string {
+	h := sha256.New()
+	for _, part := range []string{
+		r.URL.RequestURI(),
+		r.Header.Get("Authorization"),
+		r.Header.Get("Accept"),
+		r.Header.Get("Accept-Profile"),
+		r.Header.Get("Range"),
+		r.Header.Get("Prefer"),
+		r.Header.Get(fields.Header),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheable reports whether a recorded upstream response may be stored.
+func cacheable(cfg config.Config, rec *recorder) bool {
+	if rec.status != http.StatusOK || rec.overflow {
+		return false
+	}
+	if rec.header.Get(cfg.NewAccessTokenHeaderOut) != "" || rec.header.Get("Set-Cookie") != "" {
+		return false
+	}
+	if rec.header.Get("Content-Encoding") != "" {
+		return false
+	}
+	cc := strings.ToLower(rec.header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// newEntry compresses the recorded body into every stored encoding. A
+// compressed variant that is not smaller than the original is dropped.
+func newEntry(rec *recorder, now time.Time, ttl time.Duration) (*entry, error) {
+	header := rec.header.Clone()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+
+	body := rec.body.Bytes()
+	bodies := map[string][]byte{encodingIdentity: body}
+
+	var gz bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gzw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, err
+	}
+	if gz.Len() < len(body) {
+		bodies[encodingGzip] = gz.Bytes()
+	}
+
+	var br bytes.Buffer
+	brw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+	if _, err := brw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := brw.Close(); err != nil {
+		return nil, err
+	}
+	if br.Len() < len(body) {
+		bodies[encodingBrotli] = br.Bytes()
+	}
+
+	return &entry{header: header, bodies: bodies, storedAt: now, expires: now.Add(ttl)}, nil
+}
+
+// serve writes e using the best encoding the client accepts.
+func serve(w http.ResponseWriter, r *http.Request, e *entry, status string) {
+	encoding := negotiate(r.Header.Get("Accept-Encoding"), e.bodies)
+	body := e.bodies[encoding]
+
+	for k, vv := range e.header {
+		w.Header()[k] = vv
+	}
+	if encoding != encodingIdentity {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Cache", status)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(e.storedAt).Seconds())))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// negotiate picks the stored encoding the client prefers, breaking ties by
+// server preference (br, then gzip). Identity is used when nothing else is
+// acceptable; responses are never refused for encoding reasons.
+func negotiate(acceptEncoding string, bodies map[string][]byte) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := encodingIdentity, 0.0
+	for _, enc := range []string{encodingBrotli, encodingGzip} {
+		if _, ok := bodies[enc]; !ok {
+			continue
+		}
+		q, ok := qualities[enc]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func (s *store) get(key string, now time.Time) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// put stores e, first dropping expired entries and then arbitrary ones when
+// the cache is full.
+func (s *store) put(key string, e *entry, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) >= s.maxEntries {
+		for k, existing := range s.entries {
+			if !now.Before(existing.expires) {
+				delete(s.entries, k)
+			}
+		}
+		for k := range s.entries {
+			if len(s.entries) < s.maxEntries {
+				break
+			}
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = e
+}
+
+// recorder buffers an upstream response so it can be inspected before it is
+// cached or relayed. A response that grows past maxBodyBytes cannot be
+// cached; it is relayed to w as it is written, so its body is never held in
+// memory whole.
+type recorder struct {
+	w        http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) { rec.status = status }
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.overflow {
+		return rec.w.Write(p)
+	}
+	if rec.body.Len()+len(p) > maxBodyBytes {
+		rec.overflow = true
+		rec.relay(rec.w)
+		rec.body = bytes.Buffer{}
+		return rec.w.Write(p)
+	}
+	return rec.body.Write(p)
+}
+
+// writeTo relays the recorded response unchanged, unless it overflowed and
+// was already relayed.
+func (rec *recorder) writeTo(w http.ResponseWriter) {
+	if rec.overflow {
+		return
+	}
+	rec.relay(w)
+}
+
+// relay writes the recorded header, status and buffered body to w.
+func (rec *recorder) relay(w http.ResponseWriter) {
+	for k, vv := range rec.header {
+		w.Header()[k] = vv
+	}
+	w.WriteHeader(rec.status)
+	_, _ = w.Write(rec.body.Bytes())
+}
@@ -26,9 +26,44 @@ type Config struct {
 	ProcessedFilesFieldName   string
 	UploadIntentFieldName     string
 	UploadURLFieldName        string
+	UploadHeadersFieldName    string
 	FileServiceAPIKey         string
+	// Object path injection (raw bucket/object_key pairs in responses)
+	FileSignedObjectURLPath string
+	ObjectBucketFieldName   string
+	ObjectKeyFieldName      string
+	ObjectURLFieldName      string
+	// Injection failures: by default a response whose file URLs could not be
+	// signed is served without them. InjectionFailureModes names paths
+	// that instead fail the response or carry InjectionErrorFieldName.
+	InjectionFailureModes   map[string]string
+	InjectionErrorFieldName string
+	// Media streaming redirect (/media/{file_id})
+	MediaAccessRPCPath     string
+	FileSignedMediaURLPath string
+	// Signed URL refresh (/files/refresh_urls)
+	FileAccessRPCPath   string
+	FileRefreshMaxFiles int
 	// HTTP client
 	HTTPClientTimeoutSeconds int
+	// Pagination enforcement
+	PaginationTables   []string
+	PaginationMaxLimit int
+	PaginationMode     string
+	// Response cache
+	ResponseCachePaths      []string
+	ResponseCacheTTLSeconds int
+	ResponseCacheMaxEntries int
+	// Load shedding
+	LoadShedMaxInFlight         int
+	LoadShedMaxQueue            int
+	LoadShedQueueTimeoutSeconds int
+	LoadShedRetryAfterSeconds   int
+	// Path rewriting: PathPrefix is stripped from request paths (e.g.
+	// /api/v1/rpc/x is served as /rpc/x); PathRewrites maps legacy paths to
+	// their new names after the prefix is stripped.
+	PathPrefix   string
+	PathRewrites map[string]string
 }
 
 // Environment variable names used by the gateway
@@ -50,9 +85,49 @@ const (
 	EnvProcessedFilesFieldName   = "PROCESSED_FILES_FIELD_NAME"
 	EnvUploadIntentFieldName     = "UPLOAD_INTENT_FIELD_NAME"
 	EnvUploadURLFieldName        = "UPLOAD_URL_FIELD_NAME"
+	EnvUploadHeadersFieldName    = "UPLOAD_HEADERS_FIELD_NAME"
 	EnvFileServiceAPIKey         = "FILE_SERVICE_API_KEY"
+	EnvFileSignedObjectURLPath   = "FILE_SIGNED_OBJECT_URL_PATH"
+	EnvObjectBucketFieldName     = "OBJECT_BUCKET_FIELD_NAME"
+	EnvObjectKeyFieldName        = "OBJECT_KEY_FIELD_NAME"
+	EnvObjectURLFieldName        = "OBJECT_URL_FIELD_NAME"
+	EnvInjectionFailureModes     = "FILE_INJECTION_FAILURE_MODES"
+	EnvInjectionErrorFieldName   = "FILES_PROCESSING_ERROR_FIELD_NAME"
+	EnvMediaAccessRPCPath        = "MEDIA_ACCESS_RPC_PATH"
+	EnvFileSignedMediaURLPath    = "FILE_SIGNED_MEDIA_URL_PATH"
+	EnvFileAccessRPCPath         = "FILE_ACCESS_RPC_PATH"
+	EnvFileRefreshMaxFiles       = "FILE_REFRESH_MAX_FILES"
 	// HTTP
 	EnvHTTPClientTimeoutSeconds = "HTTP_CLIENT_TIMEOUT_SECONDS"
+	// Pagination
+	EnvPaginationTables   = "PAGINATION_TABLES"
+	EnvPaginationMaxLimit = "PAGINATION_MAX_LIMIT"
+	EnvPaginationMode     = "PAGINATION_MODE"
+	// Response cache
+	EnvResponseCachePaths      = "RESPONSE_CACHE_PATHS"
+	EnvResponseCacheTTLSeconds = "RESPONSE_CACHE_TTL_SECONDS"
+	EnvResponseCacheMaxEntries = "RESPONSE_CACHE_MAX_ENTRIES"
+	// Load shedding
+	EnvLoadShedMaxInFlight         = "LOAD_SHED_MAX_IN_FLIGHT"
+	EnvLoadShedMaxQueue            = "LOAD_SHED_MAX_QUEUE"
+	EnvLoadShedQueueTimeoutSeconds = "LOAD_SHED_QUEUE_TIMEOUT_SECONDS"
+	EnvLoadShedRetryAfterSeconds   = "LOAD_SHED_RETRY_AFTER_SECONDS"
+	// Path rewriting
+	EnvPathPrefix   = "PATH_PREFIX"
+	EnvPathRewrites = "PATH_REWRITES"
+)
+
+// Pagination modes for list queries on PAGINATION_TABLES.
+const (
+	PaginationModeReject = "reject"
+	PaginationModeAuto   = "auto"
+)
+
+// File injection failure modes for paths in FILE_INJECTION_FAILURE_MODES.
+// Paths not listed serve the response without the missing URLs.
+const (
+	FileInjectionModeFail = "fail"
+	FileInjectionModeMark = "mark"
 )
 
 // collectRequired reads the provided environment keys and returns a map of values
@@ -71,6 +146,48 @@ func collectRequired(keys []string) (map[string]string, []string) {
 	return values, missing
 }
 
+// splitList splits a comma-separated env value into trimmed, non-empty items.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parsePathRewrites parses comma-separated from=to path pairs, e.g.
+// /rpc/get_cues=/rpc/cues. Both sides must be absolute paths.
+func parsePathRewrites(value string) map[string]string {
+	rewrites := make(map[string]string)
+	for _, item := range splitList(value) {
+		from, to, ok := strings.Cut(item, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || !strings.HasPrefix(from, "/") || !strings.HasPrefix(to, "/") {
+			panic(fmt.Sprintf("invalid PATH_REWRITES entry %q: must be /from=/to", item))
+		}
+		rewrites[from] = to
+	}
+	return rewrites
+}
+
+// parseInjectionFailureModes parses comma-separated path=mode pairs, e.g.
+// /rpc/lesson=fail,/cues=mark.
+func parseInjectionFailureModes(value string) map[string]string {
+	modes := make(map[string]string)
+	for _, item := range splitList(value) {
+		path, mode, ok := strings.Cut(item, "=")
+		path, mode = strings.TrimSpace(path), strings.ToLower(strings.TrimSpace(mode))
+		if !ok || !strings.HasPrefix(path, "/") || (mode != FileInjectionModeFail && mode != FileInjectionModeMark) {
+			panic(fmt.Sprintf("invalid FILE_INJECTION_FAILURE_MODES entry %q: must be /path=fail or /path=mark", item))
+		}
+		modes["/"+strings.Trim(path, "/")] = mode
+	}
+	return modes
+}
+
 // collectOptional reads optional env vars and applies defaults when empty/whitespace.
 func collectOptional(defaults map[string]string) map[string]string {
 	values := make(map[string]string, len(defaults))
@@ -110,11 +227,34 @@ func Load() Config {
 	}
 
 	optionalEnvVars := collectOptional(map[string]string{
-		EnvPort:                     "8080",
-		EnvRefreshTokenHeaderIn:     "X-Refresh-Token",
-		EnvNewAccessTokenHeaderOut:  "X-New-Access-Token",
-		EnvNewRefreshTokenHeaderOut: "X-New-Refresh-Token",
-		EnvHTTPClientTimeoutSeconds: "10",
+		EnvPort:                        "8080",
+		EnvRefreshTokenHeaderIn:        "X-Refresh-Token",
+		EnvNewAccessTokenHeaderOut:     "X-New-Access-Token",
+		EnvNewRefreshTokenHeaderOut:    "X-New-Refresh-Token",
+		EnvHTTPClientTimeoutSeconds:    "10",
+		EnvUploadHeadersFieldName:      "upload_headers",
+		EnvFileSignedObjectURLPath:     "/signed_object_url",
+		EnvObjectBucketFieldName:       "bucket",
+		EnvObjectKeyFieldName:          "object_key",
+		EnvObjectURLFieldName:          "signed_url",
+		EnvInjectionFailureModes:       "",
+		EnvInjectionErrorFieldName:     "files_processing_error",
+		EnvMediaAccessRPCPath:          "/rpc/media_file",
+		EnvFileSignedMediaURLPath:      "/signed_media_url",
+		EnvFileAccessRPCPath:           "/rpc/accessible_files",
+		EnvFileRefreshMaxFiles:         "100",
+		EnvPaginationTables:            "",
+		EnvPaginationMaxLimit:          "100",
+		EnvPaginationMode:              PaginationModeAuto,
+		EnvResponseCachePaths:          "",
+		EnvResponseCacheTTLSeconds:     "30",
+		EnvResponseCacheMaxEntries:     "1000",
+		EnvLoadShedMaxInFlight:         "0",
+		EnvLoadShedMaxQueue:            "100",
+		EnvLoadShedQueueTimeoutSeconds: "5",
+		EnvLoadShedRetryAfterSeconds:   "1",
+		EnvPathPrefix:                  "",
+		EnvPathRewrites:                "",
 	})
 
 	httpTimeout, err := strconv.Atoi(optionalEnvVars[EnvHTTPClientTimeoutSeconds])
@@ -122,23 +262,96 @@ func Load() Config {
 		panic("invalid HTTP_CLIENT_TIMEOUT_SECONDS: must be integer seconds")
 	}
 
+	fileRefreshMaxFiles, err := strconv.Atoi(optionalEnvVars[EnvFileRefreshMaxFiles])
+	if err != nil || fileRefreshMaxFiles < 1 {
+		panic("invalid FILE_REFRESH_MAX_FILES: must be a positive integer")
+	}
+
+	paginationMaxLimit, err := strconv.Atoi(optionalEnvVars[EnvPaginationMaxLimit])
+	if err != nil || paginationMaxLimit < 1 {
+		panic("invalid PAGINATION_MAX_LIMIT: must be a positive integer")
+	}
+
+	paginationMode := strings.ToLower(optionalEnvVars[EnvPaginationMode])
+	if paginationMode != PaginationModeReject && paginationMode != PaginationModeAuto {
+		panic("invalid PAGINATION_MODE: must be reject or auto")
+	}
+
+	cacheTTL, err := strconv.Atoi(optionalEnvVars[EnvResponseCacheTTLSeconds])
+	if err != nil || cacheTTL < 0 {
+		panic("invalid RESPONSE_CACHE_TTL_SECONDS: must be non-negative integer seconds")
+	}
+
+	cacheMaxEntries, err := strconv.Atoi(optionalEnvVars[EnvResponseCacheMaxEntries])
+	if err != nil || cacheMaxEntries < 1 {
+		panic("invalid RESPONSE_CACHE_MAX_ENTRIES: must be a positive integer")
+	}
+
+	loadShedMaxInFlight, err := strconv.Atoi(optionalEnvVars[EnvLoadShedMaxInFlight])
+	if err != nil || loadShedMaxInFlight < 0 {
+		panic("invalid LOAD_SHED_MAX_IN_FLIGHT: must be a non-negative integer")
+	}
+
+	loadShedMaxQueue, err := strconv.Atoi(optionalEnvVars[EnvLoadShedMaxQueue])
+	if err != nil || loadShedMaxQueue < 0 {
+		panic("invalid LOAD_SHED_MAX_QUEUE: must be a non-negative integer")
+	}
+
+	loadShedQueueTimeout, err := strconv.Atoi(optionalEnvVars[EnvLoadShedQueueTimeoutSeconds])
+	if err != nil || loadShedQueueTimeout < 0 {
+		panic("invalid LOAD_SHED_QUEUE_TIMEOUT_SECONDS: must be non-negative integer seconds")
+	}
+
+	loadShedRetryAfter, err := strconv.Atoi(optionalEnvVars[EnvLoadShedRetryAfterSeconds])
+	if err != nil || loadShedRetryAfter < 0 {
+		panic("invalid LOAD_SHED_RETRY_AFTER_SECONDS: must be non-negative integer seconds")
+	}
+
+	pathPrefix := strings.TrimRight(optionalEnvVars[EnvPathPrefix], "/")
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		panic("invalid PATH_PREFIX: must start with /")
+	}
+
 	return Config{
-		Port:                      optionalEnvVars[EnvPort],
-		PostgRESTURL:              requiredEnvVars[EnvPostgRESTURL],
-		JWTSecret:                 requiredEnvVars[EnvJWTSecret],
-		RefreshTokensPath:         requiredEnvVars[EnvRefreshTokensPath],
-		RefreshThresholdSeconds:   threshold,
-		RefreshTokenHeaderIn:      optionalEnvVars[EnvRefreshTokenHeaderIn],
-		NewAccessTokenHeaderOut:   optionalEnvVars[EnvNewAccessTokenHeaderOut],
-		NewRefreshTokenHeaderOut:  optionalEnvVars[EnvNewRefreshTokenHeaderOut],
-		FileServiceURL:            requiredEnvVars[EnvFileServiceURL],
-		FileSignedDownloadURLPath: requiredEnvVars[EnvFileSignedDownloadURLPath],
-		FileSignedUploadURLPath:   requiredEnvVars[EnvFileSignedUploadURLPath],
-		FilesFieldName:            requiredEnvVars[EnvFilesFieldName],
-		ProcessedFilesFieldName:   requiredEnvVars[EnvProcessedFilesFieldName],
-		UploadIntentFieldName:     requiredEnvVars[EnvUploadIntentFieldName],
-		UploadURLFieldName:        requiredEnvVars[EnvUploadURLFieldName],
-		FileServiceAPIKey:         requiredEnvVars[EnvFileServiceAPIKey],
-		HTTPClientTimeoutSeconds:  httpTimeout,
+		Port:                        optionalEnvVars[EnvPort],
+		PostgRESTURL:                requiredEnvVars[EnvPostgRESTURL],
+		JWTSecret:                   requiredEnvVars[EnvJWTSecret],
+		RefreshTokensPath:           requiredEnvVars[EnvRefreshTokensPath],
+		RefreshThresholdSeconds:     threshold,
+		RefreshTokenHeaderIn:        optionalEnvVars[EnvRefreshTokenHeaderIn],
+		NewAccessTokenHeaderOut:     optionalEnvVars[EnvNewAccessTokenHeaderOut],
+		NewRefreshTokenHeaderOut:    optionalEnvVars[EnvNewRefreshTokenHeaderOut],
+		FileServiceURL:              requiredEnvVars[EnvFileServiceURL],
+		FileSignedDownloadURLPath:   requiredEnvVars[EnvFileSignedDownloadURLPath],
+		FileSignedUploadURLPath:     requiredEnvVars[EnvFileSignedUploadURLPath],
+		FilesFieldName:              requiredEnvVars[EnvFilesFieldName],
+		ProcessedFilesFieldName:     requiredEnvVars[EnvProcessedFilesFieldName],
+		UploadIntentFieldName:       requiredEnvVars[EnvUploadIntentFieldName],
+		UploadURLFieldName:          requiredEnvVars[EnvUploadURLFieldName],
+		UploadHeadersFieldName:      optionalEnvVars[EnvUploadHeadersFieldName],
+		FileServiceAPIKey:           requiredEnvVars[EnvFileServiceAPIKey],
+		FileSignedObjectURLPath:     optionalEnvVars[EnvFileSignedObjectURLPath],
+		ObjectBucketFieldName:       optionalEnvVars[EnvObjectBucketFieldName],
+		ObjectKeyFieldName:          optionalEnvVars[EnvObjectKeyFieldName],
+		ObjectURLFieldName:          optionalEnvVars[EnvObjectURLFieldName],
+		InjectionFailureModes:       parseInjectionFailureModes(optionalEnvVars[EnvInjectionFailureModes]),
+		InjectionErrorFieldName:     optionalEnvVars[EnvInjectionErrorFieldName],
+		MediaAccessRPCPath:          optionalEnvVars[EnvMediaAccessRPCPath],
+		FileSignedMediaURLPath:      optionalEnvVars[EnvFileSignedMediaURLPath],
+		FileAccessRPCPath:           optionalEnvVars[EnvFileAccessRPCPath],
+		FileRefreshMaxFiles:         fileRefreshMaxFiles,
+		HTTPClientTimeoutSeconds:    httpTimeout,
+		PaginationTables:            splitList(optionalEnvVars[EnvPaginationTables]),
+		PaginationMaxLimit:          paginationMaxLimit,
+		PaginationMode:              paginationMode,
+		ResponseCachePaths:          splitList(optionalEnvVars[EnvResponseCachePaths]),
+		ResponseCacheTTLSeconds:     cacheTTL,
+		ResponseCacheMaxEntries:     cacheMaxEntries,
+		LoadShedMaxInFlight:         loadShedMaxInFlight,
+		LoadShedMaxQueue:            loadShedMaxQueue,
+		LoadShedQueueTimeoutSeconds: loadShedQueueTimeout,
+		LoadShedRetryAfterSeconds:   loadShedRetryAfter,
+		PathPrefix:                  pathPrefix,
+		PathRewrites:                parsePathRewrites(optionalEnvVars[EnvPathRewrites]),
 	}
 }
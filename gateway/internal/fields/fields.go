@@ -0,0 +1,168 @@
+// Package fields shapes proxied JSON responses down to a caller-chosen set of
+// fields ("sparse fieldsets"), so list-heavy mobile screens can fetch only what
+// they render without a dedicated PostgREST view per screen.
+//
+// Fields are requested with the X-Fields header or, for clients that cannot
+// set headers, the _fields query parameter, as a comma-separated list of
+// dotted paths:
+//
+//	X-Fields: id,title,author.name,files_processed.url
+//
+// Pruning runs after signed URL injection, so injected keys can be selected
+// like any other. Objects keep only the listed keys; arrays are pruned element
+// by element; a listed key with no nested paths is kept whole. Keys missing
+// from the response are ignored.
+package fields
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Header is the request header carrying the field list.
+	Header = "X-Fields"
+	// QueryParam is the query parameter carrying the field list when the
+	// header is absent. It is removed before the request reaches PostgREST,
+	// which would otherwise read it as a column filter.
+	QueryParam = "_fields"
+)
+
+// Spec is a parsed field list: each key maps to the fields kept inside it, or
+// to nil to keep the value whole.
+type Spec map[string]Spec
+
+// Parse parses a comma-separated list of dotted paths. An empty list returns
+// a nil Spec, meaning no shaping.
+func Parse(value string) (Spec, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	spec := Spec{}
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return nil, errors.New("empty field in field list")
+		}
+		node := spec
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			if part == "" {
+				return nil, errors.New("empty path segment in field " + strconv.Quote(path))
+			}
+			child, seen := node[part]
+			if i == len(parts)-1 {
+				// A bare key keeps the whole value, even if nested paths
+				// under it were also listed.
+				node[part] = nil
+				break
+			}
+			if seen && child == nil {
+				break
+			}
+			if child == nil {
+				child = Spec{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+	return spec, nil
+}
+
+// FromRequest returns the field list requested by r, preferring the header
+// over the query parameter.
+func FromRequest(r *http.Request) (Spec, error) {
+	if v := r.Header.Get(Header); v != "" {
+		return Parse(v)
+	}
+	return Parse(r.URL.Query().Get(QueryParam))
+}
+
+// StripQuery removes the field list parameter from u so it is not forwarded.
+func StripQuery(u *url.URL) {
+	query := u.Query()
+	if !query.Has(QueryParam) {
+		return
+	}
+	query.Del(QueryParam)
+	u.RawQuery = query.Encode()
+}
+
+// Prune returns body with every value not selected by spec removed. A nil
+// spec, or a body that is not JSON, is returned unchanged.
+func Prune(body []byte, spec Spec) ([]byte, error) {
+	if spec == nil || len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return body, err
+	}
+	return json.Marshal(prune(doc, spec))
+}
+
+func prune(v any, spec Spec) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(spec))
+		for key, sub := range spec {
+			value, ok := t[key]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[key] = value
+			} else {
+				out[key] = prune(value, sub)
+			}
+		}
+		return out
+	case []any:
+		for i := range t {
+			t[i] = prune(t[i], spec)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// ShapeResponse prunes a successful JSON response body to spec and resets its
+// length. Other responses, including errors, are left as PostgREST sent them;
+// on a malformed body the original is restored.
+func ShapeResponse(resp *http.Response, spec Spec) {
+	if spec == nil || resp.Body == nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return
+	}
+	if resp.Request != nil && (resp.Request.Method == http.MethodHead || resp.Request.Method == http.MethodOptions) {
+		return
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") {
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return
+	}
+	shaped, err := Prune(body, spec)
+	if err != nil {
+		shaped = body
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(shaped))
+	resp.ContentLength = int64(len(shaped))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(shaped)))
+}
@@ -0,0 +1,89 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/apierror"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// injectionFailureMessage tells clients the response is missing file URLs
+// and that retrying is expected to help.
+const injectionFailureMessage = "file URLs could not be signed; retry the request"
+
+// handleInjectionFailure applies the failure mode configured for the
+// response's path after a file service call failed, and returns the body to
+// send. Paths without a mode keep body, which is the response without the
+// missing URLs.
+//
+// In "fail" mode the response becomes a 503 with an "unavailable" error
+// envelope. In "mark" mode body gains cfg.InjectionErrorFieldName (on the
+// top-level object, or on each object of a top-level array) with the same
+// envelope, so clients can render what they have and offer a retry. Either
+// way the response is marked no-store so the response cache does not keep it.
+func handleInjectionFailure(ctx context.Context, cfg config.Config, resp *http.Response, body []byte, failure error) []byte {
+	path := ""
+	if resp.Request != nil {
+		path = "/" + strings.Trim(resp.Request.URL.Path, "/")
+	}
+	mode := cfg.InjectionFailureModes[path]
+
+	logger.Warn(ctx, "file URL injection failed", logger.Fields{
+		"path":  path,
+		"mode":  mode,
+		"error": failure.Error(),
+	})
+
+	requestID, _ := ctx.Value(logger.RequestIDKey).(string)
+	envelope := apierror.Error{Code: apierror.CodeUnavailable, Message: injectionFailureMessage, RequestID: requestID}
+
+	switch mode {
+	case config.FileInjectionModeFail:
+		failed, err := json.Marshal(envelope)
+		if err != nil {
+			return body
+		}
+		resp.StatusCode = http.StatusServiceUnavailable
+		resp.Status = "503 " + http.StatusText(http.StatusServiceUnavailable)
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Header.Set("Cache-Control", "no-store")
+		resp.Header.Del("Content-Range")
+		return failed
+	case config.FileInjectionModeMark:
+		marked, err := markInjectionFailure(cfg, body, envelope)
+		if err != nil {
+			return body
+		}
+		resp.Header.Set("Cache-Control", "no-store")
+		return marked
+	}
+	return body
+}
+
+// markInjectionFailure adds the failure field to body's top-level object, or
+// to every object in its top-level array.
+func markInjectionFailure(cfg config.Config, body []byte, envelope apierror.Error) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	switch t := generic.(type) {
+	case map[string]any:
+		t[cfg.InjectionErrorFieldName] = envelope
+	case []any:
+		for _, item := range t {
+			if obj, ok := item.(map[string]any); ok {
+				obj[cfg.InjectionErrorFieldName] = envelope
+			}
+		}
+	}
+	return json.Marshal(generic)
+}
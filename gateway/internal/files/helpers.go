@@ -11,10 +11,24 @@ import (
 	"github.com/bencyrus/chatterbox/gateway/internal/config"
 )
 
-// ProcessFileURLsIfNeeded reads the response body, attempts to inject signed download URLs
-// and signed upload URLs, and writes back the possibly modified body. It is safe to call;
-// on any error it restores the original body and returns without propagating errors.
+// ProcessFileURLsIfNeeded reads the response body, attempts to inject signed download URLs,
+// signed upload URLs, and signed object URLs, and writes back the possibly modified body. It is safe to call;
+// on any error it restores the original body and returns without propagating errors. When a file
+// service call fails on a path listed in cfg.InjectionFailureModes, the response is failed or
+// marked instead (see handleInjectionFailure).
+//
+// OPTIONS (including CORS preflight) and HEAD responses pass through
+// untouched: there is no body to rewrite. The proxy sets a HEAD response's
+// Content-Length from the matching GET (see proxy.setHeadContentLength).
 func ProcessFileURLsIfNeeded(ctx context.Context, cfg config.Config, resp *http.Response) {
+	method := http.MethodGet
+	if resp.Request != nil {
+		method = resp.Request.Method
+	}
+	if method == http.MethodOptions || method == http.MethodHead {
+		return
+	}
+
 	ct := resp.Header.Get("Content-Type")
 	if ct == "" || !strings.Contains(ct, "application/json") {
 		return
@@ -28,23 +42,40 @@ func ProcessFileURLsIfNeeded(ctx context.Context, cfg config.Config, resp *http.
 		_ = resp.Body.Close()
 	}
 
-	// Chain processors: first inject download URLs, then inject upload URLs
-	processed := buf.Bytes()
-
-	// Process download file URLs
-	var err error
-	processed, err = InjectSignedFileURLs(ctx, cfg, processed)
-	if err != nil || processed == nil {
-		processed = buf.Bytes()
-	}
-
-	// Process upload URLs
-	processed, err = InjectSignedUploadURL(ctx, cfg, processed)
-	if err != nil || processed == nil {
-		processed = buf.Bytes()
-	}
+	processed := injectFileURLs(ctx, cfg, resp, buf.Bytes())
 
 	resp.Body = io.NopCloser(bytes.NewReader(processed))
 	resp.ContentLength = int64(len(processed))
 	resp.Header.Set("Content-Length", strconv.Itoa(len(processed)))
 }
+
+// injectFileURLs runs body through the injection chain and returns the body
+// to send, with the path's failure mode applied when a file service call
+// failed.
+func injectFileURLs(ctx context.Context, cfg config.Config, resp *http.Response, body []byte) []byte {
+	// Chain processors: download URLs, then upload URLs, then raw
+	// bucket/object_key pairs. A processor that fails returns its input
+	// unchanged, so what earlier ones injected is kept; only a nil result
+	// falls back to the upstream body.
+	processed := body
+	var failure error
+	for _, inject := range []func(context.Context, config.Config, []byte) ([]byte, error){
+		InjectSignedFileURLs,
+		InjectSignedUploadURL,
+		InjectSignedObjectURLs,
+	} {
+		next, err := inject(ctx, cfg, processed)
+		if next == nil {
+			next = body
+		}
+		processed = next
+		if err != nil && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		processed = handleInjectionFailure(ctx, cfg, resp, processed, failure)
+	}
+	return processed
+}
@@ -0,0 +1,147 @@
+package files
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+)
+
+const upstreamBody = `{"id":1,"files":[7]}`
+
+// newTestEnv starts an upstream answering every request with upstreamBody
+// and a file service signing every file, and returns a config pointing at
+// the file service.
+func newTestEnv(t *testing.T) (config.Config, *httptest.Server) {
+	t.Helper()
+	fileService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"file_id":7,"url":"https://storage.example.com/7?sig=abc"}]`)
+	}))
+	t.Cleanup(fileService.Close)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(upstreamBody)))
+		if r.Method != http.MethodHead {
+			io.WriteString(w, upstreamBody)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.Config{
+		FileServiceURL:            fileService.URL,
+		FileSignedDownloadURLPath: "/signed_download_url",
+		FilesFieldName:            "files",
+		ProcessedFilesFieldName:   "processed_files",
+		UploadIntentFieldName:     "upload_intent",
+		ObjectBucketFieldName:     "bucket",
+		ObjectKeyFieldName:        "object_key",
+		HTTPClientTimeoutSeconds:  5,
+	}
+	return cfg, upstream
+}
+
+// roundTrip sends method to the upstream and returns its response, as the
+// reverse proxy hands it to ModifyResponse.
+func roundTrip(t *testing.T, method, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestProcessFileURLsIfNeededSkipsOptions(t *testing.T) {
+	cfg, _ := newTestEnv(t)
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"application/json"}, "Content-Length": {strconv.Itoa(len(upstreamBody))}},
+		Body:          io.NopCloser(strings.NewReader(upstreamBody)),
+		ContentLength: int64(len(upstreamBody)),
+		Request:       httptest.NewRequest(http.MethodOptions, "/rpc/list_files", nil),
+	}
+
+	ProcessFileURLsIfNeeded(context.Background(), cfg, resp)
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != upstreamBody {
+		t.Errorf("body = %s, want it untouched", body)
+	}
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(upstreamBody)) {
+		t.Errorf("Content-Length = %q, want %d", got, len(upstreamBody))
+	}
+	if resp.ContentLength != int64(len(upstreamBody)) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(upstreamBody))
+	}
+}
+
+func TestProcessFileURLsIfNeededLeavesHead(t *testing.T) {
+	cfg, upstream := newTestEnv(t)
+
+	head := roundTrip(t, http.MethodHead, upstream.URL+"/rpc/list_files")
+	ProcessFileURLsIfNeeded(context.Background(), cfg, head)
+
+	if got := head.Header.Get("Content-Length"); got != strconv.Itoa(len(upstreamBody)) {
+		t.Errorf("HEAD Content-Length = %q, want the upstream %d", got, len(upstreamBody))
+	}
+}
+
+func TestProcessFileURLsIfNeededRewritesGet(t *testing.T) {
+	cfg, upstream := newTestEnv(t)
+
+	resp := roundTrip(t, http.MethodGet, upstream.URL+"/rpc/list_files")
+	ProcessFileURLsIfNeeded(context.Background(), cfg, resp)
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `"processed_files"`) || !strings.Contains(string(body), "sig=abc") {
+		t.Errorf("body = %s, want signed URLs injected", body)
+	}
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length = %q, want %d", got, len(body))
+	}
+}
+
+func TestInjectFileURLsKeepsEarlierInjectionsOnFailure(t *testing.T) {
+	fileService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/signed_upload_url" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"file_id":7,"url":"https://storage.example.com/7?sig=abc"}]`)
+	}))
+	t.Cleanup(fileService.Close)
+
+	cfg := config.Config{
+		FileServiceURL:            fileService.URL,
+		FileSignedDownloadURLPath: "/signed_download_url",
+		FileSignedUploadURLPath:   "/signed_upload_url",
+		FilesFieldName:            "files",
+		ProcessedFilesFieldName:   "processed_files",
+		UploadIntentFieldName:     "upload_intent",
+		HTTPClientTimeoutSeconds:  5,
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Request:    httptest.NewRequest(http.MethodGet, "/rpc/list_files", nil),
+	}
+
+	body := injectFileURLs(context.Background(), cfg, resp, []byte(`{"files":[7],"upload_intent":3}`))
+
+	if !strings.Contains(string(body), "sig=abc") {
+		t.Errorf("body = %s, want the download URLs kept after the upload step failed", body)
+	}
+}
@@ -0,0 +1,151 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// objectRef identifies a storage object by bucket and object key.
+type objectRef struct {
+	Bucket    string `json:"bucket"`
+	ObjectKey string `json:"object_key"`
+}
+
+// signedObjectURL is a single item returned by the files service signed object URL endpoint.
+type signedObjectURL struct {
+	Bucket    string `json:"bucket"`
+	ObjectKey string `json:"object_key"`
+	URL       string `json:"url"`
+}
+
+// InjectSignedObjectURLs walks the JSON response (objects and arrays at any depth) for objects
+// that expose a storage path directly through cfg.ObjectBucketFieldName and cfg.ObjectKeyFieldName.
+// All pairs found are signed with a single call to the file service signed object URL endpoint and
+// each matching object gains a cfg.ObjectURLFieldName field with its URL. Objects the file service
+// declines to sign are left untouched; a failed call returns the original body with an error.
+func InjectSignedObjectURLs(ctx context.Context, cfg config.Config, body []byte) ([]byte, error) {
+	// Cheap pre-check so responses without object paths are not decoded again.
+	if !bytes.Contains(body, []byte(`"`+cfg.ObjectKeyFieldName+`"`)) {
+		return body, nil
+	}
+
+	// Decode numbers as json.Number so re-encoding preserves large IDs exactly.
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		// Not JSON; return original body without error
+		return body, nil
+	}
+
+	nodes := make([]map[string]any, 0)
+	collectObjectNodes(cfg, generic, &nodes)
+	if len(nodes) == 0 {
+		return body, nil
+	}
+
+	refs := make([]objectRef, 0, len(nodes))
+	seen := make(map[objectRef]struct{}, len(nodes))
+	for _, node := range nodes {
+		ref := nodeRef(cfg, node)
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		refs = append(refs, ref)
+	}
+
+	logger.Debug(ctx, "processing object URLs", logger.Fields{
+		"objects_count":    len(refs),
+		"file_service_url": cfg.FileServiceURL + cfg.FileSignedObjectURLPath,
+	})
+
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+	url := cfg.FileServiceURL + cfg.FileSignedObjectURLPath
+	reqBody, err := json.Marshal(map[string]any{"objects": refs})
+	if err != nil {
+		logger.Error(ctx, "failed to marshal file service object payload", err)
+		return body, fmt.Errorf("failed to marshal file service object payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		logger.Error(ctx, "failed to create file service object request", err)
+		return body, fmt.Errorf("failed to create file service object request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.FileServiceAPIKey != "" {
+		req.Header.Set("X-File-Service-Api-Key", cfg.FileServiceAPIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error(ctx, "file service object request failed", err)
+		return body, fmt.Errorf("file service object request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warn(ctx, "file service returned error status for object URLs", fileServiceErrorFields(resp))
+		return body, fmt.Errorf("file service returned error status for object URLs: %d", resp.StatusCode)
+	}
+
+	var signed []signedObjectURL
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		logger.Error(ctx, "failed to decode file service object response", err)
+		return body, fmt.Errorf("failed to decode file service object response: %w", err)
+	}
+
+	urls := make(map[objectRef]string, len(signed))
+	for _, s := range signed {
+		urls[objectRef{Bucket: s.Bucket, ObjectKey: s.ObjectKey}] = s.URL
+	}
+	for _, node := range nodes {
+		if u, ok := urls[nodeRef(cfg, node)]; ok {
+			node[cfg.ObjectURLFieldName] = u
+		}
+	}
+
+	newBody, err := json.Marshal(generic)
+	if err != nil {
+		logger.Error(ctx, "failed to marshal updated response with object URLs", err)
+		return body, fmt.Errorf("failed to marshal updated response with object URLs: %w", err)
+	}
+
+	logger.Info(ctx, "object URLs processed successfully", logger.Fields{
+		"signed_count": len(signed),
+	})
+	return newBody, nil
+}
+
+// collectObjectNodes appends every object in v that carries non-empty string bucket and
+// object key fields.
+func collectObjectNodes(cfg config.Config, v any, out *[]map[string]any) {
+	switch t := v.(type) {
+	case map[string]any:
+		bucket, bucketOK := t[cfg.ObjectBucketFieldName].(string)
+		key, keyOK := t[cfg.ObjectKeyFieldName].(string)
+		if bucketOK && keyOK && bucket != "" && key != "" {
+			*out = append(*out, t)
+		}
+		for _, child := range t {
+			collectObjectNodes(cfg, child, out)
+		}
+	case []any:
+		for _, child := range t {
+			collectObjectNodes(cfg, child, out)
+		}
+	}
+}
+
+// nodeRef returns the object reference held by a collected node.
+func nodeRef(cfg config.Config, node map[string]any) objectRef {
+	bucket, _ := node[cfg.ObjectBucketFieldName].(string)
+	key, _ := node[cfg.ObjectKeyFieldName].(string)
+	return objectRef{Bucket: bucket, ObjectKey: key}
+}
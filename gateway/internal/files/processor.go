@@ -4,17 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/apierror"
 	"github.com/bencyrus/chatterbox/shared/logger"
 )
 
 // InjectSignedFileURLs inspects the JSON response payload. If it contains an array field
 // configured by cfg.FilesFieldName, it calls the file service signed URL endpoint with the array
 // and, on success, injects a field configured by cfg.ProcessedFilesFieldName that contains the
-// service's response while keeping the original files field intact.
+// service's response while keeping the original files field intact. When the file service
+// cannot be reached or fails, the original body is returned with an error.
 func InjectSignedFileURLs(ctx context.Context, cfg config.Config, body []byte) ([]byte, error) {
 	var generic map[string]any
 	if err := json.Unmarshal(body, &generic); err != nil {
@@ -43,12 +46,12 @@ func InjectSignedFileURLs(ctx context.Context, cfg config.Config, body []byte) (
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
 		logger.Error(ctx, "failed to marshal file service payload", err)
-		return body, nil
+		return body, fmt.Errorf("failed to marshal file service payload: %w", err)
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
 	if err != nil {
 		logger.Error(ctx, "failed to create file service request", err)
-		return body, nil
+		return body, fmt.Errorf("failed to create file service request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if cfg.FileServiceAPIKey != "" {
@@ -58,27 +61,25 @@ func InjectSignedFileURLs(ctx context.Context, cfg config.Config, body []byte) (
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error(ctx, "file service request failed", err)
-		return body, nil
+		return body, fmt.Errorf("file service request failed: %w", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		logger.Warn(ctx, "file service returned error status", logger.Fields{
-			"status_code": resp.StatusCode,
-		})
-		return body, nil
+		logger.Warn(ctx, "file service returned error status", fileServiceErrorFields(resp))
+		return body, fmt.Errorf("file service returned error status: %d", resp.StatusCode)
 	}
 
 	var serviceJSON any
 	if err := json.NewDecoder(resp.Body).Decode(&serviceJSON); err != nil {
 		logger.Error(ctx, "failed to decode file service response", err)
-		return body, nil
+		return body, fmt.Errorf("failed to decode file service response: %w", err)
 	}
 
 	generic[cfg.ProcessedFilesFieldName] = serviceJSON
 	newBody, err := json.Marshal(generic)
 	if err != nil {
 		logger.Error(ctx, "failed to marshal updated response", err)
-		return body, nil
+		return body, fmt.Errorf("failed to marshal updated response: %w", err)
 	}
 
 	logger.Info(ctx, "file URLs processed successfully")
@@ -88,6 +89,9 @@ func InjectSignedFileURLs(ctx context.Context, cfg config.Config, body []byte) (
 // InjectSignedUploadURL inspects the JSON response payload. If it contains a field
 // configured by cfg.UploadIntentFieldName, it calls the file service signed upload URL endpoint
 // and injects a field configured by cfg.UploadURLFieldName that contains the signed upload URL.
+// When the URL was signed with extra headers, they are injected under
+// cfg.UploadHeadersFieldName; clients must send them verbatim with the upload. As with
+// InjectSignedFileURLs, a file service failure returns the original body with an error.
 func InjectSignedUploadURL(ctx context.Context, cfg config.Config, body []byte) ([]byte, error) {
 	var generic map[string]any
 	if err := json.Unmarshal(body, &generic); err != nil {
@@ -110,12 +114,12 @@ func InjectSignedUploadURL(ctx context.Context, cfg config.Config, body []byte)
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
 		logger.Error(ctx, "failed to marshal file service upload payload", err)
-		return body, nil
+		return body, fmt.Errorf("failed to marshal file service upload payload: %w", err)
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
 	if err != nil {
 		logger.Error(ctx, "failed to create file service upload request", err)
-		return body, nil
+		return body, fmt.Errorf("failed to create file service upload request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if cfg.FileServiceAPIKey != "" {
@@ -125,33 +129,45 @@ func InjectSignedUploadURL(ctx context.Context, cfg config.Config, body []byte)
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error(ctx, "file service upload request failed", err)
-		return body, nil
+		return body, fmt.Errorf("file service upload request failed: %w", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		logger.Warn(ctx, "file service returned error status for upload URL", logger.Fields{
-			"status_code": resp.StatusCode,
-		})
-		return body, nil
+		logger.Warn(ctx, "file service returned error status for upload URL", fileServiceErrorFields(resp))
+		return body, fmt.Errorf("file service returned error status for upload URL: %d", resp.StatusCode)
 	}
 
 	var serviceResponse map[string]any
 	if err := json.NewDecoder(resp.Body).Decode(&serviceResponse); err != nil {
 		logger.Error(ctx, "failed to decode file service upload response", err)
-		return body, nil
+		return body, fmt.Errorf("failed to decode file service upload response: %w", err)
 	}
 
 	// Inject the upload_url field
 	if uploadURL, ok := serviceResponse["upload_url"]; ok {
 		generic[cfg.UploadURLFieldName] = uploadURL
 	}
+	if headers, ok := serviceResponse["upload_headers"].(map[string]any); ok && len(headers) > 0 {
+		generic[cfg.UploadHeadersFieldName] = headers
+	}
 
 	newBody, err := json.Marshal(generic)
 	if err != nil {
 		logger.Error(ctx, "failed to marshal updated response with upload URL", err)
-		return body, nil
+		return body, fmt.Errorf("failed to marshal updated response with upload URL: %w", err)
 	}
 
 	logger.Info(ctx, "upload URL processed successfully")
 	return newBody, nil
 }
+
+// fileServiceErrorFields describes a failed files service response for
+// logging, including the code of its JSON error envelope when it has one.
+func fileServiceErrorFields(resp *http.Response) logger.Fields {
+	fields := logger.Fields{"status_code": resp.StatusCode}
+	if apiErr := apierror.Read(resp); apiErr != nil {
+		fields["error_code"] = apiErr.Code
+		fields["error_message"] = apiErr.Message
+	}
+	return fields
+}
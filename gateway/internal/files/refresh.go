@@ -0,0 +1,161 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/rpc"
+	"github.com/bencyrus/chatterbox/shared/apierror"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// RefreshPath is where the signed URL refresh endpoint is mounted.
+const RefreshPath = "/files/refresh_urls"
+
+// refreshRequest is the body of POST /files/refresh_urls.
+type refreshRequest struct {
+	FileIDs []int64 `json:"file_ids"`
+}
+
+// signedFile is one entry of the files service signed download URL response.
+type signedFile struct {
+	FileID int64  `json:"file_id"`
+	URL    string `json:"url"`
+}
+
+// NewRefreshHandler serves POST /files/refresh_urls with {"file_ids": [...]}.
+// It asks PostgREST (cfg.FileAccessRPCPath, with the caller's Authorization
+// header) which of the files the caller may read, then returns fresh signed
+// download URLs for those from the files service as {"files": [{file_id, url}]}.
+//
+// Long-lived pages use it to refresh expiring media URLs without re-fetching
+// the resources that embedded them. File ids the caller cannot access are
+// omitted from the response rather than failing the request.
+func NewRefreshHandler(cfg config.Config) http.Handler {
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		fileIDs, err := uniqueFileIDs(req.FileIDs, cfg.FileRefreshMaxFiles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Authorize with the caller's credentials; relay PostgREST's error as is.
+		access, err := rpc.Call(ctx, client, cfg, r.Header.Get("Authorization"), cfg.FileAccessRPCPath, map[string]any{"file_ids": fileIDs})
+		if err != nil {
+			logger.Error(ctx, "file access check failed", err, logger.Fields{"files_count": len(fileIDs)})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !access.OK() {
+			logger.Warn(ctx, "file access denied", logger.Fields{
+				"files_count": len(fileIDs),
+				"status_code": access.StatusCode,
+			})
+			rpc.Write(w, access, access.StatusCode)
+			return
+		}
+
+		var accessible refreshRequest
+		if err := json.Unmarshal(access.Body, &accessible); err != nil {
+			logger.Error(ctx, "failed to decode file access response", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		signed := []signedFile{}
+		if len(accessible.FileIDs) > 0 {
+			signed, err = signDownloads(ctx, client, cfg, accessible.FileIDs)
+			if err != nil {
+				logger.Error(ctx, "failed to refresh signed file urls", err, logger.Fields{"files_count": len(accessible.FileIDs)})
+				http.Error(w, "failed to obtain file urls", http.StatusBadGateway)
+				return
+			}
+		}
+
+		logger.Info(ctx, "file urls refreshed", logger.Fields{
+			"requested": len(fileIDs),
+			"refreshed": len(signed),
+		})
+
+		// The signed URLs are per-caller and short-lived; never let them be cached.
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"files": signed})
+	})
+}
+
+// uniqueFileIDs validates the requested ids and drops duplicates, keeping order.
+func uniqueFileIDs(fileIDs []int64, max int) ([]int64, error) {
+	if len(fileIDs) == 0 {
+		return nil, fmt.Errorf("file_ids must be a non-empty array")
+	}
+	seen := make(map[int64]bool, len(fileIDs))
+	unique := make([]int64, 0, len(fileIDs))
+	for _, id := range fileIDs {
+		if id <= 0 {
+			return nil, fmt.Errorf("invalid file id: %d", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > max {
+		return nil, fmt.Errorf("too many file_ids: at most %d per request", max)
+	}
+	return unique, nil
+}
+
+// signDownloads asks the files service for signed download URLs.
+func signDownloads(ctx context.Context, client *http.Client, cfg config.Config, fileIDs []int64) ([]signedFile, error) {
+	reqBody, err := json.Marshal(map[string]any{"files": fileIDs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signed download request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.FileServiceURL+cfg.FileSignedDownloadURLPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed download request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.FileServiceAPIKey != "" {
+		req.Header.Set("X-File-Service-Api-Key", cfg.FileServiceAPIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signed download request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if apiErr := apierror.Read(resp); apiErr != nil {
+			return nil, fmt.Errorf("files service returned status %d for signed download urls: %w", resp.StatusCode, apiErr)
+		}
+		return nil, fmt.Errorf("files service returned status %d for signed download urls", resp.StatusCode)
+	}
+
+	signed := []signedFile{}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, fmt.Errorf("failed to decode signed download response: %w", err)
+	}
+	return signed, nil
+}
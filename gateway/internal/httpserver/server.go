@@ -3,9 +3,18 @@ package httpserver
 import (
 	"net/http"
 
+	"github.com/bencyrus/chatterbox/gateway/internal/admintasks"
+	"github.com/bencyrus/chatterbox/gateway/internal/apikeys"
+	"github.com/bencyrus/chatterbox/gateway/internal/cache"
 	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/files"
 	"github.com/bencyrus/chatterbox/gateway/internal/httpapi"
+	"github.com/bencyrus/chatterbox/gateway/internal/loadshed"
+	"github.com/bencyrus/chatterbox/gateway/internal/media"
+	"github.com/bencyrus/chatterbox/gateway/internal/pagination"
 	"github.com/bencyrus/chatterbox/gateway/internal/proxy"
+	"github.com/bencyrus/chatterbox/gateway/internal/rewrite"
+	"github.com/bencyrus/chatterbox/gateway/internal/sessions"
 	"github.com/bencyrus/chatterbox/shared/middleware"
 )
 
@@ -20,10 +29,22 @@ func NewHandler(cfg config.Config) (http.Handler, error) {
 	mux := http.NewServeMux()
 	// Gateway endpoints
 	mux.Handle("/openapi.json", httpapi.NewOpenAPIHandler(cfg))
+	mux.Handle(media.PathPrefix, media.NewHandler(cfg))
+	mux.Handle(files.RefreshPath, files.NewRefreshHandler(cfg))
+	apiKeys := apikeys.NewHandler(cfg)
+	mux.Handle(apikeys.PathPrefix, apiKeys)
+	mux.Handle(apikeys.PathPrefix+"/", apiKeys)
+	mux.Handle(admintasks.PathPrefix, admintasks.NewHandler(cfg))
+	sessionsHandler := sessions.NewHandler(cfg)
+	mux.Handle(sessions.PathPrefix, sessionsHandler)
+	mux.Handle(sessions.PathPrefix+"/", sessionsHandler)
 
-	// Catch-all: reverse proxy to PostgREST
-	mux.Handle("/", gw)
+	// Catch-all: reverse proxy to PostgREST, guarded against unbounded list
+	// queries; configured hot reads are served from the response cache
+	mux.Handle("/", pagination.Enforce(cfg, cache.Responses(cfg, gw)))
 
-	// Wrap with shared middleware
-	return middleware.RequestIDMiddleware(mux), nil
+	// Wrap with shared middleware; excess load is shed before any
+	// endpoint or the proxy does work, and paths are rewritten before
+	// routing
+	return middleware.RequestIDMiddleware(loadshed.Limit(cfg, rewrite.Paths(cfg, mux))), nil
 }
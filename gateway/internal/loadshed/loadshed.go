@@ -0,0 +1,80 @@
+package loadshed
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// Limit wraps next with a bounded concurrency limiter. At most
+// cfg.LoadShedMaxInFlight requests are served at once; up to
+// cfg.LoadShedMaxQueue more wait for a slot, each for at most
+// cfg.LoadShedQueueTimeoutSeconds. Requests beyond the queue, or that time out
+// waiting, are shed with 503 and Retry-After so a traffic spike degrades into
+// fast rejections instead of unbounded goroutines and memory.
+//
+// A zero cfg.LoadShedMaxInFlight disables the limiter.
+func Limit(cfg config.Config, next http.Handler) http.Handler {
+	if cfg.LoadShedMaxInFlight <= 0 {
+		return next
+	}
+
+	slots := make(chan struct{}, cfg.LoadShedMaxInFlight)
+	maxQueue := int64(cfg.LoadShedMaxQueue)
+	queueTimeout := time.Duration(cfg.LoadShedQueueTimeoutSeconds) * time.Second
+	retryAfter := strconv.Itoa(cfg.LoadShedRetryAfterSeconds)
+	var queued atomic.Int64
+
+	shed := func(w http.ResponseWriter, r *http.Request, reason string) {
+		logger.Warn(r.Context(), "shedding request", logger.Fields{
+			"reason":       reason,
+			"method":       r.Method,
+			"path":         r.URL.Path,
+			"in_flight":    len(slots),
+			"queued":       queued.Load(),
+			"max_inflight": cap(slots),
+		})
+		w.Header().Set("Retry-After", retryAfter)
+		http.Error(w, "server busy, retry later", http.StatusServiceUnavailable)
+	}
+
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		defer func() { <-slots }()
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fast path: a free slot.
+		select {
+		case slots <- struct{}{}:
+			serve(w, r)
+			return
+		default:
+		}
+
+		if queued.Add(1) > maxQueue {
+			queued.Add(-1)
+			shed(w, r, "queue_full")
+			return
+		}
+
+		timer := time.NewTimer(queueTimeout)
+		defer timer.Stop()
+
+		select {
+		case slots <- struct{}{}:
+			queued.Add(-1)
+			serve(w, r)
+		case <-timer.C:
+			queued.Add(-1)
+			shed(w, r, "queue_timeout")
+		case <-r.Context().Done():
+			// The client gave up while queued; nothing to write.
+			queued.Add(-1)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/rpc"
+	"github.com/bencyrus/chatterbox/shared/apierror"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// PathPrefix is where the media redirect endpoint is mounted.
+const PathPrefix = "/media/"
+
+// signedMedia is the files service response for a signed media URL.
+type signedMedia struct {
+	FileID    int64     `json:"file_id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewHandler serves GET/HEAD /media/{file_id}. It authorizes the caller against
+// PostgREST (cfg.MediaAccessRPCPath with the caller's Authorization header) and
+// then redirects to a short-lived signed streaming URL from the files service.
+//
+// The /media URL itself never expires, so players can use it as a stable source
+// and re-request it whenever the signed URL lapses. Clients that want to refresh
+// ahead of expiry can send `Accept: application/json` to receive
+// {file_id, url, expires_at} instead of a redirect.
+func NewHandler(cfg config.Config) http.Handler {
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fileID, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/"), 10, 64)
+		if err != nil || fileID <= 0 {
+			http.Error(w, "invalid file id", http.StatusBadRequest)
+			return
+		}
+
+		// Authorize with the caller's credentials; relay PostgREST's error as is.
+		access, err := rpc.Call(ctx, client, cfg, r.Header.Get("Authorization"), cfg.MediaAccessRPCPath, map[string]any{"file_id": fileID})
+		if err != nil {
+			logger.Error(ctx, "media access check failed", err, logger.Fields{"file_id": fileID})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !access.OK() {
+			logger.Warn(ctx, "media access denied", logger.Fields{
+				"file_id":     fileID,
+				"status_code": access.StatusCode,
+			})
+			rpc.Write(w, access, access.StatusCode)
+			return
+		}
+
+		media, err := signMedia(ctx, client, cfg, fileID)
+		if err != nil {
+			logger.Error(ctx, "failed to obtain signed media url", err, logger.Fields{"file_id": fileID})
+			http.Error(w, "failed to obtain media url", http.StatusBadGateway)
+			return
+		}
+
+		// The signed URL is per-caller and short-lived; never let it be cached.
+		w.Header().Set("Cache-Control", "private, no-store")
+
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(media)
+			return
+		}
+
+		http.Redirect(w, r, media.URL, http.StatusFound)
+	})
+}
+
+// signMedia asks the files service for a short-lived signed streaming URL.
+func signMedia(ctx context.Context, client *http.Client, cfg config.Config, fileID int64) (*signedMedia, error) {
+	reqBody, err := json.Marshal(map[string]any{"file_id": fileID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signed media request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.FileServiceURL+cfg.FileSignedMediaURLPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed media request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.FileServiceAPIKey != "" {
+		req.Header.Set("X-File-Service-Api-Key", cfg.FileServiceAPIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signed media request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if apiErr := apierror.Read(resp); apiErr != nil {
+			return nil, fmt.Errorf("files service returned status %d for signed media url: %w", resp.StatusCode, apiErr)
+		}
+		return nil, fmt.Errorf("files service returned status %d for signed media url", resp.StatusCode)
+	}
+
+	var media signedMedia
+	if err := json.NewDecoder(resp.Body).Decode(&media); err != nil {
+		return nil, fmt.Errorf("failed to decode signed media response: %w", err)
+	}
+	if media.URL == "" {
+		return nil, fmt.Errorf("files service signed media response missing url")
+	}
+	return &media, nil
+}
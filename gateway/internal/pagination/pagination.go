@@ -0,0 +1,117 @@
+package pagination
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// Enforce wraps next with a safeguard against unbounded list queries on the
+// tables configured by cfg.PaginationTables. A read is considered unbounded when
+// it has neither a `limit` query parameter nor a closed `Range` header, or when
+// either asks for more than cfg.PaginationMaxLimit rows.
+//
+// In "reject" mode such requests fail with 400 before reaching PostgREST. In
+// "auto" mode the request is rewritten to the max page size so callers still get
+// a bounded first page (PostgREST reports the window in Content-Range).
+func Enforce(cfg config.Config, next http.Handler) http.Handler {
+	if len(cfg.PaginationTables) == 0 {
+		return next
+	}
+
+	tables := make(map[string]struct{}, len(cfg.PaginationTables))
+	for _, t := range cfg.PaginationTables {
+		tables["/"+strings.Trim(t, "/")] = struct{}{}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path := strings.TrimRight(r.URL.Path, "/")
+		if _, ok := tables[path]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		maxLimit := cfg.PaginationMaxLimit
+		query := r.URL.Query()
+
+		limit, hasLimit := parseLimit(query.Get("limit"))
+		rangeStart, rangeSize, hasRange := parseRange(r.Header.Get("Range"))
+
+		// PostgREST applies both a limit and a Range together, so either one
+		// within the threshold is enough to bound the result.
+		if (hasLimit && limit <= maxLimit) || (hasRange && rangeSize > 0 && rangeSize <= maxLimit) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Warn(ctx, "unbounded list query on paginated table", logger.Fields{
+			"path":       path,
+			"limit":      query.Get("limit"),
+			"range":      r.Header.Get("Range"),
+			"max_limit":  maxLimit,
+			"pagination": cfg.PaginationMode,
+		})
+
+		if cfg.PaginationMode == config.PaginationModeReject {
+			http.Error(w, "list queries on this resource must specify a limit of at most "+strconv.Itoa(maxLimit), http.StatusBadRequest)
+			return
+		}
+
+		// Auto mode: clamp to at most max rows, preserving the caller's
+		// starting offset when it was expressed as a Range header.
+		r = r.Clone(ctx)
+		if hasRange {
+			r.Header.Set("Range", strconv.Itoa(rangeStart)+"-"+strconv.Itoa(rangeStart+maxLimit-1))
+		}
+		query.Set("limit", strconv.Itoa(maxLimit))
+		r.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseLimit parses a PostgREST `limit` query parameter. Invalid values are
+// reported as absent and left for PostgREST to reject.
+func parseLimit(value string) (int, bool) {
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseRange parses a PostgREST `Range: START-END` header. Open-ended ranges
+// (`START-`) are reported with size 0, meaning unbounded.
+func parseRange(value string) (start, size int, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, 0, false
+	}
+	dash := strings.IndexByte(value, '-')
+	if dash < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(value[:dash]))
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	endStr := strings.TrimSpace(value[dash+1:])
+	if endStr == "" {
+		return start, 0, true
+	}
+	end, err := strconv.Atoi(endStr)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end - start + 1, true
+}
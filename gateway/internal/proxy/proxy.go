@@ -1,13 +1,18 @@
 package proxy
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bencyrus/chatterbox/gateway/internal/auth"
 	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/fields"
 	fileops "github.com/bencyrus/chatterbox/gateway/internal/files"
 	"github.com/bencyrus/chatterbox/shared/logger"
 )
@@ -44,6 +49,17 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"path":        r.URL.Path,
 	})
 
+	// Sparse fieldsets are applied to the response, not sent upstream.
+	spec, err := fields.FromRequest(r)
+	if err != nil {
+		http.Error(w, "invalid "+fields.Header+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if spec != nil {
+		// Never prune away the marker of a failed file URL injection.
+		spec[g.cfg.InjectionErrorFieldName] = nil
+	}
+
 	// Preflight token refresh only when the access token is nearing expiry.
 	// When a refresh succeeds, the proxied request uses the refreshed access
 	// token so that callers do not see spurious 401s for tokens that were
@@ -51,7 +67,7 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var refreshed *auth.RefreshResult
 	if auth.ShouldRefreshAccessToken(g.cfg, r.Header, time.Now()) && r.Header.Get(g.cfg.RefreshTokenHeaderIn) != "" {
 		logger.Debug(ctx, "attempting token refresh")
-		refreshed = auth.PreflightRefresh(ctx, g.cfg, r.Header, 2*time.Second)
+		refreshed = auth.PreflightRefresh(ctx, g.cfg, r, 2*time.Second)
 		if refreshed != nil {
 			logger.Info(ctx, "token refresh successful")
 		}
@@ -62,7 +78,11 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			// Forward to PostgREST backend
 			req.URL.Scheme = g.backend.Scheme
 			req.URL.Host = g.backend.Host
-			// Preserve original path and query
+			// Preserve original path and query, minus the field list
+			fields.StripQuery(req.URL)
+			req.Header.Del(fields.Header)
+			// Replace any client-sent device and IP headers with our own
+			auth.SetSessionHeaders(req.Header, r)
 			// If we obtained refreshed tokens with a non-empty access token,
 			// ensure the proxied request uses the refreshed access token.
 			// The refresh token is only consumed by the gateway on future
@@ -85,9 +105,55 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 			// Process file URLs if needed
 			fileops.ProcessFileURLsIfNeeded(ctx, g.cfg, resp)
+
+			// Prune to the requested fields once URLs are injected
+			fields.ShapeResponse(resp, spec)
+
+			if resp.Request != nil && resp.Request.Method == http.MethodHead {
+				g.setHeadContentLength(ctx, resp, spec)
+			}
 			return nil
 		},
 	}
 
 	proxy.ServeHTTP(w, r)
 }
+
+// setHeadContentLength sets a HEAD response's Content-Length to that of the
+// matching GET after file URL injection and field shaping. The upstream
+// length describes the unmodified body, and HEAD has none to rewrite, so the
+// request is replayed upstream as a GET and run through the same steps. A
+// HEAD on a JSON route therefore costs as much as the GET, file service
+// signing included. When the replay fails or answers with another status,
+// the upstream length is passed through.
+func (g *Gateway) setHeadContentLength(ctx context.Context, resp *http.Response, spec fields.Spec) {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return
+	}
+
+	get := resp.Request.Clone(ctx)
+	get.Method = http.MethodGet
+	get.Body = nil
+	get.ContentLength = 0
+
+	replayed, err := g.transport.RoundTrip(get)
+	if err != nil {
+		logger.Warn(ctx, "HEAD content length replay failed", logger.Fields{"error": err.Error()})
+		return
+	}
+	defer replayed.Body.Close()
+	if replayed.StatusCode != resp.StatusCode {
+		return
+	}
+	replayed.Request = get
+
+	fileops.ProcessFileURLsIfNeeded(ctx, g.cfg, replayed)
+	fields.ShapeResponse(replayed, spec)
+
+	length, err := io.Copy(io.Discard, replayed.Body)
+	if err != nil {
+		return
+	}
+	resp.ContentLength = length
+	resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/fields"
+)
+
+const upstreamBody = `{"id":1,"title":"lesson","files":[7]}`
+
+func newTestGateway(t *testing.T) *Gateway {
+	t.Helper()
+	fileService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"file_id":7,"url":"https://storage.example.com/7?sig=abc"}]`)
+	}))
+	t.Cleanup(fileService.Close)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(upstreamBody)))
+		if r.Method != http.MethodHead {
+			io.WriteString(w, upstreamBody)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	g, err := NewGateway(config.Config{
+		PostgRESTURL:              upstream.URL,
+		FileServiceURL:            fileService.URL,
+		FileSignedDownloadURLPath: "/signed_download_url",
+		FilesFieldName:            "files",
+		ProcessedFilesFieldName:   "processed_files",
+		InjectionErrorFieldName:   "files_error",
+		HTTPClientTimeoutSeconds:  5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func serve(g *Gateway, method, fieldList string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/lessons", nil)
+	if fieldList != "" {
+		req.Header.Set(fields.Header, fieldList)
+	}
+	rec := httptest.NewRecorder()
+	g.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHeadContentLengthMatchesGet(t *testing.T) {
+	g := newTestGateway(t)
+	for _, fieldList := range []string{"", "id,processed_files.url"} {
+		get := serve(g, http.MethodGet, fieldList)
+		head := serve(g, http.MethodHead, fieldList)
+
+		want := strconv.Itoa(get.Body.Len())
+		if want == strconv.Itoa(len(upstreamBody)) {
+			t.Fatalf("X-Fields %q: GET body was not rewritten", fieldList)
+		}
+		if got := head.Header().Get("Content-Length"); got != want {
+			t.Errorf("X-Fields %q: HEAD Content-Length = %q, want %s (the GET body)", fieldList, got, want)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("X-Fields %q: HEAD wrote a body", fieldList)
+		}
+	}
+}
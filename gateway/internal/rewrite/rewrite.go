@@ -0,0 +1,59 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// Paths wraps next so URL structure can change without lockstep client
+// releases. With cfg.PathPrefix set (e.g. /api/v1), a request under the
+// prefix is served as if it had been made without it; requests without the
+// prefix pass through unchanged, so old clients keep working while new ones
+// move over. cfg.PathRewrites then maps exact legacy paths (e.g. an old RPC
+// name) to their replacements. Both apply before routing, so gateway
+// endpoints and the PostgREST proxy see the rewritten path.
+//
+// With neither configured, next is returned as is.
+func Paths(cfg config.Config, next http.Handler) http.Handler {
+	if cfg.PathPrefix == "" && len(cfg.PathRewrites) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if cfg.PathPrefix != "" {
+			if path == cfg.PathPrefix {
+				path = "/"
+			} else if rest, ok := strings.CutPrefix(path, cfg.PathPrefix+"/"); ok {
+				path = "/" + rest
+			}
+		}
+		if to, ok := cfg.PathRewrites[path]; ok {
+			path = to
+		}
+
+		if path == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Debug(r.Context(), "rewrote request path", logger.Fields{
+			"from": r.URL.Path,
+			"to":   path,
+		})
+
+		// Shallow-copy the request with a rewritten URL, as http.StripPrefix
+		// does; RawPath is dropped so the new Path is used for encoding.
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,68 @@
+// Package rpc calls PostgREST RPC functions on behalf of a gateway caller.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+)
+
+// Response is a buffered PostgREST response.
+type Response struct {
+	StatusCode  int
+	Body        []byte
+	ContentType string
+}
+
+// OK reports whether PostgREST answered with a 2xx status.
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Call posts args as JSON to cfg.PostgRESTURL+path, forwarding the caller's
+// Authorization header (if any) so the database function runs as the caller.
+func Call(ctx context.Context, client *http.Client, cfg config.Config, authorization, path string, args any) (*Response, error) {
+	reqBody, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rpc request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.PostgRESTURL+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rpc request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rpc request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rpc response: %w", err)
+	}
+	return &Response{
+		StatusCode:  resp.StatusCode,
+		Body:        body,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// Write relays resp to w with the given status (use resp.StatusCode to pass it
+// through unchanged).
+func Write(w http.ResponseWriter, resp *Response, status int) {
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(resp.Body)
+}
@@ -0,0 +1,83 @@
+package sessions
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/gateway/internal/config"
+	"github.com/bencyrus/chatterbox/gateway/internal/rpc"
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// PathPrefix is where the session endpoints are mounted. Both the bare
+// collection path and everything below it are routed here.
+const PathPrefix = "/sessions"
+
+// PostgREST RPCs backing each operation; they act on the caller's own account.
+const (
+	listRPCPath   = "/rpc/list_sessions"
+	revokeRPCPath = "/rpc/revoke_session"
+)
+
+// NewHandler serves the caller's refresh-token sessions:
+//
+//	GET    /sessions        list active sessions (device, last used, IP)
+//	DELETE /sessions/{id}   revoke a session so its refresh token stops working
+//
+// Device details are recorded by the gateway whenever it refreshes tokens.
+// PostgREST errors are relayed as is.
+func NewHandler(cfg config.Config) http.Handler {
+	client := &http.Client{Timeout: time.Duration(cfg.HTTPClientTimeoutSeconds) * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var rpcPath string
+		args := map[string]any{}
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+		switch {
+		case rest == "" && r.Method == http.MethodGet:
+			rpcPath = listRPCPath
+		case rest == "":
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		default:
+			sessionID, err := strconv.ParseInt(rest, 10, 64)
+			if err != nil || sessionID <= 0 {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Method != http.MethodDelete {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			rpcPath = revokeRPCPath
+			args["session_id"] = sessionID
+		}
+
+		resp, err := rpc.Call(ctx, client, cfg, authorization, rpcPath, args)
+		if err != nil {
+			logger.Error(ctx, "session request failed", err, logger.Fields{"rpc": rpcPath})
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !resp.OK() {
+			logger.Warn(ctx, "session request rejected", logger.Fields{
+				"rpc":         rpcPath,
+				"status_code": resp.StatusCode,
+			})
+		}
+
+		w.Header().Set("Cache-Control", "private, no-store")
+		rpc.Write(w, resp, resp.StatusCode)
+	})
+}
@@ -0,0 +1,49 @@
+-- batch dequeue: claim several tasks per round-trip for higher worker throughput
+--
+-- same availability rules and lease duration as queues.dequeue_next_available_task(),
+-- but returns up to _limit tasks in a single call so the worker can fan them out
+-- to its goroutines without one query per task.
+
+-- dequeue and claim up to _limit available tasks with time-limited leases
+create or replace function queues.dequeue_available_tasks(_limit integer)
+returns setof queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _lease_duration interval := interval '5 minutes';
+begin
+    return query
+    with claimed as (
+        select t.*
+        from queues.task t
+        where not exists (
+            select 1
+            from queues.task_completed c
+            where c.task_id = t.task_id
+        )
+        and not exists (
+            select 1
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        )
+        and t.scheduled_at <= now()
+        order by t.scheduled_at, t.task_id
+        limit greatest(coalesce(_limit, 1), 1)
+        for update skip locked
+    ),
+    leased as (
+        insert into queues.task_lease (task_id, expires_at)
+        select
+            task_id,
+            now() + _lease_duration
+        from claimed
+    )
+    select *
+    from claimed
+    order by scheduled_at, task_id;
+end;
+$$;
+
+grant execute on function queues.dequeue_available_tasks(integer) to worker_service_user;
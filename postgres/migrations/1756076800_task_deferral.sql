@@ -0,0 +1,23 @@
+-- task deferral: let the worker hold a task until a business-meaningful time
+--
+-- comms payloads may carry not_before/deliver_at independent of scheduled_at, so
+-- handlers can enqueue immediately but deliver later. when the worker dequeues such
+-- a task early it appends a lease that expires at the delivery time instead of
+-- completing the task; the dequeue functions already skip tasks with an active lease.
+
+-- defer a task until _until by appending a lease that expires then
+create or replace function queues.defer_task(
+    _task_id bigint,
+    _until timestamp with time zone
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.task_lease (task_id, expires_at)
+    values (_task_id, greatest(coalesce(_until, now()), now()));
+end;
+$$;
+
+grant execute on function queues.defer_task(bigint, timestamp with time zone) to worker_service_user;
@@ -0,0 +1,57 @@
+-- task event timeline: one append-only row per lifecycle transition of a task
+--
+-- the worker records dequeued, deferred, before_handler_*, provider_called,
+-- succeeded and failed events through queues.append_event so the full history of
+-- a task (e.g. a stuck transcription) can be read with a single query instead of
+-- correlating logs across services:
+--
+--   select * from queues.task_event where task_id = $1 order by task_event_id;
+
+-- queues.task_event: append-only lifecycle events per task
+create table queues.task_event (
+    task_event_id bigserial primary key,
+    task_id bigint not null references queues.task(task_id) on delete cascade,
+    event_type text not null,
+    details jsonb not null default '{}'::jsonb,
+    created_at timestamp with time zone not null default now()
+);
+
+create index task_event_task_id_idx on queues.task_event (task_id, task_event_id);
+
+-- append a lifecycle event for a task
+-- a dequeue of a task that was already dequeued without an intervening deferral
+-- (lease expired after a crash or timeout) is recorded as retried
+create or replace function queues.append_event(
+    _task_id bigint,
+    _event_type text,
+    _details jsonb default '{}'::jsonb
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _type text := _event_type;
+begin
+    if _type = 'dequeued' and exists (
+        select 1
+        from queues.task_event e
+        where e.task_id = _task_id
+        and e.event_type in ('dequeued', 'retried')
+        and not exists (
+            select 1
+            from queues.task_event d
+            where d.task_id = _task_id
+            and d.event_type = 'deferred'
+            and d.task_event_id > e.task_event_id
+        )
+    ) then
+        _type := 'retried';
+    end if;
+
+    insert into queues.task_event (task_id, event_type, details)
+    values (_task_id, _type, coalesce(_details, '{}'::jsonb));
+end;
+$$;
+
+grant execute on function queues.append_event(bigint, text, jsonb) to worker_service_user;
@@ -0,0 +1,74 @@
+-- task error classes: worker-level retry and dead-letter for classified failures
+--
+-- processors classify provider errors as permanent, retryable or rate limited.
+-- retryable/rate-limited failures are retried by the worker (the task is
+-- re-leased with a backoff instead of completed) until the per-task retry budget
+-- is spent; the budget is counted from queues.error rows for the task, which the
+-- worker appends via queues.fail_task on every failure. permanent failures are
+-- recorded in queues.task_dead_letter before the error handler runs.
+--
+-- queues.defer_task is redefined to release the current claim so a retry (or a
+-- deferral) becomes available at the requested time rather than when the
+-- dequeue lease would have expired.
+
+-- queues.task_dead_letter: tasks that failed permanently (one per task)
+create table queues.task_dead_letter (
+    task_id bigint primary key references queues.task(task_id) on delete cascade,
+    error_class text not null,
+    error_message text not null,
+    dead_lettered_at timestamp with time zone not null default now()
+);
+
+-- count recorded failures for a task (used for the worker retry budget)
+create or replace function queues.count_task_errors(_task_id bigint)
+returns integer
+language sql
+stable
+security definer
+as $$
+    select count(*)::integer
+    from queues.error e
+    where e.task_id = _task_id;
+$$;
+
+-- move a task to the dead-letter table (idempotent)
+create or replace function queues.dead_letter_task(
+    _task_id bigint,
+    _error_class text,
+    _error_message text
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.task_dead_letter (task_id, error_class, error_message)
+    values (_task_id, _error_class, _error_message)
+    on conflict (task_id) do nothing;
+end;
+$$;
+
+grant execute on function queues.count_task_errors(bigint) to worker_service_user;
+grant execute on function queues.dead_letter_task(bigint, text, text) to worker_service_user;
+
+-- defer a task until _until: release the worker's current claim and append a
+-- lease that expires then, so short retry delays are not held back by the
+-- remaining 5-minute dequeue lease
+create or replace function queues.defer_task(
+    _task_id bigint,
+    _until timestamp with time zone
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    update queues.task_lease
+    set expires_at = now()
+    where task_id = _task_id
+    and expires_at > now();
+
+    insert into queues.task_lease (task_id, expires_at)
+    values (_task_id, greatest(coalesce(_until, now()), now()));
+end;
+$$;
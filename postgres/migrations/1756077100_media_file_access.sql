@@ -0,0 +1,38 @@
+-- media file access: authorization check for the gateway /media/{file_id} redirect
+--
+-- the gateway calls this with the caller's jwt before asking the files service for
+-- a short-lived streaming url, so only files owned by the caller's account (and not
+-- deleted) can be streamed.
+
+-- api: confirm the authenticated account may stream a file
+create or replace function api.media_file(
+    file_id bigint
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Get Media File Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_get_media_file';
+    end if;
+
+    if not exists (
+        select 1
+        from files.account_files(_authenticated_account_id) f
+        where f.file_id = media_file.file_id
+    ) then
+        raise exception 'Get Media File Failed'
+            using detail = 'Invalid File',
+                  hint = 'file_not_found';
+    end if;
+
+    return jsonb_build_object('file_id', file_id);
+end;
+$$;
+
+grant execute on function api.media_file(bigint) to authenticated;
@@ -0,0 +1,39 @@
+-- task idempotency keys: guard external side effects against duplicate execution
+--
+-- a task can be dequeued again after a crash or lease expiry even though its
+-- provider call (email, sms, transcription kickoff, ...) already went out. right
+-- before the side effect the worker claims a key derived from task_id + attempt
+-- (attempt = recorded failures + 1, so deliberate worker retries get a fresh key).
+-- if the key is already claimed the side effect is skipped.
+
+-- queues.idempotency_key: one row per claimed side effect
+create table queues.idempotency_key (
+    idempotency_key text primary key,
+    task_id bigint not null references queues.task(task_id) on delete cascade,
+    claimed_at timestamp with time zone not null default now()
+);
+
+create index idempotency_key_task_id_idx on queues.idempotency_key (task_id);
+
+-- claim an idempotency key; returns false when it was already claimed
+create or replace function queues.claim_idempotency_key(
+    _task_id bigint,
+    _idempotency_key text
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _claimed boolean;
+begin
+    insert into queues.idempotency_key (idempotency_key, task_id)
+    values (_idempotency_key, _task_id)
+    on conflict (idempotency_key) do nothing
+    returning true into _claimed;
+
+    return coalesce(_claimed, false);
+end;
+$$;
+
+grant execute on function queues.claim_idempotency_key(bigint, text) to worker_service_user;
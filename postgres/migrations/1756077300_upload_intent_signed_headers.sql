@@ -0,0 +1,37 @@
+-- upload intent signed headers: extra headers bound into signed upload urls
+--
+-- browsers uploading directly to GCS with custom metadata fail unless those headers
+-- are part of the v4 signature (and allowed by the bucket cors config). upload
+-- intents can now carry headers such as cache-control, content-disposition or
+-- x-goog-meta-* that the files service signs into the url and returns to the
+-- client, which must send them verbatim with the PUT.
+
+alter table files.upload_intent
+    add column if not exists signed_headers jsonb not null default '{}'::jsonb;
+
+alter table files.upload_intent
+    drop constraint if exists upload_intent_signed_headers_is_object;
+
+alter table files.upload_intent
+    add constraint upload_intent_signed_headers_is_object
+    check (jsonb_typeof(signed_headers) = 'object');
+
+-- lookup upload intent metadata for the files service (now with signed headers)
+create or replace function files.lookup_upload_intent(
+    _upload_intent_id bigint
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select jsonb_build_object(
+        'upload_intent_id', ui.upload_intent_id,
+        'bucket', ui.bucket,
+        'object_key', ui.object_key,
+        'mime_type', ui.mime_type,
+        'signed_headers', ui.signed_headers
+    )
+    from files.upload_intent ui
+    where ui.upload_intent_id = _upload_intent_id;
+$$;
@@ -0,0 +1,125 @@
+-- recurring tasks: cron-style definitions the worker scheduler turns into tasks
+--
+-- each definition holds a 5-field cron expression (evaluated in utc unless it
+-- starts with CRON_TZ=<zone>), a task type and the payload to enqueue. the worker
+-- computes run times; the database owns the definitions and makes each run
+-- enqueue at most once. only the instance holding the scheduler lease schedules,
+-- so a fleet of workers does not enqueue duplicates.
+--
+-- a new definition (next_run_at null) is first given its next run time without
+-- enqueuing. when runs were missed (e.g. no worker was up) a single catch-up
+-- task is enqueued and the next run is computed from now.
+
+-- queues.recurring_task: recurring task definitions
+create table queues.recurring_task (
+    recurring_task_id bigserial primary key,
+    name text not null unique,
+    cron_expression text not null,
+    task_type queues.task_type not null,
+    payload jsonb not null default '{}'::jsonb,
+    enabled boolean not null default true,
+    next_run_at timestamp with time zone,
+    last_enqueued_at timestamp with time zone,
+    created_at timestamp with time zone not null default now()
+);
+
+-- queues.scheduler_lease: leader election for the recurring task scheduler
+create table queues.scheduler_lease (
+    lease_name text primary key,
+    holder text not null,
+    expires_at timestamp with time zone not null
+);
+
+-- acquire or renew the scheduler lease; returns true when _holder is the leader
+create or replace function queues.acquire_scheduler_lease(
+    _holder text,
+    _ttl_seconds integer
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _acquired boolean;
+begin
+    insert into queues.scheduler_lease (lease_name, holder, expires_at)
+    values ('recurring_tasks', _holder, now() + make_interval(secs => _ttl_seconds))
+    on conflict (lease_name) do update
+    set holder = excluded.holder,
+        expires_at = excluded.expires_at
+    where queues.scheduler_lease.holder = excluded.holder
+    or queues.scheduler_lease.expires_at <= now()
+    returning true into _acquired;
+
+    return coalesce(_acquired, false);
+end;
+$$;
+
+-- release the scheduler lease (on shutdown) so another worker can take over
+create or replace function queues.release_scheduler_lease(
+    _holder text
+)
+returns void
+language sql
+security definer
+as $$
+    delete from queues.scheduler_lease
+    where lease_name = 'recurring_tasks'
+    and holder = _holder;
+$$;
+
+-- enabled definitions that are due (or have no next run time yet)
+create or replace function queues.due_recurring_tasks()
+returns table (
+    recurring_task_id bigint,
+    name text,
+    cron_expression text,
+    next_run_at timestamp with time zone
+)
+language sql
+stable
+security definer
+as $$
+    select rt.recurring_task_id, rt.name, rt.cron_expression, rt.next_run_at
+    from queues.recurring_task rt
+    where rt.enabled
+    and (rt.next_run_at is null or rt.next_run_at <= now())
+    order by rt.next_run_at nulls first, rt.recurring_task_id;
+$$;
+
+-- enqueue the run due at _run_at (when not null) and advance the definition to
+-- _next_run_at. the update only applies while next_run_at still equals _run_at,
+-- so a run is enqueued at most once. returns true when a task was enqueued.
+create or replace function queues.schedule_recurring_task(
+    _recurring_task_id bigint,
+    _run_at timestamp with time zone,
+    _next_run_at timestamp with time zone
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _definition queues.recurring_task;
+begin
+    update queues.recurring_task rt
+    set next_run_at = _next_run_at,
+        last_enqueued_at = case when _run_at is null then rt.last_enqueued_at else now() end
+    where rt.recurring_task_id = _recurring_task_id
+    and rt.enabled
+    and rt.next_run_at is not distinct from _run_at
+    returning * into _definition;
+
+    if not found or _run_at is null then
+        return false;
+    end if;
+
+    perform queues.enqueue(_definition.task_type, _definition.payload, now());
+    return true;
+end;
+$$;
+
+grant execute on function queues.acquire_scheduler_lease(text, integer) to worker_service_user;
+grant execute on function queues.release_scheduler_lease(text) to worker_service_user;
+grant execute on function queues.due_recurring_tasks() to worker_service_user;
+grant execute on function queues.schedule_recurring_task(bigint, timestamp with time zone, timestamp with time zone) to worker_service_user;
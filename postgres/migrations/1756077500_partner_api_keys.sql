@@ -0,0 +1,246 @@
+-- partner api keys: self-serve lifecycle for partner credentials
+--
+-- keys are random tokens shown to the caller exactly once (on create/rotate); only
+-- their sha256 hash and a short display prefix are stored. management functions
+-- are restricted to accounts with the new 'admin' role and are exposed by the
+-- gateway under /partner-api-keys. auth.verify_partner_api_key resolves a
+-- presented key, but nothing calls it yet: no gateway or postgrest auth path
+-- accepts partner api keys, so the keys authenticate no requests.
+
+-- admin role for operator-only endpoints
+alter domain accounts.account_role_type
+    drop constraint if exists account_role_type_check;
+
+alter domain accounts.account_role_type
+    add constraint account_role_type_check
+    check (value in ('creator', 'user', 'admin'));
+
+-- function: check if the given account has the 'admin' role
+create or replace function auth.is_admin_account(_account_id bigint)
+returns boolean
+stable
+language sql
+security definer
+as $$
+    select exists (
+        select 1
+        from accounts.account_role
+        where account_id = _account_id
+        and role = 'admin'
+    );
+$$;
+
+-- tables
+create table auth.partner_api_key (
+    partner_api_key_id bigserial primary key,
+    name text not null,
+    key_prefix text not null,
+    key_hash bytea not null unique,
+    created_by bigint references accounts.account(account_id) on delete set null,
+    created_at timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    rotated_from_partner_api_key_id bigint references auth.partner_api_key(partner_api_key_id) on delete set null
+);
+
+-- helpers
+create or replace function auth.hash_partner_api_key(_api_key text)
+returns bytea
+immutable
+language sql
+as $$
+    select digest(coalesce(_api_key, ''), 'sha256');
+$$;
+
+-- public view of a key (never includes the hash)
+create or replace function auth.partner_api_key_json(_key auth.partner_api_key)
+returns jsonb
+stable
+language sql
+as $$
+    select jsonb_build_object(
+        'partner_api_key_id', _key.partner_api_key_id,
+        'name', _key.name,
+        'key_prefix', _key.key_prefix,
+        'created_by', _key.created_by,
+        'created_at', _key.created_at,
+        'last_used_at', _key.last_used_at,
+        'revoked_at', _key.revoked_at,
+        'rotated_from_partner_api_key_id', _key.rotated_from_partner_api_key_id
+    );
+$$;
+
+-- create a key; returns the stored row and the plaintext key (only time it exists)
+create or replace function auth.create_partner_api_key(
+    _name text,
+    _created_by bigint,
+    _rotated_from_partner_api_key_id bigint default null,
+    out api_key text,
+    out row_data auth.partner_api_key
+)
+returns record
+language plpgsql
+security definer
+as $$
+declare
+    _api_key_plain text := 'cbx_' || auth.url_encode(gen_random_bytes(32));
+begin
+    insert into auth.partner_api_key (name, key_prefix, key_hash, created_by, rotated_from_partner_api_key_id)
+    values (
+        _name,
+        left(_api_key_plain, 12),
+        auth.hash_partner_api_key(_api_key_plain),
+        _created_by,
+        _rotated_from_partner_api_key_id
+    )
+    returning * into row_data;
+
+    api_key := _api_key_plain;
+    return;
+end;
+$$;
+
+-- resolve a presented key; null when unknown or revoked. not called by any
+-- auth path yet
+create or replace function auth.verify_partner_api_key(_api_key text)
+returns auth.partner_api_key
+language sql
+security definer
+as $$
+    update auth.partner_api_key k
+    set last_used_at = now()
+    where k.key_hash = auth.hash_partner_api_key(_api_key)
+    and k.revoked_at is null
+    returning k.*;
+$$;
+
+-- api: create a partner api key (admin only)
+create or replace function api.create_partner_api_key(name text)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _create_result record; -- OUT: api_key text, row_data auth.partner_api_key
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Create Partner API Key Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_partner_api_keys';
+    end if;
+
+    if nullif(trim(create_partner_api_key.name), '') is null then
+        raise exception 'Create Partner API Key Failed'
+            using detail = 'Invalid Input',
+                  hint = 'name_missing';
+    end if;
+
+    _create_result := auth.create_partner_api_key(trim(create_partner_api_key.name), _authenticated_account_id);
+
+    return auth.partner_api_key_json(_create_result.row_data)
+        || jsonb_build_object('api_key', _create_result.api_key);
+end;
+$$;
+
+-- api: list partner api keys, newest first (admin only)
+create or replace function api.list_partner_api_keys()
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'List Partner API Keys Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_partner_api_keys';
+    end if;
+
+    return coalesce(
+        (
+            select jsonb_agg(auth.partner_api_key_json(k) order by k.partner_api_key_id desc)
+            from auth.partner_api_key k
+        ),
+        '[]'::jsonb
+    );
+end;
+$$;
+
+-- api: rotate a key: revoke it and issue a replacement with the same name (admin only)
+create or replace function api.rotate_partner_api_key(partner_api_key_id bigint)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _existing auth.partner_api_key;
+    _create_result record; -- OUT: api_key text, row_data auth.partner_api_key
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Rotate Partner API Key Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_partner_api_keys';
+    end if;
+
+    update auth.partner_api_key k
+    set revoked_at = now()
+    where k.partner_api_key_id = rotate_partner_api_key.partner_api_key_id
+    and k.revoked_at is null
+    returning k.* into _existing;
+
+    if not found then
+        raise exception 'Rotate Partner API Key Failed'
+            using detail = 'Invalid Key',
+                  hint = 'partner_api_key_not_found';
+    end if;
+
+    _create_result := auth.create_partner_api_key(
+        _existing.name,
+        _authenticated_account_id,
+        _existing.partner_api_key_id
+    );
+
+    return auth.partner_api_key_json(_create_result.row_data)
+        || jsonb_build_object('api_key', _create_result.api_key);
+end;
+$$;
+
+-- api: revoke a key (admin only; idempotent for already revoked keys)
+create or replace function api.revoke_partner_api_key(partner_api_key_id bigint)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _key auth.partner_api_key;
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Revoke Partner API Key Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_partner_api_keys';
+    end if;
+
+    update auth.partner_api_key k
+    set revoked_at = coalesce(k.revoked_at, now())
+    where k.partner_api_key_id = revoke_partner_api_key.partner_api_key_id
+    returning k.* into _key;
+
+    if not found then
+        raise exception 'Revoke Partner API Key Failed'
+            using detail = 'Invalid Key',
+                  hint = 'partner_api_key_not_found';
+    end if;
+
+    return auth.partner_api_key_json(_key);
+end;
+$$;
+
+grant execute on function api.create_partner_api_key(text) to authenticated;
+grant execute on function api.list_partner_api_keys() to authenticated;
+grant execute on function api.rotate_partner_api_key(bigint) to authenticated;
+grant execute on function api.revoke_partner_api_key(bigint) to authenticated;
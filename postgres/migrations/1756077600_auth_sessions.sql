@@ -0,0 +1,244 @@
+-- auth sessions: track refresh-token sessions so users can see and revoke devices
+--
+-- every refresh token now carries a session id ('sid' claim) backed by a row in
+-- auth.session. logins start a new session; api.refresh_tokens keeps the session,
+-- records when it was last used and, when called by the gateway, the device's
+-- user agent, a parsed device label and the client ip. a revoked session can no
+-- longer refresh (its outstanding access token stays valid until it expires).
+-- refresh tokens issued before this migration have no sid and are moved onto a
+-- new session the first time they refresh.
+
+-- tables
+create table auth.session (
+    session_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    created_at timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone not null default now(),
+    device text,
+    user_agent text,
+    ip_address text,
+    revoked_at timestamp with time zone
+);
+
+create index session_account_id_idx on auth.session (account_id);
+
+-- helpers
+create or replace function auth.create_session(_account_id bigint)
+returns bigint
+language sql
+security definer
+as $$
+    insert into auth.session (account_id)
+    values (_account_id)
+    returning session_id;
+$$;
+
+-- read the sid claim of an already validated token (null for legacy tokens)
+create or replace function auth.token_session_id(_token text)
+returns bigint
+immutable
+language sql
+as $$
+    select nullif(
+        convert_from(auth.url_decode(split_part(_token, '.', 2)), 'utf8')::jsonb ->> 'sid',
+        ''
+    )::bigint;
+$$;
+
+-- public view of a session
+create or replace function auth.session_json(_session auth.session)
+returns jsonb
+stable
+language sql
+as $$
+    select jsonb_build_object(
+        'session_id', _session.session_id,
+        'created_at', _session.created_at,
+        'last_used_at', _session.last_used_at,
+        'device', _session.device,
+        'user_agent', _session.user_agent,
+        'ip_address', _session.ip_address
+    );
+$$;
+
+-- create a refresh token bound to an existing session
+create or replace function auth.create_session_refresh_token(
+    _account_id bigint,
+    _session_id bigint,
+    out refresh_token text
+)
+returns text
+stable
+language plpgsql
+security definer
+as $$
+declare
+    _jwt_config record := auth.jwt_config();
+begin
+    refresh_token := auth.sign(
+        jsonb_build_object(
+            'sub', _account_id,
+            'sid', _session_id,
+            'role', 'authenticated',
+            'token_use', 'refresh'::auth.token_use,
+            'iat', extract(epoch from now())::int,
+            'nbf', extract(epoch from now())::int,
+            'exp', extract(
+                epoch from now() + make_interval(
+                    secs => (_jwt_config.refresh_token_expiry_seconds)
+                )
+            )::int
+        ),
+        (_jwt_config.secret),
+        'HS256'
+    );
+
+    return;
+end;
+$$;
+
+-- Create refresh token function: starts a new session and returns its refresh token
+-- (used by every login flow)
+create or replace function auth.create_refresh_token(
+    _account_id bigint,
+    out refresh_token text
+)
+returns text
+volatile
+language plpgsql
+security definer
+as $$
+begin
+    refresh_token := auth.create_session_refresh_token(_account_id, auth.create_session(_account_id));
+    return;
+end;
+$$;
+
+-- Refresh tokens function: refreshes access and refresh tokens within the token's
+-- session. device details are supplied by the gateway and stored when present.
+drop function if exists api.refresh_tokens(text);
+
+create or replace function api.refresh_tokens(
+    refresh_token text,
+    user_agent text default null,
+    device text default null,
+    ip_address text default null
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _access_token text;
+    _new_refresh_token text;
+    _validate_result record;
+    _session_id bigint;
+begin
+    if refresh_token is null then
+        raise exception 'Refresh Failed'
+            using detail = 'Missing Refresh Token',
+                  hint = 'missing_refresh_token';
+    end if;
+
+    _validate_result := auth.validate_token(refresh_token, 'refresh'::auth.token_use);
+
+    if _validate_result.validation_failure_message is not null then
+        raise exception 'Refresh Failed'
+            using detail = 'Invalid Refresh Token',
+                  hint = _validate_result.validation_failure_message;
+    end if;
+
+    _session_id := auth.token_session_id(refresh_token);
+    if _session_id is null then
+        _session_id := auth.create_session(_validate_result.account_id);
+    end if;
+
+    update auth.session s
+    set last_used_at = now(),
+        user_agent = coalesce(nullif(refresh_tokens.user_agent, ''), s.user_agent),
+        device = coalesce(nullif(refresh_tokens.device, ''), s.device),
+        ip_address = coalesce(nullif(refresh_tokens.ip_address, ''), s.ip_address)
+    where s.session_id = _session_id
+    and s.account_id = _validate_result.account_id
+    and s.revoked_at is null;
+
+    if not found then
+        raise exception 'Refresh Failed'
+            using detail = 'Invalid Refresh Token',
+                  hint = 'session_revoked';
+    end if;
+
+    _access_token := auth.create_access_token(_validate_result.account_id);
+    _new_refresh_token := auth.create_session_refresh_token(_validate_result.account_id, _session_id);
+
+    return jsonb_build_object(
+        'access_token', _access_token,
+        'refresh_token', _new_refresh_token
+    );
+end;
+$$;
+
+grant execute on function api.refresh_tokens(text, text, text, text) to anon;
+
+-- api: list the authenticated account's active sessions, most recently used first
+create or replace function api.list_sessions()
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if _authenticated_account_id is null then
+        raise exception 'List Sessions Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_list_sessions';
+    end if;
+
+    return coalesce(
+        (
+            select jsonb_agg(auth.session_json(s) order by s.last_used_at desc)
+            from auth.session s
+            where s.account_id = _authenticated_account_id
+            and s.revoked_at is null
+        ),
+        '[]'::jsonb
+    );
+end;
+$$;
+
+-- api: revoke one of the authenticated account's sessions (idempotent)
+create or replace function api.revoke_session(session_id bigint)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _session auth.session;
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Revoke Session Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_revoke_session';
+    end if;
+
+    update auth.session s
+    set revoked_at = coalesce(s.revoked_at, now())
+    where s.session_id = revoke_session.session_id
+    and s.account_id = _authenticated_account_id
+    returning s.* into _session;
+
+    if not found then
+        raise exception 'Revoke Session Failed'
+            using detail = 'Invalid Session',
+                  hint = 'session_not_found';
+    end if;
+
+    return auth.session_json(_session) || jsonb_build_object('revoked_at', _session.revoked_at);
+end;
+$$;
+
+grant execute on function api.list_sessions() to authenticated;
+grant execute on function api.revoke_session(bigint) to authenticated;
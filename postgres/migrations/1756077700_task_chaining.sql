@@ -0,0 +1,101 @@
+-- task chaining: follow-up tasks declared by a task's result
+--
+-- a db_function or success handler result may carry next_tasks
+-- ([{ task_type, payload, scheduled_at? }]); after the task succeeds the worker
+-- enqueues them through queues.enqueue_next_tasks so multi-step workflows
+-- (transcribe -> summarize -> notify) can be declared step by step.
+--
+-- loop protection:
+-- - every chained task records its parent, the chain's root task and its depth;
+--   enqueueing beyond _max_depth raises instead of enqueueing.
+-- - a parent enqueues its follow-ups at most once, so re-running a task (e.g.
+--   after a crash before completion) does not fork the workflow.
+
+-- queues.task_chain: parent/child links between chained tasks
+create table queues.task_chain (
+    child_task_id bigint primary key references queues.task(task_id) on delete cascade,
+    parent_task_id bigint not null references queues.task(task_id) on delete cascade,
+    root_task_id bigint not null references queues.task(task_id) on delete cascade,
+    depth integer not null check (depth > 0),
+    created_at timestamp with time zone not null default now()
+);
+
+create index task_chain_parent_task_id_idx on queues.task_chain (parent_task_id);
+create index task_chain_root_task_id_idx on queues.task_chain (root_task_id);
+
+-- enqueue follow-up tasks for _parent_task_id; returns how many were enqueued
+-- (0 when the parent already enqueued its follow-ups)
+create or replace function queues.enqueue_next_tasks(
+    _parent_task_id bigint,
+    _next_tasks jsonb,
+    _max_depth integer
+)
+returns integer
+language plpgsql
+security definer
+as $$
+declare
+    _parent_chain queues.task_chain;
+    _root_task_id bigint;
+    _depth integer;
+    _next_task jsonb;
+    _child_task_id bigint;
+    _enqueued integer := 0;
+begin
+    if jsonb_typeof(_next_tasks) is distinct from 'array' then
+        raise exception 'Enqueue Next Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'next_tasks_not_array';
+    end if;
+
+    if jsonb_array_length(_next_tasks) = 0 then
+        return 0;
+    end if;
+
+    -- serialize concurrent attempts for the same parent
+    perform 1 from queues.task t where t.task_id = _parent_task_id for update;
+
+    if exists (select 1 from queues.task_chain c where c.parent_task_id = _parent_task_id) then
+        return 0;
+    end if;
+
+    select * into _parent_chain
+    from queues.task_chain c
+    where c.child_task_id = _parent_task_id;
+
+    _root_task_id := coalesce(_parent_chain.root_task_id, _parent_task_id);
+    _depth := coalesce(_parent_chain.depth, 0) + 1;
+
+    if _depth > _max_depth then
+        raise exception 'Enqueue Next Tasks Failed'
+            using detail = format('Chain depth %s exceeds maximum %s (root task %s)', _depth, _max_depth, _root_task_id),
+                  hint = 'chain_depth_exceeded';
+    end if;
+
+    for _next_task in select * from jsonb_array_elements(_next_tasks)
+    loop
+        if jsonb_typeof(_next_task -> 'payload') is distinct from 'object' then
+            raise exception 'Enqueue Next Tasks Failed'
+                using detail = 'Invalid Input',
+                      hint = 'next_task_payload_not_object';
+        end if;
+
+        insert into queues.task (task_type, payload, scheduled_at)
+        values (
+            (_next_task ->> 'task_type')::queues.task_type,
+            _next_task -> 'payload',
+            coalesce((_next_task ->> 'scheduled_at')::timestamp with time zone, now())
+        )
+        returning task_id into _child_task_id;
+
+        insert into queues.task_chain (child_task_id, parent_task_id, root_task_id, depth)
+        values (_child_task_id, _parent_task_id, _root_task_id, _depth);
+
+        _enqueued := _enqueued + 1;
+    end loop;
+
+    return _enqueued;
+end;
+$$;
+
+grant execute on function queues.enqueue_next_tasks(bigint, jsonb, integer) to worker_service_user;
@@ -0,0 +1,196 @@
+-- task replay: admin api to list failed tasks and requeue them
+--
+-- queue tasks are immutable and completion is terminal, so a replay enqueues a
+-- new task with the original task type and payload (or an edited payload) and
+-- links it to the original in queues.task_replay. a task counts as failed when it
+-- was dead-lettered, or when it was completed and its latest attempt recorded an
+-- error. everything is restricted to accounts with the 'admin' role and exposed by
+-- the gateway under /admin/tasks.
+
+-- queues.task_replay: replays of failed tasks
+create table queues.task_replay (
+    replay_task_id bigint primary key references queues.task(task_id) on delete cascade,
+    original_task_id bigint not null references queues.task(task_id) on delete cascade,
+    payload_edited boolean not null default false,
+    replayed_by bigint references accounts.account(account_id) on delete set null,
+    replayed_at timestamp with time zone not null default now()
+);
+
+create index task_replay_original_task_id_idx on queues.task_replay (original_task_id);
+
+-- whether a completed task's latest attempt recorded an error
+create or replace function queues.task_last_attempt_failed(_task_id bigint)
+returns boolean
+language sql
+stable
+security definer
+as $$
+    select exists (select 1 from queues.task_completed tc where tc.task_id = _task_id)
+    and exists (
+        select 1
+        from queues.error e
+        where e.task_id = _task_id
+        and e.created_at >= (
+            select max(l.leased_at)
+            from queues.task_lease l
+            where l.task_id = _task_id
+        )
+    );
+$$;
+
+-- failed tasks, newest first, with their latest error
+create or replace function queues.failed_tasks(
+    _dead_lettered_only boolean default false,
+    _limit integer default 100
+)
+returns table (
+    task_id bigint,
+    task_type text,
+    payload jsonb,
+    enqueued_at timestamp with time zone,
+    completed_at timestamp with time zone,
+    dead_lettered boolean,
+    error_class text,
+    last_error text,
+    error_count integer,
+    replay_count integer
+)
+language sql
+stable
+security definer
+as $$
+    select
+        t.task_id,
+        t.task_type,
+        t.payload,
+        t.enqueued_at,
+        tc.completed_at,
+        dl.task_id is not null,
+        dl.error_class,
+        last_error.error_message,
+        (select count(*)::integer from queues.error e where e.task_id = t.task_id),
+        (select count(*)::integer from queues.task_replay r where r.original_task_id = t.task_id)
+    from queues.task t
+    left join queues.task_completed tc on tc.task_id = t.task_id
+    left join queues.task_dead_letter dl on dl.task_id = t.task_id
+    left join lateral (
+        select e.error_message
+        from queues.error e
+        where e.task_id = t.task_id
+        order by e.error_id desc
+        limit 1
+    ) last_error on true
+    where dl.task_id is not null
+    or (not _dead_lettered_only and queues.task_last_attempt_failed(t.task_id))
+    order by t.task_id desc
+    limit least(greatest(coalesce(_limit, 100), 1), 1000);
+$$;
+
+-- api: list failed tasks (admin only)
+create or replace function api.list_failed_tasks(
+    dead_lettered_only boolean default false,
+    "limit" integer default 100
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'List Failed Tasks Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    return coalesce(
+        (
+            select jsonb_agg(to_jsonb(f) order by f.task_id desc)
+            from queues.failed_tasks(dead_lettered_only, "limit") f
+        ),
+        '[]'::jsonb
+    );
+end;
+$$;
+
+-- api: requeue failed tasks as new tasks (admin only). payload replaces the
+-- original payload and is only accepted when replaying a single task.
+create or replace function api.replay_tasks(
+    task_ids bigint[],
+    payload jsonb default null
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _original queues.task;
+    _replay_task_id bigint;
+    _replayed jsonb := '[]'::jsonb;
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    if coalesce(cardinality(task_ids), 0) = 0 then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'task_ids_missing';
+    end if;
+
+    if replay_tasks.payload is not null then
+        if cardinality(task_ids) > 1 then
+            raise exception 'Replay Tasks Failed'
+                using detail = 'Invalid Input',
+                      hint = 'edited_payload_requires_single_task';
+        end if;
+        if jsonb_typeof(replay_tasks.payload) is distinct from 'object' then
+            raise exception 'Replay Tasks Failed'
+                using detail = 'Invalid Input',
+                      hint = 'payload_not_object';
+        end if;
+    end if;
+
+    for _original in
+        select t.*
+        from queues.task t
+        where t.task_id = any(task_ids)
+        order by t.task_id
+    loop
+        if not exists (select 1 from queues.task_dead_letter dl where dl.task_id = _original.task_id)
+        and not queues.task_last_attempt_failed(_original.task_id) then
+            raise exception 'Replay Tasks Failed'
+                using detail = format('Task %s has not failed', _original.task_id),
+                      hint = 'task_not_failed';
+        end if;
+
+        insert into queues.task (task_type, payload)
+        values (_original.task_type, coalesce(replay_tasks.payload, _original.payload))
+        returning task_id into _replay_task_id;
+
+        insert into queues.task_replay (replay_task_id, original_task_id, payload_edited, replayed_by)
+        values (_replay_task_id, _original.task_id, replay_tasks.payload is not null, _authenticated_account_id);
+
+        _replayed := _replayed || jsonb_build_object(
+            'original_task_id', _original.task_id,
+            'replay_task_id', _replay_task_id
+        );
+    end loop;
+
+    if jsonb_array_length(_replayed) <> cardinality(task_ids) then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'task_not_found';
+    end if;
+
+    return _replayed;
+end;
+$$;
+
+grant execute on function api.list_failed_tasks(boolean, integer) to authenticated;
+grant execute on function api.replay_tasks(bigint[], jsonb) to authenticated;
@@ -0,0 +1,212 @@
+-- paused task types: let operators stop processing one task type at runtime
+--
+-- a row in queues.paused_task_type keeps tasks of that type in the queue: the
+-- dequeue functions skip them and the worker re-leases any it already claimed,
+-- so e.g. email sends can be held during a provider incident while every other
+-- type keeps flowing. resuming deletes the row and the backlog drains normally.
+-- the admin api is exposed by the gateway under /admin/tasks.
+
+-- queues.paused_task_type: task types whose processing is paused
+create table queues.paused_task_type (
+    task_type text primary key,
+    reason text,
+    paused_by bigint references accounts.account(account_id) on delete set null,
+    paused_at timestamp with time zone not null default now()
+);
+
+-- task types currently paused, for the worker's dispatch guard
+create or replace function queues.paused_task_types()
+returns setof text
+language sql
+stable
+security definer
+as $$
+    select p.task_type
+    from queues.paused_task_type p
+    order by p.task_type;
+$$;
+
+-- dequeue and claim the next available task of a type that is not paused
+create or replace function queues.dequeue_next_available_task()
+returns queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _task queues.task;
+    _lease_duration interval := interval '5 minutes';
+begin
+    -- find and lock an available task
+    select t.* into _task
+    from queues.task t
+    where not exists (
+        select 1 from queues.task_completed c
+        where c.task_id = t.task_id
+    )
+    and not exists (
+        select 1 from queues.task_lease l
+        where l.task_id = t.task_id
+        and l.expires_at > now()
+    )
+    and not exists (
+        select 1 from queues.paused_task_type p
+        where p.task_type = t.task_type
+    )
+    and t.scheduled_at <= now()
+    order by t.scheduled_at, t.task_id
+    limit 1
+    for update skip locked;
+
+    if _task.task_id is null then
+        return null;
+    end if;
+
+    -- append a lease record
+    insert into queues.task_lease (task_id, expires_at)
+    values (_task.task_id, now() + _lease_duration);
+
+    return _task;
+end;
+$$;
+
+-- dequeue and claim up to _limit available tasks of types that are not paused
+create or replace function queues.dequeue_available_tasks(_limit integer)
+returns setof queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _lease_duration interval := interval '5 minutes';
+begin
+    return query
+    with claimed as (
+        select t.*
+        from queues.task t
+        where not exists (
+            select 1
+            from queues.task_completed c
+            where c.task_id = t.task_id
+        )
+        and not exists (
+            select 1
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        )
+        and not exists (
+            select 1
+            from queues.paused_task_type p
+            where p.task_type = t.task_type
+        )
+        and t.scheduled_at <= now()
+        order by t.scheduled_at, t.task_id
+        limit greatest(coalesce(_limit, 1), 1)
+        for update skip locked
+    ),
+    leased as (
+        insert into queues.task_lease (task_id, expires_at)
+        select
+            task_id,
+            now() + _lease_duration
+        from claimed
+    )
+    select *
+    from claimed
+    order by scheduled_at, task_id;
+end;
+$$;
+
+-- api: list paused task types (admin only)
+create or replace function api.list_paused_task_types()
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'List Paused Task Types Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    return coalesce(
+        (
+            select jsonb_agg(to_jsonb(p) order by p.task_type)
+            from queues.paused_task_type p
+        ),
+        '[]'::jsonb
+    );
+end;
+$$;
+
+-- api: pause a task type (admin only). pausing an already paused type updates
+-- its reason and keeps the original pause time.
+create or replace function api.pause_task_type(
+    task_type text,
+    reason text default null
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _paused queues.paused_task_type;
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Pause Task Type Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    if nullif(btrim(pause_task_type.task_type), '') is null then
+        raise exception 'Pause Task Type Failed'
+            using detail = 'Invalid Input',
+                  hint = 'task_type_missing';
+    end if;
+
+    insert into queues.paused_task_type (task_type, reason, paused_by)
+    values (btrim(pause_task_type.task_type), pause_task_type.reason, _authenticated_account_id)
+    on conflict on constraint paused_task_type_pkey do update
+        set reason = excluded.reason,
+            paused_by = excluded.paused_by
+    returning * into _paused;
+
+    return to_jsonb(_paused);
+end;
+$$;
+
+-- api: resume a paused task type (admin only); a no-op when it is not paused
+create or replace function api.resume_task_type(task_type text)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _resumed boolean;
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Resume Task Type Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    delete from queues.paused_task_type p
+    where p.task_type = btrim(resume_task_type.task_type);
+    _resumed := found;
+
+    return jsonb_build_object(
+        'task_type', btrim(resume_task_type.task_type),
+        'resumed', _resumed
+    );
+end;
+$$;
+
+grant execute on function queues.paused_task_types() to worker_service_user;
+grant execute on function api.list_paused_task_types() to authenticated;
+grant execute on function api.pause_task_type(text, text) to authenticated;
+grant execute on function api.resume_task_type(text) to authenticated;
@@ -0,0 +1,35 @@
+-- queue depth: number of tasks ready to be dequeued right now
+--
+-- sampled by the worker's autoscaler to size its pool of processing goroutines.
+-- counts tasks with the same availability rules as the dequeue functions: not
+-- completed, no active lease, due, and not of a paused task type.
+
+-- count tasks that are available to dequeue
+create or replace function queues.queue_depth()
+returns bigint
+language sql
+stable
+security definer
+as $$
+    select count(*)
+    from queues.task t
+    where not exists (
+        select 1
+        from queues.task_completed c
+        where c.task_id = t.task_id
+    )
+    and not exists (
+        select 1
+        from queues.task_lease l
+        where l.task_id = t.task_id
+        and l.expires_at > now()
+    )
+    and not exists (
+        select 1
+        from queues.paused_task_type p
+        where p.task_type = t.task_type
+    )
+    and t.scheduled_at <= now();
+$$;
+
+grant execute on function queues.queue_depth() to worker_service_user;
@@ -0,0 +1,53 @@
+-- before handler cache: reuse a task's before_handler payload across retries
+--
+-- a before_handler often records facts as it builds the provider payload (e.g. a
+-- new attempt row). when a task is retried after a provider failure the handler
+-- would run again and record them twice. tasks that set
+-- "cache_before_handler": true in their payload have the first successful
+-- before_handler payload saved per task and handler, and every later attempt of
+-- the same task reuses it instead of calling the handler.
+
+-- queues.before_handler_result: saved before_handler payloads per task
+create table queues.before_handler_result (
+    task_id bigint not null references queues.task(task_id) on delete cascade,
+    handler_name text not null,
+    payload jsonb not null,
+    created_at timestamp with time zone not null default now(),
+    primary key (task_id, handler_name)
+);
+
+-- saved before_handler payload for a task, or null when none was saved
+create or replace function queues.get_before_handler_result(
+    _task_id bigint,
+    _handler_name text
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select r.payload
+    from queues.before_handler_result r
+    where r.task_id = _task_id
+    and r.handler_name = _handler_name;
+$$;
+
+-- save a before_handler payload for a task; the first saved payload wins
+create or replace function queues.save_before_handler_result(
+    _task_id bigint,
+    _handler_name text,
+    _payload jsonb
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.before_handler_result (task_id, handler_name, payload)
+    values (_task_id, _handler_name, _payload)
+    on conflict (task_id, handler_name) do nothing;
+end;
+$$;
+
+grant execute on function queues.get_before_handler_result(bigint, text) to worker_service_user;
+grant execute on function queues.save_before_handler_result(bigint, text, jsonb) to worker_service_user;
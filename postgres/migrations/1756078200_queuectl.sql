@@ -0,0 +1,246 @@
+-- queuectl: operator functions behind the worker/cmd/queuectl admin cli
+--
+-- list pending and failed tasks, show a task with its error and event history,
+-- requeue, cancel and purge tasks without hand-written sql. queue tasks stay
+-- immutable: a requeue enqueues a copy (linked in queues.task_replay) and
+-- cancels the original if it has not run yet, and a cancel completes a pending
+-- task without processing it, recording why in queues.task_cancellation.
+
+-- queues.task_cancellation: tasks completed by an operator without processing
+create table queues.task_cancellation (
+    task_id bigint primary key references queues.task(task_id) on delete cascade,
+    reason text,
+    cancelled_at timestamp with time zone not null default now()
+);
+
+-- tasks not completed yet, soonest first, optionally of one task type
+create or replace function queues.pending_tasks(
+    _task_type text default null,
+    _limit integer default 100
+)
+returns table (
+    task_id bigint,
+    task_type text,
+    payload jsonb,
+    enqueued_at timestamp with time zone,
+    scheduled_at timestamp with time zone,
+    leased_until timestamp with time zone,
+    error_count integer
+)
+language sql
+stable
+security definer
+as $$
+    select
+        t.task_id,
+        t.task_type,
+        t.payload,
+        t.enqueued_at,
+        t.scheduled_at,
+        (
+            select max(l.expires_at)
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        ),
+        (select count(*)::integer from queues.error e where e.task_id = t.task_id)
+    from queues.task t
+    where not exists (
+        select 1
+        from queues.task_completed c
+        where c.task_id = t.task_id
+    )
+    and (_task_type is null or t.task_type = _task_type)
+    order by t.scheduled_at, t.task_id
+    limit least(greatest(coalesce(_limit, 100), 1), 1000);
+$$;
+
+-- one task with its queue state, or no row when it does not exist
+create or replace function queues.task_status(_task_id bigint)
+returns table (
+    task_id bigint,
+    task_type text,
+    payload jsonb,
+    enqueued_at timestamp with time zone,
+    scheduled_at timestamp with time zone,
+    completed_at timestamp with time zone,
+    leased_until timestamp with time zone,
+    dead_lettered boolean,
+    cancelled boolean
+)
+language sql
+stable
+security definer
+as $$
+    select
+        t.task_id,
+        t.task_type,
+        t.payload,
+        t.enqueued_at,
+        t.scheduled_at,
+        tc.completed_at,
+        (
+            select max(l.expires_at)
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        ),
+        exists (select 1 from queues.task_dead_letter dl where dl.task_id = t.task_id),
+        exists (select 1 from queues.task_cancellation x where x.task_id = t.task_id)
+    from queues.task t
+    left join queues.task_completed tc on tc.task_id = t.task_id
+    where t.task_id = _task_id;
+$$;
+
+-- a task's recorded errors, oldest first
+create or replace function queues.task_errors(_task_id bigint)
+returns table (
+    error_id bigint,
+    error_message text,
+    created_at timestamp with time zone
+)
+language sql
+stable
+security definer
+as $$
+    select e.error_id, e.error_message, e.created_at
+    from queues.error e
+    where e.task_id = _task_id
+    order by e.error_id;
+$$;
+
+-- a task's lifecycle events, oldest first
+create or replace function queues.task_events(_task_id bigint)
+returns table (
+    task_event_id bigint,
+    event_type text,
+    details jsonb,
+    created_at timestamp with time zone
+)
+language sql
+stable
+security definer
+as $$
+    select e.task_event_id, e.event_type, e.details, e.created_at
+    from queues.task_event e
+    where e.task_id = _task_id
+    order by e.task_event_id;
+$$;
+
+-- complete a pending task without processing it; returns false when the task
+-- was already completed. a worker already processing it still finishes.
+create or replace function queues.cancel_task(
+    _task_id bigint,
+    _reason text default null
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _cancelled boolean;
+begin
+    if not exists (select 1 from queues.task t where t.task_id = _task_id) then
+        raise exception 'Cancel Task Failed'
+            using detail = format('Task %s does not exist', _task_id),
+                  hint = 'task_not_found';
+    end if;
+
+    insert into queues.task_completed (task_id)
+    values (_task_id)
+    on conflict (task_id) do nothing
+    returning true into _cancelled;
+
+    if not coalesce(_cancelled, false) then
+        return false;
+    end if;
+
+    insert into queues.task_cancellation (task_id, reason)
+    values (_task_id, _reason);
+
+    update queues.task_lease
+    set expires_at = now()
+    where task_id = _task_id
+    and expires_at > now();
+
+    return true;
+end;
+$$;
+
+-- enqueue a copy of a task to run now and link it to the original; a pending
+-- original is cancelled so it does not run twice. returns the new task id.
+create or replace function queues.requeue_task(_task_id bigint)
+returns bigint
+language plpgsql
+security definer
+as $$
+declare
+    _original queues.task;
+    _requeued_task_id bigint;
+begin
+    select t.* into _original
+    from queues.task t
+    where t.task_id = _task_id;
+
+    if _original.task_id is null then
+        raise exception 'Requeue Task Failed'
+            using detail = format('Task %s does not exist', _task_id),
+                  hint = 'task_not_found';
+    end if;
+
+    perform queues.cancel_task(_task_id, 'requeued');
+
+    insert into queues.task (task_type, payload)
+    values (_original.task_type, _original.payload)
+    returning task_id into _requeued_task_id;
+
+    insert into queues.task_replay (replay_task_id, original_task_id)
+    values (_requeued_task_id, _task_id);
+
+    return _requeued_task_id;
+end;
+$$;
+
+-- delete tasks completed before _completed_before, with their errors and
+-- history; returns how many tasks were deleted
+create or replace function queues.purge_tasks(_completed_before timestamp with time zone)
+returns bigint
+language plpgsql
+security definer
+as $$
+declare
+    _purged bigint;
+begin
+    if _completed_before is null or _completed_before > now() then
+        raise exception 'Purge Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'completed_before_must_be_in_the_past';
+    end if;
+
+    delete from queues.error e
+    using queues.task_completed c
+    where c.task_id = e.task_id
+    and c.completed_at < _completed_before;
+
+    with purged as (
+        delete from queues.task t
+        using queues.task_completed c
+        where c.task_id = t.task_id
+        and c.completed_at < _completed_before
+        returning t.task_id
+    )
+    select count(*) into _purged
+    from purged;
+
+    return _purged;
+end;
+$$;
+
+grant execute on function queues.pending_tasks(text, integer) to worker_service_user;
+grant execute on function queues.task_status(bigint) to worker_service_user;
+grant execute on function queues.task_errors(bigint) to worker_service_user;
+grant execute on function queues.task_events(bigint) to worker_service_user;
+grant execute on function queues.cancel_task(bigint, text) to worker_service_user;
+grant execute on function queues.requeue_task(bigint) to worker_service_user;
+grant execute on function queues.purge_tasks(timestamp with time zone) to worker_service_user;
+grant execute on function queues.failed_tasks(boolean, integer) to worker_service_user;
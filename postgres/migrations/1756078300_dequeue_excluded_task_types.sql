@@ -0,0 +1,60 @@
+-- dequeue with excluded task types: let a worker instance skip processors it
+-- has disabled at runtime
+--
+-- unlike queues.paused_task_type, which pauses a task type for every worker, a
+-- worker can disable one of its own processors (admin api on its health port).
+-- it passes those types here so it does not claim tasks it would only put back;
+-- other instances keep processing them.
+
+-- dequeue and claim up to _limit available tasks, skipping _excluded_task_types
+create or replace function queues.dequeue_available_tasks(
+    _limit integer,
+    _excluded_task_types text[]
+)
+returns setof queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _lease_duration interval := interval '5 minutes';
+begin
+    return query
+    with claimed as (
+        select t.*
+        from queues.task t
+        where not exists (
+            select 1
+            from queues.task_completed c
+            where c.task_id = t.task_id
+        )
+        and not exists (
+            select 1
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        )
+        and not exists (
+            select 1
+            from queues.paused_task_type p
+            where p.task_type = t.task_type
+        )
+        and t.task_type::text <> all(coalesce(_excluded_task_types, '{}'::text[]))
+        and t.scheduled_at <= now()
+        order by t.scheduled_at, t.task_id
+        limit greatest(coalesce(_limit, 1), 1)
+        for update skip locked
+    ),
+    leased as (
+        insert into queues.task_lease (task_id, expires_at)
+        select
+            task_id,
+            now() + _lease_duration
+        from claimed
+    )
+    select *
+    from claimed
+    order by scheduled_at, task_id;
+end;
+$$;
+
+grant execute on function queues.dequeue_available_tasks(integer, text[]) to worker_service_user;
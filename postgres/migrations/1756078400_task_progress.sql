@@ -0,0 +1,58 @@
+-- task progress: live percentage/stage updates from long-running processors
+--
+-- a processor (transcoding, export, ...) reports how far its task has got
+-- through queues.task_progress; only the latest report per task is kept.
+-- applications read it through queues.get_task_progress, typically wrapped in a
+-- domain api function that maps their own resource to the task.
+
+-- queues.task_progress_state: latest progress report per task
+create table queues.task_progress_state (
+    task_id bigint primary key references queues.task(task_id) on delete cascade,
+    percent integer not null check (percent between 0 and 100),
+    stage text,
+    details jsonb not null default '{}'::jsonb,
+    updated_at timestamp with time zone not null default now()
+);
+
+-- record a task's progress, replacing its previous report
+create or replace function queues.task_progress(
+    _task_id bigint,
+    _percent integer,
+    _stage text default null,
+    _details jsonb default '{}'::jsonb
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.task_progress_state (task_id, percent, stage, details)
+    values (_task_id, least(greatest(coalesce(_percent, 0), 0), 100), _stage, coalesce(_details, '{}'::jsonb))
+    on conflict (task_id) do update
+        set percent = excluded.percent,
+            stage = excluded.stage,
+            details = excluded.details,
+            updated_at = now();
+end;
+$$;
+
+-- a task's latest progress report, or null when it has not reported any
+create or replace function queues.get_task_progress(_task_id bigint)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select jsonb_build_object(
+        'task_id', p.task_id,
+        'percent', p.percent,
+        'stage', p.stage,
+        'details', p.details,
+        'updated_at', p.updated_at,
+        'completed', exists (select 1 from queues.task_completed c where c.task_id = p.task_id)
+    )
+    from queues.task_progress_state p
+    where p.task_id = _task_id;
+$$;
+
+grant execute on function queues.task_progress(bigint, integer, text, jsonb) to worker_service_user;
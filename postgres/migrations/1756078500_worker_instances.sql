@@ -0,0 +1,123 @@
+-- worker instance registration and heartbeat
+--
+-- every worker process registers itself on startup and heartbeats while it
+-- runs, so operators can see which workers are alive. the worker also names its
+-- instance in each 'dequeued' task event, which lets stale-lease recovery find
+-- the tasks a dead worker was holding.
+
+-- queues.worker_instance: one row per worker process (<hostname>:<pid>)
+create table queues.worker_instance (
+    worker_instance_id text primary key,
+    hostname text not null,
+    version text not null,
+    concurrency integer not null,
+    started_at timestamp with time zone not null default now(),
+    last_heartbeat_at timestamp with time zone not null default now(),
+    stopped_at timestamp with time zone
+);
+
+-- register (or re-register) a worker instance on startup
+create or replace function queues.register_worker_instance(
+    _worker_instance_id text,
+    _hostname text,
+    _version text,
+    _concurrency integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.worker_instance (worker_instance_id, hostname, version, concurrency)
+    values (_worker_instance_id, _hostname, _version, _concurrency)
+    on conflict (worker_instance_id) do update
+        set hostname = excluded.hostname,
+            version = excluded.version,
+            concurrency = excluded.concurrency,
+            started_at = now(),
+            last_heartbeat_at = now(),
+            stopped_at = null;
+end;
+$$;
+
+-- record that a worker instance is still alive
+create or replace function queues.heartbeat_worker_instance(
+    _worker_instance_id text,
+    _concurrency integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    update queues.worker_instance
+    set concurrency = _concurrency,
+        last_heartbeat_at = now()
+    where worker_instance_id = _worker_instance_id;
+end;
+$$;
+
+-- mark a worker instance as cleanly stopped
+create or replace function queues.stop_worker_instance(_worker_instance_id text)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    update queues.worker_instance
+    set stopped_at = now()
+    where worker_instance_id = _worker_instance_id
+      and stopped_at is null;
+end;
+$$;
+
+-- worker instances that stopped heartbeating without a clean stop
+create or replace function queues.dead_worker_instances(_stale_after interval default interval '2 minutes')
+returns setof queues.worker_instance
+language sql
+stable
+security definer
+as $$
+    select wi.*
+    from queues.worker_instance wi
+    where wi.stopped_at is null
+      and wi.last_heartbeat_at < now() - _stale_after
+    order by wi.last_heartbeat_at;
+$$;
+
+-- incomplete tasks whose latest claim was made by a dead worker instance; their
+-- leases will lapse and the tasks be re-dequeued, or an operator can requeue them
+create or replace function queues.dead_worker_tasks(_stale_after interval default interval '2 minutes')
+returns table (
+    task_id bigint,
+    task_type text,
+    worker_instance_id text,
+    dequeued_at timestamp with time zone
+)
+language sql
+stable
+security definer
+as $$
+    select t.task_id, t.task_type::text, d.worker_instance_id, d.created_at
+    from queues.task t
+    cross join lateral (
+        select e.details->>'worker_instance_id' as worker_instance_id, e.created_at
+        from queues.task_event e
+        where e.task_id = t.task_id
+          and e.event_type in ('dequeued', 'retried')
+        order by e.task_event_id desc
+        limit 1
+    ) d
+    join queues.dead_worker_instances(_stale_after) wi
+        on wi.worker_instance_id = d.worker_instance_id
+    where not exists (
+        select 1 from queues.task_completed c where c.task_id = t.task_id
+    )
+    order by t.task_id;
+$$;
+
+grant execute on function queues.register_worker_instance(text, text, text, integer) to worker_service_user;
+grant execute on function queues.heartbeat_worker_instance(text, integer) to worker_service_user;
+grant execute on function queues.stop_worker_instance(text) to worker_service_user;
+grant execute on function queues.dead_worker_instances(interval) to worker_service_user;
+grant execute on function queues.dead_worker_tasks(interval) to worker_service_user;
@@ -0,0 +1,59 @@
+-- dequeue restricted to given task types: per-type poll intervals and weighted
+-- shares of each dequeue cycle
+--
+-- a worker can poll latency-sensitive types (e.g. otp email) on a faster
+-- interval, or split each dequeue cycle between types by weight, by claiming
+-- only the task types it asks for here. paused types are still skipped.
+
+-- dequeue and claim up to _limit available tasks of _task_types
+create or replace function queues.dequeue_task_types(
+    _limit integer,
+    _task_types text[]
+)
+returns setof queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _lease_duration interval := interval '5 minutes';
+begin
+    return query
+    with claimed as (
+        select t.*
+        from queues.task t
+        where t.task_type::text = any(coalesce(_task_types, '{}'::text[]))
+        and not exists (
+            select 1
+            from queues.task_completed c
+            where c.task_id = t.task_id
+        )
+        and not exists (
+            select 1
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        )
+        and not exists (
+            select 1
+            from queues.paused_task_type p
+            where p.task_type = t.task_type
+        )
+        and t.scheduled_at <= now()
+        order by t.scheduled_at, t.task_id
+        limit greatest(coalesce(_limit, 1), 1)
+        for update skip locked
+    ),
+    leased as (
+        insert into queues.task_lease (task_id, expires_at)
+        select
+            task_id,
+            now() + _lease_duration
+        from claimed
+    )
+    select *
+    from claimed
+    order by scheduled_at, task_id;
+end;
+$$;
+
+grant execute on function queues.dequeue_task_types(integer, text[]) to worker_service_user;
@@ -0,0 +1,18 @@
+-- selftest: no-op function run by the worker and files service --selftest
+--
+-- a deploy gate runs each binary with --selftest; calling this proves the
+-- service can connect with its own role and execute functions.
+
+-- no-op function in the standard json envelope
+create or replace function internal.selftest(payload jsonb default '{}'::jsonb)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select jsonb_build_object('status', 'succeeded');
+$$;
+
+grant execute on function internal.selftest(jsonb) to worker_service_user;
+grant usage on schema internal to file_service_user;
+grant execute on function internal.selftest(jsonb) to file_service_user;
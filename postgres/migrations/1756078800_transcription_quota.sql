@@ -0,0 +1,205 @@
+-- transcription cost guardrails: per-account quota checked before kickoff
+--
+-- the kickoff before_handler now reports the recording's duration (file
+-- metadata key 'duration', in seconds), and kickoff tasks carry a
+-- quota_handler. the worker compares the duration against the limits that
+-- handler returns and fails the task with a validation outcome when the
+-- recording is over quota, before any elevenlabs call is made.
+
+-- per-account quota overrides; accounts without a row get the defaults below.
+-- a null limit means unlimited.
+create table elevenlabs.transcription_quota (
+    account_id bigint primary key references accounts.account(account_id) on delete cascade,
+    max_recording_seconds numeric check (max_recording_seconds > 0),
+    daily_seconds numeric check (daily_seconds > 0),
+    updated_at timestamp with time zone not null default now()
+);
+
+-- facts: default quota for accounts without an override
+create or replace function elevenlabs.default_transcription_quota(
+    out max_recording_seconds numeric,
+    out daily_seconds numeric
+)
+language sql
+immutable
+as $$
+    select 600::numeric, 3600::numeric;
+$$;
+
+-- facts: a file's duration in seconds from its metadata, or null when unknown
+create or replace function files.file_duration_seconds(_file_id bigint)
+returns numeric
+language sql
+stable
+as $$
+    select case jsonb_typeof(m.value)
+        when 'number' then m.value::numeric
+        when 'string' then nullif(regexp_replace(m.value #>> '{}', '[^0-9.]', '', 'g'), '')::numeric
+    end
+    from files.file_metadata m
+    where m.file_id = _file_id
+      and m.key = 'duration';
+$$;
+
+-- facts: account owning the recording behind a transcription attempt
+create or replace function elevenlabs.recording_transcription_attempt_account_id(
+    _recording_transcription_attempt_id bigint
+)
+returns bigint
+language sql
+stable
+as $$
+    select p.account_id
+    from elevenlabs.recording_transcription_attempt a
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    join learning.profile_cue_recording r
+        on r.profile_cue_recording_id = t.profile_cue_recording_id
+    join learning.profile p
+        on p.profile_id = r.profile_id
+    where a.recording_transcription_attempt_id = _recording_transcription_attempt_id;
+$$;
+
+-- facts: seconds of audio sent to elevenlabs for an account in the last day
+create or replace function elevenlabs.account_transcribed_seconds_last_day(_account_id bigint)
+returns numeric
+language sql
+stable
+as $$
+    select coalesce(sum(files.file_duration_seconds(r.file_id)), 0)
+    from elevenlabs.recording_transcription_request req
+    join elevenlabs.recording_transcription_attempt a
+        on a.recording_transcription_attempt_id = req.recording_transcription_attempt_id
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    join learning.profile_cue_recording r
+        on r.profile_cue_recording_id = t.profile_cue_recording_id
+    join learning.profile p
+        on p.profile_id = r.profile_id
+    where p.account_id = _account_id
+      and req.created_at > now() - interval '1 day';
+$$;
+
+-- before handler: build provider payload from recording_transcription_attempt_id in payload
+create or replace function elevenlabs.get_recording_transcription_kickoff_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->>'recording_transcription_attempt_id')::bigint;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    -- 2. FACTS
+    _facts := elevenlabs.get_recording_transcription_kickoff_payload_facts(_recording_transcription_attempt_id);
+
+    -- 3. LOGIC
+    if _facts.file_id is null then
+        return jsonb_build_object('status', 'recording_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'file_id', _facts.file_id,
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'duration_seconds', files.file_duration_seconds(_facts.file_id)
+        )
+    );
+end;
+$$;
+
+-- quota handler: transcription limits for the account behind the attempt
+-- returns: { max_recording_seconds, daily_seconds, used_seconds } (null limit = unlimited)
+create or replace function elevenlabs.get_recording_transcription_quota(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->>'recording_transcription_attempt_id')::bigint;
+    _account_id bigint;
+    _quota record;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    -- 2. FACTS
+    _account_id := elevenlabs.recording_transcription_attempt_account_id(_recording_transcription_attempt_id);
+    if _account_id is null then
+        return jsonb_build_object('status', 'recording_not_found');
+    end if;
+
+    select q.max_recording_seconds, q.daily_seconds
+    into _quota
+    from elevenlabs.transcription_quota q
+    where q.account_id = _account_id;
+
+    -- 3. LOGIC
+    if not found then
+        select d.max_recording_seconds, d.daily_seconds
+        into _quota
+        from elevenlabs.default_transcription_quota() d;
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'account_id', _account_id,
+            'max_recording_seconds', _quota.max_recording_seconds,
+            'daily_seconds', _quota.daily_seconds,
+            'used_seconds', elevenlabs.account_transcribed_seconds_last_day(_account_id)
+        )
+    );
+end;
+$$;
+
+-- effect: schedule a transcription kickoff attempt (returns attempt_id)
+create or replace function elevenlabs.schedule_recording_transcription_kickoff(
+    _recording_transcription_task_id bigint
+)
+returns bigint
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint;
+begin
+    insert into elevenlabs.recording_transcription_attempt (recording_transcription_task_id)
+    values (_recording_transcription_task_id)
+    returning recording_transcription_attempt_id into _recording_transcription_attempt_id;
+
+    perform queues.enqueue(
+        'transcription_kickoff',
+        jsonb_build_object(
+            'task_type', 'transcription_kickoff',
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'before_handler', 'elevenlabs.get_recording_transcription_kickoff_payload',
+            'quota_handler', 'elevenlabs.get_recording_transcription_quota',
+            'success_handler', 'elevenlabs.record_recording_transcription_request_success',
+            'error_handler', 'elevenlabs.record_recording_transcription_request_failure'
+        ),
+        now()
+    );
+
+    return _recording_transcription_attempt_id;
+end;
+$$;
+
+-- worker service user grants
+grant execute on function elevenlabs.get_recording_transcription_quota(jsonb) to worker_service_user;
@@ -0,0 +1,23 @@
+-- release idempotency keys for side effects that never went out
+--
+-- when a provider's circuit breaker is open the worker refuses the call after
+-- the task already claimed its idempotency key, and reschedules the task
+-- without recording a failure. the rescheduled attempt derives the same key,
+-- so the worker releases it first; otherwise the task would be skipped as a
+-- duplicate without the provider ever being called.
+
+-- release an idempotency key claimed by the task; no-op when not claimed
+create or replace function queues.release_idempotency_key(
+    _task_id bigint,
+    _idempotency_key text
+)
+returns void
+language sql
+security definer
+as $$
+    delete from queues.idempotency_key
+    where idempotency_key = _idempotency_key
+      and task_id = _task_id;
+$$;
+
+grant execute on function queues.release_idempotency_key(bigint, text) to worker_service_user;
@@ -0,0 +1,87 @@
+-- worker fleet visibility: in-flight counts and last poll time per instance
+--
+-- heartbeats now also carry how many tasks the instance is processing (per
+-- task type) and when it last polled the queue. queues.worker_fleet() reads
+-- the table back with a derived status, for the worker's fleet command and
+-- admin endpoint.
+
+alter table queues.worker_instance
+    add column in_flight jsonb not null default '{}'::jsonb,
+    add column last_poll_at timestamp with time zone;
+
+-- the heartbeat signature changes; replace it rather than overload it
+drop function queues.heartbeat_worker_instance(text, integer);
+
+-- record that a worker instance is still alive, with what it is doing
+create or replace function queues.heartbeat_worker_instance(
+    _worker_instance_id text,
+    _concurrency integer,
+    _in_flight jsonb default '{}'::jsonb,
+    _last_poll_at timestamp with time zone default null
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    update queues.worker_instance
+    set concurrency = _concurrency,
+        in_flight = coalesce(_in_flight, '{}'::jsonb),
+        last_poll_at = coalesce(_last_poll_at, last_poll_at),
+        last_heartbeat_at = now()
+    where worker_instance_id = _worker_instance_id;
+end;
+$$;
+
+-- a stopped instance is processing nothing
+create or replace function queues.stop_worker_instance(_worker_instance_id text)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    update queues.worker_instance
+    set stopped_at = now(),
+        in_flight = '{}'::jsonb
+    where worker_instance_id = _worker_instance_id
+      and stopped_at is null;
+end;
+$$;
+
+-- worker instances with status 'alive', 'stale' (no heartbeat within
+-- _stale_after) or 'stopped'; stopped instances only when _include_stopped
+create or replace function queues.worker_fleet(
+    _stale_after interval default interval '2 minutes',
+    _include_stopped boolean default false
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select coalesce(jsonb_agg(
+        jsonb_build_object(
+            'worker_instance_id', wi.worker_instance_id,
+            'hostname', wi.hostname,
+            'version', wi.version,
+            'concurrency', wi.concurrency,
+            'in_flight', wi.in_flight,
+            'started_at', wi.started_at,
+            'last_heartbeat_at', wi.last_heartbeat_at,
+            'last_poll_at', wi.last_poll_at,
+            'stopped_at', wi.stopped_at,
+            'status', case
+                when wi.stopped_at is not null then 'stopped'
+                when wi.last_heartbeat_at < now() - _stale_after then 'stale'
+                else 'alive'
+            end
+        )
+        order by wi.stopped_at nulls first, wi.started_at desc
+    ), '[]'::jsonb)
+    from queues.worker_instance wi
+    where _include_stopped
+       or wi.stopped_at is null;
+$$;
+
+grant execute on function queues.heartbeat_worker_instance(text, integer, jsonb, timestamp with time zone) to worker_service_user;
+grant execute on function queues.worker_fleet(interval, boolean) to worker_service_user;
@@ -0,0 +1,62 @@
+-- task reschedule: run a task again at a provider-requested time
+--
+-- when resend or elevenlabs answer 429 with retry-after, the processor returns
+-- a reschedule outcome instead of a failure. the worker re-leases the task
+-- until that time without recording a queues.error row, so the retry budget is
+-- not spent on the provider's own back-pressure. reschedules are recorded here
+-- and capped per task; once the cap is reached the worker handles the 429 as a
+-- regular rate-limited failure.
+
+-- queues.task_reschedule: one row per provider-requested reschedule
+create table queues.task_reschedule (
+    task_reschedule_id bigserial primary key,
+    task_id bigint not null references queues.task(task_id) on delete cascade,
+    reason text not null,
+    rescheduled_until timestamp with time zone not null,
+    created_at timestamp with time zone not null default now()
+);
+
+create index task_reschedule_task_id_idx on queues.task_reschedule (task_id);
+
+-- reschedule a task until _until; returns false (and leaves the task alone)
+-- when it was already rescheduled _max_reschedules times
+create or replace function queues.reschedule_task(
+    _task_id bigint,
+    _until timestamp with time zone,
+    _reason text,
+    _max_reschedules integer default null
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _reschedules integer;
+begin
+    -- 1. VALIDATION
+    if _until is null then
+        raise exception 'reschedule_task: _until is required';
+    end if;
+
+    -- 2. FACTS
+    select count(*)::integer
+    into _reschedules
+    from queues.task_reschedule r
+    where r.task_id = _task_id;
+
+    -- 3. LOGIC
+    if _max_reschedules is not null and _reschedules >= _max_reschedules then
+        return false;
+    end if;
+
+    insert into queues.task_reschedule (task_id, reason, rescheduled_until)
+    values (_task_id, coalesce(_reason, ''), _until);
+
+    perform queues.defer_task(_task_id, _until);
+
+    -- 4. OUTPUT
+    return true;
+end;
+$$;
+
+grant execute on function queues.reschedule_task(bigint, timestamp with time zone, text, integer) to worker_service_user;
@@ -0,0 +1,244 @@
+-- webhook replay protection: timestamp skew limits and delivery deduplication
+--
+-- providers retry webhook deliveries, and a captured delivery can be replayed.
+-- signatures are only verified later by the supervisors, so the endpoints now
+-- reject, at receipt time, deliveries whose signed timestamp is outside an
+-- allowed skew from now (in either direction), and remember each accepted
+-- delivery's provider event id so a repeat within the dedup window is
+-- acknowledged without being stored again. rejected deliveries still get a
+-- 'received' response (with a warning) so providers stop retrying them.
+--
+-- event ids: openai sends a webhook-id header per event; elevenlabs has no
+-- delivery id, and each transcription request gets exactly one result, so its
+-- request_id is used.
+
+-- internal.webhook_delivery: accepted deliveries per provider event id
+create table internal.webhook_delivery (
+    provider text not null,
+    event_id text not null,
+    received_at timestamp with time zone not null default now(),
+    primary key (provider, event_id)
+);
+
+create index webhook_delivery_received_at_idx on internal.webhook_delivery (received_at);
+
+-- whether a signed webhook timestamp (unix seconds) is within _max_skew_seconds
+-- of now, in either direction
+create or replace function internal.webhook_timestamp_is_fresh(
+    _timestamp_epoch bigint,
+    _max_skew_seconds integer default 300
+)
+returns boolean
+language sql
+stable
+as $$
+    select _timestamp_epoch is not null
+        and abs(extract(epoch from now())::bigint - _timestamp_epoch) <= _max_skew_seconds;
+$$;
+
+-- claim a provider event id; returns false when the same event was already
+-- accepted within _dedup_window (a retried or replayed delivery)
+create or replace function internal.claim_webhook_delivery(
+    _provider text,
+    _event_id text,
+    _dedup_window interval default interval '24 hours'
+)
+returns boolean
+language plpgsql
+security definer
+as $$
+declare
+    _claimed boolean;
+begin
+    insert into internal.webhook_delivery (provider, event_id)
+    values (_provider, _event_id)
+    on conflict (provider, event_id) do update
+        set received_at = now()
+        where internal.webhook_delivery.received_at < now() - _dedup_window
+    returning true into _claimed;
+
+    return coalesce(_claimed, false);
+end;
+$$;
+
+-- db_function: forget deliveries older than the dedup window; run daily by the
+-- recurring task below
+create or replace function internal.prune_webhook_deliveries(payload jsonb default '{}'::jsonb)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _older_than interval := coalesce((payload->>'older_than')::interval, interval '7 days');
+    _deleted integer;
+begin
+    delete from internal.webhook_delivery
+    where received_at < now() - _older_than;
+    get diagnostics _deleted = row_count;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object('deleted', _deleted)
+    );
+end;
+$$;
+
+grant execute on function internal.prune_webhook_deliveries(jsonb) to worker_service_user;
+
+insert into queues.recurring_task (name, cron_expression, task_type, payload)
+values (
+    'prune_webhook_deliveries',
+    '15 4 * * *',
+    'db_function',
+    '{"task_type": "db_function", "db_function": "internal.prune_webhook_deliveries"}'::jsonb
+)
+on conflict (name) do nothing;
+
+-- =============================================================================
+-- elevenlabs: transcription webhook
+-- =============================================================================
+
+-- extract the signed timestamp from "t=<timestamp>,v0=<hash>"; null when malformed
+create or replace function elevenlabs.transcription_webhook_signature_timestamp(
+    _elevenlabs_signature_header text
+)
+returns bigint
+language plpgsql
+immutable
+as $$
+begin
+    return substring(split_part(_elevenlabs_signature_header, ',', 1) from '^t=(\d+)$')::bigint;
+exception when others then
+    return null;
+end;
+$$;
+
+-- api: webhook endpoint, now with skew and replay checks before storing
+create or replace function api.eleven_labs_transcription_webhook(
+    json
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _webhook_body json := $1;
+    _facts record;
+begin
+    -- 1. FACTS
+    _facts := elevenlabs.transcription_webhook_facts(_webhook_body);
+
+    -- 2. LOGIC
+    if _facts.elevenlabs_request_id is null then
+        raise warning 'api.eleven_labs_transcription_webhook.invalid.missing_request_id';
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'missing_request_id'
+        );
+    end if;
+
+    -- matches the tolerance used when the signature is verified
+    if not internal.webhook_timestamp_is_fresh(
+        elevenlabs.transcription_webhook_signature_timestamp(_facts.signature_header),
+        1800
+    ) then
+        raise warning 'api.eleven_labs_transcription_webhook.invalid.timestamp_out_of_range: %', _facts.elevenlabs_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'timestamp_out_of_range'
+        );
+    end if;
+
+    if _facts.recording_transcription_request_id is null then
+        raise warning 'api.eleven_labs_transcription_webhook.invalid.request_not_found: %', _facts.elevenlabs_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'request_not_found'
+        );
+    end if;
+
+    if _facts.response_already_exists then
+        raise warning 'api.eleven_labs_transcription_webhook.invalid.response_already_exists: %', _facts.elevenlabs_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'response_already_exists'
+        );
+    end if;
+
+    if not internal.claim_webhook_delivery('elevenlabs', _facts.elevenlabs_request_id) then
+        raise warning 'api.eleven_labs_transcription_webhook.invalid.duplicate_delivery: %', _facts.elevenlabs_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'duplicate_delivery'
+        );
+    end if;
+
+    -- 3. EFFECT
+    perform elevenlabs.record_transcription_webhook_response(
+        _facts.recording_transcription_request_id,
+        _webhook_body,
+        _facts.signature_header
+    );
+
+    return jsonb_build_object('status', 'received');
+end;
+$$;
+
+-- =============================================================================
+-- openai: responses webhook
+-- =============================================================================
+
+-- api: webhook endpoint, now with skew and replay checks before storing
+create or replace function api.openai_webhook(
+    json
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _webhook_body json := $1;
+    _facts record;
+    _timestamp_epoch bigint;
+begin
+    -- 1. FACTS
+    _facts := openai.openai_response_webhook_facts(_webhook_body);
+
+    begin
+        _timestamp_epoch := _facts.webhook_timestamp::bigint;
+    exception when others then
+        _timestamp_epoch := null;
+    end;
+
+    -- 2. LOGIC
+    -- matches the tolerance used when the signature is verified
+    if not internal.webhook_timestamp_is_fresh(_timestamp_epoch, 300) then
+        raise warning 'api.openai_webhook.invalid.timestamp_out_of_range: %', _facts.webhook_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'timestamp_out_of_range'
+        );
+    end if;
+
+    if _facts.webhook_event_already_exists
+        or (_facts.webhook_id is not null and not internal.claim_webhook_delivery('openai', _facts.webhook_id))
+    then
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'webhook_event_already_exists'
+        );
+    end if;
+
+    -- 3. EFFECT
+    perform openai.record_openai_response_webhook_event(
+        _facts.webhook_id,
+        _facts.openai_response_id,
+        _facts.event_type,
+        _webhook_body,
+        _facts.webhook_timestamp,
+        _facts.webhook_signature
+    );
+
+    return jsonb_build_object('status', 'received');
+end;
+$$;
@@ -0,0 +1,50 @@
+-- task request correlation: stamp the originating request_id into task payloads
+--
+-- a task enqueued while serving an http request carries that request's id
+-- (x-request-id, set by caddy and forwarded by the gateway to postgrest) as
+-- payload.request_id. the worker logs all processing of the task under it and
+-- forwards it to the files service, so a failure can be traced from the http
+-- request through the queue to the provider call.
+--
+-- tasks enqueued by the worker itself (supervisors, handlers, next_tasks)
+-- inherit the id of the task being processed: the worker sets
+-- chatterbox.request_id for the transaction that runs the function. a payload
+-- that already has a request_id keeps it.
+
+-- current request id: postgrest request header, else the worker's setting
+create or replace function queues.current_request_id()
+returns text
+language sql
+stable
+as $$
+    select coalesce(
+        nullif(current_setting('request.headers', true), '')::json->>'x-request-id',
+        nullif(current_setting('chatterbox.request_id', true), '')
+    );
+$$;
+
+-- Trigger to stamp request_id into a new task's payload
+create or replace function queues.stamp_task_request_id()
+returns trigger
+language plpgsql
+as $$
+declare
+    _request_id text;
+begin
+    if jsonb_typeof(new.payload) <> 'object' or new.payload ? 'request_id' then
+        return new;
+    end if;
+
+    _request_id := queues.current_request_id();
+    if _request_id is not null then
+        new.payload := new.payload || jsonb_build_object('request_id', _request_id);
+    end if;
+
+    return new;
+end;
+$$;
+
+create trigger task_stamp_request_id
+before insert on queues.task
+for each row
+execute function queues.stamp_task_request_id();
@@ -0,0 +1,34 @@
+-- accessible files: authorization check for the gateway /files/refresh_urls endpoint
+--
+-- the gateway calls this with the caller's jwt before asking the files service for
+-- fresh signed download urls, so only files owned by the caller's account (and not
+-- deleted) are re-signed. ids the caller cannot access are left out of the result.
+
+-- api: filter file ids down to those the authenticated account may read
+create or replace function api.accessible_files(
+    file_ids bigint[]
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _accessible_file_ids bigint[];
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Get Accessible Files Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_get_accessible_files';
+    end if;
+
+    select coalesce(array_agg(distinct f.file_id order by f.file_id), '{}')
+    into _accessible_file_ids
+    from files.account_files(_authenticated_account_id) f
+    where f.file_id = any(accessible_files.file_ids);
+
+    return jsonb_build_object('file_ids', to_jsonb(_accessible_file_ids));
+end;
+$$;
+
+grant execute on function api.accessible_files(bigint[]) to authenticated;
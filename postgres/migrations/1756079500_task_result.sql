@@ -0,0 +1,49 @@
+-- task results: the worker payload of every succeeded task
+--
+-- a processor's result (provider response, db_function payload) used to reach
+-- only the success handler, so it was lost for task types without one. the
+-- worker now records it for every succeeded task, making outcomes queryable for
+-- audit and debugging (queuectl show). failures stay in queues.error.
+--
+-- a task re-run after a crash overwrites its result; rows go with their task
+-- when it is purged.
+
+-- queues.task_result: result payload per succeeded task
+create table queues.task_result (
+    task_id bigint primary key references queues.task(task_id) on delete cascade,
+    payload jsonb not null,
+    recorded_at timestamp with time zone not null default now()
+);
+
+-- record (or replace) a task's result payload
+create or replace function queues.record_result(
+    _task_id bigint,
+    _payload jsonb
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into queues.task_result (task_id, payload)
+    values (_task_id, coalesce(_payload, 'null'::jsonb))
+    on conflict (task_id) do update
+        set payload = excluded.payload,
+            recorded_at = now();
+end;
+$$;
+
+-- a task's recorded result payload, or null
+create or replace function queues.get_task_result(_task_id bigint)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select r.payload
+    from queues.task_result r
+    where r.task_id = _task_id;
+$$;
+
+grant execute on function queues.record_result(bigint, jsonb) to worker_service_user;
+grant execute on function queues.get_task_result(bigint) to worker_service_user;
@@ -0,0 +1,68 @@
+-- priority lane: claim tasks carrying a payload priority hint
+--
+-- producers mark latency-sensitive work (e.g. live-classroom transcriptions)
+-- with payload.priority = 'interactive'. each worker reserves a small pool that
+-- claims only such tasks, so they are not queued behind bulk back-catalog
+-- processing. the regular dequeue still picks them up too when it gets there
+-- first.
+
+create index task_priority_scheduled_idx
+    on queues.task ((payload->>'priority'), scheduled_at, task_id)
+    where payload ? 'priority';
+
+-- claim up to _limit available tasks with payload.priority = _priority whose
+-- type is one of _task_types, in scheduled order
+create or replace function queues.dequeue_priority_tasks(
+    _limit integer,
+    _priority text,
+    _task_types text[]
+)
+returns setof queues.task
+language plpgsql
+security definer
+as $$
+declare
+    _lease_duration interval := interval '5 minutes';
+begin
+    return query
+    with claimed as (
+        select t.*
+        from queues.task t
+        where t.payload ? 'priority'
+        and t.payload->>'priority' = _priority
+        and t.task_type::text = any(coalesce(_task_types, '{}'::text[]))
+        and not exists (
+            select 1
+            from queues.task_completed c
+            where c.task_id = t.task_id
+        )
+        and not exists (
+            select 1
+            from queues.task_lease l
+            where l.task_id = t.task_id
+            and l.expires_at > now()
+        )
+        and not exists (
+            select 1
+            from queues.paused_task_type p
+            where p.task_type = t.task_type
+        )
+        and t.scheduled_at <= now()
+        order by t.scheduled_at, t.task_id
+        limit greatest(coalesce(_limit, 1), 1)
+        for update skip locked
+    ),
+    leased as (
+        insert into queues.task_lease (task_id, expires_at)
+        select
+            task_id,
+            now() + _lease_duration
+        from claimed
+    )
+    select *
+    from claimed
+    order by scheduled_at, task_id;
+end;
+$$;
+
+grant execute on function queues.dequeue_priority_tasks(integer, text, text[]) to worker_service_user;
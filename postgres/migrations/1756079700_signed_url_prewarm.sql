@@ -0,0 +1,31 @@
+-- signed url pre-warming: mint signed download urls before clients ask
+--
+-- a signed_url_prewarm task runs its before_handler to list file ids (e.g. the
+-- media attached to lessons starting within the next hour) and asks the files
+-- service for their signed download urls. the files service caches them, so a
+-- classroom joining at once is served from that cache instead of every client
+-- triggering a lookup and signature at start time.
+--
+-- the before_handler is owned by the feature that knows which files will be
+-- needed; it receives the task payload and returns
+-- {"status": "succeeded", "payload": {"file_ids": [...]}}. schedule it with a
+-- recurring task definition, e.g. every 15 minutes:
+--
+--   insert into queues.recurring_task (name, cron_expression, task_type, payload)
+--   values ('prewarm_lesson_media', '*/15 * * * *', 'signed_url_prewarm',
+--           '{"before_handler": "<schema>.upcoming_lesson_media"}');
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm'
+    ));
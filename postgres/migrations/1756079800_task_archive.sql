@@ -0,0 +1,164 @@
+-- task archival: move old completed tasks out of the hot queue tables
+--
+-- completed tasks, their errors, events and results were kept in the queue
+-- tables forever (or until someone ran queuectl purge), so every dequeue and
+-- depth query scanned a growing history. a task_archive task now moves tasks
+-- completed more than retention_days ago into queues.task_archive, one row per
+-- task with its history folded into jsonb, and deletes them from the hot
+-- tables. schedule it with a recurring task definition, e.g. nightly:
+--
+--   insert into queues.recurring_task (name, cron_expression, task_type, payload)
+--   values ('archive_completed_tasks', '0 3 * * *', 'task_archive',
+--           '{"retention_days": 30}');
+--
+-- tasks that are the parent or root of a chain with an unfinished child stay
+-- until the child completes, so chain depth tracking keeps its anchor.
+
+-- queues.task_archive: completed tasks moved out of queues.task
+create table queues.task_archive (
+    task_id bigint primary key,
+    task_type text not null,
+    payload jsonb not null,
+    enqueued_at timestamp with time zone not null,
+    scheduled_at timestamp with time zone not null,
+    completed_at timestamp with time zone not null,
+    dead_letter_error_class text,
+    result jsonb,
+    errors jsonb not null default '[]'::jsonb,
+    events jsonb not null default '[]'::jsonb,
+    archived_at timestamp with time zone not null default now()
+);
+
+create index task_archive_completed_at_idx on queues.task_archive (completed_at);
+
+-- archive one batch of tasks completed before now() - retention_days.
+-- payload: {"retention_days": 30, "batch_size": 1000}
+-- returns {"status": "succeeded", "payload": {"archived": n, "completed_before": ts}}
+create or replace function queues.archive_completed_tasks(_payload jsonb)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _retention_days integer := coalesce((_payload->>'retention_days')::integer, 30);
+    _batch_size integer := coalesce((_payload->>'batch_size')::integer, 1000);
+    _completed_before timestamp with time zone;
+    _task_ids bigint[];
+    _archived integer;
+begin
+    if _retention_days < 1 or _batch_size < 1 or _batch_size > 10000 then
+        return jsonb_build_object(
+            'validation_failure_message',
+            'retention_days must be at least 1 and batch_size between 1 and 10000'
+        );
+    end if;
+
+    _completed_before := now() - make_interval(days => _retention_days);
+
+    select array_agg(s.task_id) into _task_ids
+    from (
+        select t.task_id
+        from queues.task t
+        join queues.task_completed c on c.task_id = t.task_id
+        where c.completed_at < _completed_before
+        and not exists (
+            select 1
+            from queues.task_chain ch
+            where (ch.parent_task_id = t.task_id or ch.root_task_id = t.task_id)
+            and not exists (
+                select 1 from queues.task_completed cc where cc.task_id = ch.child_task_id
+            )
+        )
+        order by c.completed_at
+        limit _batch_size
+        for update of t skip locked
+    ) s;
+
+    if _task_ids is null then
+        return jsonb_build_object(
+            'status', 'succeeded',
+            'payload', jsonb_build_object('archived', 0, 'completed_before', _completed_before)
+        );
+    end if;
+
+    insert into queues.task_archive (
+        task_id,
+        task_type,
+        payload,
+        enqueued_at,
+        scheduled_at,
+        completed_at,
+        dead_letter_error_class,
+        result,
+        errors,
+        events
+    )
+    select
+        t.task_id,
+        t.task_type,
+        t.payload,
+        t.enqueued_at,
+        t.scheduled_at,
+        c.completed_at,
+        dl.error_class,
+        r.payload,
+        coalesce((
+            select jsonb_agg(jsonb_build_object(
+                'error_message', e.error_message,
+                'created_at', e.created_at
+            ) order by e.error_id)
+            from queues.error e
+            where e.task_id = t.task_id
+        ), '[]'::jsonb),
+        coalesce((
+            select jsonb_agg(jsonb_build_object(
+                'event_type', ev.event_type,
+                'details', ev.details,
+                'created_at', ev.created_at
+            ) order by ev.task_event_id)
+            from queues.task_event ev
+            where ev.task_id = t.task_id
+        ), '[]'::jsonb)
+    from queues.task t
+    join queues.task_completed c on c.task_id = t.task_id
+    left join queues.task_dead_letter dl on dl.task_id = t.task_id
+    left join queues.task_result r on r.task_id = t.task_id
+    where t.task_id = any(_task_ids)
+    on conflict (task_id) do nothing;
+
+    -- errors only lose their task reference on delete, so remove them here
+    delete from queues.error e
+    where e.task_id = any(_task_ids);
+
+    delete from queues.task t
+    where t.task_id = any(_task_ids);
+
+    get diagnostics _archived = row_count;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'archived', _archived,
+            'completed_before', _completed_before
+        )
+    );
+end;
+$$;
+
+grant execute on function queues.archive_completed_tasks(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive'
+    ));
@@ -0,0 +1,27 @@
+-- webhook delivery: outbound http callbacks triggered from postgres
+--
+-- a webhook task runs its before_handler, which returns the request to send:
+-- {"status": "succeeded", "payload": {"url": "https://...", "method": "POST",
+--  "headers": {...}, "body": {...}, "hmac_secret": "..."}}. the worker sends it
+-- with the task id in x-chatterbox-delivery and, when hmac_secret is set, an
+-- x-chatterbox-signature header (t=<unix>,v1=<hex hmac-sha256 of "t.body">).
+-- a 2xx response succeeds and the success handler receives
+-- {"status_code", "latency_ms", "body_snippet"}; 5xx, 429 and network errors
+-- are retried within the worker's retry budget for the webhook task type.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook'
+    ));
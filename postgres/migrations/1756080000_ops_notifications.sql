@@ -0,0 +1,176 @@
+-- ops notifications: tell operators about failures nobody is watching for
+--
+-- the worker calls queues.notify_ops when a task fails for good (retries
+-- exhausted, dead-lettered or unclassified) or when a task type's failure rate
+-- over a window crosses WORKER_OPS_ERROR_RATE_THRESHOLD. each instance sends
+-- at most one notification per kind and task type per cooldown and counts the
+-- events in between into the next one.
+--
+-- queues.notify_ops records the notification and fans it out to whichever
+-- destinations internal.config 'ops_notifications' sets:
+--   email_to           an email task from the noreply address
+--   slack_webhook_url  a webhook task posting {"text": ...} to a slack
+--                      incoming webhook
+-- an empty value skips that destination; notifications are still recorded.
+
+insert into internal.config (key, value)
+values (
+    'ops_notifications',
+    '{
+        "email_to": "{secrets.ops_notification_email}",
+        "slack_webhook_url": "{secrets.ops_slack_webhook_url}"
+    }'
+)
+on conflict (key) do nothing;
+
+-- queues.ops_notification: one row per notification the worker raised
+create table queues.ops_notification (
+    ops_notification_id bigserial primary key,
+    kind text not null check (kind in ('retries_exhausted', 'error_rate')),
+    task_type text not null,
+    event_count integer not null,
+    first_event_at timestamp with time zone not null,
+    details jsonb not null default '{}'::jsonb,
+    summary text not null,
+    created_at timestamp with time zone not null default now()
+);
+
+create index ops_notification_created_at_idx on queues.ops_notification (created_at);
+
+-- one-line, human-readable summary of a notification payload
+create or replace function queues.ops_notification_summary(_payload jsonb)
+returns text
+language sql
+immutable
+as $$
+    select case _payload->>'kind'
+        when 'retries_exhausted' then format(
+            '[chatterbox] %s: %s task(s) failed for good since %s. last: task %s (%s, attempt %s/%s): %s',
+            _payload->>'task_type',
+            _payload->>'count',
+            _payload->>'since',
+            _payload#>>'{details,task_id}',
+            coalesce(nullif(_payload#>>'{details,error_class}', ''), 'unclassified'),
+            _payload#>>'{details,attempt}',
+            _payload#>>'{details,max_attempts}',
+            _payload#>>'{details,error}'
+        )
+        else format(
+            '[chatterbox] %s: %s of %s attempts failed (%s%%) since %s, threshold %s%%. recent errors: %s',
+            _payload->>'task_type',
+            _payload#>>'{details,failed}',
+            _payload#>>'{details,total}',
+            round((_payload#>>'{details,error_rate}')::numeric * 100),
+            _payload#>>'{details,window_start}',
+            round((_payload#>>'{details,threshold}')::numeric * 100),
+            coalesce((
+                select string_agg(e, ' | ')
+                from jsonb_array_elements_text(_payload#>'{details,sample_errors}') e
+            ), 'none')
+        )
+    end;
+$$;
+
+-- record a notification and enqueue its email and slack deliveries.
+-- payload: {"kind", "task_type", "count", "since", "details": {...}}
+-- returns {"status": "succeeded", "payload": {"ops_notification_id": n}}
+create or replace function queues.notify_ops(_payload jsonb)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _config jsonb := coalesce(internal.get_config('ops_notifications'), '{}'::jsonb);
+    _email_to text := nullif(_config->>'email_to', '');
+    _slack_webhook_url text := nullif(_config->>'slack_webhook_url', '');
+    _summary text;
+    _ops_notification_id bigint;
+    _validation_failure_message text;
+begin
+    if coalesce(_payload->>'kind', '') not in ('retries_exhausted', 'error_rate') or coalesce(_payload->>'task_type', '') = '' then
+        return jsonb_build_object(
+            'validation_failure_message',
+            'kind must be retries_exhausted or error_rate and task_type is required'
+        );
+    end if;
+
+    _summary := queues.ops_notification_summary(_payload);
+
+    insert into queues.ops_notification (kind, task_type, event_count, first_event_at, details, summary)
+    values (
+        _payload->>'kind',
+        _payload->>'task_type',
+        coalesce((_payload->>'count')::integer, 1),
+        coalesce((_payload->>'since')::timestamp with time zone, now()),
+        coalesce(_payload->'details', '{}'::jsonb),
+        _summary
+    )
+    returning ops_notification_id into _ops_notification_id;
+
+    if _email_to is not null then
+        _validation_failure_message := comms.create_and_kickoff_email_task(
+            comms.from_email_address('noreply'),
+            _email_to,
+            left(_summary, 150),
+            '<p>' || replace(replace(replace(_summary, '&', '&amp;'), '<', '&lt;'), '>', '&gt;') || '</p>'
+                || '<pre>'
+                || replace(replace(replace(jsonb_pretty(coalesce(_payload->'details', '{}'::jsonb)), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')
+                || '</pre>',
+            now()
+        );
+        if _validation_failure_message is not null then
+            raise warning 'ops notification % email not scheduled: %', _ops_notification_id, _validation_failure_message;
+        end if;
+    end if;
+
+    if _slack_webhook_url is not null then
+        perform queues.enqueue(
+            'webhook',
+            jsonb_build_object(
+                'task_type', 'webhook',
+                'before_handler', 'queues.get_ops_notification_webhook_payload',
+                'ops_notification_id', _ops_notification_id
+            )
+        );
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object('ops_notification_id', _ops_notification_id)
+    );
+end;
+$$;
+
+-- before_handler of the slack webhook task: the request posting the summary
+create or replace function queues.get_ops_notification_webhook_payload(_payload jsonb)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _slack_webhook_url text := nullif(internal.get_config('ops_notifications')->>'slack_webhook_url', '');
+    _summary text;
+begin
+    select n.summary into _summary
+    from queues.ops_notification n
+    where n.ops_notification_id = (_payload->>'ops_notification_id')::bigint;
+
+    if _summary is null or _slack_webhook_url is null then
+        return jsonb_build_object(
+            'validation_failure_message',
+            'ops notification not found or slack_webhook_url not configured'
+        );
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'url', _slack_webhook_url,
+            'body', jsonb_build_object('text', _summary)
+        )
+    );
+end;
+$$;
+
+grant execute on function queues.notify_ops(jsonb) to worker_service_user;
+grant execute on function queues.get_ops_notification_webhook_payload(jsonb) to worker_service_user;
@@ -0,0 +1,467 @@
+-- send discord message process: mirrors sms/email sending
+--
+-- a discord message names a webhook by key; the urls (which carry the
+-- webhook's token) live in internal.config 'discord_webhooks', e.g.
+--
+--   update internal.config
+--   set value = value || '{"ops": "https://discord.com/api/webhooks/<id>/<token>"}'
+--   where key = 'discord_webhooks';
+--
+-- comms.create_and_kickoff_discord_message_task('ops', 'deploy finished', '[]')
+-- then runs the usual supervisor: one discord_message task per attempt, whose
+-- success handler records the id of the message discord created.
+
+insert into internal.config (key, value)
+values ('discord_webhooks', '{}'::jsonb)
+on conflict (key) do nothing;
+
+alter domain comms.channel drop constraint if exists channel_check;
+
+alter domain comms.channel
+    add constraint channel_check
+    check (value in ('email', 'sms', 'discord'));
+
+-- discord payload table
+create table comms.discord_message (
+    message_id bigint primary key references comms.message(message_id) on delete cascade,
+    webhook_key text not null,
+    content text,
+    username text,
+    embeds jsonb not null default '[]'::jsonb,
+    check (content is not null or jsonb_array_length(embeds) > 0)
+);
+
+create or replace function comms.create_discord_message(
+    _webhook_key text,
+    _content text,
+    _embeds jsonb default '[]'::jsonb,
+    _username text default null,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _webhook_key is null then
+        validation_failure_message := 'webhook_key_missing';
+        return;
+    end if;
+    if jsonb_typeof(coalesce(_embeds, '[]'::jsonb)) <> 'array' then
+        validation_failure_message := 'embeds_not_array';
+        return;
+    end if;
+    if _content is null and jsonb_array_length(coalesce(_embeds, '[]'::jsonb)) = 0 then
+        validation_failure_message := 'content_or_embeds_missing';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('discord')
+    returning message_id
+    into created_message_id;
+
+    insert into comms.discord_message (message_id, webhook_key, content, username, embeds)
+    values (created_message_id, _webhook_key, _content, _username, coalesce(_embeds, '[]'::jsonb));
+    return;
+end;
+$$;
+
+-- send discord process: task and attempts (append-only)
+create table comms.send_discord_task (
+    send_discord_task_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempts (append-only, one per scheduled attempt)
+create table comms.send_discord_attempt (
+    send_discord_attempt_id bigserial primary key,
+    send_discord_task_id bigint not null references comms.send_discord_task(send_discord_task_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt succeeded (one per attempt at most), with discord's message id
+create table comms.send_discord_attempt_succeeded (
+    send_discord_attempt_id bigint primary key references comms.send_discord_attempt(send_discord_attempt_id) on delete cascade,
+    discord_message_id text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt failed (one per attempt at most)
+create table comms.send_discord_attempt_failed (
+    send_discord_attempt_id bigint primary key references comms.send_discord_attempt(send_discord_attempt_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- facts: aggregated facts for send_discord_supervisor
+create or replace function comms.send_discord_supervisor_facts(
+    _send_discord_task_id bigint,
+    out has_success boolean,
+    out num_failures integer,
+    out num_attempts integer
+)
+language sql
+stable
+as $$
+    select
+        exists (
+            select 1
+            from comms.send_discord_attempt a
+            join comms.send_discord_attempt_succeeded s on s.send_discord_attempt_id = a.send_discord_attempt_id
+            where a.send_discord_task_id = _send_discord_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_discord_attempt a
+            join comms.send_discord_attempt_failed f on f.send_discord_attempt_id = a.send_discord_attempt_id
+            where a.send_discord_task_id = _send_discord_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_discord_attempt a
+            where a.send_discord_task_id = _send_discord_task_id
+        );
+$$;
+
+-- facts: get discord payload facts from attempt_id
+create or replace function comms.get_discord_payload_facts(
+    _send_discord_attempt_id bigint,
+    out message_id bigint,
+    out webhook_key text,
+    out content text,
+    out username text,
+    out embeds jsonb
+)
+language sql
+stable
+as $$
+    select
+        dm.message_id,
+        dm.webhook_key,
+        dm.content,
+        dm.username,
+        dm.embeds
+    from comms.send_discord_attempt a
+    join comms.send_discord_task t on t.send_discord_task_id = a.send_discord_task_id
+    join comms.discord_message dm on dm.message_id = t.message_id
+    where a.send_discord_attempt_id = _send_discord_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_discord_attempt_id in payload
+create or replace function comms.get_discord_message_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_discord_attempt_id bigint := (_payload->>'send_discord_attempt_id')::bigint;
+    _facts record;
+    _webhook_url text;
+begin
+    if _send_discord_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_discord_attempt_id');
+    end if;
+
+    _facts := comms.get_discord_payload_facts(_send_discord_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    _webhook_url := nullif(internal.get_config('discord_webhooks')->>_facts.webhook_key, '');
+    if _webhook_url is null then
+        return jsonb_build_object(
+            'validation_failure_message',
+            format('discord webhook %s is not configured', _facts.webhook_key)
+        );
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            'webhook_url', _webhook_url,
+            'content', _facts.content,
+            'username', _facts.username
+        )) || jsonb_build_object('embeds', _facts.embeds)
+    );
+end;
+$$;
+
+-- success handler: record success fact with discord's message id
+-- receives: { original_payload: { send_discord_attempt_id, ... }, worker_payload: { id, channel_id } }
+create or replace function comms.record_discord_message_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_discord_attempt_id bigint := (_payload->'original_payload'->>'send_discord_attempt_id')::bigint;
+begin
+    if _send_discord_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_discord_attempt_id');
+    end if;
+
+    insert into comms.send_discord_attempt_succeeded (send_discord_attempt_id, discord_message_id)
+    values (_send_discord_attempt_id, _payload->'worker_payload'->>'id')
+    on conflict (send_discord_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record failure fact
+-- receives: { original_payload: { send_discord_attempt_id, ... }, error: "..." }
+create or replace function comms.record_discord_message_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_discord_attempt_id bigint := (_payload->'original_payload'->>'send_discord_attempt_id')::bigint;
+    _error_message text := _payload->>'error';
+begin
+    if _send_discord_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_discord_attempt_id');
+    end if;
+
+    insert into comms.send_discord_attempt_failed (send_discord_attempt_id, error_message)
+    values (_send_discord_attempt_id, _error_message)
+    on conflict (send_discord_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: schedule a discord send attempt
+create or replace function comms.schedule_discord_attempt(
+    _send_discord_task_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _send_discord_attempt_id bigint;
+begin
+    insert into comms.send_discord_attempt (send_discord_task_id)
+    values (_send_discord_task_id)
+    returning send_discord_attempt_id into _send_discord_attempt_id;
+
+    perform queues.enqueue(
+        'discord_message',
+        jsonb_build_object(
+            'task_type', 'discord_message',
+            'send_discord_attempt_id', _send_discord_attempt_id,
+            'before_handler', 'comms.get_discord_message_payload',
+            'success_handler', 'comms.record_discord_message_success',
+            'error_handler', 'comms.record_discord_message_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- effect: schedule discord supervisor recheck with exponential backoff
+create or replace function comms.schedule_discord_supervisor_recheck(
+    _send_discord_task_id bigint,
+    _num_failures integer,
+    _run_count integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _base_delay_seconds integer := 5;
+    _next_check_at timestamptz;
+begin
+    _next_check_at := now() + (
+        _base_delay_seconds * power(2, _num_failures)
+    ) * interval '1 second';
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_discord_supervisor',
+            'send_discord_task_id', _send_discord_task_id,
+            'run_count', _run_count + 1
+        ),
+        _next_check_at
+    );
+end;
+$$;
+
+-- supervisor: orchestrates discord sending using append-only facts
+create or replace function comms.send_discord_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_discord_task_id bigint := (_payload->>'send_discord_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _max_runs integer := 20;
+    _max_attempts integer := 2;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _send_discord_task_id is null then
+        return jsonb_build_object('status', 'missing_send_discord_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'send_discord_supervisor exceeded max runs'
+            using detail = 'Possible infinite loop detected',
+                  hint = format('task_id=%s, run_count=%s', _send_discord_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK (before facts)
+    perform 1
+    from comms.send_discord_task t
+    where t.send_discord_task_id = _send_discord_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := comms.send_discord_supervisor_facts(_send_discord_task_id);
+
+    -- 4. LOGIC + EFFECTS
+    if _facts.has_success then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    if _facts.num_attempts = _facts.num_failures then
+        perform comms.schedule_discord_attempt(_send_discord_task_id);
+    end if;
+
+    perform comms.schedule_discord_supervisor_recheck(
+        _send_discord_task_id,
+        _facts.num_failures,
+        _run_count
+    );
+
+    return jsonb_build_object('status', 'scheduled');
+end;
+$$;
+
+create or replace function comms.kickoff_send_discord_task(
+    _message_id bigint,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _send_discord_task_id bigint;
+begin
+    -- validation
+    if _message_id is null then
+        validation_failure_message := 'missing_message_id';
+        return;
+    end if;
+
+    if not comms.message_exists(_message_id) then
+        validation_failure_message := 'message_not_found';
+        return;
+    end if;
+
+    -- output
+    insert into comms.send_discord_task (message_id)
+    values (_message_id)
+    returning send_discord_task_id
+    into _send_discord_task_id;
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_discord_supervisor',
+            'send_discord_task_id', _send_discord_task_id
+        ),
+        _scheduled_at
+    );
+
+    return;
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_discord_message_task(
+    _webhook_key text,
+    _content text,
+    _embeds jsonb default '[]'::jsonb,
+    _username text default null,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_discord_message_result record;
+    _kickoff_discord_validation_failure_message text;
+begin
+    select (comms.create_discord_message(_webhook_key, _content, _embeds, _username)).*
+    into strict _create_discord_message_result;
+
+    if _create_discord_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_discord_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_discord_task(_create_discord_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_discord_validation_failure_message;
+
+    if _kickoff_discord_validation_failure_message is not null then
+        validation_failure_message := _kickoff_discord_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
+
+-- per-function grants to worker_service_user (discord)
+grant execute on function comms.kickoff_send_discord_task(bigint, timestamp with time zone) to worker_service_user;
+grant execute on function comms.get_discord_message_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_discord_message_success(jsonb) to worker_service_user;
+grant execute on function comms.record_discord_message_failure(jsonb) to worker_service_user;
+grant execute on function comms.schedule_discord_attempt(bigint) to worker_service_user;
+grant execute on function comms.schedule_discord_supervisor_recheck(bigint, integer, integer) to worker_service_user;
+grant execute on function comms.send_discord_supervisor(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message'
+    ));
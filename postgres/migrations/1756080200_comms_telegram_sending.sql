@@ -0,0 +1,503 @@
+-- send telegram message process: mirrors sms/email/discord sending
+--
+-- telegram messages go out through the bot api with the worker's
+-- TELEGRAM_BOT_TOKEN. a message targets a chat directly by id (a numeric chat
+-- id or an @channelusername) or by a key in internal.config 'telegram_chats',
+-- which the before_handler resolves, e.g.
+--
+--   update internal.config
+--   set value = value || '{"ops": "-1001234567890"}'
+--   where key = 'telegram_chats';
+--
+-- comms.create_and_kickoff_telegram_message_task('ops', 'deploy finished')
+-- then runs the usual supervisor: one telegram_message task per attempt, sent
+-- with sendMessage, or sendDocument when the message carries a files service
+-- file or a document url. the success handler records telegram's message id.
+
+insert into internal.config (key, value)
+values ('telegram_chats', '{}'::jsonb)
+on conflict (key) do nothing;
+
+alter domain comms.channel drop constraint if exists channel_check;
+
+alter domain comms.channel
+    add constraint channel_check
+    check (value in ('email', 'sms', 'discord', 'telegram'));
+
+-- telegram payload table: exactly one of chat_id and chat_key, at most one
+-- document source
+create table comms.telegram_message (
+    message_id bigint primary key references comms.message(message_id) on delete cascade,
+    chat_id text,
+    chat_key text,
+    text text,
+    parse_mode text check (parse_mode in ('MarkdownV2', 'HTML')),
+    document_file_id bigint references files.file(file_id),
+    document_url text,
+    check ((chat_id is null) <> (chat_key is null)),
+    check (document_file_id is null or document_url is null),
+    check (text is not null or document_file_id is not null or document_url is not null)
+);
+
+-- _chat is a chat id (numeric or @channelusername) or a telegram_chats key
+create or replace function comms.create_telegram_message(
+    _chat text,
+    _text text,
+    _parse_mode text default null,
+    _document_file_id bigint default null,
+    _document_url text default null,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+declare
+    _is_chat_id boolean := _chat ~ '^(-?[0-9]+|@[A-Za-z0-9_]+)$';
+begin
+    if _chat is null then
+        validation_failure_message := 'chat_missing';
+        return;
+    end if;
+    if _text is null and _document_file_id is null and _document_url is null then
+        validation_failure_message := 'text_or_document_missing';
+        return;
+    end if;
+    if _document_file_id is not null and _document_url is not null then
+        validation_failure_message := 'multiple_documents';
+        return;
+    end if;
+    if _parse_mode is not null and _parse_mode not in ('MarkdownV2', 'HTML') then
+        validation_failure_message := 'parse_mode_invalid';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('telegram')
+    returning message_id
+    into created_message_id;
+
+    insert into comms.telegram_message (message_id, chat_id, chat_key, text, parse_mode, document_file_id, document_url)
+    values (
+        created_message_id,
+        case when _is_chat_id then _chat end,
+        case when not _is_chat_id then _chat end,
+        _text,
+        _parse_mode,
+        _document_file_id,
+        _document_url
+    );
+    return;
+end;
+$$;
+
+-- send telegram process: task and attempts (append-only)
+create table comms.send_telegram_task (
+    send_telegram_task_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempts (append-only, one per scheduled attempt)
+create table comms.send_telegram_attempt (
+    send_telegram_attempt_id bigserial primary key,
+    send_telegram_task_id bigint not null references comms.send_telegram_task(send_telegram_task_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt succeeded (one per attempt at most), with telegram's message id
+create table comms.send_telegram_attempt_succeeded (
+    send_telegram_attempt_id bigint primary key references comms.send_telegram_attempt(send_telegram_attempt_id) on delete cascade,
+    telegram_message_id bigint,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt failed (one per attempt at most)
+create table comms.send_telegram_attempt_failed (
+    send_telegram_attempt_id bigint primary key references comms.send_telegram_attempt(send_telegram_attempt_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- facts: aggregated facts for send_telegram_supervisor
+create or replace function comms.send_telegram_supervisor_facts(
+    _send_telegram_task_id bigint,
+    out has_success boolean,
+    out num_failures integer,
+    out num_attempts integer
+)
+language sql
+stable
+as $$
+    select
+        exists (
+            select 1
+            from comms.send_telegram_attempt a
+            join comms.send_telegram_attempt_succeeded s on s.send_telegram_attempt_id = a.send_telegram_attempt_id
+            where a.send_telegram_task_id = _send_telegram_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_telegram_attempt a
+            join comms.send_telegram_attempt_failed f on f.send_telegram_attempt_id = a.send_telegram_attempt_id
+            where a.send_telegram_task_id = _send_telegram_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_telegram_attempt a
+            where a.send_telegram_task_id = _send_telegram_task_id
+        );
+$$;
+
+-- facts: get telegram payload facts from attempt_id
+create or replace function comms.get_telegram_payload_facts(
+    _send_telegram_attempt_id bigint,
+    out message_id bigint,
+    out chat_id text,
+    out chat_key text,
+    out text text,
+    out parse_mode text,
+    out document_file_id bigint,
+    out document_url text
+)
+language sql
+stable
+as $$
+    select
+        tm.message_id,
+        tm.chat_id,
+        tm.chat_key,
+        tm.text,
+        tm.parse_mode,
+        tm.document_file_id,
+        tm.document_url
+    from comms.send_telegram_attempt a
+    join comms.send_telegram_task t on t.send_telegram_task_id = a.send_telegram_task_id
+    join comms.telegram_message tm on tm.message_id = t.message_id
+    where a.send_telegram_attempt_id = _send_telegram_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_telegram_attempt_id in
+-- payload, resolving chat_key to a chat id through telegram_chats
+create or replace function comms.get_telegram_message_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_telegram_attempt_id bigint := (_payload->>'send_telegram_attempt_id')::bigint;
+    _facts record;
+    _chat_id text;
+begin
+    if _send_telegram_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_telegram_attempt_id');
+    end if;
+
+    _facts := comms.get_telegram_payload_facts(_send_telegram_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    _chat_id := coalesce(_facts.chat_id, nullif(internal.get_config('telegram_chats')->>_facts.chat_key, ''));
+    if _chat_id is null then
+        return jsonb_build_object(
+            'validation_failure_message',
+            format('telegram chat %s is not configured', _facts.chat_key)
+        );
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            -- numeric ids go out as numbers, channel usernames as strings
+            'chat_id', case when _chat_id ~ '^-?[0-9]+$' then to_jsonb(_chat_id::bigint) else to_jsonb(_chat_id) end,
+            'text', _facts.text,
+            'parse_mode', _facts.parse_mode,
+            'document', case
+                when _facts.document_file_id is not null then jsonb_build_object('file_id', _facts.document_file_id)
+                when _facts.document_url is not null then jsonb_build_object('url', _facts.document_url)
+            end
+        ))
+    );
+end;
+$$;
+
+-- success handler: record success fact with telegram's message id
+-- receives: { original_payload: { send_telegram_attempt_id, ... }, worker_payload: { message_id, chat_id } }
+create or replace function comms.record_telegram_message_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_telegram_attempt_id bigint := (_payload->'original_payload'->>'send_telegram_attempt_id')::bigint;
+begin
+    if _send_telegram_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_telegram_attempt_id');
+    end if;
+
+    insert into comms.send_telegram_attempt_succeeded (send_telegram_attempt_id, telegram_message_id)
+    values (_send_telegram_attempt_id, (_payload->'worker_payload'->>'message_id')::bigint)
+    on conflict (send_telegram_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record failure fact
+-- receives: { original_payload: { send_telegram_attempt_id, ... }, error: "..." }
+create or replace function comms.record_telegram_message_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_telegram_attempt_id bigint := (_payload->'original_payload'->>'send_telegram_attempt_id')::bigint;
+    _error_message text := _payload->>'error';
+begin
+    if _send_telegram_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_telegram_attempt_id');
+    end if;
+
+    insert into comms.send_telegram_attempt_failed (send_telegram_attempt_id, error_message)
+    values (_send_telegram_attempt_id, _error_message)
+    on conflict (send_telegram_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: schedule a telegram send attempt
+create or replace function comms.schedule_telegram_attempt(
+    _send_telegram_task_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _send_telegram_attempt_id bigint;
+begin
+    insert into comms.send_telegram_attempt (send_telegram_task_id)
+    values (_send_telegram_task_id)
+    returning send_telegram_attempt_id into _send_telegram_attempt_id;
+
+    perform queues.enqueue(
+        'telegram_message',
+        jsonb_build_object(
+            'task_type', 'telegram_message',
+            'send_telegram_attempt_id', _send_telegram_attempt_id,
+            'before_handler', 'comms.get_telegram_message_payload',
+            'success_handler', 'comms.record_telegram_message_success',
+            'error_handler', 'comms.record_telegram_message_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- effect: schedule telegram supervisor recheck with exponential backoff
+create or replace function comms.schedule_telegram_supervisor_recheck(
+    _send_telegram_task_id bigint,
+    _num_failures integer,
+    _run_count integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _base_delay_seconds integer := 5;
+    _next_check_at timestamptz;
+begin
+    _next_check_at := now() + (
+        _base_delay_seconds * power(2, _num_failures)
+    ) * interval '1 second';
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_telegram_supervisor',
+            'send_telegram_task_id', _send_telegram_task_id,
+            'run_count', _run_count + 1
+        ),
+        _next_check_at
+    );
+end;
+$$;
+
+-- supervisor: orchestrates telegram sending using append-only facts
+create or replace function comms.send_telegram_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_telegram_task_id bigint := (_payload->>'send_telegram_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _max_runs integer := 20;
+    _max_attempts integer := 2;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _send_telegram_task_id is null then
+        return jsonb_build_object('status', 'missing_send_telegram_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'send_telegram_supervisor exceeded max runs'
+            using detail = 'Possible infinite loop detected',
+                  hint = format('task_id=%s, run_count=%s', _send_telegram_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK (before facts)
+    perform 1
+    from comms.send_telegram_task t
+    where t.send_telegram_task_id = _send_telegram_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := comms.send_telegram_supervisor_facts(_send_telegram_task_id);
+
+    -- 4. LOGIC + EFFECTS
+    if _facts.has_success then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    if _facts.num_attempts = _facts.num_failures then
+        perform comms.schedule_telegram_attempt(_send_telegram_task_id);
+    end if;
+
+    perform comms.schedule_telegram_supervisor_recheck(
+        _send_telegram_task_id,
+        _facts.num_failures,
+        _run_count
+    );
+
+    return jsonb_build_object('status', 'scheduled');
+end;
+$$;
+
+create or replace function comms.kickoff_send_telegram_task(
+    _message_id bigint,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _send_telegram_task_id bigint;
+begin
+    -- validation
+    if _message_id is null then
+        validation_failure_message := 'missing_message_id';
+        return;
+    end if;
+
+    if not comms.message_exists(_message_id) then
+        validation_failure_message := 'message_not_found';
+        return;
+    end if;
+
+    -- output
+    insert into comms.send_telegram_task (message_id)
+    values (_message_id)
+    returning send_telegram_task_id
+    into _send_telegram_task_id;
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_telegram_supervisor',
+            'send_telegram_task_id', _send_telegram_task_id
+        ),
+        _scheduled_at
+    );
+
+    return;
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_telegram_message_task(
+    _chat text,
+    _text text,
+    _parse_mode text default null,
+    _document_file_id bigint default null,
+    _document_url text default null,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_telegram_message_result record;
+    _kickoff_telegram_validation_failure_message text;
+begin
+    select (comms.create_telegram_message(_chat, _text, _parse_mode, _document_file_id, _document_url)).*
+    into strict _create_telegram_message_result;
+
+    if _create_telegram_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_telegram_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_telegram_task(_create_telegram_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_telegram_validation_failure_message;
+
+    if _kickoff_telegram_validation_failure_message is not null then
+        validation_failure_message := _kickoff_telegram_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
+
+-- per-function grants to worker_service_user (telegram)
+grant execute on function comms.kickoff_send_telegram_task(bigint, timestamp with time zone) to worker_service_user;
+grant execute on function comms.get_telegram_message_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_telegram_message_success(jsonb) to worker_service_user;
+grant execute on function comms.record_telegram_message_failure(jsonb) to worker_service_user;
+grant execute on function comms.schedule_telegram_attempt(bigint) to worker_service_user;
+grant execute on function comms.schedule_telegram_supervisor_recheck(bigint, integer, integer) to worker_service_user;
+grant execute on function comms.send_telegram_supervisor(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message'
+    ));
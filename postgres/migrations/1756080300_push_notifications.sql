@@ -0,0 +1,564 @@
+-- push notifications: device registry and send process via fcm
+--
+-- apps register their fcm registration token after login with
+-- api.register_push_device(token, platform) and drop it on logout with
+-- api.unregister_push_device(token). a push message targets an account; the
+-- before_handler sends it to every valid device of that account. tokens fcm
+-- reports as unregistered come back to the success handler, which marks them
+-- invalidated so they are not used again. sending mirrors sms/email: one
+-- push_notification task per attempt under a supervisor.
+
+alter domain comms.channel drop constraint if exists channel_check;
+
+alter domain comms.channel
+    add constraint channel_check
+    check (value in ('email', 'sms', 'discord', 'telegram', 'push'));
+
+-- comms.push_device: one row per fcm registration token
+create table comms.push_device (
+    push_device_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    token text not null unique,
+    platform text not null check (platform in ('ios', 'android', 'web')),
+    created_at timestamp with time zone not null default now(),
+    last_registered_at timestamp with time zone not null default now(),
+    invalidated_at timestamp with time zone
+);
+
+create index push_device_account_id_idx on comms.push_device (account_id) where invalidated_at is null;
+
+-- push payload table
+create table comms.push_message (
+    message_id bigint primary key references comms.message(message_id) on delete cascade,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    title text,
+    body text,
+    data jsonb not null default '{}'::jsonb,
+    check (title is not null or body is not null or data <> '{}'::jsonb)
+);
+
+create or replace function comms.create_push_message(
+    _account_id bigint,
+    _title text,
+    _body text,
+    _data jsonb default '{}'::jsonb,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _account_id is null then
+        validation_failure_message := 'account_id_missing';
+        return;
+    end if;
+    if jsonb_typeof(coalesce(_data, '{}'::jsonb)) <> 'object' then
+        validation_failure_message := 'data_not_object';
+        return;
+    end if;
+    if _title is null and _body is null and coalesce(_data, '{}'::jsonb) = '{}'::jsonb then
+        validation_failure_message := 'title_body_or_data_missing';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('push')
+    returning message_id
+    into created_message_id;
+
+    -- fcm data values must be strings
+    insert into comms.push_message (message_id, account_id, title, body, data)
+    values (
+        created_message_id,
+        _account_id,
+        _title,
+        _body,
+        coalesce((
+            select jsonb_object_agg(key, case when jsonb_typeof(value) = 'string' then value else to_jsonb(value::text) end)
+            from jsonb_each(_data)
+        ), '{}'::jsonb)
+    );
+    return;
+end;
+$$;
+
+-- api: register (or re-register) a device token for the authenticated account
+create or replace function api.register_push_device(token text, platform text)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _device comms.push_device;
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Register Push Device Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_register_push_device';
+    end if;
+
+    if coalesce(register_push_device.token, '') = '' or register_push_device.platform not in ('ios', 'android', 'web') then
+        raise exception 'Register Push Device Failed'
+            using detail = 'Invalid Device',
+                  hint = 'invalid_push_device';
+    end if;
+
+    -- a token moves to whichever account registered it last
+    insert into comms.push_device (account_id, token, platform)
+    values (_authenticated_account_id, register_push_device.token, register_push_device.platform)
+    on conflict on constraint push_device_token_key do update
+    set account_id = excluded.account_id,
+        platform = excluded.platform,
+        last_registered_at = now(),
+        invalidated_at = null
+    returning * into _device;
+
+    return jsonb_build_object(
+        'push_device_id', _device.push_device_id,
+        'platform', _device.platform,
+        'last_registered_at', _device.last_registered_at
+    );
+end;
+$$;
+
+-- api: drop a device token of the authenticated account (idempotent)
+create or replace function api.unregister_push_device(token text)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Unregister Push Device Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_unregister_push_device';
+    end if;
+
+    delete from comms.push_device d
+    where d.token = unregister_push_device.token
+    and d.account_id = _authenticated_account_id;
+end;
+$$;
+
+grant execute on function api.register_push_device(text, text) to authenticated;
+grant execute on function api.unregister_push_device(text) to authenticated;
+
+-- send push process: task and attempts (append-only)
+create table comms.send_push_task (
+    send_push_task_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempts (append-only, one per scheduled attempt)
+create table comms.send_push_attempt (
+    send_push_attempt_id bigserial primary key,
+    send_push_task_id bigint not null references comms.send_push_task(send_push_task_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt succeeded (one per attempt at most), with per-device counts
+create table comms.send_push_attempt_succeeded (
+    send_push_attempt_id bigint primary key references comms.send_push_attempt(send_push_attempt_id) on delete cascade,
+    sent_count integer not null default 0,
+    invalid_token_count integer not null default 0,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt failed (one per attempt at most)
+create table comms.send_push_attempt_failed (
+    send_push_attempt_id bigint primary key references comms.send_push_attempt(send_push_attempt_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- facts: aggregated facts for send_push_supervisor
+create or replace function comms.send_push_supervisor_facts(
+    _send_push_task_id bigint,
+    out has_success boolean,
+    out num_failures integer,
+    out num_attempts integer
+)
+language sql
+stable
+as $$
+    select
+        exists (
+            select 1
+            from comms.send_push_attempt a
+            join comms.send_push_attempt_succeeded s on s.send_push_attempt_id = a.send_push_attempt_id
+            where a.send_push_task_id = _send_push_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_push_attempt a
+            join comms.send_push_attempt_failed f on f.send_push_attempt_id = a.send_push_attempt_id
+            where a.send_push_task_id = _send_push_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_push_attempt a
+            where a.send_push_task_id = _send_push_task_id
+        );
+$$;
+
+-- facts: get push payload facts from attempt_id
+create or replace function comms.get_push_payload_facts(
+    _send_push_attempt_id bigint,
+    out message_id bigint,
+    out account_id bigint,
+    out title text,
+    out body text,
+    out data jsonb
+)
+language sql
+stable
+as $$
+    select
+        pm.message_id,
+        pm.account_id,
+        pm.title,
+        pm.body,
+        pm.data
+    from comms.send_push_attempt a
+    join comms.send_push_task t on t.send_push_task_id = a.send_push_task_id
+    join comms.push_message pm on pm.message_id = t.message_id
+    where a.send_push_attempt_id = _send_push_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_push_attempt_id in
+-- payload, with the account's current device tokens
+create or replace function comms.get_push_notification_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_push_attempt_id bigint := (_payload->>'send_push_attempt_id')::bigint;
+    _facts record;
+    _tokens jsonb;
+begin
+    if _send_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_push_attempt_id');
+    end if;
+
+    _facts := comms.get_push_payload_facts(_send_push_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    select jsonb_agg(d.token order by d.last_registered_at desc)
+    into _tokens
+    from comms.push_device d
+    where d.account_id = _facts.account_id
+    and d.invalidated_at is null;
+
+    if _tokens is null then
+        return jsonb_build_object('validation_failure_message', 'no_push_devices');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            'tokens', _tokens,
+            'title', _facts.title,
+            'body', _facts.body,
+            'data', _facts.data
+        ))
+    );
+end;
+$$;
+
+-- success handler: record success fact and invalidate the tokens fcm rejected
+-- receives: { original_payload: { send_push_attempt_id, ... }, worker_payload: { sent, invalid_tokens, ... } }
+create or replace function comms.record_push_notification_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_push_attempt_id bigint := (_payload->'original_payload'->>'send_push_attempt_id')::bigint;
+    _invalid_tokens jsonb := coalesce(_payload->'worker_payload'->'invalid_tokens', '[]'::jsonb);
+begin
+    if _send_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_push_attempt_id');
+    end if;
+
+    insert into comms.send_push_attempt_succeeded (send_push_attempt_id, sent_count, invalid_token_count)
+    values (
+        _send_push_attempt_id,
+        coalesce((_payload->'worker_payload'->>'sent')::integer, 0),
+        jsonb_array_length(_invalid_tokens)
+    )
+    on conflict (send_push_attempt_id) do nothing;
+
+    update comms.push_device d
+    set invalidated_at = now()
+    where d.token in (select jsonb_array_elements_text(_invalid_tokens))
+    and d.invalidated_at is null;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record failure fact
+-- receives: { original_payload: { send_push_attempt_id, ... }, error: "..." }
+create or replace function comms.record_push_notification_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_push_attempt_id bigint := (_payload->'original_payload'->>'send_push_attempt_id')::bigint;
+    _error_message text := _payload->>'error';
+begin
+    if _send_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_push_attempt_id');
+    end if;
+
+    insert into comms.send_push_attempt_failed (send_push_attempt_id, error_message)
+    values (_send_push_attempt_id, _error_message)
+    on conflict (send_push_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: schedule a push send attempt
+create or replace function comms.schedule_push_attempt(
+    _send_push_task_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _send_push_attempt_id bigint;
+begin
+    insert into comms.send_push_attempt (send_push_task_id)
+    values (_send_push_task_id)
+    returning send_push_attempt_id into _send_push_attempt_id;
+
+    perform queues.enqueue(
+        'push_notification',
+        jsonb_build_object(
+            'task_type', 'push_notification',
+            'send_push_attempt_id', _send_push_attempt_id,
+            'before_handler', 'comms.get_push_notification_payload',
+            'success_handler', 'comms.record_push_notification_success',
+            'error_handler', 'comms.record_push_notification_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- effect: schedule push supervisor recheck with exponential backoff
+create or replace function comms.schedule_push_supervisor_recheck(
+    _send_push_task_id bigint,
+    _num_failures integer,
+    _run_count integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _base_delay_seconds integer := 5;
+    _next_check_at timestamptz;
+begin
+    _next_check_at := now() + (
+        _base_delay_seconds * power(2, _num_failures)
+    ) * interval '1 second';
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_push_supervisor',
+            'send_push_task_id', _send_push_task_id,
+            'run_count', _run_count + 1
+        ),
+        _next_check_at
+    );
+end;
+$$;
+
+-- supervisor: orchestrates push sending using append-only facts
+create or replace function comms.send_push_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_push_task_id bigint := (_payload->>'send_push_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _max_runs integer := 20;
+    _max_attempts integer := 2;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _send_push_task_id is null then
+        return jsonb_build_object('status', 'missing_send_push_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'send_push_supervisor exceeded max runs'
+            using detail = 'Possible infinite loop detected',
+                  hint = format('task_id=%s, run_count=%s', _send_push_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK (before facts)
+    perform 1
+    from comms.send_push_task t
+    where t.send_push_task_id = _send_push_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := comms.send_push_supervisor_facts(_send_push_task_id);
+
+    -- 4. LOGIC + EFFECTS
+    if _facts.has_success then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    if _facts.num_attempts = _facts.num_failures then
+        perform comms.schedule_push_attempt(_send_push_task_id);
+    end if;
+
+    perform comms.schedule_push_supervisor_recheck(
+        _send_push_task_id,
+        _facts.num_failures,
+        _run_count
+    );
+
+    return jsonb_build_object('status', 'scheduled');
+end;
+$$;
+
+create or replace function comms.kickoff_send_push_task(
+    _message_id bigint,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _send_push_task_id bigint;
+begin
+    -- validation
+    if _message_id is null then
+        validation_failure_message := 'missing_message_id';
+        return;
+    end if;
+
+    if not comms.message_exists(_message_id) then
+        validation_failure_message := 'message_not_found';
+        return;
+    end if;
+
+    -- output
+    insert into comms.send_push_task (message_id)
+    values (_message_id)
+    returning send_push_task_id
+    into _send_push_task_id;
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_push_supervisor',
+            'send_push_task_id', _send_push_task_id
+        ),
+        _scheduled_at
+    );
+
+    return;
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_push_notification_task(
+    _account_id bigint,
+    _title text,
+    _body text,
+    _data jsonb default '{}'::jsonb,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_push_message_result record;
+    _kickoff_push_validation_failure_message text;
+begin
+    select (comms.create_push_message(_account_id, _title, _body, _data)).*
+    into strict _create_push_message_result;
+
+    if _create_push_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_push_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_push_task(_create_push_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_push_validation_failure_message;
+
+    if _kickoff_push_validation_failure_message is not null then
+        validation_failure_message := _kickoff_push_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
+
+-- per-function grants to worker_service_user (push)
+grant execute on function comms.kickoff_send_push_task(bigint, timestamp with time zone) to worker_service_user;
+grant execute on function comms.get_push_notification_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_push_notification_success(jsonb) to worker_service_user;
+grant execute on function comms.record_push_notification_failure(jsonb) to worker_service_user;
+grant execute on function comms.schedule_push_attempt(bigint) to worker_service_user;
+grant execute on function comms.schedule_push_supervisor_recheck(bigint, integer, integer) to worker_service_user;
+grant execute on function comms.send_push_supervisor(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification'
+    ));
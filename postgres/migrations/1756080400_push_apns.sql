@@ -0,0 +1,240 @@
+-- push notifications: apns as a second provider
+--
+-- ios apps may register their apns device token instead of an fcm token
+-- (provider 'apns'); the worker sends to those directly through apns, which
+-- makes ios-only options usable. a push message's apns options (push_type,
+-- interruption_level, sound, badge, thread_id, relevance_score, collapse_id,
+-- priority, and live activity event/content_state/...) are kept in
+-- comms.push_message.apns and passed through by the before_handler.
+
+alter table comms.push_device
+    add column provider text not null default 'fcm' check (provider in ('fcm', 'apns'));
+
+alter table comms.push_message add column apns jsonb;
+
+alter table comms.push_message drop constraint push_message_check;
+
+alter table comms.push_message
+    add constraint push_message_check
+    check (title is not null or body is not null or data <> '{}'::jsonb or apns is not null);
+
+drop function comms.create_and_kickoff_push_notification_task(bigint, text, text, jsonb, timestamp with time zone);
+drop function comms.create_push_message(bigint, text, text, jsonb);
+drop function api.register_push_device(text, text);
+drop function comms.get_push_payload_facts(bigint);
+
+create or replace function comms.create_push_message(
+    _account_id bigint,
+    _title text,
+    _body text,
+    _data jsonb default '{}'::jsonb,
+    _apns jsonb default null,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _account_id is null then
+        validation_failure_message := 'account_id_missing';
+        return;
+    end if;
+    if jsonb_typeof(coalesce(_data, '{}'::jsonb)) <> 'object' then
+        validation_failure_message := 'data_not_object';
+        return;
+    end if;
+    if _apns is not null and jsonb_typeof(_apns) <> 'object' then
+        validation_failure_message := 'apns_not_object';
+        return;
+    end if;
+    if _title is null and _body is null and coalesce(_data, '{}'::jsonb) = '{}'::jsonb and _apns is null then
+        validation_failure_message := 'title_body_data_or_apns_missing';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('push')
+    returning message_id
+    into created_message_id;
+
+    -- fcm data values must be strings
+    insert into comms.push_message (message_id, account_id, title, body, data, apns)
+    values (
+        created_message_id,
+        _account_id,
+        _title,
+        _body,
+        coalesce((
+            select jsonb_object_agg(key, case when jsonb_typeof(value) = 'string' then value else to_jsonb(value::text) end)
+            from jsonb_each(_data)
+        ), '{}'::jsonb),
+        _apns
+    );
+    return;
+end;
+$$;
+
+-- api: register (or re-register) a device token for the authenticated account;
+-- provider says whether the token is an fcm registration token or an apns
+-- device token
+create or replace function api.register_push_device(token text, platform text, provider text default 'fcm')
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _device comms.push_device;
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Register Push Device Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_register_push_device';
+    end if;
+
+    if coalesce(register_push_device.token, '') = '' or register_push_device.platform not in ('ios', 'android', 'web')
+        or register_push_device.provider not in ('fcm', 'apns')
+        or (register_push_device.provider = 'apns' and register_push_device.platform <> 'ios') then
+        raise exception 'Register Push Device Failed'
+            using detail = 'Invalid Device',
+                  hint = 'invalid_push_device';
+    end if;
+
+    -- a token moves to whichever account registered it last
+    insert into comms.push_device (account_id, token, platform, provider)
+    values (_authenticated_account_id, register_push_device.token, register_push_device.platform, register_push_device.provider)
+    on conflict on constraint push_device_token_key do update
+    set account_id = excluded.account_id,
+        platform = excluded.platform,
+        provider = excluded.provider,
+        last_registered_at = now(),
+        invalidated_at = null
+    returning * into _device;
+
+    return jsonb_build_object(
+        'push_device_id', _device.push_device_id,
+        'platform', _device.platform,
+        'provider', _device.provider,
+        'last_registered_at', _device.last_registered_at
+    );
+end;
+$$;
+
+grant execute on function api.register_push_device(text, text, text) to authenticated;
+
+-- facts: get push payload facts from attempt_id
+create or replace function comms.get_push_payload_facts(
+    _send_push_attempt_id bigint,
+    out message_id bigint,
+    out account_id bigint,
+    out title text,
+    out body text,
+    out data jsonb,
+    out apns jsonb
+)
+language sql
+stable
+as $$
+    select
+        pm.message_id,
+        pm.account_id,
+        pm.title,
+        pm.body,
+        pm.data,
+        pm.apns
+    from comms.send_push_attempt a
+    join comms.send_push_task t on t.send_push_task_id = a.send_push_task_id
+    join comms.push_message pm on pm.message_id = t.message_id
+    where a.send_push_attempt_id = _send_push_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_push_attempt_id in
+-- payload, with the account's current fcm and apns device tokens
+create or replace function comms.get_push_notification_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_push_attempt_id bigint := (_payload->>'send_push_attempt_id')::bigint;
+    _facts record;
+    _tokens jsonb;
+    _apns_tokens jsonb;
+begin
+    if _send_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_push_attempt_id');
+    end if;
+
+    _facts := comms.get_push_payload_facts(_send_push_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    select
+        jsonb_agg(d.token order by d.last_registered_at desc) filter (where d.provider = 'fcm'),
+        jsonb_agg(d.token order by d.last_registered_at desc) filter (where d.provider = 'apns')
+    into _tokens, _apns_tokens
+    from comms.push_device d
+    where d.account_id = _facts.account_id
+    and d.invalidated_at is null;
+
+    if _tokens is null and _apns_tokens is null then
+        return jsonb_build_object('validation_failure_message', 'no_push_devices');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            'tokens', _tokens,
+            'apns_tokens', _apns_tokens,
+            'title', _facts.title,
+            'body', _facts.body,
+            'data', _facts.data,
+            'apns', _facts.apns
+        ))
+    );
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_push_notification_task(
+    _account_id bigint,
+    _title text,
+    _body text,
+    _data jsonb default '{}'::jsonb,
+    _scheduled_at timestamp with time zone default now(),
+    _apns jsonb default null,
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_push_message_result record;
+    _kickoff_push_validation_failure_message text;
+begin
+    select (comms.create_push_message(_account_id, _title, _body, _data, _apns)).*
+    into strict _create_push_message_result;
+
+    if _create_push_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_push_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_push_task(_create_push_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_push_validation_failure_message;
+
+    if _kickoff_push_validation_failure_message is not null then
+        validation_failure_message := _kickoff_push_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
@@ -0,0 +1,575 @@
+-- web push: browser subscriptions and send process via vapid
+--
+-- the web app subscribes with pushManager.subscribe() using the vapid public
+-- key and stores the subscription with
+-- api.register_web_push_subscription(endpoint, p256dh, auth), dropping it with
+-- api.unregister_web_push_subscription(endpoint). a web push message targets
+-- an account and is delivered to every live subscription of it; endpoints
+-- the push services answer 404/410 for come back to the success handler,
+-- which marks them expired. sending mirrors the push_notification flow.
+
+alter domain comms.channel drop constraint if exists channel_check;
+
+alter domain comms.channel
+    add constraint channel_check
+    check (value in ('email', 'sms', 'discord', 'telegram', 'push', 'web_push'));
+
+-- comms.web_push_subscription: one row per browser push subscription
+create table comms.web_push_subscription (
+    web_push_subscription_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    endpoint text not null unique check (endpoint like 'https://%'),
+    p256dh text not null,
+    auth text not null,
+    created_at timestamp with time zone not null default now(),
+    last_registered_at timestamp with time zone not null default now(),
+    expired_at timestamp with time zone
+);
+
+create index web_push_subscription_account_id_idx on comms.web_push_subscription (account_id) where expired_at is null;
+
+-- web push payload table: data is the json the service worker receives
+create table comms.web_push_message (
+    message_id bigint primary key references comms.message(message_id) on delete cascade,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    data jsonb not null,
+    ttl_seconds integer check (ttl_seconds > 0),
+    urgency text check (urgency in ('very-low', 'low', 'normal', 'high')),
+    topic text
+);
+
+create or replace function comms.create_web_push_message(
+    _account_id bigint,
+    _data jsonb,
+    _ttl_seconds integer default null,
+    _urgency text default null,
+    _topic text default null,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _account_id is null then
+        validation_failure_message := 'account_id_missing';
+        return;
+    end if;
+    if _data is null then
+        validation_failure_message := 'data_missing';
+        return;
+    end if;
+    if _urgency is not null and _urgency not in ('very-low', 'low', 'normal', 'high') then
+        validation_failure_message := 'invalid_urgency';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('web_push')
+    returning message_id
+    into created_message_id;
+
+    insert into comms.web_push_message (message_id, account_id, data, ttl_seconds, urgency, topic)
+    values (created_message_id, _account_id, _data, _ttl_seconds, _urgency, _topic);
+    return;
+end;
+$$;
+
+-- api: store (or refresh) a browser subscription for the authenticated account
+create or replace function api.register_web_push_subscription(endpoint text, p256dh text, auth text)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _subscription comms.web_push_subscription;
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Register Web Push Subscription Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_register_web_push_subscription';
+    end if;
+
+    if coalesce(register_web_push_subscription.endpoint, '') not like 'https://%'
+        or coalesce(register_web_push_subscription.p256dh, '') = ''
+        or coalesce(register_web_push_subscription.auth, '') = '' then
+        raise exception 'Register Web Push Subscription Failed'
+            using detail = 'Invalid Subscription',
+                  hint = 'invalid_web_push_subscription';
+    end if;
+
+    -- an endpoint moves to whichever account registered it last
+    insert into comms.web_push_subscription (account_id, endpoint, p256dh, auth)
+    values (
+        _authenticated_account_id,
+        register_web_push_subscription.endpoint,
+        register_web_push_subscription.p256dh,
+        register_web_push_subscription.auth
+    )
+    on conflict on constraint web_push_subscription_endpoint_key do update
+    set account_id = excluded.account_id,
+        p256dh = excluded.p256dh,
+        auth = excluded.auth,
+        last_registered_at = now(),
+        expired_at = null
+    returning * into _subscription;
+
+    return jsonb_build_object(
+        'web_push_subscription_id', _subscription.web_push_subscription_id,
+        'last_registered_at', _subscription.last_registered_at
+    );
+end;
+$$;
+
+-- api: drop a browser subscription of the authenticated account (idempotent)
+create or replace function api.unregister_web_push_subscription(endpoint text)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Unregister Web Push Subscription Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_unregister_web_push_subscription';
+    end if;
+
+    delete from comms.web_push_subscription s
+    where s.endpoint = unregister_web_push_subscription.endpoint
+    and s.account_id = _authenticated_account_id;
+end;
+$$;
+
+grant execute on function api.register_web_push_subscription(text, text, text) to authenticated;
+grant execute on function api.unregister_web_push_subscription(text) to authenticated;
+
+-- send web push process: task and attempts (append-only)
+create table comms.send_web_push_task (
+    send_web_push_task_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempts (append-only, one per scheduled attempt)
+create table comms.send_web_push_attempt (
+    send_web_push_attempt_id bigserial primary key,
+    send_web_push_task_id bigint not null references comms.send_web_push_task(send_web_push_task_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt succeeded (one per attempt at most), with per-subscription counts
+create table comms.send_web_push_attempt_succeeded (
+    send_web_push_attempt_id bigint primary key references comms.send_web_push_attempt(send_web_push_attempt_id) on delete cascade,
+    sent_count integer not null default 0,
+    expired_subscription_count integer not null default 0,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt failed (one per attempt at most)
+create table comms.send_web_push_attempt_failed (
+    send_web_push_attempt_id bigint primary key references comms.send_web_push_attempt(send_web_push_attempt_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- facts: aggregated facts for send_web_push_supervisor
+create or replace function comms.send_web_push_supervisor_facts(
+    _send_web_push_task_id bigint,
+    out has_success boolean,
+    out num_failures integer,
+    out num_attempts integer
+)
+language sql
+stable
+as $$
+    select
+        exists (
+            select 1
+            from comms.send_web_push_attempt a
+            join comms.send_web_push_attempt_succeeded s on s.send_web_push_attempt_id = a.send_web_push_attempt_id
+            where a.send_web_push_task_id = _send_web_push_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_web_push_attempt a
+            join comms.send_web_push_attempt_failed f on f.send_web_push_attempt_id = a.send_web_push_attempt_id
+            where a.send_web_push_task_id = _send_web_push_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_web_push_attempt a
+            where a.send_web_push_task_id = _send_web_push_task_id
+        );
+$$;
+
+-- facts: get web push payload facts from attempt_id
+create or replace function comms.get_web_push_payload_facts(
+    _send_web_push_attempt_id bigint,
+    out message_id bigint,
+    out account_id bigint,
+    out data jsonb,
+    out ttl_seconds integer,
+    out urgency text,
+    out topic text
+)
+language sql
+stable
+as $$
+    select
+        wm.message_id,
+        wm.account_id,
+        wm.data,
+        wm.ttl_seconds,
+        wm.urgency,
+        wm.topic
+    from comms.send_web_push_attempt a
+    join comms.send_web_push_task t on t.send_web_push_task_id = a.send_web_push_task_id
+    join comms.web_push_message wm on wm.message_id = t.message_id
+    where a.send_web_push_attempt_id = _send_web_push_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_web_push_attempt_id in
+-- payload, with the account's current browser subscriptions
+create or replace function comms.get_web_push_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_web_push_attempt_id bigint := (_payload->>'send_web_push_attempt_id')::bigint;
+    _facts record;
+    _subscriptions jsonb;
+begin
+    if _send_web_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_web_push_attempt_id');
+    end if;
+
+    _facts := comms.get_web_push_payload_facts(_send_web_push_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    select jsonb_agg(
+        jsonb_build_object(
+            'endpoint', s.endpoint,
+            'keys', jsonb_build_object('p256dh', s.p256dh, 'auth', s.auth)
+        )
+        order by s.last_registered_at desc
+    )
+    into _subscriptions
+    from comms.web_push_subscription s
+    where s.account_id = _facts.account_id
+    and s.expired_at is null;
+
+    if _subscriptions is null then
+        return jsonb_build_object('validation_failure_message', 'no_web_push_subscriptions');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            'subscriptions', _subscriptions,
+            'data', _facts.data,
+            'ttl_seconds', _facts.ttl_seconds,
+            'urgency', _facts.urgency,
+            'topic', _facts.topic
+        ))
+    );
+end;
+$$;
+
+-- success handler: record success fact and expire the subscriptions the
+-- push services answered 404/410 for
+-- receives: { original_payload: { send_web_push_attempt_id, ... }, worker_payload: { sent, expired_subscriptions, ... } }
+create or replace function comms.record_web_push_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_web_push_attempt_id bigint := (_payload->'original_payload'->>'send_web_push_attempt_id')::bigint;
+    _expired jsonb := coalesce(_payload->'worker_payload'->'expired_subscriptions', '[]'::jsonb);
+begin
+    if _send_web_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_web_push_attempt_id');
+    end if;
+
+    insert into comms.send_web_push_attempt_succeeded (send_web_push_attempt_id, sent_count, expired_subscription_count)
+    values (
+        _send_web_push_attempt_id,
+        coalesce((_payload->'worker_payload'->>'sent')::integer, 0),
+        jsonb_array_length(_expired)
+    )
+    on conflict (send_web_push_attempt_id) do nothing;
+
+    update comms.web_push_subscription s
+    set expired_at = now()
+    where s.endpoint in (select jsonb_array_elements_text(_expired))
+    and s.expired_at is null;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record failure fact
+-- receives: { original_payload: { send_web_push_attempt_id, ... }, error: "..." }
+create or replace function comms.record_web_push_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_web_push_attempt_id bigint := (_payload->'original_payload'->>'send_web_push_attempt_id')::bigint;
+    _error_message text := _payload->>'error';
+begin
+    if _send_web_push_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_web_push_attempt_id');
+    end if;
+
+    insert into comms.send_web_push_attempt_failed (send_web_push_attempt_id, error_message)
+    values (_send_web_push_attempt_id, _error_message)
+    on conflict (send_web_push_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: schedule a web push send attempt
+create or replace function comms.schedule_web_push_attempt(
+    _send_web_push_task_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _send_web_push_attempt_id bigint;
+begin
+    insert into comms.send_web_push_attempt (send_web_push_task_id)
+    values (_send_web_push_task_id)
+    returning send_web_push_attempt_id into _send_web_push_attempt_id;
+
+    perform queues.enqueue(
+        'web_push',
+        jsonb_build_object(
+            'task_type', 'web_push',
+            'send_web_push_attempt_id', _send_web_push_attempt_id,
+            'before_handler', 'comms.get_web_push_payload',
+            'success_handler', 'comms.record_web_push_success',
+            'error_handler', 'comms.record_web_push_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- effect: schedule web push supervisor recheck with exponential backoff
+create or replace function comms.schedule_web_push_supervisor_recheck(
+    _send_web_push_task_id bigint,
+    _num_failures integer,
+    _run_count integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _base_delay_seconds integer := 5;
+    _next_check_at timestamptz;
+begin
+    _next_check_at := now() + (
+        _base_delay_seconds * power(2, _num_failures)
+    ) * interval '1 second';
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_web_push_supervisor',
+            'send_web_push_task_id', _send_web_push_task_id,
+            'run_count', _run_count + 1
+        ),
+        _next_check_at
+    );
+end;
+$$;
+
+-- supervisor: orchestrates web push sending using append-only facts
+create or replace function comms.send_web_push_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_web_push_task_id bigint := (_payload->>'send_web_push_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _max_runs integer := 20;
+    _max_attempts integer := 2;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _send_web_push_task_id is null then
+        return jsonb_build_object('status', 'missing_send_web_push_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'send_web_push_supervisor exceeded max runs'
+            using detail = 'Possible infinite loop detected',
+                  hint = format('task_id=%s, run_count=%s', _send_web_push_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK (before facts)
+    perform 1
+    from comms.send_web_push_task t
+    where t.send_web_push_task_id = _send_web_push_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := comms.send_web_push_supervisor_facts(_send_web_push_task_id);
+
+    -- 4. LOGIC + EFFECTS
+    if _facts.has_success then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    if _facts.num_attempts = _facts.num_failures then
+        perform comms.schedule_web_push_attempt(_send_web_push_task_id);
+    end if;
+
+    perform comms.schedule_web_push_supervisor_recheck(
+        _send_web_push_task_id,
+        _facts.num_failures,
+        _run_count
+    );
+
+    return jsonb_build_object('status', 'scheduled');
+end;
+$$;
+
+create or replace function comms.kickoff_send_web_push_task(
+    _message_id bigint,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _send_web_push_task_id bigint;
+begin
+    -- validation
+    if _message_id is null then
+        validation_failure_message := 'missing_message_id';
+        return;
+    end if;
+
+    if not comms.message_exists(_message_id) then
+        validation_failure_message := 'message_not_found';
+        return;
+    end if;
+
+    -- output
+    insert into comms.send_web_push_task (message_id)
+    values (_message_id)
+    returning send_web_push_task_id
+    into _send_web_push_task_id;
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_web_push_supervisor',
+            'send_web_push_task_id', _send_web_push_task_id
+        ),
+        _scheduled_at
+    );
+
+    return;
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_web_push_task(
+    _account_id bigint,
+    _data jsonb,
+    _ttl_seconds integer default null,
+    _urgency text default null,
+    _topic text default null,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_web_push_message_result record;
+    _kickoff_web_push_validation_failure_message text;
+begin
+    select (comms.create_web_push_message(_account_id, _data, _ttl_seconds, _urgency, _topic)).*
+    into strict _create_web_push_message_result;
+
+    if _create_web_push_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_web_push_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_web_push_task(_create_web_push_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_web_push_validation_failure_message;
+
+    if _kickoff_web_push_validation_failure_message is not null then
+        validation_failure_message := _kickoff_web_push_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
+
+-- per-function grants to worker_service_user (web push)
+grant execute on function comms.kickoff_send_web_push_task(bigint, timestamp with time zone) to worker_service_user;
+grant execute on function comms.get_web_push_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_web_push_success(jsonb) to worker_service_user;
+grant execute on function comms.record_web_push_failure(jsonb) to worker_service_user;
+grant execute on function comms.schedule_web_push_attempt(bigint) to worker_service_user;
+grant execute on function comms.schedule_web_push_supervisor_recheck(bigint, integer, integer) to worker_service_user;
+grant execute on function comms.send_web_push_supervisor(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push'
+    ));
@@ -0,0 +1,42 @@
+-- sms via twilio: keep the provider's message sid and status
+--
+-- the worker now sends sms through twilio's messages api and returns
+-- { message_id: <twilio sid>, status } to the success handler. the sid is
+-- stored on the attempt's success fact so later delivery updates from twilio
+-- can be matched to the message.
+
+alter table comms.send_sms_attempt_succeeded
+    add column provider_message_id text,
+    add column provider_status text;
+
+create index send_sms_attempt_succeeded_provider_message_id_idx
+    on comms.send_sms_attempt_succeeded (provider_message_id)
+    where provider_message_id is not null;
+
+-- success handler: record success fact with twilio's sid and status
+-- receives: { original_payload: { send_sms_attempt_id, ... }, worker_payload: { message_id, status } }
+create or replace function comms.record_sms_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_sms_attempt_id bigint := (_payload->'original_payload'->>'send_sms_attempt_id')::bigint;
+begin
+    if _send_sms_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_sms_attempt_id');
+    end if;
+
+    insert into comms.send_sms_attempt_succeeded (send_sms_attempt_id, provider_message_id, provider_status)
+    values (
+        _send_sms_attempt_id,
+        _payload->'worker_payload'->>'message_id',
+        _payload->'worker_payload'->>'status'
+    )
+    on conflict (send_sms_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
@@ -0,0 +1,39 @@
+-- sms provider failover: record which provider sent each message
+--
+-- the worker sends sms through a primary provider and, when that fails
+-- transiently, a fallback (WORKER_SMS_PROVIDER / WORKER_SMS_FALLBACK_PROVIDER).
+-- the success handler now receives { provider, message_id, status } and keeps
+-- the provider next to its message id.
+
+alter table comms.send_sms_attempt_succeeded
+    add column provider text;
+
+-- success handler: record success fact with the sending provider, its
+-- message id and status
+-- receives: { original_payload: { send_sms_attempt_id, ... }, worker_payload: { provider, message_id, status } }
+create or replace function comms.record_sms_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_sms_attempt_id bigint := (_payload->'original_payload'->>'send_sms_attempt_id')::bigint;
+begin
+    if _send_sms_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_sms_attempt_id');
+    end if;
+
+    insert into comms.send_sms_attempt_succeeded (send_sms_attempt_id, provider, provider_message_id, provider_status)
+    values (
+        _send_sms_attempt_id,
+        _payload->'worker_payload'->>'provider',
+        _payload->'worker_payload'->>'message_id',
+        _payload->'worker_payload'->>'status'
+    )
+    on conflict (send_sms_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
@@ -0,0 +1,92 @@
+-- sms delivery status: record what the carrier reported after sending
+--
+-- twilio posts status callbacks to the worker (POST /webhooks/twilio/sms-status)
+-- as a message moves on after acceptance. the worker verifies the signature
+-- and passes delivered, failed and undelivered events to
+-- comms.record_sms_delivery_status, keyed by the provider message id stored on
+-- comms.send_sms_attempt_succeeded.
+
+-- delivery status reports (append-only, one per callback)
+create table comms.sms_delivery_status (
+    sms_delivery_status_id bigserial primary key,
+    send_sms_attempt_id bigint not null references comms.send_sms_attempt(send_sms_attempt_id) on delete cascade,
+    status text not null,
+    error_code text,
+    error_message text,
+    created_at timestamp with time zone not null default now(),
+    constraint sms_delivery_status_status_check check (status in ('delivered', 'failed', 'undelivered'))
+);
+
+create index sms_delivery_status_send_sms_attempt_id_idx
+    on comms.sms_delivery_status (send_sms_attempt_id, created_at desc);
+
+-- record a delivery status reported by the provider
+-- receives: { provider, message_id, status, error_code, error_message }
+create or replace function comms.record_sms_delivery_status(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _provider_message_id text := _payload->>'message_id';
+    _status text := _payload->>'status';
+    _send_sms_attempt_id bigint;
+begin
+    if _provider_message_id is null then
+        return jsonb_build_object('status', 'missing_message_id');
+    end if;
+
+    if _status is null or _status not in ('delivered', 'failed', 'undelivered') then
+        return jsonb_build_object('status', 'invalid_status');
+    end if;
+
+    select s.send_sms_attempt_id
+    into _send_sms_attempt_id
+    from comms.send_sms_attempt_succeeded s
+    where s.provider_message_id = _provider_message_id
+      and (_payload->>'provider' is null or s.provider is null or s.provider = _payload->>'provider')
+    order by s.created_at desc
+    limit 1;
+
+    if _send_sms_attempt_id is null then
+        return jsonb_build_object('status', 'unknown_message');
+    end if;
+
+    insert into comms.sms_delivery_status (send_sms_attempt_id, status, error_code, error_message)
+    values (
+        _send_sms_attempt_id,
+        _status,
+        nullif(_payload->>'error_code', ''),
+        nullif(_payload->>'error_message', '')
+    );
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- latest delivery status of an sms message, or null when none was reported
+create or replace function comms.get_sms_delivery_status(
+    _message_id bigint
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select jsonb_build_object(
+        'status', d.status,
+        'error_code', d.error_code,
+        'error_message', d.error_message,
+        'reported_at', d.created_at
+    )
+    from comms.sms_delivery_status d
+    join comms.send_sms_attempt a on a.send_sms_attempt_id = d.send_sms_attempt_id
+    join comms.send_sms_task t on t.send_sms_task_id = a.send_sms_task_id
+    where t.message_id = _message_id
+    order by d.created_at desc, d.sms_delivery_status_id desc
+    limit 1;
+$$;
+
+grant execute on function comms.record_sms_delivery_status(jsonb) to worker_service_user;
@@ -0,0 +1,101 @@
+-- sms opt-out: suppress sends to numbers that replied STOP
+--
+-- before sending, the sms processor calls comms.check_sms_suppression with the
+-- normalized (e.164) recipient and skips the send when it is suppressed, which
+-- the success handler records with provider_status 'suppressed'. carrier
+-- STOP/START replies reach comms.record_sms_opt_out through the worker's
+-- twilio inbound route (POST /webhooks/twilio/sms-inbound).
+
+-- opt-out and opt-in events per number (append-only); the latest decides
+create table comms.sms_opt_out_event (
+    sms_opt_out_event_id bigserial primary key,
+    phone_number text not null,
+    action text not null,
+    source text not null,
+    keyword text,
+    created_at timestamp with time zone not null default now(),
+    constraint sms_opt_out_event_action_check check (action in ('opt_out', 'opt_in')),
+    constraint sms_opt_out_event_phone_number_check check (phone_number ~ '^\+[1-9][0-9]{6,14}$')
+);
+
+create index sms_opt_out_event_phone_number_idx
+    on comms.sms_opt_out_event (phone_number, created_at desc, sms_opt_out_event_id desc);
+
+-- whether sms to a number is suppressed: its latest event is an opt-out
+create or replace function comms.sms_number_suppressed(
+    _phone_number text
+)
+returns boolean
+language sql
+stable
+security definer
+as $$
+    select coalesce((
+        select e.action = 'opt_out'
+        from comms.sms_opt_out_event e
+        where e.phone_number = _phone_number
+        order by e.created_at desc, e.sms_opt_out_event_id desc
+        limit 1
+    ), false);
+$$;
+
+-- suppression check called by the sms processor before sending
+-- receives: { message_id, to_number }
+-- returns: { status: 'succeeded', payload: { suppressed } }
+create or replace function comms.check_sms_suppression(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _to_number text := _payload->>'to_number';
+begin
+    if _to_number is null then
+        return jsonb_build_object('status', 'missing_to_number');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object('suppressed', comms.sms_number_suppressed(_to_number))
+    );
+end;
+$$;
+
+-- record an opt-out or opt-in
+-- receives: { phone_number, action: 'opt_out' | 'opt_in', source, keyword }
+create or replace function comms.record_sms_opt_out(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _phone_number text := _payload->>'phone_number';
+    _action text := _payload->>'action';
+begin
+    if _phone_number is null or _phone_number !~ '^\+[1-9][0-9]{6,14}$' then
+        return jsonb_build_object('status', 'invalid_phone_number');
+    end if;
+
+    if _action is null or _action not in ('opt_out', 'opt_in') then
+        return jsonb_build_object('status', 'invalid_action');
+    end if;
+
+    insert into comms.sms_opt_out_event (phone_number, action, source, keyword)
+    values (
+        _phone_number,
+        _action,
+        coalesce(_payload->>'source', 'unknown'),
+        nullif(_payload->>'keyword', '')
+    );
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+grant execute on function comms.check_sms_suppression(jsonb) to worker_service_user;
+grant execute on function comms.record_sms_opt_out(jsonb) to worker_service_user;
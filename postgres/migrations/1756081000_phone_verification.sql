@@ -0,0 +1,496 @@
+-- phone verification: one-time codes sent and checked by twilio verify
+--
+-- twilio verify generates, sends and expires the codes, so none are stored
+-- here beyond the check that carries the code the user entered (cleared once
+-- checked). api.start_phone_verification(phone_number, channel) enqueues a
+-- verify_otp_send task whose success handler records the verification sid;
+-- api.check_phone_verification(phone_verification_id, code) enqueues a
+-- verify_otp_check task, and api.get_phone_verification_check returns its
+-- outcome once the worker has checked the code. both tasks run in the
+-- interactive pool, as a user is waiting on them.
+
+-- phone verifications (append-only)
+create table comms.phone_verification (
+    phone_verification_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    phone_number text not null,
+    channel text not null default 'sms',
+    locale text,
+    created_at timestamp with time zone not null default now(),
+    constraint phone_verification_phone_number_check check (phone_number ~ '^\+[1-9][0-9]{6,14}$'),
+    constraint phone_verification_channel_check check (channel in ('sms', 'call', 'whatsapp'))
+);
+
+create index phone_verification_account_id_idx on comms.phone_verification (account_id, created_at desc);
+
+-- verification started: twilio sent the code (one per verification at most)
+create table comms.phone_verification_sent (
+    phone_verification_id bigint primary key references comms.phone_verification(phone_verification_id) on delete cascade,
+    verification_sid text not null,
+    status text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- failed send attempts (append-only)
+create table comms.phone_verification_send_failed (
+    phone_verification_send_failed_id bigserial primary key,
+    phone_verification_id bigint not null references comms.phone_verification(phone_verification_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- code checks; code is cleared once the check has an outcome
+create table comms.phone_verification_check (
+    phone_verification_check_id bigserial primary key,
+    phone_verification_id bigint not null references comms.phone_verification(phone_verification_id) on delete cascade,
+    code text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- check outcome reported by twilio (one per check at most)
+create table comms.phone_verification_check_result (
+    phone_verification_check_id bigint primary key references comms.phone_verification_check(phone_verification_check_id) on delete cascade,
+    status text not null,
+    valid boolean not null,
+    created_at timestamp with time zone not null default now()
+);
+
+-- failed check attempts (append-only)
+create table comms.phone_verification_check_failed (
+    phone_verification_check_failed_id bigserial primary key,
+    phone_verification_check_id bigint not null references comms.phone_verification_check(phone_verification_check_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- effect: create a verification and enqueue its verify_otp_send task
+create or replace function comms.start_phone_verification(
+    _account_id bigint,
+    _phone_number text,
+    _channel text default 'sms',
+    _locale text default null,
+    out validation_failure_message text,
+    out phone_verification_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _account_id is null then
+        validation_failure_message := 'account_id_missing';
+        return;
+    end if;
+    if _phone_number is null or _phone_number !~ '^\+[1-9][0-9]{6,14}$' then
+        validation_failure_message := 'invalid_phone_number';
+        return;
+    end if;
+    if coalesce(_channel, 'sms') not in ('sms', 'call', 'whatsapp') then
+        validation_failure_message := 'invalid_channel';
+        return;
+    end if;
+
+    insert into comms.phone_verification (account_id, phone_number, channel, locale)
+    values (_account_id, _phone_number, coalesce(_channel, 'sms'), _locale)
+    returning comms.phone_verification.phone_verification_id
+    into start_phone_verification.phone_verification_id;
+
+    perform queues.enqueue(
+        'verify_otp_send',
+        jsonb_build_object(
+            'task_type', 'verify_otp_send',
+            'phone_verification_id', start_phone_verification.phone_verification_id,
+            'priority', 'interactive',
+            'before_handler', 'comms.get_verify_otp_send_payload',
+            'success_handler', 'comms.record_verify_otp_send_success',
+            'error_handler', 'comms.record_verify_otp_send_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- before handler: build the verify_otp_send payload
+-- receives: { phone_verification_id, ... }
+create or replace function comms.get_verify_otp_send_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _phone_verification_id bigint := (_payload->>'phone_verification_id')::bigint;
+    _verification comms.phone_verification;
+begin
+    if _phone_verification_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_id');
+    end if;
+
+    select v.*
+    into _verification
+    from comms.phone_verification v
+    where v.phone_verification_id = _phone_verification_id;
+
+    if _verification.phone_verification_id is null then
+        return jsonb_build_object('validation_failure_message', 'phone_verification_not_found');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'verification_id', _verification.phone_verification_id,
+            'to_number', _verification.phone_number,
+            'channel', _verification.channel,
+            'locale', _verification.locale
+        ))
+    );
+end;
+$$;
+
+-- success handler: record the verification sid twilio returned
+-- receives: { original_payload: { phone_verification_id, ... }, worker_payload: { verification_sid, status, channel } }
+create or replace function comms.record_verify_otp_send_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _phone_verification_id bigint := (_payload->'original_payload'->>'phone_verification_id')::bigint;
+begin
+    if _phone_verification_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_id');
+    end if;
+
+    insert into comms.phone_verification_sent (phone_verification_id, verification_sid, status)
+    values (
+        _phone_verification_id,
+        _payload->'worker_payload'->>'verification_sid',
+        _payload->'worker_payload'->>'status'
+    )
+    on conflict (phone_verification_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record a failed send attempt
+create or replace function comms.record_verify_otp_send_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _phone_verification_id bigint := (_payload->'original_payload'->>'phone_verification_id')::bigint;
+begin
+    if _phone_verification_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_id');
+    end if;
+
+    insert into comms.phone_verification_send_failed (phone_verification_id, error_message)
+    values (_phone_verification_id, _payload->>'error');
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: store a code to check and enqueue its verify_otp_check task
+create or replace function comms.check_phone_verification(
+    _phone_verification_id bigint,
+    _code text,
+    out validation_failure_message text,
+    out phone_verification_check_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if nullif(btrim(_code), '') is null then
+        validation_failure_message := 'code_missing';
+        return;
+    end if;
+
+    if not exists (
+        select 1
+        from comms.phone_verification_sent s
+        where s.phone_verification_id = _phone_verification_id
+    ) then
+        validation_failure_message := 'phone_verification_not_sent';
+        return;
+    end if;
+
+    insert into comms.phone_verification_check (phone_verification_id, code)
+    values (_phone_verification_id, btrim(_code))
+    returning comms.phone_verification_check.phone_verification_check_id
+    into check_phone_verification.phone_verification_check_id;
+
+    perform queues.enqueue(
+        'verify_otp_check',
+        jsonb_build_object(
+            'task_type', 'verify_otp_check',
+            'phone_verification_check_id', check_phone_verification.phone_verification_check_id,
+            'priority', 'interactive',
+            'before_handler', 'comms.get_verify_otp_check_payload',
+            'success_handler', 'comms.record_verify_otp_check_success',
+            'error_handler', 'comms.record_verify_otp_check_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- before handler: build the verify_otp_check payload
+-- receives: { phone_verification_check_id, ... }
+create or replace function comms.get_verify_otp_check_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _phone_verification_check_id bigint := (_payload->>'phone_verification_check_id')::bigint;
+    _facts record;
+begin
+    if _phone_verification_check_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_check_id');
+    end if;
+
+    select
+        c.phone_verification_id,
+        c.code,
+        v.phone_number,
+        s.verification_sid
+    into _facts
+    from comms.phone_verification_check c
+    join comms.phone_verification v on v.phone_verification_id = c.phone_verification_id
+    join comms.phone_verification_sent s on s.phone_verification_id = c.phone_verification_id
+    where c.phone_verification_check_id = _phone_verification_check_id;
+
+    if _facts.phone_verification_id is null then
+        return jsonb_build_object('validation_failure_message', 'phone_verification_check_not_found');
+    end if;
+
+    if _facts.code is null then
+        return jsonb_build_object('validation_failure_message', 'phone_verification_check_already_completed');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'verification_id', _facts.phone_verification_id,
+            'verification_sid', _facts.verification_sid,
+            'to_number', _facts.phone_number,
+            'code', _facts.code
+        )
+    );
+end;
+$$;
+
+-- success handler: record the check outcome and clear the code
+-- receives: { original_payload: { phone_verification_check_id, ... }, worker_payload: { verification_sid, status, valid } }
+create or replace function comms.record_verify_otp_check_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _phone_verification_check_id bigint := (_payload->'original_payload'->>'phone_verification_check_id')::bigint;
+begin
+    if _phone_verification_check_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_check_id');
+    end if;
+
+    insert into comms.phone_verification_check_result (phone_verification_check_id, status, valid)
+    values (
+        _phone_verification_check_id,
+        coalesce(_payload->'worker_payload'->>'status', 'unknown'),
+        coalesce((_payload->'worker_payload'->>'valid')::boolean, false)
+    )
+    on conflict (phone_verification_check_id) do nothing;
+
+    update comms.phone_verification_check
+    set code = null
+    where phone_verification_check_id = _phone_verification_check_id;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record a failed check attempt; the code is cleared once the
+-- worker gives up (last attempt or rejected input)
+create or replace function comms.record_verify_otp_check_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _phone_verification_check_id bigint := (_payload->'original_payload'->>'phone_verification_check_id')::bigint;
+    _attempt integer := coalesce((_payload->>'attempt')::integer, 0);
+    _max_attempts integer := coalesce((_payload->>'max_attempts')::integer, 0);
+begin
+    if _phone_verification_check_id is null then
+        return jsonb_build_object('status', 'missing_phone_verification_check_id');
+    end if;
+
+    insert into comms.phone_verification_check_failed (phone_verification_check_id, error_message)
+    values (_phone_verification_check_id, _payload->>'error');
+
+    if _attempt >= _max_attempts or _payload->>'error_class' = 'permanent' then
+        update comms.phone_verification_check
+        set code = null
+        where phone_verification_check_id = _phone_verification_check_id;
+    end if;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- api: send a verification code to a phone number for the authenticated account
+create or replace function api.start_phone_verification(phone_number text, channel text default 'sms')
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _result record;
+begin
+    if _authenticated_account_id is null then
+        raise exception 'Start Phone Verification Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_start_phone_verification';
+    end if;
+
+    _result := comms.start_phone_verification(
+        _authenticated_account_id,
+        start_phone_verification.phone_number,
+        start_phone_verification.channel
+    );
+
+    if _result.validation_failure_message is not null then
+        raise exception 'Start Phone Verification Failed'
+            using detail = 'Invalid Request',
+                  hint = _result.validation_failure_message;
+    end if;
+
+    return jsonb_build_object('phone_verification_id', _result.phone_verification_id);
+end;
+$$;
+
+-- api: check a code the authenticated account received
+create or replace function api.check_phone_verification(phone_verification_id bigint, code text)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _result record;
+begin
+    if _authenticated_account_id is null
+        or not exists (
+            select 1
+            from comms.phone_verification v
+            where v.phone_verification_id = check_phone_verification.phone_verification_id
+            and v.account_id = _authenticated_account_id
+        ) then
+        raise exception 'Check Phone Verification Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_check_phone_verification';
+    end if;
+
+    _result := comms.check_phone_verification(
+        check_phone_verification.phone_verification_id,
+        check_phone_verification.code
+    );
+
+    if _result.validation_failure_message is not null then
+        raise exception 'Check Phone Verification Failed'
+            using detail = 'Invalid Request',
+                  hint = _result.validation_failure_message;
+    end if;
+
+    return jsonb_build_object('phone_verification_check_id', _result.phone_verification_check_id);
+end;
+$$;
+
+-- api: outcome of a code check; status is checking until the worker reports,
+-- failed when it gave up
+create or replace function api.get_phone_verification_check(phone_verification_check_id bigint)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _facts record;
+begin
+    select
+        c.code,
+        r.status,
+        r.valid
+    into _facts
+    from comms.phone_verification_check c
+    join comms.phone_verification v on v.phone_verification_id = c.phone_verification_id
+    left join comms.phone_verification_check_result r on r.phone_verification_check_id = c.phone_verification_check_id
+    where c.phone_verification_check_id = get_phone_verification_check.phone_verification_check_id
+    and v.account_id = _authenticated_account_id;
+
+    if not found then
+        raise exception 'Get Phone Verification Check Failed'
+            using detail = 'Not Found',
+                  hint = 'phone_verification_check_not_found';
+    end if;
+
+    return jsonb_build_object(
+        'status', coalesce(_facts.status, case when _facts.code is null then 'failed' else 'checking' end),
+        'valid', coalesce(_facts.valid, false)
+    );
+end;
+$$;
+
+grant execute on function api.start_phone_verification(text, text) to authenticated;
+grant execute on function api.check_phone_verification(bigint, text) to authenticated;
+grant execute on function api.get_phone_verification_check(bigint) to authenticated;
+
+-- per-function grants to worker_service_user (phone verification)
+grant execute on function comms.get_verify_otp_send_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_verify_otp_send_success(jsonb) to worker_service_user;
+grant execute on function comms.record_verify_otp_send_failure(jsonb) to worker_service_user;
+grant execute on function comms.get_verify_otp_check_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_verify_otp_check_success(jsonb) to worker_service_user;
+grant execute on function comms.record_verify_otp_check_failure(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check'
+    ));
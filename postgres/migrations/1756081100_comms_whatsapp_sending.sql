@@ -0,0 +1,498 @@
+-- send whatsapp message process: mirrors sms/email/telegram sending
+--
+-- whatsapp messages go out through the whatsapp business cloud api with the
+-- worker's WHATSAPP_ACCESS_TOKEN, from WHATSAPP_PHONE_NUMBER_ID. outside a
+-- 24-hour customer service window whatsapp only delivers approved templates,
+-- so every message names a template, its language, and the text parameters
+-- for the template's header and body placeholders, e.g.
+--
+--   comms.create_and_kickoff_whatsapp_message_task(
+--       '+4915112345678', 'order_shipped', 'de', _body_parameters => '["Anna", "A-1042"]'
+--   )
+--
+-- then runs the usual supervisor: one whatsapp_message task per attempt. the
+-- before_handler passes the parameters through as they were stored, so flows
+-- that need media headers or button parameters store the cloud api
+-- components array instead. the success handler records whatsapp's message
+-- id (wamid).
+
+alter domain comms.channel drop constraint if exists channel_check;
+
+alter domain comms.channel
+    add constraint channel_check
+    check (value in ('email', 'sms', 'discord', 'telegram', 'push', 'web_push', 'whatsapp'));
+
+-- whatsapp payload table: parameters are jsonb arrays of strings; components,
+-- when set, replaces them
+create table comms.whatsapp_message (
+    message_id bigint primary key references comms.message(message_id) on delete cascade,
+    to_number text not null,
+    template_name text not null,
+    language_code text not null,
+    header_parameters jsonb not null default '[]'::jsonb,
+    body_parameters jsonb not null default '[]'::jsonb,
+    components jsonb,
+    constraint whatsapp_message_to_number_check check (to_number ~ '^\+[1-9][0-9]{6,14}$'),
+    check (jsonb_typeof(header_parameters) = 'array'),
+    check (jsonb_typeof(body_parameters) = 'array'),
+    check (components is null or jsonb_typeof(components) = 'array')
+);
+
+-- _to_number is an e.164 number
+create or replace function comms.create_whatsapp_message(
+    _to_number text,
+    _template_name text,
+    _language_code text,
+    _header_parameters jsonb default '[]'::jsonb,
+    _body_parameters jsonb default '[]'::jsonb,
+    _components jsonb default null,
+    out validation_failure_message text,
+    out created_message_id bigint
+)
+language plpgsql
+security definer
+as $$
+begin
+    if _to_number is null or _to_number !~ '^\+[1-9][0-9]{6,14}$' then
+        validation_failure_message := 'to_number_invalid';
+        return;
+    end if;
+    if _template_name is null or _template_name = '' then
+        validation_failure_message := 'template_name_missing';
+        return;
+    end if;
+    if _language_code is null or _language_code = '' then
+        validation_failure_message := 'language_code_missing';
+        return;
+    end if;
+    if jsonb_typeof(coalesce(_header_parameters, '[]'::jsonb)) <> 'array'
+        or jsonb_typeof(coalesce(_body_parameters, '[]'::jsonb)) <> 'array'
+        or (_components is not null and jsonb_typeof(_components) <> 'array') then
+        validation_failure_message := 'parameters_invalid';
+        return;
+    end if;
+
+    insert into comms.message (channel)
+    values ('whatsapp')
+    returning message_id
+    into created_message_id;
+
+    insert into comms.whatsapp_message (message_id, to_number, template_name, language_code, header_parameters, body_parameters, components)
+    values (
+        created_message_id,
+        _to_number,
+        _template_name,
+        _language_code,
+        coalesce(_header_parameters, '[]'::jsonb),
+        coalesce(_body_parameters, '[]'::jsonb),
+        _components
+    );
+    return;
+end;
+$$;
+
+-- send whatsapp process: task and attempts (append-only)
+create table comms.send_whatsapp_task (
+    send_whatsapp_task_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempts (append-only, one per scheduled attempt)
+create table comms.send_whatsapp_attempt (
+    send_whatsapp_attempt_id bigserial primary key,
+    send_whatsapp_task_id bigint not null references comms.send_whatsapp_task(send_whatsapp_task_id) on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt succeeded (one per attempt at most), with whatsapp's message id
+create table comms.send_whatsapp_attempt_succeeded (
+    send_whatsapp_attempt_id bigint primary key references comms.send_whatsapp_attempt(send_whatsapp_attempt_id) on delete cascade,
+    whatsapp_message_id text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- attempt failed (one per attempt at most)
+create table comms.send_whatsapp_attempt_failed (
+    send_whatsapp_attempt_id bigint primary key references comms.send_whatsapp_attempt(send_whatsapp_attempt_id) on delete cascade,
+    error_message text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- facts: aggregated facts for send_whatsapp_supervisor
+create or replace function comms.send_whatsapp_supervisor_facts(
+    _send_whatsapp_task_id bigint,
+    out has_success boolean,
+    out num_failures integer,
+    out num_attempts integer
+)
+language sql
+stable
+as $$
+    select
+        exists (
+            select 1
+            from comms.send_whatsapp_attempt a
+            join comms.send_whatsapp_attempt_succeeded s on s.send_whatsapp_attempt_id = a.send_whatsapp_attempt_id
+            where a.send_whatsapp_task_id = _send_whatsapp_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_whatsapp_attempt a
+            join comms.send_whatsapp_attempt_failed f on f.send_whatsapp_attempt_id = a.send_whatsapp_attempt_id
+            where a.send_whatsapp_task_id = _send_whatsapp_task_id
+        ),
+        (
+            select count(*)::integer
+            from comms.send_whatsapp_attempt a
+            where a.send_whatsapp_task_id = _send_whatsapp_task_id
+        );
+$$;
+
+-- facts: get whatsapp payload facts from attempt_id
+create or replace function comms.get_whatsapp_payload_facts(
+    _send_whatsapp_attempt_id bigint,
+    out message_id bigint,
+    out to_number text,
+    out template_name text,
+    out language_code text,
+    out header_parameters jsonb,
+    out body_parameters jsonb,
+    out components jsonb
+)
+language sql
+stable
+as $$
+    select
+        wm.message_id,
+        wm.to_number,
+        wm.template_name,
+        wm.language_code,
+        wm.header_parameters,
+        wm.body_parameters,
+        wm.components
+    from comms.send_whatsapp_attempt a
+    join comms.send_whatsapp_task t on t.send_whatsapp_task_id = a.send_whatsapp_task_id
+    join comms.whatsapp_message wm on wm.message_id = t.message_id
+    where a.send_whatsapp_attempt_id = _send_whatsapp_attempt_id;
+$$;
+
+-- before handler: build provider payload from send_whatsapp_attempt_id in
+-- payload
+create or replace function comms.get_whatsapp_message_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_whatsapp_attempt_id bigint := (_payload->>'send_whatsapp_attempt_id')::bigint;
+    _facts record;
+begin
+    if _send_whatsapp_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_whatsapp_attempt_id');
+    end if;
+
+    _facts := comms.get_whatsapp_payload_facts(_send_whatsapp_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'attempt_not_found');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'message_id', _facts.message_id,
+            'to_number', _facts.to_number,
+            'template', _facts.template_name,
+            'language', _facts.language_code,
+            'header_parameters', _facts.header_parameters,
+            'body_parameters', _facts.body_parameters,
+            'components', _facts.components
+        ))
+    );
+end;
+$$;
+
+-- success handler: record success fact with whatsapp's message id
+-- receives: { original_payload: { send_whatsapp_attempt_id, ... }, worker_payload: { whatsapp_message_id, wa_id, status } }
+create or replace function comms.record_whatsapp_message_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_whatsapp_attempt_id bigint := (_payload->'original_payload'->>'send_whatsapp_attempt_id')::bigint;
+begin
+    if _send_whatsapp_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_whatsapp_attempt_id');
+    end if;
+
+    insert into comms.send_whatsapp_attempt_succeeded (send_whatsapp_attempt_id, whatsapp_message_id)
+    values (_send_whatsapp_attempt_id, _payload->'worker_payload'->>'whatsapp_message_id')
+    on conflict (send_whatsapp_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- error handler: record failure fact
+-- receives: { original_payload: { send_whatsapp_attempt_id, ... }, error: "..." }
+create or replace function comms.record_whatsapp_message_failure(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_whatsapp_attempt_id bigint := (_payload->'original_payload'->>'send_whatsapp_attempt_id')::bigint;
+    _error_message text := _payload->>'error';
+begin
+    if _send_whatsapp_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_whatsapp_attempt_id');
+    end if;
+
+    insert into comms.send_whatsapp_attempt_failed (send_whatsapp_attempt_id, error_message)
+    values (_send_whatsapp_attempt_id, _error_message)
+    on conflict (send_whatsapp_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- effect: schedule a whatsapp send attempt
+create or replace function comms.schedule_whatsapp_attempt(
+    _send_whatsapp_task_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _send_whatsapp_attempt_id bigint;
+begin
+    insert into comms.send_whatsapp_attempt (send_whatsapp_task_id)
+    values (_send_whatsapp_task_id)
+    returning send_whatsapp_attempt_id into _send_whatsapp_attempt_id;
+
+    perform queues.enqueue(
+        'whatsapp_message',
+        jsonb_build_object(
+            'task_type', 'whatsapp_message',
+            'send_whatsapp_attempt_id', _send_whatsapp_attempt_id,
+            'before_handler', 'comms.get_whatsapp_message_payload',
+            'success_handler', 'comms.record_whatsapp_message_success',
+            'error_handler', 'comms.record_whatsapp_message_failure'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- effect: schedule whatsapp supervisor recheck with exponential backoff
+create or replace function comms.schedule_whatsapp_supervisor_recheck(
+    _send_whatsapp_task_id bigint,
+    _num_failures integer,
+    _run_count integer
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _base_delay_seconds integer := 5;
+    _next_check_at timestamptz;
+begin
+    _next_check_at := now() + (
+        _base_delay_seconds * power(2, _num_failures)
+    ) * interval '1 second';
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_whatsapp_supervisor',
+            'send_whatsapp_task_id', _send_whatsapp_task_id,
+            'run_count', _run_count + 1
+        ),
+        _next_check_at
+    );
+end;
+$$;
+
+-- supervisor: orchestrates whatsapp sending using append-only facts
+create or replace function comms.send_whatsapp_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_whatsapp_task_id bigint := (_payload->>'send_whatsapp_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _max_runs integer := 20;
+    _max_attempts integer := 2;
+    _facts record;
+begin
+    -- 1. VALIDATION
+    if _send_whatsapp_task_id is null then
+        return jsonb_build_object('status', 'missing_send_whatsapp_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'send_whatsapp_supervisor exceeded max runs'
+            using detail = 'Possible infinite loop detected',
+                  hint = format('task_id=%s, run_count=%s', _send_whatsapp_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK (before facts)
+    perform 1
+    from comms.send_whatsapp_task t
+    where t.send_whatsapp_task_id = _send_whatsapp_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := comms.send_whatsapp_supervisor_facts(_send_whatsapp_task_id);
+
+    -- 4. LOGIC + EFFECTS
+    if _facts.has_success then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    if _facts.num_attempts = _facts.num_failures then
+        perform comms.schedule_whatsapp_attempt(_send_whatsapp_task_id);
+    end if;
+
+    perform comms.schedule_whatsapp_supervisor_recheck(
+        _send_whatsapp_task_id,
+        _facts.num_failures,
+        _run_count
+    );
+
+    return jsonb_build_object('status', 'scheduled');
+end;
+$$;
+
+create or replace function comms.kickoff_send_whatsapp_task(
+    _message_id bigint,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _send_whatsapp_task_id bigint;
+begin
+    -- validation
+    if _message_id is null then
+        validation_failure_message := 'missing_message_id';
+        return;
+    end if;
+
+    if not comms.message_exists(_message_id) then
+        validation_failure_message := 'message_not_found';
+        return;
+    end if;
+
+    -- output
+    insert into comms.send_whatsapp_task (message_id)
+    values (_message_id)
+    returning send_whatsapp_task_id
+    into _send_whatsapp_task_id;
+
+    perform queues.enqueue(
+        'db_function',
+        jsonb_build_object(
+            'task_type', 'db_function',
+            'db_function', 'comms.send_whatsapp_supervisor',
+            'send_whatsapp_task_id', _send_whatsapp_task_id
+        ),
+        _scheduled_at
+    );
+
+    return;
+end;
+$$;
+
+create or replace function comms.create_and_kickoff_whatsapp_message_task(
+    _to_number text,
+    _template_name text,
+    _language_code text,
+    _header_parameters jsonb default '[]'::jsonb,
+    _body_parameters jsonb default '[]'::jsonb,
+    _components jsonb default null,
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_whatsapp_message_result record;
+    _kickoff_whatsapp_validation_failure_message text;
+begin
+    select (comms.create_whatsapp_message(_to_number, _template_name, _language_code, _header_parameters, _body_parameters, _components)).*
+    into strict _create_whatsapp_message_result;
+
+    if _create_whatsapp_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_whatsapp_message_result.validation_failure_message;
+        return;
+    end if;
+
+    select comms.kickoff_send_whatsapp_task(_create_whatsapp_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_whatsapp_validation_failure_message;
+
+    if _kickoff_whatsapp_validation_failure_message is not null then
+        validation_failure_message := _kickoff_whatsapp_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
+
+-- per-function grants to worker_service_user (whatsapp)
+grant execute on function comms.kickoff_send_whatsapp_task(bigint, timestamp with time zone) to worker_service_user;
+grant execute on function comms.get_whatsapp_message_payload(jsonb) to worker_service_user;
+grant execute on function comms.record_whatsapp_message_success(jsonb) to worker_service_user;
+grant execute on function comms.record_whatsapp_message_failure(jsonb) to worker_service_user;
+grant execute on function comms.schedule_whatsapp_attempt(bigint) to worker_service_user;
+grant execute on function comms.schedule_whatsapp_supervisor_recheck(bigint, integer, integer) to worker_service_user;
+grant execute on function comms.send_whatsapp_supervisor(jsonb) to worker_service_user;
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
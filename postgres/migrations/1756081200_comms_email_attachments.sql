@@ -0,0 +1,176 @@
+-- email attachments: files service files sent with an email
+--
+-- the worker downloads each attached file through a signed url and sends it
+-- to resend inline (base64), so only the file id is stored here. the
+-- filename defaults to the file's 'name' metadata, then to
+-- file-<id>.<extension>; the content type is the file's mime type. the
+-- worker caps the combined size per email (WORKER_EMAIL_ATTACHMENTS_MAX_BYTES);
+-- larger emails fail validation.
+
+create table comms.email_attachment (
+    email_attachment_id bigserial primary key,
+    message_id bigint not null references comms.message(message_id) on delete cascade,
+    file_id bigint not null references files.file(file_id),
+    filename text,
+    created_at timestamp with time zone not null default now(),
+    constraint email_attachment_unique_message_file unique (message_id, file_id)
+);
+
+create index email_attachment_message_id_idx on comms.email_attachment (message_id);
+
+-- attach a file to an email message that has not been kicked off yet
+create or replace function comms.add_email_attachment(
+    _message_id bigint,
+    _file_id bigint,
+    _filename text default null,
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+begin
+    if not exists (
+        select 1
+        from comms.email_message em
+        where em.message_id = _message_id
+    ) then
+        validation_failure_message := 'email_message_not_found';
+        return;
+    end if;
+
+    if not exists (
+        select 1
+        from files.file f
+        where f.file_id = _file_id
+    ) then
+        validation_failure_message := 'file_not_found';
+        return;
+    end if;
+
+    insert into comms.email_attachment (message_id, file_id, filename)
+    values (_message_id, _file_id, nullif(_filename, ''))
+    on conflict (message_id, file_id) do update
+    set filename = excluded.filename;
+
+    return;
+end;
+$$;
+
+-- facts: attachments of an email message, in the order they were added
+create or replace function comms.get_email_attachments(
+    _message_id bigint
+)
+returns jsonb
+language sql
+stable
+as $$
+    select coalesce(
+        jsonb_agg(
+            jsonb_build_object(
+                'file_id', ea.file_id,
+                'filename', coalesce(
+                    ea.filename,
+                    fm.value #>> '{}',
+                    format('file-%s.%s', f.file_id, files.mime_type_to_extension(f.mime_type))
+                ),
+                'content_type', f.mime_type
+            )
+            order by ea.email_attachment_id
+        ),
+        '[]'::jsonb
+    )
+    from comms.email_attachment ea
+    join files.file f on f.file_id = ea.file_id
+    left join files.file_metadata fm on fm.file_id = f.file_id and fm.key = 'name'
+    where ea.message_id = _message_id;
+$$;
+
+-- before handler: build provider payload from send_email_attempt_id in
+-- payload, now with the message's attachments
+create or replace function comms.get_email_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_email_attempt_id bigint := (_payload->>'send_email_attempt_id')::bigint;
+    _facts record;
+begin
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_email_attempt_id');
+    end if;
+
+    _facts := comms.get_email_payload_facts(_send_email_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'email_message_not_found');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'message_id', _facts.message_id,
+            'from_address', _facts.from_address,
+            'to_address', _facts.to_address,
+            'subject', _facts.subject,
+            'html', _facts.html,
+            'attachments', comms.get_email_attachments(_facts.message_id)
+        )
+    );
+end;
+$$;
+
+-- create an email with attachments and kick it off; _attachment_file_ids are
+-- files service files, attached under their default filenames
+create or replace function comms.create_and_kickoff_email_task_with_attachments(
+    _from_address text,
+    _to_address text,
+    _subject text,
+    _html text,
+    _attachment_file_ids bigint[],
+    _scheduled_at timestamp with time zone default now(),
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _create_email_message_result record;
+    _file_id bigint;
+    _attachment_validation_failure_message text;
+    _kickoff_email_validation_failure_message text;
+begin
+    select (comms.create_email_message(_from_address, _to_address, _subject, _html)).*
+    into strict _create_email_message_result;
+
+    if _create_email_message_result.validation_failure_message is not null then
+        validation_failure_message := _create_email_message_result.validation_failure_message;
+        return;
+    end if;
+
+    foreach _file_id in array coalesce(_attachment_file_ids, '{}'::bigint[]) loop
+        select comms.add_email_attachment(_create_email_message_result.created_message_id, _file_id)
+        into strict _attachment_validation_failure_message;
+
+        if _attachment_validation_failure_message is not null then
+            validation_failure_message := _attachment_validation_failure_message;
+            return;
+        end if;
+    end loop;
+
+    select comms.kickoff_send_email_task(_create_email_message_result.created_message_id, _scheduled_at)
+    into strict _kickoff_email_validation_failure_message;
+
+    if _kickoff_email_validation_failure_message is not null then
+        validation_failure_message := _kickoff_email_validation_failure_message;
+        return;
+    end if;
+
+    return;
+end;
+$$;
@@ -0,0 +1,106 @@
+-- email cc, bcc and reply-to
+--
+-- optional addressing on top of the single to_address, e.g. to copy support
+-- on transactional emails and have replies go to a monitored inbox. set it
+-- between creating the message and kicking it off:
+--
+--   select (comms.create_email_message(from, to, subject, html)).* ...
+--   select comms.set_email_addressing(_message_id, '{support@example.com}', '{}', 'support@example.com');
+--   select comms.kickoff_send_email_task(_message_id);
+--
+-- messages without them go out as before; the worker treats absent fields as
+-- empty.
+
+alter table comms.email_message
+    add column cc text[] not null default '{}',
+    add column bcc text[] not null default '{}',
+    add column reply_to text;
+
+-- set cc, bcc and reply-to of an email message; null arrays clear them
+create or replace function comms.set_email_addressing(
+    _message_id bigint,
+    _cc text[] default '{}',
+    _bcc text[] default '{}',
+    _reply_to text default null,
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+declare
+    _address text;
+begin
+    if not exists (
+        select 1
+        from comms.email_message em
+        where em.message_id = _message_id
+    ) then
+        validation_failure_message := 'email_message_not_found';
+        return;
+    end if;
+
+    foreach _address in array coalesce(_cc, '{}') || coalesce(_bcc, '{}') || coalesce(array[_reply_to], '{}') loop
+        if _address is not null and _address !~ '^[^@\s]+@[^@\s]+$' then
+            validation_failure_message := 'address_invalid';
+            return;
+        end if;
+    end loop;
+
+    update comms.email_message
+    set cc = coalesce(_cc, '{}'),
+        bcc = coalesce(_bcc, '{}'),
+        reply_to = nullif(_reply_to, '')
+    where message_id = _message_id;
+
+    return;
+end;
+$$;
+
+-- before handler: build provider payload from send_email_attempt_id in
+-- payload, with cc, bcc and reply-to when set
+create or replace function comms.get_email_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_email_attempt_id bigint := (_payload->>'send_email_attempt_id')::bigint;
+    _facts record;
+    _addressing record;
+begin
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_email_attempt_id');
+    end if;
+
+    _facts := comms.get_email_payload_facts(_send_email_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'email_message_not_found');
+    end if;
+
+    select em.cc, em.bcc, em.reply_to
+    into _addressing
+    from comms.email_message em
+    where em.message_id = _facts.message_id;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'message_id', _facts.message_id,
+            'from_address', _facts.from_address,
+            'to_address', _facts.to_address,
+            'subject', _facts.subject,
+            'html', _facts.html,
+            'attachments', comms.get_email_attachments(_facts.message_id)
+        ) || jsonb_strip_nulls(jsonb_build_object(
+            'cc', case when cardinality(_addressing.cc) > 0 then to_jsonb(_addressing.cc) end,
+            'bcc', case when cardinality(_addressing.bcc) > 0 then to_jsonb(_addressing.bcc) end,
+            'reply_to', _addressing.reply_to
+        ))
+    );
+end;
+$$;
@@ -0,0 +1,99 @@
+-- email provider per message
+--
+-- the worker sends email through its configured provider (resend by
+-- default), failing over to its fallback provider on transient errors. a
+-- message can instead name the provider it goes out through, e.g. to keep a
+-- stream on the provider its sending domain is warmed up on:
+--
+--   select (comms.create_email_message(from, to, subject, html)).* ...
+--   select comms.set_email_provider(_message_id, 'ses');
+--   select comms.kickoff_send_email_task(_message_id);
+--
+-- the worker's success result names the provider that sent the email.
+
+alter table comms.email_message
+    add column provider text
+        check (provider in ('resend', 'ses', 'sendgrid'));
+
+-- set the provider an email message is sent through; null restores the
+-- worker's configured provider
+create or replace function comms.set_email_provider(
+    _message_id bigint,
+    _provider text,
+    out validation_failure_message text
+)
+returns text
+language plpgsql
+security definer
+as $$
+begin
+    if not exists (
+        select 1
+        from comms.email_message em
+        where em.message_id = _message_id
+    ) then
+        validation_failure_message := 'email_message_not_found';
+        return;
+    end if;
+
+    if _provider is not null and _provider not in ('resend', 'ses', 'sendgrid') then
+        validation_failure_message := 'email_provider_invalid';
+        return;
+    end if;
+
+    update comms.email_message
+    set provider = _provider
+    where message_id = _message_id;
+
+    return;
+end;
+$$;
+
+-- before handler: build provider payload from send_email_attempt_id in
+-- payload, with cc, bcc, reply-to and provider when set
+create or replace function comms.get_email_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_email_attempt_id bigint := (_payload->>'send_email_attempt_id')::bigint;
+    _facts record;
+    _addressing record;
+begin
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_email_attempt_id');
+    end if;
+
+    _facts := comms.get_email_payload_facts(_send_email_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'email_message_not_found');
+    end if;
+
+    select em.cc, em.bcc, em.reply_to, em.provider
+    into _addressing
+    from comms.email_message em
+    where em.message_id = _facts.message_id;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'message_id', _facts.message_id,
+            'from_address', _facts.from_address,
+            'to_address', _facts.to_address,
+            'subject', _facts.subject,
+            'html', _facts.html,
+            'attachments', comms.get_email_attachments(_facts.message_id)
+        ) || jsonb_strip_nulls(jsonb_build_object(
+            'cc', case when cardinality(_addressing.cc) > 0 then to_jsonb(_addressing.cc) end,
+            'bcc', case when cardinality(_addressing.bcc) > 0 then to_jsonb(_addressing.bcc) end,
+            'reply_to', _addressing.reply_to,
+            'provider', _addressing.provider
+        ))
+    );
+end;
+$$;
@@ -0,0 +1,62 @@
+-- email idempotency keys
+--
+-- a worker that times out waiting for resend cannot tell whether the email
+-- went out, and retrying the task could deliver it twice. the payload now
+-- carries the attempt it is sent for; the worker sends
+-- email-<message_id>-attempt-<send_email_attempt_id> as resend's
+-- Idempotency-Key, so retries of the same attempt within 24 hours return the
+-- first email instead of sending another. the supervisor's next attempt after
+-- a recorded failure has a new key and sends normally.
+--
+-- a before_handler may also return its own idempotency_key.
+
+-- before handler: build provider payload from send_email_attempt_id in
+-- payload, with cc, bcc, reply-to and provider when set, and the attempt the
+-- worker derives resend's idempotency key from
+create or replace function comms.get_email_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _send_email_attempt_id bigint := (_payload->>'send_email_attempt_id')::bigint;
+    _facts record;
+    _addressing record;
+begin
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_email_attempt_id');
+    end if;
+
+    _facts := comms.get_email_payload_facts(_send_email_attempt_id);
+
+    if _facts.message_id is null then
+        return jsonb_build_object('status', 'email_message_not_found');
+    end if;
+
+    select em.cc, em.bcc, em.reply_to, em.provider
+    into _addressing
+    from comms.email_message em
+    where em.message_id = _facts.message_id;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'message_id', _facts.message_id,
+            'send_email_attempt_id', _send_email_attempt_id,
+            'from_address', _facts.from_address,
+            'to_address', _facts.to_address,
+            'subject', _facts.subject,
+            'html', _facts.html,
+            'attachments', comms.get_email_attachments(_facts.message_id)
+        ) || jsonb_strip_nulls(jsonb_build_object(
+            'cc', case when cardinality(_addressing.cc) > 0 then to_jsonb(_addressing.cc) end,
+            'bcc', case when cardinality(_addressing.bcc) > 0 then to_jsonb(_addressing.bcc) end,
+            'reply_to', _addressing.reply_to,
+            'provider', _addressing.provider
+        ))
+    );
+end;
+$$;
@@ -0,0 +1,159 @@
+-- email delivery events: record what resend reported after sending
+--
+-- the success handler now keeps the sending provider and its email id on
+-- comms.send_email_attempt_succeeded. resend posts delivered, bounced and
+-- complained events to the worker (POST /webhooks/resend); the worker verifies
+-- the svix signature and passes them to comms.record_email_delivery_event,
+-- keyed by that id.
+--
+-- hard bounces and complaints suppress the address:
+-- comms.email_address_suppressed tells senders not to email it again.
+
+alter table comms.send_email_attempt_succeeded
+    add column provider text,
+    add column provider_message_id text;
+
+create index send_email_attempt_succeeded_provider_message_id_idx
+    on comms.send_email_attempt_succeeded (provider_message_id)
+    where provider_message_id is not null;
+
+-- delivery events (append-only, one per webhook delivery)
+create table comms.email_delivery_event (
+    email_delivery_event_id bigserial primary key,
+    send_email_attempt_id bigint not null references comms.send_email_attempt(send_email_attempt_id) on delete cascade,
+    provider_event_id text unique,
+    event text not null,
+    email_address text,
+    bounce_type text,
+    detail text,
+    created_at timestamp with time zone not null default now(),
+    constraint email_delivery_event_event_check check (event in ('delivered', 'bounced', 'complained'))
+);
+
+create index email_delivery_event_send_email_attempt_id_idx
+    on comms.email_delivery_event (send_email_attempt_id, created_at desc);
+
+create index email_delivery_event_email_address_idx
+    on comms.email_delivery_event (email_address)
+    where event in ('bounced', 'complained');
+
+-- success handler: record success fact with the sending provider and its
+-- email id
+-- receives: { original_payload: { send_email_attempt_id, ... }, worker_payload: { provider, id } }
+create or replace function comms.record_email_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _send_email_attempt_id bigint := (_payload->'original_payload'->>'send_email_attempt_id')::bigint;
+begin
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'missing_send_email_attempt_id');
+    end if;
+
+    insert into comms.send_email_attempt_succeeded (send_email_attempt_id, provider, provider_message_id)
+    values (
+        _send_email_attempt_id,
+        _payload->'worker_payload'->>'provider',
+        nullif(_payload->'worker_payload'->>'id', '')
+    )
+    on conflict (send_email_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- record a delivery event reported by the provider
+-- receives: { provider, event_id, message_id, event, email_address, bounce_type, detail }
+create or replace function comms.record_email_delivery_event(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _provider_message_id text := _payload->>'message_id';
+    _event text := _payload->>'event';
+    _send_email_attempt_id bigint;
+begin
+    if _provider_message_id is null then
+        return jsonb_build_object('status', 'missing_message_id');
+    end if;
+
+    if _event is null or _event not in ('delivered', 'bounced', 'complained') then
+        return jsonb_build_object('status', 'invalid_event');
+    end if;
+
+    select s.send_email_attempt_id
+    into _send_email_attempt_id
+    from comms.send_email_attempt_succeeded s
+    where s.provider_message_id = _provider_message_id
+      and (_payload->>'provider' is null or s.provider is null or s.provider = _payload->>'provider')
+    order by s.created_at desc
+    limit 1;
+
+    if _send_email_attempt_id is null then
+        return jsonb_build_object('status', 'unknown_message');
+    end if;
+
+    insert into comms.email_delivery_event (send_email_attempt_id, provider_event_id, event, email_address, bounce_type, detail)
+    values (
+        _send_email_attempt_id,
+        nullif(_payload->>'event_id', ''),
+        _event,
+        lower(nullif(_payload->>'email_address', '')),
+        nullif(_payload->>'bounce_type', ''),
+        nullif(_payload->>'detail', '')
+    )
+    on conflict (provider_event_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- whether email to an address is suppressed: it hard bounced or its
+-- recipient marked an email as spam
+create or replace function comms.email_address_suppressed(
+    _email_address text
+)
+returns boolean
+language sql
+stable
+security definer
+as $$
+    select exists (
+        select 1
+        from comms.email_delivery_event e
+        where e.email_address = lower(_email_address)
+          and (e.event = 'complained' or (e.event = 'bounced' and e.bounce_type = 'permanent'))
+    );
+$$;
+
+-- latest delivery event of an email message, or null when none was reported
+create or replace function comms.get_email_delivery_event(
+    _message_id bigint
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select jsonb_build_object(
+        'event', d.event,
+        'bounce_type', d.bounce_type,
+        'detail', d.detail,
+        'reported_at', d.created_at
+    )
+    from comms.email_delivery_event d
+    join comms.send_email_attempt a on a.send_email_attempt_id = d.send_email_attempt_id
+    join comms.send_email_task t on t.send_email_task_id = a.send_email_task_id
+    where t.message_id = _message_id
+    order by d.created_at desc, d.email_delivery_event_id desc
+    limit 1;
+$$;
+
+grant execute on function comms.record_email_delivery_event(jsonb) to worker_service_user;
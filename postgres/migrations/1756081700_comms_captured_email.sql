@@ -0,0 +1,78 @@
+-- captured email: where emails go in capture mode
+--
+-- with EMAIL_MODE=capture and no EMAIL_CAPTURE_SMTP_ADDR the worker sends no
+-- email at all; it stores each rendered email here through
+-- comms.record_captured_email instead, so local and staging environments can
+-- inspect what would have been sent:
+--
+--   select to_address, subject, text from comms.captured_email order by captured_email_id desc;
+--
+-- the success handler records the attempt as sent, with provider 'capture'.
+
+create table comms.captured_email (
+    captured_email_id bigserial primary key,
+    message_id bigint,
+    from_address text not null,
+    to_address text not null,
+    cc text[] not null default '{}',
+    bcc text[] not null default '{}',
+    reply_to text,
+    subject text not null,
+    html text,
+    text text,
+    headers jsonb not null default '{}',
+    tags jsonb not null default '{}',
+    attachments jsonb not null default '[]',
+    mime text not null,
+    created_at timestamp with time zone not null default now()
+);
+
+create index captured_email_to_address_idx
+    on comms.captured_email (to_address, created_at desc);
+
+-- store a captured email
+-- receives: the email payload plus { attachments: [{ filename, content_type, size }], mime }
+-- returns: { status: 'succeeded', payload: { captured_email_id } }
+create or replace function comms.record_captured_email(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _captured_email_id bigint;
+begin
+    if _payload->>'to_address' is null or _payload->>'mime' is null then
+        return jsonb_build_object('status', 'missing_email');
+    end if;
+
+    insert into comms.captured_email (
+        message_id, from_address, to_address, cc, bcc, reply_to,
+        subject, html, text, headers, tags, attachments, mime
+    )
+    values (
+        (_payload->>'message_id')::bigint,
+        coalesce(_payload->>'from_address', ''),
+        _payload->>'to_address',
+        coalesce(array(select jsonb_array_elements_text(_payload->'cc')), '{}'),
+        coalesce(array(select jsonb_array_elements_text(_payload->'bcc')), '{}'),
+        _payload->>'reply_to',
+        coalesce(_payload->>'subject', ''),
+        _payload->>'html',
+        _payload->>'text',
+        coalesce(_payload->'headers', '{}'),
+        coalesce(_payload->'tags', '{}'),
+        coalesce(_payload->'attachments', '[]'),
+        _payload->>'mime'
+    )
+    returning captured_email_id into _captured_email_id;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object('captured_email_id', _captured_email_id)
+    );
+end;
+$$;
+
+grant execute on function comms.record_captured_email(jsonb) to worker_service_user;
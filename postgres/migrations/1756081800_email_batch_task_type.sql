@@ -0,0 +1,31 @@
+-- email_batch task type
+--
+-- sends many emails in one task through resend's batch endpoint (100 per
+-- call). the before_handler returns { batch_id, emails: [<email payload>, ...] }
+-- and the success handler receives one result per email:
+-- { sent, failed, results: [{ message_id, to_address, provider, id, error }] }.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
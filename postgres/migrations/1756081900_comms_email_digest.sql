@@ -0,0 +1,274 @@
+-- email digests: one email listing an account's pending notification items
+--
+-- notification items are recorded with comms.add_notification_item instead of
+-- being emailed one by one. comms.kickoff_email_digest enqueues an
+-- email_digest task for an account and time window; its before_handler
+-- returns the account, the window and the addresses, and the worker collects
+-- the undigested items created in the window (comms.get_pending_notification_items),
+-- renders them into one email, sends it and marks them digested
+-- (comms.mark_notification_items_digested). items over the worker's cap, or
+-- left behind by a failed digest, stay pending for a later window that
+-- covers them.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
+
+-- one digest per account and window
+create table comms.email_digest (
+    email_digest_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    window_start timestamp with time zone not null,
+    window_end timestamp with time zone not null,
+    created_at timestamp with time zone not null default now(),
+    constraint email_digest_window_check check (window_end > window_start),
+    constraint email_digest_account_window_unique unique (account_id, window_start, window_end)
+);
+
+-- sent fact: the email the digest went out as
+create table comms.email_digest_sent (
+    email_digest_id bigint primary key references comms.email_digest(email_digest_id) on delete cascade,
+    item_count integer not null,
+    provider text,
+    provider_message_id text,
+    created_at timestamp with time zone not null default now()
+);
+
+-- notification items waiting for a digest; email_digest_id and digested_at
+-- are set once a digest listed the item
+create table comms.notification_item (
+    notification_item_id bigserial primary key,
+    account_id bigint not null references accounts.account(account_id) on delete cascade,
+    title text not null,
+    body text,
+    url text,
+    created_at timestamp with time zone not null default now(),
+    email_digest_id bigint references comms.email_digest(email_digest_id) on delete set null,
+    digested_at timestamp with time zone
+);
+
+create index notification_item_pending_idx
+    on comms.notification_item (account_id, created_at)
+    where digested_at is null;
+
+-- record a notification item for the account's next digest
+create or replace function comms.add_notification_item(
+    _account_id bigint,
+    _title text,
+    _body text default null,
+    _url text default null
+)
+returns bigint
+language sql
+security definer
+as $$
+    insert into comms.notification_item (account_id, title, body, url)
+    values (_account_id, _title, _body, _url)
+    returning notification_item_id;
+$$;
+
+-- effect: create the account's digest for a window and enqueue its task;
+-- a window already kicked off is not sent twice
+create or replace function comms.kickoff_email_digest(
+    _account_id bigint,
+    _window_start timestamp with time zone,
+    _window_end timestamp with time zone,
+    _scheduled_at timestamp with time zone default now()
+)
+returns bigint
+language plpgsql
+security definer
+as $$
+declare
+    _email_digest_id bigint;
+begin
+    insert into comms.email_digest (account_id, window_start, window_end)
+    values (_account_id, _window_start, _window_end)
+    on conflict (account_id, window_start, window_end) do nothing
+    returning email_digest_id into _email_digest_id;
+
+    if _email_digest_id is null then
+        return null;
+    end if;
+
+    perform queues.enqueue(
+        'email_digest',
+        jsonb_build_object(
+            'task_type', 'email_digest',
+            'email_digest_id', _email_digest_id,
+            'before_handler', 'comms.get_email_digest_payload'
+        ),
+        _scheduled_at
+    );
+
+    return _email_digest_id;
+end;
+$$;
+
+-- before handler: the digest's account, window and addresses
+-- receives: { email_digest_id, ... }
+create or replace function comms.get_email_digest_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _email_digest_id bigint := (_payload->>'email_digest_id')::bigint;
+    _digest record;
+begin
+    if _email_digest_id is null then
+        return jsonb_build_object('status', 'missing_email_digest_id');
+    end if;
+
+    select d.email_digest_id, d.account_id, d.window_start, d.window_end, a.email
+    into _digest
+    from comms.email_digest d
+    join accounts.account a on a.account_id = d.account_id
+    where d.email_digest_id = _email_digest_id;
+
+    if _digest.email_digest_id is null then
+        return jsonb_build_object('status', 'email_digest_not_found');
+    end if;
+
+    if _digest.email is null then
+        return jsonb_build_object('status', 'account_email_missing');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'digest_id', _digest.email_digest_id,
+            'account_id', _digest.account_id,
+            'window_start', _digest.window_start,
+            'window_end', _digest.window_end,
+            'from_address', comms.from_email_address('noreply'),
+            'to_address', _digest.email
+        )
+    );
+end;
+$$;
+
+-- the account's undigested items created in [window_start, window_end),
+-- oldest first
+-- receives: { account_id, window_start, window_end, limit }
+create or replace function comms.get_pending_notification_items(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _account_id bigint := (_payload->>'account_id')::bigint;
+    _window_start timestamp with time zone := (_payload->>'window_start')::timestamp with time zone;
+    _window_end timestamp with time zone := (_payload->>'window_end')::timestamp with time zone;
+    _limit integer := coalesce((_payload->>'limit')::integer, 100);
+begin
+    if _account_id is null or _window_start is null or _window_end is null then
+        return jsonb_build_object('status', 'missing_account_or_window');
+    end if;
+
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'items', coalesce((
+                select jsonb_agg(jsonb_build_object(
+                    'notification_item_id', i.notification_item_id,
+                    'title', i.title,
+                    'body', i.body,
+                    'url', i.url,
+                    'created_at', i.created_at
+                ) order by i.created_at, i.notification_item_id)
+                from (
+                    select *
+                    from comms.notification_item n
+                    where n.account_id = _account_id
+                      and n.digested_at is null
+                      and n.created_at >= _window_start
+                      and n.created_at < _window_end
+                    order by n.created_at, n.notification_item_id
+                    limit _limit
+                ) i
+            ), '[]'::jsonb)
+        )
+    );
+end;
+$$;
+
+-- mark the items a digest listed as digested and record the email it went
+-- out as; items already digested are left as they are
+-- receives: { digest_id, account_id, notification_item_ids, provider, provider_message_id }
+create or replace function comms.mark_notification_items_digested(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _email_digest_id bigint := nullif((_payload->>'digest_id')::bigint, 0);
+    _account_id bigint := (_payload->>'account_id')::bigint;
+    _item_ids bigint[];
+    _marked integer;
+begin
+    if _account_id is null then
+        return jsonb_build_object('status', 'missing_account_id');
+    end if;
+
+    select coalesce(array_agg(value::bigint), '{}')
+    into _item_ids
+    from jsonb_array_elements_text(coalesce(_payload->'notification_item_ids', '[]'::jsonb));
+
+    update comms.notification_item
+    set digested_at = now(),
+        email_digest_id = _email_digest_id
+    where account_id = _account_id
+      and notification_item_id = any(_item_ids)
+      and digested_at is null;
+
+    get diagnostics _marked = row_count;
+
+    if _email_digest_id is not null then
+        insert into comms.email_digest_sent (email_digest_id, item_count, provider, provider_message_id)
+        values (
+            _email_digest_id,
+            cardinality(_item_ids),
+            nullif(_payload->>'provider', ''),
+            nullif(_payload->>'provider_message_id', '')
+        )
+        on conflict (email_digest_id) do nothing;
+    end if;
+
+    return jsonb_build_object('status', 'succeeded', 'payload', jsonb_build_object('marked', _marked));
+end;
+$$;
+
+grant execute on function comms.get_email_digest_payload(jsonb) to worker_service_user;
+grant execute on function comms.get_pending_notification_items(jsonb) to worker_service_user;
+grant execute on function comms.mark_notification_items_digested(jsonb) to worker_service_user;
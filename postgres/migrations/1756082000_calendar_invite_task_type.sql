@@ -0,0 +1,36 @@
+-- calendar_invite task type
+--
+-- sends an email carrying an rfc 5545 calendar invite. the before_handler
+-- returns an email payload (without attachments) plus
+-- { event: { uid, sequence, method, summary, description, location, url,
+-- start, end, organizer, attendees } }; the worker renders the event as
+-- invite.ics and sends it both as a text/calendar body alternative and as an
+-- attachment, so gmail and outlook show the invite natively. the success
+-- handler receives { provider, id } like an email task's.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'calendar_invite',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
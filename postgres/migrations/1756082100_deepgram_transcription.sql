@@ -0,0 +1,308 @@
+-- deepgram transcription: a second speech-to-text provider next to elevenlabs
+--
+-- the worker now kicks off transcriptions through a configured provider
+-- (WORKER_TRANSCRIPTION_PROVIDER), failing over to another on transient
+-- errors, and reports which one accepted the request. requests record their
+-- provider; elevenlabs_request_id holds that provider's request id.
+--
+-- deepgram posts its result to api.deepgram_transcription_webhook, which
+-- stores it like the elevenlabs webhook (store first, verify later). the
+-- supervisor verifies the callback's dg-token header, the identifier of the
+-- api key the request was made with, and normalizes deepgram's result to the
+-- transcript shape elevenlabs returns.
+
+-- seed deepgram config: the api key identifier dg-token carries
+insert into internal.config (key, value)
+values (
+    'deepgram',
+    '{
+        "callback_token": "{secrets.deepgram_api_key_id}"
+    }'
+)
+on conflict (key) do nothing;
+
+alter table elevenlabs.recording_transcription_request
+    add column provider text not null default 'elevenlabs'
+        check (provider in ('elevenlabs', 'deepgram'));
+
+-- success handler: record request succeeded, with the provider that took it
+-- receives: { original_payload: { recording_transcription_attempt_id, ... }, worker_payload: { provider, request_id } }
+create or replace function elevenlabs.record_recording_transcription_request_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->'original_payload'->>'recording_transcription_attempt_id')::bigint;
+    _request_id text := (_payload->'worker_payload'->>'request_id');
+    _provider text := coalesce(nullif(_payload->'worker_payload'->>'provider', ''), 'elevenlabs');
+begin
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    if _request_id is null or _request_id = '' then
+        return jsonb_build_object('status', 'missing_request_id');
+    end if;
+
+    -- note: existence of this record IS the success fact (no separate succeeded table)
+    insert into elevenlabs.recording_transcription_request (
+        recording_transcription_attempt_id,
+        elevenlabs_request_id,
+        provider
+    ) values (
+        _recording_transcription_attempt_id,
+        _request_id,
+        _provider
+    )
+    on conflict (recording_transcription_attempt_id) do nothing;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+-- =============================================================================
+-- deepgram: transcription callback
+-- =============================================================================
+
+-- facts: extract and lookup everything needed for callback processing
+create or replace function elevenlabs.deepgram_transcription_webhook_facts(
+    _webhook_body json,
+    out signature_header text,
+    out deepgram_request_id text,
+    out recording_transcription_request_id bigint,
+    out response_already_exists boolean
+)
+language plpgsql
+stable
+as $$
+begin
+    -- deepgram sends the identifier of the request's api key as dg-token
+    signature_header := coalesce(
+        current_setting('request.headers', true)::json->>'dg-token',
+        'missing-dg-token-header'
+    );
+
+    deepgram_request_id := _webhook_body::jsonb->'metadata'->>'request_id';
+
+    recording_transcription_request_id := (
+        select req.recording_transcription_request_id
+        from elevenlabs.recording_transcription_request req
+        where req.elevenlabs_request_id = deepgram_transcription_webhook_facts.deepgram_request_id
+          and req.provider = 'deepgram'
+    );
+
+    response_already_exists := exists (
+        select 1 from elevenlabs.recording_transcription_response res
+        where res.recording_transcription_request_id = deepgram_transcription_webhook_facts.recording_transcription_request_id
+    );
+end;
+$$;
+
+-- api: callback endpoint
+-- function called by PostgREST: POST /rpc/deepgram_transcription_webhook
+-- anonymous access required (Deepgram can't authenticate with our JWT)
+-- this function does NO verification - just stores raw data and returns 200
+create or replace function api.deepgram_transcription_webhook(
+    json
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _webhook_body json := $1;
+    _facts record;
+begin
+    -- 1. FACTS
+    _facts := elevenlabs.deepgram_transcription_webhook_facts(_webhook_body);
+
+    -- 2. LOGIC
+    if _facts.deepgram_request_id is null then
+        raise warning 'api.deepgram_transcription_webhook.invalid.missing_request_id';
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'missing_request_id'
+        );
+    end if;
+
+    if _facts.recording_transcription_request_id is null then
+        raise warning 'api.deepgram_transcription_webhook.invalid.request_not_found: %', _facts.deepgram_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'request_not_found'
+        );
+    end if;
+
+    if _facts.response_already_exists then
+        raise warning 'api.deepgram_transcription_webhook.invalid.response_already_exists: %', _facts.deepgram_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'response_already_exists'
+        );
+    end if;
+
+    if not internal.claim_webhook_delivery('deepgram', _facts.deepgram_request_id) then
+        raise warning 'api.deepgram_transcription_webhook.invalid.duplicate_delivery: %', _facts.deepgram_request_id;
+        return jsonb_build_object(
+            'status', 'received',
+            'warning', 'duplicate_delivery'
+        );
+    end if;
+
+    -- 3. EFFECT
+    perform elevenlabs.record_transcription_webhook_response(
+        _facts.recording_transcription_request_id,
+        _webhook_body,
+        _facts.signature_header
+    );
+
+    return jsonb_build_object('status', 'received');
+end;
+$$;
+
+-- facts: a deepgram result in the elevenlabs transcript shape
+-- { text, words: [{ text, start, end, type, confidence }], language_code, language_probability },
+-- or null when the body has no transcript
+create or replace function elevenlabs.deepgram_transcription(
+    _raw_body jsonb
+)
+returns jsonb
+language sql
+immutable
+as $$
+    select case when _channel->'alternatives'->0 is not null then jsonb_build_object(
+        'text', coalesce(_channel->'alternatives'->0->>'transcript', ''),
+        'words', coalesce((
+            select jsonb_agg(jsonb_build_object(
+                'text', coalesce(w.word->>'punctuated_word', w.word->>'word'),
+                'start', w.word->'start',
+                'end', w.word->'end',
+                'type', 'word',
+                'confidence', w.word->'confidence'
+            ) order by w.position)
+            from jsonb_array_elements(_channel->'alternatives'->0->'words') with ordinality as w(word, position)
+        ), '[]'::jsonb),
+        'language_code', _channel->>'detected_language',
+        'language_probability', _channel->'language_confidence'
+    ) end
+    from (select _raw_body->'results'->'channels'->0 as _channel) c;
+$$;
+
+-- process transcription response: verifies the provider's signature, stores transcript
+create or replace function elevenlabs.process_recording_transcription_response(
+    _recording_transcription_attempt_id bigint
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _response elevenlabs.recording_transcription_response;
+    _provider text;
+    _attempt elevenlabs.recording_transcription_attempt;
+    _task elevenlabs.recording_transcription_task;
+    _signing_secret text;
+    _is_valid boolean;
+    _transcription jsonb;
+    _failure text;
+begin
+    -- get response via attempt
+    _response := elevenlabs.get_recording_transcription_response(_recording_transcription_attempt_id);
+    if _response.recording_transcription_response_id is null then
+        raise warning 'elevenlabs.process_recording_transcription_response.invalid.response_not_found: %', _recording_transcription_attempt_id;
+        return jsonb_build_object(
+            'status', 'failed',
+            'reason', 'response_not_found'
+        );
+    end if;
+
+    _provider := (
+        select req.provider from elevenlabs.recording_transcription_request req
+        where req.recording_transcription_request_id = _response.recording_transcription_request_id
+    );
+
+    -- verify signature and extract transcription data per provider
+    if _provider = 'deepgram' then
+        _signing_secret := internal.get_config('deepgram')->>'callback_token';
+        if _signing_secret is null or _signing_secret = '' then
+            _failure := 'missing_callback_token';
+        elsif _response.signature_header is distinct from _signing_secret then
+            _failure := 'invalid_signature';
+        else
+            _transcription := elevenlabs.deepgram_transcription(_response.raw_body::jsonb);
+        end if;
+    else
+        _signing_secret := internal.get_config('elevenlabs')->>'webhook_secret';
+        if _signing_secret is null or _signing_secret = '' then
+            _failure := 'missing_webhook_secret';
+        else
+            _is_valid := elevenlabs.transcription_webhook_signature_is_valid(
+                _response.raw_body::text,
+                _response.signature_header,
+                _signing_secret,
+                extract(epoch from _response.received_at)::bigint
+            );
+            if not _is_valid then
+                _failure := 'invalid_signature';
+            else
+                _transcription := _response.raw_body::jsonb->'data'->'transcription';
+            end if;
+        end if;
+    end if;
+
+    if _failure is null and _transcription is null then
+        _failure := 'missing_transcription_data';
+    end if;
+
+    if _failure is not null then
+        perform elevenlabs.record_recording_transcription_attempt_failure(_recording_transcription_attempt_id, _failure);
+        raise warning 'elevenlabs.process_recording_transcription_response.invalid.%: %', _failure, _recording_transcription_attempt_id;
+        return jsonb_build_object(
+            'status', 'failed',
+            'reason', _failure
+        );
+    end if;
+
+    -- get attempt and task for recording_id
+    _attempt := (
+        select a from elevenlabs.recording_transcription_attempt a
+        where a.recording_transcription_attempt_id = _recording_transcription_attempt_id
+    );
+
+    _task := (
+        select t from elevenlabs.recording_transcription_task t
+        where t.recording_transcription_task_id = _attempt.recording_transcription_task_id
+    );
+
+    -- check if transcript already exists
+    if learning.has_recording_transcript(_task.profile_cue_recording_id) then
+        raise warning 'elevenlabs.process_recording_transcription_response.transcript_already_exists: %', _task.profile_cue_recording_id;
+        return jsonb_build_object(
+            'status', 'succeeded',
+            'warning', 'transcript_already_exists'
+        );
+    end if;
+
+    -- store transcript (in learning schema - this is the actual learning outcome)
+    insert into learning.recording_transcript (
+        profile_cue_recording_id,
+        text,
+        words,
+        language_code,
+        language_probability
+    ) values (
+        _task.profile_cue_recording_id,
+        coalesce(_transcription->>'text', ''),
+        coalesce(_transcription->'words', '[]'::jsonb),
+        _transcription->>'language_code',
+        (_transcription->>'language_probability')::numeric
+    );
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+grant execute on function api.deepgram_transcription_webhook(json) to anon;
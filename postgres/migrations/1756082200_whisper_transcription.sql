@@ -0,0 +1,92 @@
+-- whisper transcription: synchronous transcription of short recordings
+--
+-- the worker can transcribe a recording through openai's audio
+-- transcriptions api (provider 'whisper'), either because the kickoff
+-- before_handler names it or because the recording is at most
+-- WORKER_WHISPER_MAX_SECONDS long. whisper answers with the transcript
+-- itself, so there is no webhook: the kickoff success handler stores the
+-- transcript it receives, and the supervisor's next run finds it.
+
+alter table elevenlabs.recording_transcription_request
+    drop constraint if exists recording_transcription_request_provider_check;
+
+alter table elevenlabs.recording_transcription_request
+    add constraint recording_transcription_request_provider_check
+        check (provider in ('elevenlabs', 'deepgram', 'whisper'));
+
+-- effect: store a transcript returned by a synchronous provider
+create or replace function elevenlabs.record_recording_transcription_transcript(
+    _recording_transcription_attempt_id bigint,
+    _transcript jsonb
+)
+returns void
+language sql
+as $$
+    insert into learning.recording_transcript (
+        profile_cue_recording_id,
+        text,
+        words,
+        language_code,
+        language_probability
+    )
+    select
+        t.profile_cue_recording_id,
+        coalesce(_transcript->>'text', ''),
+        coalesce(_transcript->'words', '[]'::jsonb),
+        _transcript->>'language_code',
+        (_transcript->>'language_probability')::numeric
+    from elevenlabs.recording_transcription_attempt a
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    where a.recording_transcription_attempt_id = _recording_transcription_attempt_id
+    on conflict (profile_cue_recording_id) do nothing;
+$$;
+
+-- success handler: record request succeeded, with the provider that took it,
+-- and store the transcript when the provider returned one
+-- receives: { original_payload: { recording_transcription_attempt_id, ... }, worker_payload: { provider, request_id, transcript? } }
+create or replace function elevenlabs.record_recording_transcription_request_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->'original_payload'->>'recording_transcription_attempt_id')::bigint;
+    _request_id text := (_payload->'worker_payload'->>'request_id');
+    _provider text := coalesce(nullif(_payload->'worker_payload'->>'provider', ''), 'elevenlabs');
+    _transcript jsonb := _payload->'worker_payload'->'transcript';
+begin
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    if _request_id is null or _request_id = '' then
+        return jsonb_build_object('status', 'missing_request_id');
+    end if;
+
+    -- note: existence of this record IS the success fact (no separate succeeded table)
+    insert into elevenlabs.recording_transcription_request (
+        recording_transcription_attempt_id,
+        elevenlabs_request_id,
+        provider
+    ) values (
+        _recording_transcription_attempt_id,
+        _request_id,
+        _provider
+    )
+    on conflict (recording_transcription_attempt_id) do nothing;
+
+    -- synchronous providers: the transcript is the response; terminal
+    -- success is inferred from it as for a verified webhook
+    if jsonb_typeof(_transcript) = 'object' then
+        perform elevenlabs.record_recording_transcription_transcript(
+            _recording_transcription_attempt_id,
+            _transcript
+        );
+    end if;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
@@ -0,0 +1,85 @@
+-- per-recording transcription provider and model
+--
+-- the kickoff before_handler now returns an optional provider and model, so
+-- product logic chooses the vendor and model per recording instead of the
+-- worker's configured default and the hardcoded scribe_v2. the choice comes
+-- from the task (set when a recording is queued for transcription), else
+-- from the account's preference, else the worker decides (its configured
+-- provider, or whisper for short recordings).
+
+alter table elevenlabs.recording_transcription_task
+    add column provider text
+        check (provider in ('elevenlabs', 'deepgram', 'whisper')),
+    add column model text;
+
+-- per-account provider preferences; accounts without a row use the worker's
+-- choice. a null model means the provider's default.
+create table elevenlabs.transcription_provider_preference (
+    account_id bigint primary key references accounts.account(account_id) on delete cascade,
+    provider text not null check (provider in ('elevenlabs', 'deepgram', 'whisper')),
+    model text,
+    updated_at timestamp with time zone not null default now()
+);
+
+-- facts: provider and model for the recording behind an attempt (null = the
+-- worker's choice); the task's choice wins over the account's preference
+create or replace function elevenlabs.recording_transcription_attempt_provider(
+    _recording_transcription_attempt_id bigint,
+    out provider text,
+    out model text
+)
+language sql
+stable
+as $$
+    select
+        coalesce(t.provider, pref.provider),
+        case when t.provider is not null then t.model else pref.model end
+    from elevenlabs.recording_transcription_attempt a
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    left join elevenlabs.transcription_provider_preference pref
+        on pref.account_id = elevenlabs.recording_transcription_attempt_account_id(a.recording_transcription_attempt_id)
+    where a.recording_transcription_attempt_id = _recording_transcription_attempt_id;
+$$;
+
+-- before handler: build provider payload from recording_transcription_attempt_id in payload
+create or replace function elevenlabs.get_recording_transcription_kickoff_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->>'recording_transcription_attempt_id')::bigint;
+    _facts record;
+    _choice record;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    -- 2. FACTS
+    _facts := elevenlabs.get_recording_transcription_kickoff_payload_facts(_recording_transcription_attempt_id);
+    _choice := elevenlabs.recording_transcription_attempt_provider(_recording_transcription_attempt_id);
+
+    -- 3. LOGIC
+    if _facts.file_id is null then
+        return jsonb_build_object('status', 'recording_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'file_id', _facts.file_id,
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'duration_seconds', files.file_duration_seconds(_facts.file_id),
+            'provider', _choice.provider,
+            'model', _choice.model
+        ))
+    );
+end;
+$$;
@@ -0,0 +1,303 @@
+-- transcription poll: fetch elevenlabs transcripts when the webhook is late
+--
+-- elevenlabs posts a finished transcript to api.eleven_labs_transcription_webhook,
+-- which needs a public url and can be delayed or lost. while the supervisor
+-- waits for the webhook of an elevenlabs request it now enqueues a
+-- transcription_poll task after 30 seconds, then after 60, 120 and 240
+-- (each poll doubles the wait). the worker fetches the transcript once
+-- (GET /v1/speech-to-text/transcripts/{request_id}); its success handler
+-- stores a completed transcript, and the supervisor's next run finds it as it
+-- would after a verified webhook. a webhook that arrives later finds the
+-- transcript already stored.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'calendar_invite',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'transcription_poll',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
+
+-- polls: one row per transcription_poll task scheduled for an attempt
+create table elevenlabs.recording_transcription_poll (
+    recording_transcription_poll_id bigserial primary key,
+    recording_transcription_attempt_id bigint not null
+        references elevenlabs.recording_transcription_attempt(recording_transcription_attempt_id)
+        on delete cascade,
+    created_at timestamp with time zone not null default now()
+);
+
+create index recording_transcription_poll_attempt_idx
+    on elevenlabs.recording_transcription_poll (recording_transcription_attempt_id);
+
+-- facts: the provider of an attempt's request and how often it was polled
+create or replace function elevenlabs.recording_transcription_poll_facts(
+    _recording_transcription_attempt_id bigint,
+    out provider text,
+    out num_polls integer
+)
+language plpgsql
+stable
+as $$
+begin
+    provider := (
+        select r.provider
+        from elevenlabs.recording_transcription_request r
+        where r.recording_transcription_attempt_id = _recording_transcription_attempt_id
+    );
+
+    num_polls := (
+        select count(*)::integer
+        from elevenlabs.recording_transcription_poll p
+        where p.recording_transcription_attempt_id = _recording_transcription_attempt_id
+    );
+end;
+$$;
+
+-- effect: schedule a transcription poll for an attempt
+create or replace function elevenlabs.schedule_recording_transcription_poll(
+    _recording_transcription_attempt_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    insert into elevenlabs.recording_transcription_poll (recording_transcription_attempt_id)
+    values (_recording_transcription_attempt_id);
+
+    perform queues.enqueue(
+        'transcription_poll',
+        jsonb_build_object(
+            'task_type', 'transcription_poll',
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'before_handler', 'elevenlabs.get_recording_transcription_poll_payload',
+            'success_handler', 'elevenlabs.record_recording_transcription_poll_result'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- before handler: the elevenlabs request id of the attempt; nothing to poll
+-- once the recording has a transcript
+-- receives: { recording_transcription_attempt_id, ... }
+create or replace function elevenlabs.get_recording_transcription_poll_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->>'recording_transcription_attempt_id')::bigint;
+    _request record;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    -- 2. FACTS
+    select r.elevenlabs_request_id, r.provider, t.profile_cue_recording_id
+    into _request
+    from elevenlabs.recording_transcription_request r
+    join elevenlabs.recording_transcription_attempt a
+        on a.recording_transcription_attempt_id = r.recording_transcription_attempt_id
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    where r.recording_transcription_attempt_id = _recording_transcription_attempt_id;
+
+    -- 3. LOGIC
+    if _request.elevenlabs_request_id is null then
+        return jsonb_build_object('status', 'request_not_found');
+    end if;
+
+    if _request.provider <> 'elevenlabs' then
+        return jsonb_build_object('status', 'provider_not_pollable');
+    end if;
+
+    if learning.has_recording_transcript(_request.profile_cue_recording_id) then
+        return jsonb_build_object('status', 'transcript_already_exists');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'request_id', _request.elevenlabs_request_id
+        )
+    );
+end;
+$$;
+
+-- success handler: store a completed transcript; a transcript still
+-- processing is polled again by the supervisor
+-- receives: { original_payload: { recording_transcription_attempt_id, ... }, worker_payload: { request_id, status, transcript? } }
+create or replace function elevenlabs.record_recording_transcription_poll_result(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->'original_payload'->>'recording_transcription_attempt_id')::bigint;
+    _status text := _payload->'worker_payload'->>'status';
+    _transcript jsonb := _payload->'worker_payload'->'transcript';
+begin
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    if _status is distinct from 'completed' then
+        return jsonb_build_object('status', 'succeeded', 'payload', jsonb_build_object('transcript_status', _status));
+    end if;
+
+    if jsonb_typeof(_transcript) <> 'object' then
+        return jsonb_build_object('status', 'missing_transcript');
+    end if;
+
+    -- fetched from elevenlabs with our api key, so there is no signature to
+    -- verify; terminal success is inferred from the transcript as for a
+    -- verified webhook
+    perform elevenlabs.record_recording_transcription_transcript(
+        _recording_transcription_attempt_id,
+        _transcript
+    );
+
+    return jsonb_build_object('status', 'succeeded', 'payload', jsonb_build_object('transcript_status', _status));
+end;
+$$;
+
+-- supervisor: poll elevenlabs while waiting for its webhook
+create or replace function elevenlabs.recording_transcription_supervisor(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_task_id bigint := (_payload->>'recording_transcription_task_id')::bigint;
+    _run_count integer := coalesce((_payload->>'run_count')::integer, 0);
+    _current_attempt_id bigint := (_payload->>'current_attempt_id')::bigint;
+    _time_waiting_seconds integer := coalesce((_payload->>'time_waiting_seconds')::integer, 0);
+    _max_runs integer := 100;
+    _max_attempts integer := 2;
+    _max_wait_seconds integer := 300;
+    _first_poll_seconds integer := 30;
+    _facts record;
+    _poll_facts record;
+    _new_attempt_id bigint;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_task_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_task_id');
+    end if;
+
+    if _run_count >= _max_runs then
+        raise exception 'elevenlabs.recording_transcription_supervisor.exceeded_max_runs'
+            using detail = format('task_id=%s, run_count=%s', _recording_transcription_task_id, _run_count);
+    end if;
+
+    -- 2. LOCK
+    perform 1
+    from elevenlabs.recording_transcription_task t
+    where t.recording_transcription_task_id = _recording_transcription_task_id
+    for update;
+
+    -- 3. FACTS
+    _facts := elevenlabs.recording_transcription_supervisor_facts(
+        _recording_transcription_task_id,
+        _current_attempt_id
+    );
+
+    -- 4. LOGIC + EFFECTS
+
+    -- terminal: transcript exists
+    if _facts.has_transcript then
+        return jsonb_build_object('status', 'succeeded');
+    end if;
+
+    -- terminal: max attempts exhausted
+    if _facts.num_failures >= _max_attempts then
+        return jsonb_build_object('status', 'max_attempts_reached');
+    end if;
+
+    -- no active attempt -> schedule kickoff
+    if _facts.num_attempts = _facts.num_failures then
+        _new_attempt_id := elevenlabs.schedule_recording_transcription_kickoff(_recording_transcription_task_id);
+        perform elevenlabs.schedule_recording_transcription_supervisor_recheck(
+            _recording_transcription_task_id, _run_count, _new_attempt_id, 0
+        );
+        return jsonb_build_object('status', 'kickoff_scheduled');
+    end if;
+
+    -- active attempt: response received -> process it
+    if _facts.attempt_has_response then
+        perform elevenlabs.process_recording_transcription_response(_current_attempt_id);
+        -- reschedule: next run will see transcript (success) or failure (new attempt)
+        perform elevenlabs.schedule_recording_transcription_supervisor_recheck(
+            _recording_transcription_task_id, _run_count, null, 0
+        );
+        return jsonb_build_object('status', 'response_processed');
+    end if;
+
+    -- active attempt: request sent, waiting for webhook
+    if _facts.attempt_has_request then
+        -- check timeout
+        if _time_waiting_seconds >= _max_wait_seconds then
+            perform elevenlabs.record_recording_transcription_attempt_failure(_current_attempt_id, 'webhook_timeout');
+            perform elevenlabs.schedule_recording_transcription_supervisor_recheck(
+                _recording_transcription_task_id, _run_count, null, 0
+            );
+            return jsonb_build_object('status', 'webhook_timeout');
+        end if;
+        -- late or undeliverable webhook: poll elevenlabs for the transcript,
+        -- backing off between polls
+        _poll_facts := elevenlabs.recording_transcription_poll_facts(_current_attempt_id);
+        if _poll_facts.provider = 'elevenlabs'
+            and _time_waiting_seconds >= _first_poll_seconds * power(2, _poll_facts.num_polls)
+        then
+            perform elevenlabs.schedule_recording_transcription_poll(_current_attempt_id);
+        end if;
+        -- keep waiting
+        perform elevenlabs.schedule_recording_transcription_supervisor_recheck(
+            _recording_transcription_task_id, _run_count, _current_attempt_id, _time_waiting_seconds
+        );
+        return jsonb_build_object('status', 'waiting_for_webhook');
+    end if;
+
+    -- active attempt: kickoff worker still running
+    perform elevenlabs.schedule_recording_transcription_supervisor_recheck(
+        _recording_transcription_task_id, _run_count, _current_attempt_id, 0
+    );
+    return jsonb_build_object('status', 'kickoff_in_progress');
+end;
+$$;
+
+grant execute on function elevenlabs.get_recording_transcription_poll_payload(jsonb) to worker_service_user;
+grant execute on function elevenlabs.record_recording_transcription_poll_result(jsonb) to worker_service_user;
@@ -0,0 +1,68 @@
+-- transcription language hint
+--
+-- the kickoff before_handler now returns the recording's language, the
+-- language of the learning profile it was recorded under, as language_code.
+-- the worker passes it to the provider instead of letting it detect the
+-- language, which is often wrong for short or non-english recordings.
+
+-- facts: the language of the profile the attempt's recording belongs to
+create or replace function elevenlabs.recording_transcription_attempt_language_code(
+    _recording_transcription_attempt_id bigint
+)
+returns text
+language sql
+stable
+as $$
+    select p.language_code
+    from elevenlabs.recording_transcription_attempt a
+    join elevenlabs.recording_transcription_task t
+        on t.recording_transcription_task_id = a.recording_transcription_task_id
+    join learning.profile_cue_recording r
+        on r.profile_cue_recording_id = t.profile_cue_recording_id
+    join learning.profile p
+        on p.profile_id = r.profile_id
+    where a.recording_transcription_attempt_id = _recording_transcription_attempt_id;
+$$;
+
+-- before handler: build provider payload from recording_transcription_attempt_id in payload
+create or replace function elevenlabs.get_recording_transcription_kickoff_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->>'recording_transcription_attempt_id')::bigint;
+    _facts record;
+    _choice record;
+begin
+    -- 1. VALIDATION
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    -- 2. FACTS
+    _facts := elevenlabs.get_recording_transcription_kickoff_payload_facts(_recording_transcription_attempt_id);
+    _choice := elevenlabs.recording_transcription_attempt_provider(_recording_transcription_attempt_id);
+
+    -- 3. LOGIC
+    if _facts.file_id is null then
+        return jsonb_build_object('status', 'recording_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'file_id', _facts.file_id,
+            'recording_transcription_attempt_id', _recording_transcription_attempt_id,
+            'duration_seconds', files.file_duration_seconds(_facts.file_id),
+            'provider', _choice.provider,
+            'model', _choice.model,
+            'language_code', elevenlabs.recording_transcription_attempt_language_code(_recording_transcription_attempt_id)
+        ))
+    );
+end;
+$$;
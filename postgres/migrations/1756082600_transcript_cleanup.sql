@@ -0,0 +1,177 @@
+-- transcript cleanup: a readable copy of every stored transcript
+--
+-- when a transcript is stored (from a verified webhook, a synchronous
+-- provider or a poll), a transcript_cleanup task is enqueued. the worker
+-- removes filler words, normalizes punctuation and splits the transcript
+-- into paragraphs, keeping each word's timestamps, and the success handler
+-- stores the result in learning.recording_transcript_cleaned. the raw
+-- transcript is left as the provider returned it.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'calendar_invite',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'transcription_poll',
+        'transcript_cleanup',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
+
+-- cleaned transcripts: text with paragraphs separated by blank lines, and
+-- the paragraphs as [{ text, start, end, words: [{ text, start, end, type }] }]
+create table learning.recording_transcript_cleaned (
+    profile_cue_recording_id bigint primary key
+        references learning.recording_transcript(profile_cue_recording_id)
+        on delete cascade,
+    text text not null,
+    paragraphs jsonb not null,
+    fillers_removed integer not null default 0,
+    created_at timestamp with time zone not null default now()
+);
+
+-- effect: enqueue the cleanup of a recording's transcript
+create or replace function learning.schedule_recording_transcript_cleanup(
+    _profile_cue_recording_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+begin
+    perform queues.enqueue(
+        'transcript_cleanup',
+        jsonb_build_object(
+            'task_type', 'transcript_cleanup',
+            'profile_cue_recording_id', _profile_cue_recording_id,
+            'before_handler', 'learning.get_recording_transcript_cleanup_payload',
+            'success_handler', 'learning.record_recording_transcript_cleanup'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- trigger: clean every transcript once it is stored, whichever path stored it
+create or replace function learning.enqueue_recording_transcript_cleanup()
+returns trigger
+language plpgsql
+security definer
+as $$
+begin
+    perform learning.schedule_recording_transcript_cleanup(new.profile_cue_recording_id);
+    return new;
+end;
+$$;
+
+create trigger recording_transcript_cleanup
+after insert on learning.recording_transcript
+for each row
+execute function learning.enqueue_recording_transcript_cleanup();
+
+-- before handler: the stored transcript of a recording
+-- receives: { profile_cue_recording_id, ... }
+create or replace function learning.get_recording_transcript_cleanup_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _profile_cue_recording_id bigint := (_payload->>'profile_cue_recording_id')::bigint;
+    _transcript learning.recording_transcript;
+begin
+    -- 1. VALIDATION
+    if _profile_cue_recording_id is null then
+        return jsonb_build_object('status', 'missing_profile_cue_recording_id');
+    end if;
+
+    -- 2. FACTS
+    select *
+    into _transcript
+    from learning.recording_transcript t
+    where t.profile_cue_recording_id = _profile_cue_recording_id;
+
+    -- 3. LOGIC
+    if _transcript.recording_transcript_id is null then
+        return jsonb_build_object('status', 'transcript_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_strip_nulls(jsonb_build_object(
+            'profile_cue_recording_id', _profile_cue_recording_id,
+            'text', _transcript.text,
+            'words', _transcript.words,
+            'language_code', _transcript.language_code
+        ))
+    );
+end;
+$$;
+
+-- success handler: store the cleaned transcript; a transcript cleaned again
+-- replaces the earlier copy
+-- receives: { original_payload: { profile_cue_recording_id, ... }, worker_payload: { text, paragraphs, fillers_removed } }
+create or replace function learning.record_recording_transcript_cleanup(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _profile_cue_recording_id bigint := (_payload->'original_payload'->>'profile_cue_recording_id')::bigint;
+    _cleaned jsonb := _payload->'worker_payload';
+begin
+    if _profile_cue_recording_id is null then
+        return jsonb_build_object('status', 'missing_profile_cue_recording_id');
+    end if;
+
+    if jsonb_typeof(_cleaned->'paragraphs') is distinct from 'array' then
+        return jsonb_build_object('status', 'missing_paragraphs');
+    end if;
+
+    insert into learning.recording_transcript_cleaned (
+        profile_cue_recording_id,
+        text,
+        paragraphs,
+        fillers_removed
+    ) values (
+        _profile_cue_recording_id,
+        coalesce(_cleaned->>'text', ''),
+        _cleaned->'paragraphs',
+        coalesce((_cleaned->>'fillers_removed')::integer, 0)
+    )
+    on conflict (profile_cue_recording_id) do update
+    set text = excluded.text,
+        paragraphs = excluded.paragraphs,
+        fillers_removed = excluded.fillers_removed,
+        created_at = now();
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
+
+grant execute on function learning.get_recording_transcript_cleanup_payload(jsonb) to worker_service_user;
+grant execute on function learning.record_recording_transcript_cleanup(jsonb) to worker_service_user;
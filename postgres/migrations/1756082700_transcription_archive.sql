@@ -0,0 +1,320 @@
+-- transcription archive: raw provider responses kept in gcs
+--
+-- when a transcript is stored, the provider's full response (the webhook body
+-- for elevenlabs and deepgram, the transcript itself for whisper and polls)
+-- is archived as a json file in gcs. an upload intent is created for it and a
+-- transcription_archive task enqueued; the worker gets a signed upload url
+-- for the intent from the files service and uploads the response, and the
+-- success handler creates the file and records its file_id. word-level
+-- timestamps are kept without growing postgres.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'calendar_invite',
+        'sms',
+        'file_delete',
+        'transcription_kickoff',
+        'transcription_poll',
+        'transcription_archive',
+        'transcript_cleanup',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
+
+-- json files (archived provider responses)
+alter domain files.mime_type drop constraint if exists mime_type_check;
+
+alter domain files.mime_type
+    add constraint mime_type_check
+    check (value in ('image/jpeg', 'image/png', 'audio/mp4', 'application/json'));
+
+create or replace function files.mime_type_to_extension(
+    _mime_type files.mime_type
+)
+returns text
+language sql
+immutable
+as $$
+    select case _mime_type
+        when 'audio/mp4' then 'm4a'
+        when 'image/jpeg' then 'jpg'
+        when 'image/png' then 'png'
+        when 'application/json' then 'json'
+        else 'bin'
+    end;
+$$;
+
+-- archives: one per transcript; file_id is set once the upload succeeded
+create table elevenlabs.recording_transcription_archive (
+    profile_cue_recording_id bigint primary key
+        references learning.recording_transcript(profile_cue_recording_id)
+        on delete cascade,
+    upload_intent_id bigint not null unique
+        references files.upload_intent(upload_intent_id)
+        on delete cascade,
+    file_id bigint
+        references files.file(file_id)
+        on delete set null,
+    created_at timestamp with time zone not null default now(),
+    archived_at timestamp with time zone
+);
+
+-- function: generate object key for archived transcription responses
+create or replace function files.generate_transcription_archive_object_key(
+    _profile_cue_recording_id bigint
+)
+returns text
+language sql
+stable
+as $$
+    select 'transcription-results/'
+        || 'r-'
+        || _profile_cue_recording_id::text
+        || '-t-'
+        || extract(epoch from now())::bigint::text
+        || '.'
+        || files.mime_type_to_extension('application/json');
+$$;
+
+-- facts: the provider's full response for a recording's transcript: the
+-- latest webhook body, or the stored transcript when there was no webhook
+-- (whisper, polls)
+create or replace function elevenlabs.recording_transcription_raw_response(
+    _profile_cue_recording_id bigint
+)
+returns jsonb
+language sql
+stable
+as $$
+    select coalesce(
+        (
+            select res.raw_body::jsonb
+            from elevenlabs.recording_transcription_task t
+            join elevenlabs.recording_transcription_attempt a
+                on a.recording_transcription_task_id = t.recording_transcription_task_id
+            join elevenlabs.recording_transcription_request req
+                on req.recording_transcription_attempt_id = a.recording_transcription_attempt_id
+            join elevenlabs.recording_transcription_response res
+                on res.recording_transcription_request_id = req.recording_transcription_request_id
+            where t.profile_cue_recording_id = _profile_cue_recording_id
+            order by res.received_at desc
+            limit 1
+        ),
+        (
+            select jsonb_build_object(
+                'text', rt.text,
+                'words', rt.words,
+                'language_code', rt.language_code,
+                'language_probability', rt.language_probability
+            )
+            from learning.recording_transcript rt
+            where rt.profile_cue_recording_id = _profile_cue_recording_id
+        )
+    );
+$$;
+
+-- effect: create the archive's upload intent and enqueue its upload; a
+-- transcript is archived once
+create or replace function elevenlabs.schedule_recording_transcription_archive(
+    _profile_cue_recording_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _created_by bigint;
+    _upload_intent_id bigint;
+begin
+    if exists (
+        select 1
+        from elevenlabs.recording_transcription_archive
+        where profile_cue_recording_id = _profile_cue_recording_id
+    ) then
+        return;
+    end if;
+
+    select t.created_by
+    into _created_by
+    from elevenlabs.recording_transcription_task t
+    where t.profile_cue_recording_id = _profile_cue_recording_id
+    order by t.created_at desc
+    limit 1;
+
+    -- transcripts not requested through a transcription task have no owner
+    if _created_by is null then
+        return;
+    end if;
+
+    insert into files.upload_intent (
+        object_key,
+        bucket,
+        mime_type,
+        created_by
+    )
+    values (
+        files.generate_transcription_archive_object_key(_profile_cue_recording_id),
+        files.gcs_bucket(),
+        'application/json',
+        _created_by
+    )
+    returning upload_intent_id
+    into _upload_intent_id;
+
+    insert into elevenlabs.recording_transcription_archive (
+        profile_cue_recording_id,
+        upload_intent_id
+    )
+    values (
+        _profile_cue_recording_id,
+        _upload_intent_id
+    );
+
+    perform queues.enqueue(
+        'transcription_archive',
+        jsonb_build_object(
+            'task_type', 'transcription_archive',
+            'profile_cue_recording_id', _profile_cue_recording_id,
+            'upload_intent_id', _upload_intent_id,
+            'before_handler', 'elevenlabs.get_recording_transcription_archive_payload',
+            'success_handler', 'elevenlabs.record_recording_transcription_archive'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- trigger: archive every transcript once it is stored
+create or replace function elevenlabs.enqueue_recording_transcription_archive()
+returns trigger
+language plpgsql
+security definer
+as $$
+begin
+    perform elevenlabs.schedule_recording_transcription_archive(new.profile_cue_recording_id);
+    return new;
+end;
+$$;
+
+create trigger recording_transcript_archive
+after insert on learning.recording_transcript
+for each row
+execute function elevenlabs.enqueue_recording_transcription_archive();
+
+-- before handler: the response to archive and its upload intent
+-- receives: { profile_cue_recording_id, upload_intent_id, ... }
+create or replace function elevenlabs.get_recording_transcription_archive_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _profile_cue_recording_id bigint := (_payload->>'profile_cue_recording_id')::bigint;
+    _upload_intent_id bigint := (_payload->>'upload_intent_id')::bigint;
+    _response jsonb;
+begin
+    -- 1. VALIDATION
+    if _profile_cue_recording_id is null or _upload_intent_id is null then
+        return jsonb_build_object('status', 'missing_profile_cue_recording_id_or_upload_intent_id');
+    end if;
+
+    -- 2. FACTS
+    _response := elevenlabs.recording_transcription_raw_response(_profile_cue_recording_id);
+
+    -- 3. LOGIC
+    if _response is null then
+        return jsonb_build_object('status', 'transcription_response_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'profile_cue_recording_id', _profile_cue_recording_id,
+            'upload_intent_id', _upload_intent_id,
+            'response', _response
+        )
+    );
+end;
+$$;
+
+-- success handler: create the uploaded file and record it on the archive
+-- receives: { original_payload: { profile_cue_recording_id, upload_intent_id, ... }, worker_payload: { upload_intent_id, size_bytes } }
+create or replace function elevenlabs.record_recording_transcription_archive(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _profile_cue_recording_id bigint := (_payload->'original_payload'->>'profile_cue_recording_id')::bigint;
+    _upload_intent_id bigint := (_payload->'original_payload'->>'upload_intent_id')::bigint;
+    _upload_intent files.upload_intent;
+    _file_id bigint;
+begin
+    if _profile_cue_recording_id is null or _upload_intent_id is null then
+        return jsonb_build_object('status', 'missing_profile_cue_recording_id_or_upload_intent_id');
+    end if;
+
+    select *
+    into _upload_intent
+    from files.upload_intent
+    where upload_intent_id = _upload_intent_id;
+
+    if not found then
+        return jsonb_build_object('status', 'upload_intent_not_found');
+    end if;
+
+    insert into files.file (
+        bucket,
+        object_key,
+        mime_type
+    )
+    values (
+        _upload_intent.bucket,
+        _upload_intent.object_key,
+        _upload_intent.mime_type
+    )
+    on conflict (object_key) do nothing
+    returning file_id
+    into _file_id;
+
+    if _file_id is null then
+        select f.file_id
+        into _file_id
+        from files.file f
+        where f.object_key = _upload_intent.object_key;
+    end if;
+
+    update elevenlabs.recording_transcription_archive
+    set file_id = _file_id,
+        archived_at = now()
+    where profile_cue_recording_id = _profile_cue_recording_id;
+
+    return jsonb_build_object('status', 'succeeded', 'payload', jsonb_build_object('file_id', _file_id));
+end;
+$$;
+
+grant execute on function elevenlabs.get_recording_transcription_archive_payload(jsonb) to worker_service_user;
+grant execute on function elevenlabs.record_recording_transcription_archive(jsonb) to worker_service_user;
@@ -0,0 +1,139 @@
+-- transcription cost tracking
+--
+-- the worker now reports, with each kickoff, the model it asked for, the
+-- audio's duration (from the kickoff payload, or whisper's response) and the
+-- cost at its configured price per minute (WORKER_TRANSCRIPTION_PRICES over
+-- the providers' list prices). the success handler records them per attempt,
+-- so transcription spend can be aggregated per account. an attempt is
+-- charged once its request is accepted, whether or not a transcript follows.
+
+create table elevenlabs.recording_transcription_cost (
+    recording_transcription_attempt_id bigint primary key
+        references elevenlabs.recording_transcription_attempt(recording_transcription_attempt_id)
+        on delete cascade,
+    account_id bigint
+        references accounts.account(account_id)
+        on delete set null,
+    provider text not null,
+    model text,
+    duration_seconds numeric,
+    price_per_minute_usd numeric(12,6),
+    cost_usd numeric(12,6),
+    created_at timestamp with time zone not null default now()
+);
+
+create index recording_transcription_cost_account_idx
+    on elevenlabs.recording_transcription_cost (account_id, created_at);
+
+-- effect: record what an attempt's request costs; unknown values stay null
+create or replace function elevenlabs.record_recording_transcription_cost(
+    _recording_transcription_attempt_id bigint,
+    _provider text,
+    _worker_payload jsonb
+)
+returns void
+language sql
+as $$
+    insert into elevenlabs.recording_transcription_cost (
+        recording_transcription_attempt_id,
+        account_id,
+        provider,
+        model,
+        duration_seconds,
+        price_per_minute_usd,
+        cost_usd
+    ) values (
+        _recording_transcription_attempt_id,
+        elevenlabs.recording_transcription_attempt_account_id(_recording_transcription_attempt_id),
+        _provider,
+        nullif(_worker_payload->>'model', ''),
+        (_worker_payload->>'duration_seconds')::numeric,
+        (_worker_payload->>'price_per_minute_usd')::numeric,
+        (_worker_payload->>'cost_usd')::numeric
+    )
+    on conflict (recording_transcription_attempt_id) do nothing;
+$$;
+
+-- facts: an account's transcription spend in usd since a point in time;
+-- attempts of unknown cost are left out
+create or replace function elevenlabs.account_transcription_cost_usd(
+    _account_id bigint,
+    _since timestamp with time zone default now() - interval '30 days'
+)
+returns numeric
+language sql
+stable
+as $$
+    select coalesce(sum(c.cost_usd), 0)
+    from elevenlabs.recording_transcription_cost c
+    where c.account_id = _account_id
+      and c.created_at >= _since;
+$$;
+
+-- daily transcription spend per account and provider
+create or replace view elevenlabs.account_transcription_spend as
+select
+    c.account_id,
+    date_trunc('day', c.created_at) as day,
+    c.provider,
+    count(*) as attempts,
+    count(*) filter (where c.cost_usd is null) as unpriced_attempts,
+    coalesce(sum(c.duration_seconds), 0) as duration_seconds,
+    coalesce(sum(c.cost_usd), 0) as cost_usd
+from elevenlabs.recording_transcription_cost c
+group by c.account_id, date_trunc('day', c.created_at), c.provider;
+
+-- success handler: record request succeeded, with the provider that took it,
+-- its cost, and the transcript when the provider returned one
+-- receives: { original_payload: { recording_transcription_attempt_id, ... }, worker_payload: { provider, request_id, model?, duration_seconds?, price_per_minute_usd?, cost_usd?, transcript? } }
+create or replace function elevenlabs.record_recording_transcription_request_success(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _recording_transcription_attempt_id bigint := (_payload->'original_payload'->>'recording_transcription_attempt_id')::bigint;
+    _request_id text := (_payload->'worker_payload'->>'request_id');
+    _provider text := coalesce(nullif(_payload->'worker_payload'->>'provider', ''), 'elevenlabs');
+    _transcript jsonb := _payload->'worker_payload'->'transcript';
+begin
+    if _recording_transcription_attempt_id is null then
+        return jsonb_build_object('status', 'missing_recording_transcription_attempt_id');
+    end if;
+
+    if _request_id is null or _request_id = '' then
+        return jsonb_build_object('status', 'missing_request_id');
+    end if;
+
+    -- note: existence of this record IS the success fact (no separate succeeded table)
+    insert into elevenlabs.recording_transcription_request (
+        recording_transcription_attempt_id,
+        elevenlabs_request_id,
+        provider
+    ) values (
+        _recording_transcription_attempt_id,
+        _request_id,
+        _provider
+    )
+    on conflict (recording_transcription_attempt_id) do nothing;
+
+    perform elevenlabs.record_recording_transcription_cost(
+        _recording_transcription_attempt_id,
+        _provider,
+        _payload->'worker_payload'
+    );
+
+    -- synchronous providers: the transcript is the response; terminal
+    -- success is inferred from it as for a verified webhook
+    if jsonb_typeof(_transcript) = 'object' then
+        perform elevenlabs.record_recording_transcription_transcript(
+            _recording_transcription_attempt_id,
+            _transcript
+        );
+    end if;
+
+    return jsonb_build_object('status', 'succeeded');
+end;
+$$;
@@ -0,0 +1,372 @@
+-- image thumbnails: scaled-down copies of uploaded images
+--
+-- the thumbnail sizes are configured in files.thumbnail_size. when an image
+-- file is created, an upload intent is created for each size and an
+-- image_thumbnail task enqueued; the worker downloads the image, turns it
+-- upright by its exif orientation, scales it down to fit each size and
+-- uploads the thumbnails through signed upload urls. the success handler
+-- creates their files and links them to the image in files.file_thumbnail.
+-- images not uploaded through an upload intent have no owner and get none.
+
+alter domain queues.task_type drop constraint if exists task_type_allowed_values;
+
+alter domain queues.task_type
+    add constraint task_type_allowed_values
+    check (value in (
+        'db_function',
+        'email',
+        'email_batch',
+        'email_digest',
+        'calendar_invite',
+        'sms',
+        'file_delete',
+        'image_thumbnail',
+        'transcription_kickoff',
+        'transcription_poll',
+        'transcription_archive',
+        'transcript_cleanup',
+        'openai_response_create',
+        'openai_response_retrieve',
+        'signed_url_prewarm',
+        'task_archive',
+        'webhook',
+        'discord_message',
+        'telegram_message',
+        'push_notification',
+        'web_push',
+        'verify_otp_send',
+        'verify_otp_check',
+        'whatsapp_message'
+    ));
+
+-- configured sizes: images are scaled down, keeping their ratio, to fit
+-- max_width x max_height; a null bound leaves that side free
+create table files.thumbnail_size (
+    name text primary key,
+    max_width integer,
+    max_height integer,
+    created_at timestamp with time zone not null default now(),
+    constraint thumbnail_size_name_check check (name ~ '^[a-z0-9_]+$'),
+    constraint thumbnail_size_bounds_check check (
+        coalesce(max_width, 1) > 0
+        and coalesce(max_height, 1) > 0
+        and (max_width is not null or max_height is not null)
+    )
+);
+
+insert into files.thumbnail_size (name, max_width, max_height)
+values
+    ('small', 160, 160),
+    ('medium', 480, 480),
+    ('large', 1280, 1280)
+on conflict (name) do nothing;
+
+-- thumbnails: one per image and size; thumbnail_file_id is set once the
+-- upload succeeded
+create table files.file_thumbnail (
+    file_id bigint not null
+        references files.file(file_id)
+        on delete cascade,
+    name text not null
+        references files.thumbnail_size(name)
+        on delete cascade,
+    upload_intent_id bigint not null unique
+        references files.upload_intent(upload_intent_id)
+        on delete cascade,
+    thumbnail_file_id bigint
+        references files.file(file_id)
+        on delete set null,
+    width integer,
+    height integer,
+    created_at timestamp with time zone not null default now(),
+    generated_at timestamp with time zone,
+    primary key (file_id, name)
+);
+
+-- function: generate object key for an image's thumbnail
+create or replace function files.generate_thumbnail_object_key(
+    _file_id bigint,
+    _name text,
+    _mime_type files.mime_type
+)
+returns text
+language sql
+stable
+as $$
+    select 'thumbnails/'
+        || 'f-'
+        || _file_id::text
+        || '-'
+        || _name
+        || '-t-'
+        || extract(epoch from now())::bigint::text
+        || '.'
+        || files.mime_type_to_extension(_mime_type);
+$$;
+
+-- effect: create an upload intent for each size the image has no thumbnail
+-- for yet and enqueue the generation of those not generated yet
+create or replace function files.schedule_image_thumbnails(
+    _file_id bigint
+)
+returns void
+language plpgsql
+security definer
+as $$
+declare
+    _file files.file;
+    _created_by bigint;
+    _size record;
+    _upload_intent_id bigint;
+begin
+    select *
+    into _file
+    from files.file
+    where file_id = _file_id;
+
+    if not found
+        or _file.mime_type not in ('image/jpeg', 'image/png')
+        or _file.object_key like 'thumbnails/%' then
+        return;
+    end if;
+
+    select ui.created_by
+    into _created_by
+    from files.upload_intent ui
+    where ui.object_key = _file.object_key;
+
+    if _created_by is null then
+        return;
+    end if;
+
+    for _size in
+        select s.name
+        from files.thumbnail_size s
+        where not exists (
+            select 1
+            from files.file_thumbnail ft
+            where ft.file_id = _file_id
+              and ft.name = s.name
+        )
+        order by s.name
+    loop
+        insert into files.upload_intent (
+            object_key,
+            bucket,
+            mime_type,
+            created_by
+        )
+        values (
+            files.generate_thumbnail_object_key(_file_id, _size.name, _file.mime_type),
+            _file.bucket,
+            _file.mime_type,
+            _created_by
+        )
+        returning upload_intent_id
+        into _upload_intent_id;
+
+        insert into files.file_thumbnail (file_id, name, upload_intent_id)
+        values (_file_id, _size.name, _upload_intent_id);
+    end loop;
+
+    if not exists (
+        select 1
+        from files.file_thumbnail ft
+        where ft.file_id = _file_id
+          and ft.thumbnail_file_id is null
+    ) then
+        return;
+    end if;
+
+    perform queues.enqueue(
+        'image_thumbnail',
+        jsonb_build_object(
+            'task_type', 'image_thumbnail',
+            'file_id', _file_id,
+            'before_handler', 'files.get_image_thumbnail_payload',
+            'success_handler', 'files.record_image_thumbnails'
+        ),
+        now()
+    );
+end;
+$$;
+
+-- trigger: generate thumbnails for every image file once it is created
+create or replace function files.enqueue_image_thumbnails()
+returns trigger
+language plpgsql
+security definer
+as $$
+begin
+    perform files.schedule_image_thumbnails(new.file_id);
+    return new;
+end;
+$$;
+
+create trigger file_image_thumbnails
+after insert on files.file
+for each row
+when (new.mime_type in ('image/jpeg', 'image/png'))
+execute function files.enqueue_image_thumbnails();
+
+-- before handler: the image and its thumbnails still to generate
+-- receives: { file_id, ... }
+create or replace function files.get_image_thumbnail_payload(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+stable
+security definer
+as $$
+declare
+    _file_id bigint := (_payload->>'file_id')::bigint;
+    _mime_type files.mime_type;
+    _thumbnails jsonb;
+begin
+    -- 1. VALIDATION
+    if _file_id is null then
+        return jsonb_build_object('status', 'missing_file_id');
+    end if;
+
+    -- 2. FACTS
+    select f.mime_type
+    into _mime_type
+    from files.file f
+    where f.file_id = _file_id;
+
+    select coalesce(jsonb_agg(jsonb_build_object(
+        'name', ft.name,
+        'max_width', coalesce(s.max_width, 0),
+        'max_height', coalesce(s.max_height, 0),
+        'upload_intent_id', ft.upload_intent_id,
+        'object_key', ui.object_key
+    ) order by ft.name), '[]'::jsonb)
+    into _thumbnails
+    from files.file_thumbnail ft
+    join files.thumbnail_size s on s.name = ft.name
+    join files.upload_intent ui on ui.upload_intent_id = ft.upload_intent_id
+    where ft.file_id = _file_id
+      and ft.thumbnail_file_id is null;
+
+    -- 3. LOGIC
+    if _mime_type is null then
+        return jsonb_build_object('status', 'file_not_found');
+    end if;
+
+    -- 4. OUTPUT
+    return jsonb_build_object(
+        'status', 'succeeded',
+        'payload', jsonb_build_object(
+            'file_id', _file_id,
+            'mime_type', _mime_type,
+            'thumbnails', _thumbnails
+        )
+    );
+end;
+$$;
+
+-- success handler: create the uploaded thumbnails' files and link them to
+-- the image
+-- receives: { original_payload: { file_id, ... }, worker_payload: { file_id, width, height, orientation, thumbnails: [{ name, upload_intent_id, object_key, width, height, size_bytes }] } }
+create or replace function files.record_image_thumbnails(
+    _payload jsonb
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _file_id bigint := (_payload->'original_payload'->>'file_id')::bigint;
+    _thumbnail jsonb;
+    _upload_intent files.upload_intent;
+    _thumbnail_file_id bigint;
+    _linked integer := 0;
+begin
+    if _file_id is null then
+        return jsonb_build_object('status', 'missing_file_id');
+    end if;
+
+    for _thumbnail in
+        select value
+        from jsonb_array_elements(coalesce(_payload->'worker_payload'->'thumbnails', '[]'::jsonb))
+    loop
+        select ui.*
+        into _upload_intent
+        from files.upload_intent ui
+        join files.file_thumbnail ft on ft.upload_intent_id = ui.upload_intent_id
+        where ui.upload_intent_id = (_thumbnail->>'upload_intent_id')::bigint
+          and ft.file_id = _file_id;
+
+        if not found then
+            continue;
+        end if;
+
+        _thumbnail_file_id := null;
+
+        insert into files.file (
+            bucket,
+            object_key,
+            mime_type
+        )
+        values (
+            _upload_intent.bucket,
+            _upload_intent.object_key,
+            _upload_intent.mime_type
+        )
+        on conflict (object_key) do nothing
+        returning file_id
+        into _thumbnail_file_id;
+
+        if _thumbnail_file_id is null then
+            select f.file_id
+            into _thumbnail_file_id
+            from files.file f
+            where f.object_key = _upload_intent.object_key;
+        end if;
+
+        update files.file_thumbnail
+        set thumbnail_file_id = _thumbnail_file_id,
+            width = (_thumbnail->>'width')::integer,
+            height = (_thumbnail->>'height')::integer,
+            generated_at = now()
+        where upload_intent_id = _upload_intent.upload_intent_id;
+
+        _linked := _linked + 1;
+    end loop;
+
+    return jsonb_build_object('status', 'succeeded', 'payload', jsonb_build_object('linked', _linked));
+end;
+$$;
+
+-- lookup the generated thumbnails of an array of image file ids
+create or replace function files.lookup_file_thumbnails(
+    _file_ids bigint[]
+)
+returns jsonb
+language sql
+stable
+security definer
+as $$
+    select coalesce(
+        jsonb_agg(
+            jsonb_build_object(
+                'file_id', ft.file_id,
+                'name', ft.name,
+                'thumbnail_file_id', ft.thumbnail_file_id,
+                'width', ft.width,
+                'height', ft.height
+            )
+            order by ft.file_id, ft.name
+        ),
+        '[]'::jsonb
+    )
+    from files.file_thumbnail ft
+    where _file_ids is not null
+      and ft.file_id = any(_file_ids)
+      and ft.thumbnail_file_id is not null;
+$$;
+
+grant execute on function files.get_image_thumbnail_payload(jsonb) to worker_service_user;
+grant execute on function files.record_image_thumbnails(jsonb) to worker_service_user;
+grant execute on function files.lookup_file_thumbnails(bigint[]) to file_service_user;
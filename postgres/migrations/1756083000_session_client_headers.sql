@@ -0,0 +1,72 @@
+-- session client details: read from gateway headers instead of arguments
+--
+-- api.refresh_tokens took the device label and client ip as arguments, and
+-- being granted to anon, let any caller write them onto its session. the
+-- gateway now sets x-session-device and x-session-ip on every request it
+-- forwards to postgrest, overwriting whatever the client sent, and the
+-- function reads them (and the user agent) from the request headers.
+
+drop function if exists api.refresh_tokens(text, text, text, text);
+
+-- Refresh tokens function: refreshes access and refresh tokens within the token's
+-- session. device details come from the headers the gateway sets and are stored
+-- when present.
+create or replace function api.refresh_tokens(
+    refresh_token text
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _headers json := nullif(current_setting('request.headers', true), '')::json;
+    _access_token text;
+    _new_refresh_token text;
+    _validate_result record;
+    _session_id bigint;
+begin
+    if refresh_token is null then
+        raise exception 'Refresh Failed'
+            using detail = 'Missing Refresh Token',
+                  hint = 'missing_refresh_token';
+    end if;
+
+    _validate_result := auth.validate_token(refresh_token, 'refresh'::auth.token_use);
+
+    if _validate_result.validation_failure_message is not null then
+        raise exception 'Refresh Failed'
+            using detail = 'Invalid Refresh Token',
+                  hint = _validate_result.validation_failure_message;
+    end if;
+
+    _session_id := auth.token_session_id(refresh_token);
+    if _session_id is null then
+        _session_id := auth.create_session(_validate_result.account_id);
+    end if;
+
+    update auth.session s
+    set last_used_at = now(),
+        user_agent = coalesce(nullif(_headers->>'user-agent', ''), s.user_agent),
+        device = coalesce(nullif(_headers->>'x-session-device', ''), s.device),
+        ip_address = coalesce(nullif(_headers->>'x-session-ip', ''), s.ip_address)
+    where s.session_id = _session_id
+    and s.account_id = _validate_result.account_id
+    and s.revoked_at is null;
+
+    if not found then
+        raise exception 'Refresh Failed'
+            using detail = 'Invalid Refresh Token',
+                  hint = 'session_revoked';
+    end if;
+
+    _access_token := auth.create_access_token(_validate_result.account_id);
+    _new_refresh_token := auth.create_session_refresh_token(_validate_result.account_id, _session_id);
+
+    return jsonb_build_object(
+        'access_token', _access_token,
+        'refresh_token', _new_refresh_token
+    );
+end;
+$$;
+
+grant execute on function api.refresh_tokens(text) to anon;
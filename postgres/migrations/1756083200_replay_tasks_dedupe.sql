@@ -0,0 +1,86 @@
+-- replay tasks dedupe: replay each requested task once
+--
+-- api.replay_tasks compared the number of replayed tasks with the length of
+-- task_ids, so a task id given twice was reported as task_not_found. the
+-- input is now deduplicated first.
+
+-- api: requeue failed tasks as new tasks (admin only). payload replaces the
+-- original payload and is only accepted when replaying a single task. task ids
+-- given more than once are replayed once.
+create or replace function api.replay_tasks(
+    task_ids bigint[],
+    payload jsonb default null
+)
+returns jsonb
+language plpgsql
+security definer
+as $$
+declare
+    _authenticated_account_id bigint := auth.jwt_account_id();
+    _task_ids bigint[] := array(select distinct unnest(task_ids));
+    _original queues.task;
+    _replay_task_id bigint;
+    _replayed jsonb := '[]'::jsonb;
+begin
+    if not auth.is_admin_account(_authenticated_account_id) then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Unauthorized',
+                  hint = 'unauthorized_to_manage_tasks';
+    end if;
+
+    if cardinality(_task_ids) = 0 then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'task_ids_missing';
+    end if;
+
+    if replay_tasks.payload is not null then
+        if cardinality(_task_ids) > 1 then
+            raise exception 'Replay Tasks Failed'
+                using detail = 'Invalid Input',
+                      hint = 'edited_payload_requires_single_task';
+        end if;
+        if jsonb_typeof(replay_tasks.payload) is distinct from 'object' then
+            raise exception 'Replay Tasks Failed'
+                using detail = 'Invalid Input',
+                      hint = 'payload_not_object';
+        end if;
+    end if;
+
+    for _original in
+        select t.*
+        from queues.task t
+        where t.task_id = any(_task_ids)
+        order by t.task_id
+    loop
+        if not exists (select 1 from queues.task_dead_letter dl where dl.task_id = _original.task_id)
+        and not queues.task_last_attempt_failed(_original.task_id) then
+            raise exception 'Replay Tasks Failed'
+                using detail = format('Task %s has not failed', _original.task_id),
+                      hint = 'task_not_failed';
+        end if;
+
+        insert into queues.task (task_type, payload)
+        values (_original.task_type, coalesce(replay_tasks.payload, _original.payload))
+        returning task_id into _replay_task_id;
+
+        insert into queues.task_replay (replay_task_id, original_task_id, payload_edited, replayed_by)
+        values (_replay_task_id, _original.task_id, replay_tasks.payload is not null, _authenticated_account_id);
+
+        _replayed := _replayed || jsonb_build_object(
+            'original_task_id', _original.task_id,
+            'replay_task_id', _replay_task_id
+        );
+    end loop;
+
+    if jsonb_array_length(_replayed) <> cardinality(_task_ids) then
+        raise exception 'Replay Tasks Failed'
+            using detail = 'Invalid Input',
+                  hint = 'task_not_found';
+    end if;
+
+    return _replayed;
+end;
+$$;
+
+grant execute on function api.replay_tasks(bigint[], jsonb) to authenticated;
@@ -0,0 +1,74 @@
+// Package apierror defines the JSON error envelope returned by Chatterbox's
+// internal HTTP services, so callers can branch on a stable code instead of
+// the status text:
+//
+//	{"code": "not_found", "message": "file not found", "request_id": "..."}
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+)
+
+// Error codes. They describe what the caller can do about the error, in
+// line with the worker's error classes: invalid_request, invalid_json,
+// unauthorized, forbidden, not_found, method_not_allowed and invalid_range
+// will not succeed on retry; internal and unavailable may.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInvalidRange     = "invalid_range"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+)
+
+// maxErrorBodyBytes bounds how much of an error response Read consumes.
+const maxErrorBodyBytes = 64 << 10
+
+// Error is the JSON error envelope.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Write responds with status and an error envelope. The request id is taken
+// from the request context (see middleware.RequestIDMiddleware), falling
+// back to the X-Request-ID header.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	requestID, _ := r.Context().Value(logger.RequestIDKey).(string)
+	if requestID == "" {
+		requestID = r.Header.Get("X-Request-ID")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Error{Code: code, Message: message, RequestID: requestID})
+}
+
+// Read decodes the error envelope of a failed response. It returns nil when
+// the body is not an envelope, e.g. from a proxy in front of the service.
+func Read(resp *http.Response) *Error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if err != nil {
+		return nil
+	}
+	var e Error
+	if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+		return nil
+	}
+	return &e
+}
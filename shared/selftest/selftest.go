@@ -0,0 +1,100 @@
+// Package selftest runs a binary's startup checks (configuration,
+// dependencies) and prints a structured report, for use as a deploy gate and
+// when debugging a broken environment.
+package selftest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Check is the outcome of one self-test step.
+type Check struct {
+	Name       string `json:"name"`
+	OK         bool   `json:"ok"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the full self-test result for a service.
+type Report struct {
+	Service string  `json:"service"`
+	OK      bool    `json:"ok"`
+	Checks  []Check `json:"checks"`
+}
+
+// Runner accumulates checks into a Report.
+type Runner struct {
+	report Report
+}
+
+// New returns a Runner for service.
+func New(service string) *Runner {
+	return &Runner{report: Report{Service: service, OK: true}}
+}
+
+// Check runs fn as the named step and records its outcome. A panic in fn
+// (e.g. from configuration loading) is recorded as a failure. It returns
+// whether the step passed, so dependent steps can be skipped.
+func (r *Runner) Check(name string, fn func() error) (ok bool) {
+	start := time.Now()
+	check := Check{Name: name}
+	defer func() {
+		if p := recover(); p != nil {
+			check.Error = fmt.Sprint(p)
+			ok = false
+		}
+		check.OK = ok
+		check.DurationMS = time.Since(start).Milliseconds()
+		if !ok {
+			r.report.OK = false
+		}
+		r.report.Checks = append(r.report.Checks, check)
+	}()
+
+	if err := fn(); err != nil {
+		check.Error = err.Error()
+		return false
+	}
+	return true
+}
+
+// Skip records the named step as not run because a step it depends on failed.
+func (r *Runner) Skip(name, reason string) {
+	r.report.OK = false
+	r.report.Checks = append(r.report.Checks, Check{Name: name, Skipped: true, Error: reason})
+}
+
+// Finish writes the report as indented JSON to w and returns the process exit
+// code: 0 when every step passed, 1 otherwise.
+func (r *Runner) Finish(w io.Writer) int {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(r.report)
+	if r.report.OK {
+		return 0
+	}
+	return 1
+}
+
+// CheckHTTP sends req and fails unless the dependency answers and accepts
+// the request's credentials: transport errors, 401, 403 and 5xx are failures.
+func CheckHTTP(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s %s rejected credentials: status %d", req.Method, req.URL, resp.StatusCode)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s %s returned status %d", req.Method, req.URL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+// Command queuectl inspects and manages the task queue from a shell.
+//
+//	queuectl list-pending [-type T] [-limit N]
+//	queuectl list-failed [-dead-lettered] [-limit N]
+//	queuectl show TASK_ID
+//	queuectl requeue TASK_ID...
+//	queuectl cancel [-reason R] TASK_ID...
+//	queuectl purge -before (RFC3339 | DURATION) [-yes]
+//	queuectl fleet [-all] [-stale DURATION]
+//
+// It connects with DATABASE_URL, like the worker.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/database"
+)
+
+const usage = `usage: queuectl <command> [flags] [args]
+
+commands:
+  list-pending [-type T] [-limit N]        tasks not completed yet, soonest first
+  list-failed [-dead-lettered] [-limit N]  failed tasks, newest first
+  show TASK_ID                             a task's payload, state, result, errors and events
+  requeue TASK_ID...                       enqueue a copy of each task to run now
+  cancel [-reason R] TASK_ID...            complete pending tasks without running them
+  purge -before TIME [-yes]                delete tasks completed before TIME
+                                           (RFC3339, or a duration such as 720h)
+  fleet [-all] [-stale D]                  worker instances: status, pool size,
+                                           in-flight tasks, last heartbeat and poll
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	databaseURL := strings.TrimSpace(os.Getenv("DATABASE_URL"))
+	if databaseURL == "" {
+		fail(fmt.Errorf("DATABASE_URL is required"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.NewClient(databaseURL, database.Options{})
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "list-pending":
+		err = listPending(ctx, db, args)
+	case "list-failed":
+		err = listFailed(ctx, db, args)
+	case "show":
+		err = show(ctx, db, args)
+	case "requeue":
+		err = requeue(ctx, db, args)
+	case "cancel":
+		err = cancel(ctx, db, args)
+	case "purge":
+		err = purge(ctx, db, args)
+	case "fleet":
+		err = fleet(ctx, db, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+func listPending(ctx context.Context, db *database.Client, args []string) error {
+	fs := flag.NewFlagSet("list-pending", flag.ExitOnError)
+	taskType := fs.String("type", "", "only tasks of this task type")
+	limit := fs.Int("limit", 50, "maximum number of tasks")
+	_ = fs.Parse(args)
+
+	tasks, err := db.PendingTasks(ctx, *taskType, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := newTable(os.Stdout, "TASK_ID", "TYPE", "SCHEDULED_AT", "LEASED_UNTIL", "ERRORS", "PAYLOAD")
+	for _, t := range tasks {
+		row(tw, t.TaskID, t.TaskType, formatTime(t.ScheduledAt), formatTime(t.LeasedUntil), t.ErrorCount, truncate(string(t.Payload), 60))
+	}
+	return tw.Flush()
+}
+
+func listFailed(ctx context.Context, db *database.Client, args []string) error {
+	fs := flag.NewFlagSet("list-failed", flag.ExitOnError)
+	deadLettered := fs.Bool("dead-lettered", false, "only dead-lettered tasks")
+	limit := fs.Int("limit", 50, "maximum number of tasks")
+	_ = fs.Parse(args)
+
+	tasks, err := db.FailedTasks(ctx, *deadLettered, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := newTable(os.Stdout, "TASK_ID", "TYPE", "COMPLETED_AT", "DEAD_LETTERED", "CLASS", "ERRORS", "REPLAYS", "LAST_ERROR")
+	for _, t := range tasks {
+		row(tw, t.TaskID, t.TaskType, formatTime(t.CompletedAt), t.DeadLettered, orDash(t.ErrorClass), t.ErrorCount, t.ReplayCount, truncate(t.LastError, 80))
+	}
+	return tw.Flush()
+}
+
+func show(ctx context.Context, db *database.Client, args []string) error {
+	ids, err := parseTaskIDs(args, 1)
+	if err != nil {
+		return err
+	}
+	taskID := ids[0]
+
+	task, err := db.TaskStatus(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task %d not found", taskID)
+	}
+	taskErrors, err := db.TaskErrors(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	events, err := db.TaskEvents(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	result, err := db.TaskResult(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	state := "pending"
+	switch {
+	case task.Cancelled:
+		state = "cancelled"
+	case task.DeadLettered:
+		state = "dead_lettered"
+	case task.CompletedAt != nil:
+		state = "completed"
+	case task.LeasedUntil != nil:
+		state = "leased"
+	}
+
+	fmt.Printf("task_id:       %d\n", task.TaskID)
+	fmt.Printf("task_type:     %s\n", task.TaskType)
+	fmt.Printf("state:         %s\n", state)
+	fmt.Printf("enqueued_at:   %s\n", formatTime(&task.EnqueuedAt))
+	fmt.Printf("scheduled_at:  %s\n", formatTime(task.ScheduledAt))
+	fmt.Printf("leased_until:  %s\n", formatTime(task.LeasedUntil))
+	fmt.Printf("completed_at:  %s\n", formatTime(task.CompletedAt))
+	fmt.Println("payload:")
+	fmt.Println(indentJSON(task.Payload))
+	if result != nil {
+		fmt.Println("result:")
+		fmt.Println(indentJSON(result))
+	}
+
+	fmt.Printf("\nerrors (%d):\n", len(taskErrors))
+	tw := newTable(os.Stdout, "ERROR_ID", "CREATED_AT", "MESSAGE")
+	for _, e := range taskErrors {
+		row(tw, e.ErrorID, formatTime(&e.CreatedAt), e.ErrorMessage)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nevents (%d):\n", len(events))
+	tw = newTable(os.Stdout, "EVENT_ID", "CREATED_AT", "TYPE", "DETAILS")
+	for _, e := range events {
+		row(tw, e.TaskEventID, formatTime(&e.CreatedAt), e.EventType, compactJSON(e.Details))
+	}
+	return tw.Flush()
+}
+
+func requeue(ctx context.Context, db *database.Client, args []string) error {
+	ids, err := parseTaskIDs(args, -1)
+	if err != nil {
+		return err
+	}
+	for _, taskID := range ids {
+		requeuedTaskID, err := db.RequeueTask(ctx, taskID)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", taskID, err)
+		}
+		fmt.Printf("task %d requeued as task %d\n", taskID, requeuedTaskID)
+	}
+	return nil
+}
+
+func cancel(ctx context.Context, db *database.Client, args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ExitOnError)
+	reason := fs.String("reason", "", "why the tasks are cancelled")
+	_ = fs.Parse(args)
+
+	ids, err := parseTaskIDs(fs.Args(), -1)
+	if err != nil {
+		return err
+	}
+	for _, taskID := range ids {
+		cancelled, err := db.CancelTask(ctx, taskID, *reason)
+		if err != nil {
+			return fmt.Errorf("task %d: %w", taskID, err)
+		}
+		if cancelled {
+			fmt.Printf("task %d cancelled\n", taskID)
+		} else {
+			fmt.Printf("task %d was already completed\n", taskID)
+		}
+	}
+	return nil
+}
+
+func purge(ctx context.Context, db *database.Client, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	before := fs.String("before", "", "delete tasks completed before this time (RFC3339, or a duration ago such as 720h)")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	_ = fs.Parse(args)
+
+	if *before == "" {
+		return fmt.Errorf("purge requires -before")
+	}
+	cutoff, err := parseCutoff(*before, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		fmt.Printf("delete all tasks completed before %s, with their errors and history? [y/N] ", cutoff.Format(time.RFC3339))
+		var answer string
+		_, _ = fmt.Scanln(&answer)
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			fmt.Println("aborted")
+			return nil
+		}
+	}
+
+	purged, err := db.PurgeTasks(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d tasks\n", purged)
+	return nil
+}
+
+// parseCutoff accepts an RFC3339 timestamp or a Go duration meaning that long
+// before now.
+func fleet(ctx context.Context, db *database.Client, args []string) error {
+	fs := flag.NewFlagSet("fleet", flag.ExitOnError)
+	all := fs.Bool("all", false, "include stopped instances")
+	stale := fs.Duration("stale", 45*time.Second, "report instances without a heartbeat for this long as stale")
+	_ = fs.Parse(args)
+
+	instances, err := db.WorkerFleet(ctx, *stale, *all)
+	if err != nil {
+		return err
+	}
+
+	tw := newTable(os.Stdout, "INSTANCE", "STATUS", "VERSION", "CONCURRENCY", "IN_FLIGHT", "STARTED_AT", "LAST_HEARTBEAT_AT", "LAST_POLL_AT")
+	for _, i := range instances {
+		row(tw, i.ID, i.Status, i.Version, i.Concurrency, formatInFlight(i.InFlight), formatTime(&i.StartedAt), formatTime(&i.LastHeartbeatAt), formatTime(i.LastPollAt))
+	}
+	return tw.Flush()
+}
+
+// formatInFlight renders in-flight counts as "total (type=n,...)".
+func formatInFlight(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "0"
+	}
+	taskTypes := make([]string, 0, len(counts))
+	total := 0
+	for taskType, n := range counts {
+		taskTypes = append(taskTypes, taskType)
+		total += n
+	}
+	sort.Strings(taskTypes)
+	for i, taskType := range taskTypes {
+		taskTypes[i] = fmt.Sprintf("%s=%d", taskType, counts[taskType])
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(taskTypes, ","))
+}
+
+func parseCutoff(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid -before %q: must be RFC3339 or a positive duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+// parseTaskIDs parses task ID arguments. want is the exact number expected, or
+// -1 for one or more.
+func parseTaskIDs(args []string, want int) ([]int64, error) {
+	if len(args) == 0 || (want > 0 && len(args) != want) {
+		return nil, fmt.Errorf("expected task id argument(s)")
+	}
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid task id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func newTable(w io.Writer, headers ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	return tw
+}
+
+func row(tw *tabwriter.Writer, cells ...any) {
+	parts := make([]string, len(cells))
+	for i, c := range cells {
+		parts[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(tw, strings.Join(parts, "\t"))
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens s to n runes on a single line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func indentJSON(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	b, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return string(raw)
+	}
+	return "  " + string(b)
+}
+
+func compactJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "{}"
+	}
+	return truncate(string(raw), 100)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "queuectl: %v\n", err)
+	os.Exit(1)
+}
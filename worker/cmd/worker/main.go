@@ -2,19 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/shared/tracing"
 	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/httpserver"
+	"github.com/bencyrus/chatterbox/worker/internal/simulate"
 	"github.com/bencyrus/chatterbox/worker/internal/worker"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
+	selftestFlag := flag.Bool("selftest", false, "validate config and dependencies, print a JSON report, and exit")
+	simulateFlag := flag.String("simulate", "", "run the tasks in this fixture file against mock providers and exit")
+	mockProvidersFlag := flag.Bool("mock-providers", false, "answer provider and files service calls with mocks instead of the network")
+	recordDirFlag := flag.String("record-dir", "simulate-out", "directory mock providers record outbound requests to")
+	flag.Parse()
+	if *selftestFlag {
+		os.Exit(runSelftest())
+	}
+	if *simulateFlag != "" {
+		os.Exit(runSimulate(*simulateFlag, *recordDirFlag))
+	}
+
+	// Load configuration. With mock providers the worker still runs against
+	// DATABASE_URL (a dev queue), but provider credentials are optional.
+	var cfg config.Config
+	if *mockProvidersFlag {
+		cfg = config.LoadSimulation()
+		if cfg.DatabaseURL == "" {
+			log.Fatalf("DATABASE_URL is required with -mock-providers")
+		}
+		transport, err := simulate.NewTransport(*recordDirFlag, cfg.FileServiceURL, nil)
+		if err != nil {
+			log.Fatalf("failed to set up mock providers: %v", err)
+		}
+		transport.Install()
+	} else {
+		cfg = config.Load()
+	}
 
 	// Initialize logger
 	logger.Init("worker")
@@ -25,8 +58,19 @@ func main() {
 		"max_idle_time": cfg.MaxIdleTime,
 		"log_level":     cfg.LogLevel,
 		"concurrency":   cfg.Concurrency,
+		"health_port":   cfg.HealthPort,
 	})
 
+	// Initialize tracing (no-op unless an OTLP endpoint is configured)
+	shutdownTracing, err := tracing.Init(ctx, "worker")
+	if err != nil {
+		logger.Error(ctx, "failed to initialize tracing", err)
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		_ = shutdownTracing(context.Background())
+	}()
+
 	// Create worker
 	w, err := worker.NewWorker(cfg)
 	if err != nil {
@@ -49,6 +93,24 @@ func main() {
 		cancel()
 	}()
 
+	// Health and readiness probes
+	srv := &http.Server{
+		Addr:              ":" + cfg.HealthPort,
+		Handler:           httpserver.NewHandler(w, cfg),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info(ctx, "worker health server starting", logger.Fields{"address": srv.Addr})
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(ctx, "worker health server error", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
 	// Start worker
 	logger.Info(ctx, "worker starting main loop")
 	if err := w.Run(ctx); err != nil && err != context.Canceled {
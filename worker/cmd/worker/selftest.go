@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/selftest"
+	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/database"
+)
+
+// selftestTimeout bounds the whole self-test so a hung dependency fails the
+// deploy gate instead of stalling it.
+const selftestTimeout = 30 * time.Second
+
+// runSelftest validates configuration, connects to the database, runs the
+// no-op internal.selftest function through internal.run_function, and checks
+// the files service accepts the API key. It returns the process exit code.
+func runSelftest() int {
+	ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+	defer cancel()
+
+	r := selftest.New("worker")
+
+	var cfg config.Config
+	if !r.Check("config", func() error {
+		cfg = config.Load()
+		return nil
+	}) {
+		r.Skip("database", "config failed")
+		r.Skip("db_function", "config failed")
+		r.Skip("files_service", "config failed")
+		return r.Finish(os.Stdout)
+	}
+
+	var db *database.Client
+	if r.Check("database", func() error {
+		var err error
+		db, err = database.NewClient(cfg.DatabaseURL, database.Options{DequeueMode: cfg.DequeueMode})
+		return err
+	}) {
+		defer db.Close()
+		r.Check("db_function", func() error {
+			result, err := db.RunFunction(ctx, "internal.selftest", json.RawMessage(`{}`))
+			if err != nil {
+				return err
+			}
+			if !result.IsSuccess() {
+				return fmt.Errorf("internal.selftest returned status %q", result.Status)
+			}
+			return nil
+		})
+	} else {
+		r.Skip("db_function", "database failed")
+	}
+
+	r.Check("files_service", func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimRight(cfg.FileServiceURL, "/")+"/signed_object_url",
+			bytes.NewReader([]byte(`{"objects":[]}`)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-File-Service-Api-Key", cfg.FileServiceAPIKey)
+		return selftest.CheckHTTP(&http.Client{Timeout: 10 * time.Second}, req)
+	})
+
+	return r.Finish(os.Stdout)
+}
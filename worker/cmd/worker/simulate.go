@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/simulate"
+	"github.com/bencyrus/chatterbox/worker/internal/worker"
+)
+
+// runSimulate runs the tasks in the fixture at path against mock providers.
+// Their outbound requests are recorded to recordDir next to results.jsonl,
+// one JSON result per task, since logs go to stdout. It needs no database or
+// provider credentials and returns the process exit code.
+func runSimulate(path, recordDir string) int {
+	fixture, err := simulate.LoadFixture(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	cfg := config.LoadSimulation()
+	logger.Init("worker")
+
+	transport, err := simulate.NewTransport(recordDir, cfg.FileServiceURL, fixture.Files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	transport.Install()
+
+	out, err := os.Create(filepath.Join(recordDir, "results.jsonl"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer out.Close()
+
+	if err := worker.Simulate(context.Background(), cfg, fixture, out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,192 @@
+// Package breaker wraps outbound provider calls in a circuit breaker, so a
+// provider that keeps failing stops receiving requests for a cooldown instead
+// of every task burning its retries against it.
+//
+// A breaker is closed while calls succeed. After threshold consecutive
+// failures (transport errors, 408 and 5xx responses) it opens and rejects
+// calls with an unavailable error; the worker reschedules those tasks without
+// counting a failure. Once the cooldown has passed it half-opens and lets a
+// single probe through: success closes it, failure opens it again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// State is a breaker's state. Its numeric value is exported as the
+// provider_circuit_state metric.
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "closed"
+}
+
+// Breaker is the circuit breaker for one provider. A nil *Breaker lets every
+// call through.
+type Breaker struct {
+	provider  string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New returns a breaker for provider that opens after threshold consecutive
+// failures and half-opens after cooldown. It returns nil when threshold is 0,
+// disabling the breaker.
+func New(provider string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	metrics.ProviderCircuitState.WithLabelValues(provider).Set(float64(Closed))
+	return &Breaker{provider: provider, threshold: threshold, cooldown: cooldown}
+}
+
+// State reports the breaker's current state.
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Transport wraps base so requests go through the breaker. With a nil
+// breaker it returns base unchanged.
+func (b *Breaker) Transport(base http.RoundTripper) http.RoundTripper {
+	if b == nil {
+		return base
+	}
+	return &transport{breaker: b, base: base}
+}
+
+type transport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker
+	ctx := req.Context()
+
+	if retryAfter, ok := b.allow(ctx); !ok {
+		metrics.ProviderCircuitRejected.WithLabelValues(b.provider).Inc()
+		return nil, types.Unavailable(fmt.Errorf("%s circuit open", b.provider), retryAfter)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && types.ErrorClass(err) != nil:
+		// Rejected before reaching the provider (e.g. by the rate
+		// limiter); says nothing about the provider's health.
+		b.release()
+	case err != nil && errors.Is(err, context.Canceled):
+		b.release()
+	case err != nil, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode >= 500:
+		b.failure(ctx)
+	default:
+		b.success(ctx)
+	}
+	return resp, err
+}
+
+// allow reports whether a call may proceed and, when not, how long until the
+// breaker half-opens.
+func (b *Breaker) allow(ctx context.Context) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+		b.transition(ctx, HalfOpen)
+		b.probing = true
+		return 0, true
+	case HalfOpen:
+		if b.probing {
+			return b.cooldown, false
+		}
+		b.probing = true
+		return 0, true
+	}
+	return 0, true
+}
+
+// release ends a call that did not reach the provider without counting it.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *Breaker) success(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != Closed {
+		b.transition(ctx, Closed)
+	}
+}
+
+func (b *Breaker) failure(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.transition(ctx, Open)
+	}
+}
+
+// transition moves to state, logging it and updating the state metric. The
+// caller holds b.mu.
+func (b *Breaker) transition(ctx context.Context, state State) {
+	fields := logger.Fields{
+		"provider": b.provider,
+		"from":     b.state.String(),
+		"to":       state.String(),
+		"failures": b.failures,
+	}
+	b.state = state
+	metrics.ProviderCircuitState.WithLabelValues(b.provider).Set(float64(state))
+
+	if state == Open {
+		fields["cooldown"] = b.cooldown
+		logger.Warn(ctx, "provider circuit opened", fields)
+		return
+	}
+	logger.Info(ctx, "provider circuit state changed", fields)
+}
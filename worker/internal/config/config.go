@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -8,9 +9,25 @@ import (
 	"time"
 )
 
+// Queue is a named queue: the task types its pool claims, how many
+// goroutines serve it, and how long each waits between empty polls.
+type Queue struct {
+	Name         string
+	TaskTypes    []string
+	Concurrency  int
+	PollInterval time.Duration
+}
+
 type Config struct {
 	// Database
 	DatabaseURL string
+	// Connection pool limits. DBMaxOpenConns caps open connections;
+	// DBMinConns connections are kept open even when idle; connections
+	// older than DBConnMaxLifetime are replaced. Zero keeps the pool_*
+	// parameters of DatabaseURL, or the pgx defaults.
+	DBMaxOpenConns    int
+	DBMinConns        int
+	DBConnMaxLifetime time.Duration
 
 	// Services
 	ResendAPIKey      string
@@ -18,17 +35,317 @@ type Config struct {
 	FileServiceAPIKey string
 	ElevenLabsAPIKey  string
 	OpenAIAPIKey      string
+	TelegramBotToken  string
+	// TranscriptionProvider kicks off transcriptions (elevenlabs, deepgram
+	// or whisper; default elevenlabs). TranscriptionFallbackProvider, when
+	// set, takes over when the primary fails transiently. Deepgram posts
+	// its results to DeepgramCallbackURL, the public URL of
+	// /rpc/deepgram_transcription_webhook. Recordings known to be at most
+	// WhisperMaxSeconds long are transcribed synchronously by Whisper
+	// instead; 0 sends only those that name it there. TranscriptionPrices
+	// overrides the list price, in USD per audio minute, of providers or
+	// provider/model pairs when pricing kickoffs.
+	TranscriptionProvider         string
+	TranscriptionFallbackProvider string
+	DeepgramAPIKey                string
+	DeepgramCallbackURL           string
+	WhisperMaxSeconds             float64
+	TranscriptionPrices           map[string]float64
+	// EmailProvider sends email (resend, ses or sendgrid; default resend).
+	// EmailFallbackProvider, when set, takes over when the primary fails
+	// transiently. SES calls are signed with SESAccessKeyID and
+	// SESSecretAccessKey and go to SESRegion.
+	EmailProvider         string
+	EmailFallbackProvider string
+	SESRegion             string
+	SESAccessKeyID        string
+	SESSecretAccessKey    string
+	SendGridAPIKey        string
+	// EmailMode is send (deliver through the providers above) or capture,
+	// which delivers every email to the catch-all SMTP server at
+	// EmailCaptureSMTPAddr (e.g. Mailpit) or, without one, stores it in
+	// comms.captured_email, so local and staging environments never email
+	// real users.
+	EmailMode            string
+	EmailCaptureSMTPAddr string
+	// ResendWebhookSecret is the signing secret ("whsec_...") of the Resend
+	// webhook posting to the worker's /webhooks/resend route; the route is
+	// served only when it is set.
+	ResendWebhookSecret string
+	// Twilio account SMS is sent from; without an account SID the worker
+	// only logs SMS. Messages go out from TwilioMessagingServiceSID when
+	// set, otherwise from TwilioFromNumber. TwilioStatusCallbackURL is the
+	// public URL of the worker's /webhooks/twilio/sms-status route; when
+	// set, messages ask Twilio to post their delivery status there and the
+	// route is served. TwilioInboundSMSURL is likewise the public URL of
+	// /webhooks/twilio/sms-inbound, which records STOP and START replies.
+	// TwilioVerifyServiceSID is the Verify service OTP tasks use.
+	TwilioAccountSID          string
+	TwilioAuthToken           string
+	TwilioFromNumber          string
+	TwilioMessagingServiceSID string
+	TwilioStatusCallbackURL   string
+	TwilioInboundSMSURL       string
+	TwilioVerifyServiceSID    string
+	VonageAPIKey              string
+	VonageAPISecret           string
+	VonageFrom                string
+	// SMSProvider sends SMS (twilio, vonage or console; default twilio
+	// when TwilioAccountSID is set, otherwise console). SMSFallbackProvider,
+	// when set, takes over when the primary fails transiently.
+	SMSProvider         string
+	SMSFallbackProvider string
+	// SMSDefaultCountry is the ISO 3166-1 alpha-2 country whose national
+	// numbers SMS recipients without a country code are read as; empty
+	// requires international numbers.
+	SMSDefaultCountry string
+	// SMSSuppressionFunction is asked before each send whether the recipient
+	// opted out; suppressed messages are not sent. Empty disables the check.
+	SMSSuppressionFunction string
+	// SMSMaxSegments caps the segments (160 GSM-7 or 70 UCS-2 characters,
+	// fewer per part once concatenated) an SMS body may cost; 0 disables
+	// the cap. SMSSegmentOverflow is reject (a validation failure) or
+	// truncate (the body is cut to the cap).
+	SMSMaxSegments     int
+	SMSSegmentOverflow string
+	// Firebase Cloud Messaging: the project and the service account the
+	// worker signs its OAuth token requests with. Push tasks fail
+	// permanently while they are unset.
+	FCMProjectID                string
+	FCMServiceAccountEmail      string
+	FCMServiceAccountPrivateKey string
+	// Apple Push Notification service, used directly for devices registered
+	// with APNs tokens: the team and .p8 signing key of the provider token,
+	// the app's bundle id (topic), and whether to use the sandbox gateway
+	// (development builds).
+	APNsTeamID     string
+	APNsKeyID      string
+	APNsPrivateKey string
+	APNsTopic      string
+	APNsSandbox    bool
+	// Web Push: the VAPID key pair's private half (base64url, as printed
+	// by the usual key generators) and the contact sent to push services.
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+	// WhatsApp Business Cloud API: a system user access token and the id
+	// of the business phone number messages are sent from.
+	WhatsAppAccessToken   string
+	WhatsAppPhoneNumberID string
 
 	// Worker settings
 	PollInterval time.Duration
-	MaxIdleTime  time.Duration
-	Concurrency  int
+	// MaxPollInterval caps the idle backoff of the pool and named queue
+	// pollers: each empty poll doubles the wait from their poll interval up
+	// to this, and a hit snaps back. Values at or below the poll interval
+	// keep polling at a fixed (jittered) rate.
+	MaxPollInterval time.Duration
+	MaxIdleTime     time.Duration
+	Concurrency     int
+	// AutoscaleEnabled replaces the fixed Concurrency with a pool that is
+	// resized every AutoscaleInterval from the sampled queue depth, running
+	// one goroutine per AutoscaleTasksPerWorker ready tasks, bounded by
+	// MinConcurrency and MaxConcurrency.
+	AutoscaleEnabled        bool
+	MinConcurrency          int
+	MaxConcurrency          int
+	AutoscaleInterval       time.Duration
+	AutoscaleTasksPerWorker int
+	// DequeueBatchSize > 1 switches the worker to batch mode: a single fetcher
+	// claims up to this many tasks per round-trip and hands them to the
+	// worker goroutines over a channel.
+	DequeueBatchSize int
+	// DequeueMode selects how tasks are claimed: "function" (default) or
+	// "skip_locked" for schemas without the queues dequeue functions.
+	DequeueMode string
+
+	// TaskTypeWeights splits each dequeue cycle between task types by weight
+	// (e.g. email=5,file_delete=1); unlisted types share what the weighted
+	// types leave unclaimed. TaskTypePollIntervals gives listed task types a
+	// dedicated poller that checks for them on its own, usually shorter,
+	// interval.
+	TaskTypeWeights       map[string]int
+	TaskTypePollIntervals map[string]time.Duration
+
+	// InteractiveConcurrency goroutines are reserved for tasks whose payload
+	// sets priority "interactive" (e.g. live-classroom transcriptions); they
+	// poll every InteractivePollInterval and claim nothing else, so those
+	// tasks are not queued behind bulk work. 0 disables the lane.
+	// ElevenLabsInteractiveModel, when set, replaces the default ElevenLabs
+	// model for interactive transcription kickoffs.
+	InteractiveConcurrency     int
+	InteractivePollInterval    time.Duration
+	ElevenLabsInteractiveModel string
+
+	// Queues are named sets of task types (e.g. messaging=email|sms), each
+	// served by its own pool of goroutines that claims nothing else, so a
+	// noisy workload cannot starve the others. The shared pool no longer
+	// claims their task types.
+	Queues []Queue
+
+	// Outbound rate limits in requests per second, one token bucket per
+	// provider shared by all goroutines; 0 disables a limit. A call that
+	// would wait longer than RateLimitMaxWait for a token is rejected as
+	// rate limited and its task rescheduled.
+	ResendRPS        float64
+	SESRPS           float64
+	SendGridRPS      float64
+	ElevenLabsRPS    float64
+	DeepgramRPS      float64
+	OpenAIRPS        float64
+	FileServiceRPS   float64
+	DiscordRPS       float64
+	TelegramRPS      float64
+	FCMRPS           float64
+	APNsRPS          float64
+	WebPushRPS       float64
+	TwilioRPS        float64
+	VonageRPS        float64
+	VerifyRPS        float64
+	WhatsAppRPS      float64
+	RateLimitMaxWait time.Duration
+
+	// Per-provider circuit breakers: after CircuitFailureThreshold
+	// consecutive failed calls a provider is not called for CircuitCooldown
+	// and its tasks are rescheduled without using up retries. A threshold of
+	// 0 disables the breakers.
+	CircuitFailureThreshold int
+	CircuitCooldown         time.Duration
+
+	// MaxTaskRetries bounds worker-level retries of retryable/rate-limited
+	// failures; once spent the error handler runs. RetryBaseDelay is doubled
+	// per recorded failure (capped at MaxRetryDelay).
+	MaxTaskRetries int
+	RetryBaseDelay time.Duration
+	MaxRetryDelay  time.Duration
+	// TaskTypeMaxAttempts overrides, per task type, how many times a task
+	// may run in total (e.g. email=5,file_delete=20); other types get
+	// MaxTaskRetries+1.
+	TaskTypeMaxAttempts map[string]int
+
+	// MaxReschedules caps how many times a task is rescheduled at a
+	// provider's request (429 with Retry-After) without spending retries;
+	// beyond it the 429 is handled as a rate-limited failure.
+	MaxReschedules int
+
+	// MaxChainDepth bounds how many follow-up generations (next_tasks) a
+	// workflow may spawn from its root task, guarding against loops.
+	MaxChainDepth int
+
+	// Operator notifications: tasks that exhaust their retries or are dead
+	// lettered, and task types whose failure rate over OpsErrorRateWindow
+	// reaches OpsErrorRateThreshold (once at least OpsErrorRateMinTasks
+	// finished in the window), are reported through OpsNotifyFunction. One
+	// notification per kind and task type is sent per OpsNotifyCooldown; the
+	// events in between are counted into the next one. An empty function
+	// disables notifications; a threshold of 0 disables the error rate check.
+	OpsNotifyFunction     string
+	OpsNotifyCooldown     time.Duration
+	OpsErrorRateThreshold float64
+	OpsErrorRateWindow    time.Duration
+	OpsErrorRateMinTasks  int
+
+	// OffloadedPayloadMaxBytes caps the size of a payload fetched from the
+	// files service for tasks that carry payload_file_id.
+	OffloadedPayloadMaxBytes int64
+	// EmailAttachmentsMaxBytes caps the combined size of the files attached
+	// to one email; a larger email fails validation. Resend refuses emails
+	// over 40MB once attachments are base64 encoded.
+	EmailAttachmentsMaxBytes int64
+	// EmailBatchMaxEmails caps the emails one email_batch task may send; a
+	// larger batch fails validation.
+	EmailBatchMaxEmails int
+	// TemplatesDir holds message templates read in addition to the shipped
+	// ones, replacing shipped files of the same name; empty uses only those.
+	// Messages whose locale has no translation are rendered in
+	// TemplatesDefaultLocale before falling back to the unlocalized template.
+	TemplatesDir           string
+	TemplatesDefaultLocale string
+
+	// Recurring task scheduler: every instance competes for a database lease
+	// and only the leader enqueues due definitions, checking every
+	// SchedulerInterval and renewing its lease for SchedulerLeaseTTL.
+	SchedulerEnabled  bool
+	SchedulerInterval time.Duration
+	SchedulerLeaseTTL time.Duration
+
+	// PausedRefreshInterval is how often the dispatcher reloads the paused
+	// task types (queues.paused_task_type); a claimed task of a paused type is
+	// re-leased for this long instead of being processed.
+	PausedRefreshInterval time.Duration
+
+	// EnabledProcessors, when non-empty, restricts this instance to the
+	// listed task types: no other processor is registered and the dequeue
+	// claims only these types, so specialized pools can split the work.
+	EnabledProcessors []string
+
+	// DisabledProcessors are task types this instance starts with disabled;
+	// they can be re-enabled at runtime through the admin API, which requires
+	// AdminToken as a bearer token and is off when it is empty.
+	DisabledProcessors []string
+	AdminToken         string
+
+	// DryRun makes processors run their before_handlers and log the request
+	// they would send, then return a synthetic success instead of calling the
+	// provider (Resend, ElevenLabs, OpenAI, files service deletes).
+	DryRun bool
+
+	// HeartbeatInterval is how often this instance refreshes its row in
+	// queues.worker_instance.
+	HeartbeatInterval time.Duration
+
+	// Health server
+	HealthPort string
+	// HealthDequeueStaleAfter marks the worker not ready when no dequeue
+	// round-trip has succeeded within this window.
+	HealthDequeueStaleAfter time.Duration
 
 	// Logging
 	LogLevel string
 }
 
+// Load reads the configuration from the environment and panics when a value
+// is invalid or a required one is missing.
 func Load() Config {
+	cfg := load()
+
+	// Validate required fields
+	if cfg.DatabaseURL == "" {
+		panic("DATABASE_URL is required")
+	}
+
+	if cfg.FileServiceURL == "" {
+		panic("FILE_SERVICE_URL is required")
+	}
+
+	if cfg.FileServiceAPIKey == "" {
+		panic("FILE_SERVICE_API_KEY is required")
+	}
+
+	return cfg
+}
+
+// SimulationFileServiceURL is the files service base URL simulation mode
+// uses when FILE_SERVICE_URL is unset; its requests are answered by the mock
+// files service.
+const SimulationFileServiceURL = "http://files.simulate.invalid"
+
+// LoadSimulation reads the configuration for simulation mode, where every
+// provider call is answered by a mock: DATABASE_URL is optional and missing
+// files service settings and provider API keys default to placeholders.
+func LoadSimulation() Config {
+	cfg := load()
+	if cfg.FileServiceURL == "" {
+		cfg.FileServiceURL = SimulationFileServiceURL
+	}
+	for _, key := range []*string{&cfg.FileServiceAPIKey, &cfg.ResendAPIKey, &cfg.ElevenLabsAPIKey, &cfg.DeepgramAPIKey, &cfg.OpenAIAPIKey, &cfg.TelegramBotToken} {
+		if *key == "" {
+			*key = "simulate"
+		}
+	}
+	return cfg
+}
+
+func load() Config {
 	cfg := Config{
 		DatabaseURL:       getEnv("DATABASE_URL", ""),
 		ResendAPIKey:      getEnv("RESEND_API_KEY", ""),
@@ -36,8 +353,143 @@ func Load() Config {
 		FileServiceAPIKey: getEnv("FILE_SERVICE_API_KEY", ""),
 		ElevenLabsAPIKey:  getEnv("ELEVENLABS_API_KEY", ""),
 		OpenAIAPIKey:      getEnv("OPENAI_API_KEY", ""),
+		TelegramBotToken:  getEnv("TELEGRAM_BOT_TOKEN", ""),
 		LogLevel:          getEnv("LOG_LEVEL", "info"),
+		HealthPort:        getEnv("WORKER_HEALTH_PORT", "8080"),
+		DequeueMode:       strings.ToLower(getEnv("WORKER_DEQUEUE_MODE", "function")),
+		AdminToken:        getEnv("WORKER_ADMIN_TOKEN", ""),
+	}
+
+	cfg.EmailProvider = getEnv("WORKER_EMAIL_PROVIDER", "resend")
+	cfg.EmailFallbackProvider = getEnv("WORKER_EMAIL_FALLBACK_PROVIDER", "")
+	for key, provider := range map[string]string{"WORKER_EMAIL_PROVIDER": cfg.EmailProvider, "WORKER_EMAIL_FALLBACK_PROVIDER": cfg.EmailFallbackProvider} {
+		switch provider {
+		case "resend", "ses", "sendgrid", "":
+		default:
+			panic(fmt.Sprintf("invalid %s: %q (want resend, ses or sendgrid)", key, provider))
+		}
+	}
+	if cfg.EmailFallbackProvider == cfg.EmailProvider {
+		cfg.EmailFallbackProvider = ""
+	}
+	cfg.SESRegion = getEnv("SES_REGION", "")
+	cfg.SESAccessKeyID = getEnv("SES_ACCESS_KEY_ID", "")
+	cfg.SESSecretAccessKey = getEnv("SES_SECRET_ACCESS_KEY", "")
+	cfg.SendGridAPIKey = getEnv("SENDGRID_API_KEY", "")
+	cfg.ResendWebhookSecret = getEnv("RESEND_WEBHOOK_SECRET", "")
+	cfg.EmailMode = strings.ToLower(getEnv("EMAIL_MODE", "send"))
+	if cfg.EmailMode != "send" && cfg.EmailMode != "capture" {
+		panic(fmt.Sprintf("invalid EMAIL_MODE: %q (want send or capture)", cfg.EmailMode))
+	}
+	cfg.EmailCaptureSMTPAddr = getEnv("EMAIL_CAPTURE_SMTP_ADDR", "")
+	cfg.TemplatesDir = getEnv("WORKER_TEMPLATES_DIR", "")
+	cfg.TemplatesDefaultLocale = getEnv("WORKER_TEMPLATES_DEFAULT_LOCALE", "en")
+
+	cfg.TranscriptionProvider = getEnv("WORKER_TRANSCRIPTION_PROVIDER", "elevenlabs")
+	cfg.TranscriptionFallbackProvider = getEnv("WORKER_TRANSCRIPTION_FALLBACK_PROVIDER", "")
+	for key, provider := range map[string]string{"WORKER_TRANSCRIPTION_PROVIDER": cfg.TranscriptionProvider, "WORKER_TRANSCRIPTION_FALLBACK_PROVIDER": cfg.TranscriptionFallbackProvider} {
+		switch provider {
+		case "elevenlabs", "deepgram", "whisper", "":
+		default:
+			panic(fmt.Sprintf("invalid %s: %q (want elevenlabs, deepgram or whisper)", key, provider))
+		}
+	}
+	if cfg.TranscriptionFallbackProvider == cfg.TranscriptionProvider {
+		cfg.TranscriptionFallbackProvider = ""
+	}
+	cfg.DeepgramAPIKey = getEnv("DEEPGRAM_API_KEY", "")
+	cfg.DeepgramCallbackURL = getEnv("DEEPGRAM_CALLBACK_URL", "")
+	whisperMaxSeconds, err := strconv.ParseFloat(getEnv("WORKER_WHISPER_MAX_SECONDS", "0"), 64)
+	if err != nil || whisperMaxSeconds < 0 {
+		panic(fmt.Sprintf("invalid WORKER_WHISPER_MAX_SECONDS: %v", err))
 	}
+	cfg.WhisperMaxSeconds = whisperMaxSeconds
+	prices, err := parsePrices(getEnv("WORKER_TRANSCRIPTION_PRICES", ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_TRANSCRIPTION_PRICES: %v", err))
+	}
+	cfg.TranscriptionPrices = prices
+
+	cfg.TwilioAccountSID = getEnv("TWILIO_ACCOUNT_SID", "")
+	cfg.TwilioAuthToken = getEnv("TWILIO_AUTH_TOKEN", "")
+	cfg.TwilioFromNumber = getEnv("TWILIO_FROM_NUMBER", "")
+	cfg.TwilioMessagingServiceSID = getEnv("TWILIO_MESSAGING_SERVICE_SID", "")
+	cfg.TwilioStatusCallbackURL = getEnv("TWILIO_STATUS_CALLBACK_URL", "")
+	cfg.TwilioInboundSMSURL = getEnv("TWILIO_INBOUND_SMS_URL", "")
+	cfg.TwilioVerifyServiceSID = getEnv("TWILIO_VERIFY_SERVICE_SID", "")
+	cfg.VonageAPIKey = getEnv("VONAGE_API_KEY", "")
+	cfg.VonageAPISecret = getEnv("VONAGE_API_SECRET", "")
+	cfg.VonageFrom = getEnv("VONAGE_FROM", "")
+	defaultSMSProvider := "console"
+	if cfg.TwilioAccountSID != "" {
+		defaultSMSProvider = "twilio"
+	}
+	cfg.SMSProvider = getEnv("WORKER_SMS_PROVIDER", defaultSMSProvider)
+	cfg.SMSFallbackProvider = getEnv("WORKER_SMS_FALLBACK_PROVIDER", "")
+	for key, provider := range map[string]string{"WORKER_SMS_PROVIDER": cfg.SMSProvider, "WORKER_SMS_FALLBACK_PROVIDER": cfg.SMSFallbackProvider} {
+		switch provider {
+		case "twilio", "vonage", "console", "":
+		default:
+			panic(fmt.Sprintf("invalid %s: %q (want twilio, vonage or console)", key, provider))
+		}
+	}
+	if cfg.SMSFallbackProvider == cfg.SMSProvider {
+		cfg.SMSFallbackProvider = ""
+	}
+	cfg.SMSDefaultCountry = strings.ToUpper(getEnv("WORKER_SMS_DEFAULT_COUNTRY", ""))
+	cfg.SMSSuppressionFunction = getEnv("WORKER_SMS_SUPPRESSION_FUNCTION", "comms.check_sms_suppression")
+	smsMaxSegments, err := strconv.Atoi(getEnv("WORKER_SMS_MAX_SEGMENTS", "0"))
+	if err != nil || smsMaxSegments < 0 {
+		panic(fmt.Sprintf("invalid WORKER_SMS_MAX_SEGMENTS: %v", err))
+	}
+	cfg.SMSMaxSegments = smsMaxSegments
+	cfg.SMSSegmentOverflow = strings.ToLower(getEnv("WORKER_SMS_SEGMENT_OVERFLOW", "reject"))
+	if cfg.SMSSegmentOverflow != "reject" && cfg.SMSSegmentOverflow != "truncate" {
+		panic(fmt.Sprintf("invalid WORKER_SMS_SEGMENT_OVERFLOW: %q (want reject or truncate)", cfg.SMSSegmentOverflow))
+	}
+	cfg.FCMProjectID = getEnv("FCM_PROJECT_ID", "")
+	cfg.FCMServiceAccountEmail = getEnv("FCM_SERVICE_ACCOUNT_EMAIL", "")
+	// Literal \n sequences are turned back into newlines, as for the files
+	// service's GCS signing key.
+	cfg.FCMServiceAccountPrivateKey = strings.ReplaceAll(getEnv("FCM_SERVICE_ACCOUNT_PRIVATE_KEY", ""), `\n`, "\n")
+	cfg.APNsTeamID = getEnv("APNS_TEAM_ID", "")
+	cfg.APNsKeyID = getEnv("APNS_KEY_ID", "")
+	cfg.APNsPrivateKey = strings.ReplaceAll(getEnv("APNS_PRIVATE_KEY", ""), `\n`, "\n")
+	cfg.APNsTopic = getEnv("APNS_TOPIC", "")
+	cfg.VAPIDPrivateKey = getEnv("VAPID_PRIVATE_KEY", "")
+	cfg.VAPIDSubject = getEnv("VAPID_SUBJECT", "")
+	cfg.WhatsAppAccessToken = getEnv("WHATSAPP_ACCESS_TOKEN", "")
+	cfg.WhatsAppPhoneNumberID = getEnv("WHATSAPP_PHONE_NUMBER_ID", "")
+
+	for _, taskType := range strings.Split(getEnv("WORKER_ENABLED_PROCESSORS", ""), ",") {
+		if taskType = strings.TrimSpace(taskType); taskType != "" {
+			cfg.EnabledProcessors = append(cfg.EnabledProcessors, taskType)
+		}
+	}
+	for _, taskType := range strings.Split(getEnv("WORKER_DISABLED_PROCESSORS", ""), ",") {
+		if taskType = strings.TrimSpace(taskType); taskType != "" {
+			cfg.DisabledProcessors = append(cfg.DisabledProcessors, taskType)
+		}
+	}
+
+	// Database connection pool
+	dbMaxOpenConns, err := strconv.Atoi(getEnv("DB_MAX_OPEN_CONNS", "0"))
+	if err != nil || dbMaxOpenConns < 0 {
+		panic(fmt.Sprintf("invalid DB_MAX_OPEN_CONNS: %v", err))
+	}
+	cfg.DBMaxOpenConns = dbMaxOpenConns
+
+	dbMinConns, err := strconv.Atoi(getEnv("DB_MIN_CONNS", "0"))
+	if err != nil || dbMinConns < 0 || (dbMaxOpenConns > 0 && dbMinConns > dbMaxOpenConns) {
+		panic(fmt.Sprintf("invalid DB_MIN_CONNS: %v", err))
+	}
+	cfg.DBMinConns = dbMinConns
+
+	dbConnMaxLifetimeSeconds, err := strconv.Atoi(getEnv("DB_CONN_MAX_LIFETIME_SECONDS", "0"))
+	if err != nil || dbConnMaxLifetimeSeconds < 0 {
+		panic(fmt.Sprintf("invalid DB_CONN_MAX_LIFETIME_SECONDS: %v", err))
+	}
+	cfg.DBConnMaxLifetime = time.Duration(dbConnMaxLifetimeSeconds) * time.Second
 
 	// Parse durations
 	pollIntervalSeconds, err := strconv.Atoi(getEnv("WORKER_POLL_INTERVAL_SECONDS", "5"))
@@ -46,6 +498,12 @@ func Load() Config {
 	}
 	cfg.PollInterval = time.Duration(pollIntervalSeconds) * time.Second
 
+	maxPollIntervalSeconds, err := strconv.Atoi(getEnv("WORKER_MAX_POLL_INTERVAL_SECONDS", "30"))
+	if err != nil || maxPollIntervalSeconds < 0 {
+		panic(fmt.Sprintf("invalid WORKER_MAX_POLL_INTERVAL_SECONDS: %v", err))
+	}
+	cfg.MaxPollInterval = time.Duration(maxPollIntervalSeconds) * time.Second
+
 	maxIdleSeconds, err := strconv.Atoi(getEnv("WORKER_MAX_IDLE_TIME_SECONDS", "30"))
 	if err != nil {
 		panic(fmt.Sprintf("invalid WORKER_MAX_IDLE_TIME_SECONDS: %v", err))
@@ -59,22 +517,429 @@ func Load() Config {
 	}
 	cfg.Concurrency = concurrency
 
-	// Validate required fields
-	if cfg.DatabaseURL == "" {
-		panic("DATABASE_URL is required")
+	// Queue-depth autoscaling (replaces WORKER_CONCURRENCY when enabled)
+	autoscaleEnabled, err := strconv.ParseBool(getEnv("WORKER_AUTOSCALE_ENABLED", "false"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_AUTOSCALE_ENABLED: %v", err))
 	}
+	cfg.AutoscaleEnabled = autoscaleEnabled
 
-	if cfg.FileServiceURL == "" {
-		panic("FILE_SERVICE_URL is required")
+	minConcurrency, err := strconv.Atoi(getEnv("WORKER_MIN_CONCURRENCY", "1"))
+	if err != nil || minConcurrency < 1 {
+		panic(fmt.Sprintf("invalid WORKER_MIN_CONCURRENCY: %v", err))
 	}
+	cfg.MinConcurrency = minConcurrency
 
-	if cfg.FileServiceAPIKey == "" {
-		panic("FILE_SERVICE_API_KEY is required")
+	maxConcurrency, err := strconv.Atoi(getEnv("WORKER_MAX_CONCURRENCY", "10"))
+	if err != nil || maxConcurrency < minConcurrency {
+		panic(fmt.Sprintf("invalid WORKER_MAX_CONCURRENCY: %v (must be at least WORKER_MIN_CONCURRENCY)", err))
+	}
+	cfg.MaxConcurrency = maxConcurrency
+
+	autoscaleIntervalSeconds, err := strconv.Atoi(getEnv("WORKER_AUTOSCALE_INTERVAL_SECONDS", "10"))
+	if err != nil || autoscaleIntervalSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_AUTOSCALE_INTERVAL_SECONDS: %v", err))
+	}
+	cfg.AutoscaleInterval = time.Duration(autoscaleIntervalSeconds) * time.Second
+
+	tasksPerWorker, err := strconv.Atoi(getEnv("WORKER_AUTOSCALE_TASKS_PER_WORKER", "5"))
+	if err != nil || tasksPerWorker < 1 {
+		panic(fmt.Sprintf("invalid WORKER_AUTOSCALE_TASKS_PER_WORKER: %v", err))
 	}
+	cfg.AutoscaleTasksPerWorker = tasksPerWorker
+
+	// Batch dequeue (1 = one task per query)
+	batchSize, err := strconv.Atoi(getEnv("WORKER_DEQUEUE_BATCH_SIZE", "1"))
+	if err != nil || batchSize < 1 {
+		panic(fmt.Sprintf("invalid WORKER_DEQUEUE_BATCH_SIZE: %v", err))
+	}
+	cfg.DequeueBatchSize = batchSize
+
+	if cfg.DequeueMode != "function" && cfg.DequeueMode != "skip_locked" {
+		panic(fmt.Sprintf("invalid WORKER_DEQUEUE_MODE: %s (must be function or skip_locked)", cfg.DequeueMode))
+	}
+
+	weights, err := parseTaskTypeInts(getEnv("WORKER_TASK_TYPE_WEIGHTS", ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_TASK_TYPE_WEIGHTS: %v", err))
+	}
+	cfg.TaskTypeWeights = weights
+
+	pollSeconds, err := parseTaskTypeInts(getEnv("WORKER_TASK_TYPE_POLL_INTERVALS", ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_TASK_TYPE_POLL_INTERVALS: %v", err))
+	}
+	cfg.TaskTypePollIntervals = make(map[string]time.Duration, len(pollSeconds))
+	for taskType, seconds := range pollSeconds {
+		cfg.TaskTypePollIntervals[taskType] = time.Duration(seconds) * time.Second
+	}
+
+	interactiveConcurrency, err := strconv.Atoi(getEnv("WORKER_INTERACTIVE_CONCURRENCY", "1"))
+	if err != nil || interactiveConcurrency < 0 {
+		panic(fmt.Sprintf("invalid WORKER_INTERACTIVE_CONCURRENCY: %v", err))
+	}
+	cfg.InteractiveConcurrency = interactiveConcurrency
+
+	interactivePollSeconds, err := strconv.Atoi(getEnv("WORKER_INTERACTIVE_POLL_INTERVAL_SECONDS", "1"))
+	if err != nil || interactivePollSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_INTERACTIVE_POLL_INTERVAL_SECONDS: %v", err))
+	}
+	cfg.InteractivePollInterval = time.Duration(interactivePollSeconds) * time.Second
+	cfg.ElevenLabsInteractiveModel = strings.TrimSpace(getEnv("WORKER_ELEVENLABS_INTERACTIVE_MODEL", ""))
+
+	queuesFile := getEnv("WORKER_QUEUES_FILE", "")
+	if queuesFile != "" && getEnv("WORKER_QUEUES", "") != "" {
+		panic("invalid WORKER_QUEUES_FILE: WORKER_QUEUES is also set")
+	}
+	if queuesFile != "" {
+		queues, err := loadQueuesFile(queuesFile, cfg.PollInterval)
+		if err != nil {
+			panic(fmt.Sprintf("invalid WORKER_QUEUES_FILE: %v", err))
+		}
+		cfg.Queues = queues
+	} else {
+		queues, err := parseQueues(getEnv("WORKER_QUEUES", ""))
+		if err != nil {
+			panic(fmt.Sprintf("invalid WORKER_QUEUES: %v", err))
+		}
+		concurrency, err := parseTaskTypeInts(getEnv("WORKER_QUEUE_CONCURRENCY", ""))
+		if err != nil {
+			panic(fmt.Sprintf("invalid WORKER_QUEUE_CONCURRENCY: %v", err))
+		}
+		pollSeconds, err := parseTaskTypeInts(getEnv("WORKER_QUEUE_POLL_INTERVALS", ""))
+		if err != nil {
+			panic(fmt.Sprintf("invalid WORKER_QUEUE_POLL_INTERVALS: %v", err))
+		}
+		for i := range queues {
+			q := &queues[i]
+			q.Concurrency = max(concurrency[q.Name], 1)
+			q.PollInterval = cfg.PollInterval
+			if seconds, ok := pollSeconds[q.Name]; ok {
+				q.PollInterval = time.Duration(seconds) * time.Second
+			}
+			delete(concurrency, q.Name)
+			delete(pollSeconds, q.Name)
+		}
+		for name := range concurrency {
+			panic(fmt.Sprintf("invalid WORKER_QUEUE_CONCURRENCY: no queue named %s", name))
+		}
+		for name := range pollSeconds {
+			panic(fmt.Sprintf("invalid WORKER_QUEUE_POLL_INTERVALS: no queue named %s", name))
+		}
+		cfg.Queues = queues
+	}
+
+	for key, target := range map[string]*float64{
+		"WORKER_RESEND_RPS":       &cfg.ResendRPS,
+		"WORKER_SES_RPS":          &cfg.SESRPS,
+		"WORKER_SENDGRID_RPS":     &cfg.SendGridRPS,
+		"WORKER_ELEVENLABS_RPS":   &cfg.ElevenLabsRPS,
+		"WORKER_DEEPGRAM_RPS":     &cfg.DeepgramRPS,
+		"WORKER_OPENAI_RPS":       &cfg.OpenAIRPS,
+		"WORKER_FILE_SERVICE_RPS": &cfg.FileServiceRPS,
+		"WORKER_DISCORD_RPS":      &cfg.DiscordRPS,
+		"WORKER_TELEGRAM_RPS":     &cfg.TelegramRPS,
+		"WORKER_FCM_RPS":          &cfg.FCMRPS,
+		"WORKER_APNS_RPS":         &cfg.APNsRPS,
+		"WORKER_WEB_PUSH_RPS":     &cfg.WebPushRPS,
+		"WORKER_TWILIO_RPS":       &cfg.TwilioRPS,
+		"WORKER_VONAGE_RPS":       &cfg.VonageRPS,
+		"WORKER_VERIFY_RPS":       &cfg.VerifyRPS,
+		"WORKER_WHATSAPP_RPS":     &cfg.WhatsAppRPS,
+	} {
+		rps, err := strconv.ParseFloat(getEnv(key, "0"), 64)
+		if err != nil || rps < 0 {
+			panic(fmt.Sprintf("invalid %s: %v", key, err))
+		}
+		*target = rps
+	}
+
+	rateLimitMaxWaitSeconds, err := strconv.Atoi(getEnv("WORKER_RATE_LIMIT_MAX_WAIT_SECONDS", "5"))
+	if err != nil || rateLimitMaxWaitSeconds < 0 {
+		panic(fmt.Sprintf("invalid WORKER_RATE_LIMIT_MAX_WAIT_SECONDS: %v", err))
+	}
+	cfg.RateLimitMaxWait = time.Duration(rateLimitMaxWaitSeconds) * time.Second
+
+	circuitThreshold, err := strconv.Atoi(getEnv("WORKER_CIRCUIT_FAILURE_THRESHOLD", "5"))
+	if err != nil || circuitThreshold < 0 {
+		panic(fmt.Sprintf("invalid WORKER_CIRCUIT_FAILURE_THRESHOLD: %v", err))
+	}
+	cfg.CircuitFailureThreshold = circuitThreshold
+
+	circuitCooldownSeconds, err := strconv.Atoi(getEnv("WORKER_CIRCUIT_COOLDOWN_SECONDS", "30"))
+	if err != nil || circuitCooldownSeconds <= 0 {
+		panic(fmt.Sprintf("invalid WORKER_CIRCUIT_COOLDOWN_SECONDS: %v", err))
+	}
+	cfg.CircuitCooldown = time.Duration(circuitCooldownSeconds) * time.Second
+
+	maxRetries, err := strconv.Atoi(getEnv("WORKER_MAX_TASK_RETRIES", "3"))
+	if err != nil || maxRetries < 0 {
+		panic(fmt.Sprintf("invalid WORKER_MAX_TASK_RETRIES: %v", err))
+	}
+	cfg.MaxTaskRetries = maxRetries
+
+	maxAttempts, err := parseTaskTypeInts(getEnv("WORKER_TASK_TYPE_MAX_ATTEMPTS", ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_TASK_TYPE_MAX_ATTEMPTS: %v", err))
+	}
+	cfg.TaskTypeMaxAttempts = maxAttempts
+
+	maxReschedules, err := strconv.Atoi(getEnv("WORKER_MAX_RESCHEDULES", "10"))
+	if err != nil || maxReschedules < 0 {
+		panic(fmt.Sprintf("invalid WORKER_MAX_RESCHEDULES: %v", err))
+	}
+	cfg.MaxReschedules = maxReschedules
+
+	retryBaseSeconds, err := strconv.Atoi(getEnv("WORKER_RETRY_BASE_DELAY_SECONDS", "30"))
+	if err != nil || retryBaseSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_RETRY_BASE_DELAY_SECONDS: %v", err))
+	}
+	cfg.RetryBaseDelay = time.Duration(retryBaseSeconds) * time.Second
+
+	maxRetryDelaySeconds, err := strconv.Atoi(getEnv("WORKER_MAX_RETRY_DELAY_SECONDS", "3600"))
+	if err != nil || maxRetryDelaySeconds < retryBaseSeconds {
+		panic(fmt.Sprintf("invalid WORKER_MAX_RETRY_DELAY_SECONDS: %v", err))
+	}
+	cfg.MaxRetryDelay = time.Duration(maxRetryDelaySeconds) * time.Second
+
+	maxChainDepth, err := strconv.Atoi(getEnv("WORKER_MAX_CHAIN_DEPTH", "10"))
+	if err != nil || maxChainDepth < 1 {
+		panic(fmt.Sprintf("invalid WORKER_MAX_CHAIN_DEPTH: %v", err))
+	}
+	cfg.MaxChainDepth = maxChainDepth
+
+	cfg.OpsNotifyFunction = getEnv("WORKER_OPS_NOTIFY_FUNCTION", "queues.notify_ops")
+
+	opsCooldownSeconds, err := strconv.Atoi(getEnv("WORKER_OPS_NOTIFY_COOLDOWN_SECONDS", "900"))
+	if err != nil || opsCooldownSeconds < 0 {
+		panic(fmt.Sprintf("invalid WORKER_OPS_NOTIFY_COOLDOWN_SECONDS: %v", err))
+	}
+	cfg.OpsNotifyCooldown = time.Duration(opsCooldownSeconds) * time.Second
+
+	opsThreshold, err := strconv.ParseFloat(getEnv("WORKER_OPS_ERROR_RATE_THRESHOLD", "0.5"), 64)
+	if err != nil || opsThreshold < 0 || opsThreshold > 1 {
+		panic(fmt.Sprintf("invalid WORKER_OPS_ERROR_RATE_THRESHOLD: %v", err))
+	}
+	cfg.OpsErrorRateThreshold = opsThreshold
+
+	opsWindowSeconds, err := strconv.Atoi(getEnv("WORKER_OPS_ERROR_RATE_WINDOW_SECONDS", "300"))
+	if err != nil || opsWindowSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_OPS_ERROR_RATE_WINDOW_SECONDS: %v", err))
+	}
+	cfg.OpsErrorRateWindow = time.Duration(opsWindowSeconds) * time.Second
+
+	opsMinTasks, err := strconv.Atoi(getEnv("WORKER_OPS_ERROR_RATE_MIN_TASKS", "20"))
+	if err != nil || opsMinTasks < 1 {
+		panic(fmt.Sprintf("invalid WORKER_OPS_ERROR_RATE_MIN_TASKS: %v", err))
+	}
+	cfg.OpsErrorRateMinTasks = opsMinTasks
+
+	maxPayloadBytes, err := strconv.ParseInt(getEnv("WORKER_OFFLOADED_PAYLOAD_MAX_BYTES", "67108864"), 10, 64)
+	if err != nil || maxPayloadBytes < 1 {
+		panic(fmt.Sprintf("invalid WORKER_OFFLOADED_PAYLOAD_MAX_BYTES: %v", err))
+	}
+	cfg.OffloadedPayloadMaxBytes = maxPayloadBytes
+
+	maxAttachmentBytes, err := strconv.ParseInt(getEnv("WORKER_EMAIL_ATTACHMENTS_MAX_BYTES", "31457280"), 10, 64)
+	if err != nil || maxAttachmentBytes < 1 {
+		panic(fmt.Sprintf("invalid WORKER_EMAIL_ATTACHMENTS_MAX_BYTES: %v", err))
+	}
+	cfg.EmailAttachmentsMaxBytes = maxAttachmentBytes
+
+	batchMaxEmails, err := strconv.Atoi(getEnv("WORKER_EMAIL_BATCH_MAX_EMAILS", "1000"))
+	if err != nil || batchMaxEmails < 1 {
+		panic(fmt.Sprintf("invalid WORKER_EMAIL_BATCH_MAX_EMAILS: %v", err))
+	}
+	cfg.EmailBatchMaxEmails = batchMaxEmails
+
+	dryRun, err := strconv.ParseBool(getEnv("WORKER_DRY_RUN", "false"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_DRY_RUN: %v", err))
+	}
+	cfg.DryRun = dryRun
+
+	apnsSandbox, err := strconv.ParseBool(getEnv("APNS_SANDBOX", "false"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid APNS_SANDBOX: %v", err))
+	}
+	cfg.APNsSandbox = apnsSandbox
+
+	schedulerEnabled, err := strconv.ParseBool(getEnv("WORKER_SCHEDULER_ENABLED", "true"))
+	if err != nil {
+		panic(fmt.Sprintf("invalid WORKER_SCHEDULER_ENABLED: %v", err))
+	}
+	cfg.SchedulerEnabled = schedulerEnabled
+
+	schedulerIntervalSeconds, err := strconv.Atoi(getEnv("WORKER_SCHEDULER_INTERVAL_SECONDS", "15"))
+	if err != nil || schedulerIntervalSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_SCHEDULER_INTERVAL_SECONDS: %v", err))
+	}
+	cfg.SchedulerInterval = time.Duration(schedulerIntervalSeconds) * time.Second
+
+	schedulerLeaseSeconds, err := strconv.Atoi(getEnv("WORKER_SCHEDULER_LEASE_SECONDS", "60"))
+	if err != nil || schedulerLeaseSeconds <= schedulerIntervalSeconds {
+		panic(fmt.Sprintf("invalid WORKER_SCHEDULER_LEASE_SECONDS: %v (must exceed the scheduler interval)", err))
+	}
+	cfg.SchedulerLeaseTTL = time.Duration(schedulerLeaseSeconds) * time.Second
+
+	pausedRefreshSeconds, err := strconv.Atoi(getEnv("WORKER_PAUSED_REFRESH_SECONDS", "10"))
+	if err != nil || pausedRefreshSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_PAUSED_REFRESH_SECONDS: %v", err))
+	}
+	cfg.PausedRefreshInterval = time.Duration(pausedRefreshSeconds) * time.Second
+
+	heartbeatSeconds, err := strconv.Atoi(getEnv("WORKER_HEARTBEAT_INTERVAL_SECONDS", "15"))
+	if err != nil || heartbeatSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_HEARTBEAT_INTERVAL_SECONDS: %v", err))
+	}
+	cfg.HeartbeatInterval = time.Duration(heartbeatSeconds) * time.Second
+
+	staleSeconds, err := strconv.Atoi(getEnv("WORKER_HEALTH_DEQUEUE_STALE_SECONDS", "300"))
+	if err != nil || staleSeconds < 1 {
+		panic(fmt.Sprintf("invalid WORKER_HEALTH_DEQUEUE_STALE_SECONDS: %v", err))
+	}
+	cfg.HealthDequeueStaleAfter = time.Duration(staleSeconds) * time.Second
 
 	return cfg
 }
 
+// parseTaskTypeInts parses a comma-separated list of task_type=n pairs with
+// positive n, e.g. "email=5,file_delete=1".
+func parseTaskTypeInts(value string) (map[string]int, error) {
+	values := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		taskType, raw, ok := strings.Cut(pair, "=")
+		taskType = strings.TrimSpace(taskType)
+		if !ok || taskType == "" {
+			return nil, fmt.Errorf("%q is not task_type=value", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q must have a positive integer value", pair)
+		}
+		values[taskType] = n
+	}
+	return values, nil
+}
+
+// parsePrices parses a comma-separated list of key=price pairs with
+// non-negative prices, e.g. "elevenlabs=0.005,whisper/gpt-4o-transcribe=0.006".
+func parsePrices(value string) (map[string]float64, error) {
+	prices := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q is not key=price", pair)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("%q must have a non-negative price", pair)
+		}
+		prices[key] = price
+	}
+	return prices, nil
+}
+
+// parseQueues parses a comma-separated list of name=task_type|task_type
+// queues, e.g. "messaging=email|sms,media=transcription_kickoff". Concurrency
+// and poll interval are left for the caller to fill in.
+func parseQueues(value string) ([]Queue, error) {
+	var queues []Queue
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q is not name=task_type|task_type", pair)
+		}
+		var taskTypes []string
+		for _, taskType := range strings.Split(raw, "|") {
+			if taskType = strings.TrimSpace(taskType); taskType != "" {
+				taskTypes = append(taskTypes, taskType)
+			}
+		}
+		queues = append(queues, Queue{Name: name, TaskTypes: taskTypes})
+	}
+	return queues, validateQueues(queues)
+}
+
+// queuesFile is the JSON layout of WORKER_QUEUES_FILE.
+type queuesFile struct {
+	Queues []struct {
+		Name                string   `json:"name"`
+		TaskTypes           []string `json:"task_types"`
+		Concurrency         int      `json:"concurrency"`
+		PollIntervalSeconds int      `json:"poll_interval_seconds"`
+	} `json:"queues"`
+}
+
+// loadQueuesFile reads queues from a JSON file such as
+// {"queues":[{"name":"media","task_types":["transcription_kickoff"],"concurrency":2,"poll_interval_seconds":5}]}.
+// Concurrency defaults to 1 and the poll interval to defaultPoll.
+func loadQueuesFile(path string, defaultPoll time.Duration) ([]Queue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file queuesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	queues := make([]Queue, 0, len(file.Queues))
+	for _, q := range file.Queues {
+		if q.Concurrency < 0 || q.PollIntervalSeconds < 0 {
+			return nil, fmt.Errorf("queue %q: concurrency and poll_interval_seconds must not be negative", q.Name)
+		}
+		queue := Queue{
+			Name:         q.Name,
+			TaskTypes:    q.TaskTypes,
+			Concurrency:  max(q.Concurrency, 1),
+			PollInterval: defaultPoll,
+		}
+		if q.PollIntervalSeconds > 0 {
+			queue.PollInterval = time.Duration(q.PollIntervalSeconds) * time.Second
+		}
+		queues = append(queues, queue)
+	}
+	return queues, validateQueues(queues)
+}
+
+// validateQueues requires unique queue names, at least one task type per
+// queue, and each task type in at most one queue.
+func validateQueues(queues []Queue) error {
+	names := make(map[string]bool)
+	owner := make(map[string]string)
+	for _, q := range queues {
+		if q.Name == "" {
+			return fmt.Errorf("queue without name")
+		}
+		if names[q.Name] {
+			return fmt.Errorf("duplicate queue %s", q.Name)
+		}
+		names[q.Name] = true
+		if len(q.TaskTypes) == 0 {
+			return fmt.Errorf("queue %s has no task types", q.Name)
+		}
+		for _, taskType := range q.TaskTypes {
+			if other, ok := owner[taskType]; ok {
+				return fmt.Errorf("task type %s is in queues %s and %s", taskType, other, q.Name)
+			}
+			owner[taskType] = q.Name
+		}
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -2,46 +2,162 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Dequeue modes selecting how tasks are claimed.
+const (
+	// DequeueModeFunction claims tasks through queues.dequeue_next_available_task()
+	// and queues.dequeue_available_tasks(n).
+	DequeueModeFunction = "function"
+	// DequeueModeSkipLocked claims tasks with a direct
+	// select ... for update skip locked query against queues.task, for schemas
+	// that do not install the dequeue functions.
+	DequeueModeSkipLocked = "skip_locked"
+)
+
+// leaseDuration mirrors the lease granted by the dequeue functions.
+const leaseDuration = 5 * time.Minute
+
+// Options tunes how the client talks to the database. Zero pool limits keep
+// the pgx defaults, or the pool_* parameters of the database URL.
+type Options struct {
+	DequeueMode string
+	// MaxConns caps open connections. MinConns connections are kept open
+	// even when idle. Connections older than MaxConnLifetime are closed and
+	// replaced once released.
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+}
+
+// Client talks to Postgres through a pgx connection pool. The pool replaces
+// broken connections on its own: idle connections are health-checked in the
+// background and pinged before reuse, so a restarted database or a dropped
+// connection costs a reconnect rather than a failed dequeue.
+//
+// A Client handed to a WithTx callback runs every query in that transaction.
 type Client struct {
-	db *sql.DB
+	db   dbtx
+	pool *pgxpool.Pool
+	opts Options
+}
+
+// dbtx is the subset of *pgxpool.Pool and pgx.Tx the client's queries use.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
-func NewClient(databaseURL string) (*Client, error) {
-	db, err := sql.Open("postgres", databaseURL)
+func NewClient(databaseURL string, opts Options) (*Client, error) {
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database url: %w", err)
+	}
+	if opts.MaxConns > 0 {
+		poolConfig.MaxConns = int32(opts.MaxConns)
+	}
+	if opts.MinConns > 0 {
+		poolConfig.MinConns = min(int32(opts.MinConns), poolConfig.MaxConns)
+	}
+	if opts.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = opts.MaxConnLifetime
+	}
+
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := db.Ping(context.Background()); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &Client{db: db}, nil
+	return &Client{db: db, pool: db, opts: opts}, nil
 }
 
 func (c *Client) Close() error {
-	return c.db.Close()
+	c.pool.Close()
+	return nil
+}
+
+// WithTx runs fn with a client bound to a single transaction, committing it
+// when fn returns nil and rolling it back otherwise. Called on a client that
+// is already in a transaction, it runs fn in a savepoint instead, so a
+// failed step can be undone without aborting the enclosing transaction.
+func (c *Client) WithTx(ctx context.Context, fn func(tx *Client) error) error {
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&Client{db: tx, pool: c.pool, opts: c.opts}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Ping verifies the database is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// PoolStats returns a snapshot of the connection pool for metrics.
+func (c *Client) PoolStats() metrics.DBPoolStats {
+	stat := c.pool.Stat()
+	return metrics.DBPoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		IdleConns:            stat.IdleConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireDuration:      stat.AcquireDuration(),
+		NewConnsCount:        stat.NewConnsCount(),
+	}
 }
 
 // DequeueNextTask calls queues.dequeue_next_available_task() to get the next available task
 // The function acquires a 5-minute lease on the task; if not completed before expiry, the task becomes available again
-func (c *Client) DequeueNextTask(ctx context.Context) (*types.Task, error) {
+// Tasks whose type is in excluded are not claimed.
+func (c *Client) DequeueNextTask(ctx context.Context, excluded []string) (*types.Task, error) {
+	if c.opts.DequeueMode == DequeueModeSkipLocked || len(excluded) > 0 {
+		tasks, err := c.DequeueTasks(ctx, 1, excluded)
+		if err != nil || len(tasks) == 0 {
+			return nil, err
+		}
+		return tasks[0], nil
+	}
+
 	var task types.Task
-	var taskID sql.NullInt64
-	var taskType sql.NullString
+	var taskID *int64
+	var taskType *string
 	var payloadBytes []byte
-	var enqueuedAt, scheduledAt sql.NullTime
+	var enqueuedAt, scheduledAt *time.Time
 
 	query := `select * from queues.dequeue_next_available_task()`
-	row := c.db.QueryRowContext(ctx, query)
+	row := c.db.QueryRow(ctx, query)
 
 	err := row.Scan(
 		&taskID,
@@ -52,38 +168,187 @@ func (c *Client) DequeueNextTask(ctx context.Context) (*types.Task, error) {
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // No tasks available
 		}
 		return nil, fmt.Errorf("failed to dequeue task: %w", err)
 	}
 
 	// Handle NULL composite (no task claimed)
-	if !taskID.Valid {
+	if taskID == nil {
 		return nil, nil
 	}
 
-	task.TaskID = taskID.Int64
-	if taskType.Valid {
-		task.TaskType = taskType.String
+	task.TaskID = *taskID
+	if taskType != nil {
+		task.TaskType = *taskType
 	}
 	if payloadBytes != nil {
 		task.Payload = payloadBytes
 	}
-	if enqueuedAt.Valid {
-		task.EnqueuedAt = enqueuedAt.Time
+	if enqueuedAt != nil {
+		task.EnqueuedAt = *enqueuedAt
 	}
-	if scheduledAt.Valid {
-		task.ScheduledAt = scheduledAt.Time
+	if scheduledAt != nil {
+		task.ScheduledAt = *scheduledAt
 	}
 
 	return &task, nil
 }
 
+// DequeueTasks calls queues.dequeue_available_tasks(n) to claim up to n available tasks
+// in a single round-trip. Each returned task carries the same 5-minute lease as
+// DequeueNextTask. An empty slice means no tasks are currently available.
+// Tasks whose type is in excluded are not claimed.
+func (c *Client) DequeueTasks(ctx context.Context, n int, excluded []string) ([]*types.Task, error) {
+	if n < 1 {
+		n = 1
+	}
+	if c.opts.DequeueMode == DequeueModeSkipLocked {
+		return c.dequeueSkipLocked(ctx, n, excluded, nil, "")
+	}
+
+	query := `select task_id, task_type, payload, enqueued_at, scheduled_at from queues.dequeue_available_tasks($1)`
+	args := []any{n}
+	if len(excluded) > 0 {
+		query = `select task_id, task_type, payload, enqueued_at, scheduled_at from queues.dequeue_available_tasks($1, $2)`
+		args = append(args, excluded)
+	}
+	rows, err := c.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue tasks: %w", err)
+	}
+	return scanTasks(rows, n)
+}
+
+// DequeueTasksOfTypes claims up to n available tasks whose type is one of
+// taskTypes, via queues.dequeue_task_types.
+func (c *Client) DequeueTasksOfTypes(ctx context.Context, n int, taskTypes []string) ([]*types.Task, error) {
+	if n < 1 {
+		n = 1
+	}
+	if len(taskTypes) == 0 {
+		return nil, nil
+	}
+	if c.opts.DequeueMode == DequeueModeSkipLocked {
+		return c.dequeueSkipLocked(ctx, n, nil, taskTypes, "")
+	}
+
+	query := `select task_id, task_type, payload, enqueued_at, scheduled_at from queues.dequeue_task_types($1, $2)`
+	rows, err := c.db.Query(ctx, query, n, taskTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue tasks: %w", err)
+	}
+	return scanTasks(rows, n)
+}
+
+// DequeueTasksOfPriority claims up to n available tasks whose payload
+// priority is priority and whose type is one of taskTypes, via
+// queues.dequeue_priority_tasks.
+func (c *Client) DequeueTasksOfPriority(ctx context.Context, n int, priority string, taskTypes []string) ([]*types.Task, error) {
+	if n < 1 {
+		n = 1
+	}
+	if len(taskTypes) == 0 {
+		return nil, nil
+	}
+	if c.opts.DequeueMode == DequeueModeSkipLocked {
+		return c.dequeueSkipLocked(ctx, n, nil, taskTypes, priority)
+	}
+
+	query := `select task_id, task_type, payload, enqueued_at, scheduled_at from queues.dequeue_priority_tasks($1, $2, $3)`
+	rows, err := c.db.Query(ctx, query, n, priority, taskTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue priority tasks: %w", err)
+	}
+	return scanTasks(rows, n)
+}
+
+// dequeueSkipLocked claims up to n tasks with a single statement that selects
+// available rows using for update skip locked and appends their leases. It
+// applies the same availability rules as the dequeue functions, skipping
+// excluded types and, when included is non-empty, claiming only those types.
+// A non-empty priority claims only tasks with that payload priority.
+func (c *Client) dequeueSkipLocked(ctx context.Context, n int, excluded, included []string, priority string) ([]*types.Task, error) {
+	query := `
+		with claimed as (
+			select t.task_id, t.task_type, t.payload, t.enqueued_at, t.scheduled_at
+			from queues.task t
+			where not exists (
+				select 1
+				from queues.task_completed c
+				where c.task_id = t.task_id
+			)
+			and not exists (
+				select 1
+				from queues.task_lease l
+				where l.task_id = t.task_id
+				and l.expires_at > now()
+			)
+			and not exists (
+				select 1
+				from queues.paused_task_type p
+				where p.task_type = t.task_type
+			)
+			and t.task_type::text <> all($3::text[])
+			and (cardinality($4::text[]) = 0 or t.task_type::text = any($4::text[]))
+			and ($5::text = '' or t.payload->>'priority' = $5::text)
+			and t.scheduled_at <= now()
+			order by t.scheduled_at, t.task_id
+			limit $1
+			for update of t skip locked
+		),
+		leased as (
+			insert into queues.task_lease (task_id, expires_at)
+			select task_id, now() + $2::interval
+			from claimed
+		)
+		select task_id, task_type, payload, enqueued_at, scheduled_at
+		from claimed
+		order by scheduled_at, task_id`
+
+	if excluded == nil {
+		excluded = []string{}
+	}
+	if included == nil {
+		included = []string{}
+	}
+	rows, err := c.db.Query(ctx, query, n, leaseDuration, excluded, included, priority)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue tasks (skip locked): %w", err)
+	}
+	return scanTasks(rows, n)
+}
+
+// scanTasks reads dequeued task rows and closes rows.
+func scanTasks(rows pgx.Rows, n int) ([]*types.Task, error) {
+	defer rows.Close()
+
+	tasks := make([]*types.Task, 0, n)
+	for rows.Next() {
+		var task types.Task
+		if err := rows.Scan(
+			&task.TaskID,
+			&task.TaskType,
+			&task.Payload,
+			&task.EnqueuedAt,
+			&task.ScheduledAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan dequeued task: %w", err)
+		}
+		tasks = append(tasks, &task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to dequeue tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
 // CompleteTask marks a task as completed so it won't be processed again
 func (c *Client) CompleteTask(ctx context.Context, taskID int64) error {
 	query := `select queues.complete_task($1)`
-	_, err := c.db.ExecContext(ctx, query, taskID)
+	_, err := c.db.Exec(ctx, query, taskID)
 	if err != nil {
 		return fmt.Errorf("failed to complete task: %w", err)
 	}
@@ -93,20 +358,325 @@ func (c *Client) CompleteTask(ctx context.Context, taskID int64) error {
 // FailTask records a task failure with an error message for observability
 func (c *Client) FailTask(ctx context.Context, taskID int64, errorMessage string) error {
 	query := `select queues.fail_task($1, $2)`
-	_, err := c.db.ExecContext(ctx, query, taskID, errorMessage)
+	_, err := c.db.Exec(ctx, query, taskID, errorMessage)
 	if err != nil {
 		return fmt.Errorf("failed to record task failure: %w", err)
 	}
 	return nil
 }
 
+// CountTaskErrors returns how many failures have been recorded for a task via
+// queues.count_task_errors; the worker uses it as the task's retry count.
+func (c *Client) CountTaskErrors(ctx context.Context, taskID int64) (int, error) {
+	var count int
+	query := `select queues.count_task_errors($1)`
+	if err := c.db.QueryRow(ctx, query, taskID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count task errors: %w", err)
+	}
+	return count, nil
+}
+
+// DeadLetterTask records a permanently failed task in queues.task_dead_letter.
+func (c *Client) DeadLetterTask(ctx context.Context, taskID int64, errorClass, errorMessage string) error {
+	query := `select queues.dead_letter_task($1, $2, $3)`
+	_, err := c.db.Exec(ctx, query, taskID, errorClass, errorMessage)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter task: %w", err)
+	}
+	return nil
+}
+
+// ClaimIdempotencyKey records key for a task via queues.claim_idempotency_key.
+// It returns false when the key was already claimed.
+func (c *Client) ClaimIdempotencyKey(ctx context.Context, taskID int64, key string) (bool, error) {
+	var claimed bool
+	query := `select queues.claim_idempotency_key($1, $2)`
+	if err := c.db.QueryRow(ctx, query, taskID, key).Scan(&claimed); err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return claimed, nil
+}
+
+// ReleaseIdempotencyKey removes a key the task claimed via
+// queues.release_idempotency_key, for a side effect that never went out.
+func (c *Client) ReleaseIdempotencyKey(ctx context.Context, taskID int64, key string) error {
+	query := `select queues.release_idempotency_key($1, $2)`
+	if _, err := c.db.Exec(ctx, query, taskID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// GetBeforeHandlerResult returns the before_handler payload saved for the task
+// via queues.get_before_handler_result, or nil when none was saved.
+func (c *Client) GetBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string) (json.RawMessage, error) {
+	var payload []byte
+	query := `select queues.get_before_handler_result($1, $2)`
+	if err := c.db.QueryRow(ctx, query, taskID, handlerName).Scan(&payload); err != nil {
+		return nil, fmt.Errorf("failed to get before handler result: %w", err)
+	}
+	return payload, nil
+}
+
+// SaveBeforeHandlerResult saves a before_handler payload for the task via
+// queues.save_before_handler_result. An already saved payload is kept.
+func (c *Client) SaveBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string, payload json.RawMessage) error {
+	query := `select queues.save_before_handler_result($1, $2, $3)`
+	if _, err := c.db.Exec(ctx, query, taskID, handlerName, []byte(payload)); err != nil {
+		return fmt.Errorf("failed to save before handler result: %w", err)
+	}
+	return nil
+}
+
+// DeferTask holds a task until the given time by releasing its current lease and
+// appending one that expires then. The task is not completed and becomes
+// available again after until.
+func (c *Client) DeferTask(ctx context.Context, taskID int64, until time.Time) error {
+	query := `select queues.defer_task($1, $2)`
+	_, err := c.db.Exec(ctx, query, taskID, until)
+	if err != nil {
+		return fmt.Errorf("failed to defer task: %w", err)
+	}
+	return nil
+}
+
+// RescheduleTask re-leases a task until the given time via
+// queues.reschedule_task without recording a failure. It returns false when
+// the task was already rescheduled maxReschedules times.
+func (c *Client) RescheduleTask(ctx context.Context, taskID int64, until time.Time, reason string, maxReschedules int) (bool, error) {
+	var rescheduled bool
+	query := `select queues.reschedule_task($1, $2, $3, $4)`
+	if err := c.db.QueryRow(ctx, query, taskID, until, reason, maxReschedules).Scan(&rescheduled); err != nil {
+		return false, fmt.Errorf("failed to reschedule task: %w", err)
+	}
+	return rescheduled, nil
+}
+
+// QueueDepth returns the number of tasks available to dequeue right now, via
+// queues.queue_depth().
+func (c *Client) QueueDepth(ctx context.Context) (int64, error) {
+	var depth int64
+	query := `select queues.queue_depth()`
+	if err := c.db.QueryRow(ctx, query).Scan(&depth); err != nil {
+		return 0, fmt.Errorf("failed to get queue depth: %w", err)
+	}
+	return depth, nil
+}
+
+// RegisterWorkerInstance records this worker process on startup via
+// queues.register_worker_instance.
+func (c *Client) RegisterWorkerInstance(ctx context.Context, instanceID, hostname, version string, concurrency int) error {
+	query := `select queues.register_worker_instance($1, $2, $3, $4)`
+	if _, err := c.db.Exec(ctx, query, instanceID, hostname, version, concurrency); err != nil {
+		return fmt.Errorf("failed to register worker instance: %w", err)
+	}
+	return nil
+}
+
+// HeartbeatWorkerInstance marks this worker process alive via
+// queues.heartbeat_worker_instance, with its in-flight task counts by task
+// type and the time of its last queue poll (nil when it has not polled yet).
+func (c *Client) HeartbeatWorkerInstance(ctx context.Context, instanceID string, concurrency int, inFlight map[string]int, lastPollAt *time.Time) error {
+	inFlightJSON, err := json.Marshal(inFlight)
+	if err != nil {
+		return fmt.Errorf("failed to marshal in-flight counts: %w", err)
+	}
+	query := `select queues.heartbeat_worker_instance($1, $2, $3, $4)`
+	if _, err := c.db.Exec(ctx, query, instanceID, concurrency, inFlightJSON, lastPollAt); err != nil {
+		return fmt.Errorf("failed to heartbeat worker instance: %w", err)
+	}
+	return nil
+}
+
+// StopWorkerInstance marks this worker process cleanly stopped via
+// queues.stop_worker_instance.
+func (c *Client) StopWorkerInstance(ctx context.Context, instanceID string) error {
+	query := `select queues.stop_worker_instance($1)`
+	if _, err := c.db.Exec(ctx, query, instanceID); err != nil {
+		return fmt.Errorf("failed to stop worker instance: %w", err)
+	}
+	return nil
+}
+
+// WorkerFleet lists worker instances via queues.worker_fleet. Instances
+// without a heartbeat within staleAfter are reported as stale; stopped ones
+// are included only when includeStopped is set.
+func (c *Client) WorkerFleet(ctx context.Context, staleAfter time.Duration, includeStopped bool) ([]types.WorkerInstance, error) {
+	var raw []byte
+	query := `select queues.worker_fleet(make_interval(secs => $1), $2)`
+	if err := c.db.QueryRow(ctx, query, staleAfter.Seconds(), includeStopped).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("failed to list worker fleet: %w", err)
+	}
+
+	var fleet []types.WorkerInstance
+	if err := json.Unmarshal(raw, &fleet); err != nil {
+		return nil, fmt.Errorf("failed to parse worker fleet: %w", err)
+	}
+	return fleet, nil
+}
+
+// ReportTaskProgress records a task's latest progress via queues.task_progress.
+func (c *Client) ReportTaskProgress(ctx context.Context, taskID int64, percent int, stage string, details json.RawMessage) error {
+	if len(details) == 0 {
+		details = json.RawMessage(`{}`)
+	}
+	query := `select queues.task_progress($1, $2, $3, $4)`
+	if _, err := c.db.Exec(ctx, query, taskID, percent, nullString(stage), []byte(details)); err != nil {
+		return fmt.Errorf("failed to report task progress: %w", err)
+	}
+	return nil
+}
+
+// PausedTaskTypes returns the task types whose processing is paused, via
+// queues.paused_task_types().
+func (c *Client) PausedTaskTypes(ctx context.Context) ([]string, error) {
+	query := `select * from queues.paused_task_types()`
+	rows, err := c.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list paused task types: %w", err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var taskType string
+		if err := rows.Scan(&taskType); err != nil {
+			return nil, fmt.Errorf("failed to scan paused task type: %w", err)
+		}
+		out = append(out, taskType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read paused task types: %w", err)
+	}
+	return out, nil
+}
+
+// AcquireSchedulerLease acquires or renews the recurring task scheduler lease
+// for holder via queues.acquire_scheduler_lease. It returns true while holder is
+// the leader.
+func (c *Client) AcquireSchedulerLease(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	var acquired bool
+	query := `select queues.acquire_scheduler_lease($1, $2)`
+	if err := c.db.QueryRow(ctx, query, holder, int(ttl.Seconds())).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("failed to acquire scheduler lease: %w", err)
+	}
+	return acquired, nil
+}
+
+// ReleaseSchedulerLease gives up the scheduler lease if holder owns it.
+func (c *Client) ReleaseSchedulerLease(ctx context.Context, holder string) error {
+	query := `select queues.release_scheduler_lease($1)`
+	if _, err := c.db.Exec(ctx, query, holder); err != nil {
+		return fmt.Errorf("failed to release scheduler lease: %w", err)
+	}
+	return nil
+}
+
+// DueRecurringTasks returns enabled recurring task definitions that are due or
+// not yet scheduled, via queues.due_recurring_tasks().
+func (c *Client) DueRecurringTasks(ctx context.Context) ([]types.RecurringTask, error) {
+	query := `select recurring_task_id, name, cron_expression, next_run_at from queues.due_recurring_tasks()`
+	rows, err := c.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due recurring tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []types.RecurringTask
+	for rows.Next() {
+		var rt types.RecurringTask
+		if err := rows.Scan(&rt.RecurringTaskID, &rt.Name, &rt.CronExpression, &rt.NextRunAt); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring task: %w", err)
+		}
+		out = append(out, rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recurring tasks: %w", err)
+	}
+	return out, nil
+}
+
+// ScheduleRecurringTask enqueues the run due at runAt (nil only advances a new
+// definition) and moves the definition to nextRunAt, via
+// queues.schedule_recurring_task. It returns true when a task was enqueued.
+func (c *Client) ScheduleRecurringTask(ctx context.Context, recurringTaskID int64, runAt *time.Time, nextRunAt time.Time) (bool, error) {
+	var enqueued bool
+	query := `select queues.schedule_recurring_task($1, $2, $3)`
+	if err := c.db.QueryRow(ctx, query, recurringTaskID, runAt, nextRunAt).Scan(&enqueued); err != nil {
+		return false, fmt.Errorf("failed to schedule recurring task: %w", err)
+	}
+	return enqueued, nil
+}
+
+// EnqueueNextTasks enqueues follow-up tasks for parentTaskID via
+// queues.enqueue_next_tasks and returns how many were enqueued (0 when the
+// parent already enqueued its follow-ups). It fails when the chain would
+// exceed maxDepth.
+func (c *Client) EnqueueNextTasks(ctx context.Context, parentTaskID int64, nextTasks []types.NextTask, maxDepth int) (int, error) {
+	raw, err := json.Marshal(nextTasks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal next tasks: %w", err)
+	}
+
+	var enqueued int
+	query := `select queues.enqueue_next_tasks($1, $2, $3)`
+	err = c.withRequestID(ctx, func(q querier) error {
+		return q.QueryRow(ctx, query, parentTaskID, raw, maxDepth).Scan(&enqueued)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue next tasks: %w", err)
+	}
+	return enqueued, nil
+}
+
+// RecordResult stores a succeeded task's result payload via
+// queues.record_result, replacing any earlier one.
+func (c *Client) RecordResult(ctx context.Context, taskID int64, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task result: %w", err)
+	}
+	query := `select queues.record_result($1, $2)`
+	if _, err := c.db.Exec(ctx, query, taskID, raw); err != nil {
+		return fmt.Errorf("failed to record task result: %w", err)
+	}
+	return nil
+}
+
+// TaskResult returns a task's recorded result payload via
+// queues.get_task_result, or nil when none was recorded.
+func (c *Client) TaskResult(ctx context.Context, taskID int64) (json.RawMessage, error) {
+	var payload []byte
+	query := `select queues.get_task_result($1)`
+	if err := c.db.QueryRow(ctx, query, taskID).Scan(&payload); err != nil {
+		return nil, fmt.Errorf("failed to get task result: %w", err)
+	}
+	return payload, nil
+}
+
+// AppendEvent records a task lifecycle event via queues.append_event.
+func (c *Client) AppendEvent(ctx context.Context, taskID int64, eventType string, details json.RawMessage) error {
+	if len(details) == 0 {
+		details = json.RawMessage(`{}`)
+	}
+	query := `select queues.append_event($1, $2, $3)`
+	_, err := c.db.Exec(ctx, query, taskID, eventType, details)
+	if err != nil {
+		return fmt.Errorf("failed to append task event: %w", err)
+	}
+	return nil
+}
+
 // RunFunction calls internal.run_function(function_name, payload) and returns the parsed result
 // in DBFunctionResult (status, payload). Status "succeeded" indicates success.
 func (c *Client) RunFunction(ctx context.Context, functionName string, payload json.RawMessage) (*types.DBFunctionResult, error) {
 	var resultJSON json.RawMessage
 
 	query := `select internal.run_function($1, $2)`
-	if err := c.db.QueryRowContext(ctx, query, functionName, payload).Scan(&resultJSON); err != nil {
+	err := c.withRequestID(ctx, func(q querier) error {
+		return q.QueryRow(ctx, query, functionName, payload).Scan(&resultJSON)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to run function %s: %w", functionName, err)
 	}
 
@@ -116,3 +686,206 @@ func (c *Client) RunFunction(ctx context.Context, functionName string, payload j
 	}
 	return &result, nil
 }
+
+// PendingTasks lists up to limit tasks that are not completed yet via
+// queues.pending_tasks, optionally only of taskType.
+func (c *Client) PendingTasks(ctx context.Context, taskType string, limit int) ([]types.TaskStatus, error) {
+	query := `
+		select task_id, task_type, payload, enqueued_at, scheduled_at, leased_until, error_count
+		from queues.pending_tasks($1, $2)`
+	rows, err := c.db.Query(ctx, query, nullString(taskType), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []types.TaskStatus
+	for rows.Next() {
+		var t types.TaskStatus
+		if err := rows.Scan(&t.TaskID, &t.TaskType, &t.Payload, &t.EnqueuedAt, &t.ScheduledAt, &t.LeasedUntil, &t.ErrorCount); err != nil {
+			return nil, fmt.Errorf("failed to scan pending task: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pending tasks: %w", err)
+	}
+	return out, nil
+}
+
+// FailedTasks lists up to limit failed tasks, newest first, via
+// queues.failed_tasks.
+func (c *Client) FailedTasks(ctx context.Context, deadLetteredOnly bool, limit int) ([]types.TaskStatus, error) {
+	query := `
+		select task_id, task_type, payload, enqueued_at, completed_at, dead_lettered,
+			error_class, last_error, error_count, replay_count
+		from queues.failed_tasks($1, $2)`
+	rows, err := c.db.Query(ctx, query, deadLetteredOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var out []types.TaskStatus
+	for rows.Next() {
+		var t types.TaskStatus
+		var errorClass, lastError *string
+		if err := rows.Scan(&t.TaskID, &t.TaskType, &t.Payload, &t.EnqueuedAt, &t.CompletedAt, &t.DeadLettered,
+			&errorClass, &lastError, &t.ErrorCount, &t.ReplayCount); err != nil {
+			return nil, fmt.Errorf("failed to scan failed task: %w", err)
+		}
+		t.ErrorClass = stringValue(errorClass)
+		t.LastError = stringValue(lastError)
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read failed tasks: %w", err)
+	}
+	return out, nil
+}
+
+// TaskStatus returns a task with its queue state via queues.task_status, or
+// nil when the task does not exist.
+func (c *Client) TaskStatus(ctx context.Context, taskID int64) (*types.TaskStatus, error) {
+	query := `
+		select task_id, task_type, payload, enqueued_at, scheduled_at, completed_at,
+			leased_until, dead_lettered, cancelled
+		from queues.task_status($1)`
+
+	var t types.TaskStatus
+	err := c.db.QueryRow(ctx, query, taskID).Scan(&t.TaskID, &t.TaskType, &t.Payload, &t.EnqueuedAt,
+		&t.ScheduledAt, &t.CompletedAt, &t.LeasedUntil, &t.DeadLettered, &t.Cancelled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task status: %w", err)
+	}
+	return &t, nil
+}
+
+// TaskErrors returns the errors recorded for a task via queues.task_errors.
+func (c *Client) TaskErrors(ctx context.Context, taskID int64) ([]types.TaskError, error) {
+	query := `select error_id, error_message, created_at from queues.task_errors($1)`
+	rows, err := c.db.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task errors: %w", err)
+	}
+	defer rows.Close()
+
+	var out []types.TaskError
+	for rows.Next() {
+		var e types.TaskError
+		if err := rows.Scan(&e.ErrorID, &e.ErrorMessage, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan task error: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task errors: %w", err)
+	}
+	return out, nil
+}
+
+// TaskEvents returns a task's lifecycle timeline via queues.task_events.
+func (c *Client) TaskEvents(ctx context.Context, taskID int64) ([]types.TaskEvent, error) {
+	query := `select task_event_id, event_type, details, created_at from queues.task_events($1)`
+	rows, err := c.db.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task events: %w", err)
+	}
+	defer rows.Close()
+
+	var out []types.TaskEvent
+	for rows.Next() {
+		var e types.TaskEvent
+		if err := rows.Scan(&e.TaskEventID, &e.EventType, &e.Details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan task event: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task events: %w", err)
+	}
+	return out, nil
+}
+
+// CancelTask completes a pending task without processing it via
+// queues.cancel_task. It returns false when the task was already completed.
+func (c *Client) CancelTask(ctx context.Context, taskID int64, reason string) (bool, error) {
+	var cancelled bool
+	query := `select queues.cancel_task($1, $2)`
+	if err := c.db.QueryRow(ctx, query, taskID, nullString(reason)).Scan(&cancelled); err != nil {
+		return false, fmt.Errorf("failed to cancel task: %w", err)
+	}
+	return cancelled, nil
+}
+
+// RequeueTask enqueues a copy of a task via queues.requeue_task and returns
+// the new task's ID.
+func (c *Client) RequeueTask(ctx context.Context, taskID int64) (int64, error) {
+	var requeuedTaskID int64
+	query := `select queues.requeue_task($1)`
+	if err := c.db.QueryRow(ctx, query, taskID).Scan(&requeuedTaskID); err != nil {
+		return 0, fmt.Errorf("failed to requeue task: %w", err)
+	}
+	return requeuedTaskID, nil
+}
+
+// PurgeTasks deletes tasks completed before completedBefore via
+// queues.purge_tasks and returns how many were deleted.
+func (c *Client) PurgeTasks(ctx context.Context, completedBefore time.Time) (int64, error) {
+	var purged int64
+	query := `select queues.purge_tasks($1)`
+	if err := c.db.QueryRow(ctx, query, completedBefore).Scan(&purged); err != nil {
+		return 0, fmt.Errorf("failed to purge tasks: %w", err)
+	}
+	return purged, nil
+}
+
+// nullString maps an empty string to SQL NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// stringValue reads a nullable text column, NULL as "".
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// querier is the subset of dbtx used by withRequestID callers.
+type querier interface {
+	QueryRow(ctx context.Context, query string, args ...any) pgx.Row
+}
+
+// withRequestID runs fn with the request id from ctx (see logger.WithRequestID)
+// set as chatterbox.request_id for the duration of a transaction, so tasks
+// enqueued by the called functions carry it (queues.stamp_task_request_id).
+// Without a request id fn runs directly on the pool (or the client's
+// transaction).
+func (c *Client) withRequestID(ctx context.Context, fn func(q querier) error) error {
+	requestID, _ := ctx.Value(logger.RequestIDKey).(string)
+	if requestID == "" {
+		return fn(c.db)
+	}
+
+	tx, err := c.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `select set_config('chatterbox.request_id', $1, true)`, requestID); err != nil {
+		return fmt.Errorf("failed to set request id: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,127 @@
+// Package events records the per-task lifecycle timeline in queues.task_event.
+//
+// The worker scopes a context to the task being processed with
+// Recorder.WithTask; anything running under that context (processors, handler
+// invocations, provider HTTP calls) can then call Record without knowing the
+// task ID or holding a database handle. Recording is best effort: failures are
+// logged and never fail the task.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/database"
+)
+
+// Lifecycle event types. A repeated dequeued event is stored as retried by
+// queues.append_event.
+const (
+	Dequeued               = "dequeued"
+	Deferred               = "deferred"
+	BeforeHandlerSucceeded = "before_handler_succeeded"
+	BeforeHandlerFailed    = "before_handler_failed"
+	ProviderCalled         = "provider_called"
+	Succeeded              = "succeeded"
+	Failed                 = "failed"
+	ValidationFailed       = "validation_failed"
+	RetryScheduled         = "retry_scheduled"
+	DeadLettered           = "dead_lettered"
+	SkippedDuplicate       = "skipped_duplicate"
+	Chained                = "chained"
+	ChainRejected          = "chain_rejected"
+)
+
+// Details carries event-specific fields stored as jsonb.
+type Details map[string]any
+
+type Recorder struct {
+	db *database.Client
+}
+
+func NewRecorder(db *database.Client) *Recorder {
+	return &Recorder{db: db}
+}
+
+type scopeKey struct{}
+
+type scope struct {
+	recorder *Recorder
+	taskID   int64
+}
+
+// WithTask returns a context whose events are recorded against taskID.
+func (r *Recorder) WithTask(ctx context.Context, taskID int64) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{recorder: r, taskID: taskID})
+}
+
+// Record appends an event for the task ctx is scoped to. It is a no-op when
+// ctx carries no task scope.
+func Record(ctx context.Context, eventType string, details Details) {
+	s, ok := ctx.Value(scopeKey{}).(scope)
+	if !ok || s.recorder == nil {
+		return
+	}
+
+	var raw json.RawMessage
+	if len(details) > 0 {
+		b, err := json.Marshal(details)
+		if err != nil {
+			logger.Warn(ctx, "failed to marshal task event details", logger.Fields{
+				"task_id":    s.taskID,
+				"event_type": eventType,
+				"error":      err.Error(),
+			})
+		} else {
+			raw = b
+		}
+	}
+
+	// Record even if the task context was canceled mid-flight so the
+	// timeline still shows how far the task got.
+	recordCtx := context.WithoutCancel(ctx)
+	if err := s.recorder.db.AppendEvent(recordCtx, s.taskID, eventType, raw); err != nil {
+		logger.Warn(ctx, "failed to record task event", logger.Fields{
+			"task_id":    s.taskID,
+			"event_type": eventType,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// Transport wraps an http.RoundTripper and records a provider_called event for
+// each outbound request made under a task-scoped context.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport around base (http.DefaultTransport if nil).
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+
+	details := Details{
+		"method":      req.Method,
+		"host":        req.URL.Host,
+		"path":        req.URL.Path,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	} else {
+		details["status_code"] = resp.StatusCode
+	}
+	Record(req.Context(), ProviderCalled, details)
+
+	return resp, err
+}
@@ -0,0 +1,265 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/services/sms"
+	"github.com/bencyrus/chatterbox/worker/internal/worker"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// readinessTimeout bounds the database ping performed by /readyz so a hung
+// connection cannot stall the orchestrator's probe.
+const readinessTimeout = 2 * time.Second
+
+// maxWebhookBody bounds the provider callback bodies read.
+const maxWebhookBody = 64 << 10
+
+// NewHandler builds the worker's embedded HTTP handler for probes and metrics:
+//   - /healthz reports the process is up.
+//   - /readyz reports whether the worker can make progress (see worker.Readiness).
+//   - /metrics exposes Prometheus metrics (see the metrics package).
+//
+// When adminToken is set it also serves the processor admin API, which
+// requires it as a bearer token:
+//   - GET /processors lists processors and whether they are enabled/paused.
+//   - POST /processors/{task_type}/enable and .../disable toggle a processor
+//     on this instance.
+//   - GET /fleet lists the worker instances in queues.worker_instance with
+//     their status, in-flight tasks and last poll; ?all=true includes stopped
+//     instances.
+//
+// With TWILIO_AUTH_TOKEN it also receives Twilio's signed SMS webhooks, each
+// when its public URL is configured:
+//   - POST /webhooks/twilio/sms-status (TWILIO_STATUS_CALLBACK_URL) records
+//     delivered, failed and undelivered statuses (see
+//     worker.RecordSMSDeliveryStatus).
+//   - POST /webhooks/twilio/sms-inbound (TWILIO_INBOUND_SMS_URL) records
+//     STOP and START replies (see worker.RecordSMSOptOut).
+//
+// With RESEND_WEBHOOK_SECRET it receives Resend's Svix-signed webhook:
+//   - POST /webhooks/resend records delivered, bounced and complained
+//     emails (see worker.RecordEmailDeliveryEvent).
+func NewHandler(w *worker.Worker, cfg config.Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler(w))
+	mux.Handle("/metrics", promhttp.Handler())
+	if adminToken := cfg.AdminToken; adminToken != "" {
+		mux.Handle("GET /processors", requireToken(adminToken, listProcessorsHandler(w)))
+		mux.Handle("POST /processors/{task_type}/{action}", requireToken(adminToken, toggleProcessorHandler(w)))
+		mux.Handle("GET /fleet", requireToken(adminToken, fleetHandler(w)))
+	}
+	if cfg.TwilioAuthToken != "" && cfg.TwilioStatusCallbackURL != "" {
+		mux.Handle("POST /webhooks/twilio/sms-status", twilioStatusHandler(w, cfg.TwilioAuthToken, cfg.TwilioStatusCallbackURL))
+	}
+	if cfg.TwilioAuthToken != "" && cfg.TwilioInboundSMSURL != "" {
+		mux.Handle("POST /webhooks/twilio/sms-inbound", twilioInboundHandler(w, cfg.TwilioAuthToken, cfg.TwilioInboundSMSURL))
+	}
+	if cfg.ResendWebhookSecret != "" {
+		mux.Handle("POST /webhooks/resend", resendWebhookHandler(w, cfg.ResendWebhookSecret))
+	}
+	return mux
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func readyzHandler(wk *worker.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		readiness := wk.Readiness(ctx)
+		if !readiness.Ready {
+			logger.Warn(ctx, "worker not ready", logger.Fields{
+				"database_reachable": readiness.DatabaseReachable,
+				"processors":         len(readiness.Processors),
+				"last_dequeue_at":    readiness.LastDequeueAt,
+			})
+		}
+
+		writeJSON(w, readiness.Ready, readiness)
+	}
+}
+
+func listProcessorsHandler(wk *worker.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, true, wk.Processors())
+	}
+}
+
+func toggleProcessorHandler(wk *worker.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var enabled bool
+		switch r.PathValue("action") {
+		case "enable":
+			enabled = true
+		case "disable":
+			enabled = false
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := wk.SetProcessorEnabled(r.Context(), r.PathValue("task_type"), enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, true, wk.Processors())
+	}
+}
+
+func fleetHandler(wk *worker.Worker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		includeStopped, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+		fleet, err := wk.Fleet(r.Context(), includeStopped)
+		if err != nil {
+			logger.Error(r.Context(), "failed to list worker fleet", err)
+			http.Error(w, "failed to list worker fleet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, true, fleet)
+	}
+}
+
+// twilioStatusHandler records Twilio message status callbacks. The
+// signature is checked against callbackURL, the URL Twilio was given, as the
+// request may reach the worker through a proxy under another URL. Statuses
+// that are not final are acknowledged and ignored.
+func twilioStatusHandler(wk *worker.Worker, authToken, callbackURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBody)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		if !sms.ValidTwilioSignature(authToken, callbackURL, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+			logger.Warn(r.Context(), "rejected twilio status callback with invalid signature")
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+
+		status, ok := sms.TwilioDeliveryStatus(r.PostForm)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := wk.RecordSMSDeliveryStatus(r.Context(), status); err != nil {
+			logger.Error(r.Context(), "failed to record sms delivery status", err, logger.Fields{
+				"message_id": status.MessageID,
+				"status":     status.Status,
+			})
+			http.Error(w, "failed to record status", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// twilioInboundHandler records STOP and START replies from Twilio's inbound
+// message webhook, signed like the status callbacks. It answers an empty
+// TwiML response, so the worker itself never replies; Twilio's opt-out
+// handling sends the confirmation.
+func twilioInboundHandler(wk *worker.Worker, authToken, inboundURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBody)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		if !sms.ValidTwilioSignature(authToken, inboundURL, r.PostForm, r.Header.Get("X-Twilio-Signature")) {
+			logger.Warn(r.Context(), "rejected twilio inbound message with invalid signature")
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+
+		if optOut, ok := sms.TwilioOptOut(r.PostForm); ok {
+			if err := wk.RecordSMSOptOut(r.Context(), optOut); err != nil {
+				logger.Error(r.Context(), "failed to record sms opt-out", err, logger.Fields{
+					"action": optOut.Action,
+				})
+				http.Error(w, "failed to record opt-out", http.StatusInternalServerError)
+				return
+			}
+			logger.Info(r.Context(), "sms opt-out recorded", logger.Fields{
+				"action":  optOut.Action,
+				"keyword": optOut.Keyword,
+			})
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Response></Response>`))
+	}
+}
+
+// resendWebhookHandler records delivery events from Resend's webhook. An
+// event is acknowledged only once recorded, so Resend redelivers it after a
+// database error; redeliveries share the svix-id the database dedupes on.
+func resendWebhookHandler(wk *worker.Worker, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		if !email.ValidResendSignature(secret, r.Header, body, time.Now()) {
+			logger.Warn(r.Context(), "rejected resend webhook with invalid signature")
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+
+		event, ok, err := email.ResendDeliveryEvent(r.Header.Get("svix-id"), body)
+		if err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := wk.RecordEmailDeliveryEvent(r.Context(), event); err != nil {
+			logger.Error(r.Context(), "failed to record email delivery event", err, logger.Fields{
+				"message_id": event.MessageID,
+				"event":      event.Event,
+			})
+			http.Error(w, "failed to record event", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// requireToken rejects requests without "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON writes body as JSON with 200 when ok and 503 otherwise.
+func writeJSON(w http.ResponseWriter, ok bool, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
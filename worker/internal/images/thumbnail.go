@@ -0,0 +1,166 @@
+// Package images generates thumbnails of uploaded images: JPEGs and PNGs are
+// decoded, turned upright by their EXIF orientation, scaled down to fit a
+// bounding box and encoded again in the format of the original.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// jpegQuality is the quality thumbnails are encoded with as JPEG.
+const jpegQuality = 85
+
+var (
+	// ErrUnsupportedFormat reports an image that is neither a JPEG nor a PNG.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooLarge reports an image with more pixels than allowed.
+	ErrTooLarge = errors.New("image too large")
+)
+
+// Decode decodes a JPEG or PNG and turns it upright by its EXIF orientation,
+// also returned. Images over maxPixels are refused before their pixels are
+// decoded; 0 allows any size.
+func Decode(data []byte, maxPixels int) (*image.RGBA, int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, 0, ErrUnsupportedFormat
+		}
+		return nil, 0, err
+	}
+	if format != "jpeg" && format != "png" {
+		return nil, 0, ErrUnsupportedFormat
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, 0, fmt.Errorf("%w: %dx%d is over %d pixels", ErrTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = Orientation(data)
+	}
+	return orient(rgba, orientation), orientation, nil
+}
+
+// orient returns img turned upright for an EXIF orientation. Orientations 5
+// to 8 swap its width and height.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror
+				sx, sy = w-1-x, y
+			case 3: // turn a half
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip
+				sx, sy = x, h-1-y
+			case 5: // mirror along the main diagonal
+				sx, sy = y, x
+			case 6: // turn a quarter clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirror along the other diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // turn a quarter counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// Fit returns width and height scaled down, keeping their ratio, to fit
+// within maxWidth and maxHeight. A bound of 0 leaves that side free. Images
+// that already fit keep their size; they are never scaled up.
+func Fit(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// Resize scales img down to width and height, each pixel the average of the
+// source pixels it covers. Averaging premultiplied colors keeps transparent
+// pixels from darkening the edges around them.
+func Resize(img *image.RGBA, width, height int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == w && height == h {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*h/height, max((y+1)*h/height, y*h/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*w/width, max((x+1)*w/width, x*w/width+1)
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[img.PixOffset(x0, sy):img.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			px := dst.Pix[dst.PixOffset(x, y):][:4]
+			for c := range px {
+				px[c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Encode encodes img as mimeType, image/jpeg or image/png. JPEGs, which have
+// no transparency, are laid over a white background.
+func Encode(img *image.RGBA, mimeType string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch mimeType {
+	case "image/jpeg":
+		opaque := image.NewRGBA(img.Bounds())
+		draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(opaque, opaque.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, opaque, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	case "image/png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, mimeType)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,175 @@
+// Package metrics defines the worker's Prometheus instruments. They are
+// registered on the default registry and exposed by the health server at
+// /metrics.
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "chatterbox_worker"
+
+// Task outcome label values.
+const (
+	StatusSucceeded        = "succeeded"
+	StatusFailed           = "failed"
+	StatusValidationFailed = "validation_failed"
+)
+
+var (
+	// TasksProcessed counts processed tasks by type and outcome.
+	TasksProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_processed_total",
+		Help:      "Tasks processed, by task type and outcome.",
+	}, []string{"task_type", "status"})
+
+	// TaskProcessingDuration observes time spent in processTask, including
+	// handler calls.
+	TaskProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_processing_duration_seconds",
+		Help:      "Time spent processing a task, by task type.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"task_type"})
+
+	// TaskQueueWait observes the delay between enqueued_at and the worker
+	// picking the task up.
+	TaskQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_queue_wait_seconds",
+		Help:      "Time between a task being enqueued and dequeued, by task type.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 16),
+	}, []string{"task_type"})
+
+	// QueueDepth is the last sampled number of tasks ready to dequeue.
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Tasks available to dequeue at the last autoscaler sample.",
+	})
+
+	// WorkerGoroutines is the current size of the task processing pool.
+	WorkerGoroutines = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_goroutines",
+		Help:      "Goroutines currently processing tasks.",
+	})
+
+	// ProviderRateLimitWait observes how long outbound provider calls waited
+	// for a rate limit token.
+	ProviderRateLimitWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_rate_limit_wait_seconds",
+		Help:      "Time outbound provider calls waited for a rate limit token, by provider.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"provider"})
+
+	// ProviderRateLimitRejected counts provider calls rejected because no
+	// token was available within the maximum wait; their tasks are
+	// rescheduled.
+	ProviderRateLimitRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_rate_limit_rejected_total",
+		Help:      "Outbound provider calls rejected by the worker's rate limiter, by provider.",
+	}, []string{"provider"})
+
+	// ProviderCircuitState is each provider's circuit breaker state: 0
+	// closed, 1 half-open, 2 open.
+	ProviderCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_circuit_state",
+		Help:      "Provider circuit breaker state (0 closed, 1 half-open, 2 open), by provider.",
+	}, []string{"provider"})
+
+	// ProviderCircuitRejected counts provider calls refused by an open
+	// circuit breaker; their tasks are rescheduled.
+	ProviderCircuitRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_circuit_rejected_total",
+		Help:      "Outbound provider calls refused by an open circuit breaker, by provider.",
+	}, []string{"provider"})
+
+	// HandlerDuration observes before/success/error handler invocations.
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Database handler invocation latency, by handler kind, handler name, and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"kind", "handler", "status"})
+)
+
+// DBPoolStats is a snapshot of the worker's database connection pool.
+type DBPoolStats struct {
+	MaxConns             int32
+	TotalConns           int32
+	IdleConns            int32
+	AcquiredConns        int32
+	AcquireCount         int64
+	EmptyAcquireCount    int64
+	CanceledAcquireCount int64
+	AcquireDuration      time.Duration
+	NewConnsCount        int64
+}
+
+// RegisterDBPool exposes the connection pool returned by stats as
+// db_pool_* gauges and counters, sampled on each scrape. Call it once per
+// process.
+func RegisterDBPool(stats func() DBPoolStats) {
+	gauge := func(name, help string, value func(DBPoolStats) float64) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stats()) })
+	}
+	counter := func(name, help string, value func(DBPoolStats) float64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stats()) })
+	}
+
+	gauge("db_pool_max_conns", "Maximum size of the database connection pool.",
+		func(s DBPoolStats) float64 { return float64(s.MaxConns) })
+	gauge("db_pool_total_conns", "Open database connections, idle or in use.",
+		func(s DBPoolStats) float64 { return float64(s.TotalConns) })
+	gauge("db_pool_idle_conns", "Idle database connections.",
+		func(s DBPoolStats) float64 { return float64(s.IdleConns) })
+	gauge("db_pool_acquired_conns", "Database connections currently in use.",
+		func(s DBPoolStats) float64 { return float64(s.AcquiredConns) })
+	counter("db_pool_acquires_total", "Connections acquired from the pool.",
+		func(s DBPoolStats) float64 { return float64(s.AcquireCount) })
+	counter("db_pool_empty_acquires_total", "Acquires that had to wait for a connection because none was idle.",
+		func(s DBPoolStats) float64 { return float64(s.EmptyAcquireCount) })
+	counter("db_pool_canceled_acquires_total", "Acquires canceled by their context before a connection was available.",
+		func(s DBPoolStats) float64 { return float64(s.CanceledAcquireCount) })
+	counter("db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.",
+		func(s DBPoolStats) float64 { return s.AcquireDuration.Seconds() })
+	counter("db_pool_new_conns_total", "Connections opened, including reconnects after a connection was dropped.",
+		func(s DBPoolStats) float64 { return float64(s.NewConnsCount) })
+}
+
+// ObserveSince records the seconds elapsed since start on h.
+func ObserveSince(h prometheus.Observer, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Status maps an error to a status label value.
+func Status(err error) string {
+	var validation *types.ValidationError
+	if errors.As(err, &validation) {
+		return StatusValidationFailed
+	}
+	if err != nil {
+		return StatusFailed
+	}
+	return StatusSucceeded
+}
@@ -0,0 +1,231 @@
+// Package opsnotify tells operators about failures nobody is watching for.
+// The worker reports every finished attempt here; two conditions raise a
+// notification through a database function, which records it and enqueues the
+// email and Slack tasks that deliver it:
+//
+//   - retries_exhausted: a task failed for good (its retry budget ran out, it
+//     was dead-lettered, or its error was unclassified), so only its error
+//     handler knows.
+//   - error_rate: at least a threshold share of a task type's attempts in the
+//     current window failed, with enough attempts for the rate to mean
+//     something.
+//
+// Each kind is sent at most once per cooldown per task type. Events in
+// between are counted and reported with the next notification, so a burst
+// becomes one message with a count. State is per worker instance.
+package opsnotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/processing"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Notification kinds.
+const (
+	KindRetriesExhausted = "retries_exhausted"
+	KindErrorRate        = "error_rate"
+)
+
+const (
+	// maxSampleErrors bounds the recent error messages kept per task type.
+	maxSampleErrors = 5
+	// maxErrorLength truncates each sampled error message.
+	maxErrorLength = 500
+)
+
+// Options configures a Notifier. An empty Function disables notifications;
+// an ErrorRateThreshold of 0 disables the error rate check.
+type Options struct {
+	Function           string
+	Cooldown           time.Duration
+	ErrorRateThreshold float64
+	ErrorRateWindow    time.Duration
+	ErrorRateMinTasks  int
+}
+
+// Notification is the payload passed to the notify function.
+type Notification struct {
+	Kind     string `json:"kind"`
+	TaskType string `json:"task_type"`
+	// Count is how many events of this kind were seen since the previous
+	// notification, this one included; Since is when the first of them was.
+	Count   int            `json:"count"`
+	Since   time.Time      `json:"since"`
+	Details map[string]any `json:"details"`
+}
+
+// Notifier tracks outcomes per task type and sends notifications. A nil
+// *Notifier records nothing.
+type Notifier struct {
+	functions processing.FunctionRunner
+	opts      Options
+
+	mu      sync.Mutex
+	windows map[string]*window
+	alerts  map[alertKey]*alert
+}
+
+// window counts one task type's attempts since start.
+type window struct {
+	start  time.Time
+	total  int
+	failed int
+	errors []string
+}
+
+type alertKey struct {
+	kind     string
+	taskType string
+}
+
+// alert is the cooldown state of one kind and task type.
+type alert struct {
+	sentAt  time.Time
+	pending int
+	since   time.Time
+}
+
+// New returns a Notifier that sends through functions, or nil when
+// opts.Function is empty.
+func New(functions processing.FunctionRunner, opts Options) *Notifier {
+	if opts.Function == "" {
+		return nil
+	}
+	return &Notifier{
+		functions: functions,
+		opts:      opts,
+		windows:   make(map[string]*window),
+		alerts:    make(map[alertKey]*alert),
+	}
+}
+
+// Succeeded records a successful attempt of taskType.
+func (n *Notifier) Succeeded(taskType string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.window(taskType, time.Now()).total++
+}
+
+// Failed records a failed attempt of task. final reports that the task will
+// not run again; attempt and maxAttempts are included in the notification.
+func (n *Notifier) Failed(ctx context.Context, task *types.Task, failure error, attempt, maxAttempts int, final bool) {
+	if n == nil {
+		return
+	}
+	now := time.Now()
+	message := truncate(failure.Error())
+
+	var due []Notification
+	n.mu.Lock()
+	w := n.window(task.TaskType, now)
+	w.total++
+	w.failed++
+	w.errors = append(w.errors, message)
+	if len(w.errors) > maxSampleErrors {
+		w.errors = w.errors[len(w.errors)-maxSampleErrors:]
+	}
+
+	if final {
+		if note, ok := n.fire(KindRetriesExhausted, task.TaskType, now); ok {
+			note.Details = map[string]any{
+				"task_id":      task.TaskID,
+				"error":        message,
+				"error_class":  types.ErrorClassName(failure),
+				"attempt":      attempt,
+				"max_attempts": maxAttempts,
+			}
+			due = append(due, note)
+		}
+	}
+
+	rate := float64(w.failed) / float64(w.total)
+	if n.opts.ErrorRateThreshold > 0 && w.total >= n.opts.ErrorRateMinTasks && rate >= n.opts.ErrorRateThreshold {
+		if note, ok := n.fire(KindErrorRate, task.TaskType, now); ok {
+			note.Details = map[string]any{
+				"failed":         w.failed,
+				"total":          w.total,
+				"error_rate":     rate,
+				"threshold":      n.opts.ErrorRateThreshold,
+				"window_start":   w.start,
+				"window_seconds": int(n.opts.ErrorRateWindow / time.Second),
+				"sample_errors":  append([]string(nil), w.errors...),
+			}
+			due = append(due, note)
+		}
+	}
+	n.mu.Unlock()
+
+	for _, note := range due {
+		n.send(ctx, note)
+	}
+}
+
+// window returns taskType's current window, starting a new one when the
+// previous has run its length. Callers hold n.mu.
+func (n *Notifier) window(taskType string, now time.Time) *window {
+	w, ok := n.windows[taskType]
+	if !ok || now.Sub(w.start) >= n.opts.ErrorRateWindow {
+		w = &window{start: now}
+		n.windows[taskType] = w
+	}
+	return w
+}
+
+// fire counts an event of kind for taskType and returns the notification to
+// send when the cooldown allows one. Callers hold n.mu.
+func (n *Notifier) fire(kind, taskType string, now time.Time) (Notification, bool) {
+	key := alertKey{kind: kind, taskType: taskType}
+	a, ok := n.alerts[key]
+	if !ok {
+		a = &alert{}
+		n.alerts[key] = a
+	}
+	if a.pending == 0 {
+		a.since = now
+	}
+	a.pending++
+	if !a.sentAt.IsZero() && now.Sub(a.sentAt) < n.opts.Cooldown {
+		return Notification{}, false
+	}
+	note := Notification{Kind: kind, TaskType: taskType, Count: a.pending, Since: a.since}
+	a.sentAt = now
+	a.pending = 0
+	return note, true
+}
+
+// send runs the notify function. Failures are logged; a notification is not
+// retried, the next event after the cooldown carries the count.
+func (n *Notifier) send(ctx context.Context, note Notification) {
+	fields := logger.Fields{"kind": note.Kind, "task_type": note.TaskType, "count": note.Count}
+	payload, err := json.Marshal(note)
+	if err != nil {
+		logger.Error(ctx, "failed to marshal ops notification", err, fields)
+		return
+	}
+	res, err := n.functions.RunFunction(ctx, n.opts.Function, payload)
+	if err == nil && !res.IsSuccess() {
+		err = fmt.Errorf("%s returned status %q", n.opts.Function, res.Status)
+	}
+	if err != nil {
+		logger.Error(ctx, "failed to send ops notification", err, fields)
+		return
+	}
+	logger.Warn(ctx, "ops notification sent", fields)
+}
+
+func truncate(s string) string {
+	if len(s) <= maxErrorLength {
+		return s
+	}
+	return s[:maxErrorLength] + "…"
+}
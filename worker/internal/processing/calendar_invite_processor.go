@@ -0,0 +1,81 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// CalendarInviteProcessor handles task_type == "calendar_invite" by:
+// - Calling the before_handler for the email and its event
+// - Rendering the event as an iCalendar invite
+// - Sending the email with the invite attached and as a body alternative
+type CalendarInviteProcessor struct {
+	handlers  *HandlerInvoker
+	service   *email.Service
+	templates *templates.Engine
+}
+
+func NewCalendarInviteProcessor(handlers *HandlerInvoker, service *email.Service, templates *templates.Engine) *CalendarInviteProcessor {
+	return &CalendarInviteProcessor{handlers: handlers, service: service, templates: templates}
+}
+
+func (p *CalendarInviteProcessor) TaskType() string  { return "calendar_invite" }
+func (p *CalendarInviteProcessor) HasHandlers() bool { return true }
+
+func (p *CalendarInviteProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("calendar_invite task missing before_handler"))
+	}
+
+	var invite types.CalendarInvitePayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &invite); err != nil {
+		return types.NewTaskFailure(err)
+	}
+	if len(invite.Attachments) > 0 {
+		return types.NewTaskValidationFailure("calendar invites do not take attachments")
+	}
+	if err := renderEmailTemplate(p.templates, &invite.EmailPayload); err != nil {
+		return types.NewTaskValidationFailure(err.Error())
+	}
+	attachment, err := email.CalendarInvite(&invite, time.Now())
+	if err != nil {
+		return types.NewTaskValidationFailure(fmt.Sprintf("invalid calendar invite: %v", err))
+	}
+
+	logger.Info(ctx, "calendar invite prepared", logger.Fields{
+		"message_id": invite.MessageID,
+		"event_uid":  invite.Event.UID,
+		"sequence":   invite.Event.Sequence,
+	})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "email", invite) {
+		return types.NewTaskSuccess(&email.EmailResponse{Provider: invite.Provider, ID: dryRunID(task)})
+	}
+
+	resp, err := p.service.SendEmail(ctx, &invite.EmailPayload, []email.Attachment{attachment})
+	if err != nil {
+		err = fmt.Errorf("failed to send calendar invite: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+	return types.NewTaskSuccess(resp)
+}
@@ -6,15 +6,14 @@ import (
 	"fmt"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
-	"github.com/bencyrus/chatterbox/worker/internal/database"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
 )
 
 type DBFunctionProcessor struct {
-	db *database.Client
+	db FunctionRunner
 }
 
-func NewDBFunctionProcessor(db *database.Client) *DBFunctionProcessor {
+func NewDBFunctionProcessor(db FunctionRunner) *DBFunctionProcessor {
 	return &DBFunctionProcessor{db: db}
 }
 
@@ -40,6 +39,14 @@ func (p *DBFunctionProcessor) Process(ctx context.Context, task *types.Task) *ty
 	if err != nil {
 		return types.NewTaskFailure(fmt.Errorf("failed to execute database function %s: %w", payload.DBFunction, err))
 	}
+	if result.IsValidationFailure() {
+		logger.Info(ctx, "database function rejected its input", logger.Fields{
+			"task_id":            task.TaskID,
+			"function":           payload.DBFunction,
+			"validation_failure": result.ValidationFailureMessage,
+		})
+		return types.NewTaskValidationFailure(result.ValidationFailureMessage)
+	}
 	if !result.IsSuccess() {
 		// Non-succeeded status is logged but not treated as fatal - the supervisor pattern
 		// uses status values to communicate outcomes without raising errors
@@ -50,5 +57,7 @@ func (p *DBFunctionProcessor) Process(ctx context.Context, task *types.Task) *ty
 		})
 	}
 
-	return types.NewTaskSuccess(map[string]any{"status": result.Status})
+	taskResult := types.NewTaskSuccess(map[string]any{"status": result.Status})
+	taskResult.NextTasks = result.NextTasks
+	return taskResult
 }
@@ -0,0 +1,74 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/discord"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// DiscordMessageProcessor handles task_type == "discord_message" by:
+// - Calling the before_handler for the webhook URL and message (content, embeds)
+// - Posting it to the Discord webhook
+// - Returning the created message's id for the success handler
+type DiscordMessageProcessor struct {
+	handlers *HandlerInvoker
+	service  *discord.Service
+}
+
+func NewDiscordMessageProcessor(handlers *HandlerInvoker, service *discord.Service) *DiscordMessageProcessor {
+	return &DiscordMessageProcessor{handlers: handlers, service: service}
+}
+
+func (p *DiscordMessageProcessor) TaskType() string  { return "discord_message" }
+func (p *DiscordMessageProcessor) HasHandlers() bool { return true }
+
+func (p *DiscordMessageProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("discord_message task missing before_handler"))
+	}
+
+	var message types.DiscordMessagePayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &message); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	logger.Info(ctx, "discord message payload prepared", logger.Fields{"message_id": message.MessageID})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "discord", redactedDiscordMessage(message)) {
+		return types.NewTaskSuccess(&discord.MessageResponse{ID: dryRunID(task)})
+	}
+
+	resp, err := p.service.SendMessage(ctx, &message)
+	if err != nil {
+		err = fmt.Errorf("failed to send discord message: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(resp)
+}
+
+// redactedDiscordMessage returns message without its webhook URL, which
+// carries the webhook's token, for logging.
+func redactedDiscordMessage(message types.DiscordMessagePayload) types.DiscordMessagePayload {
+	if message.WebhookURL != "" {
+		message.WebhookURL = "REDACTED"
+	}
+	return message
+}
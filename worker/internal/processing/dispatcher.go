@@ -2,27 +2,164 @@ package processing
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 )
 
-// Dispatcher routes tasks to registered processors by task type.
+// Dispatcher routes tasks to registered processors by task type. It is safe
+// for concurrent use: processors can be registered, disabled and re-enabled
+// while tasks are being dispatched.
+//
+// A task type is runnable when it has a processor that is enabled on this
+// instance and is not paused for the whole fleet (queues.paused_task_type).
 type Dispatcher struct {
+	mu         sync.RWMutex
 	processors map[string]Processor
+	schemas    map[string]*jsonschema.Schema
+	disabled   map[string]struct{}
+	paused     map[string]struct{}
 }
 
 func NewDispatcher() *Dispatcher {
-	return &Dispatcher{processors: map[string]Processor{}}
+	return &Dispatcher{
+		processors: map[string]Processor{},
+		schemas:    map[string]*jsonschema.Schema{},
+		disabled:   map[string]struct{}{},
+		paused:     map[string]struct{}{},
+	}
 }
 
+// Register adds p, together with the payload schema for its task type in
+// schemas/, if there is one.
 func (d *Dispatcher) Register(p Processor) {
+	schema := compileSchema(p.TaskType())
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	d.processors[p.TaskType()] = p
+	d.schemas[p.TaskType()] = schema
+}
+
+// Validate checks a task's payload against its processor's schema and, for a
+// PayloadValidator, its typed validation. It returns a *types.ValidationError
+// for a malformed payload.
+func (d *Dispatcher) Validate(p Processor, task *types.Task) error {
+	d.mu.RLock()
+	schema := d.schemas[task.TaskType]
+	d.mu.RUnlock()
+	return validatePayload(schema, p, task)
 }
 
 func (d *Dispatcher) Get(task *types.Task) (Processor, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 	p, ok := d.processors[task.TaskType]
 	if !ok {
 		return nil, fmt.Errorf("no processor registered for task type: %s", task.TaskType)
 	}
 	return p, nil
 }
+
+// TaskTypes returns the registered task types in sorted order.
+func (d *Dispatcher) TaskTypes() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return sortedKeys(d.processors)
+}
+
+// Disable stops this instance from processing taskType until Enable is called.
+func (d *Dispatcher) Disable(taskType string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.processors[taskType]; !ok {
+		return fmt.Errorf("no processor registered for task type: %s", taskType)
+	}
+	d.disabled[taskType] = struct{}{}
+	return nil
+}
+
+// Enable resumes processing of a task type disabled with Disable.
+func (d *Dispatcher) Enable(taskType string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.processors[taskType]; !ok {
+		return fmt.Errorf("no processor registered for task type: %s", taskType)
+	}
+	delete(d.disabled, taskType)
+	return nil
+}
+
+// Disabled returns the task types disabled on this instance in sorted order.
+func (d *Dispatcher) Disabled() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return sortedKeys(d.disabled)
+}
+
+// Runnable returns the registered task types that are neither disabled on
+// this instance nor paused fleet-wide, in sorted order.
+func (d *Dispatcher) Runnable() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	runnable := make([]string, 0, len(d.processors))
+	for _, taskType := range sortedKeys(d.processors) {
+		_, disabled := d.disabled[taskType]
+		_, paused := d.paused[taskType]
+		if !disabled && !paused {
+			runnable = append(runnable, taskType)
+		}
+	}
+	return runnable
+}
+
+// SetPaused replaces the set of paused task types.
+func (d *Dispatcher) SetPaused(taskTypes []string) {
+	paused := make(map[string]struct{}, len(taskTypes))
+	for _, taskType := range taskTypes {
+		paused[taskType] = struct{}{}
+	}
+	d.mu.Lock()
+	d.paused = paused
+	d.mu.Unlock()
+}
+
+// Paused reports whether processing of taskType is paused fleet-wide or
+// disabled on this instance.
+func (d *Dispatcher) Paused(taskType string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, paused := d.paused[taskType]
+	_, disabled := d.disabled[taskType]
+	return paused || disabled
+}
+
+// ProcessorStatus describes one registered processor for the admin API.
+type ProcessorStatus struct {
+	TaskType string `json:"task_type"`
+	Enabled  bool   `json:"enabled"`
+	Paused   bool   `json:"paused"`
+}
+
+// Statuses returns every registered processor's state in task type order.
+func (d *Dispatcher) Statuses() []ProcessorStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]ProcessorStatus, 0, len(d.processors))
+	for _, taskType := range sortedKeys(d.processors) {
+		_, disabled := d.disabled[taskType]
+		_, paused := d.paused[taskType]
+		out = append(out, ProcessorStatus{TaskType: taskType, Enabled: !disabled, Paused: paused})
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// DryRun reports whether the worker runs in dry-run mode (WORKER_DRY_RUN).
+// When it does, it logs request, exactly what the processor would send to
+// provider, and records a provider_called event marked dry_run; the caller
+// then returns a synthetic success instead of calling the provider. Success
+// handlers still run, so the workflow can be followed end to end in staging.
+func (h *HandlerInvoker) DryRun(ctx context.Context, task *types.Task, provider string, request any) bool {
+	if !h.dryRun {
+		return false
+	}
+	logger.Info(ctx, "dry run: provider call skipped", logger.Fields{
+		"task_id":   task.TaskID,
+		"task_type": task.TaskType,
+		"provider":  provider,
+		"request":   request,
+	})
+	events.Record(ctx, events.ProviderCalled, events.Details{"provider": provider, "dry_run": true})
+	return true
+}
+
+// dryRunID is the synthetic provider id returned for a task in dry-run mode.
+func dryRunID(task *types.Task) string {
+	return fmt.Sprintf("dry_run_%d", task.TaskID)
+}
+
+// redactQuery drops the query string, which carries the signature, from a
+// signed URL before it is logged.
+func redactQuery(signedURL string) string {
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return ""
+	}
+	u.RawQuery = ""
+	return u.String()
+}
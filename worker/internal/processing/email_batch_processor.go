@@ -0,0 +1,114 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// EmailBatchProcessor handles task_type == "email_batch" by:
+// - Calling the before_handler for the batch's emails
+// - Sending them in chunks through Resend's batch endpoint
+// - Returning one result per email for the success handler
+type EmailBatchProcessor struct {
+	handlers  *HandlerInvoker
+	service   *email.Service
+	templates *templates.Engine
+	// maxEmails caps the emails one batch may hold.
+	maxEmails int
+}
+
+func NewEmailBatchProcessor(handlers *HandlerInvoker, service *email.Service, templates *templates.Engine, maxEmails int) *EmailBatchProcessor {
+	return &EmailBatchProcessor{handlers: handlers, service: service, templates: templates, maxEmails: maxEmails}
+}
+
+func (p *EmailBatchProcessor) TaskType() string  { return "email_batch" }
+func (p *EmailBatchProcessor) HasHandlers() bool { return true }
+
+func (p *EmailBatchProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("email_batch task missing before_handler"))
+	}
+
+	var batch types.EmailBatchPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &batch); err != nil {
+		return types.NewTaskFailure(err)
+	}
+	if len(batch.Emails) == 0 {
+		return types.NewTaskValidationFailure("email batch has no emails")
+	}
+	if p.maxEmails > 0 && len(batch.Emails) > p.maxEmails {
+		return types.NewTaskValidationFailure(fmt.Sprintf("email batch has %d emails, more than the %d allowed", len(batch.Emails), p.maxEmails))
+	}
+	for i := range batch.Emails {
+		if err := renderEmailTemplate(p.templates, &batch.Emails[i]); err != nil {
+			return types.NewTaskValidationFailure(fmt.Sprintf("email %d: %v", i, err))
+		}
+	}
+
+	logger.Info(ctx, "email batch payload prepared", logger.Fields{
+		"batch_id": batch.BatchID,
+		"emails":   len(batch.Emails),
+	})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "email", batch) {
+		result := &types.EmailBatchResult{Sent: len(batch.Emails)}
+		for i, e := range batch.Emails {
+			result.Results = append(result.Results, types.EmailRecipientResult{
+				MessageID: e.MessageID,
+				ToAddress: e.ToAddress,
+				ID:        fmt.Sprintf("%s-%d", dryRunID(task), i),
+			})
+		}
+		return types.NewTaskSuccess(result)
+	}
+
+	// Worker retries of the task share the key, so chunks Resend already
+	// accepted are not sent again.
+	idempotencyKey := fmt.Sprintf("email-batch-task-%d", task.TaskID)
+	if batch.BatchID != 0 {
+		idempotencyKey = fmt.Sprintf("email-batch-%d", batch.BatchID)
+	}
+	payloads := make([]*types.EmailPayload, len(batch.Emails))
+	for i := range batch.Emails {
+		payloads[i] = &batch.Emails[i]
+	}
+	results, err := p.service.SendBatch(ctx, payloads, idempotencyKey)
+	if err != nil {
+		err = fmt.Errorf("failed to send email batch: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	result := &types.EmailBatchResult{Results: make([]types.EmailRecipientResult, len(results))}
+	for i, r := range results {
+		recipient := types.EmailRecipientResult{MessageID: payloads[i].MessageID, ToAddress: payloads[i].ToAddress}
+		if r.Err != nil {
+			recipient.Error = r.Err.Error()
+			result.Failed++
+		} else {
+			recipient.Provider = r.Response.Provider
+			recipient.ID = r.Response.ID
+			result.Sent++
+		}
+		result.Results[i] = recipient
+	}
+	return types.NewTaskSuccess(result)
+}
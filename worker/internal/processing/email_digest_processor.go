@@ -0,0 +1,197 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+const (
+	// digestItemsFunction returns an account's undigested notification items
+	// created in a window, oldest first.
+	digestItemsFunction = "comms.get_pending_notification_items"
+	// digestMarkFunction marks the items a digest listed as digested.
+	digestMarkFunction = "comms.mark_notification_items_digested"
+	// digestMaxItems caps the items one digest lists; the rest stay pending
+	// for the next one.
+	digestMaxItems = 100
+	// digestTemplate is the email template digests are rendered with unless
+	// the before_handler names another; it is given the digest's Subject,
+	// WindowStart, WindowEnd and Items.
+	digestTemplate = "digest"
+)
+
+// EmailDigestProcessor handles task_type == "email_digest" by:
+// - Calling the before_handler for the account, window and addresses
+// - Collecting the account's pending notification items in the window
+// - Rendering them into one email and sending it
+// - Marking the items as digested
+type EmailDigestProcessor struct {
+	handlers  *HandlerInvoker
+	service   *email.Service
+	templates *templates.Engine
+	functions FunctionRunner
+}
+
+func NewEmailDigestProcessor(handlers *HandlerInvoker, service *email.Service, templates *templates.Engine, functions FunctionRunner) *EmailDigestProcessor {
+	return &EmailDigestProcessor{handlers: handlers, service: service, templates: templates, functions: functions}
+}
+
+func (p *EmailDigestProcessor) TaskType() string  { return "email_digest" }
+func (p *EmailDigestProcessor) HasHandlers() bool { return true }
+
+func (p *EmailDigestProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("email_digest task missing before_handler"))
+	}
+
+	var digest types.EmailDigestPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &digest); err != nil {
+		return types.NewTaskFailure(err)
+	}
+	if digest.AccountID == 0 {
+		return types.NewTaskValidationFailure("email digest has no account_id")
+	}
+	if !digest.WindowEnd.After(digest.WindowStart) {
+		return types.NewTaskValidationFailure("email digest window_end must be after window_start")
+	}
+
+	items, err := p.pendingItems(ctx, &digest)
+	if err != nil {
+		return types.NewTaskFailure(err)
+	}
+	result := &types.EmailDigestResult{AccountID: digest.AccountID, Items: len(items)}
+	if len(items) == 0 {
+		logger.Info(ctx, "no pending notification items, digest not sent", logger.Fields{
+			"account_id":   digest.AccountID,
+			"window_start": digest.WindowStart,
+			"window_end":   digest.WindowEnd,
+		})
+		return types.NewTaskSuccess(result)
+	}
+	for _, item := range items {
+		result.NotificationItemIDs = append(result.NotificationItemIDs, item.NotificationItemID)
+	}
+
+	name := digest.Template
+	if name == "" {
+		name = digestTemplate
+	}
+	rendered, err := p.templates.Email(name, digest.Locale, map[string]any{
+		"Subject":     digest.Subject,
+		"WindowStart": digest.WindowStart.UTC(),
+		"WindowEnd":   digest.WindowEnd.UTC(),
+		"Items":       items,
+	})
+	if err != nil {
+		return types.NewTaskValidationFailure(fmt.Sprintf("failed to render email digest template %q: %v", name, err))
+	}
+	emailPayload := &types.EmailPayload{
+		FromAddress: digest.FromAddress,
+		ToAddress:   digest.ToAddress,
+		Subject:     rendered.Subject,
+		HTML:        rendered.HTML,
+		Text:        rendered.Text,
+		Provider:    digest.Provider,
+		Tags:        digest.Tags,
+		// Retries of the task after the email went out but before the items
+		// were marked send the same digest, which the key deduplicates.
+		IdempotencyKey: fmt.Sprintf("email-digest-%d-%d", digest.AccountID, digest.WindowEnd.Unix()),
+	}
+
+	logger.Info(ctx, "email digest prepared", logger.Fields{
+		"digest_id":  digest.DigestID,
+		"account_id": digest.AccountID,
+		"items":      len(items),
+	})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	var resp *email.EmailResponse
+	if p.handlers.DryRun(ctx, task, "email", emailPayload) {
+		resp = &email.EmailResponse{Provider: emailPayload.Provider, ID: dryRunID(task)}
+	} else {
+		resp, err = p.service.SendEmail(ctx, emailPayload, nil)
+		if err != nil {
+			err = fmt.Errorf("failed to send email digest: %w", err)
+			if at, ok := types.RescheduleTime(err); ok {
+				return types.NewTaskReschedule(at, err)
+			}
+			return types.NewTaskFailure(err)
+		}
+	}
+	result.Provider = resp.Provider
+	result.ID = resp.ID
+
+	if err := p.markDigested(ctx, &digest, result); err != nil {
+		return types.NewTaskFailure(err)
+	}
+	return types.NewTaskSuccess(result)
+}
+
+// pendingItems returns the account's undigested items in the window, at
+// most digestMaxItems of them.
+func (p *EmailDigestProcessor) pendingItems(ctx context.Context, digest *types.EmailDigestPayload) ([]types.DigestItem, error) {
+	args, err := json.Marshal(map[string]any{
+		"account_id":   digest.AccountID,
+		"window_start": digest.WindowStart.Format(time.RFC3339Nano),
+		"window_end":   digest.WindowEnd.Format(time.RFC3339Nano),
+		"limit":        digestMaxItems,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pending notification items query: %w", err)
+	}
+	res, err := p.functions.RunFunction(ctx, digestItemsFunction, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending notification items: %w", err)
+	}
+	if res.Status != "succeeded" {
+		return nil, fmt.Errorf("pending notification items query returned status %q", res.Status)
+	}
+	var pending struct {
+		Items []types.DigestItem `json:"items"`
+	}
+	if len(res.Payload) > 0 {
+		if err := json.Unmarshal(res.Payload, &pending); err != nil {
+			return nil, fmt.Errorf("failed to decode pending notification items: %w", err)
+		}
+	}
+	return pending.Items, nil
+}
+
+// markDigested marks the items result lists as digested by the email it
+// records.
+func (p *EmailDigestProcessor) markDigested(ctx context.Context, digest *types.EmailDigestPayload, result *types.EmailDigestResult) error {
+	args, err := json.Marshal(map[string]any{
+		"digest_id":             digest.DigestID,
+		"account_id":            digest.AccountID,
+		"notification_item_ids": result.NotificationItemIDs,
+		"provider":              result.Provider,
+		"provider_message_id":   result.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal digested notification items: %w", err)
+	}
+	res, err := p.functions.RunFunction(ctx, digestMarkFunction, args)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification items digested: %w", err)
+	}
+	if res.Status != "succeeded" {
+		return fmt.Errorf("marking notification items digested returned status %q", res.Status)
+	}
+	return nil
+}
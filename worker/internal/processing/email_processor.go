@@ -3,20 +3,32 @@ package processing
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
 	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/services/files"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
 )
 
+// errAttachmentsTooLarge reports attachments over the size cap, which no
+// retry will fix.
+var errAttachmentsTooLarge = errors.New("email attachments exceed the size limit")
+
 type EmailProcessor struct {
-	handlers *HandlerInvoker
-	service  *email.Service
+	handlers  *HandlerInvoker
+	service   *email.Service
+	templates *templates.Engine
+	files     *files.Service
+	// maxAttachmentBytes caps the combined size of an email's attachments.
+	maxAttachmentBytes int64
 }
 
-func NewEmailProcessor(handlers *HandlerInvoker, service *email.Service) *EmailProcessor {
-	return &EmailProcessor{handlers: handlers, service: service}
+func NewEmailProcessor(handlers *HandlerInvoker, service *email.Service, templates *templates.Engine, files *files.Service, maxAttachmentBytes int64) *EmailProcessor {
+	return &EmailProcessor{handlers: handlers, service: service, templates: templates, files: files, maxAttachmentBytes: maxAttachmentBytes}
 }
 
 func (p *EmailProcessor) TaskType() string  { return "email" }
@@ -32,16 +44,89 @@ func (p *EmailProcessor) Process(ctx context.Context, task *types.Task) *types.T
 	}
 
 	var emailPayload types.EmailPayload
-	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task.Payload, &emailPayload); err != nil {
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &emailPayload); err != nil {
 		return types.NewTaskFailure(err)
 	}
 
+	if err := renderEmailTemplate(p.templates, &emailPayload); err != nil {
+		return types.NewTaskValidationFailure(err.Error())
+	}
+
 	logger.Info(ctx, "email payload prepared", logger.Fields{"message_id": emailPayload.MessageID})
 
-	resp, err := p.service.SendEmail(ctx, &emailPayload)
+	attachments, err := p.downloadAttachments(ctx, emailPayload.Attachments)
+	if errors.Is(err, errAttachmentsTooLarge) {
+		return types.NewTaskValidationFailure(err.Error())
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to download email attachments: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "email", emailPayload) {
+		return types.NewTaskSuccess(&email.EmailResponse{Provider: emailPayload.Provider, ID: dryRunID(task)})
+	}
+
+	resp, err := p.service.SendEmail(ctx, &emailPayload, attachments)
 	if err != nil {
-		return types.NewTaskFailure(fmt.Errorf("failed to send email: %w", err))
+		err = fmt.Errorf("failed to send email: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
 	}
 
 	return types.NewTaskSuccess(resp)
 }
+
+// downloadAttachments fetches each attachment's content from the files
+// service, stopping as soon as their combined size passes the cap.
+func (p *EmailProcessor) downloadAttachments(ctx context.Context, refs []types.EmailAttachment) ([]email.Attachment, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	attachments := make([]email.Attachment, 0, len(refs))
+	remaining := p.maxAttachmentBytes
+	for _, ref := range refs {
+		content, err := p.download(ctx, ref.FileID, remaining)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= int64(len(content))
+
+		filename := ref.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("attachment-%d", ref.FileID)
+		}
+		attachments = append(attachments, email.Attachment{Filename: filename, ContentType: ref.ContentType, Content: content})
+	}
+	return attachments, nil
+}
+
+// download reads file fileID, failing with errAttachmentsTooLarge once it
+// passes maxBytes.
+func (p *EmailProcessor) download(ctx context.Context, fileID, maxBytes int64) ([]byte, error) {
+	body, err := p.files.OpenFile(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file %d: %w", fileID, err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("file %d: failed to read: %w", fileID, err))
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("%w of %d bytes at file %d", errAttachmentsTooLarge, p.maxAttachmentBytes, fileID)
+	}
+	return content, nil
+}
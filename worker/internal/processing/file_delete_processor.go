@@ -40,7 +40,7 @@ func (p *FileDeleteProcessor) Process(ctx context.Context, task *types.Task) *ty
 	}
 
 	var filePayload types.FileDeletePayload
-	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task.Payload, &filePayload); err != nil {
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &filePayload); err != nil {
 		return types.NewTaskFailure(fmt.Errorf("file_delete before_handler failed: %w", err))
 	}
 
@@ -48,6 +48,13 @@ func (p *FileDeleteProcessor) Process(ctx context.Context, task *types.Task) *ty
 		"file_id": filePayload.FileID,
 	})
 
+	if p.handlers.DryRun(ctx, task, "files", filePayload) {
+		return types.NewTaskSuccess(&types.FileDeleteResult{
+			FileID:       filePayload.FileID,
+			DeleteStatus: "deleted",
+		})
+	}
+
 	signedURL, err := p.service.GetSignedDeleteURL(ctx, filePayload.FileID)
 	if err != nil {
 		return types.NewTaskFailure(fmt.Errorf("failed to get signed delete URL: %w", err))
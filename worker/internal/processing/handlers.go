@@ -4,43 +4,128 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/bencyrus/chatterbox/worker/internal/database"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/bencyrus/chatterbox/worker/processing")
+
+// FunctionRunner runs a database function with a JSON payload.
+type FunctionRunner interface {
+	RunFunction(ctx context.Context, functionName string, payload json.RawMessage) (*types.DBFunctionResult, error)
+}
+
+// HandlerStore is the database surface handlers and side-effect claims run
+// against. *database.Client implements it; simulation mode substitutes an
+// in-memory store.
+type HandlerStore interface {
+	FunctionRunner
+	GetBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string) (json.RawMessage, error)
+	SaveBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string, payload json.RawMessage) error
+	CountTaskErrors(ctx context.Context, taskID int64) (int, error)
+	ClaimIdempotencyKey(ctx context.Context, taskID int64, key string) (bool, error)
+	ReleaseIdempotencyKey(ctx context.Context, taskID int64, key string) error
+}
+
+var _ HandlerStore = (*database.Client)(nil)
+
 // HandlerInvoker centralizes invocation of before/success/error handlers.
 type HandlerInvoker struct {
-	db *database.Client
+	db     HandlerStore
+	dryRun bool
 }
 
-func NewHandlerInvoker(db *database.Client) *HandlerInvoker {
-	return &HandlerInvoker{db: db}
+// NewHandlerInvoker returns an invoker; with dryRun, processors that consult
+// DryRun skip their provider calls.
+func NewHandlerInvoker(db HandlerStore, dryRun bool) *HandlerInvoker {
+	return &HandlerInvoker{db: db, dryRun: dryRun}
+}
+
+// WithDB returns an invoker whose handlers run on db, e.g. a transaction
+// from database.Client.WithTx.
+func (h *HandlerInvoker) WithDB(db HandlerStore) *HandlerInvoker {
+	return &HandlerInvoker{db: db, dryRun: h.dryRun}
 }
 
 // CallBefore expects handler to return DBFunctionResult with status="succeeded" and payload.
 // The payload is unmarshaled into target.
-func (h *HandlerInvoker) CallBefore(ctx context.Context, handlerName string, originalPayload json.RawMessage, target any) error {
-	result, err := h.db.RunFunction(ctx, handlerName, originalPayload)
-	if err != nil {
-		return fmt.Errorf("before handler %s failed: %w", handlerName, err)
+//
+// When the task payload sets cache_before_handler, the first successful
+// payload is saved for the task and reused on later attempts instead of
+// invoking the handler again.
+func (h *HandlerInvoker) CallBefore(ctx context.Context, handlerName string, task *types.Task, target any) (err error) {
+	ctx, span := startHandlerSpan(ctx, "before", handlerName)
+	defer observeHandler(ctx, span, "before", handlerName, time.Now(), &err)
+
+	cached := false
+	defer func() {
+		if err != nil {
+			events.Record(ctx, events.BeforeHandlerFailed, events.Details{"handler": handlerName, "error": err.Error()})
+			return
+		}
+		events.Record(ctx, events.BeforeHandlerSucceeded, events.Details{"handler": handlerName, "cached": cached})
+	}()
+
+	var taskPayload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &taskPayload); err != nil {
+		return fmt.Errorf("failed to parse task payload: %w", err)
 	}
-	if !result.IsSuccess() {
-		return fmt.Errorf("before handler %s returned status: %s", handlerName, result.Status)
+
+	var payload json.RawMessage
+	if taskPayload.CacheBeforeHandler {
+		payload, err = h.db.GetBeforeHandlerResult(ctx, task.TaskID, handlerName)
+		if err != nil {
+			return err
+		}
+		cached = len(payload) > 0
 	}
-	if len(result.Payload) == 0 {
-		return fmt.Errorf("before handler %s did not return payload", handlerName)
+
+	if !cached {
+		result, err := h.db.RunFunction(ctx, handlerName, task.Payload)
+		if err != nil {
+			return fmt.Errorf("before handler %s failed: %w", handlerName, err)
+		}
+		if result.IsValidationFailure() {
+			return &types.ValidationError{Message: result.ValidationFailureMessage}
+		}
+		if !result.IsSuccess() {
+			return fmt.Errorf("before handler %s returned status: %s", handlerName, result.Status)
+		}
+		if len(result.Payload) == 0 {
+			return fmt.Errorf("before handler %s did not return payload", handlerName)
+		}
+		payload = result.Payload
+
+		if taskPayload.CacheBeforeHandler {
+			if err := h.db.SaveBeforeHandlerResult(ctx, task.TaskID, handlerName, payload); err != nil {
+				return err
+			}
+		}
 	}
-	if err := json.Unmarshal(result.Payload, target); err != nil {
+
+	if err := json.Unmarshal(payload, target); err != nil {
 		return fmt.Errorf("failed to unmarshal before payload: %w", err)
 	}
 	return nil
 }
 
-func (h *HandlerInvoker) CallSuccess(ctx context.Context, handlerName string, originalPayload json.RawMessage, workerResult any) error {
+// CallSuccess passes the worker result to the success handler and returns any
+// follow-up tasks the handler declared in its next_tasks.
+func (h *HandlerInvoker) CallSuccess(ctx context.Context, handlerName string, originalPayload json.RawMessage, workerResult any) (nextTasks []types.NextTask, err error) {
+	ctx, span := startHandlerSpan(ctx, "success", handlerName)
+	defer observeHandler(ctx, span, "success", handlerName, time.Now(), &err)
+
 	workerPayloadBytes, err := json.Marshal(workerResult)
 	if err != nil {
-		return fmt.Errorf("failed to marshal worker result: %w", err)
+		return nil, fmt.Errorf("failed to marshal worker result: %w", err)
 	}
 
 	payload := types.HandlerPayload{
@@ -48,6 +133,32 @@ func (h *HandlerInvoker) CallSuccess(ctx context.Context, handlerName string, or
 		WorkerPayload:   workerPayloadBytes,
 	}
 	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal handler payload: %w", err)
+	}
+
+	result, err := h.db.RunFunction(ctx, handlerName, payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+	return result.NextTasks, nil
+}
+
+// CallError passes the failure message and, when classified, its error class to
+// the error handler, with the attempt that failed and the task type's maximum
+// attempts (omitted when 0).
+func (h *HandlerInvoker) CallError(ctx context.Context, handlerName string, originalPayload json.RawMessage, failure error, attempt, maxAttempts int) (err error) {
+	ctx, span := startHandlerSpan(ctx, "error", handlerName)
+	defer observeHandler(ctx, span, "error", handlerName, time.Now(), &err)
+
+	payload := types.HandlerPayload{
+		OriginalPayload: originalPayload,
+		Error:           failure.Error(),
+		ErrorClass:      types.ErrorClassName(failure),
+		Attempt:         attempt,
+		MaxAttempts:     maxAttempts,
+	}
+	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal handler payload: %w", err)
 	}
@@ -56,10 +167,14 @@ func (h *HandlerInvoker) CallSuccess(ctx context.Context, handlerName string, or
 	return err
 }
 
-func (h *HandlerInvoker) CallError(ctx context.Context, handlerName string, originalPayload json.RawMessage, errorMessage string) error {
+// CallValidation passes a validation failure message to the validation handler.
+func (h *HandlerInvoker) CallValidation(ctx context.Context, handlerName string, originalPayload json.RawMessage, message string) (err error) {
+	ctx, span := startHandlerSpan(ctx, "validation", handlerName)
+	defer observeHandler(ctx, span, "validation", handlerName, time.Now(), &err)
+
 	payload := types.HandlerPayload{
-		OriginalPayload: originalPayload,
-		Error:           errorMessage,
+		OriginalPayload:   originalPayload,
+		ValidationFailure: message,
 	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -69,3 +184,43 @@ func (h *HandlerInvoker) CallError(ctx context.Context, handlerName string, orig
 	_, err = h.db.RunFunction(ctx, handlerName, payloadBytes)
 	return err
 }
+
+// CallQuota runs a quota handler with the original task payload and
+// unmarshals the limits it returns into target.
+func (h *HandlerInvoker) CallQuota(ctx context.Context, handlerName string, originalPayload json.RawMessage, target any) (err error) {
+	ctx, span := startHandlerSpan(ctx, "quota", handlerName)
+	defer observeHandler(ctx, span, "quota", handlerName, time.Now(), &err)
+
+	result, err := h.db.RunFunction(ctx, handlerName, originalPayload)
+	if err != nil {
+		return fmt.Errorf("quota handler %s failed: %w", handlerName, err)
+	}
+	if !result.IsSuccess() {
+		return fmt.Errorf("quota handler %s returned status: %s", handlerName, result.Status)
+	}
+	if err := json.Unmarshal(result.Payload, target); err != nil {
+		return fmt.Errorf("failed to unmarshal quota payload: %w", err)
+	}
+	return nil
+}
+
+// startHandlerSpan starts a tracing span for a handler invocation.
+func startHandlerSpan(ctx context.Context, kind, handlerName string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "handler."+kind, trace.WithAttributes(
+		attribute.String("handler.kind", kind),
+		attribute.String("handler.name", handlerName),
+	))
+}
+
+// observeHandler records handler latency and outcome, adds it to the task's
+// handler timings, and ends the handler span. It is deferred with a pointer
+// to the named error result so the final outcome is captured.
+func observeHandler(ctx context.Context, span trace.Span, kind, handlerName string, start time.Time, err *error) {
+	metrics.ObserveSince(metrics.HandlerDuration.WithLabelValues(kind, handlerName, metrics.Status(*err)), start)
+	addHandlerDuration(ctx, kind, time.Since(start))
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
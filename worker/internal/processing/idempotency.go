@@ -0,0 +1,81 @@
+package processing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+type claimsKey struct{}
+
+// sideEffectClaims collects the idempotency keys claimed while processing one
+// task, so only keys this run claimed can be released.
+type sideEffectClaims struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+// WithSideEffectClaims returns a context that tracks the idempotency keys
+// ClaimSideEffect claims under it, for ReleaseSideEffect.
+func WithSideEffectClaims(ctx context.Context) context.Context {
+	return context.WithValue(ctx, claimsKey{}, &sideEffectClaims{})
+}
+
+// ClaimSideEffect claims the task's idempotency key right before an external
+// side effect. The key is derived from the task ID and attempt (recorded
+// failures + 1), so a task re-dequeued after a crash or lease expiry maps to
+// the same key while a deliberate worker retry gets a new one. It reports
+// false when the side effect already ran and must be skipped.
+func (h *HandlerInvoker) ClaimSideEffect(ctx context.Context, task *types.Task) (bool, error) {
+	failures, err := h.db.CountTaskErrors(ctx, task.TaskID)
+	if err != nil {
+		return false, err
+	}
+	key := fmt.Sprintf("task:%d:attempt:%d", task.TaskID, failures+1)
+
+	claimed, err := h.db.ClaimIdempotencyKey(ctx, task.TaskID, key)
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		logger.Warn(ctx, "side effect already executed, skipping duplicate", logger.Fields{
+			"task_id":         task.TaskID,
+			"task_type":       task.TaskType,
+			"idempotency_key": key,
+		})
+		return false, nil
+	}
+
+	if claims, ok := ctx.Value(claimsKey{}).(*sideEffectClaims); ok {
+		claims.mu.Lock()
+		claims.keys = append(claims.keys, key)
+		claims.mu.Unlock()
+	}
+	return true, nil
+}
+
+// ReleaseSideEffect releases the idempotency keys claimed under ctx (see
+// WithSideEffectClaims). Use it only when the side effect is known not to
+// have gone out, e.g. an open circuit breaker refused the call, and the task
+// is rescheduled without recording a failure: the next attempt derives the
+// same key and would otherwise be skipped as a duplicate. Keys claimed by an
+// earlier run of the task are never released.
+func (h *HandlerInvoker) ReleaseSideEffect(ctx context.Context, task *types.Task) error {
+	claims, ok := ctx.Value(claimsKey{}).(*sideEffectClaims)
+	if !ok {
+		return nil
+	}
+
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+	for len(claims.keys) > 0 {
+		if err := h.db.ReleaseIdempotencyKey(ctx, task.TaskID, claims.keys[0]); err != nil {
+			return err
+		}
+		claims.keys = claims.keys[1:]
+	}
+	return nil
+}
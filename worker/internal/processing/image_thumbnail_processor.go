@@ -0,0 +1,141 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/images"
+	"github.com/bencyrus/chatterbox/worker/internal/services/files"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+const (
+	// imageMaxBytes is the largest image the processor downloads.
+	imageMaxBytes = 32 << 20
+	// imageMaxPixels bounds the pixels decoded, so a small file cannot
+	// expand into gigabytes of memory.
+	imageMaxPixels = 50_000_000
+)
+
+// ImageThumbnailProcessor handles task_type == "image_thumbnail" by:
+// - Calling the before_handler to get the image and the thumbnail sizes to generate
+// - Downloading the image through the files service
+// - Turning it upright by its EXIF orientation and scaling it down to each size
+// - Uploading each thumbnail through a signed upload URL for its upload intent
+// - Returning the thumbnails' object keys for the success handler to link to the image
+type ImageThumbnailProcessor struct {
+	handlers *HandlerInvoker
+	files    *files.Service
+}
+
+func NewImageThumbnailProcessor(handlers *HandlerInvoker, filesService *files.Service) *ImageThumbnailProcessor {
+	return &ImageThumbnailProcessor{handlers: handlers, files: filesService}
+}
+
+func (p *ImageThumbnailProcessor) TaskType() string  { return "image_thumbnail" }
+func (p *ImageThumbnailProcessor) HasHandlers() bool { return true }
+
+func (p *ImageThumbnailProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("image_thumbnail task missing before_handler"))
+	}
+
+	var thumbnailPayload types.ImageThumbnailPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &thumbnailPayload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("image_thumbnail before_handler failed: %w", err))
+	}
+	if thumbnailPayload.MimeType != "image/jpeg" && thumbnailPayload.MimeType != "image/png" {
+		return types.NewTaskFailure(&types.ValidationError{Message: fmt.Sprintf("image_thumbnail mime_type %q is not image/jpeg or image/png", thumbnailPayload.MimeType)})
+	}
+	for _, spec := range thumbnailPayload.Thumbnails {
+		if spec.UploadIntentID == 0 || spec.MaxWidth < 0 || spec.MaxHeight < 0 {
+			return types.NewTaskFailure(&types.ValidationError{Message: fmt.Sprintf("image_thumbnail %q needs an upload_intent_id and non-negative bounds", spec.Name)})
+		}
+	}
+
+	logger.Info(ctx, "processing image_thumbnail task", logger.Fields{
+		"file_id":    thumbnailPayload.FileID,
+		"mime_type":  thumbnailPayload.MimeType,
+		"thumbnails": len(thumbnailPayload.Thumbnails),
+	})
+
+	result := &types.ImageThumbnailResult{FileID: thumbnailPayload.FileID, Thumbnails: []types.ImageThumbnail{}}
+	if len(thumbnailPayload.Thumbnails) == 0 {
+		return types.NewTaskSuccess(result)
+	}
+	if p.handlers.DryRun(ctx, task, "files", thumbnailPayload) {
+		for _, spec := range thumbnailPayload.Thumbnails {
+			result.Thumbnails = append(result.Thumbnails, types.ImageThumbnail{Name: spec.Name, UploadIntentID: spec.UploadIntentID, ObjectKey: spec.ObjectKey})
+		}
+		return types.NewTaskSuccess(result)
+	}
+
+	data, err := p.download(ctx, thumbnailPayload.FileID)
+	if err != nil {
+		return types.NewTaskFailure(err)
+	}
+	img, orientation, err := images.Decode(data, imageMaxPixels)
+	if err != nil {
+		return types.NewTaskFailure(&types.ValidationError{Message: fmt.Sprintf("image_thumbnail file %d: %v", thumbnailPayload.FileID, err)})
+	}
+	result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	result.Orientation = orientation
+
+	for _, spec := range thumbnailPayload.Thumbnails {
+		width, height := images.Fit(result.Width, result.Height, spec.MaxWidth, spec.MaxHeight)
+		encoded, err := images.Encode(images.Resize(img, width, height), thumbnailPayload.MimeType)
+		if err != nil {
+			return types.NewTaskFailure(fmt.Errorf("failed to encode %s thumbnail: %w", spec.Name, err))
+		}
+
+		upload, err := p.files.GetSignedUploadURL(ctx, spec.UploadIntentID)
+		if err != nil {
+			return types.NewTaskFailure(fmt.Errorf("failed to get signed upload URL for %s thumbnail: %w", spec.Name, err))
+		}
+		if err := p.files.UploadBySignedURL(ctx, upload, thumbnailPayload.MimeType, encoded); err != nil {
+			return types.NewTaskFailure(fmt.Errorf("failed to upload %s thumbnail: %w", spec.Name, err))
+		}
+
+		result.Thumbnails = append(result.Thumbnails, types.ImageThumbnail{
+			Name:           spec.Name,
+			UploadIntentID: spec.UploadIntentID,
+			ObjectKey:      spec.ObjectKey,
+			Width:          width,
+			Height:         height,
+			SizeBytes:      len(encoded),
+		})
+	}
+
+	logger.Info(ctx, "image thumbnails uploaded", logger.Fields{
+		"file_id":     thumbnailPayload.FileID,
+		"orientation": orientation,
+		"thumbnails":  len(result.Thumbnails),
+	})
+
+	return types.NewTaskSuccess(result)
+}
+
+// download reads the image, refusing files over imageMaxBytes.
+func (p *ImageThumbnailProcessor) download(ctx context.Context, fileID int64) ([]byte, error) {
+	body, err := p.files.OpenFile(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, imageMaxBytes+1))
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to download image: %w", err))
+	}
+	if len(data) > imageMaxBytes {
+		return nil, &types.ValidationError{Message: fmt.Sprintf("image is over the %d MB thumbnail limit", imageMaxBytes>>20)}
+	}
+	return data, nil
+}
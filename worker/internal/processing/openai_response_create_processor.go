@@ -42,7 +42,7 @@ func (p *OpenAIResponseCreateProcessor) Process(ctx context.Context, task *types
 	}
 
 	var createPayload types.OpenAIResponseCreatePayload
-	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task.Payload, &createPayload); err != nil {
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &createPayload); err != nil {
 		return types.NewTaskFailure(fmt.Errorf("openai_response_create before_handler failed: %w", err))
 	}
 
@@ -50,6 +50,21 @@ func (p *OpenAIResponseCreateProcessor) Process(ctx context.Context, task *types
 		"attempt_id": createPayload.OpenAIResponseAttemptID,
 	})
 
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "openai", createPayload) {
+		id := dryRunID(task)
+		return types.NewTaskSuccess(&types.OpenAIResponseCreateResult{
+			OpenAIResponseID: id,
+			Status:           "queued",
+			ResponseBody:     json.RawMessage(fmt.Sprintf(`{"id":%q,"status":"queued"}`, id)),
+		})
+	}
+
 	result, err := p.service.CreateResponse(ctx, &createPayload)
 	if err != nil {
 		return types.NewTaskFailure(fmt.Errorf("OpenAI response create error: %w", err))
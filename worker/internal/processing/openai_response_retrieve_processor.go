@@ -42,7 +42,7 @@ func (p *OpenAIResponseRetrieveProcessor) Process(ctx context.Context, task *typ
 	}
 
 	var retrievePayload types.OpenAIResponseRetrievePayload
-	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task.Payload, &retrievePayload); err != nil {
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &retrievePayload); err != nil {
 		return types.NewTaskFailure(fmt.Errorf("openai_response_retrieve before_handler failed: %w", err))
 	}
 
@@ -51,6 +51,14 @@ func (p *OpenAIResponseRetrieveProcessor) Process(ctx context.Context, task *typ
 		"openai_response_id": retrievePayload.OpenAIResponseID,
 	})
 
+	if p.handlers.DryRun(ctx, task, "openai", retrievePayload) {
+		return types.NewTaskSuccess(&types.OpenAIResponseRetrieveResult{
+			OpenAIResponseID: retrievePayload.OpenAIResponseID,
+			Status:           "completed",
+			ResponseBody:     json.RawMessage(fmt.Sprintf(`{"id":%q,"status":"completed","output":[]}`, retrievePayload.OpenAIResponseID)),
+		})
+	}
+
 	result, err := p.service.RetrieveResponse(ctx, &retrievePayload)
 	if err != nil {
 		return types.NewTaskFailure(fmt.Errorf("OpenAI response retrieve error: %w", err))
@@ -15,5 +15,6 @@ type Processor interface {
 	// HasHandlers indicates whether the processor expects before/success/error handlers.
 	HasHandlers() bool
 	// Process performs the unit of work and returns a TaskResult. It must not enqueue.
+	// Long-running processors can publish progress through Progress(ctx).
 	Process(ctx context.Context, task *types.Task) *types.TaskResult
 }
@@ -0,0 +1,96 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/database"
+)
+
+// minProgressInterval throttles progress writes: a report is skipped when the
+// previous one was written less than this long ago, unless the stage changed
+// or the task reached 100%.
+const minProgressInterval = time.Second
+
+// ProgressReporter lets a long-running processor (transcoding, export, ...)
+// publish how far its task has got, so applications can show live progress.
+// Reports are best effort: a failed write is logged and never fails the task.
+type ProgressReporter interface {
+	// Report records percent (0-100), the current stage, and optional
+	// details for the task.
+	Report(ctx context.Context, percent int, stage string, details map[string]any)
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose processors report through r.
+func WithProgress(ctx context.Context, r ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, r)
+}
+
+// Progress returns the ProgressReporter for the task ctx is scoped to, or one
+// that discards reports when there is none.
+func Progress(ctx context.Context) ProgressReporter {
+	if r, ok := ctx.Value(progressKey{}).(ProgressReporter); ok {
+		return r
+	}
+	return discardProgress{}
+}
+
+type discardProgress struct{}
+
+func (discardProgress) Report(context.Context, int, string, map[string]any) {}
+
+// dbProgressReporter writes reports to queues.task_progress.
+type dbProgressReporter struct {
+	db     *database.Client
+	taskID int64
+
+	mu        sync.Mutex
+	lastAt    time.Time
+	lastStage string
+}
+
+// NewProgressReporter returns a ProgressReporter for taskID backed by the
+// database.
+func NewProgressReporter(db *database.Client, taskID int64) ProgressReporter {
+	return &dbProgressReporter{db: db, taskID: taskID}
+}
+
+func (r *dbProgressReporter) Report(ctx context.Context, percent int, stage string, details map[string]any) {
+	percent = min(max(percent, 0), 100)
+
+	r.mu.Lock()
+	now := time.Now()
+	if percent < 100 && stage == r.lastStage && now.Sub(r.lastAt) < minProgressInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastAt, r.lastStage = now, stage
+	r.mu.Unlock()
+
+	var raw json.RawMessage
+	if len(details) > 0 {
+		b, err := json.Marshal(details)
+		if err != nil {
+			logger.Warn(ctx, "failed to marshal task progress details", logger.Fields{
+				"task_id": r.taskID,
+				"error":   err.Error(),
+			})
+		} else {
+			raw = b
+		}
+	}
+
+	if err := r.db.ReportTaskProgress(context.WithoutCancel(ctx), r.taskID, percent, stage, raw); err != nil {
+		logger.Warn(ctx, "failed to report task progress", logger.Fields{
+			"task_id": r.taskID,
+			"percent": percent,
+			"stage":   stage,
+			"error":   err.Error(),
+		})
+	}
+}
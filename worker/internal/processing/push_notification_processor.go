@@ -0,0 +1,116 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/apns"
+	"github.com/bencyrus/chatterbox/worker/internal/services/fcm"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// PushNotificationProcessor handles task_type == "push_notification" by:
+// - Calling the before_handler for the device tokens and notification (title, body, data)
+// - Sending it to every FCM token through FCM and every APNs token directly through APNs
+// - Returning per-device outcomes, with the tokens rejected as invalid for the success handler to remove
+type PushNotificationProcessor struct {
+	handlers *HandlerInvoker
+	fcm      *fcm.Service
+	apns     *apns.Service
+}
+
+func NewPushNotificationProcessor(handlers *HandlerInvoker, fcm *fcm.Service, apns *apns.Service) *PushNotificationProcessor {
+	return &PushNotificationProcessor{handlers: handlers, fcm: fcm, apns: apns}
+}
+
+func (p *PushNotificationProcessor) TaskType() string  { return "push_notification" }
+func (p *PushNotificationProcessor) HasHandlers() bool { return true }
+
+func (p *PushNotificationProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("push_notification task missing before_handler"))
+	}
+
+	var push types.PushNotificationPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &push); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	logger.Info(ctx, "push notification payload prepared", logger.Fields{
+		"message_id": push.MessageID,
+		"devices":    len(push.Tokens) + len(push.APNsTokens),
+	})
+
+	if len(push.Tokens) == 0 && len(push.APNsTokens) == 0 {
+		return types.NewTaskFailure(fmt.Errorf("push notification has no device tokens"))
+	}
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "push", push) {
+		return types.NewTaskSuccess(&types.PushNotificationResult{Sent: len(push.Tokens) + len(push.APNsTokens)})
+	}
+
+	result, err := p.send(ctx, &push)
+	if err != nil {
+		err = fmt.Errorf("failed to send push notification: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
+
+// send delivers push through each provider it has tokens for and merges the
+// outcomes. Once a device has been reached the task must not be retried, so
+// a provider that then fails has its tokens reported as FailedTokens instead
+// of failing the task.
+func (p *PushNotificationProcessor) send(ctx context.Context, push *types.PushNotificationPayload) (*types.PushNotificationResult, error) {
+	merged := &types.PushNotificationResult{}
+	var firstErr error
+	for _, provider := range []struct {
+		name   string
+		tokens []string
+		send   func(context.Context, *types.PushNotificationPayload) (*types.PushNotificationResult, error)
+	}{
+		{"fcm", push.Tokens, p.fcm.Send},
+		{"apns", push.APNsTokens, p.apns.Send},
+	} {
+		if len(provider.tokens) == 0 {
+			continue
+		}
+		result, err := provider.send(ctx, push)
+		if err != nil {
+			logger.Warn(ctx, "push notification provider failed", logger.Fields{
+				"message_id": push.MessageID,
+				"provider":   provider.name,
+				"error":      err.Error(),
+			})
+			if firstErr == nil {
+				firstErr = err
+			}
+			merged.FailedTokens = append(merged.FailedTokens, provider.tokens...)
+			continue
+		}
+		merged.Sent += result.Sent
+		merged.MessageIDs = append(merged.MessageIDs, result.MessageIDs...)
+		merged.InvalidTokens = append(merged.InvalidTokens, result.InvalidTokens...)
+		merged.FailedTokens = append(merged.FailedTokens, result.FailedTokens...)
+	}
+	if merged.Sent == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return merged, nil
+}
@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/files"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// SignedURLPrewarmProcessor handles task_type == "signed_url_prewarm" by:
+// - Calling the before_handler to list the file ids to warm
+// - Requesting their signed download URLs from the files service, which caches them
+// Enqueued ahead of scheduled lessons (e.g. by a recurring task), it keeps
+// many simultaneous joins from each minting the same URLs at start time.
+type SignedURLPrewarmProcessor struct {
+	handlers *HandlerInvoker
+	service  *files.Service
+}
+
+func NewSignedURLPrewarmProcessor(handlers *HandlerInvoker, service *files.Service) *SignedURLPrewarmProcessor {
+	return &SignedURLPrewarmProcessor{
+		handlers: handlers,
+		service:  service,
+	}
+}
+
+func (p *SignedURLPrewarmProcessor) TaskType() string  { return "signed_url_prewarm" }
+func (p *SignedURLPrewarmProcessor) HasHandlers() bool { return true }
+
+func (p *SignedURLPrewarmProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("signed_url_prewarm task missing before_handler"))
+	}
+
+	var prewarm types.SignedURLPrewarmPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &prewarm); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("signed_url_prewarm before_handler failed: %w", err))
+	}
+
+	logger.Info(ctx, "processing signed_url_prewarm task", logger.Fields{
+		"file_count": len(prewarm.FileIDs),
+	})
+
+	result := &types.SignedURLPrewarmResult{RequestedFiles: len(prewarm.FileIDs)}
+	if len(prewarm.FileIDs) == 0 {
+		return types.NewTaskSuccess(result)
+	}
+	if p.handlers.DryRun(ctx, task, "files", prewarm) {
+		result.WarmedFiles = len(prewarm.FileIDs)
+		return types.NewTaskSuccess(result)
+	}
+
+	warmed, err := p.service.WarmSignedDownloadURLs(ctx, prewarm.FileIDs)
+	if err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to warm signed download URLs: %w", err))
+	}
+	result.WarmedFiles = warmed
+
+	return types.NewTaskSuccess(result)
+}
@@ -5,17 +5,41 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/bencyrus/chatterbox/shared/logger"
 	"github.com/bencyrus/chatterbox/worker/internal/services/sms"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
 )
 
+// SMSOptions configures the checks the sms processor runs before sending.
+type SMSOptions struct {
+	// DefaultCountry is the ISO 3166-1 alpha-2 country whose national
+	// numbers recipients without a country code are read as; empty rejects
+	// them.
+	DefaultCountry string
+	// SuppressionFunction is asked whether the recipient opted out; empty
+	// skips the check.
+	SuppressionFunction string
+	// MaxSegments caps the segments a body may be billed as; 0 disables the
+	// cap. Longer bodies are rejected, or cut to the cap with
+	// TruncateOverflow.
+	MaxSegments      int
+	TruncateOverflow bool
+}
+
 type SMSProcessor struct {
-	handlers *HandlerInvoker
-	service  *sms.Service
+	handlers  *HandlerInvoker
+	service   *sms.Service
+	templates *templates.Engine
+	functions FunctionRunner
+	opts      SMSOptions
 }
 
-func NewSMSProcessor(handlers *HandlerInvoker, service *sms.Service) *SMSProcessor {
-	return &SMSProcessor{handlers: handlers, service: service}
+// NewSMSProcessor returns the sms processor. A body given as a template is
+// rendered, recipient numbers are normalized to E.164 and checked against
+// the suppression function, and the body's segments counted, before sending.
+func NewSMSProcessor(handlers *HandlerInvoker, service *sms.Service, templates *templates.Engine, functions FunctionRunner, opts SMSOptions) *SMSProcessor {
+	return &SMSProcessor{handlers: handlers, service: service, templates: templates, functions: functions, opts: opts}
 }
 
 func (p *SMSProcessor) TaskType() string  { return "sms" }
@@ -31,14 +55,103 @@ func (p *SMSProcessor) Process(ctx context.Context, task *types.Task) *types.Tas
 	}
 
 	var smsPayload types.SMSPayload
-	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task.Payload, &smsPayload); err != nil {
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &smsPayload); err != nil {
 		return types.NewTaskFailure(err)
 	}
+	if err := renderSMSTemplate(p.templates, &smsPayload); err != nil {
+		return types.NewTaskValidationFailure(err.Error())
+	}
+
+	// A malformed number would only burn provider attempts; reject it as
+	// invalid input, which is not retried.
+	toNumber, err := sms.NormalizeE164(smsPayload.ToNumber, p.opts.DefaultCountry)
+	if err != nil {
+		return types.NewTaskValidationFailure(fmt.Sprintf("invalid to_number: %v", err))
+	}
+	smsPayload.ToNumber = toNumber
+
+	segments := sms.Segments(smsPayload.Body)
+	if p.opts.MaxSegments > 0 && segments.Segments > p.opts.MaxSegments {
+		if !p.opts.TruncateOverflow {
+			return types.NewTaskValidationFailure(fmt.Sprintf(
+				"sms body is %d %s segments, over the limit of %d", segments.Segments, segments.Encoding, p.opts.MaxSegments))
+		}
+		smsPayload.Body = sms.TruncateToSegments(smsPayload.Body, p.opts.MaxSegments)
+		logger.Warn(ctx, "sms body truncated to segment limit", logger.Fields{
+			"message_id":   smsPayload.MessageID,
+			"segments":     segments.Segments,
+			"max_segments": p.opts.MaxSegments,
+			"units":        segments.Units,
+		})
+		segments = sms.Segments(smsPayload.Body)
+	}
+	logger.Info(ctx, "sms segments", logger.Fields{
+		"message_id": smsPayload.MessageID,
+		"encoding":   segments.Encoding,
+		"units":      segments.Units,
+		"segments":   segments.Segments,
+	})
+
+	suppressed, err := p.suppressed(ctx, &smsPayload)
+	if err != nil {
+		return types.NewTaskFailure(err)
+	}
+	if suppressed {
+		logger.Info(ctx, "sms suppressed, recipient opted out", logger.Fields{
+			"message_id": smsPayload.MessageID,
+			"to_number":  smsPayload.ToNumber,
+		})
+		return types.NewTaskSuccess(&sms.SMSResponse{Status: sms.StatusSuppressed})
+	}
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "sms", smsPayload) {
+		return types.NewTaskSuccess(&sms.SMSResponse{MessageID: dryRunID(task), Status: "sent", Segments: segments.Segments})
+	}
 
 	resp, err := p.service.SendSMS(ctx, &smsPayload)
 	if err != nil {
-		return types.NewTaskFailure(fmt.Errorf("failed to send SMS: %w", err))
+		err = fmt.Errorf("failed to send SMS: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
 	}
+	resp.Segments = segments.Segments
 
 	return types.NewTaskSuccess(resp)
 }
+
+// suppressed asks the suppression function whether the recipient opted out.
+// It is called with { message_id, to_number } and answers
+// { status: "succeeded", payload: { suppressed } }.
+func (p *SMSProcessor) suppressed(ctx context.Context, payload *types.SMSPayload) (bool, error) {
+	if p.opts.SuppressionFunction == "" {
+		return false, nil
+	}
+	args, err := json.Marshal(map[string]any{"message_id": payload.MessageID, "to_number": payload.ToNumber})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal sms suppression check: %w", err)
+	}
+	res, err := p.functions.RunFunction(ctx, p.opts.SuppressionFunction, args)
+	if err != nil {
+		return false, fmt.Errorf("sms suppression check failed: %w", err)
+	}
+	if res.Status != "succeeded" {
+		return false, fmt.Errorf("sms suppression check returned status %q", res.Status)
+	}
+	var check struct {
+		Suppressed bool `json:"suppressed"`
+	}
+	if len(res.Payload) > 0 {
+		if err := json.Unmarshal(res.Payload, &check); err != nil {
+			return false, fmt.Errorf("failed to decode sms suppression check: %w", err)
+		}
+	}
+	return check.Suppressed, nil
+}
@@ -0,0 +1,95 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// archiveFunction moves one batch of completed tasks to queues.task_archive.
+const archiveFunction = "queues.archive_completed_tasks"
+
+// Defaults for task_archive payload fields left unset.
+const (
+	defaultArchiveRetentionDays = 30
+	defaultArchiveBatchSize     = 1000
+	defaultArchiveMaxBatches    = 10
+)
+
+// TaskArchiveProcessor handles task_type == "task_archive" by moving tasks
+// completed more than retention_days ago, with their errors, events and
+// results, out of the hot queue tables into queues.task_archive. It runs in
+// batches of batch_size until a batch comes back short or max_batches is
+// reached, so dequeue latency does not grow with the history the queue has
+// accumulated. Schedule it as a recurring task.
+type TaskArchiveProcessor struct {
+	db FunctionRunner
+}
+
+func NewTaskArchiveProcessor(db FunctionRunner) *TaskArchiveProcessor {
+	return &TaskArchiveProcessor{db: db}
+}
+
+func (p *TaskArchiveProcessor) TaskType() string  { return "task_archive" }
+func (p *TaskArchiveProcessor) HasHandlers() bool { return false }
+
+func (p *TaskArchiveProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskArchivePayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.RetentionDays == 0 {
+		payload.RetentionDays = defaultArchiveRetentionDays
+	}
+	if payload.BatchSize == 0 {
+		payload.BatchSize = defaultArchiveBatchSize
+	}
+	if payload.MaxBatches == 0 {
+		payload.MaxBatches = defaultArchiveMaxBatches
+	}
+	batchPayload, err := json.Marshal(payload)
+	if err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to marshal archive payload: %w", err))
+	}
+
+	result := &types.TaskArchiveResult{}
+	for result.Batches < payload.MaxBatches {
+		if err := ctx.Err(); err != nil {
+			break
+		}
+		res, err := p.db.RunFunction(ctx, archiveFunction, batchPayload)
+		if err != nil {
+			return types.NewTaskFailure(fmt.Errorf("failed to archive completed tasks: %w", err))
+		}
+		if res.IsValidationFailure() {
+			return types.NewTaskValidationFailure(res.ValidationFailureMessage)
+		}
+		if !res.IsSuccess() {
+			return types.NewTaskFailure(fmt.Errorf("%s returned status %q", archiveFunction, res.Status))
+		}
+		var batch types.TaskArchiveBatch
+		if len(res.Payload) > 0 {
+			if err := json.Unmarshal(res.Payload, &batch); err != nil {
+				return types.NewTaskFailure(fmt.Errorf("failed to unmarshal archive batch: %w", err))
+			}
+		}
+
+		result.Batches++
+		result.ArchivedTasks += batch.Archived
+		result.CompletedBefore = batch.CompletedBefore
+		if batch.Archived < payload.BatchSize {
+			break
+		}
+	}
+
+	logger.Info(ctx, "archived completed tasks", logger.Fields{
+		"archived_tasks":   result.ArchivedTasks,
+		"batches":          result.Batches,
+		"retention_days":   payload.RetentionDays,
+		"completed_before": result.CompletedBefore,
+	})
+	return types.NewTaskSuccess(result)
+}
@@ -0,0 +1,87 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/files"
+	"github.com/bencyrus/chatterbox/worker/internal/services/telegram"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// TelegramMessageProcessor handles task_type == "telegram_message" by:
+// - Calling the before_handler for the chat_id and message (text, document)
+// - Signing a download URL when the document is a files service file
+// - Sending it through the Bot API (sendMessage or sendDocument)
+// - Returning the sent message's id for the success handler
+type TelegramMessageProcessor struct {
+	handlers *HandlerInvoker
+	service  *telegram.Service
+	files    *files.Service
+}
+
+func NewTelegramMessageProcessor(handlers *HandlerInvoker, service *telegram.Service, files *files.Service) *TelegramMessageProcessor {
+	return &TelegramMessageProcessor{handlers: handlers, service: service, files: files}
+}
+
+func (p *TelegramMessageProcessor) TaskType() string  { return "telegram_message" }
+func (p *TelegramMessageProcessor) HasHandlers() bool { return true }
+
+func (p *TelegramMessageProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("telegram_message task missing before_handler"))
+	}
+
+	var message types.TelegramMessagePayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &message); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	logger.Info(ctx, "telegram message payload prepared", logger.Fields{"message_id": message.MessageID})
+
+	if doc := message.Document; doc != nil && doc.FileID != 0 && doc.URL == "" && doc.TelegramFileID == "" {
+		signedURL, err := p.files.GetSignedDownloadURL(ctx, doc.FileID)
+		if err != nil {
+			return types.NewTaskFailure(fmt.Errorf("failed to get signed URL for telegram document: %w", err))
+		}
+		message.Document = &types.TelegramDocument{FileID: doc.FileID, URL: signedURL}
+	}
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "telegram", redactedTelegramMessage(message)) {
+		return types.NewTaskSuccess(&telegram.MessageResponse{})
+	}
+
+	resp, err := p.service.SendMessage(ctx, &message)
+	if err != nil {
+		err = fmt.Errorf("failed to send telegram message: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(resp)
+}
+
+// redactedTelegramMessage returns message with a signed document URL's
+// signature removed, for logging.
+func redactedTelegramMessage(message types.TelegramMessagePayload) types.TelegramMessagePayload {
+	if doc := message.Document; doc != nil && doc.FileID != 0 && doc.URL != "" {
+		redacted := *doc
+		redacted.URL = redactQuery(doc.URL)
+		message.Document = &redacted
+	}
+	return message
+}
@@ -0,0 +1,50 @@
+package processing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// renderEmailTemplate renders the template an email payload names, in the
+// payload's locale, into its html and text, and its subject unless the
+// before_handler set one. Errors
+// are the payload's fault (an unknown template or missing variables), so
+// callers fail the task validation.
+func renderEmailTemplate(engine *templates.Engine, payload *types.EmailPayload) error {
+	if payload.Template == "" {
+		return nil
+	}
+	if payload.HTML != "" || payload.Text != "" {
+		return errors.New("email has both a template and a rendered body")
+	}
+	rendered, err := engine.Email(payload.Template, payload.Locale, payload.TemplateData)
+	if err != nil {
+		return fmt.Errorf("failed to render email template %q: %w", payload.Template, err)
+	}
+	if payload.Subject == "" {
+		payload.Subject = rendered.Subject
+	}
+	payload.HTML = rendered.HTML
+	payload.Text = rendered.Text
+	return nil
+}
+
+// renderSMSTemplate renders the template an sms payload names, in the
+// payload's locale, into its body.
+func renderSMSTemplate(engine *templates.Engine, payload *types.SMSPayload) error {
+	if payload.Template == "" {
+		return nil
+	}
+	if payload.Body != "" {
+		return errors.New("sms has both a template and a body")
+	}
+	body, err := engine.SMS(payload.Template, payload.Locale, payload.TemplateData)
+	if err != nil {
+		return fmt.Errorf("failed to render sms template %q: %w", payload.Template, err)
+	}
+	payload.Body = body
+	return nil
+}
@@ -0,0 +1,52 @@
+package processing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type timingsKey struct{}
+
+// handlerTimings sums the time spent in handlers while processing one task,
+// by handler kind.
+type handlerTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+}
+
+// WithHandlerTimings returns a context under which handler invocations add
+// their duration to the totals HandlerDurations reports.
+func WithHandlerTimings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, timingsKey{}, &handlerTimings{durations: make(map[string]time.Duration)})
+}
+
+// HandlerDurations returns the milliseconds spent in each kind of handler
+// (before, success, error, ...) under ctx, or nil when none ran.
+func HandlerDurations(ctx context.Context) map[string]int64 {
+	timings, ok := ctx.Value(timingsKey{}).(*handlerTimings)
+	if !ok {
+		return nil
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	if len(timings.durations) == 0 {
+		return nil
+	}
+	out := make(map[string]int64, len(timings.durations))
+	for kind, d := range timings.durations {
+		out[kind] = d.Milliseconds()
+	}
+	return out
+}
+
+// addHandlerDuration adds d to the kind's total under ctx, if tracked.
+func addHandlerDuration(ctx context.Context, kind string, d time.Duration) {
+	timings, ok := ctx.Value(timingsKey{}).(*handlerTimings)
+	if !ok {
+		return
+	}
+	timings.mu.Lock()
+	timings.durations[kind] += d
+	timings.mu.Unlock()
+}
@@ -0,0 +1,53 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/transcripts"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// TranscriptCleanupProcessor handles task_type == "transcript_cleanup" by:
+// - Calling the before_handler to get a stored transcript
+// - Removing filler words, normalizing punctuation and splitting it into paragraphs
+// - Returning the cleaned transcript, timestamps kept, for the success handler to store
+// No provider is called; the work is done in the worker rather than in Postgres.
+type TranscriptCleanupProcessor struct {
+	handlers *HandlerInvoker
+}
+
+func NewTranscriptCleanupProcessor(handlers *HandlerInvoker) *TranscriptCleanupProcessor {
+	return &TranscriptCleanupProcessor{handlers: handlers}
+}
+
+func (p *TranscriptCleanupProcessor) TaskType() string  { return "transcript_cleanup" }
+func (p *TranscriptCleanupProcessor) HasHandlers() bool { return true }
+
+func (p *TranscriptCleanupProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("transcript_cleanup task missing before_handler"))
+	}
+
+	var cleanupPayload types.TranscriptCleanupPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &cleanupPayload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("transcript_cleanup before_handler failed: %w", err))
+	}
+
+	result := transcripts.Clean(cleanupPayload.Text, cleanupPayload.Words, cleanupPayload.LanguageCode)
+
+	logger.Info(ctx, "cleaned transcript", logger.Fields{
+		"profile_cue_recording_id": cleanupPayload.ProfileCueRecordingID,
+		"words":                    len(cleanupPayload.Words),
+		"paragraphs":               len(result.Paragraphs),
+		"fillers_removed":          result.FillersRemoved,
+	})
+
+	return types.NewTaskSuccess(&result)
+}
@@ -0,0 +1,72 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/files"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// TranscriptionArchiveProcessor handles task_type == "transcription_archive" by:
+// - Calling the before_handler to get the provider's full response and an upload intent
+// - Requesting a signed upload URL for the intent from the files service
+// - Uploading the response JSON to GCS
+// - Returning the upload intent for the success handler to record as a file
+// The archive keeps word-level timestamps without storing them in Postgres.
+type TranscriptionArchiveProcessor struct {
+	handlers *HandlerInvoker
+	files    *files.Service
+}
+
+func NewTranscriptionArchiveProcessor(handlers *HandlerInvoker, filesService *files.Service) *TranscriptionArchiveProcessor {
+	return &TranscriptionArchiveProcessor{handlers: handlers, files: filesService}
+}
+
+func (p *TranscriptionArchiveProcessor) TaskType() string  { return "transcription_archive" }
+func (p *TranscriptionArchiveProcessor) HasHandlers() bool { return true }
+
+func (p *TranscriptionArchiveProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("transcription_archive task missing before_handler"))
+	}
+
+	var archivePayload types.TranscriptionArchivePayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &archivePayload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("transcription_archive before_handler failed: %w", err))
+	}
+	if len(archivePayload.Response) == 0 || !json.Valid(archivePayload.Response) {
+		return types.NewTaskFailure(&types.ValidationError{Message: "transcription_archive response must be JSON"})
+	}
+
+	logger.Info(ctx, "processing transcription_archive task", logger.Fields{
+		"profile_cue_recording_id": archivePayload.ProfileCueRecordingID,
+		"upload_intent_id":         archivePayload.UploadIntentID,
+		"size_bytes":               len(archivePayload.Response),
+	})
+
+	result := &types.TranscriptionArchiveResult{
+		UploadIntentID: archivePayload.UploadIntentID,
+		SizeBytes:      len(archivePayload.Response),
+	}
+	if p.handlers.DryRun(ctx, task, "files", result) {
+		return types.NewTaskSuccess(result)
+	}
+
+	upload, err := p.files.GetSignedUploadURL(ctx, archivePayload.UploadIntentID)
+	if err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to get signed upload URL: %w", err))
+	}
+
+	if err := p.files.UploadBySignedURL(ctx, upload, "application/json", archivePayload.Response); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to upload transcription response: %w", err))
+	}
+
+	return types.NewTaskSuccess(result)
+}
@@ -0,0 +1,79 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/transcription"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// TranscriptionPollProcessor handles task_type == "transcription_poll" by:
+// - Calling the before_handler to resolve the attempt's ElevenLabs request_id
+// - Fetching the transcript from ElevenLabs once
+// - Returning it, or status "processing" when it is not ready, for the success handler to record
+// It is the fallback for webhooks that are late or cannot be delivered (local
+// development without a public URL); the supervisor schedules polls with
+// backoff while it waits.
+type TranscriptionPollProcessor struct {
+	handlers   *HandlerInvoker
+	elevenLabs *transcription.ElevenLabsProvider
+}
+
+func NewTranscriptionPollProcessor(
+	handlers *HandlerInvoker,
+	elevenLabs *transcription.ElevenLabsProvider,
+) *TranscriptionPollProcessor {
+	return &TranscriptionPollProcessor{
+		handlers:   handlers,
+		elevenLabs: elevenLabs,
+	}
+}
+
+func (p *TranscriptionPollProcessor) TaskType() string  { return "transcription_poll" }
+func (p *TranscriptionPollProcessor) HasHandlers() bool { return true }
+
+func (p *TranscriptionPollProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("transcription_poll task missing before_handler"))
+	}
+
+	var pollPayload types.TranscriptionPollPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &pollPayload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("transcription_poll before_handler failed: %w", err))
+	}
+
+	logger.Info(ctx, "processing transcription_poll task", logger.Fields{
+		"attempt_id": pollPayload.RecordingTranscriptionAttemptID,
+		"request_id": pollPayload.RequestID,
+	})
+
+	if p.handlers.DryRun(ctx, task, transcription.ProviderElevenLabs, pollPayload) {
+		return types.NewTaskSuccess(&types.TranscriptionPollResult{RequestID: pollPayload.RequestID, Status: "processing"})
+	}
+
+	transcript, err := p.elevenLabs.Transcript(ctx, pollPayload.RequestID)
+	if errors.Is(err, transcription.ErrTranscriptNotReady) {
+		return types.NewTaskSuccess(&types.TranscriptionPollResult{RequestID: pollPayload.RequestID, Status: "processing"})
+	}
+	if err != nil {
+		err = fmt.Errorf("ElevenLabs transcript poll error: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(&types.TranscriptionPollResult{
+		RequestID:  pollPayload.RequestID,
+		Status:     "completed",
+		Transcript: transcript,
+	})
+}
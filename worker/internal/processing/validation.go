@@ -0,0 +1,111 @@
+package processing
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaFiles holds the payload JSON Schemas (draft 2020-12). A file named
+// <task_type>.json is applied to that task type's payloads; the others are
+// shared definitions referenced with $ref.
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// PayloadValidator is implemented by processors that check their payloads in
+// code, in addition to or instead of a schema.
+type PayloadValidator interface {
+	// ValidatePayload returns an error describing why payload is malformed.
+	ValidatePayload(payload json.RawMessage) error
+}
+
+// compileSchema compiles schemas/<taskType>.json, or returns nil when the task
+// type has no schema. A schema that fails to compile is a programming error.
+func compileSchema(taskType string) *jsonschema.Schema {
+	name := taskType + ".json"
+	if _, err := fs.Stat(schemaFiles, "schemas/"+name); err != nil {
+		return nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	entries, err := fs.ReadDir(schemaFiles, "schemas")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read payload schemas: %v", err))
+	}
+	for _, entry := range entries {
+		data, err := schemaFiles.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("failed to read payload schema %s: %v", entry.Name(), err))
+		}
+		if err := compiler.AddResource(entry.Name(), bytes.NewReader(data)); err != nil {
+			panic(fmt.Sprintf("invalid payload schema %s: %v", entry.Name(), err))
+		}
+	}
+
+	schema, err := compiler.Compile(name)
+	if err != nil {
+		panic(fmt.Sprintf("invalid payload schema %s: %v", name, err))
+	}
+	return schema
+}
+
+// validatePayload checks a task payload against the processor's schema and
+// typed validator. A malformed payload is reported as a ValidationError so
+// the task takes the validation outcome without any handler or provider call.
+func validatePayload(schema *jsonschema.Schema, p Processor, task *types.Task) error {
+	if schema != nil {
+		var doc any
+		if err := json.Unmarshal(task.Payload, &doc); err != nil {
+			return &types.ValidationError{Message: fmt.Sprintf("invalid %s payload: %v", task.TaskType, err)}
+		}
+		if err := schema.Validate(doc); err != nil {
+			return &types.ValidationError{Message: fmt.Sprintf("invalid %s payload: %s", task.TaskType, describeSchemaError(err))}
+		}
+	}
+
+	if v, ok := p.(PayloadValidator); ok {
+		if err := v.ValidatePayload(task.Payload); err != nil {
+			return &types.ValidationError{Message: fmt.Sprintf("invalid %s payload: %v", task.TaskType, err)}
+		}
+	}
+	return nil
+}
+
+// describeSchemaError lists the leaf schema violations as
+// "<instance location>: <message>", e.g. "/before_handler: missing property".
+func describeSchemaError(err error) string {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err.Error()
+	}
+
+	var leaves []string
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			leaves = append(leaves, location+": "+e.Message)
+			return
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(ve)
+
+	sort.Strings(leaves)
+	return strings.Join(leaves, "; ")
+}
@@ -0,0 +1,120 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/worker/internal/services/verify"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// VerifyOTPSendProcessor handles task_type == "verify_otp_send" by:
+// - Calling the before_handler for the number, channel and locale to verify
+// - Starting a Twilio Verify verification, which generates and sends the code
+// - Returning the verification SID and status for the success handler
+type VerifyOTPSendProcessor struct {
+	handlers *HandlerInvoker
+	service  *verify.Service
+}
+
+func NewVerifyOTPSendProcessor(handlers *HandlerInvoker, service *verify.Service) *VerifyOTPSendProcessor {
+	return &VerifyOTPSendProcessor{handlers: handlers, service: service}
+}
+
+func (p *VerifyOTPSendProcessor) TaskType() string  { return "verify_otp_send" }
+func (p *VerifyOTPSendProcessor) HasHandlers() bool { return true }
+
+func (p *VerifyOTPSendProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("verify_otp_send task missing before_handler"))
+	}
+
+	var send types.VerifyOTPSendPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &send); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "twilio_verify", send) {
+		return types.NewTaskSuccess(&types.VerifyOTPResult{VerificationSID: dryRunID(task), Status: "pending", Channel: send.Channel})
+	}
+
+	result, err := p.service.Send(ctx, &send)
+	if err != nil {
+		err = fmt.Errorf("failed to start verification: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
+
+// VerifyOTPCheckProcessor handles task_type == "verify_otp_check" by:
+// - Calling the before_handler for the verification and the code the user entered
+// - Checking the code with Twilio Verify
+// - Returning the verification status and whether the code was valid
+//
+// A wrong or expired code is a successful check with valid false.
+type VerifyOTPCheckProcessor struct {
+	handlers *HandlerInvoker
+	service  *verify.Service
+}
+
+func NewVerifyOTPCheckProcessor(handlers *HandlerInvoker, service *verify.Service) *VerifyOTPCheckProcessor {
+	return &VerifyOTPCheckProcessor{handlers: handlers, service: service}
+}
+
+func (p *VerifyOTPCheckProcessor) TaskType() string  { return "verify_otp_check" }
+func (p *VerifyOTPCheckProcessor) HasHandlers() bool { return true }
+
+func (p *VerifyOTPCheckProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("verify_otp_check task missing before_handler"))
+	}
+
+	var check types.VerifyOTPCheckPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &check); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	// Every check counts against the verification's attempts.
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	redacted := check
+	redacted.Code = "[redacted]"
+	if p.handlers.DryRun(ctx, task, "twilio_verify", redacted) {
+		// A dry run never approves a code.
+		return types.NewTaskSuccess(&types.VerifyOTPResult{VerificationSID: check.VerificationSID, Status: "pending"})
+	}
+
+	result, err := p.service.Check(ctx, &check)
+	if err != nil {
+		err = fmt.Errorf("failed to check verification: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
@@ -0,0 +1,68 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/webpush"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// WebPushProcessor handles task_type == "web_push" by:
+// - Calling the before_handler for the browser subscriptions and the data to deliver
+// - Encrypting it per subscription and posting it to each push service with VAPID
+// - Returning per-subscription outcomes, with expired subscriptions for the success handler to remove
+type WebPushProcessor struct {
+	handlers *HandlerInvoker
+	service  *webpush.Service
+}
+
+func NewWebPushProcessor(handlers *HandlerInvoker, service *webpush.Service) *WebPushProcessor {
+	return &WebPushProcessor{handlers: handlers, service: service}
+}
+
+func (p *WebPushProcessor) TaskType() string  { return "web_push" }
+func (p *WebPushProcessor) HasHandlers() bool { return true }
+
+func (p *WebPushProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("web_push task missing before_handler"))
+	}
+
+	var push types.WebPushPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &push); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	logger.Info(ctx, "web push payload prepared", logger.Fields{
+		"message_id":    push.MessageID,
+		"subscriptions": len(push.Subscriptions),
+	})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "web_push", push) {
+		return types.NewTaskSuccess(&types.WebPushResult{Sent: len(push.Subscriptions)})
+	}
+
+	result, err := p.service.Send(ctx, &push)
+	if err != nil {
+		err = fmt.Errorf("failed to send web push: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
@@ -0,0 +1,67 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/bencyrus/chatterbox/worker/internal/services/webhook"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// WebhookProcessor handles task_type == "webhook" by:
+// - Calling the before_handler for the request to send (url, method, headers, body, hmac_secret)
+// - Delivering it and returning the status, latency and start of the response body
+// Failed deliveries are retried within the worker's retry budget for the
+// task type (WORKER_TASK_TYPE_MAX_ATTEMPTS), so Postgres can trigger
+// third-party callbacks without new Go code.
+type WebhookProcessor struct {
+	handlers *HandlerInvoker
+	service  *webhook.Service
+}
+
+func NewWebhookProcessor(handlers *HandlerInvoker, service *webhook.Service) *WebhookProcessor {
+	return &WebhookProcessor{handlers: handlers, service: service}
+}
+
+func (p *WebhookProcessor) TaskType() string  { return "webhook" }
+func (p *WebhookProcessor) HasHandlers() bool { return true }
+
+func (p *WebhookProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("webhook task missing before_handler"))
+	}
+
+	var hook types.WebhookPayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &hook); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("webhook before_handler failed: %w", err))
+	}
+
+	if p.handlers.DryRun(ctx, task, "webhook", redactedWebhook(hook)) {
+		return types.NewTaskSuccess(&types.WebhookResult{StatusCode: 200})
+	}
+
+	result, err := p.service.Deliver(ctx, strconv.FormatInt(task.TaskID, 10), &hook)
+	if err != nil {
+		err = fmt.Errorf("failed to deliver webhook: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
+
+// redactedWebhook returns hook without its signing secret, for logging.
+func redactedWebhook(hook types.WebhookPayload) types.WebhookPayload {
+	if hook.HMACSecret != "" {
+		hook.HMACSecret = "REDACTED"
+	}
+	return hook
+}
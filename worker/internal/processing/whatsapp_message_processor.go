@@ -0,0 +1,68 @@
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/services/whatsapp"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// WhatsAppMessageProcessor handles task_type == "whatsapp_message" by:
+// - Calling the before_handler for the recipient, template and its parameters
+// - Sending the template message through the WhatsApp Business Cloud API
+// - Returning WhatsApp's message id for the success handler
+type WhatsAppMessageProcessor struct {
+	handlers *HandlerInvoker
+	service  *whatsapp.Service
+}
+
+func NewWhatsAppMessageProcessor(handlers *HandlerInvoker, service *whatsapp.Service) *WhatsAppMessageProcessor {
+	return &WhatsAppMessageProcessor{handlers: handlers, service: service}
+}
+
+func (p *WhatsAppMessageProcessor) TaskType() string  { return "whatsapp_message" }
+func (p *WhatsAppMessageProcessor) HasHandlers() bool { return true }
+
+func (p *WhatsAppMessageProcessor) Process(ctx context.Context, task *types.Task) *types.TaskResult {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return types.NewTaskFailure(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	if payload.BeforeHandler == "" {
+		return types.NewTaskFailure(fmt.Errorf("whatsapp_message task missing before_handler"))
+	}
+
+	var message types.WhatsAppMessagePayload
+	if err := p.handlers.CallBefore(ctx, payload.BeforeHandler, task, &message); err != nil {
+		return types.NewTaskFailure(err)
+	}
+
+	logger.Info(ctx, "whatsapp message payload prepared", logger.Fields{
+		"message_id": message.MessageID,
+		"template":   message.Template,
+	})
+
+	if claimed, err := p.handlers.ClaimSideEffect(ctx, task); err != nil {
+		return types.NewTaskFailure(err)
+	} else if !claimed {
+		return types.NewTaskSkipped()
+	}
+
+	if p.handlers.DryRun(ctx, task, "whatsapp", message) {
+		return types.NewTaskSuccess(&types.WhatsAppMessageResult{})
+	}
+
+	result, err := p.service.SendTemplate(ctx, &message)
+	if err != nil {
+		err = fmt.Errorf("failed to send whatsapp message: %w", err)
+		if at, ok := types.RescheduleTime(err); ok {
+			return types.NewTaskReschedule(at, err)
+		}
+		return types.NewTaskFailure(err)
+	}
+
+	return types.NewTaskSuccess(result)
+}
@@ -0,0 +1,105 @@
+// Package ratelimit throttles outbound calls to external providers with a
+// token bucket per provider, shared by every worker goroutine, so raising
+// concurrency cannot exceed a provider's quota.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"golang.org/x/time/rate"
+)
+
+// Provider names, used as the provider metric label.
+const (
+	ProviderResend     = "resend"
+	ProviderSES        = "ses"
+	ProviderSendGrid   = "sendgrid"
+	ProviderElevenLabs = "elevenlabs"
+	ProviderDeepgram   = "deepgram"
+	ProviderOpenAI     = "openai"
+	ProviderFiles      = "files"
+	ProviderDiscord    = "discord"
+	ProviderTelegram   = "telegram"
+	ProviderFCM        = "fcm"
+	ProviderAPNs       = "apns"
+	ProviderWebPush    = "web_push"
+	ProviderTwilio     = "twilio"
+	ProviderVonage     = "vonage"
+	ProviderVerify     = "twilio_verify"
+	ProviderWhatsApp   = "whatsapp"
+)
+
+// Limiter is a token bucket for one provider. A nil *Limiter allows every
+// call.
+type Limiter struct {
+	provider string
+	bucket   *rate.Limiter
+	maxWait  time.Duration
+}
+
+// New returns a limiter allowing rps requests per second to provider, with
+// bursts of up to rps (at least 1) requests. A call that would wait longer
+// than maxWait for a token is rejected instead. It returns nil when rps is 0,
+// disabling the limit.
+func New(provider string, rps float64, maxWait time.Duration) *Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	burst := int(math.Ceil(rps))
+	return &Limiter{
+		provider: provider,
+		bucket:   rate.NewLimiter(rate.Limit(rps), burst),
+		maxWait:  maxWait,
+	}
+}
+
+// Transport wraps base so each request takes a token first. With a nil
+// limiter it returns base unchanged.
+func (l *Limiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return base
+	}
+	return &transport{limiter: l, base: base}
+}
+
+type transport struct {
+	limiter *Limiter
+	base    http.RoundTripper
+}
+
+// RoundTrip blocks until a token is available when that takes at most
+// maxWait. Otherwise it fails with a rate-limited error carrying the wait as
+// its retry delay, so the worker reschedules the task instead of holding a
+// goroutine.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.limiter
+	reservation := l.bucket.Reserve()
+	delay := reservation.Delay()
+	if delay > l.maxWait {
+		reservation.Cancel()
+		metrics.ProviderRateLimitRejected.WithLabelValues(l.provider).Inc()
+		return nil, types.RateLimited(
+			fmt.Errorf("%s rate limit: no request token available within %s", l.provider, l.maxWait),
+			delay,
+		)
+	}
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			reservation.Cancel()
+			return nil, req.Context().Err()
+		}
+	}
+	metrics.ProviderRateLimitWait.WithLabelValues(l.provider).Observe(delay.Seconds())
+
+	return t.base.RoundTrip(req)
+}
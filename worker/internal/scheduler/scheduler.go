@@ -0,0 +1,143 @@
+// Package scheduler turns recurring task definitions (queues.recurring_task)
+// into concrete queue tasks.
+//
+// Every worker instance runs a Scheduler, but only the one holding the
+// scheduler lease in the database enqueues anything; the others keep trying to
+// acquire it so scheduling fails over when the leader stops renewing. The
+// database also guards each run, so a brief overlap between leaders cannot
+// enqueue the same run twice.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/database"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"github.com/robfig/cron/v3"
+)
+
+type Scheduler struct {
+	db       *database.Client
+	interval time.Duration
+	leaseTTL time.Duration
+	holder   string
+
+	leader bool
+}
+
+// NewScheduler returns a scheduler that checks for due definitions every
+// interval and holds leadership for leaseTTL between renewals.
+func NewScheduler(db *database.Client, interval, leaseTTL time.Duration) *Scheduler {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "worker"
+	}
+	return &Scheduler{
+		db:       db,
+		interval: interval,
+		leaseTTL: leaseTTL,
+		holder:   fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}
+}
+
+// Run schedules until ctx is canceled, then releases the lease if held.
+func (s *Scheduler) Run(ctx context.Context) {
+	logger.Info(ctx, "starting recurring task scheduler", logger.Fields{
+		"interval":  s.interval,
+		"lease_ttl": s.leaseTTL,
+		"holder":    s.holder,
+	})
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			if s.leader {
+				releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				if err := s.db.ReleaseSchedulerLease(releaseCtx, s.holder); err != nil {
+					logger.Warn(ctx, "failed to release scheduler lease", logger.Fields{"error": err.Error()})
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick renews (or tries to take) leadership and, when leader, schedules every
+// due definition.
+func (s *Scheduler) tick(ctx context.Context) {
+	leader, err := s.db.AcquireSchedulerLease(ctx, s.holder, s.leaseTTL)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error(ctx, "failed to acquire scheduler lease", err)
+		}
+		return
+	}
+	if leader != s.leader {
+		logger.Info(ctx, "scheduler leadership changed", logger.Fields{
+			"holder": s.holder,
+			"leader": leader,
+		})
+		s.leader = leader
+	}
+	if !leader {
+		return
+	}
+
+	due, err := s.db.DueRecurringTasks(ctx)
+	if err != nil {
+		logger.Error(ctx, "failed to list due recurring tasks", err)
+		return
+	}
+	for _, rt := range due {
+		s.schedule(ctx, rt)
+	}
+}
+
+// schedule enqueues rt's due run (if any) and advances it to its next run
+// time. A definition with an invalid cron expression is logged and left alone.
+func (s *Scheduler) schedule(ctx context.Context, rt types.RecurringTask) {
+	fields := logger.Fields{
+		"recurring_task_id": rt.RecurringTaskID,
+		"name":              rt.Name,
+		"cron_expression":   rt.CronExpression,
+	}
+
+	schedule, err := cron.ParseStandard(rt.CronExpression)
+	if err != nil {
+		fields["error"] = err.Error()
+		logger.Warn(ctx, "skipping recurring task with invalid cron expression", fields)
+		return
+	}
+
+	// Missed runs collapse into the one being enqueued now; the next run is
+	// computed from the current time rather than from the missed slot.
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		logger.Warn(ctx, "skipping recurring task whose cron expression never fires", fields)
+		return
+	}
+
+	enqueued, err := s.db.ScheduleRecurringTask(ctx, rt.RecurringTaskID, rt.NextRunAt, next)
+	if err != nil {
+		logger.Error(ctx, "failed to schedule recurring task", err, fields)
+		return
+	}
+
+	fields["next_run_at"] = next
+	if enqueued {
+		logger.Info(ctx, "recurring task enqueued", fields)
+	} else {
+		logger.Debug(ctx, "recurring task scheduled", fields)
+	}
+}
@@ -0,0 +1,85 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tokenRefresh is how long a provider token is reused. APNs rejects tokens
+// older than an hour and throttles providers that mint a new one more often
+// than every 20 minutes.
+const tokenRefresh = 40 * time.Minute
+
+// tokenSource signs APNs provider tokens (ES256 JWTs) with a .p8 key and
+// reuses each one for tokenRefresh.
+type tokenSource struct {
+	teamID string
+	keyID  string
+	key    *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func newTokenSource(teamID, keyID, privateKeyPEM string) (*tokenSource, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid APNs private key: no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs private key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve.Params().BitSize != 256 {
+		return nil, errors.New("invalid APNs private key: not a P-256 key")
+	}
+	return &tokenSource{teamID: teamID, keyID: keyID, key: key}, nil
+}
+
+// Token returns the current provider token, signing a new one when it is
+// due.
+func (t *tokenSource) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Since(t.issuedAt) < tokenRefresh {
+		return t.token, nil
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": t.keyID})
+	claims, _ := json.Marshal(map[string]any{"iss": t.teamID, "iat": now.Unix()})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, t.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs provider token: %w", err)
+	}
+	// JWS wants the raw 32-byte r and s, not ASN.1.
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	t.token = unsigned + "." + enc.EncodeToString(sig)
+	t.issuedAt = now
+	return t.token, nil
+}
+
+// Reset drops the cached token after APNs rejected it as expired or
+// invalid.
+func (t *tokenSource) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ""
+}
@@ -0,0 +1,303 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	productionURL = "https://api.push.apple.com"
+	sandboxURL    = "https://api.sandbox.push.apple.com"
+	// maxTokens bounds the devices one task notifies.
+	maxTokens = 500
+	// sendConcurrency is how many devices are sent to at once; APNs takes
+	// one token per request, multiplexed over one HTTP/2 connection.
+	sendConcurrency = 10
+)
+
+// APNs error reasons meaning the token will never work again for this app.
+var invalidTokenReasons = map[string]bool{
+	"BadDeviceToken":         true,
+	"Unregistered":           true,
+	"DeviceTokenNotForTopic": true,
+}
+
+type Service struct {
+	baseURL    string
+	topic      string
+	tokens     *tokenSource
+	configErr  error
+	httpClient *http.Client
+}
+
+type errorResponse struct {
+	Reason string `json:"reason"`
+}
+
+// NewService returns an APNs client for the app bundle id topic,
+// authenticated with provider tokens signed by the .p8 privateKey (keyID of
+// teamID). sandbox selects the development gateway. Sends are throttled by
+// limiter and refused while circuit is open. When the credentials are
+// missing or invalid every send fails permanently.
+func NewService(teamID, keyID, privateKey, topic string, sandbox bool, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	s := &Service{
+		baseURL: productionURL,
+		topic:   topic,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+	if sandbox {
+		s.baseURL = sandboxURL
+	}
+	if teamID == "" || keyID == "" || privateKey == "" || topic == "" {
+		s.configErr = errors.New("APNS_TEAM_ID, APNS_KEY_ID, APNS_PRIVATE_KEY and APNS_TOPIC are required for APNs push notifications")
+		return s
+	}
+	s.tokens, s.configErr = newTokenSource(teamID, keyID, privateKey)
+	return s
+}
+
+// tokenOutcome is the result of sending to one device.
+type tokenOutcome struct {
+	apnsID  string
+	invalid bool
+	err     error
+	// fatal marks an error about the notification itself (e.g. a payload
+	// too large), which fails the task instead of one device.
+	fatal bool
+}
+
+// Send delivers payload to each of its APNsTokens, with the same outcome
+// rules as the FCM service: tokens APNs rejects as bad or unregistered are
+// reported in InvalidTokens, the notification being rejected fails the
+// task, and it is retried only when no device was reached and a failure was
+// transient.
+func (s *Service) Send(ctx context.Context, payload *types.PushNotificationPayload) (*types.PushNotificationResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("push notification payload is nil")
+	}
+	if s.configErr != nil {
+		return nil, types.Permanent(s.configErr)
+	}
+	if len(payload.APNsTokens) == 0 {
+		return nil, types.Permanent(errors.New("push notification has no APNs device tokens"))
+	}
+	if len(payload.APNsTokens) > maxTokens {
+		return nil, types.Permanent(fmt.Errorf("push notification has more than %d APNs device tokens", maxTokens))
+	}
+	body, headers, err := buildRequest(payload, s.topic)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+	providerToken, err := s.tokens.Token()
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+	headers.Set("Authorization", "bearer "+providerToken)
+
+	logger.Info(ctx, "sending APNs push notification", logger.Fields{
+		"message_id": payload.MessageID,
+		"devices":    len(payload.APNsTokens),
+		"push_type":  headers.Get("apns-push-type"),
+	})
+
+	outcomes := make([]tokenOutcome, len(payload.APNsTokens))
+	sem := make(chan struct{}, sendConcurrency)
+	var wg sync.WaitGroup
+	for i, token := range payload.APNsTokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i] = s.sendOne(ctx, token, body, headers)
+		}()
+	}
+	wg.Wait()
+
+	result := &types.PushNotificationResult{}
+	var transient error
+	for i, outcome := range outcomes {
+		switch {
+		case outcome.fatal:
+			return nil, outcome.err
+		case outcome.invalid:
+			result.InvalidTokens = append(result.InvalidTokens, payload.APNsTokens[i])
+		case outcome.err != nil:
+			result.FailedTokens = append(result.FailedTokens, payload.APNsTokens[i])
+			if transient == nil {
+				transient = outcome.err
+			}
+		default:
+			result.Sent++
+			result.MessageIDs = append(result.MessageIDs, outcome.apnsID)
+		}
+	}
+	if result.Sent == 0 && transient != nil {
+		return nil, transient
+	}
+
+	logger.Info(ctx, "APNs push notification sent", logger.Fields{
+		"message_id":     payload.MessageID,
+		"sent":           result.Sent,
+		"invalid_tokens": len(result.InvalidTokens),
+		"failed_tokens":  len(result.FailedTokens),
+	})
+
+	return result, nil
+}
+
+func (s *Service) sendOne(ctx context.Context, token string, body []byte, headers http.Header) tokenOutcome {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return tokenOutcome{err: fmt.Errorf("failed to create HTTP request: %w", err), fatal: true}
+	}
+	req.Header = headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return tokenOutcome{err: types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return tokenOutcome{apnsID: resp.Header.Get("apns-id")}
+	}
+
+	var apiErr errorResponse
+	_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+	err = fmt.Errorf("APNs error (status %d): %s", resp.StatusCode, apiErr.Reason)
+
+	switch {
+	case invalidTokenReasons[apiErr.Reason]:
+		return tokenOutcome{invalid: true, err: err}
+	case apiErr.Reason == "ExpiredProviderToken" || apiErr.Reason == "InvalidProviderToken":
+		// The next send signs a new provider token.
+		s.tokens.Reset()
+		return tokenOutcome{err: types.Retryable(err)}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return tokenOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)}
+	default:
+		return tokenOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err), fatal: true}
+	}
+}
+
+// buildRequest returns the JSON body and APNs headers shared by every
+// device of payload.
+func buildRequest(payload *types.PushNotificationPayload, topic string) ([]byte, http.Header, error) {
+	opts := payload.APNs
+	if opts == nil {
+		opts = &types.APNsOptions{}
+	}
+	pushType := opts.PushType
+	if pushType == "" {
+		pushType = "alert"
+	}
+
+	aps := map[string]any{}
+	if payload.Title != "" || payload.Body != "" {
+		aps["alert"] = map[string]string{"title": payload.Title, "body": payload.Body}
+	}
+	if opts.Sound != "" {
+		aps["sound"] = opts.Sound
+	}
+	if opts.Badge != nil {
+		aps["badge"] = *opts.Badge
+	}
+	if opts.ThreadID != "" {
+		aps["thread-id"] = opts.ThreadID
+	}
+	if opts.InterruptionLevel != "" {
+		aps["interruption-level"] = opts.InterruptionLevel
+	}
+	if opts.RelevanceScore != nil {
+		aps["relevance-score"] = *opts.RelevanceScore
+	}
+
+	priority := 10
+	switch pushType {
+	case "alert":
+		if aps["alert"] == nil {
+			return nil, nil, errors.New("APNs alert push needs a title or body")
+		}
+		if payload.ImageURL != "" {
+			// Images are downloaded by the app's notification service
+			// extension, which only runs for mutable content.
+			aps["mutable-content"] = 1
+		}
+	case "background":
+		aps["content-available"] = 1
+		priority = 5
+	case "liveactivity":
+		if opts.Event == "" || len(opts.ContentState) == 0 {
+			return nil, nil, errors.New("APNs live activity push needs an event and content_state")
+		}
+		timestamp := opts.Timestamp
+		if timestamp == 0 {
+			timestamp = time.Now().Unix()
+		}
+		aps["event"] = opts.Event
+		aps["content-state"] = opts.ContentState
+		aps["timestamp"] = timestamp
+		if opts.StaleDate != 0 {
+			aps["stale-date"] = opts.StaleDate
+		}
+		if opts.DismissalDate != 0 {
+			aps["dismissal-date"] = opts.DismissalDate
+		}
+		if opts.AttributesType != "" {
+			aps["attributes-type"] = opts.AttributesType
+			aps["attributes"] = opts.Attributes
+		}
+		topic += ".push-type.liveactivity"
+	default:
+		return nil, nil, fmt.Errorf("unsupported APNs push_type %q", pushType)
+	}
+	if opts.Priority != 0 {
+		priority = opts.Priority
+	}
+
+	// Custom keys sit beside aps, as the app reads them from userInfo.
+	body := map[string]any{"aps": aps}
+	for key, value := range payload.Data {
+		if key != "aps" {
+			body[key] = value
+		}
+	}
+	if payload.ImageURL != "" {
+		body["image_url"] = payload.ImageURL
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal APNs payload: %w", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("apns-topic", topic)
+	headers.Set("apns-push-type", pushType)
+	headers.Set("apns-priority", strconv.Itoa(priority))
+	if payload.TTLSeconds > 0 {
+		headers.Set("apns-expiration", strconv.FormatInt(time.Now().Add(time.Duration(payload.TTLSeconds)*time.Second).Unix(), 10))
+	}
+	if opts.CollapseID != "" {
+		headers.Set("apns-collapse-id", opts.CollapseID)
+	}
+	return encoded, headers, nil
+}
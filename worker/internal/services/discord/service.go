@@ -0,0 +1,155 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Discord's limits on a webhook message.
+const (
+	maxContentLength = 2000
+	maxEmbeds        = 10
+)
+
+type Service struct {
+	httpClient *http.Client
+}
+
+type WebhookRequest struct {
+	Content   string               `json:"content,omitempty"`
+	Username  string               `json:"username,omitempty"`
+	AvatarURL string               `json:"avatar_url,omitempty"`
+	Embeds    []types.DiscordEmbed `json:"embeds,omitempty"`
+}
+
+// MessageResponse is the part of the created message the worker keeps. The
+// webhook is called with wait=true so Discord returns it.
+type MessageResponse struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// NewService returns a Discord webhook client whose calls are throttled by
+// limiter and refused while circuit is open.
+func NewService(limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	return &Service{
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+// SendMessage posts payload to its Discord webhook. The webhook URL carries
+// the webhook's token, so only its host is ever logged.
+func (s *Service) SendMessage(ctx context.Context, payload *types.DiscordMessagePayload) (*MessageResponse, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("discord message payload is nil")
+	}
+	target, err := webhookURL(payload.WebhookURL)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+	if err := validateMessage(payload); err != nil {
+		return nil, types.Permanent(err)
+	}
+
+	logger.Info(ctx, "sending discord message", logger.Fields{
+		"message_id": payload.MessageID,
+		"embeds":     len(payload.Embeds),
+	})
+
+	reqBody, err := json.Marshal(WebhookRequest{
+		Content:   payload.Content,
+		Username:  payload.Username,
+		AvatarURL: payload.AvatarURL,
+		Embeds:    payload.Embeds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal discord request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// The error would quote the URL, token included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		errMsg := fmt.Sprintf("discord API error (status %d)", resp.StatusCode)
+		if apiErr.Message != "" {
+			errMsg += fmt.Sprintf(": %s (code %d)", apiErr.Message, apiErr.Code)
+		}
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+
+	var message MessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	logger.Info(ctx, "discord message sent successfully", logger.Fields{
+		"message_id":         payload.MessageID,
+		"discord_message_id": message.ID,
+	})
+
+	return &message, nil
+}
+
+// webhookURL checks raw is a Discord webhook URL and returns it with
+// wait=true, so the response carries the created message.
+func webhookURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "", errors.New("invalid discord webhook url")
+	}
+	query := u.Query()
+	query.Set("wait", "true")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func validateMessage(payload *types.DiscordMessagePayload) error {
+	if payload.Content == "" && len(payload.Embeds) == 0 {
+		return errors.New("discord message needs content or embeds")
+	}
+	if utf8.RuneCountInString(payload.Content) > maxContentLength {
+		return fmt.Errorf("discord message content exceeds %d characters", maxContentLength)
+	}
+	if len(payload.Embeds) > maxEmbeds {
+		return fmt.Errorf("discord message has more than %d embeds", maxEmbeds)
+	}
+	return nil
+}
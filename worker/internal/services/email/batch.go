@@ -0,0 +1,136 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// BatchProvider is an EmailProvider with a batch endpoint, which accepts or
+// refuses up to BatchLimit emails in one call.
+type BatchProvider interface {
+	EmailProvider
+	BatchLimit() int
+	SendBatch(ctx context.Context, payloads []*types.EmailPayload, idempotencyKey string) ([]*EmailResponse, error)
+}
+
+// BatchResult is one email's outcome in SendBatch: its response, or the
+// error it alone failed with.
+type BatchResult struct {
+	Response *EmailResponse
+	Err      error
+}
+
+// SendBatch sends payloads, which may not carry attachments or send_at.
+// Through a primary with a batch endpoint (Resend) they go out in chunks of
+// its BatchLimit, chunk i with idempotencyKey-chunk-<i> so a retried batch
+// does not resend accepted chunks; a chunk failing transiently is sent one
+// by one through the fallback when there is one, and otherwise fails the
+// whole call, as does an error that is not the emails' fault. Other
+// primaries, and capture mode, send each email with SendEmail. Results are in
+// payloads' order.
+func (s *Service) SendBatch(ctx context.Context, payloads []*types.EmailPayload, idempotencyKey string) ([]BatchResult, error) {
+	results := make([]BatchResult, len(payloads))
+	batcher, ok := s.primary.(BatchProvider)
+	if !ok || s.capture {
+		for i, payload := range payloads {
+			if err := batchable(payload); err != nil {
+				results[i].Err = err
+				continue
+			}
+			results[i].Response, results[i].Err = s.SendEmail(ctx, payload, nil)
+		}
+		return results, nil
+	}
+
+	// Validate and prepare each email; the valid ones are sent in chunks.
+	var pending []int
+	prepared := make([]*types.EmailPayload, len(payloads))
+	for i, payload := range payloads {
+		if err := batchable(payload); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if payload.HTML == "" && payload.Text == "" {
+			results[i].Err = types.Permanent(errors.New("email has neither html nor text"))
+			continue
+		}
+		if err := validateTagsAndHeaders(payload); err != nil {
+			results[i].Err = types.Permanent(err)
+			continue
+		}
+		p := *payload
+		if p.Text == "" {
+			p.Text = PlainText(p.HTML)
+		}
+		prepared[i] = &p
+		pending = append(pending, i)
+	}
+
+	limit := batcher.BatchLimit()
+	for chunk := 0; chunk*limit < len(pending); chunk++ {
+		indexes := pending[chunk*limit : min((chunk+1)*limit, len(pending))]
+		chunkPayloads := make([]*types.EmailPayload, len(indexes))
+		for j, i := range indexes {
+			chunkPayloads[j] = prepared[i]
+		}
+		key := ""
+		if idempotencyKey != "" {
+			key = fmt.Sprintf("%s-chunk-%d", idempotencyKey, chunk)
+		}
+
+		responses, err := batcher.SendBatch(ctx, chunkPayloads, key)
+		if err == nil {
+			for j, i := range indexes {
+				results[i].Response = responses[j]
+			}
+			continue
+		}
+		err = fmt.Errorf("%s: %w", batcher.Name(), err)
+		switch {
+		case failoverable(err) && s.fallback != nil:
+			logger.Warn(ctx, "email batch failed; sending chunk through fallback", logger.Fields{
+				"provider": batcher.Name(),
+				"fallback": s.fallback.Name(),
+				"emails":   len(indexes),
+				"error":    err.Error(),
+			})
+			for j, i := range indexes {
+				results[i].Response, results[i].Err = s.send(ctx, s.fallback, chunkPayloads[j], nil)
+			}
+		case types.ErrorClass(err) == types.ErrPermanent:
+			for _, i := range indexes {
+				results[i].Err = err
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	sent := 0
+	for _, r := range results {
+		if r.Response != nil {
+			sent++
+		}
+	}
+	logger.Info(ctx, "email batch sent", logger.Fields{
+		"provider": batcher.Name(),
+		"emails":   len(payloads),
+		"sent":     sent,
+	})
+	return results, nil
+}
+
+// batchable rejects what batch sends do not support.
+func batchable(payload *types.EmailPayload) error {
+	if len(payload.Attachments) > 0 {
+		return types.Permanent(errors.New("batch emails cannot have attachments"))
+	}
+	if payload.SendAt != nil {
+		return types.Permanent(errors.New("batch emails cannot be scheduled (send_at)"))
+	}
+	return nil
+}
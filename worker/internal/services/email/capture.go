@@ -0,0 +1,153 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// captureFunction stores a captured email when no capture SMTP server is
+// configured.
+const captureFunction = "comms.record_captured_email"
+
+// CaptureStore runs the database function captured emails are stored
+// through; the worker's database client implements it.
+type CaptureStore interface {
+	RunFunction(ctx context.Context, functionName string, payload json.RawMessage) (*types.DBFunctionResult, error)
+}
+
+// CaptureProvider keeps emails from reaching anyone, for local and staging
+// environments (EMAIL_MODE=capture). With an SMTP address it delivers the
+// rendered message to a catch-all server such as Mailpit or MailHog;
+// otherwise it stores it in comms.captured_email.
+type CaptureProvider struct {
+	smtpAddr string
+	store    CaptureStore
+}
+
+type capturedEmail struct {
+	*types.EmailPayload
+	Attachments []capturedAttachment `json:"attachments,omitempty"`
+	MIME        string               `json:"mime"`
+}
+
+type capturedAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// NewCaptureProvider returns a CaptureProvider delivering to smtpAddr
+// (host:port), or storing through store when smtpAddr is empty.
+func NewCaptureProvider(smtpAddr string, store CaptureStore) *CaptureProvider {
+	return &CaptureProvider{smtpAddr: smtpAddr, store: store}
+}
+
+func (p *CaptureProvider) Name() string { return ProviderCapture }
+
+// Send renders payload as the MIME message SES would get and captures it.
+// Scheduled emails (send_at) are captured right away.
+func (p *CaptureProvider) Send(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
+	raw, err := buildMIME(payload, attachments, time.Now())
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+	if p.smtpAddr != "" {
+		if err := p.sendSMTP(ctx, payload, raw); err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, "email captured", logger.Fields{"message_id": payload.MessageID, "smtp_addr": p.smtpAddr})
+		return &EmailResponse{ID: fmt.Sprintf("captured-%d-%d", payload.MessageID, time.Now().UnixNano())}, nil
+	}
+
+	captured := capturedEmail{EmailPayload: payload, MIME: string(raw)}
+	for _, a := range attachments {
+		captured.Attachments = append(captured.Attachments, capturedAttachment{Filename: a.Filename, ContentType: a.ContentType, Size: len(a.Content)})
+	}
+	body, err := json.Marshal(captured)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal captured email: %w", err)
+	}
+	res, err := p.store.RunFunction(ctx, captureFunction, body)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to store captured email: %w", err))
+	}
+	if res.Status != "succeeded" {
+		return nil, types.Permanent(fmt.Errorf("failed to store captured email: %s", res.Status))
+	}
+	var stored struct {
+		CapturedEmailID int64 `json:"captured_email_id"`
+	}
+	if err := json.Unmarshal(res.Payload, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode captured email result: %w", err)
+	}
+	logger.Info(ctx, "email captured", logger.Fields{"message_id": payload.MessageID, "captured_email_id": stored.CapturedEmailID})
+	return &EmailResponse{ID: fmt.Sprintf("captured-%d", stored.CapturedEmailID)}, nil
+}
+
+// sendSMTP delivers raw to every recipient, bcc included, over plain SMTP
+// without authentication, as catch-all development servers expect.
+func (p *CaptureProvider) sendSMTP(ctx context.Context, payload *types.EmailPayload, raw []byte) error {
+	from, err := bareAddress(payload.FromAddress)
+	if err != nil {
+		return types.Permanent(fmt.Errorf("invalid from_address: %w", err))
+	}
+	var recipients []string
+	for _, address := range append(append([]string{payload.ToAddress}, payload.CC...), payload.BCC...) {
+		recipient, err := bareAddress(address)
+		if err != nil {
+			return types.Permanent(fmt.Errorf("invalid recipient %q: %w", address, err))
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "tcp", p.smtpAddr)
+	if err != nil {
+		return types.Retryable(fmt.Errorf("failed to connect to capture smtp server: %w", err))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	host, _, _ := net.SplitHostPort(p.smtpAddr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return types.Retryable(fmt.Errorf("failed to start smtp session: %w", err))
+	}
+	defer client.Close()
+
+	if err := client.Mail(from); err != nil {
+		return types.Retryable(fmt.Errorf("smtp MAIL FROM failed: %w", err))
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return types.Retryable(fmt.Errorf("smtp RCPT TO %s failed: %w", recipient, err))
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return types.Retryable(fmt.Errorf("smtp DATA failed: %w", err))
+	}
+	if _, err := w.Write(raw); err != nil {
+		return types.Retryable(fmt.Errorf("failed to write message: %w", err))
+	}
+	if err := w.Close(); err != nil {
+		return types.Retryable(fmt.Errorf("smtp DATA failed: %w", err))
+	}
+	if err := client.Quit(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Warn(ctx, "smtp QUIT failed", logger.Fields{"error": err.Error()})
+	}
+	return nil
+}
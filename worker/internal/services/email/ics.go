@@ -0,0 +1,152 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Calendar invite methods (RFC 5546): REQUEST adds or updates the event in
+// the recipient's calendar, CANCEL removes it.
+const (
+	CalendarMethodRequest = "REQUEST"
+	CalendarMethodCancel  = "CANCEL"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// CalendarInvite renders invite's event as an RFC 5545 iCalendar object and
+// returns it as the invite.ics attachment of invite's email, marked to be
+// sent as a body alternative too so Gmail and Outlook show it as an invite.
+// The organizer defaults to the sender and the attendees to the recipient.
+func CalendarInvite(invite *types.CalendarInvitePayload, now time.Time) (Attachment, error) {
+	event := invite.Event
+	method := strings.ToUpper(event.Method)
+	if method == "" {
+		method = CalendarMethodRequest
+	}
+	if method != CalendarMethodRequest && method != CalendarMethodCancel {
+		return Attachment{}, fmt.Errorf("unsupported calendar method %q", event.Method)
+	}
+	if event.UID == "" {
+		return Attachment{}, errors.New("calendar event has no uid")
+	}
+	if event.Summary == "" {
+		return Attachment{}, errors.New("calendar event has no summary")
+	}
+	if event.Start.IsZero() || !event.End.After(event.Start) {
+		return Attachment{}, errors.New("calendar event end must be after its start")
+	}
+
+	organizer := types.CalendarAttendee{Email: invite.FromAddress}
+	if event.Organizer != nil {
+		organizer = *event.Organizer
+	}
+	organizerLine, err := icsAddressLine("ORGANIZER", organizer, "")
+	if err != nil {
+		return Attachment{}, fmt.Errorf("invalid organizer: %w", err)
+	}
+	attendees := event.Attendees
+	if len(attendees) == 0 {
+		attendees = []types.CalendarAttendee{{Email: invite.ToAddress}}
+	}
+
+	var w icsWriter
+	w.line("BEGIN:VCALENDAR")
+	w.line("PRODID:-//Chatterbox//Worker//EN")
+	w.line("VERSION:2.0")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:" + method)
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + icsText(event.UID))
+	w.line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+	w.line("DTSTAMP:" + now.UTC().Format(icsTimeFormat))
+	w.line("DTSTART:" + event.Start.UTC().Format(icsTimeFormat))
+	w.line("DTEND:" + event.End.UTC().Format(icsTimeFormat))
+	w.line("SUMMARY:" + icsText(event.Summary))
+	if event.Description != "" {
+		w.line("DESCRIPTION:" + icsText(event.Description))
+	}
+	if event.Location != "" {
+		w.line("LOCATION:" + icsText(event.Location))
+	}
+	if event.URL != "" {
+		w.line("URL:" + event.URL)
+	}
+	w.line(organizerLine)
+	for _, attendee := range attendees {
+		line, err := icsAddressLine("ATTENDEE", attendee, ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE")
+		if err != nil {
+			return Attachment{}, fmt.Errorf("invalid attendee: %w", err)
+		}
+		w.line(line)
+	}
+	if method == CalendarMethodCancel {
+		w.line("STATUS:CANCELLED")
+	} else {
+		w.line("STATUS:CONFIRMED")
+	}
+	w.line("END:VEVENT")
+	w.line("END:VCALENDAR")
+
+	return Attachment{
+		Filename:    "invite.ics",
+		ContentType: "text/calendar; charset=utf-8; method=" + method,
+		Content:     w.buf.Bytes(),
+		Alternative: true,
+	}, nil
+}
+
+// icsAddressLine renders an ORGANIZER or ATTENDEE property for person, with
+// its name as CN and any extra parameters.
+func icsAddressLine(property string, person types.CalendarAttendee, params string) (string, error) {
+	address, err := bareAddress(person.Email)
+	if err != nil {
+		return "", err
+	}
+	if person.Name != "" {
+		params = ";CN=" + icsParam(person.Name) + params
+	}
+	return property + params + ":mailto:" + address, nil
+}
+
+// icsText escapes a TEXT value (RFC 5545 section 3.3.11).
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+// icsParam formats a parameter value, which cannot contain double quotes
+// and is quoted when it contains a colon, semicolon or comma.
+func icsParam(s string) string {
+	s = strings.NewReplacer(`"`, "", "\r", "", "\n", " ").Replace(s)
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// icsWriter writes content lines ending in CRLF, folded to 75 octets with
+// continuation lines starting with a space, never inside a UTF-8 sequence.
+type icsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *icsWriter) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// The leading space counts toward the next line's 75 octets.
+		limit = 74
+	}
+	w.buf.WriteString(s + "\r\n")
+}
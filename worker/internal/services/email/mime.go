@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// buildMIME renders payload as a raw RFC 5322 message for providers that
+// take one (SES): a multipart/alternative text and HTML body, wrapped in
+// multipart/mixed when there are attachments. Alternative attachments (a
+// calendar invite) are also added to the multipart/alternative body. Bcc
+// recipients are left out of the headers; the provider gets them separately.
+func buildMIME(payload *types.EmailPayload, attachments []Attachment, now time.Time) ([]byte, error) {
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+	}
+
+	from, err := formatAddress(payload.FromAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from_address: %w", err)
+	}
+	to, err := formatAddress(payload.ToAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to_address: %w", err)
+	}
+	header("From", from)
+	header("To", to)
+	if len(payload.CC) > 0 {
+		cc := make([]string, len(payload.CC))
+		for i, address := range payload.CC {
+			if cc[i], err = formatAddress(address); err != nil {
+				return nil, fmt.Errorf("invalid cc address: %w", err)
+			}
+		}
+		header("Cc", strings.Join(cc, ", "))
+	}
+	if payload.ReplyTo != "" {
+		replyTo, err := formatAddress(payload.ReplyTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reply_to: %w", err)
+		}
+		header("Reply-To", replyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", payload.Subject))
+	for _, name := range sortedKeys(payload.Headers) {
+		header(name, mime.QEncoding.Encode("utf-8", payload.Headers[name]))
+	}
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	alternative, err := alternativePart(payload, attachments)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		header("Content-Type", alternative.contentType)
+		msg.WriteString("\r\n")
+		msg.Write(alternative.body)
+		return msg.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	mixed := multipart.NewWriter(&body)
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	msg.WriteString("\r\n")
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {alternative.contentType}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(alternative.body)
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		// The attached copy of an invite already in the body is sent as
+		// application/ics, so clients do not show the invite twice.
+		if a.Alternative {
+			contentType = "application/ics"
+		}
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, a.Content)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+type mimePart struct {
+	contentType string
+	body        []byte
+}
+
+// alternativePart returns the text and HTML bodies, and any alternative
+// attachments, that are set as a multipart/alternative part, plain text
+// first as RFC 2046 asks.
+func alternativePart(payload *types.EmailPayload, attachments []Attachment) (mimePart, error) {
+	var bodies []mimePart
+	if payload.Text != "" {
+		bodies = append(bodies, mimePart{contentType: "text/plain; charset=utf-8", body: []byte(payload.Text)})
+	}
+	if payload.HTML != "" {
+		bodies = append(bodies, mimePart{contentType: "text/html; charset=utf-8", body: []byte(payload.HTML)})
+	}
+
+	var buf bytes.Buffer
+	alternative := multipart.NewWriter(&buf)
+	for _, b := range bodies {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {b.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return mimePart{}, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		qp.Write(b.body)
+		qp.Close()
+	}
+	for _, a := range attachments {
+		if !a.Alternative {
+			continue
+		}
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return mimePart{}, err
+		}
+		writeBase64Lines(part, a.Content)
+	}
+	if err := alternative.Close(); err != nil {
+		return mimePart{}, err
+	}
+	return mimePart{contentType: "multipart/alternative; boundary=" + alternative.Boundary(), body: buf.Bytes()}, nil
+}
+
+// formatAddress parses an address ("a@example.com" or "Name <a@...>") and
+// formats it with the display name encoded for a header.
+func formatAddress(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return parsed.String(), nil
+}
+
+// writeBase64Lines writes data base64 encoded in 76-character lines.
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
@@ -0,0 +1,207 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ResendProvider sends email through the Resend API.
+type ResendProvider struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+type ResendRequest struct {
+	From        string             `json:"from"`
+	To          []string           `json:"to"`
+	Subject     string             `json:"subject"`
+	HTML        string             `json:"html,omitempty"`
+	Text        string             `json:"text,omitempty"`
+	Cc          []string           `json:"cc,omitempty"`
+	Bcc         []string           `json:"bcc,omitempty"`
+	ReplyTo     string             `json:"reply_to,omitempty"`
+	ScheduledAt string             `json:"scheduled_at,omitempty"`
+	Attachments []ResendAttachment `json:"attachments,omitempty"`
+	Headers     map[string]string  `json:"headers,omitempty"`
+	Tags        []ResendTag        `json:"tags,omitempty"`
+}
+
+type ResendTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ResendAttachment is an attachment sent inline; Content is marshaled as
+// base64.
+type ResendAttachment struct {
+	Filename    string `json:"filename"`
+	Content     []byte `json:"content"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type ResendResponse struct {
+	ID      string `json:"id"`
+	Error   string `json:"error,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// resendConcurrentIdempotentRequests is the 409 Resend answers while a
+// request with the same idempotency key is still in progress.
+const resendConcurrentIdempotentRequests = "concurrent_idempotent_requests"
+
+// resendBatchLimit is the most emails Resend's batch endpoint takes per call.
+const resendBatchLimit = 100
+
+// NewResendProvider returns a Resend client whose calls are throttled by
+// limiter and refused while circuit is open.
+func NewResendProvider(apiKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *ResendProvider {
+	return &ResendProvider{
+		apiKey: apiKey,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *ResendProvider) Name() string { return ProviderResend }
+
+// Send sends payload through Resend, with attachments sent inline. The
+// payload's IdempotencyKey is sent as Resend's Idempotency-Key, so a repeated
+// send within 24 hours returns the first email instead of sending another.
+func (p *ResendProvider) Send(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("RESEND_API_KEY is required"))
+	}
+
+	var resendResp ResendResponse
+	if err := p.post(ctx, "https://api.resend.com/emails", newResendRequest(payload, attachments), payload.IdempotencyKey, &resendResp); err != nil {
+		return nil, err
+	}
+	return &EmailResponse{ID: resendResp.ID}, nil
+}
+
+// SendBatch sends up to resendBatchLimit emails in one call to Resend's
+// batch endpoint, which takes neither attachments nor scheduled sends. The
+// batch is accepted or refused as a whole; responses are in payloads' order.
+func (p *ResendProvider) SendBatch(ctx context.Context, payloads []*types.EmailPayload, idempotencyKey string) ([]*EmailResponse, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("RESEND_API_KEY is required"))
+	}
+	if len(payloads) > resendBatchLimit {
+		return nil, types.Permanent(fmt.Errorf("resend batches take at most %d emails, got %d", resendBatchLimit, len(payloads)))
+	}
+
+	batch := make([]ResendRequest, len(payloads))
+	for i, payload := range payloads {
+		batch[i] = newResendRequest(payload, nil)
+	}
+	var batchResp struct {
+		Data []ResendResponse `json:"data"`
+	}
+	if err := p.post(ctx, "https://api.resend.com/emails/batch", batch, idempotencyKey, &batchResp); err != nil {
+		return nil, err
+	}
+	if len(batchResp.Data) != len(payloads) {
+		return nil, fmt.Errorf("resend batch returned %d ids for %d emails", len(batchResp.Data), len(payloads))
+	}
+	responses := make([]*EmailResponse, len(payloads))
+	for i, r := range batchResp.Data {
+		responses[i] = &EmailResponse{Provider: ProviderResend, ID: r.ID}
+	}
+	return responses, nil
+}
+
+func (p *ResendProvider) BatchLimit() int { return resendBatchLimit }
+
+func newResendRequest(payload *types.EmailPayload, attachments []Attachment) ResendRequest {
+	resendReq := ResendRequest{
+		From:    payload.FromAddress,
+		To:      []string{payload.ToAddress},
+		Subject: payload.Subject,
+		HTML:    payload.HTML,
+		Text:    payload.Text,
+		Cc:      payload.CC,
+		Bcc:     payload.BCC,
+		ReplyTo: payload.ReplyTo,
+		Headers: payload.Headers,
+	}
+	for _, name := range sortedKeys(payload.Tags) {
+		resendReq.Tags = append(resendReq.Tags, ResendTag{Name: name, Value: payload.Tags[name]})
+	}
+	if sendAt := scheduledSendAt(payload); !sendAt.IsZero() {
+		resendReq.ScheduledAt = sendAt.UTC().Format(time.RFC3339)
+	}
+	for _, a := range attachments {
+		resendReq.Attachments = append(resendReq.Attachments, ResendAttachment{
+			Filename:    a.Filename,
+			Content:     a.Content,
+			ContentType: a.ContentType,
+		})
+	}
+	return resendReq
+}
+
+// post sends body as JSON to url, with idempotencyKey as the
+// Idempotency-Key when set, and decodes a successful response into out.
+func (p *ResendProvider) post(ctx context.Context, url string, body any, idempotencyKey string, out any) error {
+	// Marshal request body
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resend request: %w", err)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	// Send request
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	// Check for API errors (error responses may not be JSON)
+	if resp.StatusCode >= 400 {
+		var resendResp ResendResponse
+		_ = json.NewDecoder(resp.Body).Decode(&resendResp)
+		errMsg := fmt.Sprintf("resend API error (status %d)", resp.StatusCode)
+		if resendResp.Name != "" {
+			errMsg += " " + resendResp.Name
+		}
+		if resendResp.Error != "" {
+			errMsg += ": " + resendResp.Error
+		} else if resendResp.Message != "" {
+			errMsg += ": " + resendResp.Message
+		}
+		if resendResp.Name == resendConcurrentIdempotentRequests {
+			return types.Retryable(errors.New(errMsg))
+		}
+		return types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
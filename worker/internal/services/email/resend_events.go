@@ -0,0 +1,117 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resendWebhookTolerance is how far a webhook's svix-timestamp may be from
+// now before the request is refused as a replay.
+const resendWebhookTolerance = 5 * time.Minute
+
+// DeliveryEvent is a delivery report for a sent email, as passed to
+// comms.record_email_delivery_event. MessageID is the provider's email id
+// the success handler stored; EventID identifies the webhook delivery, so a
+// redelivered event is recorded once.
+type DeliveryEvent struct {
+	Provider     string `json:"provider"`
+	EventID      string `json:"event_id"`
+	MessageID    string `json:"message_id"`
+	Event        string `json:"event"`
+	EmailAddress string `json:"email_address,omitempty"`
+	BounceType   string `json:"bounce_type,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+// resendEvents maps the Resend webhook event types recorded to their
+// DeliveryEvent.Event; the others (sent, opened, clicked, ...) are not.
+var resendEvents = map[string]string{
+	"email.delivered":  "delivered",
+	"email.bounced":    "bounced",
+	"email.complained": "complained",
+}
+
+type resendWebhookEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		EmailID string   `json:"email_id"`
+		To      []string `json:"to"`
+		Bounce  struct {
+			Type    string `json:"type"`
+			SubType string `json:"subType"`
+			Message string `json:"message"`
+		} `json:"bounce"`
+	} `json:"data"`
+}
+
+// ValidResendSignature reports whether header carries a valid Svix
+// signature of body for the webhook signing secret ("whsec_..."): the base64
+// HMAC-SHA256 of "<svix-id>.<svix-timestamp>.<body>" keyed with the decoded
+// secret, among the space-separated "v1,<signature>" entries of
+// svix-signature, with a timestamp within five minutes of now.
+func ValidResendSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	id := header.Get("svix-id")
+	timestamp := header.Get("svix-timestamp")
+	signatures := header.Get("svix-signature")
+	if secret == "" || id == "" || timestamp == "" || signatures == "" {
+		return false
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(secs, 0)); skew > resendWebhookTolerance || skew < -resendWebhookTolerance {
+		return false
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	for _, entry := range strings.Fields(signatures) {
+		version, signature, ok := strings.Cut(entry, ",")
+		if ok && version == "v1" && hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResendDeliveryEvent maps a Resend webhook body, delivered as eventID (its
+// svix-id), to a DeliveryEvent. ok is false for event types that are not
+// recorded.
+func ResendDeliveryEvent(eventID string, body []byte) (event DeliveryEvent, ok bool, err error) {
+	var webhook resendWebhookEvent
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return DeliveryEvent{}, false, err
+	}
+	name, recorded := resendEvents[webhook.Type]
+	if !recorded || webhook.Data.EmailID == "" {
+		return DeliveryEvent{}, false, nil
+	}
+	event = DeliveryEvent{
+		Provider:   ProviderResend,
+		EventID:    eventID,
+		MessageID:  webhook.Data.EmailID,
+		Event:      name,
+		BounceType: strings.ToLower(webhook.Data.Bounce.Type),
+		Detail:     webhook.Data.Bounce.Message,
+	}
+	if len(webhook.Data.To) > 0 {
+		event.EmailAddress = strings.ToLower(webhook.Data.To[0])
+	}
+	if event.Detail == "" {
+		event.Detail = webhook.Data.Bounce.SubType
+	}
+	return event, true, nil
+}
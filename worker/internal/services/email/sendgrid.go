@@ -0,0 +1,203 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridProvider sends email through SendGrid's v3 Mail Send API.
+type SendGridProvider struct {
+	apiKey     string
+	httpClient *http.Client
+}
+
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	SendAt           int64                     `json:"send_at,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+	CustomArgs       map[string]string         `json:"custom_args,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Cc  []sendGridAddress `json:"cc,omitempty"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sendGridAttachment's Content is marshaled as base64.
+type sendGridAttachment struct {
+	Content     []byte `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition"`
+}
+
+type sendGridErrorResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+	} `json:"errors"`
+}
+
+// NewSendGridProvider returns a SendGrid client throttled by limiter and
+// refused while circuit is open.
+func NewSendGridProvider(apiKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *SendGridProvider {
+	return &SendGridProvider{
+		apiKey: apiKey,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *SendGridProvider) Name() string { return ProviderSendGrid }
+
+// Send sends payload through SendGrid. SendGrid answers 202 without a body;
+// the message id comes from its X-Message-Id header.
+func (p *SendGridProvider) Send(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("SENDGRID_API_KEY is required"))
+	}
+	sgReq, err := buildSendGridRequest(payload, attachments)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+
+	reqBody, err := json.Marshal(sgReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sendgrid request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp sendGridErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		errMsg := fmt.Sprintf("sendgrid API error (status %d)", resp.StatusCode)
+		var messages []string
+		for _, e := range errResp.Errors {
+			if e.Field != "" {
+				messages = append(messages, e.Field+": "+e.Message)
+			} else {
+				messages = append(messages, e.Message)
+			}
+		}
+		if len(messages) > 0 {
+			errMsg += ": " + strings.Join(messages, "; ")
+		}
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+
+	return &EmailResponse{ID: resp.Header.Get("X-Message-Id")}, nil
+}
+
+func buildSendGridRequest(payload *types.EmailPayload, attachments []Attachment) (sendGridRequest, error) {
+	from, err := sendGridAddressOf(payload.FromAddress)
+	if err != nil {
+		return sendGridRequest{}, fmt.Errorf("invalid from_address: %w", err)
+	}
+	to, err := sendGridAddressOf(payload.ToAddress)
+	if err != nil {
+		return sendGridRequest{}, fmt.Errorf("invalid to_address: %w", err)
+	}
+	personalization := sendGridPersonalization{To: []sendGridAddress{to}}
+	for _, address := range payload.CC {
+		cc, err := sendGridAddressOf(address)
+		if err != nil {
+			return sendGridRequest{}, fmt.Errorf("invalid cc address: %w", err)
+		}
+		personalization.Cc = append(personalization.Cc, cc)
+	}
+	for _, address := range payload.BCC {
+		bcc, err := sendGridAddressOf(address)
+		if err != nil {
+			return sendGridRequest{}, fmt.Errorf("invalid bcc address: %w", err)
+		}
+		personalization.Bcc = append(personalization.Bcc, bcc)
+	}
+
+	sgReq := sendGridRequest{
+		Personalizations: []sendGridPersonalization{personalization},
+		From:             from,
+		Subject:          payload.Subject,
+		Headers:          payload.Headers,
+		// SendGrid's custom_args are its key/value labels, reported back in
+		// its event webhook like Resend's tags.
+		CustomArgs: payload.Tags,
+	}
+	if payload.ReplyTo != "" {
+		replyTo, err := sendGridAddressOf(payload.ReplyTo)
+		if err != nil {
+			return sendGridRequest{}, fmt.Errorf("invalid reply_to: %w", err)
+		}
+		sgReq.ReplyTo = &replyTo
+	}
+	// SendGrid requires text/plain before text/html.
+	if payload.Text != "" {
+		sgReq.Content = append(sgReq.Content, sendGridContent{Type: "text/plain", Value: payload.Text})
+	}
+	if payload.HTML != "" {
+		sgReq.Content = append(sgReq.Content, sendGridContent{Type: "text/html", Value: payload.HTML})
+	}
+	if sendAt := scheduledSendAt(payload); !sendAt.IsZero() {
+		sgReq.SendAt = sendAt.Unix()
+	}
+	for _, a := range attachments {
+		sgReq.Attachments = append(sgReq.Attachments, sendGridAttachment{
+			Content:     a.Content,
+			Filename:    a.Filename,
+			Type:        a.ContentType,
+			Disposition: "attachment",
+		})
+	}
+	return sgReq, nil
+}
+
+func sendGridAddressOf(address string) (sendGridAddress, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return sendGridAddress{}, err
+	}
+	return sendGridAddress{Email: parsed.Address, Name: parsed.Name}, nil
+}
@@ -1,105 +1,234 @@
 package email
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"golang.org/x/net/http/httpguts"
 )
 
-type Service struct {
-	apiKey     string
-	httpClient *http.Client
+// Provider names, as configured in WORKER_EMAIL_PROVIDER and
+// WORKER_EMAIL_FALLBACK_PROVIDER, chosen per message with
+// EmailPayload.Provider, and reported in EmailResponse.Provider.
+const (
+	ProviderResend   = "resend"
+	ProviderSES      = "ses"
+	ProviderSendGrid = "sendgrid"
+	ProviderCapture  = "capture"
+)
+
+// EmailProvider delivers one email. Implementations classify their errors
+// with the types error classes, which decide whether the fallback is tried.
+type EmailProvider interface {
+	Name() string
+	Send(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error)
+}
+
+// EmailResponse is what the success handler receives: the provider that
+// sent the email and its message id there.
+type EmailResponse struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
 }
 
-type ResendRequest struct {
-	From    string   `json:"from"`
-	To      []string `json:"to"`
-	Subject string   `json:"subject"`
-	HTML    string   `json:"html"`
+// Attachment is a downloaded attachment to send with an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	// Alternative also sends the attachment as an alternative to the text
+	// and HTML bodies where the provider takes a raw message, as mail
+	// clients expect of a text/calendar invite.
+	Alternative bool
 }
 
-type ResendResponse struct {
-	ID    string `json:"id"`
-	Error string `json:"error,omitempty"`
+// Service sends email through a primary provider, failing over to an
+// optional fallback.
+type Service struct {
+	primary  EmailProvider
+	fallback EmailProvider
+	byName   map[string]EmailProvider
+	// capture sends every email through primary, whatever provider it
+	// names (see NewCaptureService).
+	capture bool
 }
 
-func NewService(apiKey string) *Service {
-	return &Service{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// NewService returns a Service sending through primary, and through
+// fallback (which may be nil) when the provider fails with a retryable,
+// rate-limited or unavailable error. Messages may name any of primary,
+// fallback and selectable as their provider instead of primary.
+func NewService(primary, fallback EmailProvider, selectable ...EmailProvider) *Service {
+	byName := make(map[string]EmailProvider)
+	for _, p := range append([]EmailProvider{primary, fallback}, selectable...) {
+		if p != nil {
+			if _, ok := byName[p.Name()]; !ok {
+				byName[p.Name()] = p
+			}
+		}
 	}
+	return &Service{primary: primary, fallback: fallback, byName: byName}
 }
 
-// SendEmail sends an email using the Resend API
-func (s *Service) SendEmail(ctx context.Context, payload *types.EmailPayload) (*ResendResponse, error) {
+// NewCaptureService returns a Service sending every email through capture,
+// including those that name a provider, so that no email reaches a real
+// recipient.
+func NewCaptureService(capture EmailProvider) *Service {
+	return &Service{primary: capture, byName: map[string]EmailProvider{}, capture: true}
+}
+
+// SendEmail sends payload with attachments (already downloaded) through the
+// provider payload names, or the primary, failing over to the fallback
+// provider when the failure is transient. A permanent failure (e.g. a
+// rejected address) is returned as is, as the fallback would reject it too.
+func (s *Service) SendEmail(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
 	if payload == nil {
 		return nil, fmt.Errorf("email payload is nil")
 	}
+	provider := s.primary
+	if payload.Provider != "" && !s.capture {
+		var ok bool
+		if provider, ok = s.byName[payload.Provider]; !ok {
+			return nil, types.Permanent(fmt.Errorf("unknown email provider %q", payload.Provider))
+		}
+	}
+	if payload.HTML == "" && payload.Text == "" {
+		return nil, types.Permanent(errors.New("email has neither html nor text"))
+	}
+	if err := validateTagsAndHeaders(payload); err != nil {
+		return nil, types.Permanent(err)
+	}
 
 	logger.Info(ctx, "sending email", logger.Fields{
 		"message_id":   payload.MessageID,
 		"to_address":   payload.ToAddress,
 		"from_address": payload.FromAddress,
 		"subject":      payload.Subject,
+		"cc":           len(payload.CC),
+		"bcc":          len(payload.BCC),
+		"attachments":  len(attachments),
+		"provider":     provider.Name(),
+		"send_at":      payload.SendAt,
+		"tags":         payload.Tags,
 	})
 
-	// Build Resend request
-	resendReq := ResendRequest{
-		From:    payload.FromAddress,
-		To:      []string{payload.ToAddress},
-		Subject: payload.Subject,
-		HTML:    payload.HTML,
+	if payload.Text == "" || payload.IdempotencyKey == "" {
+		prepared := *payload
+		if prepared.Text == "" {
+			prepared.Text = PlainText(payload.HTML)
+		}
+		if prepared.IdempotencyKey == "" {
+			prepared.IdempotencyKey = idempotencyKey(payload)
+		}
+		payload = &prepared
 	}
 
-	// Marshal request body
-	reqBody, err := json.Marshal(resendReq)
+	resp, err := s.send(ctx, provider, payload, attachments)
+	if err != nil && s.fallback != nil && s.fallback != provider && failoverable(err) {
+		logger.Warn(ctx, "email provider failed; trying fallback", logger.Fields{
+			"message_id": payload.MessageID,
+			"provider":   provider.Name(),
+			"fallback":   s.fallback.Name(),
+			"error":      err.Error(),
+		})
+		resp, err = s.send(ctx, s.fallback, payload, attachments)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal resend request: %w", err)
+		return nil, err
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.resend.com/emails", bytes.NewReader(reqBody))
+	logger.Info(ctx, "email sent successfully", logger.Fields{
+		"message_id":          payload.MessageID,
+		"provider":            resp.Provider,
+		"provider_message_id": resp.ID,
+	})
+
+	return resp, nil
+}
+
+func (s *Service) send(ctx context.Context, provider EmailProvider, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
+	resp, err := provider.Send(ctx, payload, attachments)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, fmt.Errorf("%s: %w", provider.Name(), err)
 	}
+	resp.Provider = provider.Name()
+	return resp, nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+// reservedHeaders are set from the payload's own fields and cannot be
+// given as extra headers.
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+	"Date": true, "Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+}
 
-	// Send request
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// validateTagsAndHeaders rejects tags providers would refuse and headers
+// that are malformed, would replace the message's own, or could inject
+// further headers.
+func validateTagsAndHeaders(payload *types.EmailPayload) error {
+	for name, value := range payload.Tags {
+		if !tagPattern.MatchString(name) || !tagPattern.MatchString(value) {
+			return fmt.Errorf("invalid tag %q=%q: names and values must be 1-256 ASCII letters, digits, _ or -", name, value)
+		}
+	}
+	for name, value := range payload.Headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return fmt.Errorf("header %s is set from the email's fields", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid header %s: value contains a line break", name)
+		}
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	// Parse response
-	var resendResp ResendResponse
-	if err := json.NewDecoder(resp.Body).Decode(&resendResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// sortedKeys returns m's keys in order, so tags and headers are sent in a
+// stable order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Check for API errors
-	if resp.StatusCode >= 400 {
-		errMsg := fmt.Sprintf("resend API error (status %d)", resp.StatusCode)
-		if resendResp.Error != "" {
-			errMsg += ": " + resendResp.Error
-		}
-		return nil, fmt.Errorf(errMsg)
+// scheduledSendAt returns the payload's SendAt when it is in the future, or
+// the zero time for an email to send now.
+func scheduledSendAt(payload *types.EmailPayload) time.Time {
+	if payload.SendAt == nil || !payload.SendAt.After(time.Now()) {
+		return time.Time{}
 	}
+	return *payload.SendAt
+}
 
-	logger.Info(ctx, "email sent successfully", logger.Fields{
-		"message_id": payload.MessageID,
-		"resend_id":  resendResp.ID,
-	})
+// idempotencyKey derives the key providers deduplicate sends by from the
+// message and its comms attempt. Worker retries of one attempt share it,
+// while the supervisor's next attempt after a recorded failure gets a new
+// one. It is empty when the before_handler returned neither.
+func idempotencyKey(payload *types.EmailPayload) string {
+	if payload.MessageID == 0 || payload.SendEmailAttemptID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("email-%d-attempt-%d", payload.MessageID, payload.SendEmailAttemptID)
+}
 
-	return &resendResp, nil
+func failoverable(err error) bool {
+	switch types.ErrorClass(err) {
+	case types.ErrRetryable, types.ErrRateLimited, types.ErrUnavailable:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,156 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// SESConfig holds the AWS credentials and region emails are sent with.
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// SESProvider sends email through the Amazon SES v2 API as raw MIME
+// messages, which carry attachments and cc in the message itself.
+type SESProvider struct {
+	ses        SESConfig
+	httpClient *http.Client
+}
+
+type sesRequest struct {
+	FromEmailAddress string         `json:"FromEmailAddress"`
+	Destination      sesDestination `json:"Destination"`
+	ReplyToAddresses []string       `json:"ReplyToAddresses,omitempty"`
+	EmailTags        []sesTag       `json:"EmailTags,omitempty"`
+	Content          struct {
+		Raw struct {
+			Data []byte `json:"Data"`
+		} `json:"Raw"`
+	} `json:"Content"`
+}
+
+type sesTag struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type sesDestination struct {
+	ToAddresses  []string `json:"ToAddresses"`
+	CcAddresses  []string `json:"CcAddresses,omitempty"`
+	BccAddresses []string `json:"BccAddresses,omitempty"`
+}
+
+type sesResponse struct {
+	MessageID string `json:"MessageId"`
+	Message   string `json:"message"`
+}
+
+// NewSESProvider returns an SES client throttled by limiter and refused
+// while circuit is open.
+func NewSESProvider(ses SESConfig, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *SESProvider {
+	return &SESProvider{
+		ses: ses,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *SESProvider) Name() string { return ProviderSES }
+
+// Send sends payload through SES's SendEmail.
+func (p *SESProvider) Send(ctx context.Context, payload *types.EmailPayload, attachments []Attachment) (*EmailResponse, error) {
+	if p.ses.Region == "" || p.ses.AccessKeyID == "" || p.ses.SecretAccessKey == "" {
+		return nil, types.Permanent(errors.New("SES_REGION, SES_ACCESS_KEY_ID and SES_SECRET_ACCESS_KEY are required"))
+	}
+
+	if !scheduledSendAt(payload).IsZero() {
+		return nil, types.Permanent(errors.New("ses does not support scheduled sends (send_at)"))
+	}
+
+	now := time.Now()
+	raw, err := buildMIME(payload, attachments, now)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+	// SES wants bare addresses in the envelope; the display names are in
+	// the message headers.
+	var sesReq sesRequest
+	if sesReq.FromEmailAddress, err = bareAddress(payload.FromAddress); err != nil {
+		return nil, types.Permanent(fmt.Errorf("invalid from_address: %w", err))
+	}
+	to, err := bareAddress(payload.ToAddress)
+	if err != nil {
+		return nil, types.Permanent(fmt.Errorf("invalid to_address: %w", err))
+	}
+	sesReq.Destination.ToAddresses = []string{to}
+	sesReq.Destination.CcAddresses = payload.CC
+	sesReq.Destination.BccAddresses = payload.BCC
+	if payload.ReplyTo != "" {
+		sesReq.ReplyToAddresses = []string{payload.ReplyTo}
+	}
+	for _, name := range sortedKeys(payload.Tags) {
+		sesReq.EmailTags = append(sesReq.EmailTags, sesTag{Name: name, Value: payload.Tags[name]})
+	}
+	sesReq.Content.Raw.Data = raw
+
+	reqBody, err := json.Marshal(sesReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ses request: %w", err)
+	}
+	endpoint := "https://email." + p.ses.Region + ".amazonaws.com/v2/email/outbound-emails"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, reqBody, p.ses.AccessKeyID, p.ses.SecretAccessKey, p.ses.Region, "ses", now)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	var sesResp sesResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&sesResp)
+
+	if resp.StatusCode >= 400 {
+		errMsg := fmt.Sprintf("ses API error (status %d)", resp.StatusCode)
+		if errType := resp.Header.Get("X-Amzn-Errortype"); errType != "" {
+			errMsg += " " + errType
+		}
+		if sesResp.Message != "" {
+			errMsg += ": " + sesResp.Message
+		}
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
+	}
+
+	return &EmailResponse{ID: sesResp.MessageID}, nil
+}
+
+func bareAddress(address string) (string, error) {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
@@ -0,0 +1,198 @@
+package email
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockElements start and end a paragraph in the plain text.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"main": true, "nav": true, "ol": true, "p": true, "section": true,
+	"table": true, "tr": true, "ul": true,
+}
+
+// skippedElements have no readable content.
+var skippedElements = map[string]bool{"head": true, "script": true, "style": true, "template": true}
+
+// PlainText renders an HTML email body as plain text for the text/plain
+// alternative: block elements become paragraphs, list items get a "- "
+// prefix, links are followed by their URL, and images by their alt text.
+func PlainText(body string) string {
+	t := &textWriter{}
+	z := html.NewTokenizer(strings.NewReader(body))
+	skipping := 0
+	var links []string
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return t.String()
+		}
+		tok := z.Token()
+		name := tok.Data
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if skippedElements[name] {
+				if tt == html.StartTagToken {
+					skipping++
+				}
+				continue
+			}
+			if skipping > 0 {
+				continue
+			}
+			switch {
+			case blockElements[name]:
+				t.breakLines(2)
+			case name == "br":
+				t.breakLines(1)
+			case name == "li":
+				t.breakLines(1)
+				t.write("- ")
+			case name == "hr":
+				t.breakLines(2)
+				t.write("---")
+				t.breakLines(2)
+			case name == "td" || name == "th":
+				t.space()
+			case name == "img":
+				if alt := strings.TrimSpace(attr(tok, "alt")); alt != "" {
+					t.text(alt)
+				}
+			case name == "a" && tt == html.StartTagToken:
+				links = append(links, linkTarget(attr(tok, "href")))
+				t.markLink()
+			}
+		case html.EndTagToken:
+			if skippedElements[name] {
+				if skipping > 0 {
+					skipping--
+				}
+				continue
+			}
+			if skipping > 0 {
+				continue
+			}
+			switch {
+			case blockElements[name]:
+				t.breakLines(2)
+			case name == "a" && len(links) > 0:
+				href := links[len(links)-1]
+				links = links[:len(links)-1]
+				if href != "" && href != t.linkText() {
+					t.write(" (" + href + ")")
+				}
+			}
+		case html.TextToken:
+			if skipping == 0 {
+				t.text(tok.Data)
+			}
+		}
+	}
+	return t.String()
+}
+
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// linkTarget returns the part of href worth printing: web URLs as they are,
+// mailto: links as the address, nothing for anchors and scripts.
+func linkTarget(href string) string {
+	href = strings.TrimSpace(href)
+	switch {
+	case strings.HasPrefix(href, "http://"), strings.HasPrefix(href, "https://"):
+		return href
+	case strings.HasPrefix(href, "mailto:"):
+		address, _, _ := strings.Cut(strings.TrimPrefix(href, "mailto:"), "?")
+		return address
+	}
+	return ""
+}
+
+// textWriter collapses whitespace the way a browser does and tracks pending
+// line breaks, so nested blocks produce one blank line between paragraphs.
+type textWriter struct {
+	b         strings.Builder
+	newlines  int  // line breaks owed before the next text
+	spaced    bool // the last thing written was a space or line start
+	linkStart int
+}
+
+func (t *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if isSpace(s[0]) {
+		t.space()
+	}
+	for i, word := range strings.Fields(s) {
+		if i > 0 {
+			t.b.WriteByte(' ')
+		}
+		t.write(word)
+	}
+	if isSpace(s[len(s)-1]) {
+		t.space()
+	}
+}
+
+func (t *textWriter) write(s string) {
+	if t.b.Len() > 0 && t.newlines > 0 {
+		t.b.WriteString(strings.Repeat("\n", t.newlines))
+	}
+	t.newlines = 0
+	t.b.WriteString(s)
+	t.spaced = strings.HasSuffix(s, " ")
+}
+
+func (t *textWriter) space() {
+	if t.b.Len() > 0 && t.newlines == 0 && !t.spaced {
+		t.b.WriteByte(' ')
+		t.spaced = true
+	}
+}
+
+func (t *textWriter) breakLines(n int) {
+	if t.newlines < n {
+		t.newlines = n
+	}
+	t.spaced = true
+}
+
+func (t *textWriter) markLink() {
+	t.linkStart = t.b.Len()
+}
+
+func (t *textWriter) linkText() string {
+	if t.linkStart > t.b.Len() {
+		return ""
+	}
+	return strings.TrimSpace(t.b.String()[t.linkStart:])
+}
+
+func (t *textWriter) String() string {
+	lines := strings.Split(t.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
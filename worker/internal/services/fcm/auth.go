@@ -0,0 +1,137 @@
+package fcm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+const (
+	tokenURL  = "https://oauth2.googleapis.com/token"
+	scope     = "https://www.googleapis.com/auth/firebase.messaging"
+	grantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// tokenLifetime is the lifetime requested for the signed assertion;
+	// Google caps access tokens at one hour.
+	tokenLifetime = time.Hour
+	// refreshMargin renews a cached access token this long before it
+	// expires, so a send never starts with a token about to lapse.
+	refreshMargin = 5 * time.Minute
+)
+
+// tokenSource mints OAuth access tokens for a service account with the
+// JWT bearer grant and caches them until shortly before they expire.
+type tokenSource struct {
+	email      string
+	key        *rsa.PrivateKey
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newTokenSource(email, privateKeyPEM string, httpClient *http.Client) (*tokenSource, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid FCM service account private key: no PEM block")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid FCM service account private key: not an RSA key")
+	}
+	return &tokenSource{email: email, key: key, httpClient: httpClient}, nil
+}
+
+// Token returns a valid access token, minting a new one when needed.
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expiresAt.Add(-refreshMargin)) {
+		return t.token, nil
+	}
+
+	assertion, err := t.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {grantType}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", types.Retryable(fmt.Errorf("failed to request FCM access token: %w", err))
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode >= 400 {
+		errMsg := fmt.Sprintf("FCM token exchange failed (status %d)", resp.StatusCode)
+		if body.Error != "" {
+			errMsg += ": " + body.Error + " " + body.ErrorDescription
+		}
+		return "", types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+	if decodeErr != nil || body.AccessToken == "" {
+		return "", fmt.Errorf("failed to decode FCM token response: %v", decodeErr)
+	}
+
+	t.token = body.AccessToken
+	t.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	return t.token, nil
+}
+
+// Reset drops the cached token after the API rejected it.
+func (t *tokenSource) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ""
+}
+
+// assertion returns the RS256-signed JWT exchanged for an access token.
+func (t *tokenSource) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   t.email,
+		"scope": scope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token assertion: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,249 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	apiBaseURL = "https://fcm.googleapis.com/v1/projects/"
+	// maxTokens bounds the devices one task notifies.
+	maxTokens = 500
+	// sendConcurrency is how many devices are sent to at once; FCM HTTP v1
+	// takes one token per request.
+	sendConcurrency = 10
+)
+
+// FCM error codes (details[].errorCode) meaning the token will never work
+// again.
+var invalidTokenCodes = map[string]bool{
+	"UNREGISTERED":       true,
+	"SENDER_ID_MISMATCH": true,
+}
+
+type Service struct {
+	projectID  string
+	tokens     *tokenSource
+	configErr  error
+	httpClient *http.Client
+}
+
+type message struct {
+	Token        string            `json:"token"`
+	Notification *notification     `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *androidConfig    `json:"android,omitempty"`
+}
+
+type notification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+type androidConfig struct {
+	TTL string `json:"ttl,omitempty"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// NewService returns an FCM HTTP v1 client for projectID, authenticated as
+// the service account email with privateKey (PEM, PKCS#8). Sends are
+// throttled by limiter and refused while circuit is open. When the
+// credentials are missing or invalid every send fails permanently.
+func NewService(projectID, email, privateKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	s := &Service{
+		projectID: projectID,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+	if projectID == "" || email == "" || privateKey == "" {
+		s.configErr = errors.New("FCM_PROJECT_ID, FCM_SERVICE_ACCOUNT_EMAIL and FCM_SERVICE_ACCOUNT_PRIVATE_KEY are required for push notifications")
+		return s
+	}
+	tokenClient := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+	s.tokens, s.configErr = newTokenSource(email, privateKey, tokenClient)
+	return s
+}
+
+// tokenOutcome is the result of sending to one device.
+type tokenOutcome struct {
+	messageID string
+	invalid   bool
+	err       error
+	// fatal marks an error about the notification itself (e.g. an invalid
+	// payload), which fails the task instead of one device.
+	fatal bool
+}
+
+// Send delivers payload to each of its tokens. Tokens FCM rejects as
+// unregistered are reported in InvalidTokens rather than failing the task.
+// The task fails when the notification itself is rejected, or when no
+// device could be reached and at least one failure was transient, so it is
+// retried; otherwise it succeeds and transient per-device failures are
+// listed in FailedTokens.
+func (s *Service) Send(ctx context.Context, payload *types.PushNotificationPayload) (*types.PushNotificationResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("push notification payload is nil")
+	}
+	if s.configErr != nil {
+		return nil, types.Permanent(s.configErr)
+	}
+	if len(payload.Tokens) == 0 {
+		return nil, types.Permanent(errors.New("push notification has no device tokens"))
+	}
+	if len(payload.Tokens) > maxTokens {
+		return nil, types.Permanent(fmt.Errorf("push notification has more than %d device tokens", maxTokens))
+	}
+	if payload.Title == "" && payload.Body == "" && len(payload.Data) == 0 {
+		return nil, types.Permanent(errors.New("push notification needs a title, body or data"))
+	}
+
+	accessToken, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "sending push notification", logger.Fields{
+		"message_id": payload.MessageID,
+		"devices":    len(payload.Tokens),
+	})
+
+	outcomes := make([]tokenOutcome, len(payload.Tokens))
+	sem := make(chan struct{}, sendConcurrency)
+	var wg sync.WaitGroup
+	for i, token := range payload.Tokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i] = s.sendOne(ctx, accessToken, token, payload)
+		}()
+	}
+	wg.Wait()
+
+	result := &types.PushNotificationResult{}
+	var transient error
+	for i, outcome := range outcomes {
+		switch {
+		case outcome.fatal:
+			return nil, outcome.err
+		case outcome.invalid:
+			result.InvalidTokens = append(result.InvalidTokens, payload.Tokens[i])
+		case outcome.err != nil:
+			result.FailedTokens = append(result.FailedTokens, payload.Tokens[i])
+			if transient == nil {
+				transient = outcome.err
+			}
+		default:
+			result.Sent++
+			result.MessageIDs = append(result.MessageIDs, outcome.messageID)
+		}
+	}
+	if result.Sent == 0 && transient != nil {
+		return nil, transient
+	}
+
+	logger.Info(ctx, "push notification sent", logger.Fields{
+		"message_id":     payload.MessageID,
+		"sent":           result.Sent,
+		"invalid_tokens": len(result.InvalidTokens),
+		"failed_tokens":  len(result.FailedTokens),
+	})
+
+	return result, nil
+}
+
+func (s *Service) sendOne(ctx context.Context, accessToken, token string, payload *types.PushNotificationPayload) tokenOutcome {
+	msg := message{Token: token, Data: payload.Data}
+	if payload.Title != "" || payload.Body != "" || payload.ImageURL != "" {
+		msg.Notification = &notification{Title: payload.Title, Body: payload.Body, Image: payload.ImageURL}
+	}
+	if payload.TTLSeconds > 0 {
+		msg.Android = &androidConfig{TTL: strconv.Itoa(payload.TTLSeconds) + "s"}
+	}
+	reqBody, err := json.Marshal(map[string]any{"message": msg})
+	if err != nil {
+		return tokenOutcome{err: fmt.Errorf("failed to marshal FCM request: %w", err), fatal: true}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBaseURL+s.projectID+"/messages:send", bytes.NewReader(reqBody))
+	if err != nil {
+		return tokenOutcome{err: fmt.Errorf("failed to create HTTP request: %w", err), fatal: true}
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return tokenOutcome{err: types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 400 {
+		var sent struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&sent); err != nil {
+			return tokenOutcome{err: fmt.Errorf("failed to decode response: %w", err)}
+		}
+		return tokenOutcome{messageID: sent.Name}
+	}
+
+	var apiErr errorResponse
+	_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+	errorCode := apiErr.Error.Status
+	for _, d := range apiErr.Error.Details {
+		if d.ErrorCode != "" {
+			errorCode = d.ErrorCode
+		}
+	}
+	err = fmt.Errorf("FCM API error (status %d, %s): %s", resp.StatusCode, errorCode, apiErr.Error.Message)
+
+	switch {
+	case invalidTokenCodes[errorCode],
+		// A malformed token is reported as INVALID_ARGUMENT, like a bad
+		// payload; only the message tells them apart.
+		errorCode == "INVALID_ARGUMENT" && strings.Contains(strings.ToLower(apiErr.Error.Message), "registration token"):
+		return tokenOutcome{invalid: true, err: err}
+	case resp.StatusCode == http.StatusUnauthorized:
+		// The cached access token was revoked or expired early; the next
+		// send mints a new one.
+		s.tokens.Reset()
+		return tokenOutcome{err: types.Retryable(err)}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return tokenOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)}
+	default:
+		return tokenOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err), fatal: true}
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/bencyrus/chatterbox/shared/apierror"
 	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // Service provides an HTTP client wrapper around the files service for
@@ -22,14 +28,16 @@ type Service struct {
 	httpClient *http.Client
 }
 
-// NewService constructs a new files Service client.
-func NewService(baseURL, apiKey string) *Service {
+// NewService constructs a new files Service client whose calls are
+// throttled by limiter and refused while circuit is open.
+func NewService(baseURL, apiKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
 	normalized := strings.TrimRight(strings.TrimSpace(baseURL), "/")
 	return &Service{
 		baseURL: normalized,
 		apiKey:  strings.TrimSpace(apiKey),
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
 		},
 	}
 }
@@ -67,15 +75,16 @@ func (s *Service) GetSignedDeleteURL(ctx context.Context, fileID int64) (string,
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-File-Service-Api-Key", s.apiKey)
+	setRequestID(req)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call files service signed_delete_url: %w", err)
+		return "", types.Retryable(fmt.Errorf("failed to call files service signed_delete_url: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("files service signed_delete_url returned status %d", resp.StatusCode)
+		return "", serviceError(resp, "signed_delete_url")
 	}
 
 	var parsed types.FileSignedDeleteURLResponse
@@ -97,63 +106,181 @@ func (s *Service) GetSignedDeleteURL(ctx context.Context, fileID int64) (string,
 // the files service. The files service is responsible for resolving storage
 // details (bucket, object key) from the file ID.
 func (s *Service) GetSignedDownloadURL(ctx context.Context, fileID int64) (string, error) {
-	if s.baseURL == "" {
-		return "", fmt.Errorf("files service baseURL is empty")
+	logger.Info(ctx, "requesting signed download URL from files service", logger.Fields{
+		"file_id": fileID,
+	})
+
+	urls, err := s.GetSignedDownloadURLs(ctx, []int64{fileID})
+	if err != nil {
+		return "", err
 	}
-	if s.apiKey == "" {
-		return "", fmt.Errorf("files service api key is empty")
+	url, ok := urls[fileID]
+	if !ok || url == "" {
+		return "", fmt.Errorf("files service signed_download_url response missing url")
 	}
 
-	logger.Info(ctx, "requesting signed download URL from files service", logger.Fields{
+	logger.Info(ctx, "received signed download URL from files service", logger.Fields{
 		"file_id": fileID,
 	})
 
-	// The files service expects a "files" array, not a single "file_id"
-	body := map[string]any{
-		"files": []int64{fileID},
+	return url, nil
+}
+
+// downloadURLBatchSize bounds the file ids sent in one /signed_download_url
+// request.
+const downloadURLBatchSize = 200
+
+// GetSignedDownloadURLs requests signed download URLs for fileIDs, in batches
+// of up to downloadURLBatchSize ids per call, and returns them by file id.
+// Duplicate ids are requested once. Ids the files service does not know are
+// missing from the result rather than failing the call, so callers bundling
+// many files decide themselves whether a missing one matters.
+func (s *Service) GetSignedDownloadURLs(ctx context.Context, fileIDs []int64) (map[int64]string, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("files service baseURL is empty")
+	}
+	if s.apiKey == "" {
+		return nil, fmt.Errorf("files service api key is empty")
 	}
 
-	reqBody, err := json.Marshal(body)
+	unique := make([]int64, 0, len(fileIDs))
+	seen := make(map[int64]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	urls := make(map[int64]string, len(unique))
+	for start := 0; start < len(unique); start += downloadURLBatchSize {
+		batch := unique[start:min(start+downloadURLBatchSize, len(unique))]
+
+		// The files service expects a "files" array of ids
+		reqBody, err := json.Marshal(map[string]any{"files": batch})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal signed download url request: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/signed_download_url", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create signed download url request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-File-Service-Api-Key", s.apiKey)
+		setRequestID(req)
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			return nil, types.Retryable(fmt.Errorf("failed to call files service signed_download_url: %w", err))
+		}
+
+		// The files service returns an array of {file_id, url} objects
+		var parsed []types.FileSignedDownloadURLResponse
+		if resp.StatusCode >= 400 {
+			err = serviceError(resp, "signed_download_url")
+		} else if decodeErr := json.NewDecoder(resp.Body).Decode(&parsed); decodeErr != nil {
+			err = fmt.Errorf("failed to decode signed_download_url response: %w", decodeErr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range parsed {
+			if f.URL != "" {
+				urls[f.FileID] = f.URL
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+// WarmSignedDownloadURLs requests signed download URLs for fileIDs and
+// discards them, so the files service caches them before clients ask. It
+// returns how many URLs the files service returned; ids it does not know are
+// skipped there.
+func (s *Service) WarmSignedDownloadURLs(ctx context.Context, fileIDs []int64) (int, error) {
+	urls, err := s.GetSignedDownloadURLs(ctx, fileIDs)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal signed download url request: %w", err)
+		return 0, err
 	}
 
-	reqURL := s.baseURL + "/signed_download_url"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(reqBody))
+	logger.Info(ctx, "warmed signed download URLs", logger.Fields{
+		"requested_files": len(fileIDs),
+		"warmed_files":    len(urls),
+	})
+
+	return len(urls), nil
+}
+
+// GetSignedUploadURL requests a signed upload URL for an upload intent from
+// the files service, which resolves the intent's bucket, object key and
+// content type.
+func (s *Service) GetSignedUploadURL(ctx context.Context, uploadIntentID int64) (*types.FileSignedUploadURLResponse, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("files service baseURL is empty")
+	}
+	if s.apiKey == "" {
+		return nil, fmt.Errorf("files service api key is empty")
+	}
+
+	reqBody, err := json.Marshal(map[string]any{"upload_intent_id": uploadIntentID})
 	if err != nil {
-		return "", fmt.Errorf("failed to create signed download url request: %w", err)
+		return nil, fmt.Errorf("failed to marshal signed upload url request: %w", err)
 	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/signed_upload_url", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed upload url request: %w", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-File-Service-Api-Key", s.apiKey)
+	setRequestID(req)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call files service signed_download_url: %w", err)
+		return nil, types.Retryable(fmt.Errorf("failed to call files service signed_upload_url: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("files service signed_download_url returned status %d", resp.StatusCode)
+		return nil, serviceError(resp, "signed_upload_url")
 	}
 
-	// The files service returns an array of {file_id, url} objects
-	var parsed []types.FileSignedDownloadURLResponse
+	var parsed types.FileSignedUploadURLResponse
 	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return "", fmt.Errorf("failed to decode signed_download_url response: %w", err)
+		return nil, fmt.Errorf("failed to decode signed_upload_url response: %w", err)
 	}
-	if len(parsed) == 0 {
-		return "", fmt.Errorf("files service signed_download_url returned empty array")
+	if parsed.UploadURL == "" {
+		return nil, fmt.Errorf("files service signed_upload_url response missing upload_url")
 	}
-	if parsed[0].URL == "" {
-		return "", fmt.Errorf("files service signed_download_url response missing url")
+	return &parsed, nil
+}
+
+// UploadBySignedURL performs an HTTP PUT of body against the provided signed
+// URL, with its content type and the headers signed into it.
+func (s *Service) UploadBySignedURL(ctx context.Context, upload *types.FileSignedUploadURLResponse, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, rewriteEmulatorURL(upload.UploadURL), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range upload.UploadHeaders {
+		req.Header.Set(name, value)
 	}
 
-	logger.Info(ctx, "received signed download URL from files service", logger.Fields{
-		"file_id": fileID,
-	})
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return types.Retryable(fmt.Errorf("failed to execute upload request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("signed upload URL request returned status %d", resp.StatusCode))
+	}
 
-	return parsed[0].URL, nil
+	return nil
 }
 
 // DeleteBySignedURL performs an HTTP DELETE against the provided signed URL.
@@ -162,31 +289,78 @@ func (s *Service) DeleteBySignedURL(ctx context.Context, signedURL string) error
 		return fmt.Errorf("signed delete URL is empty")
 	}
 
-	// In local dev, the files service returns signed URLs rewritten to
-	// localhost:4443 (for browser/curl on host). But the worker runs inside
-	// Docker, where localhost points at the worker container, not the gcs
-	// emulator container. Rewrite only for that special case.
-	if u, err := url.Parse(signedURL); err == nil {
-		if u.Host == "localhost:4443" || u.Host == "0.0.0.0:4443" || u.Host == "[::1]:4443" {
-			u.Host = "gcs:4443"
-			signedURL = u.String()
-		}
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, signedURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, rewriteEmulatorURL(signedURL), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create delete request: %w", err)
 	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to execute delete request: %w", err)
+		return types.Retryable(fmt.Errorf("failed to execute delete request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("signed delete URL request returned status %d", resp.StatusCode)
+		return types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("signed delete URL request returned status %d", resp.StatusCode))
 	}
 
 	return nil
 }
+
+// OpenFile streams a file's contents through a signed download URL from the
+// files service. The caller must close the returned body.
+func (s *Service) OpenFile(ctx context.Context, fileID int64) (io.ReadCloser, error) {
+	signedURL, err := s.GetSignedDownloadURL(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rewriteEmulatorURL(signedURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to execute download request: %w", err))
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("signed download URL request returned status %d", resp.StatusCode))
+	}
+
+	return resp.Body, nil
+}
+
+// serviceError classifies a failed files service response, carrying the
+// error code and message of its JSON error envelope when it has one.
+func serviceError(resp *http.Response, endpoint string) error {
+	err := fmt.Errorf("files service %s returned status %d", endpoint, resp.StatusCode)
+	if apiErr := apierror.Read(resp); apiErr != nil {
+		err = fmt.Errorf("files service %s returned status %d: %w", endpoint, resp.StatusCode, apiErr)
+	}
+	return types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)
+}
+
+// rewriteEmulatorURL maps signed URLs pointing at the local GCS emulator.
+// In local dev, the files service returns signed URLs rewritten to
+// localhost:4443 (for browser/curl on host). But the worker runs inside
+// Docker, where localhost points at the worker container, not the gcs
+// emulator container. Rewrite only for that special case.
+func rewriteEmulatorURL(signedURL string) string {
+	if u, err := url.Parse(signedURL); err == nil {
+		if u.Host == "localhost:4443" || u.Host == "0.0.0.0:4443" || u.Host == "[::1]:4443" {
+			u.Host = "gcs:4443"
+			return u.String()
+		}
+	}
+	return signedURL
+}
+
+// setRequestID forwards the originating request id from the request context,
+// so the files service logs the call under the same request_id.
+func setRequestID(req *http.Request) {
+	if requestID, ok := req.Context().Value(logger.RequestIDKey).(string); ok && requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+}
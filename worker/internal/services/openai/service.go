@@ -11,7 +11,11 @@ import (
 	"time"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 const responsesAPIURL = "https://api.openai.com/v1/responses"
@@ -21,11 +25,12 @@ type Service struct {
 	httpClient *http.Client
 }
 
-func NewService(apiKey string) *Service {
+func NewService(apiKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
 	return &Service{
 		apiKey: apiKey,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
 		},
 	}
 }
@@ -155,7 +160,7 @@ func (s *Service) RetrieveResponse(
 func (s *Service) do(req *http.Request) ([]byte, error) {
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
+		return nil, types.Retryable(fmt.Errorf("OpenAI API request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -165,7 +170,7 @@ func (s *Service) do(req *http.Request) ([]byte, error) {
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("OpenAI API returned %d: %s", resp.StatusCode, string(body))
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("OpenAI API returned %d: %s", resp.StatusCode, string(body)))
 	}
 
 	return body, nil
@@ -0,0 +1,34 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// ConsoleProvider only logs SMS, for local development.
+type ConsoleProvider struct{}
+
+func (ConsoleProvider) Name() string { return ProviderConsole }
+
+// Send logs payload and returns a synthetic sms_<message_id> response.
+func (ConsoleProvider) Send(ctx context.Context, payload *types.SMSPayload) (*SMSResponse, error) {
+	logger.Info(ctx, "SMS simulated", logger.Fields{
+		"message_id": payload.MessageID,
+		"to_number":  payload.ToNumber,
+		"body":       payload.Body,
+	})
+
+	log.Printf("📱 SMS TO: %s\n", payload.ToNumber)
+	log.Printf("📱 SMS BODY: %s\n", payload.Body)
+	log.Printf("📱 SMS MESSAGE ID: %d\n", payload.MessageID)
+	log.Println("📱 SMS SENT SUCCESSFULLY (simulated)")
+
+	return &SMSResponse{
+		MessageID: fmt.Sprintf("sms_%d", payload.MessageID),
+		Status:    "sent",
+	}, nil
+}
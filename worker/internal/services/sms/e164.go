@@ -0,0 +1,148 @@
+package sms
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// E.164 allows at most 15 digits; the shortest assigned numbers have 7.
+const (
+	minE164Digits = 7
+	maxE164Digits = 15
+)
+
+// numberingPlan is a country's calling code, the trunk prefix dialled before
+// national numbers (dropped in E.164), and the length range of its national
+// significant numbers. The ranges are deliberately loose; they catch garbage,
+// not unassigned numbers.
+type numberingPlan struct {
+	callingCode string
+	trunkPrefix string
+	minLength   int
+	maxLength   int
+}
+
+// numberingPlans are the countries WORKER_SMS_DEFAULT_COUNTRY may name, by
+// ISO 3166-1 alpha-2 code.
+var numberingPlans = map[string]numberingPlan{
+	"AE": {"971", "0", 8, 9},
+	"AR": {"54", "0", 10, 11},
+	"AT": {"43", "0", 4, 13},
+	"AU": {"61", "0", 9, 9},
+	"BE": {"32", "0", 8, 9},
+	"BR": {"55", "0", 10, 11},
+	"CA": {"1", "1", 10, 10},
+	"CH": {"41", "0", 9, 9},
+	"CN": {"86", "0", 7, 12},
+	"DE": {"49", "0", 5, 13},
+	"DK": {"45", "", 8, 8},
+	"ES": {"34", "", 9, 9},
+	"FI": {"358", "0", 5, 12},
+	"FR": {"33", "0", 9, 9},
+	"GB": {"44", "0", 9, 10},
+	"HK": {"852", "", 8, 8},
+	"IE": {"353", "0", 7, 9},
+	"IL": {"972", "0", 8, 9},
+	"IN": {"91", "0", 10, 10},
+	"IR": {"98", "0", 10, 10},
+	"IT": {"39", "", 6, 11},
+	"JP": {"81", "0", 9, 10},
+	"KR": {"82", "0", 8, 10},
+	"MX": {"52", "", 10, 10},
+	"NG": {"234", "0", 8, 10},
+	"NL": {"31", "0", 9, 9},
+	"NO": {"47", "", 8, 8},
+	"NZ": {"64", "0", 8, 10},
+	"PL": {"48", "", 9, 9},
+	"PT": {"351", "", 9, 9},
+	"RU": {"7", "8", 10, 10},
+	"SE": {"46", "0", 7, 10},
+	"SG": {"65", "", 8, 8},
+	"TR": {"90", "0", 10, 10},
+	"US": {"1", "1", 10, 10},
+	"ZA": {"27", "0", 9, 9},
+}
+
+// plansByCallingCode indexes numberingPlans for checking international
+// numbers. Countries sharing a calling code (US and CA, the NANP) share its
+// length range.
+var plansByCallingCode = func() map[string]numberingPlan {
+	byCode := make(map[string]numberingPlan, len(numberingPlans))
+	for _, plan := range numberingPlans {
+		byCode[plan.callingCode] = plan
+	}
+	return byCode
+}()
+
+// SupportedCountry reports whether country (ISO 3166-1 alpha-2) can be used
+// as the default country of NormalizeE164.
+func SupportedCountry(country string) bool {
+	_, ok := numberingPlans[strings.ToUpper(country)]
+	return ok
+}
+
+// NormalizeE164 returns number in E.164 form (+ and up to 15 digits). Spaces
+// and the usual separators are removed and a 00 international prefix is read
+// as +. Numbers without either prefix are taken as national numbers of
+// defaultCountry, dropping its trunk prefix; without a default country they
+// are rejected. Numbers of a known calling code must have a national number
+// of a plausible length for it.
+func NormalizeE164(number, defaultCountry string) (string, error) {
+	var digits strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+		default:
+			return "", fmt.Errorf("phone number contains %q", r)
+		}
+	}
+	cleaned := digits.String()
+	if cleaned == "" || cleaned == "+" {
+		return "", errors.New("phone number is empty")
+	}
+
+	var international string
+	switch {
+	case strings.HasPrefix(cleaned, "+"):
+		international = cleaned[1:]
+	case strings.HasPrefix(cleaned, "00"):
+		international = cleaned[2:]
+	default:
+		if defaultCountry == "" {
+			return "", errors.New("phone number is not in international format and no default country is configured")
+		}
+		plan, ok := numberingPlans[strings.ToUpper(defaultCountry)]
+		if !ok {
+			return "", fmt.Errorf("unsupported default country %q", defaultCountry)
+		}
+		national := cleaned
+		if plan.trunkPrefix != "" && strings.HasPrefix(national, plan.trunkPrefix) && len(national) > plan.minLength {
+			national = national[len(plan.trunkPrefix):]
+		}
+		international = plan.callingCode + national
+	}
+
+	if len(international) < minE164Digits || len(international) > maxE164Digits {
+		return "", fmt.Errorf("phone number must have %d to %d digits with the country code", minE164Digits, maxE164Digits)
+	}
+	if international[0] == '0' {
+		return "", errors.New("phone number has no country code")
+	}
+	for length := 1; length <= 3; length++ {
+		plan, ok := plansByCallingCode[international[:length]]
+		if !ok {
+			continue
+		}
+		national := len(international) - length
+		if national < plan.minLength || national > plan.maxLength {
+			return "", fmt.Errorf("phone number has %d digits after country code +%s, want %d to %d", national, plan.callingCode, plan.minLength, plan.maxLength)
+		}
+		break
+	}
+	return "+" + international, nil
+}
@@ -0,0 +1,65 @@
+package sms
+
+import (
+	"net/url"
+	"strings"
+)
+
+// StatusSuppressed is the SMSResponse status of a message that was not sent
+// because its recipient opted out.
+const StatusSuppressed = "suppressed"
+
+// Opt-out actions, as stored in comms.sms_opt_out_event.
+const (
+	OptOutActionOptOut = "opt_out"
+	OptOutActionOptIn  = "opt_in"
+)
+
+// OptOut is a recipient's opt-out or opt-in, as passed to
+// comms.record_sms_opt_out.
+type OptOut struct {
+	PhoneNumber string `json:"phone_number"`
+	Action      string `json:"action"`
+	Source      string `json:"source"`
+	Keyword     string `json:"keyword,omitempty"`
+}
+
+// The carrier keywords Twilio's default opt-out handling recognizes.
+var (
+	optOutKeywords = map[string]bool{
+		"STOP": true, "STOPALL": true, "UNSUBSCRIBE": true, "CANCEL": true,
+		"END": true, "QUIT": true, "OPTOUT": true, "REVOKE": true,
+	}
+	optInKeywords = map[string]bool{"START": true, "YES": true, "UNSTOP": true}
+)
+
+// TwilioOptOut maps an inbound message webhook's form to an OptOut. The
+// OptOutType Twilio adds when Advanced Opt-Out is enabled is used when
+// present; otherwise the body must be one of the opt-out or opt-in keywords
+// on its own. ok is false for other messages.
+func TwilioOptOut(form url.Values) (optOut OptOut, ok bool) {
+	from := form.Get("From")
+	if from == "" {
+		return OptOut{}, false
+	}
+	keyword := strings.ToUpper(strings.Join(strings.Fields(form.Get("Body")), ""))
+
+	var action string
+	switch strings.ToUpper(form.Get("OptOutType")) {
+	case "STOP":
+		action = OptOutActionOptOut
+	case "START":
+		action = OptOutActionOptIn
+	case "":
+		switch {
+		case optOutKeywords[keyword]:
+			action = OptOutActionOptOut
+		case optInKeywords[keyword]:
+			action = OptOutActionOptIn
+		}
+	}
+	if action == "" {
+		return OptOut{}, false
+	}
+	return OptOut{PhoneNumber: from, Action: action, Source: ProviderTwilio, Keyword: keyword}, true
+}
@@ -0,0 +1,113 @@
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// SMS encodings. A body is sent as GSM-7 when every character is in the GSM
+// 03.38 alphabet, otherwise as UCS-2.
+const (
+	EncodingGSM7 = "gsm7"
+	EncodingUCS2 = "ucs2"
+)
+
+// Characters per segment: a single-segment message uses the full 140 bytes,
+// a concatenated one loses 6 to the user data header of each part.
+const (
+	gsm7SingleSegment = 160
+	gsm7MultiSegment  = 153
+	ucs2SingleSegment = 70
+	ucs2MultiSegment  = 67
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet (one septet each); gsm7Extended
+// are the characters sent with an escape (two septets each).
+const (
+	gsm7Basic    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "^{}\\[~]|€\f"
+)
+
+// SegmentInfo describes how a body is split for sending. Units are septets
+// for GSM-7 and UTF-16 code units for UCS-2.
+type SegmentInfo struct {
+	Encoding string `json:"encoding"`
+	Units    int    `json:"units"`
+	Segments int    `json:"segments"`
+}
+
+// Segments returns the encoding of body and the number of segments it is
+// billed as.
+func Segments(body string) SegmentInfo {
+	if units, ok := gsm7Units(body); ok {
+		return SegmentInfo{Encoding: EncodingGSM7, Units: units, Segments: segmentCount(units, gsm7SingleSegment, gsm7MultiSegment)}
+	}
+	units := len(utf16.Encode([]rune(body)))
+	return SegmentInfo{Encoding: EncodingUCS2, Units: units, Segments: segmentCount(units, ucs2SingleSegment, ucs2MultiSegment)}
+}
+
+// TruncateToSegments shortens body to fit in maxSegments segments, cutting
+// whole characters. A body that fits is returned unchanged.
+func TruncateToSegments(body string, maxSegments int) string {
+	info := Segments(body)
+	if maxSegments <= 0 || info.Segments <= maxSegments {
+		return body
+	}
+	limit := maxSegments * ucs2MultiSegment
+	if maxSegments == 1 {
+		limit = ucs2SingleSegment
+	}
+	if info.Encoding == EncodingGSM7 {
+		limit = maxSegments * gsm7MultiSegment
+		if maxSegments == 1 {
+			limit = gsm7SingleSegment
+		}
+	}
+
+	var b strings.Builder
+	used := 0
+	for _, r := range body {
+		size := runeUnits(r, info.Encoding)
+		if used+size > limit {
+			break
+		}
+		used += size
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func gsm7Units(body string) (int, bool) {
+	units := 0
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			units++
+		case strings.ContainsRune(gsm7Extended, r):
+			units += 2
+		default:
+			return 0, false
+		}
+	}
+	return units, true
+}
+
+func runeUnits(r rune, encoding string) int {
+	if encoding == EncodingGSM7 {
+		if strings.ContainsRune(gsm7Extended, r) {
+			return 2
+		}
+		return 1
+	}
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func segmentCount(units, single, multi int) int {
+	if units <= single {
+		return 1
+	}
+	return (units + multi - 1) / multi
+}
@@ -3,24 +3,53 @@ package sms
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
 )
 
-type Service struct{}
+// Provider names, as configured in WORKER_SMS_PROVIDER and
+// WORKER_SMS_FALLBACK_PROVIDER and reported in SMSResponse.Provider.
+const (
+	ProviderTwilio  = "twilio"
+	ProviderVonage  = "vonage"
+	ProviderConsole = "console"
+)
+
+// SMSProvider delivers one SMS. Implementations classify their errors with
+// the types error classes, which decide whether the fallback is tried.
+type SMSProvider interface {
+	Name() string
+	Send(ctx context.Context, payload *types.SMSPayload) (*SMSResponse, error)
+}
 
+// SMSResponse is what the success handler receives: the provider that sent
+// the message, its message id there, the status it reported, and the
+// segments the body was billed as.
 type SMSResponse struct {
+	Provider  string `json:"provider"`
 	MessageID string `json:"message_id"`
 	Status    string `json:"status"`
+	Segments  int    `json:"segments,omitempty"`
 }
 
-func NewService() *Service {
-	return &Service{}
+// Service sends SMS through a primary provider, failing over to an optional
+// fallback.
+type Service struct {
+	primary  SMSProvider
+	fallback SMSProvider
 }
 
-// SendSMS simulates sending an SMS by logging it to console
+// NewService returns a Service sending through primary, and through
+// fallback (which may be nil) when primary fails with a retryable,
+// rate-limited or unavailable error.
+func NewService(primary, fallback SMSProvider) *Service {
+	return &Service{primary: primary, fallback: fallback}
+}
+
+// SendSMS sends payload, failing over to the fallback provider when the
+// primary's failure is transient. A permanent failure (e.g. an invalid
+// number) is returned as is, as the fallback would reject it too.
 func (s *Service) SendSMS(ctx context.Context, payload *types.SMSPayload) (*SMSResponse, error) {
 	if payload == nil {
 		return nil, fmt.Errorf("sms payload is nil")
@@ -29,26 +58,46 @@ func (s *Service) SendSMS(ctx context.Context, payload *types.SMSPayload) (*SMSR
 	logger.Info(ctx, "sending SMS", logger.Fields{
 		"message_id": payload.MessageID,
 		"to_number":  payload.ToNumber,
-		"body":       payload.Body,
+		"provider":   s.primary.Name(),
 	})
 
-	// Log the SMS to console for now
-	log.Printf("📱 SMS TO: %s\n", payload.ToNumber)
-	log.Printf("📱 SMS BODY: %s\n", payload.Body)
-	log.Printf("📱 SMS MESSAGE ID: %d\n", payload.MessageID)
-	log.Println("📱 SMS SENT SUCCESSFULLY (simulated)")
-
-	// Return a simulated response
-	response := &SMSResponse{
-		MessageID: fmt.Sprintf("sms_%d", payload.MessageID),
-		Status:    "sent",
+	resp, err := s.send(ctx, s.primary, payload)
+	if err != nil && s.fallback != nil && failoverable(err) {
+		logger.Warn(ctx, "SMS provider failed; trying fallback", logger.Fields{
+			"message_id": payload.MessageID,
+			"provider":   s.primary.Name(),
+			"fallback":   s.fallback.Name(),
+			"error":      err.Error(),
+		})
+		resp, err = s.send(ctx, s.fallback, payload)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Info(ctx, "SMS sent successfully", logger.Fields{
-		"message_id":   payload.MessageID,
-		"simulated_id": response.MessageID,
-		"status":       response.Status,
+		"message_id":          payload.MessageID,
+		"provider":            resp.Provider,
+		"provider_message_id": resp.MessageID,
+		"status":              resp.Status,
 	})
 
-	return response, nil
+	return resp, nil
+}
+
+func (s *Service) send(ctx context.Context, provider SMSProvider, payload *types.SMSPayload) (*SMSResponse, error) {
+	resp, err := provider.Send(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", provider.Name(), err)
+	}
+	resp.Provider = provider.Name()
+	return resp, nil
+}
+
+func failoverable(err error) bool {
+	switch types.ErrorClass(err) {
+	case types.ErrRetryable, types.ErrRateLimited, types.ErrUnavailable:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,119 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const twilioBaseURL = "https://api.twilio.com/2010-04-01/Accounts/"
+
+// TwilioConfig holds the Twilio account messages are sent from. Messages go
+// out from MessagingServiceSID when set, otherwise from FromNumber. When
+// StatusCallbackURL is set Twilio posts each message's status changes there.
+type TwilioConfig struct {
+	AccountSID          string
+	AuthToken           string
+	FromNumber          string
+	MessagingServiceSID string
+	StatusCallbackURL   string
+}
+
+// TwilioProvider sends SMS through Twilio's Messages API.
+type TwilioProvider struct {
+	twilio     TwilioConfig
+	httpClient *http.Client
+}
+
+type twilioMessage struct {
+	SID          string `json:"sid"`
+	Status       string `json:"status"`
+	ErrorCode    *int   `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+type twilioError struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+}
+
+// NewTwilioProvider returns a Twilio client throttled by limiter and refused
+// while circuit is open.
+func NewTwilioProvider(twilio TwilioConfig, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *TwilioProvider {
+	return &TwilioProvider{
+		twilio: twilio,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *TwilioProvider) Name() string { return ProviderTwilio }
+
+// Send sends payload through Twilio. The response carries Twilio's message
+// SID and its status at acceptance (usually queued or accepted).
+func (p *TwilioProvider) Send(ctx context.Context, payload *types.SMSPayload) (*SMSResponse, error) {
+	if p.twilio.AccountSID == "" || p.twilio.AuthToken == "" || (p.twilio.FromNumber == "" && p.twilio.MessagingServiceSID == "") {
+		return nil, types.Permanent(errors.New("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER or TWILIO_MESSAGING_SERVICE_SID are required"))
+	}
+
+	form := url.Values{"To": {payload.ToNumber}, "Body": {payload.Body}}
+	if p.twilio.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", p.twilio.MessagingServiceSID)
+	} else {
+		form.Set("From", p.twilio.FromNumber)
+	}
+	if p.twilio.StatusCallbackURL != "" {
+		form.Set("StatusCallback", p.twilio.StatusCallbackURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, twilioBaseURL+p.twilio.AccountSID+"/Messages.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.SetBasicAuth(p.twilio.AccountSID, p.twilio.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr twilioError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		errMsg := fmt.Sprintf("twilio API error (status %d)", resp.StatusCode)
+		if apiErr.Code != 0 {
+			errMsg += fmt.Sprintf(", code %d: %s", apiErr.Code, apiErr.Message)
+		}
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+
+	var message twilioMessage
+	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if message.Status == "failed" || message.Status == "undelivered" {
+		errMsg := "twilio rejected message with status " + message.Status
+		if message.ErrorCode != nil {
+			errMsg += fmt.Sprintf(", code %d: %s", *message.ErrorCode, message.ErrorMessage)
+		}
+		return nil, types.Permanent(errors.New(errMsg))
+	}
+
+	return &SMSResponse{MessageID: message.SID, Status: message.Status}, nil
+}
@@ -0,0 +1,80 @@
+package sms
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DeliveryStatus is a delivery report for a sent message, as passed to
+// comms.record_sms_delivery_status. MessageID is the provider's message id
+// the success handler stored.
+type DeliveryStatus struct {
+	Provider     string `json:"provider"`
+	MessageID    string `json:"message_id"`
+	Status       string `json:"status"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// finalTwilioStatuses are the Twilio message statuses recorded as delivery
+// state; the intermediate ones (queued, sending, sent) are not.
+var finalTwilioStatuses = map[string]bool{
+	"delivered":   true,
+	"failed":      true,
+	"undelivered": true,
+}
+
+// ValidTwilioSignature reports whether signature (the X-Twilio-Signature
+// header) is Twilio's signature of a request to callbackURL with the form
+// parameters form: the base64 HMAC-SHA1, keyed with the auth token, of the
+// URL followed by each parameter name and value sorted by name.
+func ValidTwilioSignature(authToken, callbackURL string, form url.Values, signature string) bool {
+	if authToken == "" || signature == "" {
+		return false
+	}
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(callbackURL)
+	for _, key := range keys {
+		for _, value := range form[key] {
+			b.WriteString(key)
+			b.WriteString(value)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// TwilioDeliveryStatus maps a Twilio status callback's form to a
+// DeliveryStatus. ok is false for statuses that are not final.
+func TwilioDeliveryStatus(form url.Values) (status DeliveryStatus, ok bool) {
+	messageStatus := form.Get("MessageStatus")
+	if messageStatus == "" {
+		messageStatus = form.Get("SmsStatus")
+	}
+	messageSID := form.Get("MessageSid")
+	if messageSID == "" {
+		messageSID = form.Get("SmsSid")
+	}
+	if !finalTwilioStatuses[messageStatus] || messageSID == "" {
+		return DeliveryStatus{}, false
+	}
+	return DeliveryStatus{
+		Provider:     ProviderTwilio,
+		MessageID:    messageSID,
+		Status:       messageStatus,
+		ErrorCode:    form.Get("ErrorCode"),
+		ErrorMessage: form.Get("ErrorMessage"),
+	}, true
+}
@@ -0,0 +1,113 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const vonageURL = "https://rest.nexmo.com/sms/json"
+
+// VonageConfig holds the Vonage account and sender messages are sent from.
+type VonageConfig struct {
+	APIKey    string
+	APISecret string
+	From      string
+}
+
+// VonageProvider sends SMS through Vonage's SMS API.
+type VonageProvider struct {
+	vonage     VonageConfig
+	httpClient *http.Client
+}
+
+type vonageResponse struct {
+	Messages []struct {
+		MessageID string `json:"message-id"`
+		Status    string `json:"status"`
+		ErrorText string `json:"error-text"`
+	} `json:"messages"`
+}
+
+// Vonage statuses worth retrying: throttled, internal error, and
+// communication failure.
+var vonageRetryableStatuses = map[string]bool{"1": true, "5": true, "13": true}
+
+// NewVonageProvider returns a Vonage client throttled by limiter and refused
+// while circuit is open.
+func NewVonageProvider(vonage VonageConfig, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *VonageProvider {
+	return &VonageProvider{
+		vonage: vonage,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *VonageProvider) Name() string { return ProviderVonage }
+
+// Send sends payload through Vonage. A long message is split into parts by
+// Vonage; the response carries the first part's message id.
+func (p *VonageProvider) Send(ctx context.Context, payload *types.SMSPayload) (*SMSResponse, error) {
+	if p.vonage.APIKey == "" || p.vonage.APISecret == "" || p.vonage.From == "" {
+		return nil, types.Permanent(errors.New("VONAGE_API_KEY, VONAGE_API_SECRET and VONAGE_FROM are required"))
+	}
+
+	form := url.Values{
+		"api_key":    {p.vonage.APIKey},
+		"api_secret": {p.vonage.APISecret},
+		"from":       {p.vonage.From},
+		// Vonage expects the number without the leading +.
+		"to":   {strings.TrimPrefix(payload.ToNumber, "+")},
+		"text": {payload.Body},
+		"type": {"unicode"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vonageURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("vonage API error (status %d)", resp.StatusCode))
+	}
+
+	var vonageResp vonageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vonageResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(vonageResp.Messages) == 0 {
+		return nil, errors.New("vonage response has no messages")
+	}
+	// Vonage reports errors per part with HTTP 200.
+	for _, part := range vonageResp.Messages {
+		if part.Status == "0" {
+			continue
+		}
+		err := fmt.Errorf("vonage rejected message (status %s): %s", part.Status, part.ErrorText)
+		if vonageRetryableStatuses[part.Status] {
+			return nil, types.Retryable(err)
+		}
+		return nil, types.Permanent(err)
+	}
+
+	return &SMSResponse{MessageID: vonageResp.Messages[0].MessageID, Status: "submitted"}, nil
+}
@@ -0,0 +1,196 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const apiBaseURL = "https://api.telegram.org"
+
+// Telegram's limits on message text and document captions.
+const (
+	maxTextLength    = 4096
+	maxCaptionLength = 1024
+)
+
+type Service struct {
+	botToken   string
+	httpClient *http.Client
+}
+
+// MessageResponse is the part of the sent message the worker keeps.
+// DocumentFileID lets later messages resend the same document without
+// Telegram fetching it again.
+type MessageResponse struct {
+	MessageID      int64  `json:"message_id"`
+	ChatID         int64  `json:"chat_id"`
+	DocumentFileID string `json:"document_file_id,omitempty"`
+}
+
+type sendRequest struct {
+	ChatID              json.RawMessage `json:"chat_id"`
+	Text                string          `json:"text,omitempty"`
+	Document            string          `json:"document,omitempty"`
+	Caption             string          `json:"caption,omitempty"`
+	ParseMode           string          `json:"parse_mode,omitempty"`
+	DisableNotification bool            `json:"disable_notification,omitempty"`
+}
+
+// apiResponse is the Bot API envelope.
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+	Result struct {
+		MessageID int64 `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Document struct {
+			FileID string `json:"file_id"`
+		} `json:"document"`
+	} `json:"result"`
+}
+
+// NewService returns a Telegram Bot API client whose calls are throttled by
+// limiter and refused while circuit is open.
+func NewService(botToken string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	return &Service{
+		botToken: botToken,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+// SendMessage sends payload with sendMessage, or with sendDocument when it
+// carries a document. The document must already be resolved to a URL or a
+// Telegram file_id. The bot token is part of the request path, so request
+// URLs are never logged or returned in errors.
+func (s *Service) SendMessage(ctx context.Context, payload *types.TelegramMessagePayload) (*MessageResponse, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("telegram message payload is nil")
+	}
+	if s.botToken == "" {
+		return nil, types.Permanent(errors.New("TELEGRAM_BOT_TOKEN is not configured"))
+	}
+	method, req, err := buildRequest(payload)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+
+	logger.Info(ctx, "sending telegram message", logger.Fields{
+		"message_id": payload.MessageID,
+		"method":     method,
+	})
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal telegram request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBaseURL+"/bot"+s.botToken+"/"+method, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, errors.New("failed to create HTTP request")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&apiResp)
+
+	if resp.StatusCode >= 400 || (decodeErr == nil && !apiResp.OK) {
+		status := resp.StatusCode
+		if apiResp.ErrorCode != 0 {
+			status = apiResp.ErrorCode
+		}
+		errMsg := fmt.Sprintf("telegram API error (status %d)", status)
+		if apiResp.Description != "" {
+			errMsg += ": " + apiResp.Description
+		}
+		if status == http.StatusTooManyRequests && apiResp.Parameters.RetryAfter > 0 {
+			return nil, types.RateLimited(errors.New(errMsg), time.Duration(apiResp.Parameters.RetryAfter)*time.Second)
+		}
+		return nil, types.ClassifyHTTPStatus(status, resp.Header, errors.New(errMsg))
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
+	}
+
+	message := &MessageResponse{
+		MessageID:      apiResp.Result.MessageID,
+		ChatID:         apiResp.Result.Chat.ID,
+		DocumentFileID: apiResp.Result.Document.FileID,
+	}
+
+	logger.Info(ctx, "telegram message sent successfully", logger.Fields{
+		"message_id":          payload.MessageID,
+		"telegram_message_id": message.MessageID,
+	})
+
+	return message, nil
+}
+
+// buildRequest returns the Bot API method and request for payload.
+func buildRequest(payload *types.TelegramMessagePayload) (string, sendRequest, error) {
+	chatID := bytes.TrimSpace(payload.ChatID)
+	if len(chatID) == 0 || bytes.Equal(chatID, []byte("null")) || bytes.Equal(chatID, []byte(`""`)) {
+		return "", sendRequest{}, errors.New("telegram message missing chat_id")
+	}
+	req := sendRequest{
+		ChatID:              chatID,
+		ParseMode:           payload.ParseMode,
+		DisableNotification: payload.DisableNotification,
+	}
+
+	if payload.Document == nil {
+		if payload.Text == "" {
+			return "", sendRequest{}, errors.New("telegram message needs text or a document")
+		}
+		if utf8.RuneCountInString(payload.Text) > maxTextLength {
+			return "", sendRequest{}, fmt.Errorf("telegram message text exceeds %d characters", maxTextLength)
+		}
+		req.Text = payload.Text
+		return "sendMessage", req, nil
+	}
+
+	switch {
+	case payload.Document.TelegramFileID != "":
+		req.Document = payload.Document.TelegramFileID
+	case payload.Document.URL != "":
+		req.Document = payload.Document.URL
+	default:
+		return "", sendRequest{}, errors.New("telegram document needs a url or telegram_file_id")
+	}
+	if utf8.RuneCountInString(payload.Text) > maxCaptionLength {
+		return "", sendRequest{}, fmt.Errorf("telegram document caption exceeds %d characters", maxCaptionLength)
+	}
+	req.Caption = payload.Text
+	return "sendDocument", req, nil
+}
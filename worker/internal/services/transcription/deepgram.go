@@ -0,0 +1,116 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	deepgramAPIURL = "https://api.deepgram.com/v1/listen"
+	deepgramModel  = "nova-3"
+)
+
+// DeepgramConfig configures the Deepgram provider. CallbackURL is where
+// Deepgram posts the transcript: the public URL of
+// api.deepgram_transcription_webhook.
+type DeepgramConfig struct {
+	APIKey      string
+	CallbackURL string
+}
+
+// DeepgramProvider transcribes through Deepgram's pre-recorded audio API
+// with a callback: Deepgram fetches the audio from the signed URL and posts
+// the result to CallbackURL, signed with the dg-token header.
+type DeepgramProvider struct {
+	config     DeepgramConfig
+	httpClient *http.Client
+}
+
+// DeepgramResponse is Deepgram's answer to a request with a callback.
+type DeepgramResponse struct {
+	RequestID string `json:"request_id"`
+}
+
+// NewDeepgramProvider returns a Deepgram client whose calls are throttled
+// by limiter and refused while circuit is open.
+func NewDeepgramProvider(config DeepgramConfig, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *DeepgramProvider {
+	return &DeepgramProvider{
+		config: config,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *DeepgramProvider) Name() string { return ProviderDeepgram }
+
+// Kickoff asks Deepgram to transcribe the audio at r.AudioURL and post the
+// result to the callback URL, which is matched to the attempt by the request
+// id returned here. The attempt id is sent as a tag for Deepgram's usage
+// reports.
+func (p *DeepgramProvider) Kickoff(ctx context.Context, r *Request) (*types.TranscriptionKickoffResult, error) {
+	if p.config.APIKey == "" {
+		return nil, types.Permanent(errors.New("DEEPGRAM_API_KEY is required"))
+	}
+	if p.config.CallbackURL == "" {
+		return nil, types.Permanent(errors.New("DEEPGRAM_CALLBACK_URL is required"))
+	}
+
+	model := deepgramModel
+	if r.Model != "" {
+		model = r.Model
+	}
+	query := url.Values{
+		"model":           {model},
+		"callback":        {p.config.CallbackURL},
+		"callback_method": {http.MethodPost},
+		"smart_format":    {"true"},
+		"punctuate":       {"true"},
+		"detect_language": {"true"},
+		"tag":             {"recording_transcription_attempt_id:" + strconv.FormatInt(r.AttemptID, 10)},
+	}
+	if r.LanguageCode != "" {
+		query.Del("detect_language")
+		query.Set("language", r.LanguageCode)
+	}
+
+	body, err := json.Marshal(map[string]string{"url": r.AudioURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, deepgramAPIURL+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Token "+p.config.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info(ctx, "calling Deepgram listen API", logger.Fields{
+		"model": model,
+	})
+
+	var result DeepgramResponse
+	if err := do(p.httpClient, req, &result); err != nil {
+		return nil, err
+	}
+	if result.RequestID == "" {
+		return nil, fmt.Errorf("Deepgram response missing request_id")
+	}
+
+	return &types.TranscriptionKickoffResult{RequestID: result.RequestID, Model: model}, nil
+}
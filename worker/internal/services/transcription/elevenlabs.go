@@ -0,0 +1,207 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	elevenLabsAPIURL = "https://api.elevenlabs.io/v1/speech-to-text"
+	elevenLabsModel  = "scribe_v2"
+)
+
+// ErrTranscriptNotReady reports a transcript ElevenLabs has not finished yet.
+var ErrTranscriptNotReady = errors.New("transcript not ready")
+
+// ElevenLabsProvider transcribes through the ElevenLabs speech-to-text API
+// with webhook=true; the transcript is posted to the webhook configured in
+// the ElevenLabs dashboard (api.eleven_labs_transcription_webhook).
+type ElevenLabsProvider struct {
+	apiKey     string
+	httpClient *http.Client
+	// interactiveModel replaces elevenLabsModel for interactive requests
+	// when set.
+	interactiveModel string
+}
+
+// NewElevenLabsProvider returns an ElevenLabs client whose calls are
+// throttled by limiter and refused while circuit is open.
+func NewElevenLabsProvider(apiKey, interactiveModel string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *ElevenLabsProvider {
+	return &ElevenLabsProvider{
+		apiKey:           apiKey,
+		interactiveModel: interactiveModel,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second, // Short timeout - just kickoff, not waiting for result
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *ElevenLabsProvider) Name() string { return ProviderElevenLabs }
+
+// Kickoff calls the ElevenLabs speech-to-text API with webhook=true.
+// It uses multipart/form-data as required by the API.
+func (p *ElevenLabsProvider) Kickoff(ctx context.Context, r *Request) (*types.TranscriptionKickoffResult, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("ELEVENLABS_API_KEY is required"))
+	}
+
+	model := elevenLabsModel
+	switch {
+	case r.Model != "":
+		model = r.Model
+	case r.Interactive && p.interactiveModel != "":
+		model = p.interactiveModel
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	// Required fields
+	if err := writer.WriteField("model_id", model); err != nil {
+		return nil, fmt.Errorf("failed to write model_id: %w", err)
+	}
+
+	if err := writer.WriteField("cloud_storage_url", r.AudioURL); err != nil {
+		return nil, fmt.Errorf("failed to write cloud_storage_url: %w", err)
+	}
+
+	// Enable webhook mode
+	if err := writer.WriteField("webhook", "true"); err != nil {
+		return nil, fmt.Errorf("failed to write webhook: %w", err)
+	}
+
+	// Include attempt ID in webhook metadata for correlation
+	webhookMetadata, err := json.Marshal(map[string]int64{
+		"recording_transcription_attempt_id": r.AttemptID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook metadata: %w", err)
+	}
+	if err := writer.WriteField("webhook_metadata", string(webhookMetadata)); err != nil {
+		return nil, fmt.Errorf("failed to write webhook_metadata: %w", err)
+	}
+
+	// Optional settings for better transcription
+	if err := writer.WriteField("tag_audio_events", "true"); err != nil {
+		return nil, fmt.Errorf("failed to write tag_audio_events: %w", err)
+	}
+
+	if err := writer.WriteField("timestamps_granularity", "word"); err != nil {
+		return nil, fmt.Errorf("failed to write timestamps_granularity: %w", err)
+	}
+
+	// Without a language ElevenLabs detects it
+	if r.LanguageCode != "" {
+		if err := writer.WriteField("language_code", r.LanguageCode); err != nil {
+			return nil, fmt.Errorf("failed to write language_code: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, elevenLabsAPIURL, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("xi-api-key", p.apiKey)
+
+	logger.Info(ctx, "calling ElevenLabs speech-to-text API", logger.Fields{
+		"model": model,
+	})
+
+	var result types.ElevenLabsAsyncResponse
+	if err := do(p.httpClient, req, &result); err != nil {
+		return nil, err
+	}
+	if result.RequestID == "" {
+		return nil, fmt.Errorf("ElevenLabs response missing request_id")
+	}
+
+	return &types.TranscriptionKickoffResult{RequestID: result.RequestID, Model: model}, nil
+}
+
+// Transcript fetches the transcript of a request kicked off with
+// webhook=true, as ElevenLabs returns it (the body its webhook carries under
+// data.transcription). It returns ErrTranscriptNotReady while the request is
+// still being transcribed.
+func (p *ElevenLabsProvider) Transcript(ctx context.Context, requestID string) (json.RawMessage, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("ELEVENLABS_API_KEY is required"))
+	}
+	if requestID == "" {
+		return nil, types.Permanent(errors.New("request_id is required"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, elevenLabsAPIURL+"/transcripts/"+url.PathEscape(requestID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("xi-api-key", p.apiKey)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// ElevenLabs answers 404 until the transcript exists.
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTranscriptNotReady
+	}
+	if resp.StatusCode >= 400 {
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("API returned %d: %s", resp.StatusCode, string(body)))
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("failed to parse response: invalid JSON")
+	}
+	return body, nil
+}
+
+// do sends req and decodes a successful JSON response into out, classifying
+// failed calls by their status.
+func do(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return types.Retryable(fmt.Errorf("request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("API returned %d: %s", resp.StatusCode, string(body)))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
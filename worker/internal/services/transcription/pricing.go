@@ -0,0 +1,67 @@
+package transcription
+
+import (
+	"math"
+	"strings"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Pricing is the price of transcription in USD per minute of audio, keyed by
+// provider or by provider/model (e.g. whisper/gpt-4o-mini-transcribe). A
+// model's price is used over its provider's.
+type Pricing map[string]float64
+
+// DefaultPricing holds the providers' list prices for pay-as-you-go
+// transcription of prerecorded audio. Negotiated prices are set with
+// WORKER_TRANSCRIPTION_PRICES.
+var DefaultPricing = Pricing{
+	ProviderElevenLabs: 0.0067, // $0.40 per hour
+	ProviderDeepgram:   0.0043,
+	ProviderWhisper:    0.006,
+
+	// Models priced differently from their provider's default
+	ProviderWhisper + "/gpt-4o-mini-transcribe": 0.003,
+}
+
+// With returns a copy of p with prices replaced or added by overrides.
+func (p Pricing) With(overrides map[string]float64) Pricing {
+	merged := make(Pricing, len(p)+len(overrides))
+	for key, price := range p {
+		merged[key] = price
+	}
+	for key, price := range overrides {
+		merged[strings.ToLower(key)] = price
+	}
+	return merged
+}
+
+// PerMinute returns the price per minute of provider's model, or of the
+// provider when the model has none, and whether there is one.
+func (p Pricing) PerMinute(provider, model string) (float64, bool) {
+	if model != "" {
+		if price, ok := p[provider+"/"+strings.ToLower(model)]; ok {
+			return price, true
+		}
+	}
+	price, ok := p[provider]
+	return price, ok
+}
+
+// apply sets result's duration, from durationSeconds unless the provider
+// reported one, its price and the cost of the duration at that price,
+// rounded to a millionth of a dollar.
+func (p Pricing) apply(result *types.TranscriptionKickoffResult, durationSeconds *float64) {
+	if result.DurationSeconds == nil {
+		result.DurationSeconds = durationSeconds
+	}
+	price, ok := p.PerMinute(result.Provider, result.Model)
+	if !ok {
+		return
+	}
+	result.PricePerMinuteUSD = &price
+	if result.DurationSeconds != nil {
+		cost := math.Round(*result.DurationSeconds/60*price*1e6) / 1e6
+		result.CostUSD = &cost
+	}
+}
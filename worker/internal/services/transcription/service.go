@@ -0,0 +1,171 @@
+// Package transcription kicks off speech-to-text requests. Asynchronous
+// providers answer with a request id at once and post the transcript to a
+// callback later, which Postgres stores and its supervisor verifies;
+// synchronous ones (Whisper) return the transcript itself (see
+// docs/worker/transcription.md).
+package transcription
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Provider names, as configured in WORKER_TRANSCRIPTION_PROVIDER and
+// WORKER_TRANSCRIPTION_FALLBACK_PROVIDER, chosen per task with the
+// payload's provider, and reported in TranscriptionKickoffResult.Provider.
+const (
+	ProviderElevenLabs = "elevenlabs"
+	ProviderDeepgram   = "deepgram"
+	ProviderWhisper    = "whisper"
+)
+
+// TranscriptionProvider starts one asynchronous transcription.
+// Implementations classify their errors with the types error classes, which
+// decide whether the fallback is tried.
+type TranscriptionProvider interface {
+	Name() string
+	Kickoff(ctx context.Context, req *Request) (*types.TranscriptionKickoffResult, error)
+}
+
+// Request is a recording to transcribe. The attempt id goes with the
+// request so the callback can be matched to it. Asynchronous providers
+// fetch the audio from AudioURL; synchronous ones read FileID.
+type Request struct {
+	AttemptID int64  `json:"recording_transcription_attempt_id"`
+	FileID    int64  `json:"file_id"`
+	AudioURL  string `json:"audio_url"`
+	// DurationSeconds is the recording's length, or nil when unknown.
+	DurationSeconds *float64 `json:"duration_seconds,omitempty"`
+	// Provider names the provider to use instead of the one the Service
+	// would choose. Model replaces the provider's default model.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// LanguageCode is the spoken language (ISO 639-1), or empty to have the
+	// provider detect it.
+	LanguageCode string `json:"language_code,omitempty"`
+	// Interactive asks for the provider's low-latency model, when it has
+	// one configured and no Model is given.
+	Interactive bool `json:"interactive,omitempty"`
+}
+
+// Service kicks off transcriptions through a primary provider, failing over
+// to an optional fallback.
+type Service struct {
+	primary  TranscriptionProvider
+	fallback TranscriptionProvider
+	byName   map[string]TranscriptionProvider
+	// short takes recordings known to be at most shortMaxSeconds long.
+	short           TranscriptionProvider
+	shortMaxSeconds float64
+	pricing         Pricing
+}
+
+// NewService returns a Service kicking off through primary, and through
+// fallback (which may be nil) when the provider fails with a retryable,
+// rate-limited or unavailable error. Recordings known to be at most
+// shortMaxSeconds long go to short instead of primary, when both are set;
+// a synchronous provider there spares short recordings the callback round
+// trip. Requests may name any of primary, fallback and short as their
+// provider. Results are priced with pricing.
+func NewService(primary, fallback, short TranscriptionProvider, shortMaxSeconds float64, pricing Pricing) *Service {
+	byName := make(map[string]TranscriptionProvider)
+	for _, p := range []TranscriptionProvider{primary, fallback, short} {
+		if p != nil {
+			if _, ok := byName[p.Name()]; !ok {
+				byName[p.Name()] = p
+			}
+		}
+	}
+	return &Service{primary: primary, fallback: fallback, byName: byName, short: short, shortMaxSeconds: shortMaxSeconds, pricing: pricing}
+}
+
+// Provider is the name of the provider req would be sent to first.
+func (s *Service) Provider(req *Request) string {
+	if provider, err := s.choose(req); err == nil {
+		return provider.Name()
+	}
+	return req.Provider
+}
+
+// choose returns the provider req names, or else the short provider for a
+// short enough recording, or else the primary.
+func (s *Service) choose(req *Request) (TranscriptionProvider, error) {
+	if req.Provider != "" {
+		provider, ok := s.byName[req.Provider]
+		if !ok {
+			return nil, types.Permanent(fmt.Errorf("unknown transcription provider %q", req.Provider))
+		}
+		return provider, nil
+	}
+	if s.short != nil && s.shortMaxSeconds > 0 && req.DurationSeconds != nil && *req.DurationSeconds <= s.shortMaxSeconds {
+		return s.short, nil
+	}
+	return s.primary, nil
+}
+
+// Kickoff starts transcribing req, failing over to the fallback provider
+// when the chosen provider's failure is transient. A permanent failure
+// (e.g. an unreadable file) is returned as is, as the fallback would refuse
+// it too.
+func (s *Service) Kickoff(ctx context.Context, req *Request) (*types.TranscriptionKickoffResult, error) {
+	if req == nil {
+		return nil, fmt.Errorf("transcription request is nil")
+	}
+	provider, err := s.choose(req)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "kicking off transcription", logger.Fields{
+		"attempt_id": req.AttemptID,
+		"provider":   provider.Name(),
+	})
+
+	result, err := s.kickoff(ctx, provider, req)
+	if err != nil && s.fallback != nil && s.fallback != provider && failoverable(err) {
+		logger.Warn(ctx, "transcription provider failed; trying fallback", logger.Fields{
+			"attempt_id": req.AttemptID,
+			"provider":   provider.Name(),
+			"fallback":   s.fallback.Name(),
+			"error":      err.Error(),
+		})
+		// A model belongs to the provider that was asked for.
+		fallbackReq := *req
+		fallbackReq.Model = ""
+		result, err = s.kickoff(ctx, s.fallback, &fallbackReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "transcription kicked off successfully", logger.Fields{
+		"attempt_id":  req.AttemptID,
+		"provider":    result.Provider,
+		"request_id":  result.RequestID,
+		"synchronous": result.Transcript != nil,
+		"cost_usd":    result.CostUSD,
+	})
+
+	return result, nil
+}
+
+func (s *Service) kickoff(ctx context.Context, provider TranscriptionProvider, req *Request) (*types.TranscriptionKickoffResult, error) {
+	result, err := provider.Kickoff(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", provider.Name(), err)
+	}
+	result.Provider = provider.Name()
+	s.pricing.apply(result, req.DurationSeconds)
+	return result, nil
+}
+
+func failoverable(err error) bool {
+	switch types.ErrorClass(err) {
+	case types.ErrRetryable, types.ErrRateLimited, types.ErrUnavailable:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package transcription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	whisperAPIURL = "https://api.openai.com/v1/audio/transcriptions"
+	whisperModel  = "whisper-1"
+	// whisperMaxBytes is the largest file the transcriptions API accepts.
+	whisperMaxBytes = 25 << 20
+)
+
+// OpenFunc opens a stored file's contents by id; files.Service.OpenFile.
+type OpenFunc func(ctx context.Context, fileID int64) (io.ReadCloser, error)
+
+// WhisperProvider transcribes synchronously through OpenAI's audio
+// transcriptions API: the worker downloads the recording, uploads it and
+// gets the transcript back in the same call, so it suits short recordings
+// only.
+type WhisperProvider struct {
+	apiKey     string
+	open       OpenFunc
+	httpClient *http.Client
+}
+
+// whisperResponse is the verbose_json transcription with word timestamps
+// and the audio's duration, or the json one with the text alone.
+type whisperResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Words    []struct {
+		Word  string  `json:"word"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	} `json:"words"`
+}
+
+// NewWhisperProvider returns a Whisper client reading recordings with open,
+// whose calls are throttled by limiter and refused while circuit is open.
+func NewWhisperProvider(apiKey string, open OpenFunc, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *WhisperProvider {
+	return &WhisperProvider{
+		apiKey: apiKey,
+		open:   open,
+		httpClient: &http.Client{
+			Timeout:   5 * time.Minute, // the transcript comes back in the response
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+func (p *WhisperProvider) Name() string { return ProviderWhisper }
+
+// Kickoff transcribes the recording r.FileID and returns its transcript.
+// The request id is OpenAI's x-request-id, or one derived from the attempt
+// when the response has none. Recordings over the API's 25 MB limit fail
+// permanently.
+func (p *WhisperProvider) Kickoff(ctx context.Context, r *Request) (*types.TranscriptionKickoffResult, error) {
+	if p.apiKey == "" {
+		return nil, types.Permanent(errors.New("OPENAI_API_KEY is required"))
+	}
+
+	audio, err := p.download(ctx, r.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	model := whisperModel
+	if r.Model != "" {
+		model = r.Model
+	}
+	fields := [][2]string{{"model", model}}
+	// Only whisper models return word timestamps (verbose_json); the
+	// others (gpt-4o-transcribe) return the text alone.
+	if strings.HasPrefix(model, "whisper") {
+		fields = append(fields, [2]string{"response_format", "verbose_json"}, [2]string{"timestamp_granularities[]", "word"})
+	} else {
+		fields = append(fields, [2]string{"response_format", "json"})
+	}
+	if r.LanguageCode != "" {
+		fields = append(fields, [2]string{"language", r.LanguageCode})
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", field[0], err)
+		}
+	}
+	// The API reads the format from the file name's extension; recordings
+	// are uploaded as audio/mp4.
+	file, err := writer.CreateFormFile("file", "recording.m4a")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file part: %w", err)
+	}
+	file.Write(audio)
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, whisperAPIURL, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	logger.Info(ctx, "calling OpenAI audio transcriptions API", logger.Fields{
+		"model": model,
+		"bytes": len(audio),
+	})
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, fmt.Errorf("API returned %d: %s", resp.StatusCode, string(body)))
+	}
+
+	var result whisperResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	transcript := &types.Transcript{
+		Text:         result.Text,
+		Words:        make([]types.TranscriptWord, len(result.Words)),
+		LanguageCode: result.Language,
+	}
+	for i, w := range result.Words {
+		transcript.Words[i] = types.TranscriptWord{Text: w.Word, Start: w.Start, End: w.End, Type: "word"}
+	}
+
+	requestID := resp.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = "whisper_" + strconv.FormatInt(r.AttemptID, 10)
+	}
+	kickoff := &types.TranscriptionKickoffResult{RequestID: requestID, Model: model, Transcript: transcript}
+	if result.Duration > 0 {
+		kickoff.DurationSeconds = &result.Duration
+	}
+	return kickoff, nil
+}
+
+// download reads the recording, refusing files over whisperMaxBytes.
+func (p *WhisperProvider) download(ctx context.Context, fileID int64) ([]byte, error) {
+	body, err := p.open(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer body.Close()
+
+	audio, err := io.ReadAll(io.LimitReader(body, whisperMaxBytes+1))
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to download recording: %w", err))
+	}
+	if len(audio) > whisperMaxBytes {
+		return nil, types.Permanent(fmt.Errorf("recording is over the %d MB whisper limit", whisperMaxBytes>>20))
+	}
+	return audio, nil
+}
@@ -0,0 +1,196 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const baseURL = "https://verify.twilio.com/v2/Services/"
+
+// Twilio error codes with a meaning of their own.
+const (
+	codeNotFound         = 20404 // the verification expired, was approved or never existed
+	codeMaxCheckAttempts = 60202
+	codeMaxSendAttempts  = 60203
+)
+
+// Check statuses reported for those codes instead of an error.
+const (
+	statusExpired          = "expired"
+	statusMaxCheckAttempts = "max_attempts_reached"
+)
+
+var validChannels = map[string]bool{"sms": true, "call": true, "whatsapp": true}
+
+type Service struct {
+	accountSID string
+	authToken  string
+	serviceSID string
+	httpClient *http.Client
+}
+
+type verification struct {
+	SID     string `json:"sid"`
+	Status  string `json:"status"`
+	Channel string `json:"channel"`
+	Valid   bool   `json:"valid"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewService returns a Twilio Verify client for the Verify service
+// serviceSID, authenticated as accountSID. Calls are throttled by limiter
+// and refused while circuit is open.
+func NewService(accountSID, authToken, serviceSID string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	return &Service{
+		accountSID: accountSID,
+		authToken:  authToken,
+		serviceSID: serviceSID,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+// Send starts a verification, which has Twilio generate a code and send it
+// over payload.Channel. Sending again to a number with a pending
+// verification resends the same code.
+func (s *Service) Send(ctx context.Context, payload *types.VerifyOTPSendPayload) (*types.VerifyOTPResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("verify payload is nil")
+	}
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	channel := payload.Channel
+	if channel == "" {
+		channel = "sms"
+	}
+	if !validChannels[channel] {
+		return nil, types.Permanent(fmt.Errorf("unsupported verify channel %q", channel))
+	}
+	if payload.ToNumber == "" {
+		return nil, types.Permanent(errors.New("verify payload has no to_number"))
+	}
+
+	form := url.Values{"To": {payload.ToNumber}, "Channel": {channel}}
+	if payload.Locale != "" {
+		form.Set("Locale", payload.Locale)
+	}
+
+	logger.Info(ctx, "starting verification", logger.Fields{
+		"verification_id": payload.VerificationID,
+		"channel":         channel,
+	})
+
+	var v verification
+	apiErr, err := s.post(ctx, "/Verifications", form, &v)
+	if err != nil {
+		if apiErr != nil && apiErr.Code == codeMaxSendAttempts {
+			return nil, types.Permanent(err)
+		}
+		return nil, err
+	}
+	return &types.VerifyOTPResult{VerificationSID: v.SID, Status: v.Status, Channel: v.Channel}, nil
+}
+
+// Check checks payload.Code against its verification. A wrong code is a
+// result (status pending, not valid), as are an expired verification and
+// too many attempts; only transport and service failures are errors.
+func (s *Service) Check(ctx context.Context, payload *types.VerifyOTPCheckPayload) (*types.VerifyOTPResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("verify payload is nil")
+	}
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	if payload.Code == "" {
+		return nil, types.Permanent(errors.New("verify check has no code"))
+	}
+
+	form := url.Values{"Code": {payload.Code}}
+	switch {
+	case payload.VerificationSID != "":
+		form.Set("VerificationSid", payload.VerificationSID)
+	case payload.ToNumber != "":
+		form.Set("To", payload.ToNumber)
+	default:
+		return nil, types.Permanent(errors.New("verify check needs a verification_sid or to_number"))
+	}
+
+	var v verification
+	apiErr, err := s.post(ctx, "/VerificationCheck", form, &v)
+	if err != nil {
+		switch {
+		case apiErr != nil && apiErr.Code == codeNotFound:
+			return &types.VerifyOTPResult{VerificationSID: payload.VerificationSID, Status: statusExpired}, nil
+		case apiErr != nil && apiErr.Code == codeMaxCheckAttempts:
+			return &types.VerifyOTPResult{VerificationSID: payload.VerificationSID, Status: statusMaxCheckAttempts}, nil
+		}
+		return nil, err
+	}
+
+	logger.Info(ctx, "verification checked", logger.Fields{
+		"verification_id": payload.VerificationID,
+		"status":          v.Status,
+	})
+
+	return &types.VerifyOTPResult{VerificationSID: v.SID, Status: v.Status, Channel: v.Channel, Valid: v.Valid}, nil
+}
+
+func (s *Service) configured() error {
+	if s.accountSID == "" || s.authToken == "" || s.serviceSID == "" {
+		return types.Permanent(errors.New("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_VERIFY_SERVICE_SID are required for verification"))
+	}
+	return nil
+}
+
+// post sends form to the Verify service path and decodes the response into
+// target. Error responses are classified by status and returned with
+// Twilio's error body, when it had one.
+func (s *Service) post(ctx context.Context, path string, form url.Values, target any) (*apiError, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+s.serviceSID+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr apiError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		errMsg := fmt.Sprintf("twilio verify API error (status %d)", resp.StatusCode)
+		if apiErr.Code != 0 {
+			errMsg += fmt.Sprintf(", code %d: %s", apiErr.Code, apiErr.Message)
+		}
+		return &apiErr, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, errors.New(errMsg))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Headers set on every delivery. SignatureHeader is only set when the
+// payload carries an HMAC secret.
+const (
+	DeliveryHeader  = "X-Chatterbox-Delivery"
+	SignatureHeader = "X-Chatterbox-Signature"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	maxTimeout     = 60 * time.Second
+	// snippetBytes bounds the response body kept in the result and errors.
+	snippetBytes = 1024
+)
+
+// Service delivers webhooks to arbitrary receivers. Unlike the provider
+// clients it has no shared rate limit or circuit breaker: one slow receiver
+// must not hold back deliveries to the others.
+type Service struct {
+	httpClient *http.Client
+}
+
+func NewService() *Service {
+	return &Service{
+		httpClient: &http.Client{
+			Transport: events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)),
+			// Redirects are not followed, so a signed request is only ever
+			// sent to the URL the database chose.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Deliver sends payload's request. deliveryID identifies the delivery across
+// retries (the task id), so receivers can drop duplicates.
+//
+// With an HMAC secret the request carries
+// "X-Chatterbox-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+//
+// A 2xx response is a success. Other responses fail with the status and the
+// start of the body, classified like provider errors, so 5xx and 429 are
+// retried by the worker and other 4xx are not.
+func (s *Service) Deliver(ctx context.Context, deliveryID string, payload *types.WebhookPayload) (*types.WebhookResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("webhook payload is nil")
+	}
+	target, err := url.Parse(payload.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, types.Permanent(fmt.Errorf("invalid webhook url %q", payload.URL))
+	}
+	method := strings.ToUpper(payload.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	body, err := requestBody(payload.Body)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+
+	timeout := defaultTimeout
+	if payload.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(payload.TimeoutSeconds)*time.Second, maxTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, types.Permanent(fmt.Errorf("failed to create webhook request: %w", err))
+	}
+	if len(body) > 0 && !hasHeader(payload.Headers, "Content-Type") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range payload.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(DeliveryHeader, deliveryID)
+	if payload.HMACSecret != "" {
+		req.Header.Set(SignatureHeader, Sign(payload.HMACSecret, time.Now(), body))
+	}
+
+	logger.Info(ctx, "delivering webhook", logger.Fields{
+		"method": method,
+		"host":   target.Host,
+		"path":   target.Path,
+	})
+
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to deliver webhook: %w", err))
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, snippetBytes))
+
+	result := &types.WebhookResult{
+		StatusCode:  resp.StatusCode,
+		LatencyMS:   time.Since(start).Milliseconds(),
+		BodySnippet: strings.ToValidUTF8(string(snippet), ""),
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook receiver returned status %d", resp.StatusCode)
+		if result.BodySnippet != "" {
+			err = fmt.Errorf("%w: %s", err, result.BodySnippet)
+		}
+		return nil, types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)
+	}
+
+	logger.Info(ctx, "webhook delivered", logger.Fields{
+		"host":        target.Host,
+		"status_code": result.StatusCode,
+		"latency_ms":  result.LatencyMS,
+	})
+
+	return result, nil
+}
+
+// Sign returns the signature header value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestBody returns the bytes to send for raw: the content of a JSON
+// string, or the JSON itself for any other value.
+func requestBody(raw json.RawMessage) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, nil
+	}
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, fmt.Errorf("invalid webhook body: %w", err)
+		}
+		return []byte(s), nil
+	}
+	if !json.Valid(trimmed) {
+		return nil, errors.New("invalid webhook body: not JSON")
+	}
+	return trimmed, nil
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	// maxSubscriptions bounds the browsers one task notifies.
+	maxSubscriptions = 500
+	// sendConcurrency is how many subscriptions are sent to at once.
+	sendConcurrency = 10
+	// defaultTTL applies when the payload sets none; the TTL header is
+	// required.
+	defaultTTL = 24 * time.Hour
+)
+
+var validUrgencies = map[string]bool{"very-low": true, "low": true, "normal": true, "high": true}
+
+type Service struct {
+	vapid      *vapid
+	configErr  error
+	httpClient *http.Client
+}
+
+// NewService returns a Web Push client identifying itself with the VAPID
+// privateKey and subject (a mailto: or https: contact). Sends are throttled
+// by limiter and refused while circuit is open. When the keys are missing or
+// invalid every send fails permanently.
+func NewService(subject, privateKey string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	s := &Service{
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+	if subject == "" || privateKey == "" {
+		s.configErr = errors.New("VAPID_SUBJECT and VAPID_PRIVATE_KEY are required for web push")
+		return s
+	}
+	s.vapid, s.configErr = newVAPID(subject, privateKey)
+	return s
+}
+
+// subscriptionOutcome is the result of sending to one subscription.
+type subscriptionOutcome struct {
+	expired bool
+	err     error
+	// transient marks a failure worth retrying the task for.
+	transient bool
+	// fatal marks an error about the message itself (too large), which
+	// fails the task. A rejected VAPID token is per subscription, as a
+	// subscription made with another application server key is rejected
+	// the same way.
+	fatal bool
+}
+
+// Send encrypts payload.Data for each subscription and posts it to the
+// subscription's push service. Subscriptions answered 404 or 410 are
+// reported in ExpiredSubscriptions. The task fails when the message is
+// rejected as too large, or when no browser could be reached and
+// at least one failure was transient, so it is retried; otherwise it
+// succeeds and the other failures are listed in FailedSubscriptions.
+func (s *Service) Send(ctx context.Context, payload *types.WebPushPayload) (*types.WebPushResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("web push payload is nil")
+	}
+	if s.configErr != nil {
+		return nil, types.Permanent(s.configErr)
+	}
+	if len(payload.Subscriptions) == 0 {
+		return nil, types.Permanent(errors.New("web push has no subscriptions"))
+	}
+	if len(payload.Subscriptions) > maxSubscriptions {
+		return nil, types.Permanent(fmt.Errorf("web push has more than %d subscriptions", maxSubscriptions))
+	}
+	if len(payload.Data) == 0 {
+		return nil, types.Permanent(errors.New("web push has no data"))
+	}
+	if len(payload.Data) > maxPlaintextLen {
+		return nil, types.Permanent(fmt.Errorf("web push data exceeds %d bytes", maxPlaintextLen))
+	}
+	if payload.Urgency != "" && !validUrgencies[payload.Urgency] {
+		return nil, types.Permanent(fmt.Errorf("invalid web push urgency %q", payload.Urgency))
+	}
+
+	logger.Info(ctx, "sending web push", logger.Fields{
+		"message_id":    payload.MessageID,
+		"subscriptions": len(payload.Subscriptions),
+	})
+
+	outcomes := make([]subscriptionOutcome, len(payload.Subscriptions))
+	sem := make(chan struct{}, sendConcurrency)
+	var wg sync.WaitGroup
+	for i, sub := range payload.Subscriptions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outcomes[i] = s.sendOne(ctx, sub, payload)
+		}()
+	}
+	wg.Wait()
+
+	result := &types.WebPushResult{}
+	var transient error
+	for i, outcome := range outcomes {
+		endpoint := payload.Subscriptions[i].Endpoint
+		switch {
+		case outcome.fatal:
+			return nil, outcome.err
+		case outcome.expired:
+			result.ExpiredSubscriptions = append(result.ExpiredSubscriptions, endpoint)
+		case outcome.err != nil:
+			result.FailedSubscriptions = append(result.FailedSubscriptions, endpoint)
+			if outcome.transient && transient == nil {
+				transient = outcome.err
+			}
+		default:
+			result.Sent++
+		}
+	}
+	if result.Sent == 0 && transient != nil {
+		return nil, transient
+	}
+
+	logger.Info(ctx, "web push sent", logger.Fields{
+		"message_id":            payload.MessageID,
+		"sent":                  result.Sent,
+		"expired_subscriptions": len(result.ExpiredSubscriptions),
+		"failed_subscriptions":  len(result.FailedSubscriptions),
+	})
+
+	return result, nil
+}
+
+func (s *Service) sendOne(ctx context.Context, sub types.WebPushSubscription, payload *types.WebPushPayload) subscriptionOutcome {
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" {
+		// Not a push service endpoint; it can never be delivered to.
+		return subscriptionOutcome{expired: true, err: errors.New("web push endpoint is not an https URL")}
+	}
+	body, err := encrypt(payload.Data, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		return subscriptionOutcome{expired: true, err: err}
+	}
+	authorization, err := s.vapid.Authorization(sub.Endpoint)
+	if err != nil {
+		return subscriptionOutcome{expired: true, err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return subscriptionOutcome{expired: true, err: fmt.Errorf("failed to create HTTP request: %w", err)}
+	}
+	ttl := defaultTTL
+	if payload.TTLSeconds > 0 {
+		ttl = time.Duration(payload.TTLSeconds) * time.Second
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	if payload.Urgency != "" {
+		req.Header.Set("Urgency", payload.Urgency)
+	}
+	if payload.Topic != "" {
+		req.Header.Set("Topic", payload.Topic)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return subscriptionOutcome{err: types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err)), transient: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return subscriptionOutcome{}
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("push service error (status %d): %s", resp.StatusCode, bytes.TrimSpace(respBody))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return subscriptionOutcome{expired: true, err: err}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return subscriptionOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err), transient: true}
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return subscriptionOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err), fatal: true}
+	default:
+		return subscriptionOutcome{err: types.ClassifyHTTPStatus(resp.StatusCode, resp.Header, err)}
+	}
+}
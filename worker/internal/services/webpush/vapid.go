@@ -0,0 +1,112 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// vapidLifetime is the exp of a VAPID JWT; push services reject more
+	// than 24 hours.
+	vapidLifetime = 12 * time.Hour
+	// vapidRefresh renews a cached JWT well before it expires.
+	vapidRefresh = 11 * time.Hour
+)
+
+// vapid signs the per push service VAPID (RFC 8292) tokens identifying the
+// application server.
+type vapid struct {
+	subject   string
+	key       *ecdsa.PrivateKey
+	publicKey string // base64url uncompressed point, sent as k=
+
+	mu     sync.Mutex
+	tokens map[string]vapidToken // by audience (push service origin)
+}
+
+type vapidToken struct {
+	token    string
+	issuedAt time.Time
+}
+
+// newVAPID parses privateKey, the base64url 32-byte P-256 scalar printed by
+// the usual VAPID key generators, and derives its public key.
+func newVAPID(subject, privateKey string) (*vapid, error) {
+	raw, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	public := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return &vapid{
+		subject:   subject,
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(public),
+		tokens:    map[string]vapidToken{},
+	}, nil
+}
+
+// Authorization returns the Authorization header for a request to
+// endpoint.
+func (v *vapid) Authorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid web push endpoint")
+	}
+	audience := u.Scheme + "://" + u.Host
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cached, ok := v.tokens[audience]
+	if !ok || time.Since(cached.issuedAt) >= vapidRefresh {
+		now := time.Now()
+		token, err := v.sign(audience, now)
+		if err != nil {
+			return "", err
+		}
+		cached = vapidToken{token: token, issuedAt: now}
+		v.tokens[audience] = cached
+	}
+	return "vapid t=" + cached.token + ", k=" + v.publicKey, nil
+}
+
+func (v *vapid) sign(audience string, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	claims, _ := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": now.Add(vapidLifetime).Unix(),
+		"sub": v.subject,
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, v.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
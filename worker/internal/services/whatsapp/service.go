@@ -0,0 +1,220 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const apiBaseURL = "https://graph.facebook.com/v21.0/"
+
+// Cloud API error codes that mean "slow down". WhatsApp reports them with a
+// 400 status rather than a 429.
+var rateLimitCodes = map[int]bool{
+	4:      true, // application request limit
+	80007:  true, // WhatsApp Business Account rate limit
+	130429: true, // throughput limit
+	131048: true, // spam rate limit
+	131056: true, // pair rate limit: too many messages to one recipient
+}
+
+type Service struct {
+	accessToken   string
+	phoneNumberID string
+	httpClient    *http.Client
+}
+
+type sendRequest struct {
+	MessagingProduct string          `json:"messaging_product"`
+	To               string          `json:"to"`
+	Type             string          `json:"type"`
+	Template         templateRequest `json:"template"`
+}
+
+type templateRequest struct {
+	Name     string `json:"name"`
+	Language struct {
+		Code string `json:"code"`
+	} `json:"language"`
+	Components json.RawMessage `json:"components,omitempty"`
+}
+
+type component struct {
+	Type       string      `json:"type"`
+	Parameters []parameter `json:"parameters"`
+}
+
+type parameter struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type sendResponse struct {
+	Contacts []struct {
+		WaID string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []struct {
+		ID            string `json:"id"`
+		MessageStatus string `json:"message_status"`
+	} `json:"messages"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message   string `json:"message"`
+		Code      int    `json:"code"`
+		ErrorData struct {
+			Details string `json:"details"`
+		} `json:"error_data"`
+	} `json:"error"`
+}
+
+// NewService returns a WhatsApp Business Cloud API client sending from the
+// business phone number phoneNumberID. Calls are throttled by limiter and
+// refused while circuit is open.
+func NewService(accessToken, phoneNumberID string, limiter *ratelimit.Limiter, circuit *breaker.Breaker) *Service {
+	return &Service{
+		accessToken:   accessToken,
+		phoneNumberID: phoneNumberID,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: circuit.Transport(limiter.Transport(events.NewTransport(otelhttp.NewTransport(http.DefaultTransport)))),
+		},
+	}
+}
+
+// SendTemplate sends payload's template message. WhatsApp accepting the
+// message is a success; delivery is reported later, to the business's
+// webhook.
+func (s *Service) SendTemplate(ctx context.Context, payload *types.WhatsAppMessagePayload) (*types.WhatsAppMessageResult, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("whatsapp message payload is nil")
+	}
+	if s.accessToken == "" || s.phoneNumberID == "" {
+		return nil, types.Permanent(errors.New("WHATSAPP_ACCESS_TOKEN and WHATSAPP_PHONE_NUMBER_ID are required for whatsapp messages"))
+	}
+	req, err := buildRequest(payload)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+
+	logger.Info(ctx, "sending whatsapp message", logger.Fields{
+		"message_id": payload.MessageID,
+		"template":   payload.Template,
+	})
+
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal whatsapp request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBaseURL+s.phoneNumberID+"/messages", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.accessToken)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, types.Retryable(fmt.Errorf("failed to send HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		errMsg := fmt.Sprintf("whatsapp API error (status %d)", resp.StatusCode)
+		if errResp.Error.Code != 0 {
+			errMsg += fmt.Sprintf(", code %d: %s", errResp.Error.Code, errResp.Error.Message)
+			if errResp.Error.ErrorData.Details != "" {
+				errMsg += " (" + errResp.Error.ErrorData.Details + ")"
+			}
+		}
+		status := resp.StatusCode
+		if rateLimitCodes[errResp.Error.Code] {
+			status = http.StatusTooManyRequests
+		}
+		return nil, types.ClassifyHTTPStatus(status, resp.Header, errors.New(errMsg))
+	}
+
+	var sendResp sendResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sendResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(sendResp.Messages) == 0 {
+		return nil, errors.New("whatsapp response has no message id")
+	}
+
+	result := &types.WhatsAppMessageResult{
+		WhatsAppMessageID: sendResp.Messages[0].ID,
+		Status:            sendResp.Messages[0].MessageStatus,
+	}
+	if len(sendResp.Contacts) > 0 {
+		result.WaID = sendResp.Contacts[0].WaID
+	}
+
+	logger.Info(ctx, "whatsapp message sent successfully", logger.Fields{
+		"message_id":          payload.MessageID,
+		"whatsapp_message_id": result.WhatsAppMessageID,
+	})
+
+	return result, nil
+}
+
+// buildRequest returns the Cloud API template message for payload.
+func buildRequest(payload *types.WhatsAppMessagePayload) (sendRequest, error) {
+	to := strings.TrimPrefix(strings.TrimSpace(payload.ToNumber), "+")
+	if to == "" {
+		return sendRequest{}, errors.New("whatsapp message missing to_number")
+	}
+	if payload.Template == "" {
+		return sendRequest{}, errors.New("whatsapp message missing template")
+	}
+	if payload.Language == "" {
+		return sendRequest{}, errors.New("whatsapp message missing language")
+	}
+
+	req := sendRequest{MessagingProduct: "whatsapp", To: to, Type: "template"}
+	req.Template.Name = payload.Template
+	req.Template.Language.Code = payload.Language
+
+	if len(payload.Components) > 0 && string(payload.Components) != "null" {
+		req.Template.Components = payload.Components
+		return req, nil
+	}
+	var components []component
+	if len(payload.HeaderParameters) > 0 {
+		components = append(components, component{Type: "header", Parameters: textParameters(payload.HeaderParameters)})
+	}
+	if len(payload.BodyParameters) > 0 {
+		components = append(components, component{Type: "body", Parameters: textParameters(payload.BodyParameters)})
+	}
+	if len(components) > 0 {
+		raw, err := json.Marshal(components)
+		if err != nil {
+			return sendRequest{}, fmt.Errorf("failed to marshal whatsapp template components: %w", err)
+		}
+		req.Template.Components = raw
+	}
+	return req, nil
+}
+
+func textParameters(values []string) []parameter {
+	parameters := make([]parameter, len(values))
+	for i, v := range values {
+		parameters[i] = parameter{Type: "text", Text: v}
+	}
+	return parameters
+}
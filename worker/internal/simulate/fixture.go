@@ -0,0 +1,51 @@
+// Package simulate runs processors locally without a database or real
+// provider credentials. Tasks come from a fixture file, handler functions
+// return the fixture's canned results, and outbound provider calls are
+// answered by mocks that record each request to disk.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Fixture is a simulation input file.
+type Fixture struct {
+	// Tasks are processed in order. A task without task_id is numbered by
+	// its position, starting at 1.
+	Tasks []types.Task `json:"tasks"`
+	// Handlers are the results handler and db_function functions return,
+	// by function name.
+	Handlers map[string]types.DBFunctionResult `json:"handlers"`
+	// Files are the contents the mock storage serves, by file id.
+	Files map[string]string `json:"files"`
+}
+
+// LoadFixture reads and parses the fixture at path.
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	for i := range fixture.Tasks {
+		task := &fixture.Tasks[i]
+		if task.TaskType == "" {
+			return nil, fmt.Errorf("fixture task %d has no task_type", i)
+		}
+		if task.TaskID == 0 {
+			task.TaskID = int64(i + 1)
+		}
+		if len(task.Payload) == 0 {
+			task.Payload = json.RawMessage(`{}`)
+		}
+	}
+	return &fixture, nil
+}
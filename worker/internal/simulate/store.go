@@ -0,0 +1,97 @@
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/bencyrus/chatterbox/worker/internal/processing"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// FunctionCall is one handler or db_function call made against a Store.
+type FunctionCall struct {
+	Function string          `json:"function"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Store is an in-memory processing.HandlerStore. Functions return the
+// fixture's result for their name, or status "succeeded" without payload when
+// the fixture has none; before handlers therefore need a fixture entry.
+type Store struct {
+	results map[string]types.DBFunctionResult
+
+	mu      sync.Mutex
+	calls   []FunctionCall
+	before  map[string]json.RawMessage
+	claimed map[string]bool
+}
+
+var _ processing.HandlerStore = (*Store)(nil)
+
+// NewStore returns a Store answering with results by function name.
+func NewStore(results map[string]types.DBFunctionResult) *Store {
+	return &Store{
+		results: results,
+		before:  make(map[string]json.RawMessage),
+		claimed: make(map[string]bool),
+	}
+}
+
+// TakeCalls returns the function calls made since the last TakeCalls.
+func (s *Store) TakeCalls() []FunctionCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func (s *Store) RunFunction(ctx context.Context, functionName string, payload json.RawMessage) (*types.DBFunctionResult, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, FunctionCall{Function: functionName, Payload: append(json.RawMessage(nil), payload...)})
+	s.mu.Unlock()
+
+	result, ok := s.results[functionName]
+	if !ok {
+		return &types.DBFunctionResult{Status: "succeeded"}, nil
+	}
+	return &result, nil
+}
+
+func (s *Store) GetBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string) (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.before[fmt.Sprintf("%d:%s", taskID, handlerName)], nil
+}
+
+func (s *Store) SaveBeforeHandlerResult(ctx context.Context, taskID int64, handlerName string, payload json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.before[fmt.Sprintf("%d:%s", taskID, handlerName)] = payload
+	return nil
+}
+
+// CountTaskErrors reports no recorded failures: every simulated task runs as
+// its first attempt.
+func (s *Store) CountTaskErrors(ctx context.Context, taskID int64) (int, error) {
+	return 0, nil
+}
+
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, taskID int64, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claimed[key] {
+		return false, nil
+	}
+	s.claimed[key] = true
+	return true, nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, taskID int64, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, key)
+	return nil
+}
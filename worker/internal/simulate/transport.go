@@ -0,0 +1,222 @@
+package simulate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Hosts the mocks answer. Storage is where the mock files service's signed
+// URLs point.
+const (
+	resendHost     = "api.resend.com"
+	elevenLabsHost = "api.elevenlabs.io"
+	deepgramHost   = "api.deepgram.com"
+	openAIHost     = "api.openai.com"
+	storageHost    = "storage.simulate.invalid"
+)
+
+// redactedHeaders carry credentials and are not written to recordings.
+var redactedHeaders = []string{"Authorization", "Xi-Api-Key", "X-File-Service-Api-Key"}
+
+// Transport is an http.RoundTripper that answers provider and files service
+// calls with canned responses instead of reaching the network, and records
+// every request as a numbered JSON file in its directory. Requests to any
+// other host get 502 so nothing leaves the machine.
+type Transport struct {
+	dir       string
+	filesHost string
+	files     map[string]string
+	seq       atomic.Int64
+}
+
+// Recording is the JSON written for each outbound request.
+type Recording struct {
+	Time     time.Time           `json:"time"`
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Header   map[string][]string `json:"header"`
+	Body     any                 `json:"body,omitempty"`
+	Status   int                 `json:"status"`
+	Response json.RawMessage     `json:"response,omitempty"`
+}
+
+// NewTransport returns a Transport that records to dir, creating it, and
+// mocks the files service at fileServiceURL. The mock storage serves files by
+// id, or a placeholder for ids not in files.
+func NewTransport(dir, fileServiceURL string, files map[string]string) (*Transport, error) {
+	u, err := url.Parse(fileServiceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid files service URL: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &Transport{dir: dir, filesHost: u.Host, files: files}, nil
+}
+
+// Install makes t the default transport. It must run before provider
+// clients are built, since they wrap http.DefaultTransport when created.
+func (t *Transport) Install() {
+	http.DefaultTransport = t
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n := t.seq.Add(1)
+	status, response := t.respond(req, body, n)
+	if err := t.record(req, body, n, status, response); err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	if json.Valid(response) {
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       req,
+	}, nil
+}
+
+// respond returns the canned status and body for req, the nth request.
+func (t *Transport) respond(req *http.Request, body []byte, n int64) (int, []byte) {
+	switch req.URL.Host {
+	case resendHost:
+		return http.StatusOK, mustJSON(map[string]string{"id": fmt.Sprintf("simulated-email-%d", n)})
+	case elevenLabsHost, deepgramHost:
+		if req.Method == http.MethodGet {
+			return http.StatusOK, mustJSON(map[string]any{"text": "simulated transcript", "language_code": "en", "language_probability": 1, "words": []any{}})
+		}
+		return http.StatusOK, mustJSON(map[string]string{"request_id": fmt.Sprintf("simulated-transcription-%d", n)})
+	case openAIHost:
+		if req.URL.Path == "/v1/audio/transcriptions" {
+			return http.StatusOK, mustJSON(map[string]any{"text": "simulated transcript", "language": "english", "words": []any{}})
+		}
+		if req.Method == http.MethodGet {
+			id := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+			return http.StatusOK, mustJSON(map[string]any{"id": id, "status": "completed", "output": []any{}})
+		}
+		return http.StatusOK, mustJSON(map[string]string{"id": fmt.Sprintf("simulated-response-%d", n), "status": "queued"})
+	case t.filesHost:
+		return t.respondFiles(req, body)
+	case storageHost:
+		fileID := strings.TrimPrefix(req.URL.Path, "/files/")
+		if req.Method == http.MethodDelete {
+			return http.StatusNoContent, nil
+		}
+		if req.Method == http.MethodPut {
+			return http.StatusOK, nil
+		}
+		if content, ok := t.files[fileID]; ok {
+			return http.StatusOK, []byte(content)
+		}
+		return http.StatusOK, []byte("simulated file " + fileID)
+	}
+	return http.StatusBadGateway, mustJSON(map[string]string{"error": "no simulated provider for host " + req.URL.Host})
+}
+
+// respondFiles mocks the files service endpoints the worker calls; signed
+// URLs point at the mock storage.
+func (t *Transport) respondFiles(req *http.Request, body []byte) (int, []byte) {
+	var parsed struct {
+		FileID         int64   `json:"file_id"`
+		Files          []int64 `json:"files"`
+		UploadIntentID int64   `json:"upload_intent_id"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return http.StatusBadRequest, mustJSON(map[string]string{"code": "invalid_json", "message": err.Error()})
+	}
+
+	switch req.URL.Path {
+	case "/signed_upload_url":
+		uploadURL := fmt.Sprintf("http://%s/uploads/%d", storageHost, parsed.UploadIntentID)
+		return http.StatusOK, mustJSON(map[string]any{"upload_url": uploadURL, "upload_headers": map[string]string{}})
+	case "/signed_delete_url":
+		return http.StatusOK, mustJSON(map[string]string{"url": storageURL(parsed.FileID)})
+	case "/signed_download_url":
+		urls := make([]map[string]any, 0, len(parsed.Files))
+		for _, id := range parsed.Files {
+			urls = append(urls, map[string]any{"file_id": id, "url": storageURL(id)})
+		}
+		return http.StatusOK, mustJSON(urls)
+	}
+	return http.StatusNotFound, mustJSON(map[string]string{"code": "not_found", "message": "not found"})
+}
+
+// record writes req, the nth request, and its canned response to a file
+// numbered n.
+func (t *Transport) record(req *http.Request, body []byte, n int64, status int, response []byte) error {
+	header := req.Header.Clone()
+	for _, name := range redactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "REDACTED")
+		}
+	}
+
+	rec := Recording{
+		Time:   time.Now().UTC(),
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: header,
+		Status: status,
+	}
+	if len(body) > 0 {
+		if json.Valid(body) {
+			rec.Body = json.RawMessage(body)
+		} else {
+			rec.Body = string(body)
+		}
+	}
+	if json.Valid(response) {
+		rec.Response = response
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %w", err)
+	}
+	data = append(data, '\n')
+	name := fmt.Sprintf("%04d-%s-%s.json", n, strings.ToLower(req.Method), req.URL.Hostname())
+	if err := os.WriteFile(filepath.Join(t.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+func storageURL(fileID int64) string {
+	return "http://" + storageHost + "/files/" + strconv.FormatInt(fileID, 10)
+}
+
+func mustJSON(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,281 @@
+// Package templates renders message templates, so before_handlers can return
+// a template name and its variables instead of building HTML in Postgres.
+//
+// A template is a set of files named <channel>/<name>.<part>.tmpl, where
+// channel is email or sms and part is subject, html or txt. html parts are
+// html/template, which escapes the variables for their context; the others
+// are text/template. The worker ships the templates under email/ and reads
+// further ones, replacing shipped files of the same name, from
+// WORKER_TEMPLATES_DIR.
+//
+// Translations live in a directory per locale, <channel>/<locale>/<name>.
+// <part>.tmpl (e.g. email/fr-CA/welcome.html.tmpl). A message is rendered
+// with the first variant found along its locale's fallback chain: fr-CA,
+// then fr, then the default locale, then the unlocalized template.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed email
+var builtin embed.FS
+
+// ErrNotFound reports a template name with no files for the channel.
+var ErrNotFound = errors.New("template not found")
+
+// Engine holds the parsed templates, keyed by "<channel>/<name>.<part>" or
+// "<channel>/<locale>/<name>.<part>".
+type Engine struct {
+	html          map[string]*htmltemplate.Template
+	text          map[string]*texttemplate.Template
+	defaultLocale string
+}
+
+// Email is a rendered email template. Text is empty when the template has
+// no txt part; the email service then derives it from HTML. Locale is the
+// variant rendered, empty for the unlocalized template.
+type Email struct {
+	Subject string
+	HTML    string
+	Text    string
+	Locale  string
+}
+
+// funcs are available to every template: date formats a time, or an RFC
+// 3339 string as variables from JSON carry them, with a Go layout; default
+// returns its first argument when the second is empty.
+var funcs = map[string]any{
+	"date": func(layout string, value any) (string, error) {
+		switch v := value.(type) {
+		case time.Time:
+			return v.Format(layout), nil
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return "", err
+			}
+			return t.Format(layout), nil
+		}
+		return "", fmt.Errorf("date: unsupported value %T", value)
+	},
+	"default": func(fallback, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// localePattern matches a locale: a language, optionally followed by a
+// script or region (en, fr-CA, zh-Hant).
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// New parses the shipped templates and then those in dir, when set.
+// Messages whose locale has no variant fall back to defaultLocale before the
+// unlocalized templates.
+func New(dir, defaultLocale string) (*Engine, error) {
+	e := &Engine{
+		html:          map[string]*htmltemplate.Template{},
+		text:          map[string]*texttemplate.Template{},
+		defaultLocale: NormalizeLocale(defaultLocale),
+	}
+	if err := e.load(builtin); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := e.load(os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+	return e, nil
+}
+
+// load parses every .tmpl file of fsys under email/ and sms/.
+func (e *Engine) load(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(file, ".tmpl") {
+			return err
+		}
+		key := strings.TrimSuffix(file, ".tmpl")
+		segments := strings.Split(key, "/")
+		if channel := segments[0]; channel != "email" && channel != "sms" {
+			return nil
+		}
+		switch len(segments) {
+		case 2:
+		case 3:
+			if !localePattern.MatchString(segments[1]) {
+				return fmt.Errorf("%s: %q is not a locale", file, segments[1])
+			}
+			segments[1] = NormalizeLocale(segments[1])
+			key = strings.Join(segments, "/")
+		default:
+			return fmt.Errorf("%s: want <channel>/<name>.<part>.tmpl or <channel>/<locale>/<name>.<part>.tmpl", file)
+		}
+		part := path.Ext(key)
+		if part != ".subject" && part != ".html" && part != ".txt" {
+			return fmt.Errorf("%s: part must be subject, html or txt", file)
+		}
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		if part == ".html" {
+			t, err := htmltemplate.New(key).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+			if err != nil {
+				return err
+			}
+			e.html[key] = t
+			return nil
+		}
+		t, err := texttemplate.New(key).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		if err != nil {
+			return err
+		}
+		e.text[key] = t
+		return nil
+	})
+}
+
+// NormalizeLocale formats a locale as a lowercase language followed by its
+// subtags, a region in uppercase: "fr_ca" becomes "fr-CA".
+func NormalizeLocale(locale string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(locale), func(r rune) bool { return r == '-' || r == '_' })
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// localeChain returns the locales tried for locale, most specific first:
+// the locale and its shorter prefixes, the default locale and its prefixes,
+// and "" for the unlocalized templates.
+func (e *Engine) localeChain(locale string) []string {
+	var chain []string
+	seen := map[string]bool{}
+	for _, l := range []string{NormalizeLocale(locale), e.defaultLocale} {
+		for l != "" {
+			if !seen[l] {
+				seen[l] = true
+				chain = append(chain, l)
+			}
+			i := strings.LastIndex(l, "-")
+			if i < 0 {
+				break
+			}
+			l = l[:i]
+		}
+	}
+	return append(chain, "")
+}
+
+// variantKey is the key of channel's template name in locale, without the
+// part.
+func variantKey(channel, locale, name string) string {
+	if locale == "" {
+		return channel + "/" + name
+	}
+	return channel + "/" + locale + "/" + name
+}
+
+// Email renders the email template name with data. Each part comes from
+// the first variant along locale's fallback chain that has it, so a
+// translation may leave out parts it shares with a broader one; an html or
+// a txt part is required. Subject is empty without a subject part.
+func (e *Engine) Email(name, locale string, data any) (Email, error) {
+	var out Email
+	var html *htmltemplate.Template
+	var text, subject *texttemplate.Template
+	for _, l := range e.localeChain(locale) {
+		key := variantKey("email", l, name)
+		if t, ok := e.html[key+".html"]; ok && html == nil && text == nil {
+			html, out.Locale = t, l
+		}
+		if t, ok := e.text[key+".txt"]; ok && html == nil && text == nil {
+			text, out.Locale = t, l
+		}
+		if t, ok := e.text[key+".subject"]; ok && subject == nil {
+			subject = t
+		}
+	}
+	if html == nil && text == nil {
+		return Email{}, fmt.Errorf("%w: email/%s", ErrNotFound, name)
+	}
+	// The txt part goes with the html part's variant when that has one.
+	if html != nil {
+		text = e.text[variantKey("email", out.Locale, name)+".txt"]
+	}
+
+	var err error
+	if subject != nil {
+		if out.Subject, err = execute(subject, data); err != nil {
+			return Email{}, err
+		}
+		out.Subject = strings.TrimSpace(out.Subject)
+	}
+	if html != nil {
+		if out.HTML, err = execute(html, data); err != nil {
+			return Email{}, err
+		}
+	}
+	if text != nil {
+		if out.Text, err = execute(text, data); err != nil {
+			return Email{}, err
+		}
+	}
+	return out, nil
+}
+
+// SMS renders the txt part of the sms template name with data, in the first
+// variant of locale's fallback chain that has one.
+func (e *Engine) SMS(name, locale string, data any) (string, error) {
+	var t *texttemplate.Template
+	for _, l := range e.localeChain(locale) {
+		if found, ok := e.text[variantKey("sms", l, name)+".txt"]; ok {
+			t = found
+			break
+		}
+	}
+	if t == nil {
+		return "", fmt.Errorf("%w: sms/%s", ErrNotFound, name)
+	}
+	body, err := execute(t, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body), nil
+}
+
+func execute(t interface {
+	Execute(w io.Writer, data any) error
+}, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
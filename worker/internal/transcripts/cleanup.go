@@ -0,0 +1,220 @@
+// Package transcripts cleans up raw transcripts for reading, keeping that
+// CPU-bound text work out of Postgres: filler words are removed, punctuation
+// is normalized and the words are grouped into paragraphs, each word keeping
+// the timestamps the provider gave it.
+package transcripts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+const (
+	// paragraphPause is the silence, in seconds, after a sentence that
+	// starts a new paragraph.
+	paragraphPause = 2.0
+	// paragraphMaxSentences is the most sentences a paragraph takes before
+	// the next one starts.
+	paragraphMaxSentences = 5
+)
+
+// fillers are the filler words removed per language (ISO 639-1). Transcripts
+// in another language, or in none, use English's.
+var fillers = map[string]map[string]bool{
+	"en": set("um", "umm", "uh", "uhh", "uhm", "er", "erm", "ah", "hmm", "hm", "mm", "mhm"),
+	"fr": set("euh", "heu", "hum", "hmm", "bah"),
+	"de": set("äh", "ähm", "öh", "öhm", "hm", "hmm"),
+	"es": set("eh", "em", "mmm", "hmm"),
+	"zh": set("嗯", "呃", "额"),
+}
+
+// languageAliases map the ISO 639-2 codes ElevenLabs reports and the names
+// Whisper reports to ISO 639-1.
+var languageAliases = map[string]string{
+	"eng": "en", "english": "en",
+	"fra": "fr", "fre": "fr", "french": "fr",
+	"deu": "de", "ger": "de", "german": "de",
+	"spa": "es", "spanish": "es",
+	"zho": "zh", "chi": "zh", "cmn": "zh", "chinese": "zh",
+}
+
+// unspaced are the languages written without spaces between words.
+var unspaced = map[string]bool{"zh": true, "ja": true, "th": true}
+
+// sentenceEnds are the punctuation marks that end a sentence.
+const sentenceEnds = ".?!。？！"
+
+var (
+	repeatedCommas = regexp.MustCompile(`,{2,}`)
+	repeatedMarks  = regexp.MustCompile(`([!?])[!?]*`)
+	repeatedDots   = regexp.MustCompile(`\.{2,}`)
+)
+
+func set(words ...string) map[string]bool {
+	m := make(map[string]bool, len(words))
+	for _, w := range words {
+		m[w] = true
+	}
+	return m
+}
+
+// Clean cleans a transcript given as its words, or, when there are none (a
+// model that returns text alone), as its text split on whitespace without
+// timestamps. Spacing and audio event tokens are dropped. A paragraph ends at
+// a change of speaker, or at the end of a sentence followed by a pause of
+// paragraphPause seconds or after paragraphMaxSentences sentences.
+func Clean(text string, words []types.TranscriptWord, languageCode string) types.TranscriptCleanupResult {
+	language := normalizeLanguage(languageCode)
+	fillerWords, ok := fillers[language]
+	if !ok {
+		fillerWords = fillers["en"]
+	}
+	if len(words) == 0 {
+		for _, field := range strings.Fields(text) {
+			words = append(words, types.TranscriptWord{Text: field, Type: "word"})
+		}
+	}
+
+	kept := make([]types.TranscriptWord, 0, len(words))
+	removed := 0
+	for _, w := range words {
+		if w.Type != "" && w.Type != "word" {
+			continue
+		}
+		w.Text = normalizePunctuation(w.Text)
+		if w.Text == "" {
+			continue
+		}
+		if fillerWords[strings.ToLower(strings.TrimFunc(w.Text, unicode.IsPunct))] {
+			removed++
+			// A filler that ends a sentence hands the end on to the word
+			// before it.
+			if end := w.Text[len(strings.TrimRight(w.Text, sentenceEnds)):]; end != "" && len(kept) > 0 {
+				last := &kept[len(kept)-1]
+				if !endsSentence(last.Text) {
+					last.Text = strings.TrimRight(last.Text, ",;:") + end
+				}
+			}
+			continue
+		}
+		kept = append(kept, w)
+	}
+
+	separator := " "
+	if unspaced[language] {
+		separator = ""
+	}
+	result := types.TranscriptCleanupResult{Paragraphs: []types.TranscriptParagraph{}, FillersRemoved: removed}
+	var current []types.TranscriptWord
+	sentences := 0
+	for _, w := range kept {
+		if n := len(current); n > 0 {
+			prev := current[n-1]
+			pause := w.Start - prev.End
+			if w.SpeakerID != prev.SpeakerID || endsSentence(prev.Text) && (pause >= paragraphPause || sentences >= paragraphMaxSentences) {
+				result.Paragraphs = append(result.Paragraphs, paragraph(current, separator))
+				current, sentences = nil, 0
+			}
+		}
+		current = append(current, w)
+		if endsSentence(w.Text) {
+			sentences++
+		}
+	}
+	if len(current) > 0 {
+		result.Paragraphs = append(result.Paragraphs, paragraph(current, separator))
+	}
+
+	texts := make([]string, len(result.Paragraphs))
+	for i, p := range result.Paragraphs {
+		texts[i] = p.Text
+	}
+	result.Text = strings.Join(texts, "\n\n")
+	return result
+}
+
+// paragraph builds a paragraph of words: sentences start with a capital
+// letter, the last one is ended with a full stop if it has no end, and
+// punctuation tokens are joined to the word before them.
+func paragraph(words []types.TranscriptWord, separator string) types.TranscriptParagraph {
+	last := &words[len(words)-1]
+	if !endsSentence(last.Text) {
+		end := "."
+		if separator == "" {
+			end = "。"
+		}
+		last.Text = strings.TrimRight(last.Text, ",;:") + end
+	}
+
+	var text strings.Builder
+	capitalize := true
+	for i := range words {
+		if capitalize {
+			words[i].Text = upperFirst(words[i].Text)
+		}
+		capitalize = endsSentence(words[i].Text)
+		if i > 0 && !isPunctuation(words[i].Text) {
+			text.WriteString(separator)
+		}
+		text.WriteString(words[i].Text)
+	}
+	return types.TranscriptParagraph{
+		Text:  text.String(),
+		Start: words[0].Start,
+		End:   last.End,
+		Words: words,
+	}
+}
+
+// normalizePunctuation trims a word and collapses repeated punctuation:
+// ",," becomes ",", "?!?" becomes "?", ".." becomes "." and longer runs of
+// dots an ellipsis ("...").
+func normalizePunctuation(word string) string {
+	word = strings.TrimSpace(word)
+	word = repeatedCommas.ReplaceAllString(word, ",")
+	word = repeatedMarks.ReplaceAllString(word, "$1")
+	return repeatedDots.ReplaceAllStringFunc(word, func(dots string) string {
+		if len(dots) == 2 {
+			return "."
+		}
+		return "..."
+	})
+}
+
+// normalizeLanguage returns the ISO 639-1 code of a language code or name.
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if alias, ok := languageAliases[code]; ok {
+		return alias
+	}
+	return code
+}
+
+func endsSentence(word string) bool {
+	r, _ := utf8.DecodeLastRuneInString(word)
+	return strings.ContainsRune(sentenceEnds, r)
+}
+
+func isPunctuation(word string) bool {
+	for _, r := range word {
+		if !unicode.IsPunct(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func upperFirst(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	if !unicode.IsLower(r) {
+		return word
+	}
+	return string(unicode.ToUpper(r)) + word[size:]
+}
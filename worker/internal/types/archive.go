@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+// TaskArchivePayload configures a task_archive run. Zero values take the
+// defaults applied by the processor.
+type TaskArchivePayload struct {
+	// RetentionDays is how long completed tasks stay in the hot queue tables.
+	RetentionDays int `json:"retention_days,omitempty"`
+	// BatchSize bounds the tasks moved per database transaction.
+	BatchSize int `json:"batch_size,omitempty"`
+	// MaxBatches bounds the transactions per run; a backlog left over is
+	// picked up by the next run.
+	MaxBatches int `json:"max_batches,omitempty"`
+}
+
+// TaskArchiveResult reports what a task_archive run moved.
+type TaskArchiveResult struct {
+	ArchivedTasks   int       `json:"archived_tasks"`
+	Batches         int       `json:"batches"`
+	CompletedBefore time.Time `json:"completed_before"`
+}
+
+// TaskArchiveBatch is the payload queues.archive_completed_tasks returns for
+// one batch.
+type TaskArchiveBatch struct {
+	Archived        int       `json:"archived"`
+	CompletedBefore time.Time `json:"completed_before"`
+}
@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// CalendarInvitePayload is what a calendar_invite before_handler returns:
+// an email, shaped like an email task's payload without attachments, and
+// the event it invites its recipient to.
+type CalendarInvitePayload struct {
+	EmailPayload
+	Event CalendarEvent `json:"event"`
+}
+
+// CalendarEvent is the event of a calendar invite. UID identifies it across
+// updates: resending it with a higher Sequence updates the event in the
+// recipient's calendar, and Method CANCEL removes it. Organizer defaults to
+// the email's sender and Attendees to its recipient.
+type CalendarEvent struct {
+	UID         string             `json:"uid"`
+	Sequence    int                `json:"sequence,omitempty"`
+	Method      string             `json:"method,omitempty"`
+	Summary     string             `json:"summary"`
+	Description string             `json:"description,omitempty"`
+	Location    string             `json:"location,omitempty"`
+	URL         string             `json:"url,omitempty"`
+	Start       time.Time          `json:"start"`
+	End         time.Time          `json:"end"`
+	Organizer   *CalendarAttendee  `json:"organizer,omitempty"`
+	Attendees   []CalendarAttendee `json:"attendees,omitempty"`
+}
+
+// CalendarAttendee is an event's organizer or attendee.
+type CalendarAttendee struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
@@ -0,0 +1,50 @@
+package types
+
+// DiscordMessagePayload represents the payload structure for discord_message
+// tasks: the webhook to post to and the message, in Discord's webhook format.
+type DiscordMessagePayload struct {
+	MessageID  int64  `json:"message_id"`
+	WebhookURL string `json:"webhook_url"`
+	Content    string `json:"content,omitempty"`
+	// Username and AvatarURL override the webhook's configured identity.
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []DiscordEmbed `json:"embeds,omitempty"`
+}
+
+// DiscordEmbed is a rich embed attached to a Discord message.
+type DiscordEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	// Color is the embed's side bar color as a 0xRRGGBB integer.
+	Color int `json:"color,omitempty"`
+	// Timestamp is an ISO 8601 time shown in the footer.
+	Timestamp string              `json:"timestamp,omitempty"`
+	Author    *DiscordEmbedAuthor `json:"author,omitempty"`
+	Footer    *DiscordEmbedFooter `json:"footer,omitempty"`
+	Image     *DiscordEmbedImage  `json:"image,omitempty"`
+	Thumbnail *DiscordEmbedImage  `json:"thumbnail,omitempty"`
+	Fields    []DiscordEmbedField `json:"fields,omitempty"`
+}
+
+type DiscordEmbedAuthor struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type DiscordEmbedFooter struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type DiscordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
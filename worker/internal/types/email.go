@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // EmailPayload represents the payload structure for email tasks.
 type EmailPayload struct {
 	MessageID   int64  `json:"message_id"`
@@ -7,4 +9,47 @@ type EmailPayload struct {
 	ToAddress   string `json:"to_address"`
 	Subject     string `json:"subject"`
 	HTML        string `json:"html"`
+	// Template names a worker template (internal/templates) rendered with
+	// TemplateData into the email's html and text, and its subject unless
+	// Subject is set, instead of returning html.
+	Template     string         `json:"template,omitempty"`
+	TemplateData map[string]any `json:"template_data,omitempty"`
+	// Locale is the recipient's language (e.g. fr-CA) the template is
+	// rendered in, falling back to fr, then the worker's default locale.
+	Locale string `json:"locale,omitempty"`
+	// Text is the plain-text alternative; when empty the worker generates
+	// it from HTML.
+	Text string `json:"text,omitempty"`
+	// CC, BCC and ReplyTo are optional; a before_handler that does not
+	// return them sends to ToAddress alone, replying to FromAddress.
+	CC      []string `json:"cc,omitempty"`
+	BCC     []string `json:"bcc,omitempty"`
+	ReplyTo string   `json:"reply_to,omitempty"`
+	// Provider sends this email instead of the configured primary (resend,
+	// ses or sendgrid); empty uses the primary.
+	Provider string `json:"provider,omitempty"`
+	// Tags label the email for the provider's analytics (e.g. campaign);
+	// names and values are ASCII letters, digits, _ and -. Headers are
+	// extra message headers such as List-Unsubscribe.
+	Tags    map[string]string `json:"tags,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// SendAt, when set in the future, has the provider hold the email and
+	// deliver it then, so it can be queued ahead of a recipient's local hour.
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// SendEmailAttemptID is the comms attempt the email is sent for. With
+	// MessageID it derives the IdempotencyKey when that is empty, so a
+	// task retried after a timeout does not send the email twice.
+	SendEmailAttemptID int64  `json:"send_email_attempt_id,omitempty"`
+	IdempotencyKey     string `json:"idempotency_key,omitempty"`
+	// Attachments are files service files the worker downloads and attaches.
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
+}
+
+// EmailAttachment names a files service file to attach. Filename and
+// ContentType default to a name derived from the file id and to Resend's
+// guess from the filename.
+type EmailAttachment struct {
+	FileID      int64  `json:"file_id"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
 }
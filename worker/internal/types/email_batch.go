@@ -0,0 +1,27 @@
+package types
+
+// EmailBatchPayload is what an email_batch before_handler returns: emails
+// to send together, each shaped like an email task's payload but without
+// attachments or send_at. BatchID identifies the batch for idempotency.
+type EmailBatchPayload struct {
+	BatchID int64          `json:"batch_id,omitempty"`
+	Emails  []EmailPayload `json:"emails"`
+}
+
+// EmailBatchResult is what the success handler receives: counts and one
+// result per email, in the order they were given.
+type EmailBatchResult struct {
+	Sent    int                    `json:"sent"`
+	Failed  int                    `json:"failed"`
+	Results []EmailRecipientResult `json:"results"`
+}
+
+// EmailRecipientResult is one email's outcome in a batch: the provider and
+// its email id when sent, otherwise the error.
+type EmailRecipientResult struct {
+	MessageID int64  `json:"message_id,omitempty"`
+	ToAddress string `json:"to_address"`
+	Provider  string `json:"provider,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
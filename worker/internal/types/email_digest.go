@@ -0,0 +1,44 @@
+package types
+
+import "time"
+
+// EmailDigestPayload is what an email_digest before_handler returns: whose
+// pending notification items to collect, the window they were created in,
+// and where the digest goes. Subject defaults to one counting the items.
+type EmailDigestPayload struct {
+	DigestID    int64     `json:"digest_id,omitempty"`
+	AccountID   int64     `json:"account_id"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	FromAddress string    `json:"from_address"`
+	ToAddress   string    `json:"to_address"`
+	Subject     string    `json:"subject,omitempty"`
+	// Template is the email template the items are rendered with; empty
+	// uses the shipped digest template. Locale selects its translation, as
+	// on an email payload.
+	Template string `json:"template,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	// Provider and Tags are passed to the digest email as on an email task.
+	Provider string            `json:"provider,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// DigestItem is a pending notification item listed in a digest.
+type DigestItem struct {
+	NotificationItemID int64     `json:"notification_item_id"`
+	Title              string    `json:"title"`
+	Body               string    `json:"body,omitempty"`
+	URL                string    `json:"url,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// EmailDigestResult is what the success handler receives: the items the
+// digest listed, now marked digested, and the provider's email id. Items is
+// 0, with no email sent, when nothing was pending.
+type EmailDigestResult struct {
+	AccountID           int64   `json:"account_id"`
+	Items               int     `json:"items"`
+	NotificationItemIDs []int64 `json:"notification_item_ids,omitempty"`
+	Provider            string  `json:"provider,omitempty"`
+	ID                  string  `json:"id,omitempty"`
+}
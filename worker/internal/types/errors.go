@@ -0,0 +1,205 @@
+package types
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error classes. Processors wrap provider errors with one of these so the
+// worker can decide how to handle a failure: retryable and rate-limited
+// failures are retried by the worker, permanent failures are dead-lettered,
+// and unclassified failures go straight to the error handler. Unavailable
+// failures were never sent because the provider's circuit breaker is open;
+// the worker reschedules them without counting a failure.
+var (
+	ErrPermanent   = errors.New("permanent")
+	ErrRetryable   = errors.New("retryable")
+	ErrRateLimited = errors.New("rate limited")
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// ClassifiedError attaches an error class (and, for rate limits, a provider
+// supplied retry delay) to an underlying error.
+type ClassifiedError struct {
+	Class      error
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ClassifiedError) Error() string { return e.Err.Error() }
+
+// Unwrap exposes both the class and the underlying error to errors.Is/As.
+func (e *ClassifiedError) Unwrap() []error { return []error{e.Class, e.Err} }
+
+// Permanent marks err as a failure that will not succeed on retry.
+func Permanent(err error) error {
+	return classify(ErrPermanent, err, 0)
+}
+
+// Retryable marks err as a transient failure worth retrying.
+func Retryable(err error) error {
+	return classify(ErrRetryable, err, 0)
+}
+
+// RateLimited marks err as a provider rate limit. retryAfter is the delay the
+// provider asked for, or zero when unknown.
+func RateLimited(err error, retryAfter time.Duration) error {
+	return classify(ErrRateLimited, err, retryAfter)
+}
+
+// classify wraps err with class, unless err already carries a class: the
+// classification closest to the cause wins, so e.g. a rate-limited transport
+// error stays rate limited when a service wraps it as retryable.
+// Unavailable marks err as a call refused because the provider is known to be
+// down. retryAfter is when it may be tried again.
+func Unavailable(err error, retryAfter time.Duration) error {
+	return classify(ErrUnavailable, err, retryAfter)
+}
+
+func classify(class, err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	var inner *ClassifiedError
+	if errors.As(err, &inner) {
+		return &ClassifiedError{Class: inner.Class, Err: err, RetryAfter: inner.RetryAfter}
+	}
+	return &ClassifiedError{Class: class, Err: err, RetryAfter: retryAfter}
+}
+
+// ValidationError is the "bad input, don't retry" outcome a db_function or
+// before_handler reports through validation_failure_message. It is not an
+// operational failure: the task is neither retried nor dead-lettered, and the
+// message goes to the task's validation_handler.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string { return "validation failed: " + e.Message }
+
+// ErrorClass returns the class of err (ErrPermanent, ErrRetryable,
+// ErrRateLimited or ErrUnavailable), or nil when err is unclassified.
+func ErrorClass(err error) error {
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.Class
+	}
+	return nil
+}
+
+// ErrorClassName returns a label for err's class: "permanent", "retryable",
+// "rate_limited", "unavailable", "validation" for a ValidationError, or "" when
+// unclassified.
+func ErrorClassName(err error) string {
+	switch ErrorClass(err) {
+	case ErrPermanent:
+		return "permanent"
+	case ErrRetryable:
+		return "retryable"
+	case ErrRateLimited:
+		return "rate_limited"
+	case ErrUnavailable:
+		return "unavailable"
+	}
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		return "validation"
+	}
+	return ""
+}
+
+// RescheduleTime returns when to run a task again for a rate-limited err that
+// carries a Retry-After delay (a provider 429 with Retry-After, or the
+// outbound rate limiter). It reports false for any other error.
+func RescheduleTime(err error) (time.Time, bool) {
+	if ErrorClass(err) != ErrRateLimited {
+		return time.Time{}, false
+	}
+	retryAfter := RetryAfter(err)
+	if retryAfter <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(retryAfter), true
+}
+
+// RetryAfter returns the provider-requested retry delay carried by err, if any.
+func RetryAfter(err error) time.Duration {
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.RetryAfter
+	}
+	return 0
+}
+
+// rateLimitFallbackDelay is how long to wait after a 429 whose response gives
+// no retry hint, so the task is still rescheduled rather than failed.
+const rateLimitFallbackDelay = 30 * time.Second
+
+// ClassifyHTTPStatus wraps err according to a provider's HTTP status code:
+// 429 is rate limited (honoring the provider's retry hint), 408 and 5xx are
+// retryable, and other 4xx responses are permanent.
+func ClassifyHTTPStatus(statusCode int, header http.Header, err error) error {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		retryAfter := rateLimitDelay(header)
+		if retryAfter <= 0 {
+			retryAfter = rateLimitFallbackDelay
+		}
+		return RateLimited(err, retryAfter)
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return Retryable(err)
+	case statusCode >= 400:
+		return Permanent(err)
+	}
+	return err
+}
+
+// rateLimitDelay reads a 429 response's retry hint: Retry-After, then
+// OpenAI's retry-after-ms, then the reset of the exhausted window
+// (RateLimit-Reset / X-RateLimit-Reset, as sent by Resend and others).
+func rateLimitDelay(header http.Header) time.Duration {
+	if d := parseRetryAfter(header.Get("Retry-After")); d > 0 {
+		return d
+	}
+	if ms, err := strconv.Atoi(header.Get("Retry-After-Ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		if d := parseRateLimitReset(header.Get(name)); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// parseRateLimitReset parses a rate limit reset header, given either as
+// seconds until the window resets or as a Unix timestamp.
+func parseRateLimitReset(value string) time.Duration {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	// Values this large are epoch seconds rather than a delta.
+	if secs > 1_000_000_000 {
+		return time.Until(time.Unix(secs, 0))
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -17,6 +17,20 @@ type FileDeleteResult struct {
 	SignedDeleteURL string `json:"signed_delete_url,omitempty"`
 }
 
+// SignedURLPrewarmPayload is the payload the before_handler of a
+// signed_url_prewarm task returns: the files whose signed download URLs
+// should be minted ahead of demand (e.g. media of lessons starting soon).
+type SignedURLPrewarmPayload struct {
+	FileIDs []int64 `json:"file_ids"`
+}
+
+// SignedURLPrewarmResult reports how many of the requested files the files
+// service returned a signed URL for.
+type SignedURLPrewarmResult struct {
+	RequestedFiles int `json:"requested_files"`
+	WarmedFiles    int `json:"warmed_files"`
+}
+
 // FileSignedDeleteURLResponse represents the HTTP response body returned by
 // the files service /signed_delete_url endpoint.
 type FileSignedDeleteURLResponse struct {
@@ -29,3 +43,53 @@ type FileSignedDownloadURLResponse struct {
 	FileID int64  `json:"file_id"`
 	URL    string `json:"url"`
 }
+
+// FileSignedUploadURLResponse represents the HTTP response body returned by
+// the files service /signed_upload_url endpoint. UploadHeaders are signed
+// into the URL and must be sent verbatim with the PUT.
+type FileSignedUploadURLResponse struct {
+	UploadURL     string            `json:"upload_url"`
+	UploadHeaders map[string]string `json:"upload_headers"`
+}
+
+// ImageThumbnailPayload represents the payload for image_thumbnail tasks
+// after being prepared by the before_handler
+// (files.get_image_thumbnail_payload): the image and the thumbnails to
+// generate, each with the upload intent it goes to.
+type ImageThumbnailPayload struct {
+	FileID     int64           `json:"file_id"`
+	MimeType   string          `json:"mime_type"`
+	Thumbnails []ThumbnailSpec `json:"thumbnails"`
+}
+
+// ThumbnailSpec is one configured thumbnail size: the image is scaled down
+// to fit MaxWidth x MaxHeight (0 leaves a side free) and uploaded to the
+// upload intent's object key.
+type ThumbnailSpec struct {
+	Name           string `json:"name"`
+	MaxWidth       int    `json:"max_width"`
+	MaxHeight      int    `json:"max_height"`
+	UploadIntentID int64  `json:"upload_intent_id"`
+	ObjectKey      string `json:"object_key"`
+}
+
+// ImageThumbnailResult is recorded by the DB success_handler, which creates
+// a file for each uploaded thumbnail and links it to the image. Width and
+// Height are the upright image's; Orientation is its EXIF orientation.
+type ImageThumbnailResult struct {
+	FileID      int64            `json:"file_id"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Orientation int              `json:"orientation"`
+	Thumbnails  []ImageThumbnail `json:"thumbnails"`
+}
+
+// ImageThumbnail is one generated thumbnail.
+type ImageThumbnail struct {
+	Name           string `json:"name"`
+	UploadIntentID int64  `json:"upload_intent_id"`
+	ObjectKey      string `json:"object_key"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	SizeBytes      int    `json:"size_bytes"`
+}
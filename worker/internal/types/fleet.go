@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// WorkerInstance is one worker process as last reported by its heartbeat in
+// queues.worker_instance. Status is "alive", "stale" (missed heartbeats) or
+// "stopped", as derived by queues.worker_fleet.
+type WorkerInstance struct {
+	ID              string         `json:"worker_instance_id"`
+	Hostname        string         `json:"hostname"`
+	Version         string         `json:"version"`
+	Concurrency     int            `json:"concurrency"`
+	InFlight        map[string]int `json:"in_flight"`
+	StartedAt       time.Time      `json:"started_at"`
+	LastHeartbeatAt time.Time      `json:"last_heartbeat_at"`
+	LastPollAt      *time.Time     `json:"last_poll_at,omitempty"`
+	StoppedAt       *time.Time     `json:"stopped_at,omitempty"`
+	Status          string         `json:"status"`
+}
@@ -0,0 +1,63 @@
+package types
+
+import "encoding/json"
+
+// PushNotificationPayload represents the payload structure for
+// push_notification tasks: one notification sent to every device token.
+// Tokens are FCM registration tokens; APNsTokens are device (or live
+// activity push) tokens sent to directly through APNs.
+type PushNotificationPayload struct {
+	MessageID  int64    `json:"message_id"`
+	Tokens     []string `json:"tokens,omitempty"`
+	APNsTokens []string `json:"apns_tokens,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Body       string   `json:"body,omitempty"`
+	ImageURL   string   `json:"image_url,omitempty"`
+	// Data is delivered to the app alongside the notification; FCM only
+	// accepts string values.
+	Data map[string]string `json:"data,omitempty"`
+	// TTLSeconds bounds how long FCM keeps the notification for an offline
+	// device; 0 uses FCM's default of four weeks.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+	// APNs holds iOS-only options, applied to APNsTokens.
+	APNs *APNsOptions `json:"apns,omitempty"`
+}
+
+// APNsOptions are the APNs features FCM does not expose. Zero values leave
+// the field out of the request.
+type APNsOptions struct {
+	// PushType is alert (default), background or liveactivity.
+	PushType string `json:"push_type,omitempty"`
+	// InterruptionLevel is passive, active, time-sensitive or critical.
+	InterruptionLevel string   `json:"interruption_level,omitempty"`
+	Sound             string   `json:"sound,omitempty"`
+	Badge             *int     `json:"badge,omitempty"`
+	ThreadID          string   `json:"thread_id,omitempty"`
+	RelevanceScore    *float64 `json:"relevance_score,omitempty"`
+	CollapseID        string   `json:"collapse_id,omitempty"`
+	// Priority is 10 (immediate) or 5 (power considerate); 0 uses 10, or 5
+	// for background pushes.
+	Priority int `json:"priority,omitempty"`
+
+	// Live activity updates (push_type liveactivity): Event is start,
+	// update or end, ContentState the activity's new content state. Times
+	// are Unix seconds; Timestamp defaults to now.
+	Event          string          `json:"event,omitempty"`
+	ContentState   json.RawMessage `json:"content_state,omitempty"`
+	Timestamp      int64           `json:"timestamp,omitempty"`
+	StaleDate      int64           `json:"stale_date,omitempty"`
+	DismissalDate  int64           `json:"dismissal_date,omitempty"`
+	AttributesType string          `json:"attributes_type,omitempty"`
+	Attributes     json.RawMessage `json:"attributes,omitempty"`
+}
+
+// PushNotificationResult reports the outcome per device. InvalidTokens are
+// tokens FCM no longer accepts (app uninstalled, token rotated) and should be
+// removed; FailedTokens failed for a transient reason and may be retried in a
+// later notification.
+type PushNotificationResult struct {
+	Sent          int      `json:"sent"`
+	MessageIDs    []string `json:"message_ids,omitempty"`
+	InvalidTokens []string `json:"invalid_tokens,omitempty"`
+	FailedTokens  []string `json:"failed_tokens,omitempty"`
+}
@@ -5,4 +5,10 @@ type SMSPayload struct {
 	MessageID int64  `json:"message_id"`
 	ToNumber  string `json:"to_number"`
 	Body      string `json:"body"`
+	// Template names a worker sms template rendered with TemplateData into
+	// Body, instead of returning body.
+	Template     string         `json:"template,omitempty"`
+	TemplateData map[string]any `json:"template_data,omitempty"`
+	// Locale selects the template's translation, as on an email payload.
+	Locale string `json:"locale,omitempty"`
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 )
 
@@ -14,6 +15,22 @@ type Task struct {
 	ScheduledAt time.Time       `json:"scheduled_at"`
 }
 
+// RequestID returns the id of the HTTP request that originated the task
+// (payload request_id, stamped at enqueue), or "" when there is none.
+func (t *Task) RequestID() string {
+	var payload struct {
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(t.Payload, &payload); err != nil {
+		return ""
+	}
+	return payload.RequestID
+}
+
+// PriorityInteractive is the payload priority served by the reserved
+// interactive pool.
+const PriorityInteractive = "interactive"
+
 // TaskPayload represents the common structure of task payloads
 // The worker only needs to know about the handler fields - all business-specific
 // data stays in the original task.Payload and gets passed through to handlers
@@ -23,17 +40,70 @@ type TaskPayload struct {
 	BeforeHandler  string `json:"before_handler,omitempty"`
 	SuccessHandler string `json:"success_handler,omitempty"`
 	ErrorHandler   string `json:"error_handler,omitempty"`
+	// ValidationHandler receives validation failures; without it they go to
+	// ErrorHandler with error_class "validation".
+	ValidationHandler string `json:"validation_handler,omitempty"`
+	// QuotaHandler returns usage limits a processor checks before a costly
+	// provider call (see TranscriptionQuota).
+	QuotaHandler string `json:"quota_handler,omitempty"`
+
+	// NotBefore / DeliverAt hold a task until a business-meaningful time,
+	// independent of the queue's scheduled_at. Either name is accepted; when
+	// both are set the later one wins.
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	DeliverAt *time.Time `json:"deliver_at,omitempty"`
+
+	// PayloadFileID references a file (GCS object registered in files.file)
+	// holding the task's full JSON payload when it is too large to store in
+	// queues.task. The worker fetches it through the files service and merges
+	// it under the fields of the stored payload before processing.
+	PayloadFileID *int64 `json:"payload_file_id,omitempty"`
+
+	// CacheBeforeHandler saves the first successful before_handler payload
+	// for the task and reuses it on later attempts, so a retry after a
+	// provider failure does not run the handler (and record its facts) again.
+	CacheBeforeHandler bool `json:"cache_before_handler,omitempty"`
+
+	// Priority "interactive" routes the task through the worker's reserved
+	// interactive pool (and, for transcriptions, the faster model when one is
+	// configured). Any other value is treated as bulk.
+	Priority string `json:"priority,omitempty"`
 
 	// Note: No business-specific fields here!
 	// The database functions receive the full original task.Payload
 	// and extract whatever IDs/data they need from it
 }
 
+// DeliveryTime returns the earliest time the task may be processed, or the
+// zero time when the payload carries no delivery constraint.
+func (p *TaskPayload) DeliveryTime() time.Time {
+	var at time.Time
+	if p.NotBefore != nil {
+		at = *p.NotBefore
+	}
+	if p.DeliverAt != nil && p.DeliverAt.After(at) {
+		at = *p.DeliverAt
+	}
+	return at
+}
+
 // HandlerPayload represents the payload structure for success/error handlers
 type HandlerPayload struct {
 	OriginalPayload json.RawMessage `json:"original_payload,omitempty"`
 	WorkerPayload   json.RawMessage `json:"worker_payload,omitempty"`
 	Error           string          `json:"error,omitempty"`
+	// ErrorClass is "permanent", "retryable" or "rate_limited" when the
+	// processor classified the failure, so handlers can stop scheduling new
+	// attempts for permanent failures.
+	ErrorClass string `json:"error_class,omitempty"`
+	// Attempt is the attempt that failed (1 for the first run) and
+	// MaxAttempts the task type's limit, so handlers can tell whether the
+	// worker gave up after its last attempt.
+	Attempt     int `json:"attempt,omitempty"`
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// ValidationFailure is the validation_failure_message passed to a
+	// validation handler.
+	ValidationFailure string `json:"validation_failure,omitempty"`
 }
 
 // DBFunctionResult represents the result from a database function call
@@ -41,11 +111,30 @@ type HandlerPayload struct {
 type DBFunctionResult struct {
 	Status  string          `json:"status,omitempty"`
 	Payload json.RawMessage `json:"payload,omitempty"`
+	// NextTasks are follow-up tasks declared by a db_function task or a
+	// success handler; the worker enqueues them once the task has succeeded.
+	NextTasks []NextTask `json:"next_tasks,omitempty"`
+	// ValidationFailureMessage reports bad input that will not succeed on
+	// retry; it takes precedence over Status.
+	ValidationFailureMessage string `json:"validation_failure_message,omitempty"`
+}
+
+// NextTask is a follow-up task to enqueue after the current one succeeds.
+// ScheduledAt defaults to now.
+type NextTask struct {
+	TaskType    string          `json:"task_type"`
+	Payload     json.RawMessage `json:"payload"`
+	ScheduledAt *time.Time      `json:"scheduled_at,omitempty"`
 }
 
 // IsSuccess returns true if status is "succeeded"
 func (r *DBFunctionResult) IsSuccess() bool {
-	return r.Status == "succeeded"
+	return r.Status == "succeeded" && !r.IsValidationFailure()
+}
+
+// IsValidationFailure returns true if validation_failure_message is set
+func (r *DBFunctionResult) IsValidationFailure() bool {
+	return r.ValidationFailureMessage != ""
 }
 
 // TaskResult represents the result of processing a task
@@ -53,6 +142,19 @@ type TaskResult struct {
 	Success       bool
 	WorkerPayload any   // The result data from the service (email response, sms response, etc.)
 	Error         error // Any error that occurred
+	// Skipped marks a task whose side effect already ran in an earlier
+	// execution; it is completed without calling success or error handlers.
+	Skipped bool
+	// NextTasks are follow-up tasks declared by the processor; the success
+	// handler's own next_tasks are appended to them.
+	NextTasks []NextTask
+	// ValidationFailure holds the validation_failure_message of a task whose
+	// input was rejected. Such a task is neither a success nor an error.
+	ValidationFailure string
+	// RescheduleAt asks the worker to run the task again at that time, e.g.
+	// when a provider answered 429 with Retry-After. Error holds the
+	// provider's response; it is not recorded as a failure.
+	RescheduleAt time.Time
 }
 
 // NewTaskSuccess creates a successful task result
@@ -63,10 +165,79 @@ func NewTaskSuccess(workerPayload any) *TaskResult {
 	}
 }
 
-// NewTaskFailure creates a failed task result
+// NewTaskSkipped creates a result for a duplicate execution that was skipped
+func NewTaskSkipped() *TaskResult {
+	return &TaskResult{
+		Success: true,
+		Skipped: true,
+	}
+}
+
+// NewTaskValidationFailure creates a result for a task whose input was rejected
+func NewTaskValidationFailure(message string) *TaskResult {
+	return &TaskResult{ValidationFailure: message}
+}
+
+// NewTaskReschedule creates a result for a task the provider asked to be
+// retried at a later time; err describes the provider's response.
+func NewTaskReschedule(at time.Time, err error) *TaskResult {
+	return &TaskResult{
+		RescheduleAt: at,
+		Error:        err,
+	}
+}
+
+// NewTaskFailure creates a failed task result. A ValidationError becomes a
+// validation failure result instead.
 func NewTaskFailure(err error) *TaskResult {
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		return NewTaskValidationFailure(validation.Message)
+	}
 	return &TaskResult{
 		Success: false,
 		Error:   err,
 	}
 }
+
+// RecurringTask is a due definition from queues.due_recurring_tasks. NextRunAt
+// is nil for a definition that has not been scheduled yet.
+type RecurringTask struct {
+	RecurringTaskID int64      `json:"recurring_task_id"`
+	Name            string     `json:"name"`
+	CronExpression  string     `json:"cron_expression"`
+	NextRunAt       *time.Time `json:"next_run_at"`
+}
+
+// TaskStatus is a task with its queue state, as inspected by queuectl.
+// Fields that do not apply to a listing are left at their zero value.
+type TaskStatus struct {
+	TaskID       int64           `json:"task_id"`
+	TaskType     string          `json:"task_type"`
+	Payload      json.RawMessage `json:"payload"`
+	EnqueuedAt   time.Time       `json:"enqueued_at"`
+	ScheduledAt  *time.Time      `json:"scheduled_at,omitempty"`
+	CompletedAt  *time.Time      `json:"completed_at,omitempty"`
+	LeasedUntil  *time.Time      `json:"leased_until,omitempty"`
+	DeadLettered bool            `json:"dead_lettered"`
+	Cancelled    bool            `json:"cancelled"`
+	ErrorClass   string          `json:"error_class,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	ErrorCount   int             `json:"error_count"`
+	ReplayCount  int             `json:"replay_count"`
+}
+
+// TaskError is one queues.error row recorded for a task.
+type TaskError struct {
+	ErrorID      int64     `json:"error_id"`
+	ErrorMessage string    `json:"error_message"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TaskEvent is one queues.task_event row of a task's timeline.
+type TaskEvent struct {
+	TaskEventID int64           `json:"task_event_id"`
+	EventType   string          `json:"event_type"`
+	Details     json.RawMessage `json:"details"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package types
+
+import "encoding/json"
+
+// TelegramMessagePayload represents the payload structure for
+// telegram_message tasks. With a Document the message is sent with
+// sendDocument and Text becomes its caption; otherwise with sendMessage.
+type TelegramMessagePayload struct {
+	MessageID int64 `json:"message_id"`
+	// ChatID is the target chat: a numeric id or an "@channelusername"
+	// string, passed to Telegram as given.
+	ChatID json.RawMessage `json:"chat_id"`
+	Text   string          `json:"text,omitempty"`
+	// ParseMode is "MarkdownV2", "HTML" or empty for plain text.
+	ParseMode           string            `json:"parse_mode,omitempty"`
+	DisableNotification bool              `json:"disable_notification,omitempty"`
+	Document            *TelegramDocument `json:"document,omitempty"`
+}
+
+// TelegramDocument names the file to send. Exactly one source is set: a
+// files service file (signed by the worker), a public URL, or the file_id of
+// a document Telegram already has.
+type TelegramDocument struct {
+	FileID         int64  `json:"file_id,omitempty"`
+	URL            string `json:"url,omitempty"`
+	TelegramFileID string `json:"telegram_file_id,omitempty"`
+}
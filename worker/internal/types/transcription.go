@@ -1,18 +1,105 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // TranscriptionKickoffPayload represents the payload structure for transcription_kickoff
 // tasks after being prepared by the before_handler in Postgres.
 // It is built by learning.get_recording_transcription_kickoff_payload(payload jsonb).
 type TranscriptionKickoffPayload struct {
 	FileID                          int64 `json:"file_id"`
 	RecordingTranscriptionAttemptID int64 `json:"recording_transcription_attempt_id"`
+	// DurationSeconds is the recording's length from its file metadata, or
+	// nil when unknown.
+	DurationSeconds *float64 `json:"duration_seconds,omitempty"`
+	// Provider, when set, names the transcription provider (elevenlabs,
+	// deepgram or whisper) instead of the configured choice. Model, when
+	// set, replaces the provider's default model (e.g. scribe_v2); it is
+	// dropped when the fallback provider takes over.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// LanguageCode, when set, is the recording's spoken language as an ISO
+	// 639-1 code (en, fr), passed to the provider instead of letting it
+	// detect the language.
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+// TranscriptionQuota is the per-account transcription limit returned by a
+// transcription_kickoff task's quota_handler
+// (elevenlabs.get_recording_transcription_quota). A nil limit is unlimited.
+type TranscriptionQuota struct {
+	AccountID           int64    `json:"account_id"`
+	MaxRecordingSeconds *float64 `json:"max_recording_seconds"`
+	DailySeconds        *float64 `json:"daily_seconds"`
+	UsedSeconds         float64  `json:"used_seconds"`
+}
+
+// Check returns a ValidationError when transcribing a recording of the given
+// duration (nil when unknown) would exceed the quota. An unknown duration only
+// fails once the daily allowance is already used up.
+func (q *TranscriptionQuota) Check(durationSeconds *float64) error {
+	if durationSeconds == nil {
+		if q.DailySeconds != nil && q.UsedSeconds >= *q.DailySeconds {
+			return &ValidationError{Message: fmt.Sprintf(
+				"transcription quota exceeded: %.0fs of %.0fs daily allowance used", q.UsedSeconds, *q.DailySeconds)}
+		}
+		return nil
+	}
+
+	duration := *durationSeconds
+	if q.MaxRecordingSeconds != nil && duration > *q.MaxRecordingSeconds {
+		return &ValidationError{Message: fmt.Sprintf(
+			"recording is %.0fs, over the %.0fs per-recording transcription limit", duration, *q.MaxRecordingSeconds)}
+	}
+	if q.DailySeconds != nil && q.UsedSeconds+duration > *q.DailySeconds {
+		return &ValidationError{Message: fmt.Sprintf(
+			"transcription quota exceeded: %.0fs recording with %.0fs of %.0fs daily allowance used",
+			duration, q.UsedSeconds, *q.DailySeconds)}
+	}
+	return nil
 }
 
 // TranscriptionKickoffResult represents the result returned from the worker
-// after successfully kicking off a transcription request to ElevenLabs.
-// The RequestID is the ElevenLabs request_id returned from the async API call.
+// after successfully kicking off a transcription request. Provider is the
+// provider that accepted it (elevenlabs, deepgram or whisper) and RequestID
+// the request id it returned from the async API call, which its callback
+// carries. Synchronous providers (whisper) return the Transcript itself,
+// which the success handler stores; there is no callback to wait for.
+//
+// Model is the model the provider was asked for. DurationSeconds is the
+// audio's length, from the kickoff payload or the provider's response, and
+// CostUSD what the transcription costs at PricePerMinuteUSD, the configured
+// price of the provider and model; each is nil when unknown.
 type TranscriptionKickoffResult struct {
-	RequestID string `json:"request_id"`
+	Provider          string      `json:"provider"`
+	RequestID         string      `json:"request_id"`
+	Model             string      `json:"model,omitempty"`
+	Transcript        *Transcript `json:"transcript,omitempty"`
+	DurationSeconds   *float64    `json:"duration_seconds,omitempty"`
+	PricePerMinuteUSD *float64    `json:"price_per_minute_usd,omitempty"`
+	CostUSD           *float64    `json:"cost_usd,omitempty"`
+}
+
+// Transcript is a finished transcription, in the shape
+// learning.recording_transcript stores.
+type Transcript struct {
+	Text                string           `json:"text"`
+	Words               []TranscriptWord `json:"words"`
+	LanguageCode        string           `json:"language_code,omitempty"`
+	LanguageProbability *float64         `json:"language_probability,omitempty"`
+}
+
+// TranscriptWord is a word of a Transcript with its timing in seconds. Type
+// is word, or for ElevenLabs also spacing or audio_event; SpeakerID is set
+// by providers that diarize.
+type TranscriptWord struct {
+	Text      string  `json:"text"`
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	Type      string  `json:"type"`
+	SpeakerID string  `json:"speaker_id,omitempty"`
 }
 
 // ElevenLabsAsyncResponse represents the response from ElevenLabs when
@@ -20,3 +107,68 @@ type TranscriptionKickoffResult struct {
 type ElevenLabsAsyncResponse struct {
 	RequestID string `json:"request_id"`
 }
+
+// TranscriptionPollPayload represents the payload for transcription_poll
+// tasks after being prepared by the before_handler in Postgres
+// (elevenlabs.get_recording_transcription_poll_payload).
+type TranscriptionPollPayload struct {
+	RecordingTranscriptionAttemptID int64  `json:"recording_transcription_attempt_id"`
+	RequestID                       string `json:"request_id"`
+}
+
+// TranscriptionPollResult is recorded by the DB success_handler after
+// polling ElevenLabs for a transcript. Status is "completed" with the
+// Transcript as ElevenLabs returned it, or "processing" while it is not
+// ready; the supervisor schedules the next poll.
+type TranscriptionPollResult struct {
+	RequestID  string          `json:"request_id"`
+	Status     string          `json:"status"`
+	Transcript json.RawMessage `json:"transcript,omitempty"`
+}
+
+// TranscriptCleanupPayload represents the payload for transcript_cleanup
+// tasks after being prepared by the before_handler in Postgres
+// (learning.get_recording_transcript_cleanup_payload): a stored transcript
+// as learning.recording_transcript holds it.
+type TranscriptCleanupPayload struct {
+	ProfileCueRecordingID int64            `json:"profile_cue_recording_id"`
+	Text                  string           `json:"text"`
+	Words                 []TranscriptWord `json:"words"`
+	LanguageCode          string           `json:"language_code,omitempty"`
+}
+
+// TranscriptCleanupResult is the cleaned transcript recorded by the DB
+// success_handler: its text, paragraphs separated by blank lines, the
+// paragraphs with their words and timestamps, and how many filler words were
+// removed.
+type TranscriptCleanupResult struct {
+	Text           string                `json:"text"`
+	Paragraphs     []TranscriptParagraph `json:"paragraphs"`
+	FillersRemoved int                   `json:"fillers_removed"`
+}
+
+// TranscriptParagraph is a paragraph of a cleaned transcript, spanning
+// Start to End seconds of the recording.
+type TranscriptParagraph struct {
+	Text  string           `json:"text"`
+	Start float64          `json:"start"`
+	End   float64          `json:"end"`
+	Words []TranscriptWord `json:"words"`
+}
+
+// TranscriptionArchivePayload represents the payload for transcription_archive
+// tasks after being prepared by the before_handler in Postgres
+// (elevenlabs.get_recording_transcription_archive_payload): the upload intent
+// the archive goes to and the provider's full response.
+type TranscriptionArchivePayload struct {
+	ProfileCueRecordingID int64           `json:"profile_cue_recording_id"`
+	UploadIntentID        int64           `json:"upload_intent_id"`
+	Response              json.RawMessage `json:"response"`
+}
+
+// TranscriptionArchiveResult is recorded by the DB success_handler once the
+// response is uploaded, creating the archive's file.
+type TranscriptionArchiveResult struct {
+	UploadIntentID int64 `json:"upload_intent_id"`
+	SizeBytes      int   `json:"size_bytes"`
+}
@@ -0,0 +1,33 @@
+package types
+
+// VerifyOTPSendPayload represents the payload structure for verify_otp_send
+// tasks: start a Twilio Verify verification, which sends the code.
+type VerifyOTPSendPayload struct {
+	VerificationID int64  `json:"verification_id"`
+	ToNumber       string `json:"to_number"`
+	// Channel is sms (the default), call or whatsapp.
+	Channel string `json:"channel,omitempty"`
+	// Locale overrides the language of the message, e.g. "fr".
+	Locale string `json:"locale,omitempty"`
+}
+
+// VerifyOTPCheckPayload represents the payload structure for
+// verify_otp_check tasks: check a code the user entered. The verification is
+// identified by VerificationSID when set, otherwise by ToNumber.
+type VerifyOTPCheckPayload struct {
+	VerificationID  int64  `json:"verification_id"`
+	ToNumber        string `json:"to_number,omitempty"`
+	VerificationSID string `json:"verification_sid,omitempty"`
+	Code            string `json:"code"`
+}
+
+// VerifyOTPResult is what the success handlers receive. Status is Twilio's
+// verification status (pending, approved, canceled), or expired when the
+// verification no longer exists and max_attempts_reached when too many
+// codes were checked; Valid is true only for an approved check.
+type VerifyOTPResult struct {
+	VerificationSID string `json:"verification_sid,omitempty"`
+	Status          string `json:"status"`
+	Channel         string `json:"channel,omitempty"`
+	Valid           bool   `json:"valid"`
+}
@@ -0,0 +1,25 @@
+package types
+
+import "encoding/json"
+
+// WebhookPayload is the request a webhook task's before_handler returns for
+// the worker to deliver.
+type WebhookPayload struct {
+	URL string `json:"url"`
+	// Method defaults to POST.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is sent as-is when it is a JSON string, otherwise as JSON.
+	Body json.RawMessage `json:"body,omitempty"`
+	// HMACSecret, when set, signs the request (see the webhook service).
+	HMACSecret string `json:"hmac_secret,omitempty"`
+	// TimeoutSeconds bounds the request; 0 uses the service default.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// WebhookResult records the receiver's response to a delivered webhook.
+type WebhookResult struct {
+	StatusCode  int    `json:"status_code"`
+	LatencyMS   int64  `json:"latency_ms"`
+	BodySnippet string `json:"body_snippet,omitempty"`
+}
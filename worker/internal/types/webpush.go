@@ -0,0 +1,38 @@
+package types
+
+import "encoding/json"
+
+// WebPushPayload represents the payload structure for web_push tasks: one
+// message delivered to every browser subscription.
+type WebPushPayload struct {
+	MessageID     int64                 `json:"message_id"`
+	Subscriptions []WebPushSubscription `json:"subscriptions"`
+	// Data is the JSON the service worker receives in its push event.
+	Data json.RawMessage `json:"data"`
+	// TTLSeconds is how long the push service keeps the message for an
+	// offline browser; 0 uses a day.
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+	// Urgency is very-low, low, normal or high.
+	Urgency string `json:"urgency,omitempty"`
+	// Topic replaces a pending message with the same topic.
+	Topic string `json:"topic,omitempty"`
+}
+
+// WebPushSubscription is a browser's PushSubscription as returned by
+// pushManager.subscribe().
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// WebPushResult reports the outcome per subscription, by endpoint.
+// ExpiredSubscriptions were answered 404 or 410 by the push service and
+// should be removed; FailedSubscriptions failed for a transient reason.
+type WebPushResult struct {
+	Sent                 int      `json:"sent"`
+	ExpiredSubscriptions []string `json:"expired_subscriptions,omitempty"`
+	FailedSubscriptions  []string `json:"failed_subscriptions,omitempty"`
+}
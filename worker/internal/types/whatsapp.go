@@ -0,0 +1,30 @@
+package types
+
+import "encoding/json"
+
+// WhatsAppMessagePayload represents the payload structure for
+// whatsapp_message tasks. Messages are sent as approved templates, the only
+// kind WhatsApp delivers outside a 24-hour customer service window.
+type WhatsAppMessagePayload struct {
+	MessageID int64  `json:"message_id"`
+	ToNumber  string `json:"to_number"`
+	// Template is the approved template name, in Language (e.g. "en_US").
+	Template string `json:"template"`
+	Language string `json:"language"`
+	// HeaderParameters and BodyParameters fill the template's {{1}}, {{2}},
+	// ... placeholders in order, as text.
+	HeaderParameters []string `json:"header_parameters,omitempty"`
+	BodyParameters   []string `json:"body_parameters,omitempty"`
+	// Components, when set, is sent as the template's components as given
+	// (Cloud API format) instead of being built from the parameters, for
+	// media headers and button parameters.
+	Components json.RawMessage `json:"components,omitempty"`
+}
+
+// WhatsAppMessageResult is what the success handler receives: the message
+// id WhatsApp assigned (wamid) and the recipient's WhatsApp id.
+type WhatsAppMessageResult struct {
+	WhatsAppMessageID string `json:"whatsapp_message_id"`
+	WaID              string `json:"wa_id,omitempty"`
+	Status            string `json:"status,omitempty"`
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
+)
+
+// autoscale starts MinConcurrency processing goroutines and then, in the
+// background, resizes the pool every AutoscaleInterval to match the sampled
+// queue depth. Scaling up is immediate; scaling down stops the newest
+// goroutines, each after it finishes its current task. If the depth cannot be
+// sampled the pool keeps its current size.
+func (w *Worker) autoscale(ctx context.Context, spawn func(workerIndex int, stop <-chan struct{})) {
+	var stops []chan struct{}
+	resize := func(size int) {
+		for len(stops) < size {
+			stop := make(chan struct{})
+			spawn(len(stops), stop)
+			stops = append(stops, stop)
+		}
+		for len(stops) > size {
+			close(stops[len(stops)-1])
+			stops = stops[:len(stops)-1]
+		}
+		w.poolSize.Store(int64(size))
+		metrics.WorkerGoroutines.Set(float64(size))
+	}
+	resize(w.cfg.MinConcurrency)
+
+	logger.Info(ctx, "starting queue-depth autoscaler", logger.Fields{
+		"min_concurrency":  w.cfg.MinConcurrency,
+		"max_concurrency":  w.cfg.MaxConcurrency,
+		"interval":         w.cfg.AutoscaleInterval,
+		"tasks_per_worker": w.cfg.AutoscaleTasksPerWorker,
+	})
+
+	go func() {
+		ticker := time.NewTicker(w.cfg.AutoscaleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			depth, err := w.db.QueueDepth(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error(ctx, "failed to sample queue depth", err)
+				}
+				continue
+			}
+			metrics.QueueDepth.Set(float64(depth))
+
+			size := w.targetConcurrency(depth)
+			if size == len(stops) {
+				continue
+			}
+			logger.Info(ctx, "resizing worker pool", logger.Fields{
+				"queue_depth": depth,
+				"from":        len(stops),
+				"to":          size,
+			})
+			resize(size)
+		}
+	}()
+}
+
+// targetConcurrency is one goroutine per AutoscaleTasksPerWorker ready tasks
+// (rounded up), clamped to [MinConcurrency, MaxConcurrency].
+func (w *Worker) targetConcurrency(depth int64) int {
+	perWorker := int64(w.cfg.AutoscaleTasksPerWorker)
+	target := (depth + perWorker - 1) / perWorker
+	if target < int64(w.cfg.MinConcurrency) {
+		return w.cfg.MinConcurrency
+	}
+	if target > int64(w.cfg.MaxConcurrency) {
+		return w.cfg.MaxConcurrency
+	}
+	return int(target)
+}
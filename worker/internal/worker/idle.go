@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// idlePoll paces one polling goroutine. Each empty or failed poll doubles the
+// wait, from the loop's base interval up to max, and a hit resets it so a busy
+// queue is drained at full speed. Every wait is jittered by up to half its
+// length either way, so goroutines started together drift apart instead of
+// hitting the database in lockstep.
+type idlePoll struct {
+	base    time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+// newIdlePoll returns an idlePoll starting at base and capped at maxInterval.
+// A cap below base disables the backoff; waits are still jittered around base.
+func newIdlePoll(base, maxInterval time.Duration) *idlePoll {
+	return &idlePoll{base: base, max: max(base, maxInterval), current: base}
+}
+
+// wait sleeps for the current interval, jittered, then doubles the interval
+// for the next miss.
+func (p *idlePoll) wait() {
+	time.Sleep(jitter(p.current))
+	p.current = min(p.current*2, p.max)
+}
+
+// reset returns to the base interval after a hit.
+func (p *idlePoll) reset() {
+	p.current = p.base
+}
+
+// jitter returns a random duration in [d/2, 3d/2), which keeps the mean at d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + rand.N(d)
+}
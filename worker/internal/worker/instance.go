@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// fleetStaleHeartbeats is how many heartbeat intervals an instance may miss
+// before the fleet view reports it as stale.
+const fleetStaleHeartbeats = 3
+
+// Version identifies the worker build. It is set at build time with
+// -ldflags "-X github.com/bencyrus/chatterbox/worker/internal/worker.Version=...";
+// otherwise the VCS revision embedded by the Go toolchain is used, if any.
+var Version = "dev"
+
+// Instance describes this worker process as registered in
+// queues.worker_instance.
+type Instance struct {
+	ID              string         `json:"id"`
+	Hostname        string         `json:"hostname"`
+	Version         string         `json:"version"`
+	Concurrency     int            `json:"concurrency"`
+	InFlight        map[string]int `json:"in_flight"`
+	StartedAt       time.Time      `json:"started_at"`
+	LastHeartbeatAt *time.Time     `json:"last_heartbeat_at,omitempty"`
+	LastPollAt      *time.Time     `json:"last_poll_at,omitempty"`
+}
+
+// newInstance identifies this process as <hostname>:<pid>, matching the
+// scheduler lease holder.
+func newInstance() Instance {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "worker"
+	}
+	return Instance{
+		ID:        fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		Hostname:  hostname,
+		Version:   buildVersion(),
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+func buildVersion() string {
+	if Version != "dev" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return Version
+}
+
+// Instance reports this worker process, what it is processing, and its
+// latest successful heartbeat and queue poll.
+func (w *Worker) Instance() Instance {
+	inst := w.instance
+	inst.Concurrency = int(w.poolSize.Load())
+	inst.InFlight = w.inFlight.snapshot()
+	inst.LastHeartbeatAt = unixNanoTime(w.lastHeartbeatAt.Load())
+	inst.LastPollAt = unixNanoTime(w.lastDequeueAt.Load())
+	return inst
+}
+
+// Fleet lists the worker instances registered in queues.worker_instance.
+// Instances that missed fleetStaleHeartbeats heartbeats are reported stale;
+// stopped instances are listed only with includeStopped.
+func (w *Worker) Fleet(ctx context.Context, includeStopped bool) ([]types.WorkerInstance, error) {
+	return w.db.WorkerFleet(ctx, fleetStaleHeartbeats*w.cfg.HeartbeatInterval, includeStopped)
+}
+
+// unixNanoTime converts a stored UnixNano timestamp, with 0 meaning never.
+func unixNanoTime(nanos int64) *time.Time {
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos).UTC()
+	return &t
+}
+
+// inFlightCounter counts the tasks being processed, by task type.
+type inFlightCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// start counts a task of taskType as in flight until the returned func runs.
+func (c *inFlightCounter) start(taskType string) func() {
+	c.mu.Lock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[taskType]++
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.counts[taskType]--; c.counts[taskType] <= 0 {
+			delete(c.counts, taskType)
+		}
+	}
+}
+
+func (c *inFlightCounter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(c.counts))
+	for taskType, n := range c.counts {
+		out[taskType] = n
+	}
+	return out
+}
+
+// heartbeat registers this instance and then refreshes it every
+// HeartbeatInterval until ctx is canceled, when the instance is marked
+// stopped. Failures are logged and retried on the next tick; an instance that
+// stops heartbeating is reported by queues.dead_worker_instances.
+func (w *Worker) heartbeat(ctx context.Context) {
+	fields := logger.Fields{
+		"worker_instance_id": w.instance.ID,
+		"version":            w.instance.Version,
+	}
+
+	registered := false
+	beat := func() {
+		inst := w.Instance()
+		var err error
+		if registered {
+			err = w.db.HeartbeatWorkerInstance(ctx, inst.ID, inst.Concurrency, inst.InFlight, inst.LastPollAt)
+		} else {
+			err = w.db.RegisterWorkerInstance(ctx, inst.ID, inst.Hostname, inst.Version, inst.Concurrency)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error(ctx, "failed to heartbeat worker instance", err, fields)
+			}
+			return
+		}
+		if !registered {
+			logger.Info(ctx, "registered worker instance", fields)
+			registered = true
+		}
+		w.lastHeartbeatAt.Store(time.Now().UnixNano())
+	}
+
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		beat()
+
+		select {
+		case <-ctx.Done():
+			if registered {
+				stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				if err := w.db.StopWorkerInstance(stopCtx, w.instance.ID); err != nil {
+					logger.Warn(ctx, "failed to mark worker instance stopped", logger.Fields{"error": err.Error()})
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/processing"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// Task outcome statuses reported by the "task finished" log line.
+const (
+	outcomeSucceeded        = "succeeded"
+	outcomeFailed           = "failed"
+	outcomeValidationFailed = "validation_failed"
+	outcomeRetryScheduled   = "retry_scheduled"
+	outcomeDeferred         = "deferred"
+	outcomeUncommitted      = "uncommitted"
+)
+
+// logOutcome emits the canonical log line for one handled task: a single
+// "task finished" entry with everything needed to chart task health
+// (status, error class, queue wait, processing and handler durations), so
+// dashboards do not have to join the scattered per-step messages.
+func logOutcome(ctx context.Context, task *types.Task, status string, err error, dequeuedAt time.Time, elapsed time.Duration) {
+	fields := logger.Fields{
+		"task_id":       task.TaskID,
+		"task_type":     task.TaskType,
+		"status":        status,
+		"processing_ms": elapsed.Milliseconds(),
+		"total_ms":      time.Since(dequeuedAt).Milliseconds(),
+	}
+	if !task.EnqueuedAt.IsZero() {
+		fields["queue_wait_ms"] = dequeuedAt.Sub(task.EnqueuedAt).Milliseconds()
+	}
+	if handlers := processing.HandlerDurations(ctx); handlers != nil {
+		fields["handler_ms"] = handlers
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+		if class := types.ErrorClassName(err); class != "" {
+			fields["error_class"] = class
+		}
+	}
+	logger.Info(ctx, "task finished", fields)
+}
@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/processing"
+	"github.com/bencyrus/chatterbox/worker/internal/simulate"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// SimulationResult is the outcome of one simulated task.
+type SimulationResult struct {
+	TaskID        int64                   `json:"task_id"`
+	TaskType      string                  `json:"task_type"`
+	Status        string                  `json:"status"`
+	WorkerPayload any                     `json:"worker_payload,omitempty"`
+	Error         string                  `json:"error,omitempty"`
+	ErrorClass    string                  `json:"error_class,omitempty"`
+	RescheduleAt  *time.Time              `json:"reschedule_at,omitempty"`
+	NextTasks     []types.NextTask        `json:"next_tasks,omitempty"`
+	FunctionCalls []simulate.FunctionCall `json:"function_calls"`
+}
+
+// Simulate runs each fixture task through its processor and handlers without
+// a database and writes one SimulationResult per task to out as a JSON line.
+// Handler and db_function calls are answered from the fixture; provider calls
+// go through http.DefaultTransport, which the caller replaces with a
+// simulate.Transport before calling Simulate.
+//
+// Nothing is retried, deferred or enqueued: a task runs once and the result
+// reports what the worker would have done with it.
+func Simulate(ctx context.Context, cfg config.Config, fixture *simulate.Fixture, out io.Writer) error {
+	store := simulate.NewStore(fixture.Handlers)
+	handlers := processing.NewHandlerInvoker(store, cfg.DryRun)
+	dispatcher, err := newDispatcher(cfg, store, handlers, newServices(cfg, store))
+	if err != nil {
+		return err
+	}
+	w := &Worker{cfg: cfg, dispatcher: dispatcher, handlers: handlers}
+
+	enc := json.NewEncoder(out)
+	for i := range fixture.Tasks {
+		result := w.simulateTask(ctx, &fixture.Tasks[i])
+		result.FunctionCalls = store.TakeCalls()
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("failed to write simulation result: %w", err)
+		}
+	}
+	return nil
+}
+
+// simulateTask processes task and calls its handlers the way handleTaskResult
+// does, minus every queue write.
+func (w *Worker) simulateTask(ctx context.Context, task *types.Task) SimulationResult {
+	ctx = processing.WithSideEffectClaims(ctx)
+	ctx = processing.WithHandlerTimings(ctx)
+
+	r := SimulationResult{TaskID: task.TaskID, TaskType: task.TaskType}
+	fail := func(err error) SimulationResult {
+		r.Status = outcomeFailed
+		r.Error = err.Error()
+		r.ErrorClass = types.ErrorClassName(err)
+		return r
+	}
+
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return fail(fmt.Errorf("failed to unmarshal task payload: %w", err))
+	}
+	processor, err := w.dispatcher.Get(task)
+	if err != nil {
+		return fail(err)
+	}
+
+	var result *types.TaskResult
+	if err := w.dispatcher.Validate(processor, task); err != nil {
+		result = types.NewTaskFailure(err)
+	} else {
+		result = safeProcess(ctx, processor, task)
+	}
+
+	switch {
+	case result.Skipped:
+		r.Status = outcomeSucceeded
+	case result.ValidationFailure != "":
+		r.Status = outcomeValidationFailed
+		r.Error = result.ValidationFailure
+		w.handleValidationFailure(ctx, task, payload, result.ValidationFailure)
+	case !result.RescheduleAt.IsZero():
+		r.Status = outcomeDeferred
+		r.Error = result.Error.Error()
+		r.RescheduleAt = &result.RescheduleAt
+	case result.Success:
+		r.Status = outcomeSucceeded
+		r.WorkerPayload = result.WorkerPayload
+		r.NextTasks = result.NextTasks
+		if payload.SuccessHandler != "" {
+			nextTasks, err := w.handlers.CallSuccess(ctx, payload.SuccessHandler, task.Payload, result.WorkerPayload)
+			if err != nil {
+				logger.Error(ctx, "success handler failed", err)
+			}
+			r.NextTasks = append(r.NextTasks, nextTasks...)
+		}
+	default:
+		if payload.ErrorHandler != "" {
+			// Every simulated task runs as its first attempt.
+			if err := w.handlers.CallError(ctx, payload.ErrorHandler, task.Payload, result.Error, 1, w.maxAttempts(task.TaskType)); err != nil {
+				logger.Error(ctx, "error handler failed", err)
+			}
+		}
+		return fail(result.Error)
+	}
+	return r
+}
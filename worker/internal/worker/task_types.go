@@ -0,0 +1,292 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/config"
+	"github.com/bencyrus/chatterbox/worker/internal/types"
+)
+
+// typeShare is the number of dequeue slots allocated to one task type.
+type typeShare struct {
+	taskType string
+	slots    int
+}
+
+// weightedTypes splits dequeue slots between task types with smooth weighted
+// round-robin, so even one-task cycles follow the configured ratio over time.
+type weightedTypes struct {
+	mu      sync.Mutex
+	types   []string
+	weights map[string]int
+	current map[string]int
+}
+
+// newWeightedTypes returns nil when no weights are configured.
+func newWeightedTypes(weights map[string]int) *weightedTypes {
+	if len(weights) == 0 {
+		return nil
+	}
+	taskTypes := make([]string, 0, len(weights))
+	for taskType := range weights {
+		taskTypes = append(taskTypes, taskType)
+	}
+	sort.Strings(taskTypes)
+	return &weightedTypes{
+		types:   taskTypes,
+		weights: weights,
+		current: make(map[string]int, len(weights)),
+	}
+}
+
+// allocate distributes n slots among the task types for which eligible
+// returns true.
+func (wt *weightedTypes) allocate(n int, eligible func(taskType string) bool) []typeShare {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	slots := make(map[string]int)
+	for i := 0; i < n; i++ {
+		total, best := 0, ""
+		for _, taskType := range wt.types {
+			if !eligible(taskType) {
+				continue
+			}
+			wt.current[taskType] += wt.weights[taskType]
+			total += wt.weights[taskType]
+			if best == "" || wt.current[taskType] > wt.current[best] {
+				best = taskType
+			}
+		}
+		if best == "" {
+			break
+		}
+		wt.current[best] -= total
+		slots[best]++
+	}
+
+	shares := make([]typeShare, 0, len(slots))
+	for _, taskType := range wt.types {
+		if slots[taskType] > 0 {
+			shares = append(shares, typeShare{taskType: taskType, slots: slots[taskType]})
+		}
+	}
+	return shares
+}
+
+// dequeue claims up to n tasks. With TaskTypeWeights each weighted type is
+// first offered its share of the n slots; slots left unclaimed, and all slots
+// otherwise, go to the regular dequeue in scheduled order. A restricted worker
+// (EnabledProcessors) claims only its runnable task types, so tasks it has no
+// processor for stay queued for other instances instead of failing here.
+// Task types of named queues are left to their queue's pool.
+func (w *Worker) dequeue(ctx context.Context, n int) ([]*types.Task, error) {
+	var tasks []*types.Task
+	if w.weights != nil {
+		eligible := func(taskType string) bool {
+			_, queued := w.queued[taskType]
+			return !queued && !w.dispatcher.Paused(taskType)
+		}
+		for _, share := range w.weights.allocate(n, eligible) {
+			claimed, err := w.db.DequeueTasksOfTypes(ctx, share.slots, []string{share.taskType})
+			if err != nil {
+				// Hand over what was claimed; the regular dequeue below
+				// still fills the remaining slots.
+				logger.Error(ctx, "failed to dequeue weighted task type", err, logger.Fields{"task_type": share.taskType})
+				break
+			}
+			tasks = append(tasks, claimed...)
+		}
+	}
+
+	remaining := n - len(tasks)
+	if remaining <= 0 {
+		return tasks, nil
+	}
+
+	var more []*types.Task
+	var err error
+	if w.restricted {
+		more, err = w.db.DequeueTasksOfTypes(ctx, remaining, w.unqueued(w.dispatcher.Runnable()))
+	} else if n == 1 {
+		var task *types.Task
+		task, err = w.db.DequeueNextTask(ctx, w.excluded())
+		if task != nil {
+			more = []*types.Task{task}
+		}
+	} else {
+		more, err = w.db.DequeueTasks(ctx, remaining, w.excluded())
+	}
+	if err != nil {
+		if len(tasks) == 0 {
+			return nil, err
+		}
+		logger.Error(ctx, "failed to dequeue remaining tasks", err)
+	}
+	return append(tasks, more...), nil
+}
+
+// unqueued returns taskTypes without those of named queues.
+func (w *Worker) unqueued(taskTypes []string) []string {
+	if len(w.queued) == 0 {
+		return taskTypes
+	}
+	kept := make([]string, 0, len(taskTypes))
+	for _, taskType := range taskTypes {
+		if _, queued := w.queued[taskType]; !queued {
+			kept = append(kept, taskType)
+		}
+	}
+	return kept
+}
+
+// excluded returns the task types the regular dequeue must not claim: those
+// disabled on this instance and those of named queues, in sorted order.
+func (w *Worker) excluded() []string {
+	excluded := w.dispatcher.Disabled()
+	if len(w.queued) == 0 {
+		return excluded
+	}
+	for taskType := range w.queued {
+		if !slices.Contains(excluded, taskType) {
+			excluded = append(excluded, taskType)
+		}
+	}
+	sort.Strings(excluded)
+	return excluded
+}
+
+// pollQueue is one goroutine of a named queue's pool (Queues). It claims only
+// the queue's runnable task types, one task at a time, polling every
+// q.PollInterval, backing off towards MaxPollInterval while idle, and again
+// immediately after a hit.
+func (w *Worker) pollQueue(ctx context.Context, q config.Queue, workerIndex int) {
+	logger.Info(ctx, "starting queue poller", logger.Fields{
+		"queue":        q.Name,
+		"task_types":   q.TaskTypes,
+		"worker_index": workerIndex,
+		"interval":     q.PollInterval,
+	})
+
+	idle := newIdlePoll(q.PollInterval, w.cfg.MaxPollInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		runnable := make([]string, 0, len(q.TaskTypes))
+		for _, taskType := range q.TaskTypes {
+			if !w.dispatcher.Paused(taskType) {
+				runnable = append(runnable, taskType)
+			}
+		}
+		if len(runnable) == 0 {
+			idle.wait()
+			continue
+		}
+
+		tasks, err := w.db.DequeueTasksOfTypes(ctx, 1, runnable)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error(ctx, "failed to dequeue queue task", err, logger.Fields{"queue": q.Name})
+			}
+			idle.wait()
+			continue
+		}
+		w.markDequeued()
+		if len(tasks) == 0 {
+			idle.wait()
+			continue
+		}
+
+		idle.reset()
+		w.handleTask(ctx, tasks[0])
+	}
+}
+
+// pollTaskType is a dedicated poller for one task type with its own interval
+// (TaskTypePollIntervals), so latency-sensitive types are picked up sooner
+// than the shared pool's PollInterval. It processes one task at a time and
+// polls again immediately after a hit. It never backs off beyond its interval,
+// only jitters it.
+func (w *Worker) pollTaskType(ctx context.Context, taskType string, interval time.Duration) {
+	logger.Info(ctx, "starting task type poller", logger.Fields{
+		"task_type": taskType,
+		"interval":  interval,
+	})
+
+	idle := newIdlePoll(interval, interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if w.dispatcher.Paused(taskType) {
+			idle.wait()
+			continue
+		}
+
+		tasks, err := w.db.DequeueTasksOfTypes(ctx, 1, []string{taskType})
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error(ctx, "failed to dequeue task type", err, logger.Fields{"task_type": taskType})
+			}
+			idle.wait()
+			continue
+		}
+		w.markDequeued()
+		if len(tasks) == 0 {
+			idle.wait()
+			continue
+		}
+
+		idle.reset()
+		w.handleTask(ctx, tasks[0])
+	}
+}
+
+// pollInteractive is one goroutine of the reserved interactive pool
+// (InteractiveConcurrency). It claims only runnable tasks whose payload sets
+// priority "interactive", one at a time, polling every (jittered)
+// InteractivePollInterval and again immediately after a hit.
+func (w *Worker) pollInteractive(ctx context.Context, workerIndex int) {
+	logger.Info(ctx, "starting interactive poller", logger.Fields{
+		"worker_index": workerIndex,
+		"interval":     w.cfg.InteractivePollInterval,
+	})
+
+	idle := newIdlePoll(w.cfg.InteractivePollInterval, w.cfg.InteractivePollInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		tasks, err := w.db.DequeueTasksOfPriority(ctx, 1, types.PriorityInteractive, w.dispatcher.Runnable())
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error(ctx, "failed to dequeue interactive task", err)
+			}
+			idle.wait()
+			continue
+		}
+		w.markDequeued()
+		if len(tasks) == 0 {
+			idle.wait()
+			continue
+		}
+
+		idle.reset()
+		w.handleTask(ctx, tasks[0])
+	}
+}
@@ -3,21 +3,47 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bencyrus/chatterbox/shared/logger"
+	"github.com/bencyrus/chatterbox/worker/internal/breaker"
 	"github.com/bencyrus/chatterbox/worker/internal/config"
 	"github.com/bencyrus/chatterbox/worker/internal/database"
+	"github.com/bencyrus/chatterbox/worker/internal/events"
+	"github.com/bencyrus/chatterbox/worker/internal/metrics"
+	"github.com/bencyrus/chatterbox/worker/internal/opsnotify"
 	"github.com/bencyrus/chatterbox/worker/internal/processing"
+	"github.com/bencyrus/chatterbox/worker/internal/ratelimit"
+	"github.com/bencyrus/chatterbox/worker/internal/scheduler"
+	"github.com/bencyrus/chatterbox/worker/internal/services/apns"
+	"github.com/bencyrus/chatterbox/worker/internal/services/discord"
 	"github.com/bencyrus/chatterbox/worker/internal/services/email"
+	"github.com/bencyrus/chatterbox/worker/internal/services/fcm"
 	"github.com/bencyrus/chatterbox/worker/internal/services/files"
 	"github.com/bencyrus/chatterbox/worker/internal/services/openai"
 	"github.com/bencyrus/chatterbox/worker/internal/services/sms"
+	"github.com/bencyrus/chatterbox/worker/internal/services/telegram"
+	"github.com/bencyrus/chatterbox/worker/internal/services/transcription"
+	"github.com/bencyrus/chatterbox/worker/internal/services/verify"
+	"github.com/bencyrus/chatterbox/worker/internal/services/webhook"
+	"github.com/bencyrus/chatterbox/worker/internal/services/webpush"
+	"github.com/bencyrus/chatterbox/worker/internal/services/whatsapp"
+	"github.com/bencyrus/chatterbox/worker/internal/templates"
 	"github.com/bencyrus/chatterbox/worker/internal/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/bencyrus/chatterbox/worker")
+
 type Worker struct {
 	cfg       config.Config
 	db        *database.Client
@@ -28,53 +54,479 @@ type Worker struct {
 
 	dispatcher *processing.Dispatcher
 	handlers   *processing.HandlerInvoker
+	events     *events.Recorder
+	scheduler  *scheduler.Scheduler
+	// ops reports persistent failures to operators; nil when disabled.
+	ops *opsnotify.Notifier
+
+	// lastDequeueAt holds the UnixNano time of the last successful dequeue
+	// round-trip (whether or not it returned a task).
+	lastDequeueAt atomic.Int64
+
+	// instance identifies this process in queues.worker_instance; poolSize is
+	// the current number of processing goroutines, inFlight the tasks they
+	// hold by task type, and lastHeartbeatAt the UnixNano time of the last
+	// successful heartbeat.
+	instance        Instance
+	poolSize        atomic.Int64
+	inFlight        inFlightCounter
+	lastHeartbeatAt atomic.Int64
+
+	// weights splits dequeue cycles between task types; nil without
+	// TaskTypeWeights.
+	weights *weightedTypes
+
+	// restricted limits the regular dequeue to the dispatcher's runnable
+	// task types (EnabledProcessors), instead of claiming any type.
+	restricted bool
+
+	// queued maps each task type of a named queue (Queues) to its queue;
+	// the regular dequeue leaves those types to the queue's pool.
+	queued map[string]string
+}
+
+// Readiness summarizes whether the worker can make progress: the database is
+// reachable, processors are registered, and the dequeue loop is alive.
+type Readiness struct {
+	Ready             bool       `json:"ready"`
+	DatabaseReachable bool       `json:"database_reachable"`
+	DatabaseError     string     `json:"database_error,omitempty"`
+	Processors        []string   `json:"processors"`
+	LastDequeueAt     *time.Time `json:"last_dequeue_at,omitempty"`
+	Instance          Instance   `json:"instance"`
+}
+
+// dbPoolBackgroundConns covers the worker's background loops that query the
+// database next to task processing: batch fetcher, scheduler, heartbeat,
+// autoscaler and paused-type refresh.
+const dbPoolBackgroundConns = 5
+
+// dbPoolDemand returns how many connections the worker's goroutines can hold
+// at once: one per goroutine of the (maximum) pool, the interactive pool,
+// named queue pools, dedicated task type pollers and background loops.
+func dbPoolDemand(cfg config.Config) int {
+	concurrency := cfg.Concurrency
+	if cfg.AutoscaleEnabled {
+		concurrency = cfg.MaxConcurrency
+	}
+	for _, q := range cfg.Queues {
+		concurrency += q.Concurrency
+	}
+	return concurrency + cfg.InteractiveConcurrency + len(cfg.TaskTypePollIntervals) + dbPoolBackgroundConns
 }
 
 func NewWorker(cfg config.Config) (*Worker, error) {
 	// Initialize database client
-	db, err := database.NewClient(cfg.DatabaseURL)
+	db, err := database.NewClient(cfg.DatabaseURL, database.Options{
+		DequeueMode:     cfg.DequeueMode,
+		MaxConns:        cfg.DBMaxOpenConns,
+		MinConns:        cfg.DBMinConns,
+		MaxConnLifetime: cfg.DBConnMaxLifetime,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database client: %w", err)
 	}
+	if maxConns, demand := db.PoolStats().MaxConns, dbPoolDemand(cfg); int(maxConns) < demand {
+		logger.Warn(context.Background(), "database pool is smaller than the goroutines querying it; raise DB_MAX_OPEN_CONNS", logger.Fields{
+			"max_conns":  maxConns,
+			"goroutines": demand,
+		})
+	}
+	metrics.RegisterDBPool(db.PoolStats)
 
-	// Initialize services
-	emailSvc := email.NewService(cfg.ResendAPIKey)
-	smsSvc := sms.NewService()
-	filesSvc := files.NewService(cfg.FileServiceURL, cfg.FileServiceAPIKey)
-	openAISvc := openai.NewService(cfg.OpenAIAPIKey)
-	// Build processing stack
-	handlers := processing.NewHandlerInvoker(db)
-	dispatcher := processing.NewDispatcher()
-	dispatcher.Register(processing.NewDBFunctionProcessor(db))
-	dispatcher.Register(processing.NewEmailProcessor(handlers, emailSvc))
-	dispatcher.Register(processing.NewSMSProcessor(handlers, smsSvc))
-	dispatcher.Register(processing.NewFileDeleteProcessor(handlers, filesSvc))
-	dispatcher.Register(processing.NewTranscriptionKickoffProcessor(handlers, filesSvc, cfg.ElevenLabsAPIKey))
-	dispatcher.Register(processing.NewOpenAIResponseCreateProcessor(handlers, openAISvc))
-	dispatcher.Register(processing.NewOpenAIResponseRetrieveProcessor(handlers, openAISvc))
+	// Initialize services and build processing stack
+	svc := newServices(cfg, db)
+	handlers := processing.NewHandlerInvoker(db, cfg.DryRun)
+	dispatcher, err := newDispatcher(cfg, db, handlers, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := make(map[string]bool)
+	for _, taskType := range dispatcher.TaskTypes() {
+		registered[taskType] = true
+	}
+	for taskType := range cfg.TaskTypeWeights {
+		if !registered[taskType] {
+			return nil, fmt.Errorf("invalid WORKER_TASK_TYPE_WEIGHTS: no processor registered for task type: %s", taskType)
+		}
+	}
+	for taskType := range cfg.TaskTypePollIntervals {
+		if !registered[taskType] {
+			return nil, fmt.Errorf("invalid WORKER_TASK_TYPE_POLL_INTERVALS: no processor registered for task type: %s", taskType)
+		}
+	}
+	for taskType := range cfg.TaskTypeMaxAttempts {
+		if !registered[taskType] {
+			return nil, fmt.Errorf("invalid WORKER_TASK_TYPE_MAX_ATTEMPTS: no processor registered for task type: %s", taskType)
+		}
+	}
+	queued := make(map[string]string)
+	for _, q := range cfg.Queues {
+		for _, taskType := range q.TaskTypes {
+			if !registered[taskType] {
+				return nil, fmt.Errorf("invalid WORKER_QUEUES: no processor registered for task type: %s", taskType)
+			}
+			if _, ok := cfg.TaskTypePollIntervals[taskType]; ok {
+				return nil, fmt.Errorf("invalid WORKER_QUEUES: task type %s also has a dedicated poller in WORKER_TASK_TYPE_POLL_INTERVALS", taskType)
+			}
+			queued[taskType] = q.Name
+		}
+	}
+
+	var sched *scheduler.Scheduler
+	if cfg.SchedulerEnabled {
+		sched = scheduler.NewScheduler(db, cfg.SchedulerInterval, cfg.SchedulerLeaseTTL)
+	}
 
 	return &Worker{
 		cfg:        cfg,
 		db:         db,
-		emailSvc:   emailSvc,
-		smsSvc:     smsSvc,
-		filesSvc:   filesSvc,
-		openAISvc:  openAISvc,
+		emailSvc:   svc.email,
+		smsSvc:     svc.sms,
+		filesSvc:   svc.files,
+		openAISvc:  svc.openAI,
 		dispatcher: dispatcher,
 		handlers:   handlers,
+		events:     events.NewRecorder(db),
+		scheduler:  sched,
+		ops: opsnotify.New(db, opsnotify.Options{
+			Function:           cfg.OpsNotifyFunction,
+			Cooldown:           cfg.OpsNotifyCooldown,
+			ErrorRateThreshold: cfg.OpsErrorRateThreshold,
+			ErrorRateWindow:    cfg.OpsErrorRateWindow,
+			ErrorRateMinTasks:  cfg.OpsErrorRateMinTasks,
+		}),
+		instance:   newInstance(),
+		weights:    newWeightedTypes(cfg.TaskTypeWeights),
+		restricted: len(cfg.EnabledProcessors) > 0,
+		queued:     queued,
 	}, nil
 }
 
+// services holds the provider clients processors call.
+type services struct {
+	email         *email.Service
+	sms           *sms.Service
+	webhook       *webhook.Service
+	discord       *discord.Service
+	telegram      *telegram.Service
+	fcm           *fcm.Service
+	apns          *apns.Service
+	webPush       *webpush.Service
+	verify        *verify.Service
+	whatsApp      *whatsapp.Service
+	files         *files.Service
+	openAI        *openai.Service
+	transcription *transcription.Service
+	elevenLabs    *transcription.ElevenLabsProvider
+}
+
+// newSMSProvider builds the SMS provider named name, or returns nil for an
+// empty name (no fallback).
+func newSMSProvider(cfg config.Config, name string, circuit func(string) *breaker.Breaker) sms.SMSProvider {
+	switch name {
+	case sms.ProviderTwilio:
+		twilio := sms.TwilioConfig{
+			AccountSID:          cfg.TwilioAccountSID,
+			AuthToken:           cfg.TwilioAuthToken,
+			FromNumber:          cfg.TwilioFromNumber,
+			MessagingServiceSID: cfg.TwilioMessagingServiceSID,
+			StatusCallbackURL:   cfg.TwilioStatusCallbackURL,
+		}
+		return sms.NewTwilioProvider(twilio, ratelimit.New(ratelimit.ProviderTwilio, cfg.TwilioRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderTwilio))
+	case sms.ProviderVonage:
+		vonage := sms.VonageConfig{APIKey: cfg.VonageAPIKey, APISecret: cfg.VonageAPISecret, From: cfg.VonageFrom}
+		return sms.NewVonageProvider(vonage, ratelimit.New(ratelimit.ProviderVonage, cfg.VonageRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderVonage))
+	case sms.ProviderConsole:
+		return sms.ConsoleProvider{}
+	}
+	return nil
+}
+
+// newTranscriptionProvider builds the transcription provider named name, or
+// returns nil for an empty name (no fallback). Whisper shares OpenAI's rate
+// limit and circuit breaker; ElevenLabs is shared with transcription_poll.
+func newTranscriptionProvider(cfg config.Config, name string, circuit func(string) *breaker.Breaker, whisper *transcription.WhisperProvider, elevenLabs *transcription.ElevenLabsProvider) transcription.TranscriptionProvider {
+	switch name {
+	case transcription.ProviderWhisper:
+		return whisper
+	case transcription.ProviderElevenLabs:
+		return elevenLabs
+	case transcription.ProviderDeepgram:
+		deepgram := transcription.DeepgramConfig{APIKey: cfg.DeepgramAPIKey, CallbackURL: cfg.DeepgramCallbackURL}
+		return transcription.NewDeepgramProvider(deepgram, ratelimit.New(ratelimit.ProviderDeepgram, cfg.DeepgramRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderDeepgram))
+	}
+	return nil
+}
+
+// newEmailProviders builds every email provider, so that messages can name
+// any of them, keyed by name.
+func newEmailProviders(cfg config.Config, circuit func(string) *breaker.Breaker) map[string]email.EmailProvider {
+	ses := email.SESConfig{Region: cfg.SESRegion, AccessKeyID: cfg.SESAccessKeyID, SecretAccessKey: cfg.SESSecretAccessKey}
+	return map[string]email.EmailProvider{
+		email.ProviderResend:   email.NewResendProvider(cfg.ResendAPIKey, ratelimit.New(ratelimit.ProviderResend, cfg.ResendRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderResend)),
+		email.ProviderSES:      email.NewSESProvider(ses, ratelimit.New(ratelimit.ProviderSES, cfg.SESRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderSES)),
+		email.ProviderSendGrid: email.NewSendGridProvider(cfg.SendGridAPIKey, ratelimit.New(ratelimit.ProviderSendGrid, cfg.SendGridRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderSendGrid)),
+	}
+}
+
+// newEmailService builds the email service: in capture mode one that only
+// captures, otherwise the configured provider with its fallback.
+func newEmailService(cfg config.Config, functions processing.FunctionRunner, circuit func(string) *breaker.Breaker) *email.Service {
+	if cfg.EmailMode == "capture" {
+		return email.NewCaptureService(email.NewCaptureProvider(cfg.EmailCaptureSMTPAddr, functions))
+	}
+	providers := newEmailProviders(cfg, circuit)
+	var fallback email.EmailProvider
+	if cfg.EmailFallbackProvider != "" {
+		fallback = providers[cfg.EmailFallbackProvider]
+	}
+	return email.NewService(providers[cfg.EmailProvider], fallback, providers[email.ProviderResend], providers[email.ProviderSES], providers[email.ProviderSendGrid])
+}
+
+// newServices builds the provider clients. Outbound rate limits and circuit
+// breakers are one per provider, shared by all goroutines. functions stores
+// captured emails in capture mode.
+func newServices(cfg config.Config, functions processing.FunctionRunner) services {
+	circuit := func(provider string) *breaker.Breaker {
+		return breaker.New(provider, cfg.CircuitFailureThreshold, cfg.CircuitCooldown)
+	}
+	filesService := files.NewService(cfg.FileServiceURL, cfg.FileServiceAPIKey, ratelimit.New(ratelimit.ProviderFiles, cfg.FileServiceRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderFiles))
+	openAILimiter := ratelimit.New(ratelimit.ProviderOpenAI, cfg.OpenAIRPS, cfg.RateLimitMaxWait)
+	openAICircuit := circuit(ratelimit.ProviderOpenAI)
+	whisper := transcription.NewWhisperProvider(cfg.OpenAIAPIKey, filesService.OpenFile, openAILimiter, openAICircuit)
+	elevenLabs := transcription.NewElevenLabsProvider(cfg.ElevenLabsAPIKey, cfg.ElevenLabsInteractiveModel, ratelimit.New(ratelimit.ProviderElevenLabs, cfg.ElevenLabsRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderElevenLabs))
+	transcriptionService := transcription.NewService(
+		newTranscriptionProvider(cfg, cfg.TranscriptionProvider, circuit, whisper, elevenLabs),
+		newTranscriptionProvider(cfg, cfg.TranscriptionFallbackProvider, circuit, whisper, elevenLabs),
+		whisper, cfg.WhisperMaxSeconds,
+		transcription.DefaultPricing.With(cfg.TranscriptionPrices),
+	)
+	return services{
+		email:         newEmailService(cfg, functions, circuit),
+		sms:           sms.NewService(newSMSProvider(cfg, cfg.SMSProvider, circuit), newSMSProvider(cfg, cfg.SMSFallbackProvider, circuit)),
+		webhook:       webhook.NewService(),
+		discord:       discord.NewService(ratelimit.New(ratelimit.ProviderDiscord, cfg.DiscordRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderDiscord)),
+		telegram:      telegram.NewService(cfg.TelegramBotToken, ratelimit.New(ratelimit.ProviderTelegram, cfg.TelegramRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderTelegram)),
+		fcm:           fcm.NewService(cfg.FCMProjectID, cfg.FCMServiceAccountEmail, cfg.FCMServiceAccountPrivateKey, ratelimit.New(ratelimit.ProviderFCM, cfg.FCMRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderFCM)),
+		apns:          apns.NewService(cfg.APNsTeamID, cfg.APNsKeyID, cfg.APNsPrivateKey, cfg.APNsTopic, cfg.APNsSandbox, ratelimit.New(ratelimit.ProviderAPNs, cfg.APNsRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderAPNs)),
+		webPush:       webpush.NewService(cfg.VAPIDSubject, cfg.VAPIDPrivateKey, ratelimit.New(ratelimit.ProviderWebPush, cfg.WebPushRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderWebPush)),
+		verify:        verify.NewService(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioVerifyServiceSID, ratelimit.New(ratelimit.ProviderVerify, cfg.VerifyRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderVerify)),
+		whatsApp:      whatsapp.NewService(cfg.WhatsAppAccessToken, cfg.WhatsAppPhoneNumberID, ratelimit.New(ratelimit.ProviderWhatsApp, cfg.WhatsAppRPS, cfg.RateLimitMaxWait), circuit(ratelimit.ProviderWhatsApp)),
+		files:         filesService,
+		openAI:        openai.NewService(cfg.OpenAIAPIKey, openAILimiter, openAICircuit),
+		transcription: transcriptionService,
+		elevenLabs:    elevenLabs,
+	}
+}
+
+// newDispatcher builds every processor over functions, handlers and svc and
+// registers those cfg enables. With EnabledProcessors only the listed
+// processors are registered.
+func newDispatcher(cfg config.Config, functions processing.FunctionRunner, handlers *processing.HandlerInvoker, svc services) (*processing.Dispatcher, error) {
+	if cfg.SMSDefaultCountry != "" && !sms.SupportedCountry(cfg.SMSDefaultCountry) {
+		return nil, fmt.Errorf("invalid WORKER_SMS_DEFAULT_COUNTRY: unsupported country: %s", cfg.SMSDefaultCountry)
+	}
+	smsOptions := processing.SMSOptions{
+		DefaultCountry:      cfg.SMSDefaultCountry,
+		SuppressionFunction: cfg.SMSSuppressionFunction,
+		MaxSegments:         cfg.SMSMaxSegments,
+		TruncateOverflow:    cfg.SMSSegmentOverflow == "truncate",
+	}
+	engine, err := templates.New(cfg.TemplatesDir, cfg.TemplatesDefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WORKER_TEMPLATES_DIR: %w", err)
+	}
+	processors := []processing.Processor{
+		processing.NewDBFunctionProcessor(functions),
+		processing.NewEmailProcessor(handlers, svc.email, engine, svc.files, cfg.EmailAttachmentsMaxBytes),
+		processing.NewEmailBatchProcessor(handlers, svc.email, engine, cfg.EmailBatchMaxEmails),
+		processing.NewEmailDigestProcessor(handlers, svc.email, engine, functions),
+		processing.NewCalendarInviteProcessor(handlers, svc.email, engine),
+		processing.NewSMSProcessor(handlers, svc.sms, engine, functions, smsOptions),
+		processing.NewFileDeleteProcessor(handlers, svc.files),
+		processing.NewSignedURLPrewarmProcessor(handlers, svc.files),
+		processing.NewImageThumbnailProcessor(handlers, svc.files),
+		processing.NewTaskArchiveProcessor(functions),
+		processing.NewWebhookProcessor(handlers, svc.webhook),
+		processing.NewDiscordMessageProcessor(handlers, svc.discord),
+		processing.NewTelegramMessageProcessor(handlers, svc.telegram, svc.files),
+		processing.NewPushNotificationProcessor(handlers, svc.fcm, svc.apns),
+		processing.NewWebPushProcessor(handlers, svc.webPush),
+		processing.NewVerifyOTPSendProcessor(handlers, svc.verify),
+		processing.NewVerifyOTPCheckProcessor(handlers, svc.verify),
+		processing.NewWhatsAppMessageProcessor(handlers, svc.whatsApp),
+		processing.NewTranscriptionKickoffProcessor(handlers, svc.files, svc.transcription),
+		processing.NewTranscriptionPollProcessor(handlers, svc.elevenLabs),
+		processing.NewTranscriptCleanupProcessor(handlers),
+		processing.NewTranscriptionArchiveProcessor(handlers, svc.files),
+		processing.NewOpenAIResponseCreateProcessor(handlers, svc.openAI),
+		processing.NewOpenAIResponseRetrieveProcessor(handlers, svc.openAI),
+	}
+
+	enabled := make(map[string]bool, len(cfg.EnabledProcessors))
+	for _, taskType := range cfg.EnabledProcessors {
+		enabled[taskType] = true
+	}
+	dispatcher := processing.NewDispatcher()
+	for _, p := range processors {
+		if len(enabled) == 0 || enabled[p.TaskType()] {
+			dispatcher.Register(p)
+			delete(enabled, p.TaskType())
+		}
+	}
+	for taskType := range enabled {
+		return nil, fmt.Errorf("invalid WORKER_ENABLED_PROCESSORS: no processor registered for task type: %s", taskType)
+	}
+
+	for _, taskType := range cfg.DisabledProcessors {
+		if err := dispatcher.Disable(taskType); err != nil {
+			return nil, fmt.Errorf("invalid WORKER_DISABLED_PROCESSORS: %w", err)
+		}
+	}
+	return dispatcher, nil
+}
+
 func (w *Worker) Close() error {
 	return w.db.Close()
 }
 
+// Readiness reports the worker's current readiness for the health server.
+func (w *Worker) Readiness(ctx context.Context) Readiness {
+	r := Readiness{
+		DatabaseReachable: true,
+		Processors:        w.dispatcher.TaskTypes(),
+		Instance:          w.Instance(),
+	}
+
+	if err := w.db.Ping(ctx); err != nil {
+		r.DatabaseReachable = false
+		r.DatabaseError = err.Error()
+	}
+
+	dequeueFresh := false
+	if nanos := w.lastDequeueAt.Load(); nanos != 0 {
+		last := time.Unix(0, nanos).UTC()
+		r.LastDequeueAt = &last
+		dequeueFresh = time.Since(last) <= w.cfg.HealthDequeueStaleAfter
+	}
+
+	r.Ready = r.DatabaseReachable && len(r.Processors) > 0 && dequeueFresh
+	return r
+}
+
+// Processors reports each registered processor and whether it is enabled on
+// this instance and paused fleet-wide.
+func (w *Worker) Processors() []processing.ProcessorStatus {
+	return w.dispatcher.Statuses()
+}
+
+// SetProcessorEnabled enables or disables a processor on this instance at
+// runtime. Disabled task types are not dequeued here; other instances keep
+// processing them.
+func (w *Worker) SetProcessorEnabled(ctx context.Context, taskType string, enabled bool) error {
+	var err error
+	if enabled {
+		err = w.dispatcher.Enable(taskType)
+	} else {
+		err = w.dispatcher.Disable(taskType)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info(ctx, "processor toggled", logger.Fields{
+		"task_type": taskType,
+		"enabled":   enabled,
+		"disabled":  w.dispatcher.Disabled(),
+	})
+	return nil
+}
+
+// RecordSMSDeliveryStatus stores a provider's delivery report through
+// comms.record_sms_delivery_status. Reports for messages the database does
+// not know (e.g. sent before the provider message id was stored) are logged
+// and dropped.
+func (w *Worker) RecordSMSDeliveryStatus(ctx context.Context, status sms.DeliveryStatus) error {
+	payload, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sms delivery status: %w", err)
+	}
+	res, err := w.db.RunFunction(ctx, "comms.record_sms_delivery_status", payload)
+	if err != nil {
+		return err
+	}
+	if res.Status != "succeeded" {
+		logger.Warn(ctx, "sms delivery status not recorded", logger.Fields{
+			"provider":   status.Provider,
+			"message_id": status.MessageID,
+			"status":     status.Status,
+			"result":     res.Status,
+		})
+	}
+	return nil
+}
+
+// RecordEmailDeliveryEvent stores a provider's delivery, bounce or complaint
+// report through comms.record_email_delivery_event. Reports for emails the
+// database does not know (e.g. sent before the provider id was stored) are
+// logged and dropped.
+func (w *Worker) RecordEmailDeliveryEvent(ctx context.Context, event email.DeliveryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal email delivery event: %w", err)
+	}
+	res, err := w.db.RunFunction(ctx, "comms.record_email_delivery_event", payload)
+	if err != nil {
+		return err
+	}
+	if res.Status != "succeeded" {
+		logger.Warn(ctx, "email delivery event not recorded", logger.Fields{
+			"provider":   event.Provider,
+			"message_id": event.MessageID,
+			"event":      event.Event,
+			"result":     res.Status,
+		})
+	}
+	return nil
+}
+
+// RecordSMSOptOut stores a recipient's opt-out or opt-in through
+// comms.record_sms_opt_out.
+func (w *Worker) RecordSMSOptOut(ctx context.Context, optOut sms.OptOut) error {
+	payload, err := json.Marshal(optOut)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sms opt-out: %w", err)
+	}
+	res, err := w.db.RunFunction(ctx, "comms.record_sms_opt_out", payload)
+	if err != nil {
+		return err
+	}
+	if res.Status != "succeeded" {
+		logger.Warn(ctx, "sms opt-out not recorded", logger.Fields{
+			"action": optOut.Action,
+			"source": optOut.Source,
+			"result": res.Status,
+		})
+	}
+	return nil
+}
+
+// markDequeued records a successful dequeue round-trip.
+func (w *Worker) markDequeued() {
+	w.lastDequeueAt.Store(time.Now().UnixNano())
+}
+
 // Run starts the worker loop
 func (w *Worker) Run(ctx context.Context) error {
 	logger.Info(ctx, "starting worker", logger.Fields{
-		"poll_interval": w.cfg.PollInterval,
-		"max_idle_time": w.cfg.MaxIdleTime,
-		"concurrency":   w.cfg.Concurrency,
+		"poll_interval":      w.cfg.PollInterval,
+		"max_idle_time":      w.cfg.MaxIdleTime,
+		"concurrency":        w.cfg.Concurrency,
+		"dequeue_batch_size": w.cfg.DequeueBatchSize,
+		"autoscale":          w.cfg.AutoscaleEnabled,
+		"processors":         w.dispatcher.TaskTypes(),
+		"dry_run":            w.cfg.DryRun,
 	})
 
 	concurrency := w.cfg.Concurrency
@@ -82,63 +534,80 @@ func (w *Worker) Run(ctx context.Context) error {
 		concurrency = 1
 	}
 
+	if w.scheduler != nil {
+		go w.scheduler.Run(ctx)
+	}
+	go w.refreshPaused(ctx)
+
 	var wg sync.WaitGroup
 	errCh := make(chan error, concurrency)
 
-	startWorker := func(workerIndex int) {
-		defer wg.Done()
-		idleStart := time.Now()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-
-			task, err := w.db.DequeueNextTask(ctx)
-			if err != nil {
-				logger.Error(ctx, "failed to dequeue task", err)
-				time.Sleep(w.cfg.PollInterval)
-				continue
-			}
-			if task == nil {
-				if time.Since(idleStart) > w.cfg.MaxIdleTime {
-					// keep alive, but log occasionally
-					logger.Debug(ctx, "worker idle", logger.Fields{"worker": workerIndex})
-				}
-				time.Sleep(w.cfg.PollInterval)
-				continue
-			}
+	// spawn starts one processing goroutine; closing stop makes it exit once
+	// its current task is done. A nil stop never fires.
+	var spawn func(workerIndex int, stop <-chan struct{})
+	if w.cfg.DequeueBatchSize > 1 {
+		// Batch mode: one fetcher claims tasks in bulk and feeds the pool.
+		// The channel is unbuffered so tasks are only handed off when a
+		// goroutine is free, keeping leased-but-idle tasks to a minimum.
+		taskCh := make(chan *types.Task)
+		go w.fetchBatches(ctx, taskCh)
 
-			idleStart = time.Now()
+		spawn = func(workerIndex int, stop <-chan struct{}) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.consumeBatches(ctx, taskCh, stop)
+			}()
+		}
+	} else {
+		spawn = func(workerIndex int, stop <-chan struct{}) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.pollSingle(ctx, workerIndex, stop)
+			}()
+		}
+	}
 
-			if err := w.processTask(ctx, task); err != nil {
-				logger.Error(ctx, "failed to process task", err, logger.Fields{
-					"task_id":   task.TaskID,
-					"task_type": task.TaskType,
-				})
-				if failErr := w.db.FailTask(ctx, task.TaskID, err.Error()); failErr != nil {
-					logger.Error(ctx, "failed to record task failure", failErr)
-				}
-			}
+	for i := 0; i < w.cfg.InteractiveConcurrency; i++ {
+		wg.Add(1)
+		go func(workerIndex int) {
+			defer wg.Done()
+			w.pollInteractive(ctx, workerIndex)
+		}(i)
+	}
 
-			// Always complete the task after processing (success or failure).
-			// Retries are handled by supervisors creating new attempts, not by re-processing
-			// the same queue task. Lease expiry is only for crash recovery (worker dies
-			// mid-processing before reaching this point).
-			if err := w.db.CompleteTask(ctx, task.TaskID); err != nil {
-				logger.Error(ctx, "failed to complete task", err, logger.Fields{
-					"task_id": task.TaskID,
-				})
-			}
+	for _, q := range w.cfg.Queues {
+		for i := 0; i < q.Concurrency; i++ {
+			wg.Add(1)
+			go func(q config.Queue, workerIndex int) {
+				defer wg.Done()
+				w.pollQueue(ctx, q, workerIndex)
+			}(q, i)
 		}
 	}
 
-	wg.Add(concurrency)
-	for i := 0; i < concurrency; i++ {
-		go startWorker(i)
+	for taskType, interval := range w.cfg.TaskTypePollIntervals {
+		wg.Add(1)
+		go func(taskType string, interval time.Duration) {
+			defer wg.Done()
+			w.pollTaskType(ctx, taskType, interval)
+		}(taskType, interval)
 	}
 
+	if w.cfg.AutoscaleEnabled {
+		w.autoscale(ctx, spawn)
+	} else {
+		for i := 0; i < concurrency; i++ {
+			spawn(i, nil)
+		}
+		w.poolSize.Store(int64(concurrency))
+		metrics.WorkerGoroutines.Set(float64(concurrency))
+	}
+
+	// Registered once the pool is sized so the first row has its concurrency.
+	go w.heartbeat(ctx)
+
 	go func() {
 		wg.Wait()
 		close(errCh)
@@ -152,22 +621,449 @@ func (w *Worker) Run(ctx context.Context) error {
 	}
 }
 
+// refreshPaused reloads the paused task types into the dispatcher every
+// PausedRefreshInterval until ctx is canceled. On error the previous set is
+// kept; the dequeue functions filter paused types regardless.
+func (w *Worker) refreshPaused(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PausedRefreshInterval)
+	defer ticker.Stop()
+
+	var previous []string
+	for {
+		paused, err := w.db.PausedTaskTypes(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error(ctx, "failed to load paused task types", err)
+			}
+		} else {
+			if fmt.Sprint(paused) != fmt.Sprint(previous) {
+				logger.Info(ctx, "paused task types changed", logger.Fields{"paused": paused})
+			}
+			w.dispatcher.SetPaused(paused)
+			previous = paused
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollSingle is the default worker loop: each goroutine dequeues and processes
+// one task at a time until ctx is canceled or stop is closed, backing off
+// while the queue is empty.
+func (w *Worker) pollSingle(ctx context.Context, workerIndex int, stop <-chan struct{}) {
+	idle := newIdlePoll(w.cfg.PollInterval, w.cfg.MaxPollInterval)
+	idleStart := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		default:
+		}
+
+		dequeueCtx, span := tracer.Start(ctx, "queues.dequeue")
+		tasks, err := w.dequeue(dequeueCtx, 1)
+		endSpan(span, err)
+		if err != nil {
+			logger.Error(ctx, "failed to dequeue task", err)
+			idle.wait()
+			continue
+		}
+		w.markDequeued()
+		if len(tasks) == 0 {
+			if time.Since(idleStart) > w.cfg.MaxIdleTime {
+				// keep alive, but log occasionally
+				logger.Debug(ctx, "worker idle", logger.Fields{"worker": workerIndex})
+			}
+			idle.wait()
+			continue
+		}
+
+		idle.reset()
+		idleStart = time.Now()
+		w.handleTask(ctx, tasks[0])
+	}
+}
+
+// fetchBatches claims up to DequeueBatchSize tasks per round-trip and hands
+// them to worker goroutines over taskCh. It closes taskCh when ctx is done.
+func (w *Worker) fetchBatches(ctx context.Context, taskCh chan<- *types.Task) {
+	defer close(taskCh)
+
+	idle := newIdlePoll(w.cfg.PollInterval, w.cfg.MaxPollInterval)
+	idleStart := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		dequeueCtx, span := tracer.Start(ctx, "queues.dequeue", trace.WithAttributes(
+			attribute.Int("queue.batch_size", w.cfg.DequeueBatchSize),
+		))
+		tasks, err := w.dequeue(dequeueCtx, w.cfg.DequeueBatchSize)
+		span.SetAttributes(attribute.Int("queue.dequeued", len(tasks)))
+		endSpan(span, err)
+		if err != nil {
+			logger.Error(ctx, "failed to dequeue tasks", err)
+			idle.wait()
+			continue
+		}
+		w.markDequeued()
+		if len(tasks) == 0 {
+			if time.Since(idleStart) > w.cfg.MaxIdleTime {
+				logger.Debug(ctx, "worker idle", logger.Fields{"mode": "batch"})
+			}
+			idle.wait()
+			continue
+		}
+
+		idle.reset()
+		idleStart = time.Now()
+		logger.Debug(ctx, "dequeued task batch", logger.Fields{"count": len(tasks)})
+
+		for i, task := range tasks {
+			select {
+			case taskCh <- task:
+			case <-ctx.Done():
+				// Nothing will process the rest of the batch: give up
+				// their leases so they need not wait for them to expire.
+				w.releaseTasks(ctx, tasks[i:])
+				return
+			}
+		}
+	}
+}
+
+// releaseTasks makes claimed tasks available again right away. It runs on
+// shutdown, so it outlives ctx for a few seconds.
+func (w *Worker) releaseTasks(ctx context.Context, tasks []*types.Task) {
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	for _, task := range tasks {
+		if err := w.db.DeferTask(releaseCtx, task.TaskID, time.Now()); err != nil {
+			logger.Warn(ctx, "failed to release claimed task", logger.Fields{
+				"task_id": task.TaskID,
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
+// consumeBatches processes tasks handed off by fetchBatches until taskCh is
+// closed or stop is closed.
+func (w *Worker) consumeBatches(ctx context.Context, taskCh <-chan *types.Task, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case task, ok := <-taskCh:
+			if !ok {
+				return
+			}
+			// A handoff can race shutdown; a canceled task could not be
+			// recorded or completed.
+			if ctx.Err() != nil {
+				w.releaseTasks(ctx, []*types.Task{task})
+				return
+			}
+			w.handleTask(ctx, task)
+		}
+	}
+}
+
+// handleTask processes a claimed task, records any failure, and completes it.
+// Tasks of a paused type, or whose payload asks for a later delivery time, are
+// deferred instead.
+// Lifecycle transitions are appended to the task's event timeline, and the
+// outcome is summarized in one "task finished" log line.
+func (w *Worker) handleTask(ctx context.Context, task *types.Task) {
+	defer w.inFlight.start(task.TaskType)()
+	dequeuedAt := time.Now()
+
+	// Log, and forward to the files service, under the originating request.
+	if requestID := task.RequestID(); requestID != "" {
+		ctx = logger.WithRequestID(ctx, requestID)
+	}
+	ctx = w.events.WithTask(ctx, task.TaskID)
+	ctx = processing.WithProgress(ctx, processing.NewProgressReporter(w.db, task.TaskID))
+	ctx = processing.WithSideEffectClaims(ctx)
+	ctx = processing.WithHandlerTimings(ctx)
+	events.Record(ctx, events.Dequeued, events.Details{
+		"task_type":          task.TaskType,
+		"worker_instance_id": w.instance.ID,
+	})
+
+	status := outcomeDeferred
+	var err error
+	var elapsed time.Duration
+	defer func() { logOutcome(ctx, task, status, err, dequeuedAt, elapsed) }()
+
+	if w.deferIfPaused(ctx, task) || w.deferIfEarly(ctx, task) {
+		return
+	}
+
+	processStart := time.Now()
+	err = w.processTask(ctx, task)
+	elapsed = time.Since(processStart)
+
+	// A call refused by an open circuit breaker, or that the provider asked
+	// to retry later, is not a failure: the task has been re-leased until
+	// then and is neither recorded nor completed.
+	var deferred *deferredError
+	if errors.As(err, &deferred) {
+		return
+	}
+
+	// A success whose transaction failed is left leased, not failed: the
+	// task runs again after its lease expires.
+	var uncommitted *uncommittedError
+	if errors.As(err, &uncommitted) {
+		status = outcomeUncommitted
+		logger.Error(ctx, "failed to commit task success", uncommitted.err, logger.Fields{
+			"task_id":   task.TaskID,
+			"task_type": task.TaskType,
+		})
+		return
+	}
+
+	var validation *types.ValidationError
+	if errors.As(err, &validation) {
+		status = outcomeValidationFailed
+		// Rejected input is an outcome, not an operational failure: it is
+		// not recorded in queues.error and the task is completed below.
+		logger.Warn(ctx, "task input failed validation", logger.Fields{
+			"task_id":            task.TaskID,
+			"task_type":          task.TaskType,
+			"validation_failure": validation.Message,
+		})
+		events.Record(ctx, events.ValidationFailed, events.Details{"message": validation.Message})
+	} else if err != nil {
+		status = outcomeFailed
+		logger.Error(ctx, "failed to process task", err, logger.Fields{
+			"task_id":     task.TaskID,
+			"task_type":   task.TaskType,
+			"error_class": types.ErrorClassName(err),
+		})
+		events.Record(ctx, events.Failed, events.Details{"error": err.Error(), "error_class": types.ErrorClassName(err)})
+		if failErr := w.db.FailTask(ctx, task.TaskID, err.Error()); failErr != nil {
+			logger.Error(ctx, "failed to record task failure", failErr)
+		}
+	} else {
+		status = outcomeSucceeded
+		events.Record(ctx, events.Succeeded, nil)
+	}
+
+	// A retryable failure with retry budget left has already been re-leased
+	// until its retry time; leave it uncompleted so it is dequeued again.
+	var retry *retryScheduledError
+	if errors.As(err, &retry) {
+		status = outcomeRetryScheduled
+		return
+	}
+
+	// Otherwise complete the task after processing (success or failure).
+	// A succeeded task was already completed in its success transaction;
+	// completing it again is a no-op.
+	// Business-level retries are handled by supervisors creating new attempts,
+	// not by re-processing the same queue task. Lease expiry is only for crash
+	// recovery (worker dies mid-processing before reaching this point).
+	if err := w.db.CompleteTask(ctx, task.TaskID); err != nil {
+		logger.Error(ctx, "failed to complete task", err, logger.Fields{
+			"task_id": task.TaskID,
+		})
+	}
+}
+
+// deferIfPaused re-leases a task whose type was paused, or whose processor was
+// disabled on this instance, after it was claimed, so it stays queued without
+// being processed. It reports whether the task must
+// not be processed now.
+func (w *Worker) deferIfPaused(ctx context.Context, task *types.Task) bool {
+	if !w.dispatcher.Paused(task.TaskType) {
+		return false
+	}
+
+	until := time.Now().Add(w.cfg.PausedRefreshInterval)
+	if err := w.db.DeferTask(ctx, task.TaskID, until); err != nil {
+		logger.Error(ctx, "failed to defer task of paused type", err, logger.Fields{
+			"task_id":   task.TaskID,
+			"task_type": task.TaskType,
+		})
+		return true
+	}
+
+	events.Record(ctx, events.Deferred, events.Details{"reason": "task_type_paused", "deliver_at": until})
+	logger.Info(ctx, "task type paused; task deferred", logger.Fields{
+		"task_id":   task.TaskID,
+		"task_type": task.TaskType,
+		"until":     until,
+	})
+	return true
+}
+
+// deferIfEarly re-leases the task until its payload's not_before/deliver_at
+// when that time is still in the future. It reports whether the task must not
+// be processed now. If the deferral cannot be recorded the task is left under
+// its current lease so it is retried after expiry rather than sent early.
+func (w *Worker) deferIfEarly(ctx context.Context, task *types.Task) bool {
+	var payload types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &payload); err != nil {
+		return false
+	}
+
+	deliverAt := payload.DeliveryTime()
+	if deliverAt.IsZero() || !deliverAt.After(time.Now()) {
+		return false
+	}
+
+	if err := w.db.DeferTask(ctx, task.TaskID, deliverAt); err != nil {
+		logger.Error(ctx, "failed to defer task", err, logger.Fields{
+			"task_id":    task.TaskID,
+			"deliver_at": deliverAt,
+		})
+		return true
+	}
+
+	events.Record(ctx, events.Deferred, events.Details{"deliver_at": deliverAt})
+	logger.Info(ctx, "task deferred until delivery time", logger.Fields{
+		"task_id":    task.TaskID,
+		"task_type":  task.TaskType,
+		"deliver_at": deliverAt,
+	})
+	return true
+}
+
 // processTask processes a single task based on its type
-func (w *Worker) processTask(ctx context.Context, task *types.Task) error {
+func (w *Worker) processTask(ctx context.Context, task *types.Task) (err error) {
 	logger.Info(ctx, "processing task", logger.Fields{
 		"task_id":      task.TaskID,
 		"task_type":    task.TaskType,
 		"scheduled_at": task.ScheduledAt,
 	})
 
+	ctx, span := tracer.Start(ctx, "task.process", trace.WithAttributes(
+		attribute.Int64("task.id", task.TaskID),
+		attribute.String("task.type", task.TaskType),
+		attribute.String("request.id", task.RequestID()),
+	))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	if !task.EnqueuedAt.IsZero() {
+		metrics.TaskQueueWait.WithLabelValues(task.TaskType).Observe(start.Sub(task.EnqueuedAt).Seconds())
+	}
+	defer func() {
+		metrics.ObserveSince(metrics.TaskProcessingDuration.WithLabelValues(task.TaskType), start)
+		metrics.TasksProcessed.WithLabelValues(task.TaskType, metrics.Status(err)).Inc()
+	}()
+
+	if err := w.resolvePayload(ctx, task); err != nil {
+		return err
+	}
+
 	processor, err := w.dispatcher.Get(task)
 	if err != nil {
 		return err
 	}
-	result := processor.Process(ctx, task)
+
+	// Malformed payloads fail fast, before any handler or provider call.
+	if err := w.dispatcher.Validate(processor, task); err != nil {
+		return w.handleTaskResult(ctx, task, types.NewTaskFailure(err))
+	}
+
+	processCtx, processSpan := tracer.Start(ctx, "processor.process")
+	result := safeProcess(processCtx, processor, task)
+	endSpan(processSpan, result.Error)
+
 	return w.handleTaskResult(ctx, task, result)
 }
 
+// resolvePayload replaces an offloaded task payload with its full contents.
+// Producers store payloads above the queue's size budget (e.g. multi-megabyte
+// transcript webhooks) as a file and enqueue a small stub carrying routing
+// fields plus payload_file_id. The file must hold a JSON object; fields in the
+// stub take precedence so routing cannot be changed by the stored object.
+func (w *Worker) resolvePayload(ctx context.Context, task *types.Task) error {
+	var stub types.TaskPayload
+	if err := json.Unmarshal(task.Payload, &stub); err != nil || stub.PayloadFileID == nil {
+		return nil
+	}
+	fileID := *stub.PayloadFileID
+
+	body, err := w.filesSvc.OpenFile(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch offloaded payload: %w", err)
+	}
+	defer body.Close()
+
+	maxBytes := w.cfg.OffloadedPayloadMaxBytes
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read offloaded payload: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return fmt.Errorf("offloaded payload file %d exceeds %d bytes", fileID, maxBytes)
+	}
+
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(data, &merged); err != nil || merged == nil {
+		return fmt.Errorf("offloaded payload file %d is not a JSON object", fileID)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(task.Payload, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal task payload: %w", err)
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	resolved, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resolved payload: %w", err)
+	}
+
+	logger.Info(ctx, "resolved offloaded task payload", logger.Fields{
+		"task_id":         task.TaskID,
+		"payload_file_id": fileID,
+		"bytes":           len(data),
+	})
+	task.Payload = resolved
+	return nil
+}
+
+// safeProcess runs processor.Process and converts a panic into a task failure
+// so a single bad task cannot take down the worker goroutine. The failure then
+// flows through the error handler and queues.fail_task like any other.
+func safeProcess(ctx context.Context, processor processing.Processor, task *types.Task) (result *types.TaskResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error(ctx, "processor panicked", fmt.Errorf("%v", r), logger.Fields{
+				"task_id":   task.TaskID,
+				"task_type": task.TaskType,
+				"stack":     string(debug.Stack()),
+			})
+			result = types.NewTaskFailure(fmt.Errorf("processor panic: %v", r))
+		}
+	}()
+	return processor.Process(ctx, task)
+}
+
+// endSpan records err on span (if any) and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // handleTaskResult handles the result of a task by calling appropriate handlers
 func (w *Worker) handleTaskResult(ctx context.Context, task *types.Task, result *types.TaskResult) error {
 	// Parse task payload to get handler names
@@ -176,23 +1072,328 @@ func (w *Worker) handleTaskResult(ctx context.Context, task *types.Task, result
 		return fmt.Errorf("failed to unmarshal task payload: %w", err)
 	}
 
+	if result.Skipped {
+		events.Record(ctx, events.SkippedDuplicate, nil)
+		return nil
+	}
+
+	if result.ValidationFailure != "" {
+		w.handleValidationFailure(ctx, task, payload, result.ValidationFailure)
+		return &types.ValidationError{Message: result.ValidationFailure}
+	}
+
+	if !result.RescheduleAt.IsZero() {
+		if at, ok := w.reschedule(ctx, task, result); ok {
+			return &deferredError{err: result.Error, at: at}
+		}
+		// Over the reschedule cap, or it could not be recorded: handle the
+		// provider's response as a regular rate-limited failure below.
+	}
+
 	if result.Success {
-		if payload.SuccessHandler != "" {
-			if err := w.handlers.CallSuccess(ctx, payload.SuccessHandler, task.Payload, result.WorkerPayload); err != nil {
-				logger.Error(ctx, "success handler failed", err)
-			}
+		if err := w.completeSucceeded(ctx, task, payload, result); err != nil {
+			return &uncommittedError{err: err}
 		}
+		w.ops.Succeeded(task.TaskType)
 	} else {
+		failure := result.Error
+		attempt, maxAttempts := w.attempts(ctx, task)
+		switch types.ErrorClass(failure) {
+		case types.ErrUnavailable:
+			if at, ok := w.deferUnavailable(ctx, task, failure); ok {
+				return &deferredError{err: failure, at: at}
+			}
+			// Could not reschedule cleanly; spend a retry instead.
+			if at, ok := w.scheduleRetry(ctx, task, failure, attempt, maxAttempts); ok {
+				w.ops.Failed(ctx, task, failure, attempt, maxAttempts, false)
+				return &retryScheduledError{err: failure, at: at}
+			}
+		case types.ErrRetryable, types.ErrRateLimited:
+			if at, ok := w.scheduleRetry(ctx, task, failure, attempt, maxAttempts); ok {
+				w.ops.Failed(ctx, task, failure, attempt, maxAttempts, false)
+				return &retryScheduledError{err: failure, at: at}
+			}
+		case types.ErrPermanent:
+			if err := w.db.DeadLetterTask(ctx, task.TaskID, types.ErrorClassName(failure), failure.Error()); err != nil {
+				logger.Error(ctx, "failed to dead-letter task", err, logger.Fields{"task_id": task.TaskID})
+			} else {
+				events.Record(ctx, events.DeadLettered, events.Details{"error": failure.Error()})
+			}
+		}
+		w.ops.Failed(ctx, task, failure, attempt, maxAttempts, true)
+
 		if payload.ErrorHandler != "" {
-			if err := w.handlers.CallError(ctx, payload.ErrorHandler, task.Payload, result.Error.Error()); err != nil {
+			if err := w.handlers.CallError(ctx, payload.ErrorHandler, task.Payload, failure, attempt, maxAttempts); err != nil {
 				logger.Error(ctx, "error handler failed", err)
 			}
 		}
-		return result.Error
+		return failure
 	}
 
 	return nil
 }
 
+// completeSucceeded records a succeeded task's result, runs its success
+// handler, enqueues its follow-up tasks and completes it in one transaction,
+// so a crash after the provider call cannot complete the task without the
+// facts the handler records, or record them for a task that runs again.
+//
+// As before, a failed result write, success handler or enqueue is logged and
+// does not fail the task: each runs in a savepoint that is rolled back on its
+// own. Only a failure to complete or commit undoes the whole transaction.
+func (w *Worker) completeSucceeded(ctx context.Context, task *types.Task, payload types.TaskPayload, result *types.TaskResult) error {
+	return w.db.WithTx(ctx, func(tx *database.Client) error {
+		// Kept for every task type, including those without a success
+		// handler.
+		err := tx.WithTx(ctx, func(sp *database.Client) error {
+			return sp.RecordResult(ctx, task.TaskID, result.WorkerPayload)
+		})
+		if err != nil {
+			logger.Error(ctx, "failed to record task result", err, logger.Fields{"task_id": task.TaskID})
+		}
+
+		nextTasks := result.NextTasks
+		if payload.SuccessHandler != "" {
+			var handlerNext []types.NextTask
+			err := tx.WithTx(ctx, func(sp *database.Client) (err error) {
+				handlerNext, err = w.handlers.WithDB(sp).CallSuccess(ctx, payload.SuccessHandler, task.Payload, result.WorkerPayload)
+				return err
+			})
+			if err != nil {
+				logger.Error(ctx, "success handler failed", err)
+			}
+			nextTasks = append(nextTasks, handlerNext...)
+		}
+		w.enqueueNextTasks(ctx, tx, task, nextTasks)
+
+		return tx.CompleteTask(ctx, task.TaskID)
+	})
+}
+
+// handleValidationFailure routes a validation failure to the task's
+// validation_handler. Tasks without one fall back to the error_handler with
+// error_class "validation", so existing handlers still record the attempt.
+func (w *Worker) handleValidationFailure(ctx context.Context, task *types.Task, payload types.TaskPayload, message string) {
+	if payload.ValidationHandler != "" {
+		if err := w.handlers.CallValidation(ctx, payload.ValidationHandler, task.Payload, message); err != nil {
+			logger.Error(ctx, "validation handler failed", err)
+		}
+		return
+	}
+	if payload.ErrorHandler != "" {
+		// Rejected input is never retried, so no attempt is reported.
+		if err := w.handlers.CallError(ctx, payload.ErrorHandler, task.Payload, &types.ValidationError{Message: message}, 0, 0); err != nil {
+			logger.Error(ctx, "error handler failed", err)
+		}
+	}
+}
+
+// enqueueNextTasks enqueues the follow-up tasks a succeeded task declared. The
+// database links them to the task's chain and refuses chains deeper than
+// cfg.MaxChainDepth; failures are logged and recorded but do not fail the task.
+// The tasks are enqueued in a savepoint of tx, the task's success transaction.
+func (w *Worker) enqueueNextTasks(ctx context.Context, tx *database.Client, task *types.Task, nextTasks []types.NextTask) {
+	if len(nextTasks) == 0 {
+		return
+	}
+
+	var enqueued int
+	err := tx.WithTx(ctx, func(sp *database.Client) (err error) {
+		enqueued, err = sp.EnqueueNextTasks(ctx, task.TaskID, nextTasks, w.cfg.MaxChainDepth)
+		return err
+	})
+	if err != nil {
+		logger.Error(ctx, "failed to enqueue next tasks", err, logger.Fields{
+			"task_id":    task.TaskID,
+			"next_tasks": len(nextTasks),
+		})
+		events.Record(ctx, events.ChainRejected, events.Details{"error": err.Error(), "next_tasks": len(nextTasks)})
+		return
+	}
+
+	logger.Info(ctx, "next tasks enqueued", logger.Fields{
+		"task_id":  task.TaskID,
+		"enqueued": enqueued,
+	})
+	events.Record(ctx, events.Chained, events.Details{"enqueued": enqueued})
+}
+
+// retryScheduledError reports a failure the worker will retry itself: the
+// task has been re-leased until at and must not be completed.
+type retryScheduledError struct {
+	err error
+	at  time.Time
+}
+
+func (e *retryScheduledError) Error() string {
+	return fmt.Sprintf("%s (retry scheduled at %s)", e.err.Error(), e.at.Format(time.RFC3339))
+}
+
+func (e *retryScheduledError) Unwrap() error { return e.err }
+
+// uncommittedError reports a succeeded task whose success transaction failed:
+// nothing it recorded was kept and the task was not completed, so it runs
+// again once its lease expires.
+type uncommittedError struct {
+	err error
+}
+
+func (e *uncommittedError) Error() string {
+	return fmt.Sprintf("task success not committed: %s", e.err.Error())
+}
+
+func (e *uncommittedError) Unwrap() error { return e.err }
+
+// deferredError reports a provider call refused by an open circuit breaker
+// or rescheduled at the provider's request: the task was re-leased until at
+// without recording a failure.
+type deferredError struct {
+	err error
+	at  time.Time
+}
+
+func (e *deferredError) Error() string {
+	return fmt.Sprintf("%s (deferred until %s)", e.err.Error(), e.at.Format(time.RFC3339))
+}
+
+func (e *deferredError) Unwrap() error { return e.err }
+
+// deferUnavailable re-leases a task whose provider call was refused by an open
+// circuit breaker until the breaker half-opens. The call never went out, so
+// the idempotency key this run claimed is released first and no failure is
+// recorded; the retry budget is untouched. It reports false when either step
+// fails, in which case the failure is handled like a retryable one.
+func (w *Worker) deferUnavailable(ctx context.Context, task *types.Task, failure error) (time.Time, bool) {
+	if err := w.handlers.ReleaseSideEffect(ctx, task); err != nil {
+		logger.Error(ctx, "failed to release idempotency key", err, logger.Fields{"task_id": task.TaskID})
+		return time.Time{}, false
+	}
+
+	at := time.Now().Add(max(types.RetryAfter(failure), time.Second))
+	if err := w.db.DeferTask(ctx, task.TaskID, at); err != nil {
+		logger.Error(ctx, "failed to defer task behind open circuit", err, logger.Fields{"task_id": task.TaskID})
+		return time.Time{}, false
+	}
+
+	events.Record(ctx, events.Deferred, events.Details{
+		"reason":     "circuit_open",
+		"deliver_at": at,
+		"error":      failure.Error(),
+	})
+	logger.Info(ctx, "provider circuit open; task deferred", logger.Fields{
+		"task_id":   task.TaskID,
+		"task_type": task.TaskType,
+		"until":     at,
+	})
+	return at, true
+}
+
+// reschedule re-leases a task until result.RescheduleAt, as the provider
+// asked, via queues.reschedule_task. Like deferUnavailable it releases the
+// idempotency key this run claimed, since the provider refused the call, and
+// records no failure. It reports false once the task was rescheduled
+// MaxReschedules times or when either step fails.
+func (w *Worker) reschedule(ctx context.Context, task *types.Task, result *types.TaskResult) (time.Time, bool) {
+	if err := w.handlers.ReleaseSideEffect(ctx, task); err != nil {
+		logger.Error(ctx, "failed to release idempotency key", err, logger.Fields{"task_id": task.TaskID})
+		return time.Time{}, false
+	}
+
+	at := result.RescheduleAt
+	rescheduled, err := w.db.RescheduleTask(ctx, task.TaskID, at, "provider_retry_after", w.cfg.MaxReschedules)
+	if err != nil {
+		logger.Error(ctx, "failed to reschedule task", err, logger.Fields{"task_id": task.TaskID})
+		return time.Time{}, false
+	}
+	if !rescheduled {
+		logger.Warn(ctx, "task reschedule limit reached", logger.Fields{
+			"task_id":         task.TaskID,
+			"max_reschedules": w.cfg.MaxReschedules,
+		})
+		return time.Time{}, false
+	}
+
+	details := events.Details{"reason": "provider_retry_after", "deliver_at": at}
+	if result.Error != nil {
+		details["error"] = result.Error.Error()
+	}
+	events.Record(ctx, events.Deferred, details)
+	logger.Info(ctx, "provider asked to retry later; task rescheduled", logger.Fields{
+		"task_id":   task.TaskID,
+		"task_type": task.TaskType,
+		"until":     at,
+	})
+	return at, true
+}
+
+// maxAttempts returns how many times a task of taskType may run:
+// TaskTypeMaxAttempts for its type, or one more than MaxTaskRetries.
+func (w *Worker) maxAttempts(taskType string) int {
+	if n, ok := w.cfg.TaskTypeMaxAttempts[taskType]; ok {
+		return n
+	}
+	return w.cfg.MaxTaskRetries + 1
+}
+
+// attempts returns the attempt a failed task is on (its failures recorded so
+// far plus this one) and its maximum attempts. attempt is 0 when the
+// failures cannot be counted.
+func (w *Worker) attempts(ctx context.Context, task *types.Task) (attempt, maxAttempts int) {
+	maxAttempts = w.maxAttempts(task.TaskType)
+	failures, err := w.db.CountTaskErrors(ctx, task.TaskID)
+	if err != nil {
+		logger.Error(ctx, "failed to count task errors", err, logger.Fields{"task_id": task.TaskID})
+		return 0, maxAttempts
+	}
+	return failures + 1, maxAttempts
+}
+
+// scheduleRetry re-leases a task that failed with a retryable or rate-limited
+// error on the given attempt, using exponential backoff on the failures
+// already recorded (or the provider's Retry-After when longer). It reports
+// false when maxAttempts is reached, the attempt is unknown or the retry
+// cannot be recorded, in which case the failure goes to the error handler.
+func (w *Worker) scheduleRetry(ctx context.Context, task *types.Task, failure error, attempt, maxAttempts int) (time.Time, bool) {
+	if attempt == 0 {
+		return time.Time{}, false
+	}
+	if attempt >= maxAttempts {
+		logger.Warn(ctx, "task retry budget exhausted", logger.Fields{
+			"task_id":      task.TaskID,
+			"task_type":    task.TaskType,
+			"attempt":      attempt,
+			"max_attempts": maxAttempts,
+		})
+		return time.Time{}, false
+	}
+	failures := attempt - 1
+
+	delay := w.cfg.MaxRetryDelay
+	if failures < 30 {
+		delay = min(w.cfg.RetryBaseDelay<<failures, w.cfg.MaxRetryDelay)
+	}
+	if retryAfter := types.RetryAfter(failure); retryAfter > delay {
+		delay = retryAfter
+	}
+	at := time.Now().Add(delay)
+
+	if err := w.db.DeferTask(ctx, task.TaskID, at); err != nil {
+		logger.Error(ctx, "failed to schedule task retry", err, logger.Fields{"task_id": task.TaskID})
+		return time.Time{}, false
+	}
+
+	events.Record(ctx, events.RetryScheduled, events.Details{
+		"attempt":     attempt,
+		"retry_at":    at,
+		"error_class": types.ErrorClassName(failure),
+	})
+	logger.Info(ctx, "task retry scheduled", logger.Fields{
+		"task_id":  task.TaskID,
+		"attempt":  attempt,
+		"retry_at": at,
+	})
+	return at, true
+}
+
 // processDBFunctionTask handles database function (supervisor) tasks
 // Removed per-processor implementations and handler calls in favor of processing package.